@@ -2,61 +2,232 @@ package main
 
 import (
 	"internal-transfers/internal/api"
+	"internal-transfers/internal/calendar"
 	"internal-transfers/internal/config"
 	"internal-transfers/internal/db"
 	"internal-transfers/internal/services"
 
 	"context"
+	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
-	"time"
+	// The runtime image has no time zone database
+	_ "time/tzdata"
 
 	"github.com/kataras/iris/v12"
 )
 
+const usage = `Usage: internal-transfers [command] [flags]
+
+Commands:
+  serve                 Run the HTTP API server (default)
+  migrate up            Apply all pending schema migrations
+  migrate down [N]      Revert the last N applied migrations (default 1)
+  migrate status        List migrations and whether they are applied
+  config print          Print the effective configuration (--redacted masks secrets)
+
+Run "internal-transfers serve -h" to list the configuration flags.
+`
+
 func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig()
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "migrate":
+		err = runMigrate(args)
+	case "config":
+		err = runConfig(args)
+	default:
+		print(usage)
+		os.Exit(2)
+	}
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
 	if err != nil {
-		println("Config error:", err.Error())
+		println("Error:", err.Error())
 		os.Exit(1)
 	}
+}
 
-	// Initialize database connection
-	dbConn, err := db.NewDBConnectionFromDSN(cfg.DBUrl)
+// runServe runs the HTTP API until SIGINT or SIGTERM is received
+func runServe(args []string) error {
+	// Load configuration
+	cfg, err := config.LoadConfig(args)
 	if err != nil {
-		println("Database connection error:", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("config: %w", err)
+	}
+
+	// Graceful shutdown setup
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cal, err := newCalendar(cfg.Calendar)
+	if err != nil {
+		return fmt.Errorf("calendar: %w", err)
+	}
+
+	// Initialize storage
+	store, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	// Initialize services
+	serviceOpts := []services.AccountServiceOption{
+		services.WithMaxPrecision(cfg.Money.Precision),
+		services.WithSingleStatementTransfer(cfg.Database.SingleStatementTransfer),
+	}
+	if cfg.Fees.AccountID > 0 {
+		serviceOpts = append(serviceOpts, services.WithFees(store.feeSchedules, cfg.Fees.AccountID))
+	}
+	service := services.NewAccountService(store.accounts, serviceOpts...)
+	var accounts services.AccountServicePort = service
+	var groupCommit *services.GroupCommitService
+	if cfg.Transfers.GroupCommit {
+		groupCommit = services.NewGroupCommitService(service, services.GroupCommitOptions{
+			MaxBatch:  cfg.Transfers.GroupCommitMaxBatch,
+			MaxWait:   cfg.Transfers.GroupCommitMaxWait,
+			QueueSize: cfg.Transfers.GroupCommitQueueSize,
+		})
+		accounts = groupCommit
+	}
+	asyncTransfers := services.NewAsyncTransferService(service, store.transfers, services.AsyncTransferOptions{
+		Workers:          cfg.Transfers.AsyncWorkers,
+		BatchSize:        cfg.Transfers.AsyncBatchSize,
+		PollInterval:     cfg.Transfers.AsyncPollInterval,
+		Lease:            cfg.Transfers.AsyncLease,
+		RetryInterval:    cfg.Transfers.ScheduledRetryInterval,
+		MaxMetadataBytes: cfg.Transfers.MaxMetadataBytes,
+		Calendar:         cal,
+		GroupCommit:      groupCommit,
+	})
+	standingOrders := services.NewStandingOrderService(service, store.standingOrders, cfg.Transfers.StandingOrderInterval, cal)
+	balanceRules := services.NewBalanceRuleService(service, store.balanceRules, cfg.Transfers.BalanceRuleInterval, cal)
+	handlerOpts := []api.AccountHandlerOption{
+		api.WithTransferService(asyncTransfers),
+		api.WithStandingOrderService(standingOrders),
+		api.WithBalanceRuleService(balanceRules),
+		api.WithCalendar(cal),
+	}
+	var interest *services.InterestService
+	if cfg.Interest.HouseAccountID > 0 {
+		interest = services.NewInterestService(service, store.interest, cfg.Interest.HouseAccountID, cfg.Interest.Interval, cal)
+		handlerOpts = append(handlerOpts, api.WithInterestService(interest))
 	}
-	defer dbConn.Close()
+	if cfg.Fees.AccountID > 0 {
+		handlerOpts = append(handlerOpts, api.WithFeeService(services.NewFeeService(service, store.feeSchedules)))
+	}
+	clearingAccountIDs, _ := cfg.Clearing.AccountIDList()
+	if len(clearingAccountIDs) > 0 {
+		external := services.NewExternalTransferService(service, store.external, clearingAccountIDs)
+		if err := external.OpenClearingAccounts(); err != nil {
+			return err
+		}
+		handlerOpts = append(handlerOpts, api.WithExternalTransferService(external))
+	}
+	handler := api.NewAccountHandler(accounts, handlerOpts...)
 
-	// Initialize repositories and services
-	repo := db.NewAccountRepository(dbConn)
-	service := services.NewAccountService(repo)
-	handler := api.NewAccountHandler(service)
+	// Background workers, waited for before the storage is closed
+	var workers sync.WaitGroup
+	startWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
+	if groupCommit != nil {
+		startWorker(groupCommit.Run)
+	}
+	startWorker(asyncTransfers.Run)
+	if cfg.Transfers.StandingOrderInterval > 0 {
+		startWorker(standingOrders.Run)
+	}
+	startWorker(balanceRules.Run)
+	if interest != nil && cfg.Interest.Interval > 0 {
+		startWorker(interest.Run)
+	}
+	if sharding, ok := store.accounts.(db.BalanceShardingPort); ok && cfg.Database.ShardCompactionInterval > 0 {
+		startWorker(services.NewBalanceCompactor(sharding, cfg.Database.ShardCompactionInterval).Run)
+	}
 
 	// Create and configure the Iris application
 	app := iris.New()
 
-	api.RegisterRoutes(app, handler)
-
-	// Graceful shutdown setup
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	api.RegisterRoutes(app, handler, api.WithBodyLimit(cfg.Server.BodyLimit))
+	api.RegisterHealthRoutes(app, api.NewHealthHandler(store.health))
 
 	go func() {
-		if err := app.Listen(":"+cfg.ServerPort, iris.WithoutInterruptHandler); err != nil {
+		srv := &http.Server{
+			Addr:         ":" + cfg.Server.Port,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+		}
+		if err := app.Run(iris.Server(srv), iris.WithoutInterruptHandler, iris.WithoutServerError(iris.ErrServerClosed)); err != nil {
 			app.Logger().Fatalf("Server error: %v", err)
 		}
 	}()
 
-	<-quit
+	<-ctx.Done()
 	app.Logger().Info("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
-	if err := app.Shutdown(ctx); err != nil {
-		app.Logger().Fatalf("Server forced to shutdown: %v", err)
+	err = app.Shutdown(shutdownCtx)
+	// The group commit worker commits the transfers still queued before it returns
+	workers.Wait()
+	if err != nil {
+		return fmt.Errorf("server forced to shutdown: %w", err)
+	}
+	return nil
+}
+
+// newCalendar builds the business day calendar and loads its holiday files
+func newCalendar(cfg config.CalendarConfig) (*calendar.Calendar, error) {
+	loc, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	cutoff, err := cfg.CutoffOffset()
+	if err != nil {
+		return nil, err
+	}
+	opts := calendar.Options{Location: loc, Cutoff: cutoff, Rule: calendar.Rule(cfg.BusinessDayRule)}
+	for _, path := range cfg.HolidayFilePaths() {
+		holidays, err := calendar.LoadHolidays(path)
+		if err != nil {
+			return nil, err
+		}
+		opts.Holidays = append(opts.Holidays, holidays...)
+	}
+	return calendar.New(opts), nil
+}
+
+// runConfig executes the "config print" subcommand
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("unknown config action (expected: config print)")
+	}
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	redacted := fs.Bool("redacted", false, "mask secret values")
+	cfg, err := config.LoadConfigWithFlags(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
 	}
+	return cfg.Print(os.Stdout, *redacted)
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"internal-transfers/internal/config"
+	"internal-transfers/internal/db"
+
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runMigrate executes the "migrate up|down|status" subcommands
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate action (up, down or status)")
+	}
+	action, args := args[0], args[1:]
+	steps := 1
+	if action == "down" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid number of steps %q", args[0])
+		}
+		steps, args = n, args[1:]
+	}
+
+	cfg, err := config.LoadConfig(args)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if cfg.Database.Driver != config.DriverPostgres {
+		return fmt.Errorf("migrations only apply to the %s driver", config.DriverPostgres)
+	}
+	dbConn, err := openDB(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	ctx := context.Background()
+	migrator, err := db.NewMigrator(dbConn)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migration(s)\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+	return nil
+}
+
+// migrateUp applies pending migrations at startup
+func migrateUp(dbConn *pgxpool.Pool) error {
+	migrator, err := db.NewMigrator(dbConn)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(context.Background())
+	return err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"internal-transfers/internal/api"
+	"internal-transfers/internal/config"
+	"internal-transfers/internal/db"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// storage bundles the repositories of the configured database driver
+type storage struct {
+	accounts       db.AccountRepositoryPort
+	transfers      db.TransferRepositoryPort
+	standingOrders db.StandingOrderRepositoryPort
+	balanceRules   db.BalanceRuleRepositoryPort
+	interest       db.InterestRepositoryPort
+	feeSchedules   db.FeeScheduleRepositoryPort
+	external       db.ExternalTransferRepositoryPort
+	health         api.PoolHealthSource
+	close          func()
+}
+
+// openStorage initializes the repositories for cfg.Database.Driver
+func openStorage(ctx context.Context, cfg *config.Config) (*storage, error) {
+	if cfg.Database.Driver == config.DriverMemory {
+		log.Printf("Using the in-memory store, data is not persisted")
+		mem := db.NewMemoryStore()
+		return &storage{
+			accounts:       db.NewMemoryAccountRepository(mem),
+			transfers:      db.NewMemoryTransferRepository(mem),
+			standingOrders: db.NewMemoryStandingOrderRepository(mem),
+			balanceRules:   db.NewMemoryBalanceRuleRepository(mem),
+			interest:       db.NewMemoryInterestRepository(mem),
+			feeSchedules:   db.NewMemoryFeeScheduleRepository(mem),
+			external:       db.NewMemoryExternalTransferRepository(mem),
+			health:         memoryHealth{},
+			close:          func() {},
+		}, nil
+	}
+
+	// Initialize database connection
+	dbConn, err := openDB(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AutoMigrate {
+		if err := migrateUp(dbConn); err != nil {
+			dbConn.Close()
+			return nil, fmt.Errorf("migration: %w", err)
+		}
+	}
+
+	monitor := db.NewPoolMonitor(dbConn, cfg.Database.HealthInterval, cfg.Database.SaturationWarn)
+	go monitor.Run(ctx)
+
+	return &storage{
+		accounts:       db.NewAccountRepository(dbConn),
+		transfers:      db.NewTransferRepository(dbConn),
+		standingOrders: db.NewStandingOrderRepository(dbConn),
+		balanceRules:   db.NewBalanceRuleRepository(dbConn),
+		interest:       db.NewInterestRepository(dbConn),
+		feeSchedules:   db.NewFeeScheduleRepository(dbConn),
+		external:       db.NewExternalTransferRepository(dbConn),
+		health:         monitor,
+		close:          func() { dbConn.Close() },
+	}, nil
+}
+
+// openDB connects to Postgres, waiting for it to become available
+func openDB(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
+	dbConn, err := db.NewDBConnectionFromDSN(ctx, cfg.Database.DSN(), db.PoolOptions{
+		MaxConns:          int32(cfg.Database.MaxOpenConns),
+		MinConns:          int32(cfg.Database.MinConns),
+		ConnMaxLifetime:   cfg.Database.ConnMaxLifetime,
+		ConnMaxIdleTime:   cfg.Database.ConnMaxIdleTime,
+		ConnectAttempts:   cfg.Database.ConnectAttempts,
+		ConnectBackoff:    cfg.Database.ConnectBackoff,
+		ConnectMaxBackoff: cfg.Database.ConnectMaxBackoff,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database connection: %w", err)
+	}
+	return dbConn, nil
+}
+
+// memoryHealth reports the in-memory store as always available
+type memoryHealth struct{}
+
+func (memoryHealth) Snapshot() db.PoolHealth {
+	return db.PoolHealth{Status: db.PoolStatusUp, CheckedAt: time.Now().UTC()}
+}
@@ -1,20 +1,291 @@
 package api
 
+import (
+	"encoding/json"
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
 // CreateAccountRequest represents the request body for creating a new account.
+// ParentAccountID optionally places the account under an existing one.
+// AccountType defaults to liability; the debit-normal asset and expense types,
+// which may go negative, are rejected.
 type CreateAccountRequest struct {
-	AccountID      int64  `json:"account_id" validate:"required,gt=0"`
-	InitialBalance string `json:"initial_balance" validate:"required"`
+	AccountID       int64  `json:"account_id" validate:"required,gt=0"`
+	InitialBalance  string `json:"initial_balance" validate:"required"`
+	ParentAccountID int64  `json:"parent_account_id,omitempty" validate:"omitempty,gt=0,nefield=AccountID"`
+	AccountType     string `json:"account_type,omitempty" validate:"omitempty,oneof=asset liability equity revenue expense"`
 }
 
 // GetAccountResponse represents the response body for retrieving an account.
 type GetAccountResponse struct {
-	AccountID int64  `json:"account_id"`
-	Balance   string `json:"balance"`
+	AccountID   int64  `json:"account_id"`
+	Balance     string `json:"balance"`
+	AccountType string `json:"account_type,omitempty"`
 }
 
+// Transaction submission modes
+const (
+	TransactionModeSync  = "sync"
+	TransactionModeAsync = "async"
+)
+
 // CreateTransactionRequest represents the request body for transferring funds between accounts.
+// Mode is "sync" (the default) or "async". ExecuteAt schedules the transfer for
+// later, BusinessDayRule moves it to a business day, and RetryUntil retries a
+// failed scheduled transfer until that time. Description, ExternalReference and
+// Metadata are stored with the transfer. FeeMode is how a fee charged on the transfer is paid:
+// "on_top" (the default) of the amount or "deducted" from it.
 type CreateTransactionRequest struct {
+	SourceAccountID      int64      `json:"source_account_id" validate:"required,gt=0"`
+	DestinationAccountID int64      `json:"destination_account_id" validate:"required,gt=0,nefield=SourceAccountID"`
+	Amount               string     `json:"amount" validate:"required"`
+	Mode                 string     `json:"mode,omitempty" validate:"omitempty,oneof=sync async"`
+	ExecuteAt            *time.Time `json:"execute_at,omitempty" validate:"excluded_if=Mode sync"`
+	RetryUntil           *time.Time `json:"retry_until,omitempty" validate:"excluded_without=ExecuteAt"`
+	BusinessDayRule      string     `json:"business_day_rule,omitempty" validate:"excluded_without=ExecuteAt"`
+	FeeMode              string     `json:"fee_mode,omitempty" validate:"omitempty,oneof=on_top deducted"`
+
+	Description       string          `json:"description,omitempty" validate:"max=500"`
+	ExternalReference string          `json:"external_reference,omitempty" validate:"max=128"`
+	Metadata          json.RawMessage `json:"metadata,omitempty"`
+}
+
+// QuoteTransactionRequest represents the request body for quoting a transfer
+// without making it. FeeMode is as in CreateTransactionRequest.
+type QuoteTransactionRequest struct {
 	SourceAccountID      int64  `json:"source_account_id" validate:"required,gt=0"`
 	DestinationAccountID int64  `json:"destination_account_id" validate:"required,gt=0,nefield=SourceAccountID"`
 	Amount               string `json:"amount" validate:"required"`
+	FeeMode              string `json:"fee_mode,omitempty" validate:"omitempty,oneof=on_top deducted"`
+}
+
+// SplitTransactionRequest represents the request body for splitting one debit
+// over several destinations. Each destination takes either a fixed amount or a
+// percent of what is left after the fixed amounts.
+type SplitTransactionRequest struct {
+	SourceAccountID int64                     `json:"source_account_id" validate:"required,gt=0"`
+	Amount          string                    `json:"amount" validate:"required"`
+	Destinations    []SplitDestinationRequest `json:"destinations" validate:"required,min=1,dive"`
+
+	Description       string          `json:"description,omitempty" validate:"max=500"`
+	ExternalReference string          `json:"external_reference,omitempty" validate:"max=128"`
+	Metadata          json.RawMessage `json:"metadata,omitempty"`
+}
+
+// SplitDestinationRequest represents one destination of a split.
+type SplitDestinationRequest struct {
+	AccountID int64  `json:"account_id" validate:"required,gt=0"`
+	Amount    string `json:"amount,omitempty" validate:"required_without=Percent,excluded_with=Percent"`
+	Percent   string `json:"percent,omitempty"`
+}
+
+// SweepTransactionRequest represents the request body for pulling funds from
+// several sources into one destination. Each source gives either a fixed amount
+// or everything above a floor. Mode is "atomic" (the default) or "best_effort".
+type SweepTransactionRequest struct {
+	DestinationAccountID int64                `json:"destination_account_id" validate:"required,gt=0"`
+	Mode                 string               `json:"mode,omitempty" validate:"omitempty,oneof=atomic best_effort"`
+	Sources              []SweepSourceRequest `json:"sources" validate:"required,min=1,dive"`
+
+	Description       string          `json:"description,omitempty" validate:"max=500"`
+	ExternalReference string          `json:"external_reference,omitempty" validate:"max=128"`
+	Metadata          json.RawMessage `json:"metadata,omitempty"`
+}
+
+// SweepSourceRequest represents one source of a sweep.
+type SweepSourceRequest struct {
+	AccountID int64  `json:"account_id" validate:"required,gt=0"`
+	Amount    string `json:"amount,omitempty" validate:"required_without=Floor,excluded_with=Floor"`
+	Floor     string `json:"floor,omitempty"`
+}
+
+// SweepResponse represents a sweep: the recorded transfer with its legs, absent
+// when nothing moved, and the result of each source.
+type SweepResponse struct {
+	Transaction *TransactionResponse  `json:"transaction,omitempty"`
+	Results     []SweepResultResponse `json:"results"`
+}
+
+// SweepResultResponse represents what a sweep did with one source.
+type SweepResultResponse struct {
+	SourceAccountID int64  `json:"source_account_id"`
+	Amount          string `json:"amount"`
+	Status          string `json:"status"`
+	ErrorCode       string `json:"error_code,omitempty"`
+	TransactionID   int64  `json:"transaction_id,omitempty"`
+}
+
+// newSweepResponse converts a sweep into its response body
+func newSweepResponse(sweep model.Sweep) SweepResponse {
+	resp := SweepResponse{Results: make([]SweepResultResponse, len(sweep.Results))}
+	if sweep.Transfer.ID != 0 {
+		transaction := newTransactionResponse(sweep.Transfer)
+		resp.Transaction = &transaction
+	}
+	for i, r := range sweep.Results {
+		resp.Results[i] = SweepResultResponse{
+			SourceAccountID: r.SourceAccountID,
+			Amount:          r.Amount.String(),
+			Status:          string(r.Status),
+			ErrorCode:       r.ErrorCode,
+			TransactionID:   r.TransferID,
+		}
+	}
+	return resp
+}
+
+// TransactionResponse represents an asynchronous or scheduled transfer and its processing status.
+// A split has no destination and a sweep no source; their legs are listed with them.
+type TransactionResponse struct {
+	ID                   int64     `json:"id"`
+	Kind                 string    `json:"kind"`
+	SourceAccountID      int64     `json:"source_account_id,omitempty"`
+	DestinationAccountID int64     `json:"destination_account_id,omitempty"`
+	Amount               string    `json:"amount"`
+	Status               string    `json:"status"`
+	ErrorCode            string    `json:"error_code,omitempty"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+
+	ClientID          string          `json:"client_id,omitempty"`
+	Description       string          `json:"description,omitempty"`
+	ExternalReference string          `json:"external_reference,omitempty"`
+	Metadata          json.RawMessage `json:"metadata,omitempty"`
+
+	ExecuteAt     *time.Time `json:"execute_at,omitempty"`
+	RetryUntil    *time.Time `json:"retry_until,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+
+	Fee *FeeResponse `json:"fee,omitempty"`
+
+	ReversalOf *int64             `json:"reversal_of,omitempty"`
+	Reversals  []ReversalResponse `json:"reversals,omitempty"`
+
+	ParentID *int64                `json:"parent_id,omitempty"`
+	Legs     []TransactionResponse `json:"legs,omitempty"`
+}
+
+// TransferResponse represents a synchronous transfer made without a transfer
+// service. Such a transfer is not recorded: it has no id and cannot be looked
+// up or reversed, so Recorded is always false.
+type TransferResponse struct {
+	SourceAccountID      int64        `json:"source_account_id"`
+	DestinationAccountID int64        `json:"destination_account_id"`
+	Amount               string       `json:"amount"`
+	Fee                  *FeeResponse `json:"fee,omitempty"`
+	Recorded             bool         `json:"recorded"`
+}
+
+// QuoteTransactionResponse represents what a transfer would do if it were
+// made now: the fee it would be charged and the balances the source,
+// destination and fee accounts would have. Error and ErrorCode say why it
+// would fail; the balances are then omitted.
+type QuoteTransactionResponse struct {
+	SourceAccountID      int64                `json:"source_account_id"`
+	DestinationAccountID int64                `json:"destination_account_id"`
+	Amount               string               `json:"amount"`
+	Fee                  *FeeResponse         `json:"fee,omitempty"`
+	Balances             []GetAccountResponse `json:"balances,omitempty"`
+	Error                string               `json:"error,omitempty"`
+	ErrorCode            string               `json:"error_code,omitempty"`
+}
+
+// ReversalResponse represents a reversal in the history of the transfer it reverses.
+type ReversalResponse struct {
+	ID        int64     `json:"id"`
+	Amount    string    `json:"amount"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReverseTransactionRequest represents the request body for reversing a transfer.
+// An empty Amount reverses what is not reversed yet. RetryUntil keeps a reversal
+// pending until then when the destination of the original lacks the funds;
+// without it the reversal fails.
+type ReverseTransactionRequest struct {
+	Amount     string     `json:"amount,omitempty"`
+	RetryUntil *time.Time `json:"retry_until,omitempty"`
+}
+
+// ListTransactionsResponse represents a list of recorded transfers.
+type ListTransactionsResponse struct {
+	Transactions []TransactionResponse `json:"transactions"`
+}
+
+// newTransactionResponse converts a transfer into its response body
+func newTransactionResponse(t model.Transfer) TransactionResponse {
+	resp := TransactionResponse{
+		ID:                   t.ID,
+		Kind:                 string(t.Kind),
+		SourceAccountID:      t.SourceAccountID,
+		DestinationAccountID: t.DestinationAccountID,
+		Amount:               t.Amount.String(),
+		Status:               string(t.Status),
+		ErrorCode:            t.ErrorCode,
+		CreatedAt:            t.CreatedAt,
+		UpdatedAt:            t.UpdatedAt,
+		ClientID:             t.ClientID,
+		Description:          t.Description,
+		ExternalReference:    t.ExternalReference,
+		Metadata:             t.Metadata,
+		ExecuteAt:            t.ExecuteAt,
+		RetryUntil:           t.RetryUntil,
+		NextAttemptAt:        t.NextAttemptAt,
+		ReversalOf:           t.ReversalOf,
+		ParentID:             t.ParentID,
+	}
+	if t.Fee != nil {
+		resp.Fee = newFeeResponse(t)
+	}
+	for _, r := range t.Reversals {
+		resp.Reversals = append(resp.Reversals, ReversalResponse{ID: r.ID, Amount: r.Amount.String(), Status: string(r.Status), CreatedAt: r.CreatedAt})
+	}
+	for _, leg := range t.Legs {
+		resp.Legs = append(resp.Legs, newTransactionResponse(leg))
+	}
+	return resp
+}
+
+// SetBalanceShardsRequest represents the request body for configuring the balance shards of an account.
+type SetBalanceShardsRequest struct {
+	Shards *int `json:"shards" validate:"required,gte=0"`
+}
+
+// SetAccountParentRequest represents the request body for moving an account in
+// its hierarchy. A null or missing parent makes the account a root.
+type SetAccountParentRequest struct {
+	ParentAccountID *int64 `json:"parent_account_id" validate:"omitempty,gt=0"`
+}
+
+// SetChildPolicyRequest represents the request body for setting the policy an
+// account applies to its descendants.
+type SetChildPolicyRequest struct {
+	Policy string `json:"policy" validate:"required,oneof=none within_parent_balance"`
+}
+
+// AccountNodeResponse represents an account in the response body of an account tree.
+type AccountNodeResponse struct {
+	AccountID       int64                 `json:"account_id"`
+	ParentAccountID int64                 `json:"parent_account_id,omitempty"`
+	ChildPolicy     string                `json:"child_policy"`
+	Balance         string                `json:"balance"`
+	TotalBalance    string                `json:"total_balance"`
+	Children        []AccountNodeResponse `json:"children,omitempty"`
+}
+
+// newAccountNodeResponse maps an account tree to its response body
+func newAccountNodeResponse(node model.AccountNode) AccountNodeResponse {
+	resp := AccountNodeResponse{
+		AccountID:       node.AccountID,
+		ParentAccountID: node.ParentAccountID,
+		ChildPolicy:     string(node.ChildPolicy),
+		Balance:         node.Balance.String(),
+		TotalBalance:    node.TotalBalance.String(),
+	}
+	for _, child := range node.Children {
+		resp.Children = append(resp.Children, newAccountNodeResponse(child))
+	}
+	return resp
 }
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"internal-transfers/internal/calendar"
 	"internal-transfers/internal/model"
 	"internal-transfers/internal/services"
 
 	"errors"
+	"fmt"
 	"log"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/kataras/iris/v12"
@@ -17,12 +20,86 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// defaultListLimit is the number of items listed when the request sets no limit
+const defaultListLimit = 100
+
+// ClientIDHeader identifies the client submitting a transfer; external
+// references are unique per client
+const ClientIDHeader = "X-Client-ID"
+
+// maxClientIDLength is the longest accepted client id
+const maxClientIDLength = 64
+
 type AccountHandler struct {
-	service services.AccountServicePort
+	service           services.AccountServicePort
+	transfers         services.TransferServicePort
+	standingOrders    services.StandingOrderServicePort
+	balanceRules      services.BalanceRuleServicePort
+	interest          services.InterestServicePort
+	fees              services.FeeServicePort
+	externalTransfers services.ExternalTransferServicePort
+	calendar          *calendar.Calendar
+}
+
+// AccountHandlerOption customizes an AccountHandler
+type AccountHandlerOption func(*AccountHandler)
+
+// WithTransferService enables asynchronous transfers and their status endpoint
+func WithTransferService(transfers services.TransferServicePort) AccountHandlerOption {
+	return func(h *AccountHandler) {
+		h.transfers = transfers
+	}
+}
+
+// WithStandingOrderService enables the standing order endpoints
+func WithStandingOrderService(standingOrders services.StandingOrderServicePort) AccountHandlerOption {
+	return func(h *AccountHandler) {
+		h.standingOrders = standingOrders
+	}
+}
+
+// WithBalanceRuleService enables the balance rule endpoints
+func WithBalanceRuleService(balanceRules services.BalanceRuleServicePort) AccountHandlerOption {
+	return func(h *AccountHandler) {
+		h.balanceRules = balanceRules
+	}
 }
 
-func NewAccountHandler(service services.AccountServicePort) *AccountHandler {
-	return &AccountHandler{service: service}
+// WithInterestService enables the interest product and account interest endpoints
+func WithInterestService(interest services.InterestServicePort) AccountHandlerOption {
+	return func(h *AccountHandler) {
+		h.interest = interest
+	}
+}
+
+// WithFeeService enables the fee schedule endpoints and itemizes the fees of
+// synchronous transfers, charged by an AccountServicePort with fees enabled
+func WithFeeService(fees services.FeeServicePort) AccountHandlerOption {
+	return func(h *AccountHandler) {
+		h.fees = fees
+	}
+}
+
+// WithExternalTransferService enables the deposit and withdrawal endpoints
+func WithExternalTransferService(externalTransfers services.ExternalTransferServicePort) AccountHandlerOption {
+	return func(h *AccountHandler) {
+		h.externalTransfers = externalTransfers
+	}
+}
+
+// WithCalendar enables the business day calendar endpoint
+func WithCalendar(cal *calendar.Calendar) AccountHandlerOption {
+	return func(h *AccountHandler) {
+		h.calendar = cal
+	}
+}
+
+func NewAccountHandler(service services.AccountServicePort, opts ...AccountHandlerOption) *AccountHandler {
+	h := &AccountHandler{service: service}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // CreateAccount handles the creation of a new account
@@ -48,21 +125,35 @@ func (h *AccountHandler) CreateAccount(ctx iris.Context) {
 		return
 	}
 	account := model.Account{
-		AccountID: req.AccountID,
-		Balance:   balance,
+		AccountID:       req.AccountID,
+		Balance:         balance,
+		ParentAccountID: req.ParentAccountID,
+		Type:            model.AccountType(req.AccountType),
 	}
 	if err := h.service.CreateAccount(account); err != nil {
 		switch {
 		case errors.Is(err, model.ErrAccountIDMustBePositive),
+			errors.Is(err, model.ErrAccountIDReserved),
+			errors.Is(err, model.ErrInvalidAccountType),
+			errors.Is(err, model.ErrDebitNormalAccountType),
 			errors.Is(err, model.ErrBalanceMustBeNonNegative),
-			errors.Is(err, model.ErrPrecisionTooHigh):
+			errors.Is(err, model.ErrPrecisionTooHigh),
+			errors.Is(err, model.ErrChildBalanceLimitExceeded):
 			ctx.StatusCode(iris.StatusBadRequest)
 			ctx.JSON(ErrorResponse{Error: err.Error()})
 			return
+		case errors.Is(err, model.ErrParentAccountNotFound):
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+			return
 		case errors.Is(err, model.ErrAccountIDAlreadyExists):
 			ctx.StatusCode(iris.StatusConflict)
 			ctx.JSON(ErrorResponse{Error: err.Error()})
 			return
+		case errors.Is(err, model.ErrAccountHierarchyUnsupported), errors.Is(err, model.ErrAccountTypesUnsupported):
+			ctx.StatusCode(iris.StatusNotImplemented)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+			return
 		default:
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.JSON(ErrorResponse{Error: "failed to create account: " + err.Error()})
@@ -99,8 +190,9 @@ func (h *AccountHandler) GetAccount(ctx iris.Context) {
 	}
 
 	resp := GetAccountResponse{
-		AccountID: account.AccountID,
-		Balance:   account.Balance.String(),
+		AccountID:   account.AccountID,
+		Balance:     account.Balance.String(),
+		AccountType: string(account.Type),
 	}
 	if err := ctx.JSON(resp); err != nil {
 		log.Printf("failed to write response: %v", err)
@@ -132,14 +224,37 @@ func (h *AccountHandler) SubmitTransaction(ctx iris.Context) {
 		ctx.JSON(ErrorResponse{Error: "invalid amount: " + err.Error()})
 		return
 	}
+	clientID, ok := readClientID(ctx)
+	if !ok {
+		return
+	}
+	details := model.TransferDetails{
+		ClientID:          clientID,
+		Description:       req.Description,
+		ExternalReference: req.ExternalReference,
+		Metadata:          req.Metadata,
+		FeeMode:           model.FeeMode(req.FeeMode),
+	}
+
+	if h.transfers != nil || req.Mode == TransactionModeAsync || req.ExecuteAt != nil || !details.Empty() {
+		h.recordTransaction(ctx, req, amount, details)
+		return
+	}
 
-	err = h.service.Transfer(req.SourceAccountID, req.DestinationAccountID, amount)
+	var fee *model.Fee
+	if h.fees != nil {
+		fee, err = h.service.TransferWithFee(req.SourceAccountID, req.DestinationAccountID, amount, clientID, details.FeeMode)
+	} else {
+		err = h.service.Transfer(req.SourceAccountID, req.DestinationAccountID, amount)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrAccountIDMustBePositive),
 			errors.Is(err, model.ErrSourceAndDestinationMustDiffer),
 			errors.Is(err, model.ErrAmountMustBePositive),
-			errors.Is(err, model.ErrPrecisionTooHigh):
+			errors.Is(err, model.ErrPrecisionTooHigh),
+			errors.Is(err, model.ErrInvalidFeeMode),
+			errors.Is(err, model.ErrFeeExceedsAmount):
 			ctx.StatusCode(iris.StatusBadRequest)
 			ctx.JSON(ErrorResponse{Error: err.Error()})
 			return
@@ -147,10 +262,17 @@ func (h *AccountHandler) SubmitTransaction(ctx iris.Context) {
 			ctx.StatusCode(iris.StatusNotFound)
 			ctx.JSON(ErrorResponse{Error: err.Error()})
 			return
-		case errors.Is(err, model.ErrInsufficientFunds):
+		case errors.Is(err, model.ErrInsufficientFunds),
+			errors.Is(err, model.ErrSystemAccountSource),
+			errors.Is(err, model.ErrSystemAccountNotAllowed),
+			errors.Is(err, model.ErrChildBalanceLimitExceeded):
 			ctx.StatusCode(iris.StatusBadRequest)
 			ctx.JSON(ErrorResponse{Error: err.Error()})
 			return
+		case errors.Is(err, model.ErrTransferQueueClosed):
+			ctx.StatusCode(iris.StatusServiceUnavailable)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+			return
 		default:
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.JSON(ErrorResponse{Error: "failed to submit transaction: " + err.Error()})
@@ -158,4 +280,710 @@ func (h *AccountHandler) SubmitTransaction(ctx iris.Context) {
 		}
 	}
 	ctx.StatusCode(iris.StatusOK)
+	transfer := model.Transfer{SourceAccountID: req.SourceAccountID, DestinationAccountID: req.DestinationAccountID, Amount: amount, Fee: fee}
+	resp := TransferResponse{SourceAccountID: transfer.SourceAccountID, DestinationAccountID: transfer.DestinationAccountID, Amount: amount.String()}
+	if fee != nil {
+		resp.Fee = newFeeResponse(transfer)
+	}
+	ctx.JSON(resp)
+}
+
+// QuoteTransaction runs the checks and fee computation of a synchronous
+// transfer and reports its outcome without moving any funds. A transfer that
+// would fail with a domain error is still quoted, with the error.
+// Example: POST /transactions/quote {"source_account_id": 1, "destination_account_id": 2, "amount": "10.00"}
+func (h *AccountHandler) QuoteTransaction(ctx iris.Context) {
+	var req QuoteTransactionRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid amount: " + err.Error()})
+		return
+	}
+	clientID, ok := readClientID(ctx)
+	if !ok {
+		return
+	}
+
+	quote, err := h.service.QuoteTransfer(req.SourceAccountID, req.DestinationAccountID, amount, clientID, model.FeeMode(req.FeeMode))
+	code := model.ErrorCode(err)
+	if err != nil && code == "" {
+		log.Printf("quote transaction error: %v", err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "failed to quote transaction: " + err.Error()})
+		return
+	}
+	resp := QuoteTransactionResponse{
+		SourceAccountID:      quote.SourceAccountID,
+		DestinationAccountID: quote.DestinationAccountID,
+		Amount:               quote.Amount.String(),
+		ErrorCode:            code,
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if quote.Fee != nil {
+		resp.Fee = newFeeResponse(model.Transfer{Amount: quote.Amount, Fee: quote.Fee})
+	}
+	for _, account := range quote.Balances {
+		resp.Balances = append(resp.Balances, GetAccountResponse{AccountID: account.AccountID, Balance: account.Balance.String()})
+	}
+	ctx.JSON(resp)
+}
+
+// recordTransaction records the transfer. It is stored for background
+// processing, now or at req.ExecuteAt, and the response is 202 with its id; the
+// outcome is read from GET /transactions/{id}. A synchronous transfer with
+// details is booked with its funds, and the response is 201.
+func (h *AccountHandler) recordTransaction(ctx iris.Context, req CreateTransactionRequest, amount decimal.Decimal, details model.TransferDetails) {
+	if h.transfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "asynchronous transfers are not enabled"})
+		return
+	}
+
+	var transfer model.Transfer
+	var err error
+	switch {
+	case req.ExecuteAt != nil:
+		var retryUntil time.Time
+		if req.RetryUntil != nil {
+			retryUntil = *req.RetryUntil
+		}
+		transfer, err = h.transfers.ScheduleTransfer(req.SourceAccountID, req.DestinationAccountID, amount, *req.ExecuteAt, retryUntil, calendar.Rule(req.BusinessDayRule), details)
+	case req.Mode == TransactionModeAsync:
+		transfer, err = h.transfers.SubmitTransfer(req.SourceAccountID, req.DestinationAccountID, amount, details)
+	default:
+		transfer, err = h.transfers.BookTransfer(req.SourceAccountID, req.DestinationAccountID, amount, details)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAccountIDMustBePositive),
+			errors.Is(err, model.ErrSourceAndDestinationMustDiffer),
+			errors.Is(err, model.ErrAmountMustBePositive),
+			errors.Is(err, model.ErrPrecisionTooHigh),
+			errors.Is(err, model.ErrRetryDeadlineBeforeExecution),
+			errors.Is(err, model.ErrInvalidBusinessDayRule),
+			errors.Is(err, model.ErrInvalidMetadata),
+			errors.Is(err, model.ErrMetadataTooLarge),
+			errors.Is(err, model.ErrInvalidFeeMode),
+			errors.Is(err, model.ErrFeeExceedsAmount),
+			errors.Is(err, model.ErrInsufficientFunds),
+			errors.Is(err, model.ErrSystemAccountSource),
+			errors.Is(err, model.ErrSystemAccountNotAllowed),
+			errors.Is(err, model.ErrChildBalanceLimitExceeded):
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrSourceAccountNotFound), errors.Is(err, model.ErrDestinationAccountNotFound):
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrDuplicateExternalReference):
+			ctx.StatusCode(iris.StatusConflict)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrTransferQueueClosed):
+			ctx.StatusCode(iris.StatusServiceUnavailable)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		default:
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(ErrorResponse{Error: "failed to submit transaction: " + err.Error()})
+		}
+		return
+	}
+	ctx.Header("Location", "/transactions/"+strconv.FormatInt(transfer.ID, 10))
+	if transfer.Status == model.TransferCompleted {
+		ctx.StatusCode(iris.StatusCreated)
+	} else {
+		ctx.StatusCode(iris.StatusAccepted)
+	}
+	ctx.JSON(newTransactionResponse(transfer))
+}
+
+// readClientID reads the client id header. It responds 400 and returns false
+// when the id is too long.
+func readClientID(ctx iris.Context) (string, bool) {
+	clientID := ctx.GetHeader(ClientIDHeader)
+	if len(clientID) > maxClientIDLength {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: fmt.Sprintf("invalid %s header: longer than %d characters", ClientIDHeader, maxClientIDLength)})
+		return "", false
+	}
+	return clientID, true
+}
+
+// GetTransaction returns an asynchronous transfer and its processing status.
+// Example: GET /transactions/{id}
+func (h *AccountHandler) GetTransaction(ctx iris.Context) {
+	if h.transfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "asynchronous transfers are not enabled"})
+		return
+	}
+
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid transaction id: " + err.Error()})
+		return
+	}
+
+	transfer, err := h.transfers.GetTransfer(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrTransferIDMustBePositive):
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrTransferNotFound):
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.JSON(ErrorResponse{Error: "transaction not found"})
+		default:
+			log.Printf("get transaction error: %v", err)
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(ErrorResponse{Error: "internal server error"})
+		}
+		return
+	}
+	ctx.JSON(newTransactionResponse(transfer))
+}
+
+// FindTransactions finds the transfer the client submitted with an external
+// reference. The client is named by the X-Client-ID header.
+// Example: GET /transactions?external_reference=pay_8f2a
+func (h *AccountHandler) FindTransactions(ctx iris.Context) {
+	if h.transfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "asynchronous transfers are not enabled"})
+		return
+	}
+
+	reference := ctx.URLParam("external_reference")
+	if reference == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "external_reference is required"})
+		return
+	}
+	clientID, ok := readClientID(ctx)
+	if !ok {
+		return
+	}
+
+	resp := ListTransactionsResponse{Transactions: []TransactionResponse{}}
+	transfer, err := h.transfers.GetTransferByReference(clientID, reference)
+	switch {
+	case err == nil:
+		resp.Transactions = append(resp.Transactions, newTransactionResponse(transfer))
+	case errors.Is(err, model.ErrTransferNotFound):
+	default:
+		log.Printf("find transactions error: %v", err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "internal server error"})
+		return
+	}
+	ctx.JSON(resp)
+}
+
+// ListScheduledTransactions lists scheduled transfers in execution order.
+// Example: GET /scheduled-transfers?status=scheduled&limit=50
+func (h *AccountHandler) ListScheduledTransactions(ctx iris.Context) {
+	if h.transfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "asynchronous transfers are not enabled"})
+		return
+	}
+
+	status := model.TransferStatus(ctx.URLParam("status"))
+	if status != "" && !status.Valid() {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid status: " + string(status)})
+		return
+	}
+	limit, ok := listLimit(ctx, services.MaxScheduledTransfersPage)
+	if !ok {
+		return
+	}
+
+	transfers, err := h.transfers.ListScheduledTransfers(status, limit)
+	if err != nil {
+		log.Printf("list scheduled transactions error: %v", err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "internal server error"})
+		return
+	}
+	resp := ListTransactionsResponse{Transactions: make([]TransactionResponse, 0, len(transfers))}
+	for _, transfer := range transfers {
+		resp.Transactions = append(resp.Transactions, newTransactionResponse(transfer))
+	}
+	ctx.JSON(resp)
+}
+
+// CancelScheduledTransaction cancels a scheduled transfer that has not started yet.
+// Example: DELETE /scheduled-transfers/{id}
+func (h *AccountHandler) CancelScheduledTransaction(ctx iris.Context) {
+	if h.transfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "asynchronous transfers are not enabled"})
+		return
+	}
+
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid transaction id: " + err.Error()})
+		return
+	}
+
+	transfer, err := h.transfers.CancelScheduledTransfer(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrTransferIDMustBePositive):
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrTransferNotFound):
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.JSON(ErrorResponse{Error: "scheduled transfer not found"})
+		case errors.Is(err, model.ErrTransferNotCancellable):
+			ctx.StatusCode(iris.StatusConflict)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		default:
+			log.Printf("cancel scheduled transaction error: %v", err)
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(ErrorResponse{Error: "internal server error"})
+		}
+		return
+	}
+	ctx.JSON(newTransactionResponse(transfer))
+}
+
+// ReverseTransaction books a reversal of a completed transfer, moving all or
+// part of its amount back. It responds 201 once the funds moved, or 202 when
+// the reversal waits for funds until retry_until.
+// Example: POST /transactions/{id}/reverse {"amount": "25.00"}
+func (h *AccountHandler) ReverseTransaction(ctx iris.Context) {
+	if h.transfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "asynchronous transfers are not enabled"})
+		return
+	}
+
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid transaction id: " + err.Error()})
+		return
+	}
+	var req ReverseTransactionRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	amount := decimal.Zero
+	if req.Amount != "" {
+		if amount, err = decimal.NewFromString(req.Amount); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: "invalid amount: " + err.Error()})
+			return
+		}
+		if !amount.IsPositive() {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: model.ErrAmountMustBePositive.Error()})
+			return
+		}
+	}
+	var retryUntil time.Time
+	if req.RetryUntil != nil {
+		retryUntil = *req.RetryUntil
+	}
+
+	reversal, err := h.transfers.ReverseTransfer(id, amount, retryUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrTransferIDMustBePositive),
+			errors.Is(err, model.ErrAmountMustBePositive),
+			errors.Is(err, model.ErrPrecisionTooHigh),
+			errors.Is(err, model.ErrRetryDeadlineBeforeExecution),
+			errors.Is(err, model.ErrInsufficientFunds),
+			errors.Is(err, model.ErrSystemAccountSource),
+			errors.Is(err, model.ErrSystemAccountNotAllowed),
+			errors.Is(err, model.ErrChildBalanceLimitExceeded):
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrTransferNotFound):
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.JSON(ErrorResponse{Error: "transaction not found"})
+		case errors.Is(err, model.ErrTransferNotReversible), errors.Is(err, model.ErrReversalExceedsOriginal):
+			ctx.StatusCode(iris.StatusConflict)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		default:
+			log.Printf("reverse transaction error: %v", err)
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(ErrorResponse{Error: "internal server error"})
+		}
+		return
+	}
+	ctx.Header("Location", "/transactions/"+strconv.FormatInt(reversal.ID, 10))
+	if reversal.Status == model.TransferCompleted {
+		ctx.StatusCode(iris.StatusCreated)
+	} else {
+		ctx.StatusCode(iris.StatusAccepted)
+	}
+	ctx.JSON(newTransactionResponse(reversal))
+}
+
+// SplitTransaction debits the source once and credits every destination in
+// one transaction. It responds 201 with the split and its legs.
+// Example: POST /transactions/split {"source_account_id": 1, "amount": "100.00", "destinations": [{"account_id": 2, "amount": "10.00"}, {"account_id": 3, "percent": "100"}]}
+func (h *AccountHandler) SplitTransaction(ctx iris.Context) {
+	if h.transfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "asynchronous transfers are not enabled"})
+		return
+	}
+
+	var req SplitTransactionRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid amount: " + err.Error()})
+		return
+	}
+	shares := make([]model.SplitShare, len(req.Destinations))
+	for i, d := range req.Destinations {
+		shares[i].DestinationAccountID = d.AccountID
+		if d.Amount != "" {
+			shares[i].Amount, err = decimal.NewFromString(d.Amount)
+		} else {
+			shares[i].Percent, err = decimal.NewFromString(d.Percent)
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: fmt.Sprintf("invalid share of destination %d: %v", d.AccountID, err)})
+			return
+		}
+	}
+	clientID, ok := readClientID(ctx)
+	if !ok {
+		return
+	}
+	details := model.TransferDetails{
+		ClientID:          clientID,
+		Description:       req.Description,
+		ExternalReference: req.ExternalReference,
+		Metadata:          req.Metadata,
+	}
+
+	split, err := h.transfers.SplitTransfer(req.SourceAccountID, amount, shares, details)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAccountIDMustBePositive),
+			errors.Is(err, model.ErrSourceAndDestinationMustDiffer),
+			errors.Is(err, model.ErrAmountMustBePositive),
+			errors.Is(err, model.ErrPrecisionTooHigh),
+			errors.Is(err, model.ErrInvalidSplit),
+			errors.Is(err, model.ErrInvalidMetadata),
+			errors.Is(err, model.ErrMetadataTooLarge),
+			errors.Is(err, model.ErrInsufficientFunds),
+			errors.Is(err, model.ErrSystemAccountSource),
+			errors.Is(err, model.ErrSystemAccountNotAllowed),
+			errors.Is(err, model.ErrChildBalanceLimitExceeded):
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrSourceAccountNotFound), errors.Is(err, model.ErrDestinationAccountNotFound):
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrDuplicateExternalReference):
+			ctx.StatusCode(iris.StatusConflict)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		default:
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(ErrorResponse{Error: "failed to split transaction: " + err.Error()})
+		}
+		return
+	}
+	ctx.Header("Location", "/transactions/"+strconv.FormatInt(split.ID, 10))
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(newTransactionResponse(split))
+}
+
+// SweepTransaction pulls funds from several sources into one destination in
+// one transaction. It responds 201 with the sweep and a result per source, or
+// 200 when no source had funds to sweep.
+// Example: POST /transactions/sweep {"destination_account_id": 1, "mode": "best_effort", "sources": [{"account_id": 2, "floor": "1000"}, {"account_id": 3, "amount": "50"}]}
+func (h *AccountHandler) SweepTransaction(ctx iris.Context) {
+	if h.transfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "asynchronous transfers are not enabled"})
+		return
+	}
+
+	var req SweepTransactionRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+	sources := make([]model.SweepSource, len(req.Sources))
+	for i, src := range req.Sources {
+		sources[i].SourceAccountID = src.AccountID
+		var err error
+		if src.Amount != "" {
+			sources[i].Amount, err = decimal.NewFromString(src.Amount)
+		} else {
+			var floor decimal.Decimal
+			floor, err = decimal.NewFromString(src.Floor)
+			sources[i].Floor = &floor
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: fmt.Sprintf("invalid amount or floor of source %d: %v", src.AccountID, err)})
+			return
+		}
+	}
+	clientID, ok := readClientID(ctx)
+	if !ok {
+		return
+	}
+	details := model.TransferDetails{
+		ClientID:          clientID,
+		Description:       req.Description,
+		ExternalReference: req.ExternalReference,
+		Metadata:          req.Metadata,
+	}
+
+	sweep, err := h.transfers.SweepTransfer(req.DestinationAccountID, sources, model.SweepMode(req.Mode), details)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAccountIDMustBePositive),
+			errors.Is(err, model.ErrSourceAndDestinationMustDiffer),
+			errors.Is(err, model.ErrAmountMustBePositive),
+			errors.Is(err, model.ErrPrecisionTooHigh),
+			errors.Is(err, model.ErrInvalidSweep),
+			errors.Is(err, model.ErrInvalidMetadata),
+			errors.Is(err, model.ErrMetadataTooLarge),
+			errors.Is(err, model.ErrInsufficientFunds),
+			errors.Is(err, model.ErrSystemAccountSource),
+			errors.Is(err, model.ErrSystemAccountNotAllowed),
+			errors.Is(err, model.ErrChildBalanceLimitExceeded):
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrSourceAccountNotFound), errors.Is(err, model.ErrDestinationAccountNotFound):
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrDuplicateExternalReference):
+			ctx.StatusCode(iris.StatusConflict)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		default:
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(ErrorResponse{Error: "failed to sweep: " + err.Error()})
+		}
+		return
+	}
+	if sweep.Transfer.ID != 0 {
+		ctx.Header("Location", "/transactions/"+strconv.FormatInt(sweep.Transfer.ID, 10))
+		ctx.StatusCode(iris.StatusCreated)
+	} else {
+		ctx.StatusCode(iris.StatusOK)
+	}
+	ctx.JSON(newSweepResponse(sweep))
+}
+
+// listLimit reads the limit query parameter, defaulting to defaultListLimit.
+// It responds 400 and returns false when the limit is not between 1 and max.
+func listLimit(ctx iris.Context, max int) (int, bool) {
+	raw := ctx.URLParam("limit")
+	if raw == "" {
+		return defaultListLimit, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > max {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: fmt.Sprintf("invalid limit: must be between 1 and %d", max)})
+		return 0, false
+	}
+	return n, true
+}
+
+// SetBalanceShards configures how many shard rows receive the credits of an account.
+// Example: PUT /accounts/{id}/balance-shards {"shards": 16}
+func (h *AccountHandler) SetBalanceShards(ctx iris.Context) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid account id: " + err.Error()})
+		return
+	}
+
+	var req SetBalanceShardsRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+
+	if err := h.service.SetBalanceShards(id, *req.Shards); err != nil {
+		switch {
+		case errors.Is(err, model.ErrAccountIDMustBePositive),
+			errors.Is(err, model.ErrInvalidShardCount):
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, model.ErrAccountNotFound):
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.JSON(ErrorResponse{Error: "account not found"})
+		case errors.Is(err, model.ErrBalanceShardingUnsupported):
+			ctx.StatusCode(iris.StatusNotImplemented)
+			ctx.JSON(ErrorResponse{Error: err.Error()})
+		default:
+			log.Printf("set balance shards error: %v", err)
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(ErrorResponse{Error: "internal server error"})
+		}
+		return
+	}
+	ctx.StatusCode(iris.StatusNoContent)
+}
+
+// SetAccountParent moves an account under another one, or makes it a root.
+// Example: PUT /accounts/{id}/parent {"parent_account_id": 1}
+func (h *AccountHandler) SetAccountParent(ctx iris.Context) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid account id: " + err.Error()})
+		return
+	}
+
+	var req SetAccountParentRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+
+	var parentID int64
+	if req.ParentAccountID != nil {
+		parentID = *req.ParentAccountID
+	}
+	if err := h.service.SetAccountParent(id, parentID); err != nil {
+		h.writeHierarchyError(ctx, "set account parent", err)
+		return
+	}
+	ctx.StatusCode(iris.StatusNoContent)
+}
+
+// SetChildPolicy sets the policy an account applies to the balances of its descendants.
+// Example: PUT /accounts/{id}/child-policy {"policy": "within_parent_balance"}
+func (h *AccountHandler) SetChildPolicy(ctx iris.Context) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid account id: " + err.Error()})
+		return
+	}
+
+	var req SetChildPolicyRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+
+	if err := h.service.SetChildBalancePolicy(id, model.ChildBalancePolicy(req.Policy)); err != nil {
+		h.writeHierarchyError(ctx, "set child policy", err)
+		return
+	}
+	ctx.StatusCode(iris.StatusNoContent)
+}
+
+// GetAccountTree returns an account and its descendants with their own and
+// aggregated balances.
+// Example: GET /accounts/{id}/tree
+func (h *AccountHandler) GetAccountTree(ctx iris.Context) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid account id: " + err.Error()})
+		return
+	}
+
+	tree, err := h.service.GetAccountTree(id)
+	if err != nil {
+		h.writeHierarchyError(ctx, "get account tree", err)
+		return
+	}
+	ctx.JSON(newAccountNodeResponse(tree))
+}
+
+// writeHierarchyError responds with the status of an account hierarchy error
+func (h *AccountHandler) writeHierarchyError(ctx iris.Context, action string, err error) {
+	switch {
+	case errors.Is(err, model.ErrAccountIDMustBePositive),
+		errors.Is(err, model.ErrInvalidChildPolicy),
+		errors.Is(err, model.ErrChildBalanceLimitExceeded):
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrAccountNotFound):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(ErrorResponse{Error: "account not found"})
+	case errors.Is(err, model.ErrParentAccountNotFound):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrAccountHierarchyCycle):
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrAccountHierarchyUnsupported):
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	default:
+		log.Printf("%s error: %v", action, err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "internal server error"})
+	}
 }
@@ -2,11 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"internal-transfers/internal/calendar"
+	"internal-transfers/internal/db"
 	"internal-transfers/internal/mocks"
 	"internal-transfers/internal/model"
+	"internal-transfers/internal/services"
 
 	"github.com/golang/mock/gomock"
 	"github.com/kataras/iris/v12"
@@ -15,8 +21,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func setupTestApp(_ *testing.T, mockSvc *mocks.MockAccountServicePort) *iris.Application {
-	handler := NewAccountHandler(mockSvc)
+func setupTestApp(_ *testing.T, svc services.AccountServicePort) *iris.Application {
+	handler := NewAccountHandler(svc)
 	app := iris.New()
 	RegisterRoutes(app, handler)
 	return app
@@ -89,6 +95,7 @@ func TestCreateAccount_ServiceValidationErrors(t *testing.T) {
 		{"AccountIDMustBePositive", model.ErrAccountIDMustBePositive},
 		{"BalanceMustBeNonNegative", model.ErrBalanceMustBeNonNegative},
 		{"PrecisionTooHigh", model.ErrPrecisionTooHigh},
+		{"AccountIDReserved", model.ErrAccountIDReserved},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -144,6 +151,31 @@ func TestGetAccount_Success(t *testing.T) {
 	resp.JSON().Object().ValueEqual("balance", acc.Balance.String())
 }
 
+func TestAccountTypes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	e := httptest.New(t, setupTestApp(t, mockSvc))
+
+	mockSvc.EXPECT().CreateAccount(model.Account{AccountID: 7, Balance: decimal.RequireFromString("0"), Type: model.AccountRevenue}).Return(nil)
+	e.POST("/accounts").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":7,"initial_balance":"0","account_type":"revenue"}`).Expect().Status(http.StatusCreated)
+	e.POST("/accounts").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":7,"initial_balance":"0","account_type":"savings"}`).Expect().Status(http.StatusBadRequest)
+	mockSvc.EXPECT().CreateAccount(gomock.Any()).Return(model.ErrDebitNormalAccountType)
+	e.POST("/accounts").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":7,"initial_balance":"0","account_type":"asset"}`).Expect().Status(http.StatusBadRequest).
+		JSON().Object().ValueEqual("error", model.ErrDebitNormalAccountType.Error())
+	mockSvc.EXPECT().CreateAccount(gomock.Any()).Return(model.ErrAccountTypesUnsupported)
+	e.POST("/accounts").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":7,"initial_balance":"0","account_type":"equity"}`).Expect().Status(http.StatusNotImplemented)
+
+	mockSvc.EXPECT().GetAccount(int64(7)).Return(model.Account{AccountID: 7, Balance: decimal.NewFromInt(-3), Type: model.AccountAsset}, nil)
+	obj := e.GET("/accounts/7").Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("balance", "-3")
+	obj.ValueEqual("account_type", "asset")
+}
+
 func TestGetAccount_InvalidID(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -191,6 +223,10 @@ func TestSubmitTransaction_Success(t *testing.T) {
 	body, _ := json.Marshal(req)
 	resp := httptest.New(t, app).POST("/transactions").WithHeader("Content-Type", "application/json").WithBytes(body).Expect()
 	resp.Status(http.StatusOK)
+	obj := resp.JSON().Object()
+	obj.ValueEqual("amount", "10")
+	obj.ValueEqual("recorded", false)
+	obj.NotContainsKey("id")
 }
 
 func TestSubmitTransaction_InvalidJSON(t *testing.T) {
@@ -283,6 +319,27 @@ func TestSubmitTransaction_InsufficientFunds(t *testing.T) {
 	resp.JSON().Object().Value("error").String().Contains(model.ErrInsufficientFunds.Error())
 }
 
+func TestSubmitTransaction_FromClearingOrSystemAccount(t *testing.T) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	assert.NoError(t, accounts.CreateAccount(1, decimal.Zero))
+	svc := services.NewAccountService(accounts)
+	assert.NoError(t, services.NewExternalTransferService(svc, db.NewMemoryExternalTransferRepository(store), []int64{90}).OpenClearingAccounts())
+	app := setupTestApp(t, svc)
+
+	resp := httptest.New(t, app).POST("/transactions").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":90,"destination_account_id":1,"amount":"1000000"}`).Expect()
+	resp.Status(http.StatusBadRequest)
+	resp.JSON().Object().Value("error").String().Contains(model.ErrSystemAccountSource.Error())
+	resp = httptest.New(t, app).POST("/transactions").WithHeader("Content-Type", "application/json").
+		WithText(fmt.Sprintf(`{"source_account_id":%d,"destination_account_id":1,"amount":"1000000"}`, model.InterestExpenseAccountID)).Expect()
+	resp.Status(http.StatusBadRequest)
+	resp.JSON().Object().Value("error").String().Contains(model.ErrSystemAccountNotAllowed.Error())
+	account, err := svc.GetAccount(1)
+	assert.NoError(t, err)
+	assert.True(t, account.Balance.IsZero(), "got %s", account.Balance)
+}
+
 func TestSubmitTransaction_InternalServerError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -294,3 +351,707 @@ func TestSubmitTransaction_InternalServerError(t *testing.T) {
 	resp.Status(http.StatusInternalServerError)
 	resp.JSON().Object().Value("error").String().Contains("failed to submit transaction")
 }
+
+func TestRegisterRoutes_BodyLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	app := iris.New()
+	RegisterRoutes(app, NewAccountHandler(mockSvc), WithBodyLimit(16))
+	body, _ := json.Marshal(CreateAccountRequest{AccountID: 1, InitialBalance: "100.00"})
+	resp := httptest.New(t, app).POST("/accounts").WithHeader("Content-Type", "application/json").WithBytes(body).Expect()
+	resp.Status(http.StatusBadRequest)
+	resp.JSON().Object().Value("error").String().Contains("invalid request body")
+}
+
+func TestSetBalanceShards(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	app := setupTestApp(t, mockSvc)
+	e := httptest.New(t, app)
+
+	mockSvc.EXPECT().SetBalanceShards(int64(7), 16).Return(nil)
+	e.PUT("/accounts/7/balance-shards").WithHeader("Content-Type", "application/json").WithText(`{"shards":16}`).Expect().
+		Status(http.StatusNoContent)
+
+	// Zero turns sharding off and must not be rejected as a missing field
+	mockSvc.EXPECT().SetBalanceShards(int64(7), 0).Return(nil)
+	e.PUT("/accounts/7/balance-shards").WithHeader("Content-Type", "application/json").WithText(`{"shards":0}`).Expect().
+		Status(http.StatusNoContent)
+}
+
+func TestSetBalanceShards_Errors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	app := setupTestApp(t, mockSvc)
+	e := httptest.New(t, app)
+
+	e.PUT("/accounts/7/balance-shards").WithHeader("Content-Type", "application/json").WithText(`{}`).Expect().
+		Status(http.StatusBadRequest).JSON().Object().Value("error").String().Contains("validation error")
+	e.PUT("/accounts/7/balance-shards").WithText(`{"shards":4}`).Expect().
+		Status(http.StatusUnsupportedMediaType)
+
+	testCases := []struct {
+		err    error
+		status int
+	}{
+		{model.ErrInvalidShardCount, http.StatusBadRequest},
+		{model.ErrAccountNotFound, http.StatusNotFound},
+		{model.ErrBalanceShardingUnsupported, http.StatusNotImplemented},
+		{assert.AnError, http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		mockSvc.EXPECT().SetBalanceShards(int64(7), 4).Return(tc.err)
+		e.PUT("/accounts/7/balance-shards").WithHeader("Content-Type", "application/json").WithText(`{"shards":4}`).Expect().
+			Status(tc.status)
+	}
+}
+
+func TestCreateAccount_WithParent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	app := setupTestApp(t, mockSvc)
+	e := httptest.New(t, app)
+
+	acc := model.Account{AccountID: 2, Balance: decimal.RequireFromString("10"), ParentAccountID: 1}
+	mockSvc.EXPECT().CreateAccount(acc).Return(nil)
+	e.POST("/accounts").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":2,"initial_balance":"10","parent_account_id":1}`).Expect().
+		Status(http.StatusCreated)
+
+	e.POST("/accounts").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":2,"initial_balance":"10","parent_account_id":2}`).Expect().
+		Status(http.StatusBadRequest).JSON().Object().Value("error").String().Contains("validation error")
+
+	testCases := []struct {
+		err    error
+		status int
+	}{
+		{model.ErrParentAccountNotFound, http.StatusNotFound},
+		{model.ErrChildBalanceLimitExceeded, http.StatusBadRequest},
+		{model.ErrAccountHierarchyUnsupported, http.StatusNotImplemented},
+	}
+	for _, tc := range testCases {
+		mockSvc.EXPECT().CreateAccount(acc).Return(tc.err)
+		e.POST("/accounts").WithHeader("Content-Type", "application/json").
+			WithText(`{"account_id":2,"initial_balance":"10","parent_account_id":1}`).Expect().
+			Status(tc.status)
+	}
+}
+
+func TestSetAccountParent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	app := setupTestApp(t, mockSvc)
+	e := httptest.New(t, app)
+
+	mockSvc.EXPECT().SetAccountParent(int64(7), int64(3)).Return(nil)
+	e.PUT("/accounts/7/parent").WithHeader("Content-Type", "application/json").WithText(`{"parent_account_id":3}`).Expect().
+		Status(http.StatusNoContent)
+
+	// A null parent detaches the account
+	mockSvc.EXPECT().SetAccountParent(int64(7), int64(0)).Return(nil)
+	e.PUT("/accounts/7/parent").WithHeader("Content-Type", "application/json").WithText(`{"parent_account_id":null}`).Expect().
+		Status(http.StatusNoContent)
+
+	e.PUT("/accounts/7/parent").WithHeader("Content-Type", "application/json").WithText(`{"parent_account_id":-1}`).Expect().
+		Status(http.StatusBadRequest).JSON().Object().Value("error").String().Contains("validation error")
+
+	testCases := []struct {
+		err    error
+		status int
+	}{
+		{model.ErrAccountNotFound, http.StatusNotFound},
+		{model.ErrParentAccountNotFound, http.StatusNotFound},
+		{model.ErrAccountHierarchyCycle, http.StatusConflict},
+		{model.ErrChildBalanceLimitExceeded, http.StatusBadRequest},
+		{model.ErrAccountHierarchyUnsupported, http.StatusNotImplemented},
+		{assert.AnError, http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		mockSvc.EXPECT().SetAccountParent(int64(7), int64(3)).Return(tc.err)
+		e.PUT("/accounts/7/parent").WithHeader("Content-Type", "application/json").WithText(`{"parent_account_id":3}`).Expect().
+			Status(tc.status)
+	}
+}
+
+func TestSetChildPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	app := setupTestApp(t, mockSvc)
+	e := httptest.New(t, app)
+
+	mockSvc.EXPECT().SetChildBalancePolicy(int64(7), model.ChildBalanceWithinParent).Return(nil)
+	e.PUT("/accounts/7/child-policy").WithHeader("Content-Type", "application/json").WithText(`{"policy":"within_parent_balance"}`).Expect().
+		Status(http.StatusNoContent)
+
+	e.PUT("/accounts/7/child-policy").WithHeader("Content-Type", "application/json").WithText(`{"policy":"sometimes"}`).Expect().
+		Status(http.StatusBadRequest).JSON().Object().Value("error").String().Contains("validation error")
+
+	mockSvc.EXPECT().SetChildBalancePolicy(int64(7), model.ChildBalanceWithinParent).Return(model.ErrChildBalanceLimitExceeded)
+	e.PUT("/accounts/7/child-policy").WithHeader("Content-Type", "application/json").WithText(`{"policy":"within_parent_balance"}`).Expect().
+		Status(http.StatusBadRequest)
+}
+
+func TestGetAccountTree(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	app := setupTestApp(t, mockSvc)
+	e := httptest.New(t, app)
+
+	tree := model.AccountNode{
+		AccountID:    1,
+		ChildPolicy:  model.ChildBalanceWithinParent,
+		Balance:      decimal.RequireFromString("100"),
+		TotalBalance: decimal.RequireFromString("130"),
+		Children: []model.AccountNode{
+			{AccountID: 2, ParentAccountID: 1, ChildPolicy: model.ChildBalanceUnlimited, Balance: decimal.RequireFromString("30"), TotalBalance: decimal.RequireFromString("30")},
+		},
+	}
+	mockSvc.EXPECT().GetAccountTree(int64(1)).Return(tree, nil)
+	obj := e.GET("/accounts/1/tree").Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("account_id", 1)
+	obj.NotContainsKey("parent_account_id")
+	obj.ValueEqual("child_policy", "within_parent_balance")
+	obj.ValueEqual("balance", "100")
+	obj.ValueEqual("total_balance", "130")
+	obj.Value("children").Array().Length().Equal(1)
+	child := obj.Value("children").Array().Element(0).Object()
+	child.ValueEqual("parent_account_id", 1)
+	child.ValueEqual("total_balance", "30")
+	child.NotContainsKey("children")
+
+	mockSvc.EXPECT().GetAccountTree(int64(9)).Return(model.AccountNode{}, model.ErrAccountNotFound)
+	e.GET("/accounts/9/tree").Expect().Status(http.StatusNotFound)
+	mockSvc.EXPECT().GetAccountTree(int64(9)).Return(model.AccountNode{}, model.ErrAccountHierarchyUnsupported)
+	e.GET("/accounts/9/tree").Expect().Status(http.StatusNotImplemented)
+}
+
+func TestSubmitTransaction_QueueClosedDuringShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	app := setupTestApp(t, mockSvc)
+	mockSvc.EXPECT().Transfer(int64(1), int64(2), decimal.RequireFromString("10.00")).Return(model.ErrTransferQueueClosed)
+	body, _ := json.Marshal(CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00"})
+	resp := httptest.New(t, app).POST("/transactions").WithHeader("Content-Type", "application/json").WithBytes(body).Expect()
+	resp.Status(http.StatusServiceUnavailable)
+}
+
+func setupTransferTestApp(t *testing.T) (*iris.Application, *mocks.MockAccountServicePort, *mocks.MockTransferServicePort) {
+	ctrl := gomock.NewController(t)
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	mockTransfers := mocks.NewMockTransferServicePort(ctrl)
+	app := iris.New()
+	RegisterRoutes(app, NewAccountHandler(mockSvc, WithTransferService(mockTransfers)))
+	return app, mockSvc, mockTransfers
+}
+
+func TestSubmitTransaction_Async(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockTransfers.EXPECT().SubmitTransfer(int64(1), int64(2), decimal.RequireFromString("10.00"), model.TransferDetails{}).Return(model.Transfer{
+		ID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.RequireFromString("10.00"),
+		Status: model.TransferPending, CreatedAt: created, UpdatedAt: created,
+	}, nil)
+
+	body, _ := json.Marshal(CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10.00", Mode: TransactionModeAsync})
+	resp := httptest.New(t, app).POST("/transactions").WithHeader("Content-Type", "application/json").WithBytes(body).Expect()
+	resp.Status(http.StatusAccepted)
+	resp.Header("Location").Equal("/transactions/7")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("id", 7)
+	obj.ValueEqual("status", "pending")
+	obj.ValueEqual("amount", "10")
+	obj.NotContainsKey("error_code")
+}
+
+func TestSubmitTransaction_AsyncErrors(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	submit := func(mode string, want int) {
+		body, _ := json.Marshal(CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Mode: mode})
+		e.POST("/transactions").WithHeader("Content-Type", "application/json").WithBytes(body).Expect().Status(want)
+	}
+
+	submit("later", http.StatusBadRequest)
+
+	mockTransfers.EXPECT().SubmitTransfer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(model.Transfer{}, model.ErrPrecisionTooHigh)
+	submit(TransactionModeAsync, http.StatusBadRequest)
+
+	mockTransfers.EXPECT().SubmitTransfer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(model.Transfer{}, assert.AnError)
+	submit(TransactionModeAsync, http.StatusInternalServerError)
+
+	// Without a transfer service only synchronous transfers are available
+	ctrl := gomock.NewController(t)
+	noAsync := setupTestApp(t, mocks.NewMockAccountServicePort(ctrl))
+	body, _ := json.Marshal(CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Mode: TransactionModeAsync})
+	httptest.New(t, noAsync).POST("/transactions").WithHeader("Content-Type", "application/json").WithBytes(body).Expect().
+		Status(http.StatusNotImplemented)
+}
+
+func TestSubmitTransaction_ExplicitSyncMode(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	// A plain synchronous transfer is booked like one with details
+	mockTransfers.EXPECT().BookTransfer(int64(1), int64(2), decimal.RequireFromString("10"), model.TransferDetails{}).Return(model.Transfer{
+		ID: 5, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(10), Status: model.TransferCompleted,
+	}, nil)
+	body, _ := json.Marshal(CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "10", Mode: TransactionModeSync})
+	resp := httptest.New(t, app).POST("/transactions").WithHeader("Content-Type", "application/json").WithBytes(body).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/transactions/5")
+	resp.JSON().Object().ValueEqual("id", 5)
+}
+
+func TestSubmitTransaction_Details(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	details := model.TransferDetails{
+		ClientID: "billing", Description: "Invoice 117", ExternalReference: "pay_1", Metadata: json.RawMessage(`{"invoice":117}`),
+	}
+
+	// A synchronous transfer with details is booked and recorded
+	mockTransfers.EXPECT().BookTransfer(int64(1), int64(2), decimal.RequireFromString("10"), details).Return(model.Transfer{
+		ID: 5, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(10), Status: model.TransferCompleted, TransferDetails: details,
+	}, nil)
+	resp := e.POST("/transactions").WithHeader("Content-Type", "application/json").WithHeader(ClientIDHeader, "billing").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"10","description":"Invoice 117","external_reference":"pay_1","metadata":{"invoice":117}}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/transactions/5")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("client_id", "billing")
+	obj.ValueEqual("description", "Invoice 117")
+	obj.ValueEqual("external_reference", "pay_1")
+	obj.Value("metadata").Object().ValueEqual("invoice", 117)
+
+	details.ClientID = ""
+	mockTransfers.EXPECT().SubmitTransfer(int64(1), int64(2), decimal.RequireFromString("10"), details).Return(model.Transfer{ID: 6, Status: model.TransferPending}, nil)
+	e.POST("/transactions").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"10","mode":"async","description":"Invoice 117","external_reference":"pay_1","metadata":{"invoice":117}}`).
+		Expect().Status(http.StatusAccepted)
+}
+
+func TestSubmitTransaction_DetailsErrors(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	submit := func(body string, want int) {
+		e.POST("/transactions").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+
+	submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","external_reference":"`+strings.Repeat("r", 129)+`"}`, http.StatusBadRequest)
+	submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","description":"`+strings.Repeat("d", 501)+`"}`, http.StatusBadRequest)
+	e.POST("/transactions").WithHeader("Content-Type", "application/json").WithHeader(ClientIDHeader, strings.Repeat("c", 65)).
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"10","external_reference":"pay_1"}`).Expect().Status(http.StatusBadRequest)
+
+	testCases := []struct {
+		err  error
+		want int
+	}{
+		{model.ErrDuplicateExternalReference, http.StatusConflict},
+		{model.ErrInvalidMetadata, http.StatusBadRequest},
+		{model.ErrMetadataTooLarge, http.StatusBadRequest},
+		{model.ErrInsufficientFunds, http.StatusBadRequest},
+		{model.ErrDestinationAccountNotFound, http.StatusNotFound},
+		{model.ErrTransferQueueClosed, http.StatusServiceUnavailable},
+	}
+	for _, tc := range testCases {
+		mockTransfers.EXPECT().BookTransfer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(model.Transfer{}, tc.err)
+		submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","metadata":[1]}`, tc.want)
+	}
+}
+
+func TestFindTransactions(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+
+	mockTransfers.EXPECT().GetTransferByReference("billing", "pay_1").Return(model.Transfer{
+		ID: 5, Amount: decimal.NewFromInt(10), Status: model.TransferCompleted,
+		TransferDetails: model.TransferDetails{ClientID: "billing", ExternalReference: "pay_1"},
+	}, nil)
+	arr := e.GET("/transactions").WithQuery("external_reference", "pay_1").WithHeader(ClientIDHeader, "billing").Expect().
+		Status(http.StatusOK).JSON().Object().Value("transactions").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("id", 5)
+
+	mockTransfers.EXPECT().GetTransferByReference("", "pay_2").Return(model.Transfer{}, model.ErrTransferNotFound)
+	e.GET("/transactions").WithQuery("external_reference", "pay_2").Expect().
+		Status(http.StatusOK).JSON().Object().Value("transactions").Array().Empty()
+
+	e.GET("/transactions").Expect().Status(http.StatusBadRequest)
+
+	mockTransfers.EXPECT().GetTransferByReference(gomock.Any(), gomock.Any()).Return(model.Transfer{}, assert.AnError)
+	e.GET("/transactions").WithQuery("external_reference", "pay_3").Expect().Status(http.StatusInternalServerError)
+}
+
+func TestGetTransaction(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+
+	mockTransfers.EXPECT().GetTransfer(int64(7)).Return(model.Transfer{
+		ID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(500),
+		Status: model.TransferFailed, ErrorCode: "insufficient_funds",
+	}, nil)
+	obj := e.GET("/transactions/7").Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("status", "failed")
+	obj.ValueEqual("error_code", "insufficient_funds")
+
+	mockTransfers.EXPECT().GetTransfer(int64(8)).Return(model.Transfer{}, model.ErrTransferNotFound)
+	e.GET("/transactions/8").Expect().Status(http.StatusNotFound)
+
+	mockTransfers.EXPECT().GetTransfer(int64(0)).Return(model.Transfer{}, model.ErrTransferIDMustBePositive)
+	e.GET("/transactions/0").Expect().Status(http.StatusBadRequest)
+
+	mockTransfers.EXPECT().GetTransfer(int64(9)).Return(model.Transfer{}, assert.AnError)
+	e.GET("/transactions/9").Expect().Status(http.StatusInternalServerError)
+}
+
+func TestGetTransaction_Reversals(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	original := int64(7)
+
+	mockTransfers.EXPECT().GetTransfer(int64(7)).Return(model.Transfer{
+		ID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(50), Status: model.TransferCompleted,
+		Reversals: []model.Transfer{{ID: 8, Amount: decimal.NewFromInt(20), Status: model.TransferCompleted, ReversalOf: &original}},
+	}, nil)
+	obj := e.GET("/transactions/7").Expect().Status(http.StatusOK).JSON().Object()
+	obj.NotContainsKey("reversal_of")
+	reversal := obj.Value("reversals").Array().Element(0).Object()
+	reversal.ValueEqual("id", 8)
+	reversal.ValueEqual("amount", "20")
+	reversal.ValueEqual("status", "completed")
+
+	mockTransfers.EXPECT().GetTransfer(int64(8)).Return(model.Transfer{
+		ID: 8, SourceAccountID: 2, DestinationAccountID: 1, Amount: decimal.NewFromInt(20), Status: model.TransferCompleted, ReversalOf: &original,
+	}, nil)
+	obj = e.GET("/transactions/8").Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("reversal_of", 7)
+	obj.NotContainsKey("reversals")
+}
+
+func TestReverseTransaction(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	original := int64(7)
+
+	mockTransfers.EXPECT().ReverseTransfer(int64(7), decimal.RequireFromString("20.00"), time.Time{}).Return(model.Transfer{
+		ID: 8, SourceAccountID: 2, DestinationAccountID: 1, Amount: decimal.NewFromInt(20), Status: model.TransferCompleted, ReversalOf: &original,
+	}, nil)
+	resp := e.POST("/transactions/7/reverse").WithHeader("Content-Type", "application/json").WithText(`{"amount":"20.00"}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/transactions/8")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("reversal_of", 7)
+	obj.ValueEqual("source_account_id", 2)
+
+	retryUntil := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+	mockTransfers.EXPECT().ReverseTransfer(int64(7), decimal.Zero, retryUntil).Return(model.Transfer{
+		ID: 9, SourceAccountID: 2, DestinationAccountID: 1, Amount: decimal.NewFromInt(30), Status: model.TransferPending,
+		ReversalOf: &original, RetryUntil: &retryUntil,
+	}, nil)
+	e.POST("/transactions/7/reverse").WithHeader("Content-Type", "application/json").WithText(`{"retry_until":"2030-01-02T09:00:00Z"}`).Expect().
+		Status(http.StatusAccepted).JSON().Object().ValueEqual("status", "pending")
+}
+
+func TestReverseTransaction_Errors(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	reverse := func(body string, want int) {
+		e.POST("/transactions/7/reverse").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+
+	reverse(`not-json`, http.StatusBadRequest)
+	reverse(`{"amount":"ten"}`, http.StatusBadRequest)
+	reverse(`{"amount":"0"}`, http.StatusBadRequest)
+	reverse(`{"amount":"-5"}`, http.StatusBadRequest)
+
+	testCases := []struct {
+		err  error
+		want int
+	}{
+		{model.ErrInsufficientFunds, http.StatusBadRequest},
+		{model.ErrPrecisionTooHigh, http.StatusBadRequest},
+		{model.ErrTransferNotFound, http.StatusNotFound},
+		{model.ErrTransferNotReversible, http.StatusConflict},
+		{model.ErrReversalExceedsOriginal, http.StatusConflict},
+		{assert.AnError, http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		mockTransfers.EXPECT().ReverseTransfer(int64(7), gomock.Any(), gomock.Any()).Return(model.Transfer{}, tc.err)
+		reverse(`{}`, tc.want)
+	}
+
+	// Without a transfer service there are no recorded transfers to reverse
+	ctrl := gomock.NewController(t)
+	noAsync := setupTestApp(t, mocks.NewMockAccountServicePort(ctrl))
+	httptest.New(t, noAsync).POST("/transactions/7/reverse").WithHeader("Content-Type", "application/json").WithText(`{}`).Expect().
+		Status(http.StatusNotImplemented)
+}
+
+func TestSplitTransaction(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	parent := int64(5)
+	shares := []model.SplitShare{
+		{DestinationAccountID: 2, Amount: decimal.RequireFromString("10.00")},
+		{DestinationAccountID: 3, Percent: decimal.RequireFromString("100")},
+	}
+	details := model.TransferDetails{ClientID: "payroll", ExternalReference: "run_1"}
+	mockTransfers.EXPECT().SplitTransfer(int64(1), decimal.RequireFromString("100.00"), shares, details).Return(model.Transfer{
+		ID: 5, Kind: model.TransferKindSplit, SourceAccountID: 1, Amount: decimal.NewFromInt(100), Status: model.TransferCompleted, TransferDetails: details,
+		Legs: []model.Transfer{
+			{ID: 6, Kind: model.TransferKindTransfer, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(10), Status: model.TransferCompleted, ParentID: &parent},
+			{ID: 7, Kind: model.TransferKindTransfer, SourceAccountID: 1, DestinationAccountID: 3, Amount: decimal.NewFromInt(90), Status: model.TransferCompleted, ParentID: &parent},
+		},
+	}, nil)
+
+	resp := httptest.New(t, app).POST("/transactions/split").WithHeader("Content-Type", "application/json").WithHeader(ClientIDHeader, "payroll").
+		WithText(`{"source_account_id":1,"amount":"100.00","destinations":[{"account_id":2,"amount":"10.00"},{"account_id":3,"percent":"100"}],"external_reference":"run_1"}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/transactions/5")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("kind", "split")
+	obj.NotContainsKey("destination_account_id")
+	legs := obj.Value("legs").Array()
+	legs.Length().Equal(2)
+	legs.Element(1).Object().ValueEqual("destination_account_id", 3)
+	legs.Element(1).Object().ValueEqual("amount", "90")
+	legs.Element(1).Object().ValueEqual("parent_id", 5)
+}
+
+func TestSplitTransaction_Errors(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	split := func(body string, want int) {
+		e.POST("/transactions/split").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+
+	split(`not-json`, http.StatusBadRequest)
+	split(`{"source_account_id":1,"amount":"10","destinations":[]}`, http.StatusBadRequest)
+	split(`{"source_account_id":1,"amount":"10","destinations":[{"account_id":2}]}`, http.StatusBadRequest)
+	split(`{"source_account_id":1,"amount":"10","destinations":[{"account_id":2,"amount":"5","percent":"50"}]}`, http.StatusBadRequest)
+	split(`{"source_account_id":1,"amount":"10","destinations":[{"account_id":2,"percent":"half"}]}`, http.StatusBadRequest)
+	split(`{"source_account_id":1,"amount":"ten","destinations":[{"account_id":2,"amount":"10"}]}`, http.StatusBadRequest)
+
+	testCases := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: percents must add up to 100", model.ErrInvalidSplit), http.StatusBadRequest},
+		{model.ErrInsufficientFunds, http.StatusBadRequest},
+		{model.ErrSourceAndDestinationMustDiffer, http.StatusBadRequest},
+		{model.ErrDestinationAccountNotFound, http.StatusNotFound},
+		{model.ErrDuplicateExternalReference, http.StatusConflict},
+		{assert.AnError, http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		mockTransfers.EXPECT().SplitTransfer(int64(1), gomock.Any(), gomock.Any(), gomock.Any()).Return(model.Transfer{}, tc.err)
+		split(`{"source_account_id":1,"amount":"10","destinations":[{"account_id":2,"percent":"100"}]}`, tc.want)
+	}
+}
+
+func TestSweepTransaction(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	parent := int64(5)
+	floor := decimal.RequireFromString("1000")
+	sources := []model.SweepSource{{SourceAccountID: 2, Floor: &floor}, {SourceAccountID: 3, Amount: decimal.RequireFromString("50")}}
+	mockTransfers.EXPECT().SweepTransfer(int64(1), sources, model.SweepBestEffort, model.TransferDetails{}).Return(model.Sweep{
+		Transfer: model.Transfer{
+			ID: 5, Kind: model.TransferKindSweep, DestinationAccountID: 1, Amount: decimal.NewFromInt(250), Status: model.TransferCompleted,
+			Legs: []model.Transfer{{ID: 6, SourceAccountID: 2, DestinationAccountID: 1, Amount: decimal.NewFromInt(250), Status: model.TransferCompleted, ParentID: &parent}},
+		},
+		Results: []model.SweepResult{
+			{SourceAccountID: 2, Amount: decimal.NewFromInt(250), Status: model.SweepResultCompleted, TransferID: 6},
+			{SourceAccountID: 3, Status: model.SweepResultFailed, ErrorCode: "insufficient_funds"},
+		},
+	}, nil)
+
+	resp := e.POST("/transactions/sweep").WithHeader("Content-Type", "application/json").
+		WithText(`{"destination_account_id":1,"mode":"best_effort","sources":[{"account_id":2,"floor":"1000"},{"account_id":3,"amount":"50"}]}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/transactions/5")
+	obj := resp.JSON().Object()
+	transaction := obj.Value("transaction").Object()
+	transaction.ValueEqual("kind", "sweep")
+	transaction.NotContainsKey("source_account_id")
+	transaction.Value("legs").Array().Length().Equal(1)
+	results := obj.Value("results").Array()
+	results.Element(0).Object().ValueEqual("transaction_id", 6)
+	results.Element(1).Object().ValueEqual("status", "failed")
+	results.Element(1).Object().ValueEqual("error_code", "insufficient_funds")
+
+	// Nothing to sweep
+	mockTransfers.EXPECT().SweepTransfer(int64(1), gomock.Any(), model.SweepMode(""), gomock.Any()).Return(model.Sweep{
+		Results: []model.SweepResult{{SourceAccountID: 2, Status: model.SweepResultSkipped}},
+	}, nil)
+	resp = e.POST("/transactions/sweep").WithHeader("Content-Type", "application/json").
+		WithText(`{"destination_account_id":1,"sources":[{"account_id":2,"floor":"0"}]}`).Expect()
+	resp.Status(http.StatusOK)
+	obj = resp.JSON().Object()
+	obj.NotContainsKey("transaction")
+	obj.Value("results").Array().Element(0).Object().ValueEqual("status", "skipped")
+}
+
+func TestSweepTransaction_Errors(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	sweep := func(body string, want int) {
+		e.POST("/transactions/sweep").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+
+	sweep(`not-json`, http.StatusBadRequest)
+	sweep(`{"destination_account_id":1,"sources":[]}`, http.StatusBadRequest)
+	sweep(`{"destination_account_id":1,"mode":"eventually","sources":[{"account_id":2,"amount":"5"}]}`, http.StatusBadRequest)
+	sweep(`{"destination_account_id":1,"sources":[{"account_id":2}]}`, http.StatusBadRequest)
+	sweep(`{"destination_account_id":1,"sources":[{"account_id":2,"amount":"5","floor":"0"}]}`, http.StatusBadRequest)
+	sweep(`{"destination_account_id":1,"sources":[{"account_id":2,"floor":"none"}]}`, http.StatusBadRequest)
+
+	testCases := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("source 2: %w", model.ErrInsufficientFunds), http.StatusBadRequest},
+		{model.ErrInvalidSweep, http.StatusBadRequest},
+		{fmt.Errorf("source 2: %w", model.ErrSourceAccountNotFound), http.StatusNotFound},
+		{model.ErrDestinationAccountNotFound, http.StatusNotFound},
+		{model.ErrDuplicateExternalReference, http.StatusConflict},
+		{assert.AnError, http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		mockTransfers.EXPECT().SweepTransfer(int64(1), gomock.Any(), gomock.Any(), gomock.Any()).Return(model.Sweep{}, tc.err)
+		sweep(`{"destination_account_id":1,"sources":[{"account_id":2,"amount":"5"}]}`, tc.want)
+	}
+}
+
+func TestSubmitTransaction_Scheduled(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	executeAt := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+	retryUntil := executeAt.Add(24 * time.Hour)
+	mockTransfers.EXPECT().ScheduleTransfer(int64(1), int64(2), decimal.RequireFromString("10"), executeAt, retryUntil, calendar.Rule(""), model.TransferDetails{}).Return(model.Transfer{
+		ID: 3, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(10),
+		Status: model.TransferScheduled, ExecuteAt: &executeAt, RetryUntil: &retryUntil, NextAttemptAt: &executeAt,
+	}, nil)
+
+	resp := httptest.New(t, app).POST("/transactions").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"10","execute_at":"2030-01-02T09:00:00Z","retry_until":"2030-01-03T09:00:00Z"}`).Expect()
+	resp.Status(http.StatusAccepted)
+	obj := resp.JSON().Object()
+	obj.ValueEqual("status", "scheduled")
+	obj.ValueEqual("execute_at", "2030-01-02T09:00:00Z")
+	obj.ValueEqual("retry_until", "2030-01-03T09:00:00Z")
+}
+
+func TestSubmitTransaction_ScheduledErrors(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	submit := func(body string, want int) {
+		e.POST("/transactions").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+
+	submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","mode":"sync","execute_at":"2030-01-02T09:00:00Z"}`, http.StatusBadRequest)
+	submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","retry_until":"2030-01-02T09:00:00Z"}`, http.StatusBadRequest)
+	submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","execute_at":"tomorrow"}`, http.StatusBadRequest)
+	submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","mode":"async","business_day_rule":"following"}`, http.StatusBadRequest)
+
+	mockTransfers.EXPECT().ScheduleTransfer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(model.Transfer{}, model.ErrRetryDeadlineBeforeExecution)
+	submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","execute_at":"2030-01-02T09:00:00Z","retry_until":"2030-01-01T09:00:00Z"}`, http.StatusBadRequest)
+
+	mockTransfers.EXPECT().ScheduleTransfer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), calendar.Rule("nearest"), gomock.Any()).
+		Return(model.Transfer{}, model.ErrInvalidBusinessDayRule)
+	submit(`{"source_account_id":1,"destination_account_id":2,"amount":"10","execute_at":"2030-01-02T09:00:00Z","business_day_rule":"nearest"}`, http.StatusBadRequest)
+}
+
+func TestListScheduledTransactions(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+	executeAt := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+
+	mockTransfers.EXPECT().ListScheduledTransfers(model.TransferStatus(""), 100).Return([]model.Transfer{
+		{ID: 4, Amount: decimal.NewFromInt(1), Status: model.TransferScheduled, ExecuteAt: &executeAt},
+	}, nil)
+	arr := e.GET("/scheduled-transfers").Expect().Status(http.StatusOK).JSON().Object().Value("transactions").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("id", 4)
+
+	mockTransfers.EXPECT().ListScheduledTransfers(model.TransferCancelled, 5).Return(nil, nil)
+	e.GET("/scheduled-transfers").WithQuery("status", "cancelled").WithQuery("limit", 5).Expect().
+		Status(http.StatusOK).JSON().Object().Value("transactions").Array().Empty()
+
+	e.GET("/scheduled-transfers").WithQuery("status", "sleeping").Expect().Status(http.StatusBadRequest)
+	e.GET("/scheduled-transfers").WithQuery("limit", 0).Expect().Status(http.StatusBadRequest)
+	e.GET("/scheduled-transfers").WithQuery("limit", "all").Expect().Status(http.StatusBadRequest)
+
+	mockTransfers.EXPECT().ListScheduledTransfers(gomock.Any(), gomock.Any()).Return(nil, assert.AnError)
+	e.GET("/scheduled-transfers").Expect().Status(http.StatusInternalServerError)
+}
+
+func TestCancelScheduledTransaction(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	e := httptest.New(t, app)
+
+	mockTransfers.EXPECT().CancelScheduledTransfer(int64(4)).Return(model.Transfer{ID: 4, Amount: decimal.NewFromInt(1), Status: model.TransferCancelled}, nil)
+	e.DELETE("/scheduled-transfers/4").Expect().Status(http.StatusOK).JSON().Object().ValueEqual("status", "cancelled")
+
+	mockTransfers.EXPECT().CancelScheduledTransfer(int64(5)).Return(model.Transfer{}, model.ErrTransferNotFound)
+	e.DELETE("/scheduled-transfers/5").Expect().Status(http.StatusNotFound)
+
+	mockTransfers.EXPECT().CancelScheduledTransfer(int64(6)).Return(model.Transfer{}, model.ErrTransferNotCancellable)
+	e.DELETE("/scheduled-transfers/6").Expect().Status(http.StatusConflict)
+
+	mockTransfers.EXPECT().CancelScheduledTransfer(int64(7)).Return(model.Transfer{}, assert.AnError)
+	e.DELETE("/scheduled-transfers/7").Expect().Status(http.StatusInternalServerError)
+}
+
+func TestQuoteTransaction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	e := httptest.New(t, setupTestApp(t, mockSvc))
+	quote := func(body string, want int) {
+		e.POST("/transactions/quote").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+
+	mockSvc.EXPECT().QuoteTransfer(int64(1), int64(2), decimal.RequireFromString("10"), "acme", model.FeeDeducted).Return(model.TransferQuote{
+		SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.RequireFromString("10"),
+		Fee: &model.Fee{ScheduleID: 4, AccountID: 9, Amount: decimal.RequireFromString("0.5"), Mode: model.FeeDeducted},
+		Balances: []model.Account{
+			{AccountID: 1, Balance: decimal.RequireFromString("90")},
+			{AccountID: 2, Balance: decimal.RequireFromString("9.5")},
+			{AccountID: 9, Balance: decimal.RequireFromString("0.5")},
+		},
+	}, nil)
+	obj := e.POST("/transactions/quote").WithHeader("Content-Type", "application/json").WithHeader(ClientIDHeader, "acme").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"10","fee_mode":"deducted"}`).Expect().
+		Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("amount", "10")
+	obj.Value("fee").Object().ValueEqual("destination_credited", "9.5")
+	balances := obj.Value("balances").Array()
+	balances.Length().Equal(3)
+	balances.Element(1).Object().ValueEqual("account_id", 2)
+	balances.Element(1).Object().ValueEqual("balance", "9.5")
+	obj.NotContainsKey("error")
+
+	// A transfer that would fail is quoted with its error
+	mockSvc.EXPECT().QuoteTransfer(int64(1), int64(2), decimal.RequireFromString("500"), "", model.FeeMode("")).Return(model.TransferQuote{
+		SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.RequireFromString("500"),
+	}, model.ErrInsufficientFunds)
+	obj = e.POST("/transactions/quote").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"500"}`).Expect().
+		Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("error", model.ErrInsufficientFunds.Error())
+	obj.ValueEqual("error_code", "insufficient_funds")
+	obj.NotContainsKey("balances")
+	obj.NotContainsKey("fee")
+
+	quote(`{"source_account_id":1,"destination_account_id":1,"amount":"10"}`, http.StatusBadRequest)
+	quote(`{"source_account_id":1,"destination_account_id":2,"amount":"ten"}`, http.StatusBadRequest)
+	quote(`{"source_account_id":1,"destination_account_id":2,"amount":"10","fee_mode":"sideways"}`, http.StatusBadRequest)
+	mockSvc.EXPECT().QuoteTransfer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(model.TransferQuote{}, assert.AnError)
+	quote(`{"source_account_id":1,"destination_account_id":2,"amount":"10"}`, http.StatusInternalServerError)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// BalanceRuleRequest represents the request body for creating or replacing a
+// balance rule. At least one of MinBalance and MaxBalance is required, and the
+// rule runs after each transfer touching the account (AfterTransfer), on a
+// Schedule in the standing order syntax, or both. Enabled defaults to true.
+type BalanceRuleRequest struct {
+	AccountID             int64   `json:"account_id" validate:"required,gt=0"`
+	CounterpartyAccountID int64   `json:"counterparty_account_id" validate:"required,gt=0,nefield=AccountID"`
+	MinBalance            *string `json:"min_balance,omitempty"`
+	MaxBalance            *string `json:"max_balance,omitempty"`
+	AfterTransfer         bool    `json:"after_transfer"`
+	Schedule              string  `json:"schedule,omitempty"`
+	Enabled               *bool   `json:"enabled,omitempty"`
+}
+
+// BalanceRuleResponse represents a balance rule.
+type BalanceRuleResponse struct {
+	ID                    int64      `json:"id"`
+	AccountID             int64      `json:"account_id"`
+	CounterpartyAccountID int64      `json:"counterparty_account_id"`
+	MinBalance            *string    `json:"min_balance,omitempty"`
+	MaxBalance            *string    `json:"max_balance,omitempty"`
+	AfterTransfer         bool       `json:"after_transfer"`
+	Schedule              string     `json:"schedule,omitempty"`
+	NextRunAt             *time.Time `json:"next_run_at,omitempty"`
+	Enabled               bool       `json:"enabled"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// ListBalanceRulesResponse represents a list of balance rules.
+type ListBalanceRulesResponse struct {
+	BalanceRules []BalanceRuleResponse `json:"balance_rules"`
+}
+
+// RuleSweepResponse represents a transfer made by a balance rule.
+type RuleSweepResponse struct {
+	ID                   int64      `json:"id"`
+	TriggeredBy          string     `json:"triggered_by"`
+	SourceAccountID      int64      `json:"source_account_id"`
+	DestinationAccountID int64      `json:"destination_account_id"`
+	Amount               string     `json:"amount"`
+	Status               string     `json:"status"`
+	ErrorCode            string     `json:"error_code,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	FinishedAt           *time.Time `json:"finished_at,omitempty"`
+}
+
+// ListRuleSweepsResponse represents the sweeps of a balance rule, most recent first.
+type ListRuleSweepsResponse struct {
+	Sweeps []RuleSweepResponse `json:"sweeps"`
+}
+
+// newBalanceRuleResponse converts a balance rule into its response body
+func newBalanceRuleResponse(r model.BalanceRule) BalanceRuleResponse {
+	resp := BalanceRuleResponse{
+		ID:                    r.ID,
+		AccountID:             r.AccountID,
+		CounterpartyAccountID: r.CounterpartyAccountID,
+		AfterTransfer:         r.AfterTransfer,
+		Schedule:              r.Schedule,
+		NextRunAt:             r.NextRunAt,
+		Enabled:               r.Enabled,
+		CreatedAt:             r.CreatedAt,
+		UpdatedAt:             r.UpdatedAt,
+	}
+	if r.Min != nil {
+		min := r.Min.String()
+		resp.MinBalance = &min
+	}
+	if r.Max != nil {
+		max := r.Max.String()
+		resp.MaxBalance = &max
+	}
+	return resp
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"internal-transfers/internal/model"
+	"internal-transfers/internal/services"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/shopspring/decimal"
+)
+
+// requireBalanceRules responds 501 and returns false when balance rules are not enabled
+func (h *AccountHandler) requireBalanceRules(ctx iris.Context) bool {
+	if h.balanceRules == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "balance rules are not enabled"})
+		return false
+	}
+	return true
+}
+
+// balanceRuleID reads the id path parameter, responding 400 when it is invalid
+func balanceRuleID(ctx iris.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid balance rule id: " + err.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// balanceRuleError responds to an error of the balance rule service
+func balanceRuleError(ctx iris.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrAccountIDMustBePositive),
+		errors.Is(err, model.ErrSourceAndDestinationMustDiffer),
+		errors.Is(err, model.ErrSystemAccountNotAllowed),
+		errors.Is(err, model.ErrPrecisionTooHigh),
+		errors.Is(err, model.ErrInvalidSchedule),
+		errors.Is(err, model.ErrInvalidBalanceRule),
+		errors.Is(err, model.ErrBalanceRuleIDMustBePositive):
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrAccountNotFound):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrBalanceRuleNotFound):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(ErrorResponse{Error: "balance rule not found"})
+	default:
+		log.Printf("balance rule error: %v", err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "internal server error"})
+	}
+}
+
+// readBalanceRule reads and validates a balance rule request body,
+// responding 400 when it is invalid
+func readBalanceRule(ctx iris.Context) (model.BalanceRule, bool) {
+	var req BalanceRuleRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return model.BalanceRule{}, false
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return model.BalanceRule{}, false
+	}
+
+	rule := model.BalanceRule{
+		AccountID:             req.AccountID,
+		CounterpartyAccountID: req.CounterpartyAccountID,
+		AfterTransfer:         req.AfterTransfer,
+		Schedule:              req.Schedule,
+		Enabled:               req.Enabled == nil || *req.Enabled,
+	}
+	for _, bound := range []struct {
+		name  string
+		value *string
+		dest  **decimal.Decimal
+	}{
+		{"min_balance", req.MinBalance, &rule.Min},
+		{"max_balance", req.MaxBalance, &rule.Max},
+	} {
+		if bound.value == nil {
+			continue
+		}
+		parsed, err := decimal.NewFromString(*bound.value)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: "invalid " + bound.name + ": " + err.Error()})
+			return model.BalanceRule{}, false
+		}
+		*bound.dest = &parsed
+	}
+	return rule, true
+}
+
+// CreateBalanceRule creates a rule keeping an account between bounds.
+// Example: POST /balance-rules {"account_id": 42, "counterparty_account_id": 7, "min_balance": "1000", "max_balance": "5000", "after_transfer": true}
+func (h *AccountHandler) CreateBalanceRule(ctx iris.Context) {
+	if !h.requireBalanceRules(ctx) {
+		return
+	}
+	rule, ok := readBalanceRule(ctx)
+	if !ok {
+		return
+	}
+
+	created, err := h.balanceRules.CreateBalanceRule(rule)
+	if err != nil {
+		balanceRuleError(ctx, err)
+		return
+	}
+	ctx.Header("Location", "/balance-rules/"+strconv.FormatInt(created.ID, 10))
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(newBalanceRuleResponse(created))
+}
+
+// ListBalanceRules lists balance rules in id order.
+// Example: GET /balance-rules?account_id=42&limit=50
+func (h *AccountHandler) ListBalanceRules(ctx iris.Context) {
+	if !h.requireBalanceRules(ctx) {
+		return
+	}
+
+	var accountID int64
+	if raw := ctx.URLParam("account_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: "invalid account_id: " + raw})
+			return
+		}
+		accountID = id
+	}
+	limit, ok := listLimit(ctx, services.MaxBalanceRulesPage)
+	if !ok {
+		return
+	}
+
+	rules, err := h.balanceRules.ListBalanceRules(accountID, limit)
+	if err != nil {
+		balanceRuleError(ctx, err)
+		return
+	}
+	resp := ListBalanceRulesResponse{BalanceRules: make([]BalanceRuleResponse, 0, len(rules))}
+	for _, rule := range rules {
+		resp.BalanceRules = append(resp.BalanceRules, newBalanceRuleResponse(rule))
+	}
+	ctx.JSON(resp)
+}
+
+// GetBalanceRule returns a balance rule.
+// Example: GET /balance-rules/{id}
+func (h *AccountHandler) GetBalanceRule(ctx iris.Context) {
+	if !h.requireBalanceRules(ctx) {
+		return
+	}
+	id, ok := balanceRuleID(ctx)
+	if !ok {
+		return
+	}
+
+	rule, err := h.balanceRules.GetBalanceRule(id)
+	if err != nil {
+		balanceRuleError(ctx, err)
+		return
+	}
+	ctx.JSON(newBalanceRuleResponse(rule))
+}
+
+// UpdateBalanceRule replaces the settings of a balance rule.
+// Example: PUT /balance-rules/{id} {"account_id": 42, "counterparty_account_id": 7, "max_balance": "5000", "schedule": "0 18 * * 1-5", "enabled": false}
+func (h *AccountHandler) UpdateBalanceRule(ctx iris.Context) {
+	if !h.requireBalanceRules(ctx) {
+		return
+	}
+	id, ok := balanceRuleID(ctx)
+	if !ok {
+		return
+	}
+	rule, ok := readBalanceRule(ctx)
+	if !ok {
+		return
+	}
+
+	rule.ID = id
+	updated, err := h.balanceRules.UpdateBalanceRule(rule)
+	if err != nil {
+		balanceRuleError(ctx, err)
+		return
+	}
+	ctx.JSON(newBalanceRuleResponse(updated))
+}
+
+// DeleteBalanceRule removes a balance rule and its sweeps.
+// Example: DELETE /balance-rules/{id}
+func (h *AccountHandler) DeleteBalanceRule(ctx iris.Context) {
+	if !h.requireBalanceRules(ctx) {
+		return
+	}
+	id, ok := balanceRuleID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := h.balanceRules.DeleteBalanceRule(id); err != nil {
+		balanceRuleError(ctx, err)
+		return
+	}
+	ctx.StatusCode(iris.StatusNoContent)
+}
+
+// ListBalanceRuleSweeps lists the transfers made by a balance rule, most recent first.
+// Example: GET /balance-rules/{id}/sweeps?limit=20
+func (h *AccountHandler) ListBalanceRuleSweeps(ctx iris.Context) {
+	if !h.requireBalanceRules(ctx) {
+		return
+	}
+	id, ok := balanceRuleID(ctx)
+	if !ok {
+		return
+	}
+	limit, ok := listLimit(ctx, services.MaxBalanceRulesPage)
+	if !ok {
+		return
+	}
+
+	sweeps, err := h.balanceRules.ListSweeps(id, limit)
+	if err != nil {
+		balanceRuleError(ctx, err)
+		return
+	}
+	resp := ListRuleSweepsResponse{Sweeps: make([]RuleSweepResponse, 0, len(sweeps))}
+	for _, s := range sweeps {
+		resp.Sweeps = append(resp.Sweeps, RuleSweepResponse{
+			ID:                   s.ID,
+			TriggeredBy:          string(s.Trigger),
+			SourceAccountID:      s.SourceAccountID,
+			DestinationAccountID: s.DestinationAccountID,
+			Amount:               s.Amount.String(),
+			Status:               string(s.Status),
+			ErrorCode:            s.ErrorCode,
+			CreatedAt:            s.CreatedAt,
+			FinishedAt:           s.FinishedAt,
+		})
+	}
+	ctx.JSON(resp)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/mocks"
+	"internal-transfers/internal/model"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/httptest"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupBalanceRuleTestApp(t *testing.T) (*iris.Application, *mocks.MockBalanceRuleServicePort) {
+	ctrl := gomock.NewController(t)
+	mockRules := mocks.NewMockBalanceRuleServicePort(ctrl)
+	app := iris.New()
+	RegisterRoutes(app, NewAccountHandler(mocks.NewMockAccountServicePort(ctrl), WithBalanceRuleService(mockRules)))
+	return app, mockRules
+}
+
+func TestCreateBalanceRule(t *testing.T) {
+	app, mockRules := setupBalanceRuleTestApp(t)
+	min, max := decimal.NewFromInt(1000), decimal.NewFromInt(5000)
+	mockRules.EXPECT().CreateBalanceRule(model.BalanceRule{
+		AccountID: 42, CounterpartyAccountID: 7, Min: &min, Max: &max, AfterTransfer: true, Enabled: true,
+	}).Return(model.BalanceRule{
+		ID: 3, AccountID: 42, CounterpartyAccountID: 7, Min: &min, Max: &max, AfterTransfer: true, Enabled: true,
+	}, nil)
+
+	resp := httptest.New(t, app).POST("/balance-rules").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":42,"counterparty_account_id":7,"min_balance":"1000","max_balance":"5000","after_transfer":true}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/balance-rules/3")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("id", 3)
+	obj.ValueEqual("min_balance", "1000")
+	obj.ValueEqual("max_balance", "5000")
+	obj.ValueEqual("enabled", true)
+	obj.NotContainsKey("next_run_at")
+}
+
+func TestCreateBalanceRule_Errors(t *testing.T) {
+	app, mockRules := setupBalanceRuleTestApp(t)
+	e := httptest.New(t, app)
+	create := func(body string, want int) {
+		e.POST("/balance-rules").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+	const valid = `{"account_id":42,"counterparty_account_id":7,"max_balance":"5000","after_transfer":true}`
+
+	create(`{"account_id":42,"max_balance":"5000","after_transfer":true}`, http.StatusBadRequest)
+	create(`{"account_id":42,"counterparty_account_id":42,"max_balance":"5000","after_transfer":true}`, http.StatusBadRequest)
+	create(`{"account_id":42,"counterparty_account_id":7,"min_balance":"lots","after_transfer":true}`, http.StatusBadRequest)
+
+	for _, err := range []error{model.ErrInvalidBalanceRule, model.ErrInvalidSchedule, model.ErrPrecisionTooHigh} {
+		mockRules.EXPECT().CreateBalanceRule(gomock.Any()).Return(model.BalanceRule{}, err)
+		create(valid, http.StatusBadRequest)
+	}
+	mockRules.EXPECT().CreateBalanceRule(gomock.Any()).Return(model.BalanceRule{}, model.ErrAccountNotFound)
+	create(valid, http.StatusNotFound)
+	mockRules.EXPECT().CreateBalanceRule(gomock.Any()).Return(model.BalanceRule{}, assert.AnError)
+	create(valid, http.StatusInternalServerError)
+
+	// Without a balance rule service the endpoints are unavailable
+	ctrl := gomock.NewController(t)
+	disabled := setupTestApp(t, mocks.NewMockAccountServicePort(ctrl))
+	httptest.New(t, disabled).POST("/balance-rules").WithHeader("Content-Type", "application/json").
+		WithText(valid).Expect().Status(http.StatusNotImplemented)
+}
+
+func TestListBalanceRules(t *testing.T) {
+	app, mockRules := setupBalanceRuleTestApp(t)
+	e := httptest.New(t, app)
+
+	max := decimal.NewFromInt(5000)
+	mockRules.EXPECT().ListBalanceRules(int64(0), 100).Return([]model.BalanceRule{
+		{ID: 4, AccountID: 42, CounterpartyAccountID: 7, Max: &max, Schedule: "daily", Enabled: true},
+	}, nil)
+	arr := e.GET("/balance-rules").Expect().Status(http.StatusOK).JSON().Object().Value("balance_rules").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("schedule", "daily")
+	arr.Element(0).Object().NotContainsKey("min_balance")
+
+	mockRules.EXPECT().ListBalanceRules(int64(42), 5).Return(nil, nil)
+	e.GET("/balance-rules").WithQuery("account_id", 42).WithQuery("limit", 5).Expect().
+		Status(http.StatusOK).JSON().Object().Value("balance_rules").Array().Empty()
+
+	e.GET("/balance-rules").WithQuery("account_id", "x").Expect().Status(http.StatusBadRequest)
+	e.GET("/balance-rules").WithQuery("limit", 0).Expect().Status(http.StatusBadRequest)
+}
+
+func TestGetUpdateAndDeleteBalanceRule(t *testing.T) {
+	app, mockRules := setupBalanceRuleTestApp(t)
+	e := httptest.New(t, app)
+	max := decimal.NewFromInt(5000)
+	nextRun := time.Date(2030, 1, 1, 18, 0, 0, 0, time.UTC)
+
+	mockRules.EXPECT().GetBalanceRule(int64(4)).Return(model.BalanceRule{ID: 4, Max: &max, Schedule: "0 18 * * *", NextRunAt: &nextRun, Enabled: true}, nil)
+	obj := e.GET("/balance-rules/4").Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("next_run_at", "2030-01-01T18:00:00Z")
+
+	mockRules.EXPECT().GetBalanceRule(int64(5)).Return(model.BalanceRule{}, model.ErrBalanceRuleNotFound)
+	e.GET("/balance-rules/5").Expect().Status(http.StatusNotFound)
+
+	mockRules.EXPECT().UpdateBalanceRule(model.BalanceRule{
+		ID: 4, AccountID: 42, CounterpartyAccountID: 7, Max: &max, Schedule: "0 18 * * *",
+	}).Return(model.BalanceRule{ID: 4, AccountID: 42, CounterpartyAccountID: 7, Max: &max, Schedule: "0 18 * * *"}, nil)
+	e.PUT("/balance-rules/4").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":42,"counterparty_account_id":7,"max_balance":"5000","schedule":"0 18 * * *","enabled":false}`).Expect().
+		Status(http.StatusOK).JSON().Object().ValueEqual("enabled", false)
+
+	mockRules.EXPECT().UpdateBalanceRule(gomock.Any()).Return(model.BalanceRule{}, model.ErrBalanceRuleNotFound)
+	e.PUT("/balance-rules/5").WithHeader("Content-Type", "application/json").
+		WithText(`{"account_id":42,"counterparty_account_id":7,"max_balance":"5000","after_transfer":true}`).Expect().
+		Status(http.StatusNotFound)
+
+	mockRules.EXPECT().DeleteBalanceRule(int64(4)).Return(nil)
+	e.DELETE("/balance-rules/4").Expect().Status(http.StatusNoContent)
+
+	mockRules.EXPECT().DeleteBalanceRule(int64(0)).Return(model.ErrBalanceRuleIDMustBePositive)
+	e.DELETE("/balance-rules/0").Expect().Status(http.StatusBadRequest)
+
+	mockRules.EXPECT().DeleteBalanceRule(int64(6)).Return(model.ErrBalanceRuleNotFound)
+	e.DELETE("/balance-rules/6").Expect().Status(http.StatusNotFound)
+}
+
+func TestListBalanceRuleSweeps(t *testing.T) {
+	app, mockRules := setupBalanceRuleTestApp(t)
+	e := httptest.New(t, app)
+	created := time.Date(2030, 1, 1, 18, 0, 0, 0, time.UTC)
+
+	mockRules.EXPECT().ListSweeps(int64(4), 12).Return([]model.BalanceRuleSweep{
+		{ID: 9, RuleID: 4, Trigger: model.BalanceRuleAfterTransfer, SourceAccountID: 42, DestinationAccountID: 7,
+			Amount: decimal.NewFromInt(250), Status: model.TransferFailed, ErrorCode: "insufficient_funds", CreatedAt: created},
+	}, nil)
+	arr := e.GET("/balance-rules/4/sweeps").WithQuery("limit", 12).Expect().
+		Status(http.StatusOK).JSON().Object().Value("sweeps").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("triggered_by", "after_transfer")
+	arr.Element(0).Object().ValueEqual("amount", "250")
+	arr.Element(0).Object().ValueEqual("error_code", "insufficient_funds")
+
+	mockRules.EXPECT().ListSweeps(int64(5), 100).Return(nil, model.ErrBalanceRuleNotFound)
+	e.GET("/balance-rules/5/sweeps").Expect().Status(http.StatusNotFound)
+}
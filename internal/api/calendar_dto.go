@@ -0,0 +1,16 @@
+package api
+
+import "time"
+
+// BusinessDayResponse represents one business day. CutoffAt is the last moment
+// it takes transfers, when a cut-off is configured.
+type BusinessDayResponse struct {
+	Date     string     `json:"date"`
+	CutoffAt *time.Time `json:"cutoff_at,omitempty"`
+}
+
+// ListBusinessDaysResponse represents the upcoming business days of the calendar.
+type ListBusinessDaysResponse struct {
+	TimeZone     string                `json:"time_zone"`
+	BusinessDays []BusinessDayResponse `json:"business_days"`
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// MaxBusinessDaysPage is the largest number of business days listed at once
+const MaxBusinessDaysPage = 366
+
+// ListBusinessDays lists the business days on which a transfer submitted at
+// from can still run. from is a date (midnight in the calendar's time zone) or
+// an RFC 3339 time, and defaults to now.
+// Example: GET /calendar/business-days?from=2026-12-24&limit=5
+func (h *AccountHandler) ListBusinessDays(ctx iris.Context) {
+	if h.calendar == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "business day calendar is not enabled"})
+		return
+	}
+
+	from := time.Now()
+	if raw := ctx.URLParam("from"); raw != "" {
+		var err error
+		if from, err = time.ParseInLocation(time.DateOnly, raw, h.calendar.Location()); err != nil {
+			if from, err = time.Parse(time.RFC3339, raw); err != nil {
+				ctx.StatusCode(iris.StatusBadRequest)
+				ctx.JSON(ErrorResponse{Error: "invalid from: must be a date (YYYY-MM-DD) or an RFC 3339 time"})
+				return
+			}
+		}
+	}
+	limit, ok := listLimit(ctx, MaxBusinessDaysPage)
+	if !ok {
+		return
+	}
+
+	days := h.calendar.BusinessDays(from, limit)
+	resp := ListBusinessDaysResponse{
+		TimeZone:     h.calendar.Location().String(),
+		BusinessDays: make([]BusinessDayResponse, len(days)),
+	}
+	for i, day := range days {
+		resp.BusinessDays[i].Date = day.Format(time.DateOnly)
+		if cutoff, ok := h.calendar.CutoffOn(day); ok {
+			cutoff = cutoff.UTC()
+			resp.BusinessDays[i].CutoffAt = &cutoff
+		}
+	}
+	ctx.JSON(resp)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/calendar"
+	"internal-transfers/internal/mocks"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/httptest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListBusinessDays(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+	cal := calendar.New(calendar.Options{
+		Location: london,
+		Cutoff:   17 * time.Hour,
+		Holidays: []calendar.Holiday{{Date: time.Date(2026, 12, 25, 0, 0, 0, 0, time.UTC), Name: "Christmas Day"}},
+	})
+	app := iris.New()
+	RegisterRoutes(app, NewAccountHandler(mocks.NewMockAccountServicePort(gomock.NewController(t)), WithCalendar(cal)))
+	e := httptest.New(t, app)
+
+	obj := e.GET("/calendar/business-days").WithQuery("from", "2026-12-24").WithQuery("limit", 3).
+		Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("time_zone", "Europe/London")
+	days := obj.Value("business_days").Array()
+	days.Length().Equal(3)
+	days.Element(0).Object().ValueEqual("date", "2026-12-24")
+	days.Element(0).Object().ValueEqual("cutoff_at", "2026-12-24T17:00:00Z")
+	days.Element(1).Object().ValueEqual("date", "2026-12-28")
+	days.Element(2).Object().ValueEqual("date", "2026-12-29")
+
+	// A day whose cut-off has passed is no longer upcoming; summer time shifts the cut-off
+	days = e.GET("/calendar/business-days").WithQuery("from", "2026-06-05T16:30:00Z").WithQuery("limit", 1).
+		Expect().Status(http.StatusOK).JSON().Object().Value("business_days").Array()
+	days.Element(0).Object().ValueEqual("date", "2026-06-08")
+	days.Element(0).Object().ValueEqual("cutoff_at", "2026-06-08T16:00:00Z")
+
+	e.GET("/calendar/business-days").Expect().Status(http.StatusOK).
+		JSON().Object().Value("business_days").Array().Length().Equal(defaultListLimit)
+	e.GET("/calendar/business-days").WithQuery("from", "next week").Expect().Status(http.StatusBadRequest)
+	e.GET("/calendar/business-days").WithQuery("limit", MaxBusinessDaysPage+1).Expect().Status(http.StatusBadRequest)
+
+	// Without a calendar the endpoint is unavailable
+	disabled := setupTestApp(t, mocks.NewMockAccountServicePort(gomock.NewController(t)))
+	httptest.New(t, disabled).GET("/calendar/business-days").Expect().Status(http.StatusNotImplemented)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// ExternalTransferRequest represents the request body for a deposit or a
+// withdrawal. ClearingAccountID defaults to the first configured clearing
+// account; ExternalReference is the outside party's id of the transfer,
+// unique per client.
+type ExternalTransferRequest struct {
+	AccountID         int64  `json:"account_id" validate:"required,gt=0"`
+	Amount            string `json:"amount" validate:"required"`
+	ClearingAccountID int64  `json:"clearing_account_id,omitempty" validate:"gte=0"`
+	ExternalReference string `json:"external_reference,omitempty" validate:"max=128"`
+}
+
+// ExternalTransferResponse represents a deposit or a withdrawal.
+type ExternalTransferResponse struct {
+	ID                int64     `json:"id"`
+	AccountID         int64     `json:"account_id"`
+	ClearingAccountID int64     `json:"clearing_account_id"`
+	Amount            string    `json:"amount"`
+	Status            string    `json:"status"`
+	ExternalReference string    `json:"external_reference,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// ListDepositsResponse represents a list of deposits, newest first.
+type ListDepositsResponse struct {
+	Deposits []ExternalTransferResponse `json:"deposits"`
+}
+
+// ListWithdrawalsResponse represents a list of withdrawals, newest first.
+type ListWithdrawalsResponse struct {
+	Withdrawals []ExternalTransferResponse `json:"withdrawals"`
+}
+
+// newExternalTransferResponse converts a deposit or withdrawal into its response body
+func newExternalTransferResponse(t model.ExternalTransfer) ExternalTransferResponse {
+	return ExternalTransferResponse{
+		ID:                t.ID,
+		AccountID:         t.AccountID,
+		ClearingAccountID: t.ClearingAccountID,
+		Amount:            t.Amount.String(),
+		Status:            string(t.Status),
+		ExternalReference: t.ExternalReference,
+		CreatedAt:         t.CreatedAt,
+		UpdatedAt:         t.UpdatedAt,
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"internal-transfers/internal/model"
+	"internal-transfers/internal/services"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/shopspring/decimal"
+)
+
+// requireExternalTransfers responds 501 and returns false when deposits and
+// withdrawals are not enabled
+func (h *AccountHandler) requireExternalTransfers(ctx iris.Context) bool {
+	if h.externalTransfers == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "deposits and withdrawals are not enabled"})
+		return false
+	}
+	return true
+}
+
+// externalTransferPath returns the collection path of a kind
+func externalTransferPath(kind model.ExternalTransferKind) string {
+	return "/" + string(kind) + "s"
+}
+
+// externalTransferID reads the deposit or withdrawal id path parameter,
+// responding 400 when it is invalid
+func externalTransferID(ctx iris.Context, kind model.ExternalTransferKind) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid " + string(kind) + " id: " + err.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// externalTransferError responds to an error of the external transfer service
+func externalTransferError(ctx iris.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrAccountIDMustBePositive),
+		errors.Is(err, model.ErrExternalTransferIDMustBePositive),
+		errors.Is(err, model.ErrAmountMustBePositive),
+		errors.Is(err, model.ErrPrecisionTooHigh),
+		errors.Is(err, model.ErrUnknownClearingAccount),
+		errors.Is(err, model.ErrClearingAccountNotAllowed),
+		errors.Is(err, model.ErrSystemAccountNotAllowed),
+		errors.Is(err, model.ErrInsufficientFunds),
+		errors.Is(err, model.ErrChildBalanceLimitExceeded):
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrExternalTransferNotFound), errors.Is(err, model.ErrAccountNotFound):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrDuplicateExternalReference), errors.Is(err, model.ErrExternalTransferNotPending):
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	default:
+		log.Printf("external transfer error: %v", err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "internal server error"})
+	}
+}
+
+// CreateDeposit records a pending deposit; the account is credited when it settles.
+// Example: POST /deposits {"account_id": 1, "amount": "100.00", "external_reference": "wire-123"}
+func (h *AccountHandler) CreateDeposit(ctx iris.Context) {
+	h.createExternalTransfer(ctx, model.Deposit)
+}
+
+// CreateWithdrawal debits the account into a clearing account and records a
+// pending withdrawal.
+// Example: POST /withdrawals {"account_id": 1, "amount": "50.00"}
+func (h *AccountHandler) CreateWithdrawal(ctx iris.Context) {
+	h.createExternalTransfer(ctx, model.Withdrawal)
+}
+
+// createExternalTransfer reads the request body and creates a deposit or withdrawal
+func (h *AccountHandler) createExternalTransfer(ctx iris.Context, kind model.ExternalTransferKind) {
+	if !h.requireExternalTransfers(ctx) {
+		return
+	}
+	var req ExternalTransferRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid amount: " + err.Error()})
+		return
+	}
+	clientID, ok := readClientID(ctx)
+	if !ok {
+		return
+	}
+
+	created, err := h.externalTransfers.CreateExternalTransfer(model.ExternalTransfer{
+		Kind:              kind,
+		AccountID:         req.AccountID,
+		ClearingAccountID: req.ClearingAccountID,
+		Amount:            amount,
+		ClientID:          clientID,
+		ExternalReference: req.ExternalReference,
+	})
+	if err != nil {
+		externalTransferError(ctx, err)
+		return
+	}
+	ctx.Header("Location", externalTransferPath(kind)+"/"+strconv.FormatInt(created.ID, 10))
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(newExternalTransferResponse(created))
+}
+
+// ListDeposits lists deposits newest first, optionally of one account.
+// Example: GET /deposits?account_id=1&limit=50
+func (h *AccountHandler) ListDeposits(ctx iris.Context) {
+	transfers, ok := h.listExternalTransfers(ctx, model.Deposit)
+	if ok {
+		ctx.JSON(ListDepositsResponse{Deposits: transfers})
+	}
+}
+
+// ListWithdrawals lists withdrawals newest first, optionally of one account.
+// Example: GET /withdrawals?account_id=1&limit=50
+func (h *AccountHandler) ListWithdrawals(ctx iris.Context) {
+	transfers, ok := h.listExternalTransfers(ctx, model.Withdrawal)
+	if ok {
+		ctx.JSON(ListWithdrawalsResponse{Withdrawals: transfers})
+	}
+}
+
+// listExternalTransfers reads the filters and lists deposits or withdrawals,
+// responding with an error and returning false when that fails
+func (h *AccountHandler) listExternalTransfers(ctx iris.Context, kind model.ExternalTransferKind) ([]ExternalTransferResponse, bool) {
+	if !h.requireExternalTransfers(ctx) {
+		return nil, false
+	}
+	var accountID int64
+	if raw := ctx.URLParam("account_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: "invalid account_id: " + raw})
+			return nil, false
+		}
+		accountID = id
+	}
+	limit, ok := listLimit(ctx, services.MaxExternalTransfersPage)
+	if !ok {
+		return nil, false
+	}
+
+	transfers, err := h.externalTransfers.ListExternalTransfers(kind, accountID, limit)
+	if err != nil {
+		externalTransferError(ctx, err)
+		return nil, false
+	}
+	resp := make([]ExternalTransferResponse, 0, len(transfers))
+	for _, t := range transfers {
+		resp = append(resp, newExternalTransferResponse(t))
+	}
+	return resp, true
+}
+
+// GetDeposit returns a deposit.
+// Example: GET /deposits/{id}
+func (h *AccountHandler) GetDeposit(ctx iris.Context) {
+	h.runExternalTransfer(ctx, model.Deposit, services.ExternalTransferServicePort.GetExternalTransfer)
+}
+
+// GetWithdrawal returns a withdrawal.
+// Example: GET /withdrawals/{id}
+func (h *AccountHandler) GetWithdrawal(ctx iris.Context) {
+	h.runExternalTransfer(ctx, model.Withdrawal, services.ExternalTransferServicePort.GetExternalTransfer)
+}
+
+// SettleDeposit confirms a pending deposit, crediting its account.
+// Example: POST /deposits/{id}/settle
+func (h *AccountHandler) SettleDeposit(ctx iris.Context) {
+	h.runExternalTransfer(ctx, model.Deposit, services.ExternalTransferServicePort.SettleExternalTransfer)
+}
+
+// FailDeposit rejects a pending deposit; no funds move.
+// Example: POST /deposits/{id}/fail
+func (h *AccountHandler) FailDeposit(ctx iris.Context) {
+	h.runExternalTransfer(ctx, model.Deposit, services.ExternalTransferServicePort.FailExternalTransfer)
+}
+
+// SettleWithdrawal confirms a pending withdrawal, whose funds already left its account.
+// Example: POST /withdrawals/{id}/settle
+func (h *AccountHandler) SettleWithdrawal(ctx iris.Context) {
+	h.runExternalTransfer(ctx, model.Withdrawal, services.ExternalTransferServicePort.SettleExternalTransfer)
+}
+
+// FailWithdrawal rejects a pending withdrawal, returning its funds to its account.
+// Example: POST /withdrawals/{id}/fail
+func (h *AccountHandler) FailWithdrawal(ctx iris.Context) {
+	h.runExternalTransfer(ctx, model.Withdrawal, services.ExternalTransferServicePort.FailExternalTransfer)
+}
+
+// runExternalTransfer runs a service method on the deposit or withdrawal of
+// the id path parameter and responds with the result
+func (h *AccountHandler) runExternalTransfer(ctx iris.Context, kind model.ExternalTransferKind,
+	op func(services.ExternalTransferServicePort, model.ExternalTransferKind, int64) (model.ExternalTransfer, error)) {
+	if !h.requireExternalTransfers(ctx) {
+		return
+	}
+	id, ok := externalTransferID(ctx, kind)
+	if !ok {
+		return
+	}
+
+	t, err := op(h.externalTransfers, kind, id)
+	if err != nil {
+		externalTransferError(ctx, err)
+		return
+	}
+	ctx.JSON(newExternalTransferResponse(t))
+}
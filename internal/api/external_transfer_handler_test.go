@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/mocks"
+	"internal-transfers/internal/model"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/httptest"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupExternalTransferTestApp(t *testing.T) (*iris.Application, *mocks.MockExternalTransferServicePort) {
+	ctrl := gomock.NewController(t)
+	mockExternal := mocks.NewMockExternalTransferServicePort(ctrl)
+	app := iris.New()
+	RegisterRoutes(app, NewAccountHandler(mocks.NewMockAccountServicePort(ctrl), WithExternalTransferService(mockExternal)))
+	return app, mockExternal
+}
+
+func TestCreateDeposit(t *testing.T) {
+	app, mockExternal := setupExternalTransferTestApp(t)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockExternal.EXPECT().CreateExternalTransfer(model.ExternalTransfer{
+		Kind: model.Deposit, AccountID: 1, Amount: decimal.RequireFromString("100.5"), ClientID: "acme", ExternalReference: "wire-1",
+	}).Return(model.ExternalTransfer{
+		ID: 3, Kind: model.Deposit, AccountID: 1, ClearingAccountID: 90, Amount: decimal.RequireFromString("100.5"),
+		Status: model.ExternalTransferPending, ClientID: "acme", ExternalReference: "wire-1", CreatedAt: created, UpdatedAt: created,
+	}, nil)
+
+	resp := httptest.New(t, app).POST("/deposits").WithHeader("Content-Type", "application/json").WithHeader(ClientIDHeader, "acme").
+		WithText(`{"account_id":1,"amount":"100.5","external_reference":"wire-1"}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/deposits/3")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("id", 3)
+	obj.ValueEqual("clearing_account_id", 90)
+	obj.ValueEqual("amount", "100.5")
+	obj.ValueEqual("status", "pending")
+	obj.ValueEqual("external_reference", "wire-1")
+}
+
+func TestCreateWithdrawal_Errors(t *testing.T) {
+	app, mockExternal := setupExternalTransferTestApp(t)
+	e := httptest.New(t, app)
+	create := func(body string, want int) {
+		e.POST("/withdrawals").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+	const valid = `{"account_id":1,"amount":"50"}`
+
+	create(`{"amount":"50"}`, http.StatusBadRequest)
+	create(`{"account_id":1,"amount":"lots"}`, http.StatusBadRequest)
+	create(`{"account_id":1,"amount":"50","clearing_account_id":-1}`, http.StatusBadRequest)
+
+	mockExternal.EXPECT().CreateExternalTransfer(gomock.Any()).Return(model.ExternalTransfer{}, model.ErrInsufficientFunds)
+	create(valid, http.StatusBadRequest)
+	mockExternal.EXPECT().CreateExternalTransfer(gomock.Any()).Return(model.ExternalTransfer{}, model.ErrUnknownClearingAccount)
+	create(valid, http.StatusBadRequest)
+	mockExternal.EXPECT().CreateExternalTransfer(gomock.Any()).Return(model.ExternalTransfer{}, model.ErrAccountNotFound)
+	create(valid, http.StatusNotFound)
+	mockExternal.EXPECT().CreateExternalTransfer(gomock.Any()).Return(model.ExternalTransfer{}, model.ErrDuplicateExternalReference)
+	create(valid, http.StatusConflict)
+	mockExternal.EXPECT().CreateExternalTransfer(gomock.Any()).Return(model.ExternalTransfer{}, assert.AnError)
+	create(valid, http.StatusInternalServerError)
+
+	// Without clearing accounts the endpoints are unavailable
+	ctrl := gomock.NewController(t)
+	disabled := setupTestApp(t, mocks.NewMockAccountServicePort(ctrl))
+	httptest.New(t, disabled).POST("/withdrawals").WithHeader("Content-Type", "application/json").
+		WithText(valid).Expect().Status(http.StatusNotImplemented)
+	httptest.New(t, disabled).POST("/deposits/1/settle").Expect().Status(http.StatusNotImplemented)
+}
+
+func TestListAndGetExternalTransfers(t *testing.T) {
+	app, mockExternal := setupExternalTransferTestApp(t)
+	e := httptest.New(t, app)
+
+	mockExternal.EXPECT().ListExternalTransfers(model.Deposit, int64(1), 100).Return([]model.ExternalTransfer{
+		{ID: 4, Kind: model.Deposit, AccountID: 1, ClearingAccountID: 90, Amount: decimal.NewFromInt(5), Status: model.ExternalTransferSettled},
+	}, nil)
+	arr := e.GET("/deposits").WithQuery("account_id", 1).Expect().Status(http.StatusOK).JSON().Object().Value("deposits").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("status", "settled")
+	arr.Element(0).Object().NotContainsKey("external_reference")
+
+	mockExternal.EXPECT().ListExternalTransfers(model.Withdrawal, int64(0), 100).Return(nil, nil)
+	e.GET("/withdrawals").Expect().Status(http.StatusOK).JSON().Object().Value("withdrawals").Array().Empty()
+	e.GET("/withdrawals").WithQuery("account_id", "x").Expect().Status(http.StatusBadRequest)
+
+	mockExternal.EXPECT().GetExternalTransfer(model.Withdrawal, int64(4)).Return(model.ExternalTransfer{ID: 4, Kind: model.Withdrawal, Status: model.ExternalTransferPending}, nil)
+	e.GET("/withdrawals/4").Expect().Status(http.StatusOK).JSON().Object().ValueEqual("status", "pending")
+	mockExternal.EXPECT().GetExternalTransfer(model.Deposit, int64(5)).Return(model.ExternalTransfer{}, model.ErrExternalTransferNotFound)
+	e.GET("/deposits/5").Expect().Status(http.StatusNotFound)
+}
+
+func TestSettleAndFailExternalTransfers(t *testing.T) {
+	app, mockExternal := setupExternalTransferTestApp(t)
+	e := httptest.New(t, app)
+
+	mockExternal.EXPECT().SettleExternalTransfer(model.Deposit, int64(4)).Return(model.ExternalTransfer{ID: 4, Kind: model.Deposit, Status: model.ExternalTransferSettled}, nil)
+	e.POST("/deposits/4/settle").Expect().Status(http.StatusOK).JSON().Object().ValueEqual("status", "settled")
+	mockExternal.EXPECT().FailExternalTransfer(model.Withdrawal, int64(6)).Return(model.ExternalTransfer{ID: 6, Kind: model.Withdrawal, Status: model.ExternalTransferFailed}, nil)
+	e.POST("/withdrawals/6/fail").Expect().Status(http.StatusOK).JSON().Object().ValueEqual("status", "failed")
+
+	mockExternal.EXPECT().FailExternalTransfer(model.Deposit, int64(4)).Return(model.ExternalTransfer{}, model.ErrExternalTransferNotPending)
+	e.POST("/deposits/4/fail").Expect().Status(http.StatusConflict)
+	mockExternal.EXPECT().SettleExternalTransfer(model.Withdrawal, int64(7)).Return(model.ExternalTransfer{}, model.ErrExternalTransferNotFound)
+	e.POST("/withdrawals/7/settle").Expect().Status(http.StatusNotFound)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// FeeTierRequest represents a tier of a tiered fee schedule: transfers of at
+// least MinAmount, up to the next tier, are charged Flat plus Rate, as a
+// fraction, of their amount.
+type FeeTierRequest struct {
+	MinAmount string `json:"min_amount" validate:"required"`
+	Flat      string `json:"flat,omitempty"`
+	Rate      string `json:"rate,omitempty"`
+}
+
+// FeeScheduleRequest represents the request body for creating a fee schedule.
+// Kind is flat, charging Flat, percentage, charging Rate of the amount, or
+// tiered. MinFee and MaxFee bound the fee; an empty ClientID makes the
+// schedule the default for clients without one of their own. AccountType
+// limits the schedule to transfers from accounts of that type.
+type FeeScheduleRequest struct {
+	Name        string           `json:"name" validate:"required,max=200"`
+	ClientID    string           `json:"client_id,omitempty" validate:"max=64"`
+	AccountType string           `json:"account_type,omitempty" validate:"omitempty,oneof=asset liability equity revenue expense"`
+	Kind        string           `json:"kind" validate:"required,oneof=flat percentage tiered"`
+	Flat        string           `json:"flat,omitempty" validate:"required_if=Kind flat"`
+	Rate        string           `json:"rate,omitempty" validate:"required_if=Kind percentage"`
+	MinFee      string           `json:"min_fee,omitempty"`
+	MaxFee      string           `json:"max_fee,omitempty"`
+	Tiers       []FeeTierRequest `json:"tiers,omitempty" validate:"required_if=Kind tiered,max=100,dive"`
+}
+
+// FeeTierResponse represents a tier of a fee schedule.
+type FeeTierResponse struct {
+	MinAmount string `json:"min_amount"`
+	Flat      string `json:"flat"`
+	Rate      string `json:"rate"`
+}
+
+// FeeScheduleResponse represents a fee schedule.
+type FeeScheduleResponse struct {
+	ID          int64             `json:"id"`
+	Name        string            `json:"name"`
+	ClientID    string            `json:"client_id,omitempty"`
+	AccountType string            `json:"account_type,omitempty"`
+	Kind        string            `json:"kind"`
+	Flat        string            `json:"flat"`
+	Rate        string            `json:"rate"`
+	MinFee      string            `json:"min_fee"`
+	MaxFee      string            `json:"max_fee,omitempty"`
+	Tiers       []FeeTierResponse `json:"tiers,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// ListFeeSchedulesResponse represents a list of fee schedules.
+type ListFeeSchedulesResponse struct {
+	FeeSchedules []FeeScheduleResponse `json:"fee_schedules"`
+}
+
+// FeeResponse itemizes the fee charged on a transfer: what it cost, where it
+// went, and what the transfer debited and credited with it.
+type FeeResponse struct {
+	ScheduleID          int64  `json:"schedule_id,omitempty"`
+	AccountID           int64  `json:"account_id"`
+	Amount              string `json:"amount"`
+	Mode                string `json:"mode"`
+	SourceDebited       string `json:"source_debited"`
+	DestinationCredited string `json:"destination_credited"`
+}
+
+// newFeeScheduleResponse converts a fee schedule into its response body
+func newFeeScheduleResponse(s model.FeeSchedule) FeeScheduleResponse {
+	resp := FeeScheduleResponse{
+		ID:          s.ID,
+		Name:        s.Name,
+		ClientID:    s.ClientID,
+		AccountType: string(s.AccountType),
+		Kind:        string(s.Kind),
+		Flat:        s.Flat.String(),
+		Rate:        s.Rate.String(),
+		MinFee:      s.MinFee.String(),
+		CreatedAt:   s.CreatedAt,
+	}
+	if s.MaxFee.IsPositive() {
+		resp.MaxFee = s.MaxFee.String()
+	}
+	for _, tier := range s.Tiers {
+		resp.Tiers = append(resp.Tiers, FeeTierResponse{MinAmount: tier.MinAmount.String(), Flat: tier.Flat.String(), Rate: tier.Rate.String()})
+	}
+	return resp
+}
+
+// newFeeResponse itemizes the fee of a transfer charged one
+func newFeeResponse(t model.Transfer) *FeeResponse {
+	return &FeeResponse{
+		ScheduleID:          t.Fee.ScheduleID,
+		AccountID:           t.Fee.AccountID,
+		Amount:              t.Fee.Amount.String(),
+		Mode:                string(t.Fee.Mode),
+		SourceDebited:       t.Debited().String(),
+		DestinationCredited: t.Credited().String(),
+	}
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"internal-transfers/internal/model"
+	"internal-transfers/internal/services"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/shopspring/decimal"
+)
+
+// requireFees responds 501 and returns false when fees are not enabled
+func (h *AccountHandler) requireFees(ctx iris.Context) bool {
+	if h.fees == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "fees are not enabled"})
+		return false
+	}
+	return true
+}
+
+// feeScheduleID reads the fee schedule id path parameter, responding 400 when it is invalid
+func feeScheduleID(ctx iris.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid fee schedule id: " + err.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// feeScheduleError responds to an error of the fee service
+func feeScheduleError(ctx iris.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrFeeScheduleIDMustBePositive),
+		errors.Is(err, model.ErrPrecisionTooHigh),
+		errors.Is(err, model.ErrInvalidFeeSchedule):
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrFeeScheduleNotFound):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrFeeScheduleExists):
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	default:
+		log.Printf("fee schedule error: %v", err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "internal server error"})
+	}
+}
+
+// readFeeSchedule reads and validates a fee schedule request body,
+// responding 400 when it is invalid
+func readFeeSchedule(ctx iris.Context) (model.FeeSchedule, bool) {
+	var req FeeScheduleRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return model.FeeSchedule{}, false
+	}
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return model.FeeSchedule{}, false
+	}
+
+	schedule := model.FeeSchedule{
+		Name:        req.Name,
+		ClientID:    req.ClientID,
+		AccountType: model.AccountType(req.AccountType),
+		Kind:        model.FeeKind(req.Kind),
+		Tiers:       make([]model.FeeTier, len(req.Tiers)),
+	}
+	type field struct {
+		name  string
+		value string
+		dest  *decimal.Decimal
+	}
+	fields := []field{
+		{"flat", req.Flat, &schedule.Flat},
+		{"rate", req.Rate, &schedule.Rate},
+		{"min_fee", req.MinFee, &schedule.MinFee},
+		{"max_fee", req.MaxFee, &schedule.MaxFee},
+	}
+	for i, tier := range req.Tiers {
+		suffix := " of tier " + strconv.Itoa(i)
+		fields = append(fields,
+			field{"min_amount" + suffix, tier.MinAmount, &schedule.Tiers[i].MinAmount},
+			field{"flat" + suffix, tier.Flat, &schedule.Tiers[i].Flat},
+			field{"rate" + suffix, tier.Rate, &schedule.Tiers[i].Rate})
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		parsed, err := decimal.NewFromString(f.value)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: "invalid " + f.name + ": " + err.Error()})
+			return model.FeeSchedule{}, false
+		}
+		*f.dest = parsed
+	}
+	return schedule, true
+}
+
+// CreateFeeSchedule creates a fee schedule for a client, or the default one.
+// Example: POST /fee-schedules {"name": "standard", "kind": "percentage", "rate": "0.01", "min_fee": "0.50", "max_fee": "25"}
+func (h *AccountHandler) CreateFeeSchedule(ctx iris.Context) {
+	if !h.requireFees(ctx) {
+		return
+	}
+	schedule, ok := readFeeSchedule(ctx)
+	if !ok {
+		return
+	}
+
+	created, err := h.fees.CreateSchedule(schedule)
+	if err != nil {
+		feeScheduleError(ctx, err)
+		return
+	}
+	ctx.Header("Location", "/fee-schedules/"+strconv.FormatInt(created.ID, 10))
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(newFeeScheduleResponse(created))
+}
+
+// ListFeeSchedules lists fee schedules in id order.
+// Example: GET /fee-schedules?limit=50
+func (h *AccountHandler) ListFeeSchedules(ctx iris.Context) {
+	if !h.requireFees(ctx) {
+		return
+	}
+	limit, ok := listLimit(ctx, services.MaxFeeSchedulesPage)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.fees.ListSchedules(limit)
+	if err != nil {
+		feeScheduleError(ctx, err)
+		return
+	}
+	resp := ListFeeSchedulesResponse{FeeSchedules: make([]FeeScheduleResponse, 0, len(schedules))}
+	for _, s := range schedules {
+		resp.FeeSchedules = append(resp.FeeSchedules, newFeeScheduleResponse(s))
+	}
+	ctx.JSON(resp)
+}
+
+// GetFeeSchedule returns a fee schedule.
+// Example: GET /fee-schedules/{id}
+func (h *AccountHandler) GetFeeSchedule(ctx iris.Context) {
+	if !h.requireFees(ctx) {
+		return
+	}
+	id, ok := feeScheduleID(ctx)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.fees.GetSchedule(id)
+	if err != nil {
+		feeScheduleError(ctx, err)
+		return
+	}
+	ctx.JSON(newFeeScheduleResponse(schedule))
+}
+
+// DeleteFeeSchedule deletes a fee schedule; fees already charged are kept.
+// Example: DELETE /fee-schedules/{id}
+func (h *AccountHandler) DeleteFeeSchedule(ctx iris.Context) {
+	if !h.requireFees(ctx) {
+		return
+	}
+	id, ok := feeScheduleID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := h.fees.DeleteSchedule(id); err != nil {
+		feeScheduleError(ctx, err)
+		return
+	}
+	ctx.StatusCode(iris.StatusNoContent)
+}
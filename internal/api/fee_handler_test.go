@@ -0,0 +1,148 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/mocks"
+	"internal-transfers/internal/model"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/httptest"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupFeeTestApp(t *testing.T) (*iris.Application, *mocks.MockAccountServicePort, *mocks.MockFeeServicePort) {
+	ctrl := gomock.NewController(t)
+	mockSvc := mocks.NewMockAccountServicePort(ctrl)
+	mockFees := mocks.NewMockFeeServicePort(ctrl)
+	app := iris.New()
+	RegisterRoutes(app, NewAccountHandler(mockSvc, WithFeeService(mockFees)))
+	return app, mockSvc, mockFees
+}
+
+func TestCreateFeeSchedule(t *testing.T) {
+	app, _, mockFees := setupFeeTestApp(t)
+	tiers := []model.FeeTier{
+		{MinAmount: decimal.RequireFromString("0"), Flat: decimal.RequireFromString("1")},
+		{MinAmount: decimal.RequireFromString("100"), Rate: decimal.RequireFromString("0.005")},
+	}
+	mockFees.EXPECT().CreateSchedule(model.FeeSchedule{
+		Name: "tiered", ClientID: "acme", Kind: model.FeeTiered, MaxFee: decimal.RequireFromString("20"), Tiers: tiers,
+	}).Return(model.FeeSchedule{ID: 4, Name: "tiered", ClientID: "acme", Kind: model.FeeTiered, MaxFee: decimal.RequireFromString("20"), Tiers: tiers}, nil)
+
+	resp := httptest.New(t, app).POST("/fee-schedules").WithHeader("Content-Type", "application/json").
+		WithText(`{"name":"tiered","client_id":"acme","kind":"tiered","max_fee":"20","tiers":[{"min_amount":"0","flat":"1"},{"min_amount":"100","rate":"0.005"}]}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/fee-schedules/4")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("id", 4)
+	obj.ValueEqual("client_id", "acme")
+	obj.ValueEqual("max_fee", "20")
+	obj.Value("tiers").Array().Length().Equal(2)
+	obj.Value("tiers").Array().Element(1).Object().ValueEqual("rate", "0.005")
+}
+
+func TestCreateFeeSchedule_Errors(t *testing.T) {
+	app, _, mockFees := setupFeeTestApp(t)
+	e := httptest.New(t, app)
+	create := func(body string, want int) {
+		e.POST("/fee-schedules").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+	const valid = `{"name":"standard","kind":"percentage","rate":"0.01","min_fee":"0.5"}`
+
+	create(`{"name":"standard","kind":"weekly","flat":"1"}`, http.StatusBadRequest)
+	create(`{"name":"standard","kind":"flat"}`, http.StatusBadRequest)
+	create(`{"name":"standard","kind":"tiered"}`, http.StatusBadRequest)
+	create(`{"name":"standard","kind":"percentage","rate":"high"}`, http.StatusBadRequest)
+	create(`{"name":"standard","kind":"tiered","tiers":[{"min_amount":"0","flat":"cheap"}]}`, http.StatusBadRequest)
+	create(`{"name":"standard","kind":"flat","flat":"1","account_type":"savings"}`, http.StatusBadRequest)
+
+	mockFees.EXPECT().CreateSchedule(gomock.Any()).Return(model.FeeSchedule{}, model.ErrInvalidFeeSchedule)
+	create(valid, http.StatusBadRequest)
+	mockFees.EXPECT().CreateSchedule(gomock.Any()).Return(model.FeeSchedule{}, model.ErrFeeScheduleExists)
+	create(valid, http.StatusConflict)
+	mockFees.EXPECT().CreateSchedule(gomock.Any()).Return(model.FeeSchedule{}, assert.AnError)
+	create(valid, http.StatusInternalServerError)
+
+	// Without a fee service the endpoints are unavailable
+	ctrl := gomock.NewController(t)
+	disabled := setupTestApp(t, mocks.NewMockAccountServicePort(ctrl))
+	httptest.New(t, disabled).POST("/fee-schedules").WithHeader("Content-Type", "application/json").
+		WithText(valid).Expect().Status(http.StatusNotImplemented)
+	httptest.New(t, disabled).GET("/fee-schedules").Expect().Status(http.StatusNotImplemented)
+}
+
+func TestListGetAndDeleteFeeSchedules(t *testing.T) {
+	app, _, mockFees := setupFeeTestApp(t)
+	e := httptest.New(t, app)
+
+	mockFees.EXPECT().ListSchedules(100).Return([]model.FeeSchedule{{ID: 4, Name: "flat", Kind: model.FeeFlat, Flat: decimal.RequireFromString("0.25")}}, nil)
+	arr := e.GET("/fee-schedules").Expect().Status(http.StatusOK).JSON().Object().Value("fee_schedules").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("flat", "0.25")
+	arr.Element(0).Object().NotContainsKey("max_fee")
+
+	mockFees.EXPECT().GetSchedule(int64(4)).Return(model.FeeSchedule{ID: 4, Name: "flat", Kind: model.FeeFlat, AccountType: model.AccountAsset}, nil)
+	obj := e.GET("/fee-schedules/4").Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("kind", "flat")
+	obj.ValueEqual("account_type", "asset")
+	mockFees.EXPECT().GetSchedule(int64(5)).Return(model.FeeSchedule{}, model.ErrFeeScheduleNotFound)
+	e.GET("/fee-schedules/5").Expect().Status(http.StatusNotFound)
+
+	mockFees.EXPECT().DeleteSchedule(int64(4)).Return(nil)
+	e.DELETE("/fee-schedules/4").Expect().Status(http.StatusNoContent)
+	mockFees.EXPECT().DeleteSchedule(int64(4)).Return(model.ErrFeeScheduleNotFound)
+	e.DELETE("/fee-schedules/4").Expect().Status(http.StatusNotFound)
+}
+
+func TestSubmitTransaction_ItemizesFee(t *testing.T) {
+	app, mockSvc, _ := setupFeeTestApp(t)
+	e := httptest.New(t, app)
+	fee := &model.Fee{ScheduleID: 4, AccountID: 9, Amount: decimal.RequireFromString("0.5"), Mode: model.FeeDeducted}
+	mockSvc.EXPECT().TransferWithFee(int64(1), int64(2), decimal.RequireFromString("10"), "acme", model.FeeDeducted).Return(fee, nil)
+
+	obj := e.POST("/transactions").WithHeader("Content-Type", "application/json").WithHeader(ClientIDHeader, "acme").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"10","fee_mode":"deducted"}`).Expect().
+		Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("amount", "10")
+	feeObj := obj.Value("fee").Object()
+	feeObj.ValueEqual("schedule_id", 4)
+	feeObj.ValueEqual("account_id", 9)
+	feeObj.ValueEqual("amount", "0.5")
+	feeObj.ValueEqual("mode", "deducted")
+	feeObj.ValueEqual("source_debited", "10")
+	feeObj.ValueEqual("destination_credited", "9.5")
+
+	mockSvc.EXPECT().TransferWithFee(int64(1), int64(2), decimal.RequireFromString("10"), "", model.FeeMode("")).Return(nil, nil)
+	obj = e.POST("/transactions").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"10"}`).Expect().
+		Status(http.StatusOK).JSON().Object()
+	obj.NotContainsKey("fee")
+
+	e.POST("/transactions").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"10","fee_mode":"sideways"}`).Expect().
+		Status(http.StatusBadRequest)
+	mockSvc.EXPECT().TransferWithFee(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, model.ErrFeeExceedsAmount)
+	e.POST("/transactions").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"0.1","fee_mode":"deducted"}`).Expect().
+		Status(http.StatusBadRequest)
+}
+
+func TestGetTransaction_ItemizesFee(t *testing.T) {
+	app, _, mockTransfers := setupTransferTestApp(t)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockTransfers.EXPECT().GetTransfer(int64(7)).Return(model.Transfer{
+		ID: 7, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.RequireFromString("10"),
+		Status: model.TransferCompleted, CreatedAt: created, UpdatedAt: created,
+		Fee: &model.Fee{AccountID: 9, Amount: decimal.RequireFromString("1"), Mode: model.FeeOnTop},
+	}, nil)
+
+	feeObj := httptest.New(t, app).GET("/transactions/7").Expect().Status(http.StatusOK).JSON().Object().Value("fee").Object()
+	feeObj.NotContainsKey("schedule_id")
+	feeObj.ValueEqual("source_debited", "11")
+	feeObj.ValueEqual("destination_credited", "10")
+}
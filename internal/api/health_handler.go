@@ -0,0 +1,43 @@
+package api
+
+import (
+	"internal-transfers/internal/db"
+
+	"github.com/kataras/iris/v12"
+)
+
+// PoolHealthSource provides the latest database pool health snapshot
+type PoolHealthSource interface {
+	Snapshot() db.PoolHealth
+}
+
+// HealthResponse represents the response body of the health endpoint.
+type HealthResponse struct {
+	Status   string        `json:"status"`
+	Database db.PoolHealth `json:"database"`
+}
+
+type HealthHandler struct {
+	pool PoolHealthSource
+}
+
+func NewHealthHandler(pool PoolHealthSource) *HealthHandler {
+	return &HealthHandler{pool: pool}
+}
+
+// Health reports the service health including database pool saturation.
+// It responds 200 while the database is reachable (even if the pool is
+// saturated) and 503 when it is not.
+// Example: GET /health
+func (h *HealthHandler) Health(ctx iris.Context) {
+	pool := h.pool.Snapshot()
+	resp := HealthResponse{Status: pool.Status, Database: pool}
+	if pool.Status == db.PoolStatusDown {
+		ctx.StatusCode(iris.StatusServiceUnavailable)
+	}
+	ctx.JSON(resp)
+}
+
+func RegisterHealthRoutes(app *iris.Application, handler *HealthHandler) {
+	app.Get("/health", handler.Health)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"internal-transfers/internal/db"
+
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/httptest"
+)
+
+type fakePoolHealth struct {
+	health db.PoolHealth
+}
+
+func (f fakePoolHealth) Snapshot() db.PoolHealth { return f.health }
+
+func TestHealth(t *testing.T) {
+	testCases := []struct {
+		status string
+		code   int
+	}{
+		{db.PoolStatusUp, http.StatusOK},
+		{db.PoolStatusDegraded, http.StatusOK},
+		{db.PoolStatusDown, http.StatusServiceUnavailable},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.status, func(t *testing.T) {
+			app := iris.New()
+			RegisterHealthRoutes(app, NewHealthHandler(fakePoolHealth{db.PoolHealth{Status: tc.status, MaxOpen: 10, InUse: 9, Saturation: 0.9}}))
+			resp := httptest.New(t, app).GET("/health").Expect()
+			resp.Status(tc.code)
+			resp.JSON().Object().ValueEqual("status", tc.status)
+			resp.JSON().Object().Value("database").Object().ValueEqual("saturation", 0.9)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// interestDayFormat is the format of the days in interest responses
+const interestDayFormat = "2006-01-02"
+
+// InterestTierRequest represents a tier of an interest product: the annual
+// Rate, as a fraction, paid on the part of the balance from MinBalance up to
+// the next tier.
+type InterestTierRequest struct {
+	MinBalance string `json:"min_balance" validate:"required"`
+	Rate       string `json:"rate" validate:"required"`
+}
+
+// InterestProductRequest represents the request body for creating an
+// interest product. Method is simple or compound, and DayCount 360 or 365
+// (the default).
+type InterestProductRequest struct {
+	Name     string                `json:"name" validate:"required,max=200"`
+	Method   string                `json:"method" validate:"required,oneof=simple compound"`
+	DayCount int                   `json:"day_count,omitempty" validate:"omitempty,oneof=360 365"`
+	Tiers    []InterestTierRequest `json:"tiers" validate:"required,min=1,max=100,dive"`
+}
+
+// InterestTierResponse represents a tier of an interest product.
+type InterestTierResponse struct {
+	MinBalance string `json:"min_balance"`
+	Rate       string `json:"rate"`
+}
+
+// InterestProductResponse represents an interest product.
+type InterestProductResponse struct {
+	ID        int64                  `json:"id"`
+	Name      string                 `json:"name"`
+	Method    string                 `json:"method"`
+	DayCount  int                    `json:"day_count"`
+	Tiers     []InterestTierResponse `json:"tiers"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// ListInterestProductsResponse represents a list of interest products.
+type ListInterestProductsResponse struct {
+	InterestProducts []InterestProductResponse `json:"interest_products"`
+}
+
+// AccountInterestRequest represents the request body for setting the
+// interest product of an account; a missing or zero ProductID stops accruing.
+type AccountInterestRequest struct {
+	ProductID *int64 `json:"product_id" validate:"omitempty,gte=0"`
+}
+
+// AccountInterestResponse represents the interest state of an account.
+type AccountInterestResponse struct {
+	AccountID      int64     `json:"account_id"`
+	ProductID      int64     `json:"product_id,omitempty"`
+	NextAccrualDay string    `json:"next_accrual_day"`
+	Accrued        string    `json:"accrued"`
+	Residual       string    `json:"residual"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// InterestAccrualResponse represents the interest accrued by an account on one day.
+type InterestAccrualResponse struct {
+	Day       string `json:"day"`
+	ProductID int64  `json:"product_id"`
+	Base      string `json:"base"`
+	Amount    string `json:"amount"`
+	PostingID int64  `json:"posting_id,omitempty"`
+}
+
+// ListInterestAccrualsResponse represents the accruals of an account, most recent first.
+type ListInterestAccrualsResponse struct {
+	Accruals []InterestAccrualResponse `json:"accruals"`
+}
+
+// InterestPostingResponse represents a transfer of accrued interest to an account.
+type InterestPostingResponse struct {
+	ID              int64      `json:"id"`
+	PeriodStart     string     `json:"period_start"`
+	PeriodEnd       string     `json:"period_end"`
+	Accrued         string     `json:"accrued"`
+	CarriedResidual string     `json:"carried_residual"`
+	Amount          string     `json:"amount"`
+	Residual        string     `json:"residual"`
+	Status          string     `json:"status"`
+	ErrorCode       string     `json:"error_code,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// ListInterestPostingsResponse represents the postings of an account, most recent first.
+type ListInterestPostingsResponse struct {
+	Postings []InterestPostingResponse `json:"postings"`
+}
+
+// newInterestProductResponse converts an interest product into its response body
+func newInterestProductResponse(p model.InterestProduct) InterestProductResponse {
+	resp := InterestProductResponse{
+		ID:        p.ID,
+		Name:      p.Name,
+		Method:    string(p.Method),
+		DayCount:  p.DayCount,
+		Tiers:     make([]InterestTierResponse, 0, len(p.Tiers)),
+		CreatedAt: p.CreatedAt,
+	}
+	for _, tier := range p.Tiers {
+		resp.Tiers = append(resp.Tiers, InterestTierResponse{MinBalance: tier.MinBalance.String(), Rate: tier.Rate.String()})
+	}
+	return resp
+}
+
+// newAccountInterestResponse converts the interest state of an account into its response body
+func newAccountInterestResponse(ai model.AccountInterest) AccountInterestResponse {
+	return AccountInterestResponse{
+		AccountID:      ai.AccountID,
+		ProductID:      ai.ProductID,
+		NextAccrualDay: ai.NextAccrualDay.Format(interestDayFormat),
+		Accrued:        ai.Accrued.String(),
+		Residual:       ai.Residual.String(),
+		UpdatedAt:      ai.UpdatedAt,
+	}
+}
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"internal-transfers/internal/model"
+	"internal-transfers/internal/services"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/shopspring/decimal"
+)
+
+// requireInterest responds 501 and returns false when interest is not enabled
+func (h *AccountHandler) requireInterest(ctx iris.Context) bool {
+	if h.interest == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "interest is not enabled"})
+		return false
+	}
+	return true
+}
+
+// interestPathID reads the id path parameter of an interest product or
+// account, responding 400 when it is invalid
+func interestPathID(ctx iris.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid " + name + " id: " + err.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// interestError responds to an error of the interest service
+func interestError(ctx iris.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrAccountIDMustBePositive),
+		errors.Is(err, model.ErrProductIDMustBePositive),
+		errors.Is(err, model.ErrPrecisionTooHigh),
+		errors.Is(err, model.ErrInvalidInterestProduct):
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrAccountNotFound),
+		errors.Is(err, model.ErrInterestProductNotFound),
+		errors.Is(err, model.ErrInterestNotAssigned):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	default:
+		log.Printf("interest error: %v", err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "internal server error"})
+	}
+}
+
+// CreateInterestProduct creates an interest product.
+// Example: POST /interest-products {"name": "savings", "method": "compound", "tiers": [{"min_balance": "0", "rate": "0.01"}, {"min_balance": "10000", "rate": "0.02"}]}
+func (h *AccountHandler) CreateInterestProduct(ctx iris.Context) {
+	if !h.requireInterest(ctx) {
+		return
+	}
+
+	var req InterestProductRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+
+	product := model.InterestProduct{
+		Name:     req.Name,
+		Method:   model.InterestMethod(req.Method),
+		DayCount: req.DayCount,
+		Tiers:    make([]model.InterestTier, 0, len(req.Tiers)),
+	}
+	for i, tier := range req.Tiers {
+		minBalance, err := decimal.NewFromString(tier.MinBalance)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: "invalid min_balance of tier " + strconv.Itoa(i) + ": " + err.Error()})
+			return
+		}
+		rate, err := decimal.NewFromString(tier.Rate)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(ErrorResponse{Error: "invalid rate of tier " + strconv.Itoa(i) + ": " + err.Error()})
+			return
+		}
+		product.Tiers = append(product.Tiers, model.InterestTier{MinBalance: minBalance, Rate: rate})
+	}
+
+	created, err := h.interest.CreateProduct(product)
+	if err != nil {
+		interestError(ctx, err)
+		return
+	}
+	ctx.Header("Location", "/interest-products/"+strconv.FormatInt(created.ID, 10))
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(newInterestProductResponse(created))
+}
+
+// ListInterestProducts lists interest products in id order.
+// Example: GET /interest-products?limit=50
+func (h *AccountHandler) ListInterestProducts(ctx iris.Context) {
+	if !h.requireInterest(ctx) {
+		return
+	}
+	limit, ok := listLimit(ctx, services.MaxInterestPage)
+	if !ok {
+		return
+	}
+
+	products, err := h.interest.ListProducts(limit)
+	if err != nil {
+		interestError(ctx, err)
+		return
+	}
+	resp := ListInterestProductsResponse{InterestProducts: make([]InterestProductResponse, 0, len(products))}
+	for _, p := range products {
+		resp.InterestProducts = append(resp.InterestProducts, newInterestProductResponse(p))
+	}
+	ctx.JSON(resp)
+}
+
+// GetInterestProduct returns an interest product.
+// Example: GET /interest-products/{id}
+func (h *AccountHandler) GetInterestProduct(ctx iris.Context) {
+	if !h.requireInterest(ctx) {
+		return
+	}
+	id, ok := interestPathID(ctx, "interest product")
+	if !ok {
+		return
+	}
+
+	product, err := h.interest.GetProduct(id)
+	if err != nil {
+		interestError(ctx, err)
+		return
+	}
+	ctx.JSON(newInterestProductResponse(product))
+}
+
+// SetAccountInterest sets the interest product accruing on an account from
+// today on, or stops accruing when product_id is 0 or missing.
+// Example: PUT /accounts/{id}/interest {"product_id": 3}
+func (h *AccountHandler) SetAccountInterest(ctx iris.Context) {
+	if !h.requireInterest(ctx) {
+		return
+	}
+	accountID, ok := interestPathID(ctx, "account")
+	if !ok {
+		return
+	}
+
+	var req AccountInterestRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+	var productID int64
+	if req.ProductID != nil {
+		productID = *req.ProductID
+	}
+
+	ai, err := h.interest.SetAccountProduct(accountID, productID)
+	if err != nil {
+		interestError(ctx, err)
+		return
+	}
+	ctx.JSON(newAccountInterestResponse(ai))
+}
+
+// GetAccountInterest returns the interest state of an account.
+// Example: GET /accounts/{id}/interest
+func (h *AccountHandler) GetAccountInterest(ctx iris.Context) {
+	if !h.requireInterest(ctx) {
+		return
+	}
+	accountID, ok := interestPathID(ctx, "account")
+	if !ok {
+		return
+	}
+
+	ai, err := h.interest.GetAccountInterest(accountID)
+	if err != nil {
+		interestError(ctx, err)
+		return
+	}
+	ctx.JSON(newAccountInterestResponse(ai))
+}
+
+// ListInterestAccruals lists the daily interest accruals of an account, most recent first.
+// Example: GET /accounts/{id}/interest/accruals?limit=31
+func (h *AccountHandler) ListInterestAccruals(ctx iris.Context) {
+	if !h.requireInterest(ctx) {
+		return
+	}
+	accountID, ok := interestPathID(ctx, "account")
+	if !ok {
+		return
+	}
+	limit, ok := listLimit(ctx, services.MaxInterestPage)
+	if !ok {
+		return
+	}
+
+	accruals, err := h.interest.ListAccruals(accountID, limit)
+	if err != nil {
+		interestError(ctx, err)
+		return
+	}
+	resp := ListInterestAccrualsResponse{Accruals: make([]InterestAccrualResponse, 0, len(accruals))}
+	for _, a := range accruals {
+		resp.Accruals = append(resp.Accruals, InterestAccrualResponse{
+			Day:       a.Day.Format(interestDayFormat),
+			ProductID: a.ProductID,
+			Base:      a.Base.String(),
+			Amount:    a.Amount.String(),
+			PostingID: a.PostingID,
+		})
+	}
+	ctx.JSON(resp)
+}
+
+// ListInterestPostings lists the interest postings of an account, most recent first.
+// Example: GET /accounts/{id}/interest/postings?limit=12
+func (h *AccountHandler) ListInterestPostings(ctx iris.Context) {
+	if !h.requireInterest(ctx) {
+		return
+	}
+	accountID, ok := interestPathID(ctx, "account")
+	if !ok {
+		return
+	}
+	limit, ok := listLimit(ctx, services.MaxInterestPage)
+	if !ok {
+		return
+	}
+
+	postings, err := h.interest.ListPostings(accountID, limit)
+	if err != nil {
+		interestError(ctx, err)
+		return
+	}
+	resp := ListInterestPostingsResponse{Postings: make([]InterestPostingResponse, 0, len(postings))}
+	for _, p := range postings {
+		resp.Postings = append(resp.Postings, InterestPostingResponse{
+			ID:              p.ID,
+			PeriodStart:     p.PeriodStart.Format(interestDayFormat),
+			PeriodEnd:       p.PeriodEnd.Format(interestDayFormat),
+			Accrued:         p.Accrued.String(),
+			CarriedResidual: p.CarriedResidual.String(),
+			Amount:          p.Amount.String(),
+			Residual:        p.Residual.String(),
+			Status:          string(p.Status),
+			ErrorCode:       p.ErrorCode,
+			CreatedAt:       p.CreatedAt,
+			FinishedAt:      p.FinishedAt,
+		})
+	}
+	ctx.JSON(resp)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/mocks"
+	"internal-transfers/internal/model"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/httptest"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupInterestTestApp(t *testing.T) (*iris.Application, *mocks.MockInterestServicePort) {
+	ctrl := gomock.NewController(t)
+	mockInterest := mocks.NewMockInterestServicePort(ctrl)
+	app := iris.New()
+	RegisterRoutes(app, NewAccountHandler(mocks.NewMockAccountServicePort(ctrl), WithInterestService(mockInterest)))
+	return app, mockInterest
+}
+
+func TestCreateInterestProduct(t *testing.T) {
+	app, mockInterest := setupInterestTestApp(t)
+	tiers := []model.InterestTier{
+		{MinBalance: decimal.RequireFromString("0"), Rate: decimal.RequireFromString("0.01")},
+		{MinBalance: decimal.RequireFromString("10000"), Rate: decimal.RequireFromString("0.02")},
+	}
+	mockInterest.EXPECT().CreateProduct(model.InterestProduct{
+		Name: "savings", Method: model.InterestCompound, Tiers: tiers,
+	}).Return(model.InterestProduct{ID: 3, Name: "savings", Method: model.InterestCompound, DayCount: 365, Tiers: tiers}, nil)
+
+	resp := httptest.New(t, app).POST("/interest-products").WithHeader("Content-Type", "application/json").
+		WithText(`{"name":"savings","method":"compound","tiers":[{"min_balance":"0","rate":"0.01"},{"min_balance":"10000","rate":"0.02"}]}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/interest-products/3")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("id", 3)
+	obj.ValueEqual("day_count", 365)
+	obj.Value("tiers").Array().Length().Equal(2)
+	obj.Value("tiers").Array().Element(1).Object().ValueEqual("rate", "0.02")
+}
+
+func TestCreateInterestProduct_Errors(t *testing.T) {
+	app, mockInterest := setupInterestTestApp(t)
+	e := httptest.New(t, app)
+	create := func(body string, want int) {
+		e.POST("/interest-products").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+	const valid = `{"name":"savings","method":"simple","tiers":[{"min_balance":"0","rate":"0.01"}]}`
+
+	create(`{"name":"savings","method":"continuous","tiers":[{"min_balance":"0","rate":"0.01"}]}`, http.StatusBadRequest)
+	create(`{"name":"savings","method":"simple","day_count":366,"tiers":[{"min_balance":"0","rate":"0.01"}]}`, http.StatusBadRequest)
+	create(`{"name":"savings","method":"simple","tiers":[]}`, http.StatusBadRequest)
+	create(`{"name":"savings","method":"simple","tiers":[{"min_balance":"0","rate":"high"}]}`, http.StatusBadRequest)
+
+	mockInterest.EXPECT().CreateProduct(gomock.Any()).Return(model.InterestProduct{}, model.ErrInvalidInterestProduct)
+	create(valid, http.StatusBadRequest)
+	mockInterest.EXPECT().CreateProduct(gomock.Any()).Return(model.InterestProduct{}, assert.AnError)
+	create(valid, http.StatusInternalServerError)
+
+	// Without an interest service the endpoints are unavailable
+	ctrl := gomock.NewController(t)
+	disabled := setupTestApp(t, mocks.NewMockAccountServicePort(ctrl))
+	httptest.New(t, disabled).POST("/interest-products").WithHeader("Content-Type", "application/json").
+		WithText(valid).Expect().Status(http.StatusNotImplemented)
+	httptest.New(t, disabled).GET("/accounts/42/interest").Expect().Status(http.StatusNotImplemented)
+}
+
+func TestListAndGetInterestProducts(t *testing.T) {
+	app, mockInterest := setupInterestTestApp(t)
+	e := httptest.New(t, app)
+
+	mockInterest.EXPECT().ListProducts(100).Return([]model.InterestProduct{{ID: 3, Name: "savings", Method: model.InterestSimple}}, nil)
+	arr := e.GET("/interest-products").Expect().Status(http.StatusOK).JSON().Object().Value("interest_products").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("method", "simple")
+	arr.Element(0).Object().Value("tiers").Array().Empty()
+
+	mockInterest.EXPECT().GetProduct(int64(3)).Return(model.InterestProduct{ID: 3, Name: "savings"}, nil)
+	e.GET("/interest-products/3").Expect().Status(http.StatusOK).JSON().Object().ValueEqual("name", "savings")
+	mockInterest.EXPECT().GetProduct(int64(4)).Return(model.InterestProduct{}, model.ErrInterestProductNotFound)
+	e.GET("/interest-products/4").Expect().Status(http.StatusNotFound)
+}
+
+func TestSetAndGetAccountInterest(t *testing.T) {
+	app, mockInterest := setupInterestTestApp(t)
+	e := httptest.New(t, app)
+	ai := model.AccountInterest{
+		AccountID: 42, ProductID: 3, NextAccrualDay: time.Date(2026, 1, 29, 0, 0, 0, 0, time.UTC),
+		Accrued: decimal.RequireFromString("0.41095890410958904110"), Residual: decimal.Zero,
+	}
+
+	mockInterest.EXPECT().SetAccountProduct(int64(42), int64(3)).Return(ai, nil)
+	obj := e.PUT("/accounts/42/interest").WithHeader("Content-Type", "application/json").
+		WithText(`{"product_id":3}`).Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("product_id", 3)
+	obj.ValueEqual("next_accrual_day", "2026-01-29")
+
+	mockInterest.EXPECT().SetAccountProduct(int64(42), int64(0)).Return(model.AccountInterest{}, model.ErrInterestNotAssigned)
+	e.PUT("/accounts/42/interest").WithHeader("Content-Type", "application/json").
+		WithText(`{"product_id":null}`).Expect().Status(http.StatusNotFound)
+	e.PUT("/accounts/42/interest").WithHeader("Content-Type", "application/json").
+		WithText(`{"product_id":-1}`).Expect().Status(http.StatusBadRequest)
+
+	mockInterest.EXPECT().GetAccountInterest(int64(42)).Return(ai, nil)
+	e.GET("/accounts/42/interest").Expect().Status(http.StatusOK).JSON().Object().
+		ValueEqual("accrued", "0.4109589041095890411")
+}
+
+func TestListInterestAccrualsAndPostings(t *testing.T) {
+	app, mockInterest := setupInterestTestApp(t)
+	e := httptest.New(t, app)
+	day := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	mockInterest.EXPECT().ListAccruals(int64(42), 31).Return([]model.InterestAccrual{
+		{AccountID: 42, Day: day, ProductID: 3, Base: decimal.NewFromInt(1000), Amount: decimal.RequireFromString("0.136986")},
+	}, nil)
+	arr := e.GET("/accounts/42/interest/accruals").WithQuery("limit", 31).Expect().
+		Status(http.StatusOK).JSON().Object().Value("accruals").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("day", "2026-01-31")
+	arr.Element(0).Object().NotContainsKey("posting_id")
+
+	mockInterest.EXPECT().ListPostings(int64(42), 100).Return([]model.InterestPosting{
+		{ID: 7, AccountID: 42, PeriodStart: day.AddDate(0, 0, -30), PeriodEnd: day, Amount: decimal.RequireFromString("0.41"),
+			Status: model.TransferFailed, ErrorCode: "insufficient_funds"},
+	}, nil)
+	arr = e.GET("/accounts/42/interest/postings").Expect().
+		Status(http.StatusOK).JSON().Object().Value("postings").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("period_start", "2026-01-01")
+	arr.Element(0).Object().ValueEqual("amount", "0.41")
+	arr.Element(0).Object().ValueEqual("error_code", "insufficient_funds")
+
+	mockInterest.EXPECT().ListPostings(int64(43), 100).Return(nil, model.ErrAccountNotFound)
+	e.GET("/accounts/43/interest/postings").Expect().Status(http.StatusNotFound)
+}
@@ -6,7 +6,29 @@ import (
 	"github.com/kataras/iris/v12"
 )
 
-func RegisterRoutes(app *iris.Application, handler *AccountHandler) {
+// DefaultBodyLimit is the maximum accepted request body size in bytes
+const DefaultBodyLimit int64 = 4096
+
+type routeOptions struct {
+	bodyLimit int64
+}
+
+// RouteOption customizes RegisterRoutes
+type RouteOption func(*routeOptions)
+
+// WithBodyLimit sets the maximum accepted request body size in bytes
+func WithBodyLimit(limit int64) RouteOption {
+	return func(o *routeOptions) {
+		o.bodyLimit = limit
+	}
+}
+
+func RegisterRoutes(app *iris.Application, handler *AccountHandler, opts ...RouteOption) {
+	options := routeOptions{bodyLimit: DefaultBodyLimit}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	// Global error handler middleware
 	app.Use(func(ctx iris.Context) {
 		defer func() {
@@ -19,20 +41,65 @@ func RegisterRoutes(app *iris.Application, handler *AccountHandler) {
 		ctx.Next()
 	})
 
-	// Middleware to restrict POST to application/json and limit body size to 4KB
+	// Middleware to restrict POST and PUT to application/json and limit body size
 	jsonAndSizeLimit := func(ctx iris.Context) {
-		if ctx.Method() == iris.MethodPost {
+		if ctx.Method() == iris.MethodPost || ctx.Method() == iris.MethodPut {
 			if ctx.GetHeader("Content-Type") != "application/json" {
 				ctx.StatusCode(iris.StatusUnsupportedMediaType)
 				ctx.JSON(ErrorResponse{Error: "Content-Type must be application/json"})
 				return
 			}
-			ctx.SetMaxRequestBodySize(4096) // 4KB
+			ctx.SetMaxRequestBodySize(options.bodyLimit)
 		}
 		ctx.Next()
 	}
 
 	app.Post("/accounts", jsonAndSizeLimit, handler.CreateAccount)
 	app.Get("/accounts/{id:uint64}", handler.GetAccount)
+	app.Put("/accounts/{id:uint64}/balance-shards", jsonAndSizeLimit, handler.SetBalanceShards)
+	app.Put("/accounts/{id:uint64}/parent", jsonAndSizeLimit, handler.SetAccountParent)
+	app.Put("/accounts/{id:uint64}/child-policy", jsonAndSizeLimit, handler.SetChildPolicy)
+	app.Get("/accounts/{id:uint64}/tree", handler.GetAccountTree)
+	app.Put("/accounts/{id:uint64}/interest", jsonAndSizeLimit, handler.SetAccountInterest)
+	app.Get("/accounts/{id:uint64}/interest", handler.GetAccountInterest)
+	app.Get("/accounts/{id:uint64}/interest/accruals", handler.ListInterestAccruals)
+	app.Get("/accounts/{id:uint64}/interest/postings", handler.ListInterestPostings)
 	app.Post("/transactions", jsonAndSizeLimit, handler.SubmitTransaction)
+	app.Get("/transactions", handler.FindTransactions)
+	app.Post("/transactions/quote", jsonAndSizeLimit, handler.QuoteTransaction)
+	app.Post("/transactions/split", jsonAndSizeLimit, handler.SplitTransaction)
+	app.Post("/transactions/sweep", jsonAndSizeLimit, handler.SweepTransaction)
+	app.Get("/transactions/{id:uint64}", handler.GetTransaction)
+	app.Post("/transactions/{id:uint64}/reverse", jsonAndSizeLimit, handler.ReverseTransaction)
+	app.Get("/scheduled-transfers", handler.ListScheduledTransactions)
+	app.Delete("/scheduled-transfers/{id:uint64}", handler.CancelScheduledTransaction)
+	app.Post("/standing-orders", jsonAndSizeLimit, handler.CreateStandingOrder)
+	app.Get("/standing-orders", handler.ListStandingOrders)
+	app.Get("/standing-orders/{id:uint64}", handler.GetStandingOrder)
+	app.Delete("/standing-orders/{id:uint64}", handler.CancelStandingOrder)
+	app.Get("/standing-orders/{id:uint64}/occurrences", handler.ListStandingOrderOccurrences)
+	app.Post("/balance-rules", jsonAndSizeLimit, handler.CreateBalanceRule)
+	app.Get("/balance-rules", handler.ListBalanceRules)
+	app.Get("/balance-rules/{id:uint64}", handler.GetBalanceRule)
+	app.Put("/balance-rules/{id:uint64}", jsonAndSizeLimit, handler.UpdateBalanceRule)
+	app.Delete("/balance-rules/{id:uint64}", handler.DeleteBalanceRule)
+	app.Get("/balance-rules/{id:uint64}/sweeps", handler.ListBalanceRuleSweeps)
+	app.Post("/interest-products", jsonAndSizeLimit, handler.CreateInterestProduct)
+	app.Get("/interest-products", handler.ListInterestProducts)
+	app.Get("/interest-products/{id:uint64}", handler.GetInterestProduct)
+	app.Post("/fee-schedules", jsonAndSizeLimit, handler.CreateFeeSchedule)
+	app.Get("/fee-schedules", handler.ListFeeSchedules)
+	app.Get("/fee-schedules/{id:uint64}", handler.GetFeeSchedule)
+	app.Delete("/fee-schedules/{id:uint64}", handler.DeleteFeeSchedule)
+	app.Post("/deposits", jsonAndSizeLimit, handler.CreateDeposit)
+	app.Get("/deposits", handler.ListDeposits)
+	app.Get("/deposits/{id:uint64}", handler.GetDeposit)
+	app.Post("/deposits/{id:uint64}/settle", handler.SettleDeposit)
+	app.Post("/deposits/{id:uint64}/fail", handler.FailDeposit)
+	app.Post("/withdrawals", jsonAndSizeLimit, handler.CreateWithdrawal)
+	app.Get("/withdrawals", handler.ListWithdrawals)
+	app.Get("/withdrawals/{id:uint64}", handler.GetWithdrawal)
+	app.Post("/withdrawals/{id:uint64}/settle", handler.SettleWithdrawal)
+	app.Post("/withdrawals/{id:uint64}/fail", handler.FailWithdrawal)
+	app.Get("/calendar/business-days", handler.ListBusinessDays)
 }
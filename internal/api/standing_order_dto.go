@@ -0,0 +1,82 @@
+package api
+
+import (
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// CreateStandingOrderRequest represents the request body for creating a standing order.
+// Schedule is one of "daily", "weekly", "monthly:N", "last-business-day",
+// "every <duration>" or a five-field cron expression. StartAt defaults to now;
+// EndAt and MaxOccurrences optionally end the order. BusinessDayRule defaults to
+// the configured rule.
+type CreateStandingOrderRequest struct {
+	SourceAccountID      int64      `json:"source_account_id" validate:"required,gt=0"`
+	DestinationAccountID int64      `json:"destination_account_id" validate:"required,gt=0,nefield=SourceAccountID"`
+	Amount               string     `json:"amount" validate:"required"`
+	Schedule             string     `json:"schedule" validate:"required"`
+	StartAt              *time.Time `json:"start_at,omitempty"`
+	EndAt                *time.Time `json:"end_at,omitempty"`
+	MaxOccurrences       int        `json:"max_occurrences,omitempty" validate:"gte=0"`
+	BusinessDayRule      string     `json:"business_day_rule,omitempty"`
+}
+
+// StandingOrderResponse represents a standing order and its progress.
+type StandingOrderResponse struct {
+	ID                   int64      `json:"id"`
+	SourceAccountID      int64      `json:"source_account_id"`
+	DestinationAccountID int64      `json:"destination_account_id"`
+	Amount               string     `json:"amount"`
+	Schedule             string     `json:"schedule"`
+	StartAt              time.Time  `json:"start_at"`
+	EndAt                *time.Time `json:"end_at,omitempty"`
+	MaxOccurrences       int        `json:"max_occurrences,omitempty"`
+	Occurrences          int        `json:"occurrences"`
+	BusinessDayRule      string     `json:"business_day_rule"`
+	NextOccurrenceAt     *time.Time `json:"next_occurrence_at,omitempty"`
+	NextRunAt            *time.Time `json:"next_run_at,omitempty"`
+	Status               string     `json:"status"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// ListStandingOrdersResponse represents a list of standing orders.
+type ListStandingOrdersResponse struct {
+	StandingOrders []StandingOrderResponse `json:"standing_orders"`
+}
+
+// OccurrenceResponse represents one run of a standing order.
+type OccurrenceResponse struct {
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	Status       string     `json:"status"`
+	ErrorCode    string     `json:"error_code,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// ListOccurrencesResponse represents the occurrences of a standing order, most recent first.
+type ListOccurrencesResponse struct {
+	Occurrences []OccurrenceResponse `json:"occurrences"`
+}
+
+// newStandingOrderResponse converts a standing order into its response body
+func newStandingOrderResponse(o model.StandingOrder) StandingOrderResponse {
+	return StandingOrderResponse{
+		ID:                   o.ID,
+		SourceAccountID:      o.SourceAccountID,
+		DestinationAccountID: o.DestinationAccountID,
+		Amount:               o.Amount.String(),
+		Schedule:             o.Schedule,
+		StartAt:              o.StartAt,
+		EndAt:                o.EndAt,
+		MaxOccurrences:       o.MaxOccurrences,
+		Occurrences:          o.Occurrences,
+		BusinessDayRule:      o.BusinessDayRule,
+		NextOccurrenceAt:     o.NextOccurrenceAt,
+		NextRunAt:            o.NextRunAt,
+		Status:               string(o.Status),
+		CreatedAt:            o.CreatedAt,
+		UpdatedAt:            o.UpdatedAt,
+	}
+}
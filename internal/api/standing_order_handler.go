@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"internal-transfers/internal/model"
+	"internal-transfers/internal/services"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/shopspring/decimal"
+)
+
+// requireStandingOrders responds 501 and returns false when standing orders are not enabled
+func (h *AccountHandler) requireStandingOrders(ctx iris.Context) bool {
+	if h.standingOrders == nil {
+		ctx.StatusCode(iris.StatusNotImplemented)
+		ctx.JSON(ErrorResponse{Error: "standing orders are not enabled"})
+		return false
+	}
+	return true
+}
+
+// standingOrderID reads the id path parameter, responding 400 when it is invalid
+func standingOrderID(ctx iris.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Params().Get("id"), 10, 64)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid standing order id: " + err.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// standingOrderError responds to an error of the standing order service
+func standingOrderError(ctx iris.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrAccountIDMustBePositive),
+		errors.Is(err, model.ErrSourceAndDestinationMustDiffer),
+		errors.Is(err, model.ErrSystemAccountNotAllowed),
+		errors.Is(err, model.ErrAmountMustBePositive),
+		errors.Is(err, model.ErrPrecisionTooHigh),
+		errors.Is(err, model.ErrInvalidSchedule),
+		errors.Is(err, model.ErrEndBeforeStart),
+		errors.Is(err, model.ErrInvalidMaxOccurrences),
+		errors.Is(err, model.ErrNoOccurrences),
+		errors.Is(err, model.ErrInvalidBusinessDayRule),
+		errors.Is(err, model.ErrStandingOrderIDMustBePositive):
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, model.ErrStandingOrderNotFound):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(ErrorResponse{Error: "standing order not found"})
+	case errors.Is(err, model.ErrStandingOrderNotActive):
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(ErrorResponse{Error: err.Error()})
+	default:
+		log.Printf("standing order error: %v", err)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(ErrorResponse{Error: "internal server error"})
+	}
+}
+
+// CreateStandingOrder creates a transfer repeated on a schedule.
+// Example: POST /standing-orders {"source_account_id": 1, "destination_account_id": 2, "amount": "50", "schedule": "monthly:1"}
+func (h *AccountHandler) CreateStandingOrder(ctx iris.Context) {
+	if !h.requireStandingOrders(ctx) {
+		return
+	}
+
+	var req CreateStandingOrderRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "validation error: " + err.Error()})
+		return
+	}
+
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid amount: " + err.Error()})
+		return
+	}
+
+	order := model.StandingOrder{
+		SourceAccountID:      req.SourceAccountID,
+		DestinationAccountID: req.DestinationAccountID,
+		Amount:               amount,
+		Schedule:             req.Schedule,
+		EndAt:                req.EndAt,
+		MaxOccurrences:       req.MaxOccurrences,
+		BusinessDayRule:      req.BusinessDayRule,
+	}
+	if req.StartAt != nil {
+		order.StartAt = *req.StartAt
+	}
+	created, err := h.standingOrders.CreateStandingOrder(order)
+	if err != nil {
+		standingOrderError(ctx, err)
+		return
+	}
+	ctx.Header("Location", "/standing-orders/"+strconv.FormatInt(created.ID, 10))
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(newStandingOrderResponse(created))
+}
+
+// ListStandingOrders lists standing orders in id order.
+// Example: GET /standing-orders?status=active&limit=50
+func (h *AccountHandler) ListStandingOrders(ctx iris.Context) {
+	if !h.requireStandingOrders(ctx) {
+		return
+	}
+
+	status := model.StandingOrderStatus(ctx.URLParam("status"))
+	if status != "" && !status.Valid() {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(ErrorResponse{Error: "invalid status: " + string(status)})
+		return
+	}
+	limit, ok := listLimit(ctx, services.MaxStandingOrdersPage)
+	if !ok {
+		return
+	}
+
+	orders, err := h.standingOrders.ListStandingOrders(status, limit)
+	if err != nil {
+		standingOrderError(ctx, err)
+		return
+	}
+	resp := ListStandingOrdersResponse{StandingOrders: make([]StandingOrderResponse, 0, len(orders))}
+	for _, order := range orders {
+		resp.StandingOrders = append(resp.StandingOrders, newStandingOrderResponse(order))
+	}
+	ctx.JSON(resp)
+}
+
+// GetStandingOrder returns a standing order and its progress.
+// Example: GET /standing-orders/{id}
+func (h *AccountHandler) GetStandingOrder(ctx iris.Context) {
+	if !h.requireStandingOrders(ctx) {
+		return
+	}
+	id, ok := standingOrderID(ctx)
+	if !ok {
+		return
+	}
+
+	order, err := h.standingOrders.GetStandingOrder(id)
+	if err != nil {
+		standingOrderError(ctx, err)
+		return
+	}
+	ctx.JSON(newStandingOrderResponse(order))
+}
+
+// CancelStandingOrder stops an active standing order.
+// Example: DELETE /standing-orders/{id}
+func (h *AccountHandler) CancelStandingOrder(ctx iris.Context) {
+	if !h.requireStandingOrders(ctx) {
+		return
+	}
+	id, ok := standingOrderID(ctx)
+	if !ok {
+		return
+	}
+
+	order, err := h.standingOrders.CancelStandingOrder(id)
+	if err != nil {
+		standingOrderError(ctx, err)
+		return
+	}
+	ctx.JSON(newStandingOrderResponse(order))
+}
+
+// ListStandingOrderOccurrences lists the occurrences of a standing order, most recent first.
+// Example: GET /standing-orders/{id}/occurrences?limit=12
+func (h *AccountHandler) ListStandingOrderOccurrences(ctx iris.Context) {
+	if !h.requireStandingOrders(ctx) {
+		return
+	}
+	id, ok := standingOrderID(ctx)
+	if !ok {
+		return
+	}
+	limit, ok := listLimit(ctx, services.MaxStandingOrdersPage)
+	if !ok {
+		return
+	}
+
+	occurrences, err := h.standingOrders.ListOccurrences(id, limit)
+	if err != nil {
+		standingOrderError(ctx, err)
+		return
+	}
+	resp := ListOccurrencesResponse{Occurrences: make([]OccurrenceResponse, 0, len(occurrences))}
+	for _, o := range occurrences {
+		resp.Occurrences = append(resp.Occurrences, OccurrenceResponse{
+			ScheduledFor: o.ScheduledFor,
+			Status:       string(o.Status),
+			ErrorCode:    o.ErrorCode,
+			StartedAt:    o.StartedAt,
+			FinishedAt:   o.FinishedAt,
+		})
+	}
+	ctx.JSON(resp)
+}
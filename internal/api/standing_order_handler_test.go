@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/mocks"
+	"internal-transfers/internal/model"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/httptest"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupStandingOrderTestApp(t *testing.T) (*iris.Application, *mocks.MockStandingOrderServicePort) {
+	ctrl := gomock.NewController(t)
+	mockOrders := mocks.NewMockStandingOrderServicePort(ctrl)
+	app := iris.New()
+	RegisterRoutes(app, NewAccountHandler(mocks.NewMockAccountServicePort(ctrl), WithStandingOrderService(mockOrders)))
+	return app, mockOrders
+}
+
+func TestCreateStandingOrder(t *testing.T) {
+	app, mockOrders := setupStandingOrderTestApp(t)
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2030, 12, 31, 0, 0, 0, 0, time.UTC)
+	firstRun := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+	mockOrders.EXPECT().CreateStandingOrder(model.StandingOrder{
+		SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.RequireFromString("50"),
+		Schedule: "monthly:1", StartAt: start, EndAt: &end, MaxOccurrences: 6, BusinessDayRule: "modified-following",
+	}).Return(model.StandingOrder{
+		ID: 3, SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(50),
+		Schedule: "monthly:1", StartAt: start, EndAt: &end, MaxOccurrences: 6, BusinessDayRule: "modified-following",
+		NextOccurrenceAt: &start, NextRunAt: &firstRun, Status: model.StandingOrderActive,
+	}, nil)
+
+	resp := httptest.New(t, app).POST("/standing-orders").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"50","schedule":"monthly:1",` +
+			`"start_at":"2030-01-01T09:00:00Z","end_at":"2030-12-31T00:00:00Z","max_occurrences":6,"business_day_rule":"modified-following"}`).Expect()
+	resp.Status(http.StatusCreated)
+	resp.Header("Location").Equal("/standing-orders/3")
+	obj := resp.JSON().Object()
+	obj.ValueEqual("id", 3)
+	obj.ValueEqual("status", "active")
+	obj.ValueEqual("business_day_rule", "modified-following")
+	obj.ValueEqual("next_occurrence_at", "2030-01-01T09:00:00Z")
+	obj.ValueEqual("next_run_at", "2030-01-02T09:00:00Z")
+	obj.ValueEqual("occurrences", 0)
+}
+
+func TestCreateStandingOrder_Errors(t *testing.T) {
+	app, mockOrders := setupStandingOrderTestApp(t)
+	e := httptest.New(t, app)
+	create := func(body string, want int) {
+		e.POST("/standing-orders").WithHeader("Content-Type", "application/json").WithText(body).Expect().Status(want)
+	}
+
+	create(`{"source_account_id":1,"destination_account_id":2,"amount":"50"}`, http.StatusBadRequest)
+	create(`{"source_account_id":1,"destination_account_id":1,"amount":"50","schedule":"daily"}`, http.StatusBadRequest)
+	create(`{"source_account_id":1,"destination_account_id":2,"amount":"lots","schedule":"daily"}`, http.StatusBadRequest)
+	create(`{"source_account_id":1,"destination_account_id":2,"amount":"50","schedule":"daily","max_occurrences":-1}`, http.StatusBadRequest)
+
+	for _, err := range []error{model.ErrInvalidSchedule, model.ErrEndBeforeStart, model.ErrNoOccurrences, model.ErrPrecisionTooHigh, model.ErrInvalidBusinessDayRule} {
+		mockOrders.EXPECT().CreateStandingOrder(gomock.Any()).Return(model.StandingOrder{}, err)
+		create(`{"source_account_id":1,"destination_account_id":2,"amount":"50","schedule":"daily"}`, http.StatusBadRequest)
+	}
+	mockOrders.EXPECT().CreateStandingOrder(gomock.Any()).Return(model.StandingOrder{}, assert.AnError)
+	create(`{"source_account_id":1,"destination_account_id":2,"amount":"50","schedule":"daily"}`, http.StatusInternalServerError)
+
+	// Without a standing order service the endpoints are unavailable
+	ctrl := gomock.NewController(t)
+	disabled := setupTestApp(t, mocks.NewMockAccountServicePort(ctrl))
+	httptest.New(t, disabled).POST("/standing-orders").WithHeader("Content-Type", "application/json").
+		WithText(`{"source_account_id":1,"destination_account_id":2,"amount":"50","schedule":"daily"}`).Expect().
+		Status(http.StatusNotImplemented)
+}
+
+func TestListStandingOrders(t *testing.T) {
+	app, mockOrders := setupStandingOrderTestApp(t)
+	e := httptest.New(t, app)
+
+	mockOrders.EXPECT().ListStandingOrders(model.StandingOrderStatus(""), 100).Return([]model.StandingOrder{
+		{ID: 4, Amount: decimal.NewFromInt(1), Schedule: "weekly", Status: model.StandingOrderActive},
+	}, nil)
+	arr := e.GET("/standing-orders").Expect().Status(http.StatusOK).JSON().Object().Value("standing_orders").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("schedule", "weekly")
+
+	mockOrders.EXPECT().ListStandingOrders(model.StandingOrderCancelled, 5).Return(nil, nil)
+	e.GET("/standing-orders").WithQuery("status", "cancelled").WithQuery("limit", 5).Expect().
+		Status(http.StatusOK).JSON().Object().Value("standing_orders").Array().Empty()
+
+	e.GET("/standing-orders").WithQuery("status", "paused").Expect().Status(http.StatusBadRequest)
+	e.GET("/standing-orders").WithQuery("limit", 0).Expect().Status(http.StatusBadRequest)
+}
+
+func TestGetAndCancelStandingOrder(t *testing.T) {
+	app, mockOrders := setupStandingOrderTestApp(t)
+	e := httptest.New(t, app)
+
+	mockOrders.EXPECT().GetStandingOrder(int64(4)).Return(model.StandingOrder{ID: 4, Amount: decimal.NewFromInt(1), Status: model.StandingOrderCompleted, Occurrences: 3}, nil)
+	obj := e.GET("/standing-orders/4").Expect().Status(http.StatusOK).JSON().Object()
+	obj.ValueEqual("status", "completed")
+	obj.ValueEqual("occurrences", 3)
+	obj.NotContainsKey("next_run_at")
+
+	mockOrders.EXPECT().GetStandingOrder(int64(5)).Return(model.StandingOrder{}, model.ErrStandingOrderNotFound)
+	e.GET("/standing-orders/5").Expect().Status(http.StatusNotFound)
+
+	mockOrders.EXPECT().CancelStandingOrder(int64(4)).Return(model.StandingOrder{ID: 4, Amount: decimal.NewFromInt(1), Status: model.StandingOrderCancelled}, nil)
+	e.DELETE("/standing-orders/4").Expect().Status(http.StatusOK).JSON().Object().ValueEqual("status", "cancelled")
+
+	mockOrders.EXPECT().CancelStandingOrder(int64(6)).Return(model.StandingOrder{}, model.ErrStandingOrderNotActive)
+	e.DELETE("/standing-orders/6").Expect().Status(http.StatusConflict)
+
+	mockOrders.EXPECT().CancelStandingOrder(int64(0)).Return(model.StandingOrder{}, model.ErrStandingOrderIDMustBePositive)
+	e.DELETE("/standing-orders/0").Expect().Status(http.StatusBadRequest)
+
+	mockOrders.EXPECT().CancelStandingOrder(int64(7)).Return(model.StandingOrder{}, assert.AnError)
+	e.DELETE("/standing-orders/7").Expect().Status(http.StatusInternalServerError)
+}
+
+func TestListStandingOrderOccurrences(t *testing.T) {
+	app, mockOrders := setupStandingOrderTestApp(t)
+	e := httptest.New(t, app)
+	scheduled := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	mockOrders.EXPECT().ListOccurrences(int64(4), 12).Return([]model.StandingOrderOccurrence{
+		{StandingOrderID: 4, ScheduledFor: scheduled, Status: model.TransferFailed, ErrorCode: "insufficient_funds", StartedAt: scheduled},
+	}, nil)
+	arr := e.GET("/standing-orders/4/occurrences").WithQuery("limit", 12).Expect().
+		Status(http.StatusOK).JSON().Object().Value("occurrences").Array()
+	arr.Length().Equal(1)
+	arr.Element(0).Object().ValueEqual("scheduled_for", "2030-01-01T09:00:00Z")
+	arr.Element(0).Object().ValueEqual("error_code", "insufficient_funds")
+
+	mockOrders.EXPECT().ListOccurrences(int64(5), 100).Return(nil, model.ErrStandingOrderNotFound)
+	e.GET("/standing-orders/5/occurrences").Expect().Status(http.StatusNotFound)
+}
@@ -0,0 +1,223 @@
+// Package calendar decides which days are business days and when a transfer
+// due at a given time can run.
+//
+// A Calendar has a time zone, a set of holidays and an optional daily cut-off.
+// Saturdays, Sundays and holidays are not business days; a time falling on one
+// is moved by a Rule:
+//
+//	following            to the next business day
+//	modified-following   to the next business day, unless that is in the next
+//	                     month, in which case to the previous business day
+//	preceding            to the previous business day
+//	none                 not moved; the calendar and the cut-off are ignored
+//
+// Moved times keep their time of day. A time at or after the cut-off of its
+// business day runs at the start of the next business day instead, or at the
+// start of its own day under preceding, and under modified-following when the
+// next business day is in the next month.
+package calendar
+
+import (
+	"fmt"
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// Rule moves a time that does not fall on a business day
+type Rule string
+
+// Business day rules
+const (
+	RuleNone          Rule = "none"
+	Following         Rule = "following"
+	ModifiedFollowing Rule = "modified-following"
+	Preceding         Rule = "preceding"
+)
+
+// ParseRule parses a rule name; errors wrap model.ErrInvalidBusinessDayRule
+func ParseRule(name string) (Rule, error) {
+	switch rule := Rule(name); rule {
+	case RuleNone, Following, ModifiedFollowing, Preceding:
+		return rule, nil
+	}
+	return "", fmt.Errorf("%w: %q", model.ErrInvalidBusinessDayRule, name)
+}
+
+// maxRoll bounds the search for a business day, so that a holiday file
+// covering every weekday cannot loop forever
+const maxRoll = 366
+
+// Options configures a Calendar
+type Options struct {
+	// Location is the time zone of the calendar days and the cut-off; nil is UTC
+	Location *time.Location
+	// Cutoff is the time of day after midnight from which a business day takes
+	// no more transfers; 0 means no cut-off
+	Cutoff time.Duration
+	// Rule is used when a transfer does not name one; empty is Following
+	Rule     Rule
+	Holidays []Holiday
+}
+
+// Calendar is a business day calendar. It is immutable and safe for concurrent use.
+type Calendar struct {
+	loc      *time.Location
+	cutoff   time.Duration
+	rule     Rule
+	holidays map[date]string
+}
+
+// date is a calendar day without a time zone
+type date struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+func dateOf(t time.Time) date {
+	y, m, d := t.Date()
+	return date{y, m, d}
+}
+
+func New(opts Options) *Calendar {
+	c := &Calendar{loc: opts.Location, cutoff: opts.Cutoff, rule: opts.Rule, holidays: make(map[date]string, len(opts.Holidays))}
+	if c.loc == nil {
+		c.loc = time.UTC
+	}
+	if c.rule == "" {
+		c.rule = Following
+	}
+	for _, h := range opts.Holidays {
+		c.holidays[dateOf(h.Date)] = h.Name
+	}
+	return c
+}
+
+// Default returns a calendar in UTC with weekends only and no cut-off
+func Default() *Calendar {
+	return New(Options{})
+}
+
+// Location returns the time zone of the calendar
+func (c *Calendar) Location() *time.Location {
+	return c.loc
+}
+
+// DefaultRule returns the rule used when a transfer does not name one
+func (c *Calendar) DefaultRule() Rule {
+	return c.rule
+}
+
+// ResolveRule parses a rule name; an empty name is the default rule
+func (c *Calendar) ResolveRule(name string) (Rule, error) {
+	if name == "" {
+		return c.rule, nil
+	}
+	return ParseRule(name)
+}
+
+// IsBusinessDay reports whether t falls on a business day in the calendar's time zone
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	t = t.In(c.loc)
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := c.holidays[dateOf(t)]
+	return !holiday
+}
+
+// Holiday returns the name of the holiday t falls on, if any
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	name, ok := c.holidays[dateOf(t.In(c.loc))]
+	return name, ok
+}
+
+// CutoffOn returns the cut-off on the day of t, or false when there is none
+func (c *Calendar) CutoffOn(t time.Time) (time.Time, bool) {
+	if c.cutoff <= 0 {
+		return time.Time{}, false
+	}
+	// time.Date normalizes the nanoseconds as wall clock time, so the cut-off
+	// keeps its time of day on days with a daylight saving change
+	y, m, d := t.In(c.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, int(c.cutoff), c.loc), true
+}
+
+// Adjust returns when a transfer due at t runs under rule: on a business day,
+// before its cut-off. The result is in the location of t.
+func (c *Calendar) Adjust(t time.Time, rule Rule) time.Time {
+	if rule == RuleNone {
+		return t
+	}
+	local := t.In(c.loc)
+	if !c.IsBusinessDay(local) {
+		local = c.roll(local, rule)
+	}
+	if cutoff, ok := c.CutoffOn(local); ok && !local.Before(cutoff) {
+		local = c.afterCutoff(local, rule)
+	}
+	return local.In(t.Location())
+}
+
+// afterCutoff moves t, at or after the cut-off of its business day, in the
+// direction of rule
+func (c *Calendar) afterCutoff(t time.Time, rule Rule) time.Time {
+	if rule == Preceding {
+		return c.startOfDay(t)
+	}
+	next := c.step(t, 1)
+	if rule == ModifiedFollowing && next.Month() != t.Month() {
+		return c.startOfDay(t)
+	}
+	return c.startOfDay(next)
+}
+
+// BusinessDays returns the start of the first n business days on which a
+// transfer submitted at from can still run, in the calendar's time zone
+func (c *Calendar) BusinessDays(from time.Time, n int) []time.Time {
+	days := make([]time.Time, 0, n)
+	day := from.In(c.loc)
+	if !c.IsBusinessDay(day) {
+		day = c.step(day, 1)
+	} else if cutoff, ok := c.CutoffOn(day); ok && !day.Before(cutoff) {
+		day = c.step(day, 1)
+	}
+	for len(days) < n {
+		days = append(days, c.startOfDay(day))
+		day = c.step(day, 1)
+	}
+	return days
+}
+
+// roll moves t, which is not on a business day, by rule
+func (c *Calendar) roll(t time.Time, rule Rule) time.Time {
+	switch rule {
+	case Preceding:
+		return c.step(t, -1)
+	case ModifiedFollowing:
+		if next := c.step(t, 1); next.Month() == t.Month() {
+			return next
+		}
+		return c.step(t, -1)
+	default:
+		return c.step(t, 1)
+	}
+}
+
+// step returns the first business day strictly after t, or before it when
+// dir is -1, at the time of day of t. It returns t when there is none within
+// maxRoll days.
+func (c *Calendar) step(t time.Time, dir int) time.Time {
+	for i := 1; i <= maxRoll; i++ {
+		if day := t.AddDate(0, 0, i*dir); c.IsBusinessDay(day) {
+			return day
+		}
+	}
+	return t
+}
+
+func (c *Calendar) startOfDay(t time.Time) time.Time {
+	y, m, d := t.In(c.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+}
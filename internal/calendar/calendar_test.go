@@ -0,0 +1,135 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var christmas = []Holiday{
+	{Date: time.Date(2026, 12, 25, 0, 0, 0, 0, time.UTC), Name: "Christmas Day"},
+	{Date: time.Date(2026, 12, 28, 0, 0, 0, 0, time.UTC), Name: "Boxing Day (substitute day)"},
+}
+
+func at(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestIsBusinessDay(t *testing.T) {
+	cal := New(Options{Holidays: christmas})
+	assert.True(t, cal.IsBusinessDay(at(time.December, 24, 12, 0)))
+	assert.False(t, cal.IsBusinessDay(at(time.December, 25, 12, 0)), "holiday")
+	assert.False(t, cal.IsBusinessDay(at(time.December, 26, 12, 0)), "saturday")
+	assert.False(t, cal.IsBusinessDay(at(time.December, 27, 12, 0)), "sunday")
+
+	name, ok := cal.Holiday(at(time.December, 28, 0, 0))
+	assert.True(t, ok)
+	assert.Equal(t, "Boxing Day (substitute day)", name)
+
+	// The day is taken in the calendar's time zone
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	assert.False(t, New(Options{Location: tokyo}).IsBusinessDay(at(time.March, 6, 20, 0)), "already saturday in Tokyo")
+}
+
+func TestAdjust_Rules(t *testing.T) {
+	cal := New(Options{Holidays: christmas})
+	testCases := []struct {
+		name string
+		t    time.Time
+		rule Rule
+		want time.Time
+	}{
+		{"BusinessDayIsKept", at(time.March, 3, 9, 30), Following, at(time.March, 3, 9, 30)},
+		{"Following", at(time.February, 28, 9, 30), Following, at(time.March, 2, 9, 30)},
+		{"ModifiedFollowingWithinMonth", at(time.March, 7, 9, 30), ModifiedFollowing, at(time.March, 9, 9, 30)},
+		{"ModifiedFollowingAtMonthEnd", at(time.February, 28, 9, 30), ModifiedFollowing, at(time.February, 27, 9, 30)},
+		{"Preceding", at(time.February, 28, 9, 30), Preceding, at(time.February, 27, 9, 30)},
+		{"FollowingSkipsHolidays", at(time.December, 26, 9, 30), Following, at(time.December, 29, 9, 30)},
+		{"PrecedingSkipsHolidays", at(time.December, 27, 9, 30), Preceding, at(time.December, 24, 9, 30)},
+		{"None", at(time.December, 25, 9, 30), RuleNone, at(time.December, 25, 9, 30)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, cal.Adjust(tc.t, tc.rule))
+		})
+	}
+}
+
+func TestAdjust_Cutoff(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+	cal := New(Options{Location: london, Cutoff: 17 * time.Hour})
+
+	// Before the cut-off the time is kept
+	assert.Equal(t, at(time.March, 6, 16, 59), cal.Adjust(at(time.March, 6, 16, 59), Following))
+	// From the cut-off it runs at the start of the next business day
+	assert.Equal(t, time.Date(2026, 3, 9, 0, 0, 0, 0, london).UTC(), cal.Adjust(at(time.March, 6, 17, 0), Following))
+	// A time moved back onto a business day is still held to its cut-off,
+	// without moving forward again
+	assert.Equal(t, time.Date(2026, 3, 6, 0, 0, 0, 0, london).UTC(), cal.Adjust(at(time.March, 7, 18, 0), Preceding))
+	assert.Equal(t, time.Date(2026, 3, 6, 0, 0, 0, 0, london).UTC(), cal.Adjust(at(time.March, 6, 17, 0), Preceding))
+	// Modified following does not leave the month for the cut-off either
+	assert.Equal(t, time.Date(2026, 10, 30, 0, 0, 0, 0, london).UTC(), cal.Adjust(at(time.October, 31, 18, 0), ModifiedFollowing))
+	assert.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, london).UTC(), cal.Adjust(at(time.October, 16, 18, 0), ModifiedFollowing))
+	// The rule none ignores the cut-off
+	assert.Equal(t, at(time.March, 6, 18, 0), cal.Adjust(at(time.March, 6, 18, 0), RuleNone))
+
+	// The cut-off is local time, also after the change to summer time
+	cutoff, ok := cal.CutoffOn(at(time.March, 30, 12, 0))
+	require.True(t, ok)
+	assert.Equal(t, at(time.March, 30, 16, 0), cutoff.UTC())
+	_, ok = Default().CutoffOn(at(time.March, 30, 12, 0))
+	assert.False(t, ok)
+}
+
+func TestBusinessDays(t *testing.T) {
+	cal := New(Options{Cutoff: 17 * time.Hour, Holidays: christmas})
+
+	days := cal.BusinessDays(at(time.December, 24, 9, 0), 3)
+	assert.Equal(t, []time.Time{at(time.December, 24, 0, 0), at(time.December, 29, 0, 0), at(time.December, 30, 0, 0)}, days)
+
+	// After the cut-off the day is no longer upcoming
+	days = cal.BusinessDays(at(time.December, 24, 17, 0), 1)
+	assert.Equal(t, []time.Time{at(time.December, 29, 0, 0)}, days)
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("modified-following")
+	require.NoError(t, err)
+	assert.Equal(t, ModifiedFollowing, rule)
+
+	_, err = ParseRule("nearest")
+	assert.ErrorIs(t, err, model.ErrInvalidBusinessDayRule)
+	_, err = ParseRule("")
+	assert.ErrorIs(t, err, model.ErrInvalidBusinessDayRule)
+
+	rule, err = New(Options{Rule: Preceding}).ResolveRule("")
+	require.NoError(t, err)
+	assert.Equal(t, Preceding, rule)
+	rule, err = Default().ResolveRule("none")
+	require.NoError(t, err)
+	assert.Equal(t, RuleNone, rule)
+}
+
+func TestParseHolidays(t *testing.T) {
+	holidays, err := ParseHolidays(strings.NewReader(`# United Kingdom
+2026-12-25 Christmas Day
+
+2026-12-28   Boxing Day (substitute day)
+2027-01-01
+`))
+	require.NoError(t, err)
+	assert.Equal(t, append(christmas, Holiday{Date: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}), holidays)
+
+	_, err = ParseHolidays(strings.NewReader("2026-12-25 Christmas Day\n25/12/2026 Christmas Day\n"))
+	assert.ErrorContains(t, err, "line 2")
+
+	_, err = LoadHolidays("testdata/missing.txt")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Holiday is a day without business
+type Holiday struct {
+	// Date is the day of the holiday; its time of day and location are ignored
+	Date time.Time
+	Name string
+}
+
+// LoadHolidays reads a holiday file. Each line holds a date and an optional
+// name; blank lines and lines starting with # are skipped:
+//
+//	# United Kingdom, 2026
+//	2026-12-25 Christmas Day
+//	2026-12-28 Boxing Day (substitute day)
+func LoadHolidays(path string) ([]Holiday, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open holiday file: %w", err)
+	}
+	defer f.Close()
+	holidays, err := ParseHolidays(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return holidays, nil
+}
+
+// ParseHolidays reads holidays in the format of LoadHolidays
+func ParseHolidays(r io.Reader) ([]Holiday, error) {
+	var holidays []Holiday
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		day, name, _ := strings.Cut(text, " ")
+		d, err := time.Parse(time.DateOnly, day)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q, want YYYY-MM-DD", line, day)
+		}
+		holidays = append(holidays, Holiday{Date: d, Name: strings.TrimSpace(name)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read holidays: %w", err)
+	}
+	return holidays, nil
+}
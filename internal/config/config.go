@@ -1,56 +1,404 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
+	"internal-transfers/internal/model"
 )
 
+// Config holds every tunable of the service.
+//
+// Values are merged from (lowest to highest precedence): built-in defaults,
+// an optional YAML/TOML config file, environment variables and command line flags.
+// Struct tags describe where each field can be set:
+//   - yaml/toml: key in the config file
+//   - env: environment variable (NAME_FILE reads the value from a file instead)
+//   - flag: command line flag
+//   - secret: the value is masked when the configuration is printed redacted
 type Config struct {
-	DBUrl      string
-	ServerPort string
-	Env        string
+	Env         string          `yaml:"env" toml:"env" env:"APP_ENV" flag:"env" usage:"application environment"`
+	AutoMigrate bool            `yaml:"auto_migrate" toml:"auto_migrate" env:"AUTO_MIGRATE" flag:"auto-migrate" usage:"apply pending schema migrations on startup"`
+	Server      ServerConfig    `yaml:"server" toml:"server"`
+	Database    DatabaseConfig  `yaml:"database" toml:"database"`
+	Money       MoneyConfig     `yaml:"money" toml:"money"`
+	Transfers   TransfersConfig `yaml:"transfers" toml:"transfers"`
+	Calendar    CalendarConfig  `yaml:"calendar" toml:"calendar"`
+	Interest    InterestConfig  `yaml:"interest" toml:"interest"`
+	Fees        FeesConfig      `yaml:"fees" toml:"fees"`
+	Clearing    ClearingConfig  `yaml:"clearing" toml:"clearing"`
 }
 
-func LoadConfig() (*Config, error) {
-	_ = godotenv.Load()
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port            string        `yaml:"port" toml:"port" env:"SERVER_PORT" flag:"server-port" usage:"HTTP listen port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT" flag:"server-read-timeout" usage:"maximum duration for reading a request"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" flag:"server-write-timeout" usage:"maximum duration for writing a response"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" flag:"server-idle-timeout" usage:"keep-alive idle timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" flag:"server-shutdown-timeout" usage:"graceful shutdown timeout"`
+	BodyLimit       int64         `yaml:"body_limit" toml:"body_limit" env:"SERVER_BODY_LIMIT" flag:"server-body-limit" usage:"maximum request body size in bytes"`
+}
+
+// Storage drivers supported by DatabaseConfig.Driver
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+// DatabaseConfig holds the storage driver and Postgres connection settings
+type DatabaseConfig struct {
+	Driver         string        `yaml:"driver" toml:"driver" env:"DB_DRIVER" flag:"db-driver" usage:"storage driver: postgres, or memory for a non-persistent local store"`
+	Host           string        `yaml:"host" toml:"host" env:"POSTGRES_HOST" flag:"db-host" usage:"Postgres host"`
+	Port           string        `yaml:"port" toml:"port" env:"POSTGRES_PORT" flag:"db-port" usage:"Postgres port"`
+	User           string        `yaml:"user" toml:"user" env:"POSTGRES_USER" flag:"db-user" usage:"Postgres user"`
+	Password       string        `yaml:"password" toml:"password" env:"POSTGRES_PASSWORD" flag:"db-password" secret:"true" usage:"Postgres password"`
+	Name           string        `yaml:"name" toml:"name" env:"POSTGRES_DB" flag:"db-name" usage:"Postgres database name"`
+	SSLMode        string        `yaml:"sslmode" toml:"sslmode" env:"POSTGRES_SSLMODE" flag:"db-sslmode" usage:"Postgres sslmode (disable, allow, prefer, require, verify-ca, verify-full)"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout" env:"POSTGRES_CONNECT_TIMEOUT" flag:"db-connect-timeout" usage:"timeout for establishing a connection"`
+	MaxOpenConns   int           `yaml:"max_open_conns" toml:"max_open_conns" env:"POSTGRES_MAX_OPEN_CONNS" flag:"db-max-open-conns" usage:"maximum pool size"`
+	MinConns       int           `yaml:"min_conns" toml:"min_conns" env:"POSTGRES_MIN_CONNS" flag:"db-min-conns" usage:"connections the pool keeps open even when idle"`
+
+	ConnMaxLifetime   time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"POSTGRES_CONN_MAX_LIFETIME" flag:"db-conn-max-lifetime" usage:"maximum time a connection may be reused (0 = forever)"`
+	ConnMaxIdleTime   time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"POSTGRES_CONN_MAX_IDLE_TIME" flag:"db-conn-max-idle-time" usage:"maximum time a connection may sit idle (0 = forever)"`
+	ConnectAttempts   int           `yaml:"connect_attempts" toml:"connect_attempts" env:"POSTGRES_CONNECT_ATTEMPTS" flag:"db-connect-attempts" usage:"initial connection attempts before giving up"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff" toml:"connect_backoff" env:"POSTGRES_CONNECT_BACKOFF" flag:"db-connect-backoff" usage:"delay before the first connection retry, doubled on each attempt"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff" toml:"connect_max_backoff" env:"POSTGRES_CONNECT_MAX_BACKOFF" flag:"db-connect-max-backoff" usage:"upper bound for the connection retry delay"`
+	HealthInterval    time.Duration `yaml:"health_interval" toml:"health_interval" env:"POSTGRES_HEALTH_INTERVAL" flag:"db-health-interval" usage:"interval between pool health checks"`
+	SaturationWarn    float64       `yaml:"saturation_warn" toml:"saturation_warn" env:"POSTGRES_SATURATION_WARN" flag:"db-saturation-warn" usage:"pool saturation ratio (in use / max open) that is reported as degraded"`
+
+	SingleStatementTransfer bool          `yaml:"single_statement_transfer" toml:"single_statement_transfer" env:"DB_SINGLE_STATEMENT_TRANSFER" flag:"db-single-statement-transfer" usage:"perform transfers with a single round trip statement instead of separate lock and update statements"`
+	ShardCompactionInterval time.Duration `yaml:"shard_compaction_interval" toml:"shard_compaction_interval" env:"DB_SHARD_COMPACTION_INTERVAL" flag:"db-shard-compaction-interval" usage:"interval between folding the balance shards of hot accounts into their balance (0 = never)"`
+}
+
+// MoneyConfig holds the monetary amount settings
+type MoneyConfig struct {
+	Precision int32 `yaml:"precision" toml:"precision" env:"MONEY_PRECISION" flag:"money-precision" usage:"maximum decimal places accepted for amounts"`
+}
+
+// TransfersConfig holds the transfer processing settings
+type TransfersConfig struct {
+	GroupCommit          bool          `yaml:"group_commit" toml:"group_commit" env:"TRANSFER_GROUP_COMMIT" flag:"transfer-group-commit" usage:"queue transfers and commit them in batches, one database transaction per batch"`
+	GroupCommitMaxBatch  int           `yaml:"group_commit_max_batch" toml:"group_commit_max_batch" env:"TRANSFER_GROUP_COMMIT_MAX_BATCH" flag:"transfer-group-commit-max-batch" usage:"maximum transfers committed together"`
+	GroupCommitMaxWait   time.Duration `yaml:"group_commit_max_wait" toml:"group_commit_max_wait" env:"TRANSFER_GROUP_COMMIT_MAX_WAIT" flag:"transfer-group-commit-max-wait" usage:"how long a batch waits for more transfers before committing"`
+	GroupCommitQueueSize int           `yaml:"group_commit_queue_size" toml:"group_commit_queue_size" env:"TRANSFER_GROUP_COMMIT_QUEUE_SIZE" flag:"transfer-group-commit-queue-size" usage:"transfers that can wait for the group commit worker"`
+
+	AsyncWorkers      int           `yaml:"async_workers" toml:"async_workers" env:"TRANSFER_ASYNC_WORKERS" flag:"transfer-async-workers" usage:"workers processing asynchronous transfers on this replica (0 only accepts them)"`
+	AsyncBatchSize    int           `yaml:"async_batch_size" toml:"async_batch_size" env:"TRANSFER_ASYNC_BATCH_SIZE" flag:"transfer-async-batch-size" usage:"asynchronous transfers a worker claims at once"`
+	AsyncPollInterval time.Duration `yaml:"async_poll_interval" toml:"async_poll_interval" env:"TRANSFER_ASYNC_POLL_INTERVAL" flag:"transfer-async-poll-interval" usage:"how often an idle worker looks for pending transfers"`
+	AsyncLease        time.Duration `yaml:"async_lease" toml:"async_lease" env:"TRANSFER_ASYNC_LEASE" flag:"transfer-async-lease" usage:"how long a transfer may stay processing before another worker retries it"`
+
+	ScheduledRetryInterval time.Duration `yaml:"scheduled_retry_interval" toml:"scheduled_retry_interval" env:"TRANSFER_SCHEDULED_RETRY_INTERVAL" flag:"transfer-scheduled-retry-interval" usage:"delay between attempts of a failed scheduled transfer with a retry deadline"`
+
+	MaxMetadataBytes int `yaml:"max_metadata_bytes" toml:"max_metadata_bytes" env:"TRANSFER_MAX_METADATA_BYTES" flag:"transfer-max-metadata-bytes" usage:"largest metadata object accepted with a transfer, in bytes"`
+
+	StandingOrderInterval time.Duration `yaml:"standing_order_interval" toml:"standing_order_interval" env:"TRANSFER_STANDING_ORDER_INTERVAL" flag:"transfer-standing-order-interval" usage:"how often this replica runs due standing order occurrences (0 = never)"`
+
+	BalanceRuleInterval time.Duration `yaml:"balance_rule_interval" toml:"balance_rule_interval" env:"TRANSFER_BALANCE_RULE_INTERVAL" flag:"transfer-balance-rule-interval" usage:"how often this replica runs due scheduled balance rules (0 = never; rules after transfers still run)"`
+}
+
+// CalendarConfig holds the business day calendar of scheduled transfers and standing orders
+type CalendarConfig struct {
+	TimeZone        string `yaml:"time_zone" toml:"time_zone" env:"CALENDAR_TIME_ZONE" flag:"calendar-time-zone" usage:"IANA time zone of business days, cut-offs and schedules"`
+	HolidayFiles    string `yaml:"holiday_files" toml:"holiday_files" env:"CALENDAR_HOLIDAY_FILES" flag:"calendar-holiday-files" usage:"comma separated holiday files, one 'YYYY-MM-DD name' per line"`
+	Cutoff          string `yaml:"cutoff" toml:"cutoff" env:"CALENDAR_CUTOFF" flag:"calendar-cutoff" usage:"time of day (HH:MM) from which transfers run on the next business day (empty = no cut-off)"`
+	BusinessDayRule string `yaml:"business_day_rule" toml:"business_day_rule" env:"CALENDAR_BUSINESS_DAY_RULE" flag:"calendar-business-day-rule" usage:"default rule for transfers due on other days: following, modified-following, preceding or none"`
+}
+
+// InterestConfig holds the interest accrual and posting settings
+type InterestConfig struct {
+	HouseAccountID int64         `yaml:"house_account_id" toml:"house_account_id" env:"INTEREST_HOUSE_ACCOUNT_ID" flag:"interest-house-account-id" usage:"account interest is paid from (defaults to the interest expense system account, 0 = interest disabled)"`
+	Interval       time.Duration `yaml:"interval" toml:"interval" env:"INTEREST_INTERVAL" flag:"interest-interval" usage:"how often this replica accrues ended days and posts ended months (0 = never)"`
+}
+
+// FeesConfig holds the transfer fee settings
+type FeesConfig struct {
+	AccountID int64 `yaml:"account_id" toml:"account_id" env:"FEES_ACCOUNT_ID" flag:"fees-account-id" usage:"account transfer fees are credited to (defaults to the fees system account, 0 = fees disabled)"`
+}
+
+// ClearingConfig holds the clearing accounts of deposits and withdrawals
+type ClearingConfig struct {
+	AccountIDs string `yaml:"account_ids" toml:"account_ids" env:"CLEARING_ACCOUNT_IDS" flag:"clearing-account-ids" usage:"comma separated clearing accounts of deposits and withdrawals, the first being the default (defaults to the clearing system account, 0 = deposits and withdrawals disabled)"`
+}
+
+// maxMoneyPrecision is the scale of the NUMERIC(20, 8) balance column
+const maxMoneyPrecision = 8
+
+var validSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+var validBusinessDayRules = []string{"following", "modified-following", "preceding", "none"}
+
+// Default returns the configuration used when nothing else is specified
+func Default() *Config {
+	return &Config{
+		Env: "development",
+		Server: ServerConfig{
+			Port:            "3000",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+			BodyLimit:       4096,
+		},
+		Database: DatabaseConfig{
+			Driver:         DriverPostgres,
+			SSLMode:        "disable",
+			ConnectTimeout: 5 * time.Second,
+			MaxOpenConns:   25,
+			MinConns:       2,
+
+			ConnMaxLifetime:   30 * time.Minute,
+			ConnMaxIdleTime:   5 * time.Minute,
+			ConnectAttempts:   10,
+			ConnectBackoff:    500 * time.Millisecond,
+			ConnectMaxBackoff: 10 * time.Second,
+			HealthInterval:    15 * time.Second,
+			SaturationWarn:    0.8,
+
+			ShardCompactionInterval: time.Minute,
+		},
+		Money: MoneyConfig{
+			Precision: maxMoneyPrecision,
+		},
+		Transfers: TransfersConfig{
+			GroupCommitMaxBatch:  256,
+			GroupCommitMaxWait:   5 * time.Millisecond,
+			GroupCommitQueueSize: 4096,
+
+			AsyncWorkers:      2,
+			AsyncBatchSize:    32,
+			AsyncPollInterval: 500 * time.Millisecond,
+			AsyncLease:        time.Minute,
+
+			ScheduledRetryInterval: time.Minute,
+
+			MaxMetadataBytes: 1024,
+
+			StandingOrderInterval: 10 * time.Second,
+
+			BalanceRuleInterval: 10 * time.Second,
+		},
+		Calendar: CalendarConfig{
+			TimeZone:        "UTC",
+			BusinessDayRule: "following",
+		},
+		Interest: InterestConfig{
+			HouseAccountID: model.InterestExpenseAccountID,
+			Interval:       time.Hour,
+		},
+		Fees: FeesConfig{
+			AccountID: model.FeesAccountID,
+		},
+		Clearing: ClearingConfig{
+			AccountIDs: strconv.FormatInt(model.ClearingAccountID, 10),
+		},
+	}
+}
+
+// Validate checks the configuration and returns all problems found, joined
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Env == "" {
+		errs = append(errs, errors.New("env must not be empty"))
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server port %q must be a number between 1 and 65535", c.Server.Port))
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		errs = append(errs, errors.New("server timeouts must not be negative"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server shutdown timeout must be positive"))
+	}
+	if c.Server.BodyLimit <= 0 {
+		errs = append(errs, errors.New("server body limit must be positive"))
+	}
 
-	host := os.Getenv("POSTGRES_HOST")
-	if host == "" {
-		panic("POSTGRES_HOST environment variable is required")
+	switch c.Database.Driver {
+	case DriverPostgres:
+		required := []struct{ name, value string }{
+			{"POSTGRES_HOST", c.Database.Host},
+			{"POSTGRES_PORT", c.Database.Port},
+			{"POSTGRES_USER", c.Database.User},
+			{"POSTGRES_PASSWORD", c.Database.Password},
+			{"POSTGRES_DB", c.Database.Name},
+		}
+		for _, r := range required {
+			if r.value == "" {
+				errs = append(errs, fmt.Errorf("%s is required", r.name))
+			}
+		}
+	case DriverMemory:
+	default:
+		errs = append(errs, fmt.Errorf("database driver %q must be %s or %s", c.Database.Driver, DriverPostgres, DriverMemory))
+	}
+	if !slices.Contains(validSSLModes, c.Database.SSLMode) {
+		errs = append(errs, fmt.Errorf("database sslmode %q must be one of %s", c.Database.SSLMode, strings.Join(validSSLModes, ", ")))
+	}
+	if c.Database.ConnectTimeout < 0 {
+		errs = append(errs, errors.New("database connect timeout must not be negative"))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("database max open connections must be at least 1"))
+	} else if c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database min connections must be between 0 and max open connections"))
 	}
-	port := os.Getenv("POSTGRES_PORT")
-	if port == "" {
-		panic("POSTGRES_PORT environment variable is required")
+	if c.Database.ConnMaxLifetime < 0 || c.Database.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("database connection lifetimes must not be negative"))
 	}
-	user := os.Getenv("POSTGRES_USER")
-	if user == "" {
-		panic("POSTGRES_USER environment variable is required")
+	if c.Database.ConnectAttempts < 1 {
+		errs = append(errs, errors.New("database connect attempts must be at least 1"))
 	}
-	password := os.Getenv("POSTGRES_PASSWORD")
-	if password == "" {
-		panic("POSTGRES_PASSWORD environment variable is required")
+	if c.Database.ConnectBackoff < 0 || c.Database.ConnectMaxBackoff < c.Database.ConnectBackoff {
+		errs = append(errs, errors.New("database connect backoff must not be negative or exceed the max backoff"))
 	}
-	dbname := os.Getenv("POSTGRES_DB")
-	if dbname == "" {
-		panic("POSTGRES_DB environment variable is required")
+	if c.Database.HealthInterval <= 0 {
+		errs = append(errs, errors.New("database health interval must be positive"))
+	}
+	if c.Database.SaturationWarn <= 0 || c.Database.SaturationWarn > 1 {
+		errs = append(errs, errors.New("database saturation warning ratio must be in (0, 1]"))
+	}
+	if c.Database.ShardCompactionInterval < 0 {
+		errs = append(errs, errors.New("database shard compaction interval must not be negative"))
 	}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
+	if c.Money.Precision < 0 || c.Money.Precision > maxMoneyPrecision {
+		errs = append(errs, fmt.Errorf("money precision must be between 0 and %d", maxMoneyPrecision))
+	}
 
-	cfg := &Config{
-		DBUrl:      dsn,
-		ServerPort: os.Getenv("SERVER_PORT"),
-		Env:        os.Getenv("APP_ENV"),
+	if c.Transfers.GroupCommitMaxBatch < 1 || c.Transfers.GroupCommitQueueSize < 1 {
+		errs = append(errs, errors.New("transfer group commit batch and queue sizes must be at least 1"))
+	}
+	if c.Transfers.GroupCommitMaxWait <= 0 {
+		errs = append(errs, errors.New("transfer group commit max wait must be positive"))
+	}
+	if c.Transfers.AsyncWorkers < 0 || c.Transfers.AsyncBatchSize < 1 {
+		errs = append(errs, errors.New("async transfer workers must be at least 0 and the batch size at least 1"))
+	}
+	if c.Transfers.AsyncPollInterval <= 0 || c.Transfers.AsyncLease <= 0 {
+		errs = append(errs, errors.New("async transfer poll interval and lease must be positive"))
+	}
+	if c.Transfers.ScheduledRetryInterval <= 0 {
+		errs = append(errs, errors.New("scheduled transfer retry interval must be positive"))
+	}
+	if c.Transfers.MaxMetadataBytes < 1 {
+		errs = append(errs, errors.New("transfer max metadata bytes must be at least 1"))
+	}
+	if c.Transfers.StandingOrderInterval < 0 {
+		errs = append(errs, errors.New("standing order interval must not be negative"))
+	}
+	if c.Transfers.BalanceRuleInterval < 0 {
+		errs = append(errs, errors.New("balance rule interval must not be negative"))
 	}
 
-	if cfg.ServerPort == "" {
-		cfg.ServerPort = "3000" // default
+	if _, err := c.Calendar.Location(); err != nil {
+		errs = append(errs, fmt.Errorf("calendar time zone %q is unknown", c.Calendar.TimeZone))
 	}
-	if cfg.Env == "" {
-		cfg.Env = "development"
+	if _, err := c.Calendar.CutoffOffset(); err != nil {
+		errs = append(errs, fmt.Errorf("calendar cut-off %q must be a time of day HH:MM", c.Calendar.Cutoff))
+	}
+	if !slices.Contains(validBusinessDayRules, c.Calendar.BusinessDayRule) {
+		errs = append(errs, fmt.Errorf("calendar business day rule %q must be one of %s", c.Calendar.BusinessDayRule, strings.Join(validBusinessDayRules, ", ")))
 	}
 
-	return cfg, nil
+	if c.Interest.HouseAccountID < 0 {
+		errs = append(errs, errors.New("interest house account id must not be negative"))
+	}
+	if c.Interest.Interval < 0 {
+		errs = append(errs, errors.New("interest interval must not be negative"))
+	}
+	if c.Fees.AccountID < 0 {
+		errs = append(errs, errors.New("fees account id must not be negative"))
+	}
+	if ids, err := c.Clearing.AccountIDList(); err != nil {
+		errs = append(errs, err)
+	} else if c.Fees.AccountID > 0 && slices.Contains(ids, c.Fees.AccountID) {
+		errs = append(errs, errors.New("clearing accounts must not include the fees account"))
+	}
+	return errors.Join(errs...)
+}
+
+// DSN builds the Postgres connection string
+func (d DatabaseConfig) DSN() string {
+	params := []string{
+		"host=" + quoteDSNValue(d.Host),
+		"port=" + quoteDSNValue(d.Port),
+		"user=" + quoteDSNValue(d.User),
+		"password=" + quoteDSNValue(d.Password),
+		"dbname=" + quoteDSNValue(d.Name),
+		"sslmode=" + quoteDSNValue(d.SSLMode),
+	}
+	if d.ConnectTimeout > 0 {
+		seconds := int(d.ConnectTimeout.Round(time.Second) / time.Second)
+		if seconds == 0 {
+			seconds = 1
+		}
+		params = append(params, "connect_timeout="+strconv.Itoa(seconds))
+	}
+	return strings.Join(params, " ")
+}
+
+// Location loads the time zone of the calendar
+func (c CalendarConfig) Location() (*time.Location, error) {
+	return time.LoadLocation(c.TimeZone)
+}
+
+// CutoffOffset returns the cut-off as the time since midnight; 0 when there is none
+func (c CalendarConfig) CutoffOffset() (time.Duration, error) {
+	if c.Cutoff == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", c.Cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// HolidayFilePaths splits HolidayFiles into paths
+func (c CalendarConfig) HolidayFilePaths() []string {
+	var paths []string
+	for _, path := range strings.Split(c.HolidayFiles, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// AccountIDList parses AccountIDs, which must be distinct positive ids or a
+// single 0 that disables deposits and withdrawals
+func (c ClearingConfig) AccountIDList() ([]int64, error) {
+	if strings.TrimSpace(c.AccountIDs) == "0" {
+		return nil, nil
+	}
+	var ids []int64
+	for _, raw := range strings.Split(c.AccountIDs, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("clearing account id %q must be a positive number", raw)
+		}
+		if slices.Contains(ids, id) {
+			return nil, fmt.Errorf("clearing account id %d is listed twice", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// quoteDSNValue quotes a key/value connection string value when needed
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
 }
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"bytes"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"internal-transfers/internal/model"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -46,15 +51,17 @@ func TestLoadConfig_Success(t *testing.T) {
 	cleanup := setEnvVars(vars)
 	defer cleanup()
 
-	cfg, err := LoadConfig()
+	cfg, err := LoadConfig(nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "localhost", vars["POSTGRES_HOST"])
-	assert.Contains(t, cfg.DBUrl, "host=localhost")
-	assert.Contains(t, cfg.DBUrl, "port=5432")
-	assert.Contains(t, cfg.DBUrl, "user=user")
-	assert.Contains(t, cfg.DBUrl, "password=pass")
-	assert.Contains(t, cfg.DBUrl, "dbname=testdb")
-	assert.Equal(t, "1234", cfg.ServerPort)
+	dsn := cfg.Database.DSN()
+	assert.Contains(t, dsn, "host=localhost")
+	assert.Contains(t, dsn, "port=5432")
+	assert.Contains(t, dsn, "user=user")
+	assert.Contains(t, dsn, "password=pass")
+	assert.Contains(t, dsn, "dbname=testdb")
+	assert.Contains(t, dsn, "sslmode=disable")
+	assert.Equal(t, "1234", cfg.Server.Port)
 	assert.Equal(t, "test", cfg.Env)
 }
 
@@ -71,10 +78,13 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	os.Unsetenv("SERVER_PORT")
 	os.Unsetenv("APP_ENV")
 
-	cfg, err := LoadConfig()
+	cfg, err := LoadConfig(nil)
 	assert.NoError(t, err)
-	assert.Equal(t, "3000", cfg.ServerPort)
+	assert.Equal(t, "3000", cfg.Server.Port)
 	assert.Equal(t, "development", cfg.Env)
+	assert.Equal(t, int64(4096), cfg.Server.BodyLimit)
+	assert.Equal(t, int32(8), cfg.Money.Precision)
+	assert.False(t, cfg.Database.SingleStatementTransfer, "the single statement transfer is opt-in")
 }
 
 func TestLoadConfig_MissingRequiredEnv(t *testing.T) {
@@ -92,14 +102,309 @@ func TestLoadConfig_MissingRequiredEnv(t *testing.T) {
 		defer cleanup()
 		os.Unsetenv(missing)
 
-		func() {
-			defer func() {
-				if r := recover(); r == nil {
-					t.Errorf("expected panic for missing %s", missing)
-				}
-			}()
-			LoadConfig()
-		}()
+		cfg, err := LoadConfig(nil)
+		assert.Nil(t, cfg)
+		assert.ErrorContains(t, err, missing+" is required")
 		cleanup()
 	}
 }
+
+func TestLoadConfig_AutoMigrate(t *testing.T) {
+	vars := map[string]string{
+		"POSTGRES_HOST":     "localhost",
+		"POSTGRES_PORT":     "5432",
+		"POSTGRES_USER":     "user",
+		"POSTGRES_PASSWORD": "pass",
+		"POSTGRES_DB":       "testdb",
+		"AUTO_MIGRATE":      "true",
+	}
+	cleanup := setEnvVars(vars)
+	defer cleanup()
+
+	cfg, err := LoadConfig(nil)
+	assert.NoError(t, err)
+	assert.True(t, cfg.AutoMigrate)
+
+	os.Setenv("AUTO_MIGRATE", "sometimes")
+	_, err = LoadConfig(nil)
+	assert.ErrorContains(t, err, "AUTO_MIGRATE")
+}
+
+func TestLoadConfig_AggregatesErrors(t *testing.T) {
+	cleanup := unsetEnvVars("POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB")
+	defer cleanup()
+	restore := setEnvVars(map[string]string{"SERVER_PORT": "not-a-port", "POSTGRES_SSLMODE": "sometimes"})
+	defer restore()
+
+	_, err := LoadConfig(nil)
+	assert.Error(t, err)
+	for _, want := range []string{"POSTGRES_HOST is required", "POSTGRES_DB is required", "server port", "sslmode"} {
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	content := `
+server:
+  port: "4000"
+  body_limit: 8192
+database:
+  host: filehost
+  port: "5432"
+  user: fileuser
+  password: filepass
+  name: filedb
+  sslmode: require
+money:
+  precision: 2
+`
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+	cleanup := unsetEnvVars("POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB", "SERVER_PORT")
+	defer cleanup()
+	restore := setEnvVars(map[string]string{"POSTGRES_HOST": "envhost", "SERVER_PORT": "5000"})
+	defer restore()
+
+	cfg, err := LoadConfig([]string{"--config", file, "--server-port", "6000"})
+	assert.NoError(t, err)
+	assert.Equal(t, "6000", cfg.Server.Port, "flag overrides env and file")
+	assert.Equal(t, "envhost", cfg.Database.Host, "env overrides file")
+	assert.Equal(t, "fileuser", cfg.Database.User, "file overrides default")
+	assert.Equal(t, "require", cfg.Database.SSLMode)
+	assert.Equal(t, int64(8192), cfg.Server.BodyLimit)
+	assert.Equal(t, int32(2), cfg.Money.Precision)
+	assert.Equal(t, 10*time.Second, cfg.Server.ShutdownTimeout, "untouched values keep defaults")
+}
+
+func TestLoadConfig_TOMLFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.toml")
+	content := `
+[server]
+shutdown_timeout = "30s"
+
+[database]
+host = "tomlhost"
+port = "5432"
+user = "user"
+password = "pass"
+name = "db"
+`
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	cleanup := unsetEnvVars("POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB")
+	defer cleanup()
+
+	cfg, err := LoadConfig([]string{"--config", file})
+	assert.NoError(t, err)
+	assert.Equal(t, "tomlhost", cfg.Database.Host)
+	assert.Equal(t, 30*time.Second, cfg.Server.ShutdownTimeout)
+}
+
+func TestLoadConfig_SecretFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	assert.NoError(t, os.WriteFile(secret, []byte("s3cret\n"), 0o600))
+
+	vars := map[string]string{
+		"POSTGRES_HOST":          "localhost",
+		"POSTGRES_PORT":          "5432",
+		"POSTGRES_USER":          "user",
+		"POSTGRES_DB":            "testdb",
+		"POSTGRES_PASSWORD_FILE": secret,
+	}
+	cleanup := setEnvVars(vars)
+	defer cleanup()
+	restore := unsetEnvVars("POSTGRES_PASSWORD")
+	defer restore()
+
+	cfg, err := LoadConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.Database.Password)
+
+	os.Setenv("POSTGRES_PASSWORD", "other")
+	_, err = LoadConfig(nil)
+	assert.ErrorContains(t, err, "only one of POSTGRES_PASSWORD and POSTGRES_PASSWORD_FILE")
+	os.Unsetenv("POSTGRES_PASSWORD_FILE")
+}
+
+func TestConfig_PrintRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "s3cret"
+
+	var buf bytes.Buffer
+	assert.NoError(t, cfg.Print(&buf, true))
+	assert.NotContains(t, buf.String(), "s3cret")
+	assert.Contains(t, buf.String(), "password: '********'")
+	assert.Contains(t, buf.String(), "shutdown_timeout: 10s")
+	assert.Equal(t, "s3cret", cfg.Database.Password, "redaction must not modify the original")
+
+	buf.Reset()
+	assert.NoError(t, cfg.Print(&buf, false))
+	assert.Contains(t, buf.String(), "s3cret")
+}
+
+func TestDatabaseConfig_DSNQuoting(t *testing.T) {
+	d := DatabaseConfig{Host: "db", Port: "5432", User: "user", Password: "p a'ss", Name: "db", SSLMode: "disable"}
+	assert.Contains(t, d.DSN(), `password='p a\'ss'`)
+}
+
+func TestLoadConfig_MemoryDriver(t *testing.T) {
+	cleanup := unsetEnvVars("POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB")
+	defer cleanup()
+
+	cfg, err := LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err, "postgres settings are not required for the memory driver")
+	assert.Equal(t, DriverMemory, cfg.Database.Driver)
+
+	_, err = LoadConfig([]string{"--db-driver", "sqlite"})
+	assert.ErrorContains(t, err, "database driver")
+}
+
+func TestLoadConfig_GroupCommit(t *testing.T) {
+	cleanup := unsetEnvVars("TRANSFER_GROUP_COMMIT", "TRANSFER_GROUP_COMMIT_MAX_BATCH", "TRANSFER_GROUP_COMMIT_MAX_WAIT")
+	defer cleanup()
+
+	cfg, err := LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.False(t, cfg.Transfers.GroupCommit)
+	assert.Equal(t, 256, cfg.Transfers.GroupCommitMaxBatch)
+	assert.Equal(t, 5*time.Millisecond, cfg.Transfers.GroupCommitMaxWait)
+
+	cfg, err = LoadConfig([]string{"--db-driver", "memory", "--transfer-group-commit", "--transfer-group-commit-max-wait", "2ms"})
+	assert.NoError(t, err)
+	assert.True(t, cfg.Transfers.GroupCommit)
+	assert.Equal(t, 2*time.Millisecond, cfg.Transfers.GroupCommitMaxWait)
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--transfer-group-commit-max-batch", "0"})
+	assert.ErrorContains(t, err, "group commit")
+}
+
+func TestLoadConfig_AsyncTransfers(t *testing.T) {
+	cfg, err := LoadConfig([]string{"--db-driver", "memory", "--transfer-async-workers", "0"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cfg.Transfers.AsyncWorkers)
+	assert.Equal(t, 32, cfg.Transfers.AsyncBatchSize)
+	assert.Equal(t, time.Minute, cfg.Transfers.AsyncLease)
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--transfer-async-lease", "0s"})
+	assert.ErrorContains(t, err, "async transfer")
+}
+
+func TestLoadConfig_MaxMetadataBytes(t *testing.T) {
+	cfg, err := LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1024, cfg.Transfers.MaxMetadataBytes)
+
+	t.Setenv("TRANSFER_MAX_METADATA_BYTES", "2048")
+	cfg, err = LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2048, cfg.Transfers.MaxMetadataBytes)
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--transfer-max-metadata-bytes", "0"})
+	assert.ErrorContains(t, err, "metadata")
+}
+
+func TestLoadConfig_StandingOrderInterval(t *testing.T) {
+	t.Setenv("TRANSFER_STANDING_ORDER_INTERVAL", "1m")
+	cfg, err := LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.Transfers.StandingOrderInterval)
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--transfer-standing-order-interval", "-1s"})
+	assert.ErrorContains(t, err, "standing order interval")
+}
+
+func TestLoadConfig_BalanceRuleInterval(t *testing.T) {
+	cfg, err := LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, cfg.Transfers.BalanceRuleInterval)
+
+	t.Setenv("TRANSFER_BALANCE_RULE_INTERVAL", "0s")
+	cfg, err = LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.Transfers.BalanceRuleInterval)
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--transfer-balance-rule-interval", "-1s"})
+	assert.ErrorContains(t, err, "balance rule interval")
+}
+
+func TestLoadConfig_Interest(t *testing.T) {
+	cfg, err := LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.InterestExpenseAccountID, cfg.Interest.HouseAccountID)
+	assert.Equal(t, time.Hour, cfg.Interest.Interval)
+
+	t.Setenv("INTEREST_HOUSE_ACCOUNT_ID", "900")
+	cfg, err = LoadConfig([]string{"--db-driver", "memory", "--interest-interval", "15m"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(900), cfg.Interest.HouseAccountID)
+	assert.Equal(t, 15*time.Minute, cfg.Interest.Interval)
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--interest-house-account-id", "-1", "--interest-interval", "-1s"})
+	assert.ErrorContains(t, err, "interest house account id")
+	assert.ErrorContains(t, err, "interest interval")
+}
+
+func TestLoadConfig_Fees(t *testing.T) {
+	cfg, err := LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.FeesAccountID, cfg.Fees.AccountID)
+
+	t.Setenv("FEES_ACCOUNT_ID", "800")
+	cfg, err = LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(800), cfg.Fees.AccountID)
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--fees-account-id", "-1"})
+	assert.ErrorContains(t, err, "fees account id")
+}
+
+func TestLoadConfig_Clearing(t *testing.T) {
+	cfg, err := LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	ids, err := cfg.Clearing.AccountIDList()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{model.ClearingAccountID}, ids)
+
+	cfg, err = LoadConfig([]string{"--db-driver", "memory", "--clearing-account-ids", "0"})
+	assert.NoError(t, err)
+	ids, err = cfg.Clearing.AccountIDList()
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	t.Setenv("CLEARING_ACCOUNT_IDS", "900, 901")
+	cfg, err = LoadConfig([]string{"--db-driver", "memory"})
+	assert.NoError(t, err)
+	ids, err = cfg.Clearing.AccountIDList()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{900, 901}, ids)
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--clearing-account-ids", "900,-1"})
+	assert.ErrorContains(t, err, `clearing account id "-1"`)
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--clearing-account-ids", "900,900"})
+	assert.ErrorContains(t, err, "listed twice")
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--clearing-account-ids", "900", "--fees-account-id", "900"})
+	assert.ErrorContains(t, err, "fees account")
+}
+
+func TestLoadConfig_Calendar(t *testing.T) {
+	t.Setenv("CALENDAR_TIME_ZONE", "Europe/London")
+	t.Setenv("CALENDAR_HOLIDAY_FILES", "uk.txt, target2.txt")
+	cfg, err := LoadConfig([]string{"--db-driver", "memory", "--calendar-cutoff", "17:30", "--calendar-business-day-rule", "preceding"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"uk.txt", "target2.txt"}, cfg.Calendar.HolidayFilePaths())
+	assert.Equal(t, "preceding", cfg.Calendar.BusinessDayRule)
+	cutoff, err := cfg.Calendar.CutoffOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, 17*time.Hour+30*time.Minute, cutoff)
+	loc, err := cfg.Calendar.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, "Europe/London", loc.String())
+
+	_, err = LoadConfig([]string{"--db-driver", "memory", "--calendar-time-zone", "Mars/Olympus_Mons", "--calendar-cutoff", "5pm", "--calendar-business-day-rule", "nearest"})
+	assert.ErrorContains(t, err, "calendar time zone")
+	assert.ErrorContains(t, err, "calendar cut-off")
+	assert.ErrorContains(t, err, "calendar business day rule")
+}
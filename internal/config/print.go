@@ -0,0 +1,35 @@
+package config
+
+import (
+	"io"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redactedValue = "********"
+
+// Redacted returns a copy of the configuration with secret values masked
+func (c *Config) Redacted() *Config {
+	clone := *c
+	for _, f := range collectFields(reflect.ValueOf(&clone).Elem()) {
+		if f.secret && f.value.Kind() == reflect.String && f.value.String() != "" {
+			f.value.SetString(redactedValue)
+		}
+	}
+	return &clone
+}
+
+// Print writes the configuration as YAML, masking secrets when redacted is set
+func (c *Config) Print(w io.Writer, redacted bool) error {
+	out := c
+	if redacted {
+		out = c.Redacted()
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// ErrHierarchyAccount is returned by FundsTransferrer when an account has a
+// parent or limits its descendants, so the transfer has to take the
+// transactional path where the limits are checked
+var ErrHierarchyAccount = errors.New("account belongs to a hierarchy")
+
+// AccountHierarchyPort is implemented by repositories that can arrange
+// accounts in trees.
+//
+// An account with the within_parent_balance policy keeps its descendants
+// together at or below its own balance. Every change that could break such a
+// limit checks it with CheckBalanceLimits in the same transaction.
+type AccountHierarchyPort interface {
+	// CreateChildAccount creates an account under parentID. It returns
+	// ErrParentAccountNotFound when the parent does not exist.
+	CreateChildAccount(accountID, parentID int64, initialBalance decimal.Decimal) error
+	// SetAccountParent moves an account under parentID, or makes it a root when
+	// parentID is 0. It returns ErrAccountHierarchyCycle when the parent is the
+	// account itself or one of its descendants.
+	SetAccountParent(accountID, parentID int64) error
+	// SetChildBalancePolicy changes the policy an account applies to its descendants
+	SetChildBalancePolicy(accountID int64, policy model.ChildBalancePolicy) error
+	// GetAccountTree returns an account and its descendants, parents before
+	// their children, without the children and totals filled in
+	GetAccountTree(accountID int64) ([]model.AccountNode, error)
+	// CheckBalanceLimits locks the accounts among the given ones and their
+	// ancestors that limit their descendants, and returns
+	// ErrChildBalanceLimitExceeded when one of them holds less than its
+	// descendants as seen by tx
+	CheckBalanceLimits(tx TransactionPort, accountIDs ...int64) error
+}
+
+// accountHierarchyLockKey is the Postgres advisory lock key held while an
+// account moves, so that two concurrent moves cannot create a cycle together
+const accountHierarchyLockKey int64 = 0x6974_6869_6572 // "ithier"
+
+// Domain errors for constraint violations of the hierarchy statements
+var createChildAccountErrors = errorMapping{
+	sqlStateUniqueViolation:     model.ErrAccountIDAlreadyExists,
+	sqlStateCheckViolation:      model.ErrBalanceMustBeNonNegative,
+	sqlStateForeignKeyViolation: model.ErrParentAccountNotFound,
+}
+
+const (
+	// ancestorOfSQL reports whether $1 is $2 or one of its ancestors, and
+	// whether $2 exists
+	ancestorOfSQL = `WITH RECURSIVE ancestors AS (
+    SELECT account_id, parent_account_id FROM accounts WHERE account_id = $2::bigint
+    UNION ALL
+    SELECT a.account_id, a.parent_account_id
+    FROM accounts a JOIN ancestors c ON a.account_id = c.parent_account_id
+)
+SELECT EXISTS (SELECT 1 FROM ancestors WHERE account_id = $1::bigint), EXISTS (SELECT 1 FROM ancestors)`
+
+	// accountTreeSQL returns an account and its descendants breadth first, with
+	// the exact balance of each
+	accountTreeSQL = `WITH RECURSIVE tree AS (
+    SELECT account_id, 0 AS depth FROM accounts WHERE account_id = $1::bigint
+    UNION ALL
+    SELECT a.account_id, t.depth + 1
+    FROM accounts a JOIN tree t ON a.parent_account_id = t.account_id
+)
+SELECT a.account_id, COALESCE(a.parent_account_id, 0), a.child_policy,
+    a.balance + COALESCE((SELECT SUM(s.balance) FROM account_balance_shards s WHERE s.account_id = a.account_id), 0)
+FROM tree t JOIN accounts a ON a.account_id = t.account_id
+ORDER BY t.depth, a.account_id`
+
+	// lockLimitingAccountsSQL locks, in id order, the accounts among $1 and
+	// their ancestors that limit their descendants
+	lockLimitingAccountsSQL = `WITH RECURSIVE ancestors AS (
+    SELECT account_id, parent_account_id, child_policy FROM accounts WHERE account_id = ANY($1::bigint[])
+    UNION
+    SELECT a.account_id, a.parent_account_id, a.child_policy
+    FROM accounts a JOIN ancestors c ON a.account_id = c.parent_account_id
+)
+SELECT account_id FROM accounts
+WHERE account_id IN (SELECT account_id FROM ancestors WHERE child_policy = 'within_parent_balance')
+ORDER BY account_id
+FOR UPDATE`
+
+	// exceededLimitSQL returns an account among $1 whose descendants together
+	// hold more than its own balance
+	exceededLimitSQL = `WITH RECURSIVE descendants AS (
+    SELECT l.id AS limiting_id, a.account_id
+    FROM unnest($1::bigint[]) AS l(id) JOIN accounts a ON a.parent_account_id = l.id
+    UNION ALL
+    SELECT d.limiting_id, a.account_id
+    FROM descendants d JOIN accounts a ON a.parent_account_id = d.account_id
+), balances AS (
+    SELECT a.account_id,
+        a.balance + COALESCE((SELECT SUM(s.balance) FROM account_balance_shards s WHERE s.account_id = a.account_id), 0) AS balance
+    FROM accounts a
+    WHERE a.account_id = ANY($1::bigint[]) OR a.account_id IN (SELECT account_id FROM descendants)
+)
+SELECT l.id
+FROM unnest($1::bigint[]) AS l(id) JOIN balances own ON own.account_id = l.id
+WHERE own.balance < (
+    SELECT COALESCE(SUM(b.balance), 0)
+    FROM descendants d JOIN balances b ON b.account_id = d.account_id
+    WHERE d.limiting_id = l.id
+)
+ORDER BY l.id
+LIMIT 1`
+)
+
+// CreateChildAccount inserts the account with its parent and checks the limits
+// of its new ancestors
+func (repo *AccountRepository) CreateChildAccount(accountID, parentID int64, initialBalance decimal.Decimal) error {
+	ctx := context.Background()
+	err := pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO accounts (account_id, balance, parent_account_id) VALUES ($1, $2, $3)`, accountID, initialBalance, parentID)
+		if err != nil {
+			return translateError(err, createChildAccountErrors)
+		}
+		return checkBalanceLimits(ctx, tx, []int64{accountID})
+	})
+	if err != nil && model.ErrorCode(err) == "" && !errors.Is(err, model.ErrAccountIDAlreadyExists) && !errors.Is(err, model.ErrParentAccountNotFound) {
+		log.Printf("CreateChildAccount DB error: %v", err)
+	}
+	return err
+}
+
+// SetAccountParent moves the account under the advisory hierarchy lock, so
+// the cycle check sees every committed and no concurrent move
+func (repo *AccountRepository) SetAccountParent(accountID, parentID int64) error {
+	ctx := context.Background()
+	return pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, accountHierarchyLockKey); err != nil {
+			return translateError(err, nil)
+		}
+		if parentID != 0 {
+			var cycle, exists bool
+			if err := tx.QueryRow(ctx, ancestorOfSQL, accountID, parentID).Scan(&cycle, &exists); err != nil {
+				return translateError(err, nil)
+			}
+			if !exists {
+				return model.ErrParentAccountNotFound
+			}
+			if cycle {
+				return model.ErrAccountHierarchyCycle
+			}
+		}
+		tag, err := tx.Exec(ctx, `UPDATE accounts SET parent_account_id = NULLIF($2, 0) WHERE account_id = $1`, accountID, parentID)
+		if err != nil {
+			return translateError(err, nil)
+		}
+		if tag.RowsAffected() == 0 {
+			return model.ErrAccountNotFound
+		}
+		return checkBalanceLimits(ctx, tx, []int64{accountID})
+	})
+}
+
+// SetChildBalancePolicy changes the policy and checks it holds right away
+func (repo *AccountRepository) SetChildBalancePolicy(accountID int64, policy model.ChildBalancePolicy) error {
+	ctx := context.Background()
+	return pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE accounts SET child_policy = $2 WHERE account_id = $1`, accountID, string(policy))
+		if err != nil {
+			return translateError(err, nil)
+		}
+		if tag.RowsAffected() == 0 {
+			return model.ErrAccountNotFound
+		}
+		return checkBalanceLimits(ctx, tx, []int64{accountID})
+	})
+}
+
+// GetAccountTree returns the account and its descendants
+func (repo *AccountRepository) GetAccountTree(accountID int64) ([]model.AccountNode, error) {
+	rows, err := repo.pool.Query(context.Background(), accountTreeSQL, accountID)
+	if err != nil {
+		log.Printf("GetAccountTree DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	nodes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.AccountNode, error) {
+		var node model.AccountNode
+		var policy string
+		err := row.Scan(&node.AccountID, &node.ParentAccountID, &policy, &node.Balance)
+		node.ChildPolicy = model.ChildBalancePolicy(policy)
+		return node, err
+	})
+	if err != nil {
+		log.Printf("GetAccountTree DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	if len(nodes) == 0 {
+		return nil, model.ErrAccountNotFound
+	}
+	return nodes, nil
+}
+
+// CheckBalanceLimits checks the limits of the accounts and their ancestors within tx
+func (repo *AccountRepository) CheckBalanceLimits(tx TransactionPort, accountIDs ...int64) error {
+	dbTx, ok := tx.(*Transaction)
+	if !ok {
+		return fmt.Errorf("invalid transaction type")
+	}
+	return checkBalanceLimits(context.Background(), dbTx.tx, accountIDs)
+}
+
+// checkBalanceLimits locks the limiting accounts in one statement and checks
+// them in the next, whose snapshot sees every transaction that held the locks
+func checkBalanceLimits(ctx context.Context, tx pgx.Tx, accountIDs []int64) error {
+	rows, err := tx.Query(ctx, lockLimitingAccountsSQL, accountIDs)
+	if err != nil {
+		log.Printf("CheckBalanceLimits DB error: %v", err)
+		return translateError(err, nil)
+	}
+	limiting, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		log.Printf("CheckBalanceLimits DB error: %v", err)
+		return translateError(err, nil)
+	}
+	if len(limiting) == 0 {
+		return nil
+	}
+
+	var exceeded int64
+	err = tx.QueryRow(ctx, exceededLimitSQL, limiting).Scan(&exceeded)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("CheckBalanceLimits DB error: %v", err)
+		return translateError(err, nil)
+	}
+	return fmt.Errorf("%w (account %d)", model.ErrChildBalanceLimitExceeded, exceeded)
+}
@@ -1,13 +1,16 @@
 package db
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
 
 	"internal-transfers/internal/model"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/shopspring/decimal"
 )
 
@@ -21,17 +24,167 @@ type AccountRepositoryPort interface {
 	UpdateAccountBalance(tx TransactionPort, accountID int64, delta decimal.Decimal) error
 }
 
+// BalanceUpdate is a balance change of a single account
+type BalanceUpdate struct {
+	AccountID int64
+	Delta     decimal.Decimal
+}
+
+// BalanceBatchUpdater is implemented by repositories that can apply several
+// balance updates at once. The updates are applied in order and stop at the
+// first error, which is reported like UpdateAccountBalance reports it.
+type BalanceBatchUpdater interface {
+	UpdateAccountBalances(tx TransactionPort, updates []BalanceUpdate) error
+}
+
+// FundsTransferrer is implemented by repositories that can move funds between
+// two accounts in a single atomic operation. It reports the same domain errors
+// as the step by step transfer: ErrSourceAccountNotFound, ErrInsufficientFunds
+// and ErrDestinationAccountNotFound, checked in that order. It returns
+// ErrShardedAccount without changing anything when either account is sharded,
+// ErrHierarchyAccount when either has a parent or limits its descendants, and
+// ErrDebitNormalAccount when the source is debit-normal.
+type FundsTransferrer interface {
+	TransferFunds(sourceID, destID int64, amount decimal.Decimal) error
+}
+
+// Domain errors for constraint violations of the account statements
+var (
+	createAccountErrors = errorMapping{
+		sqlStateUniqueViolation: model.ErrAccountIDAlreadyExists,
+		sqlStateCheckViolation:  model.ErrBalanceMustBeNonNegative,
+	}
+	updateBalanceErrors = errorMapping{
+		sqlStateCheckViolation: model.ErrInsufficientFunds,
+	}
+)
+
+const (
+	// selectBalanceSQL returns the exact balance, including the shard rows of a
+	// sharded account, as of one snapshot
+	selectBalanceSQL = `SELECT a.balance + COALESCE((
+    SELECT SUM(s.balance) FROM account_balance_shards s WHERE s.account_id = a.account_id
+), 0)
+FROM accounts a
+WHERE a.account_id = $1::bigint`
+
+	// selectBalanceForUpdateSQL locks the account row and then its shard rows, so
+	// the total cannot change until the transaction ends
+	selectBalanceForUpdateSQL = `WITH account AS (
+    SELECT balance FROM accounts WHERE account_id = $1::bigint FOR UPDATE
+), shards AS (
+    SELECT balance FROM account_balance_shards
+    WHERE account_id = $1::bigint AND EXISTS (SELECT 1 FROM account)
+    ORDER BY shard
+    FOR UPDATE
+)
+SELECT a.balance + COALESCE((SELECT SUM(balance) FROM shards), 0) FROM account a`
+
+	// lockForCreditSQL takes the weakest row lock, which does not conflict with
+	// other credits; debits and compaction take FOR UPDATE and wait for it
+	lockForCreditSQL = `SELECT 1 FROM accounts WHERE account_id = $1::bigint FOR KEY SHARE`
+
+	// updateBalanceSQL applies a balance change.
+	//   - A credit to a sharded account goes to the shard row picked by $3.
+	//   - Any other change goes to the account row. A debit first folds every
+	//     shard into the account row, so the balance check sees the whole balance.
+	// The account row is always locked before the shard rows.
+	updateBalanceSQL = `WITH account AS (
+    SELECT balance_shards FROM accounts WHERE account_id = $2::bigint
+), credited AS (
+    UPDATE account_balance_shards
+    SET balance = balance + $1::numeric
+    WHERE account_id = $2::bigint
+      AND $1::numeric > 0
+      AND shard = mod($3::int, NULLIF((SELECT balance_shards FROM account), 0))
+    RETURNING shard
+), locked AS (
+    SELECT 1 FROM accounts WHERE account_id = $2::bigint AND $1::numeric < 0 FOR UPDATE
+), folded AS (
+    UPDATE account_balance_shards s
+    SET balance = 0
+    FROM (
+        SELECT shard, balance FROM account_balance_shards
+        WHERE account_id = $2::bigint AND EXISTS (SELECT 1 FROM locked)
+        ORDER BY shard
+        FOR UPDATE
+    ) old
+    WHERE s.account_id = $2::bigint AND s.shard = old.shard
+    RETURNING old.balance
+), updated AS (
+    UPDATE accounts
+    SET balance = balance + $1::numeric + (SELECT COALESCE(SUM(balance), 0) FROM folded)
+    WHERE account_id = $2::bigint AND NOT EXISTS (SELECT 1 FROM credited)
+    RETURNING account_id
+)
+SELECT (SELECT count(*) FROM credited) + (SELECT count(*) FROM updated)`
+
+	// transferFundsSQL locks both rows in id order, checks the source balance
+	// covers the amount and applies the debit and credit only when every check
+	// passed. It returns the outcome of each check so the caller can report the
+	// failed condition.
+	// Sharded accounts, accounts under or limiting others in a hierarchy and
+	// debit-normal sources are left alone: their credits and debits need more
+	// than one row, a limit check or a decision on the source, which is what
+	// the transactional path is for.
+	transferFundsSQL = `WITH plain AS (
+    SELECT
+        NOT EXISTS (
+            SELECT 1 FROM accounts WHERE account_id IN ($1::bigint, $2::bigint) AND balance_shards > 0
+        ) AS unsharded,
+        NOT EXISTS (
+            SELECT 1 FROM accounts WHERE account_id IN ($1::bigint, $2::bigint)
+              AND (parent_account_id IS NOT NULL OR child_policy <> 'none')
+        ) AS flat
+), locked AS (
+    SELECT account_id, balance, balance_shards, parent_account_id IS NOT NULL OR child_policy <> 'none' AS in_hierarchy,
+        account_type IN ('asset', 'expense') AS debit_normal
+    FROM accounts
+    WHERE account_id IN ($1::bigint, $2::bigint) AND (SELECT unsharded AND flat FROM plain)
+    ORDER BY account_id
+    FOR UPDATE
+), checked AS (
+    SELECT
+        (SELECT balance FROM locked WHERE account_id = $1::bigint) AS source_balance,
+        (SELECT balance >= $3::numeric FROM locked WHERE account_id = $1::bigint) AS covered,
+        COALESCE((SELECT debit_normal FROM locked WHERE account_id = $1::bigint), false) AS source_debit_normal,
+        EXISTS (SELECT 1 FROM locked WHERE account_id = $2::bigint) AS dest_exists,
+        NOT (SELECT unsharded FROM plain) OR EXISTS (SELECT 1 FROM locked WHERE balance_shards > 0) AS sharded,
+        NOT (SELECT flat FROM plain) OR EXISTS (SELECT 1 FROM locked WHERE in_hierarchy) AS in_hierarchy
+), updated AS (
+    UPDATE accounts a
+    SET balance = a.balance + CASE WHEN a.account_id = $1::bigint THEN -$3::numeric ELSE $3::numeric END
+    FROM checked c
+    WHERE a.account_id IN ($1::bigint, $2::bigint)
+      AND NOT c.sharded
+      AND NOT c.in_hierarchy
+      AND NOT c.source_debit_normal
+      AND c.covered
+      AND c.dest_exists
+    RETURNING a.account_id
+)
+SELECT
+    c.sharded,
+    c.in_hierarchy,
+    c.source_debit_normal,
+    c.source_balance IS NOT NULL,
+    COALESCE(c.covered, false),
+    c.dest_exists,
+    (SELECT count(*) FROM updated)
+FROM checked c`
+)
+
 type AccountRepository struct {
-	conn *sql.DB
+	pool *pgxpool.Pool
 }
 
-func NewAccountRepository(db *sql.DB) *AccountRepository {
-	return &AccountRepository{conn: db}
+func NewAccountRepository(pool *pgxpool.Pool) *AccountRepository {
+	return &AccountRepository{pool: pool}
 }
 
 // BeginTx starts a new transaction and returns the abstraction
 func (repo *AccountRepository) BeginTx() (TransactionPort, error) {
-	tx, err := repo.conn.Begin()
+	tx, err := repo.pool.Begin(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -40,46 +193,47 @@ func (repo *AccountRepository) BeginTx() (TransactionPort, error) {
 
 // CreateAccount creates a new account with the specified ID and initial balance
 func (repo *AccountRepository) CreateAccount(accountID int64, initialBalance decimal.Decimal) error {
-	_, err := repo.conn.Exec(`INSERT INTO accounts (account_id, balance) VALUES ($1, $2)`, accountID, initialBalance.String())
+	_, err := repo.pool.Exec(context.Background(), `INSERT INTO accounts (account_id, balance) VALUES ($1, $2)`, accountID, initialBalance)
 	if err != nil {
 		log.Printf("CreateAccount DB error: %v", err)
 	}
-	return err
+	return translateError(err, createAccountErrors)
 }
 
 // GetAccountBalance retrieves the balance for an account, optionally within a transaction
 func (repo *AccountRepository) GetAccountBalance(tx TransactionPort, accountID int64) (decimal.Decimal, error) {
-	var balanceStr string
+	var balance decimal.Decimal
 	var err error
 
+	ctx := context.Background()
 	if tx != nil {
 		dbTx, ok := tx.(*Transaction)
 		if !ok {
 			return decimal.Zero, fmt.Errorf("invalid transaction type")
 		}
-		err = dbTx.tx.QueryRow(`SELECT balance FROM accounts WHERE account_id = $1 FOR UPDATE LIMIT 1`, accountID).Scan(&balanceStr)
+		err = dbTx.tx.QueryRow(ctx, selectBalanceForUpdateSQL, accountID).Scan(&balance)
 	} else {
-		err = repo.conn.QueryRow(`SELECT balance FROM accounts WHERE account_id = $1 LIMIT 1`, accountID).Scan(&balanceStr)
+		err = repo.pool.QueryRow(ctx, selectBalanceSQL, accountID).Scan(&balance)
 	}
 
-	if err == sql.ErrNoRows {
+	if errors.Is(err, pgx.ErrNoRows) {
 		return decimal.Zero, model.ErrAccountNotFound
 	}
 	if err != nil {
 		log.Printf("GetAccountBalance DB error: %v", err)
-		return decimal.Zero, fmt.Errorf("query account by id: %w", err)
-	}
-
-	balance, err := decimal.NewFromString(balanceStr)
-	if err != nil {
-		log.Printf("GetAccountBalance parse error: %v", err)
-		return decimal.Zero, err
+		return decimal.Zero, fmt.Errorf("query account by id: %w", translateError(err, nil))
 	}
 	return balance, nil
 }
 
-// UpdateAccountBalanceTx updates the balance for an account within a transaction
+// UpdateAccountBalance updates the balance for an account within a transaction
 func (repo *AccountRepository) UpdateAccountBalance(tx TransactionPort, accountID int64, delta decimal.Decimal) error {
+	return repo.UpdateAccountBalances(tx, []BalanceUpdate{{AccountID: accountID, Delta: delta}})
+}
+
+// UpdateAccountBalances applies the updates within a transaction, sending them
+// to the server as a single batch
+func (repo *AccountRepository) UpdateAccountBalances(tx TransactionPort, updates []BalanceUpdate) error {
 	if tx == nil {
 		return fmt.Errorf("transaction is nil")
 	}
@@ -87,9 +241,54 @@ func (repo *AccountRepository) UpdateAccountBalance(tx TransactionPort, accountI
 	if !ok {
 		return fmt.Errorf("invalid transaction type")
 	}
-	_, err := dbTx.tx.Exec(`UPDATE accounts SET balance = balance + $1 WHERE account_id = $2`, delta.String(), accountID)
+
+	batch := &pgx.Batch{}
+	for _, u := range updates {
+		batch.Queue(updateBalanceSQL, u.Delta, u.AccountID, rand.Int32())
+	}
+	results := dbTx.tx.SendBatch(context.Background(), batch)
+	defer results.Close()
+
+	for range updates {
+		var rows int64
+		if err := results.QueryRow().Scan(&rows); err != nil {
+			log.Printf("UpdateAccountBalances DB error: %v", err)
+			return translateError(err, updateBalanceErrors)
+		}
+		if rows == 0 {
+			return model.ErrAccountNotFound
+		}
+	}
+	return nil
+}
+
+// TransferFunds moves amount from sourceID to destID with a single statement,
+// which runs in its own implicit transaction
+func (repo *AccountRepository) TransferFunds(sourceID, destID int64, amount decimal.Decimal) error {
+	var sharded, inHierarchy, debitNormal, sourceExists, sufficientFunds, destExists bool
+	var updated int64
+	err := repo.pool.QueryRow(context.Background(), transferFundsSQL, sourceID, destID, amount).
+		Scan(&sharded, &inHierarchy, &debitNormal, &sourceExists, &sufficientFunds, &destExists, &updated)
 	if err != nil {
-		log.Printf("UpdateAccountBalanceTx DB error: %v", err)
+		log.Printf("TransferFunds DB error: %v", err)
+		return translateError(err, updateBalanceErrors)
+	}
+
+	switch {
+	case sharded:
+		return ErrShardedAccount
+	case inHierarchy:
+		return ErrHierarchyAccount
+	case debitNormal:
+		return ErrDebitNormalAccount
+	case !sourceExists:
+		return model.ErrSourceAccountNotFound
+	case !sufficientFunds:
+		return model.ErrInsufficientFunds
+	case !destExists:
+		return model.ErrDestinationAccountNotFound
+	case updated != 2:
+		return fmt.Errorf("transfer updated %d accounts, expected 2", updated)
 	}
-	return err
+	return nil
 }
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrShardedAccount is returned by FundsTransferrer when an account keeps its
+// balance in shards and the transfer has to take the transactional path
+var ErrShardedAccount = errors.New("account balance is sharded")
+
+// BalanceShardingPort is implemented by repositories that can spread the balance
+// of a hot account over several shard rows.
+//
+// Credits to a sharded account update one shard row picked at random, so they
+// no longer serialize on the account row. Debits lock the account row and every
+// shard, fold the shards into the account row and debit it. Reads return the
+// account row plus the sum of the shards.
+type BalanceShardingPort interface {
+	// SetBalanceShards folds the current shards into the account row and spreads
+	// future credits over shards rows; 0 turns sharding off
+	SetBalanceShards(accountID int64, shards int) error
+	// CompactBalanceShards folds the shards of every sharded account into its
+	// account row and returns the number of accounts compacted
+	CompactBalanceShards() (int, error)
+}
+
+// AccountCreditLocker is implemented by repositories whose credits do not need
+// an exclusive account row lock. LockAccountForCredit checks that the account
+// exists and takes only the locks a credit needs, so concurrent credits to a
+// sharded account do not wait for each other.
+type AccountCreditLocker interface {
+	LockAccountForCredit(tx TransactionPort, accountID int64) error
+}
+
+// foldShardsSQL moves the shard balances of the given account into the account
+// row. The caller must hold the account row lock.
+const foldShardsSQL = `WITH folded AS (
+    UPDATE account_balance_shards s
+    SET balance = 0
+    FROM (
+        SELECT shard, balance FROM account_balance_shards
+        WHERE account_id = $1::bigint
+        ORDER BY shard
+        FOR UPDATE
+    ) old
+    WHERE s.account_id = $1::bigint AND s.shard = old.shard AND old.balance <> 0
+    RETURNING old.balance
+)
+UPDATE accounts
+SET balance = balance + (SELECT COALESCE(SUM(balance), 0) FROM folded)
+WHERE account_id = $1::bigint`
+
+// LockAccountForCredit locks the account row in FOR KEY SHARE mode
+func (repo *AccountRepository) LockAccountForCredit(tx TransactionPort, accountID int64) error {
+	dbTx, ok := tx.(*Transaction)
+	if !ok {
+		return fmt.Errorf("invalid transaction type")
+	}
+	var one int
+	err := dbTx.tx.QueryRow(context.Background(), lockForCreditSQL, accountID).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ErrAccountNotFound
+	}
+	if err != nil {
+		log.Printf("LockAccountForCredit DB error: %v", err)
+		return translateError(err, nil)
+	}
+	return nil
+}
+
+// SetBalanceShards changes the number of shard rows of an account
+func (repo *AccountRepository) SetBalanceShards(accountID int64, shards int) error {
+	ctx := context.Background()
+	return pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		var current int
+		err := tx.QueryRow(ctx, `SELECT balance_shards FROM accounts WHERE account_id = $1 FOR UPDATE`, accountID).Scan(&current)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrAccountNotFound
+		}
+		if err != nil {
+			return translateError(err, nil)
+		}
+		if _, err := tx.Exec(ctx, foldShardsSQL, accountID); err != nil {
+			return translateError(err, nil)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM account_balance_shards WHERE account_id = $1 AND shard >= $2`, accountID, shards); err != nil {
+			return translateError(err, nil)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO account_balance_shards (account_id, shard)
+SELECT $1, generate_series(0, $2 - 1)
+ON CONFLICT DO NOTHING`, accountID, shards); err != nil {
+			return translateError(err, nil)
+		}
+		_, err = tx.Exec(ctx, `UPDATE accounts SET balance_shards = $2 WHERE account_id = $1`, accountID, shards)
+		return translateError(err, nil)
+	})
+}
+
+// CompactBalanceShards folds the shards of each sharded account in its own
+// short transaction, so a hot account is only briefly blocked
+func (repo *AccountRepository) CompactBalanceShards() (int, error) {
+	ctx := context.Background()
+	rows, err := repo.pool.Query(ctx, `SELECT account_id FROM accounts WHERE balance_shards > 0 ORDER BY account_id`)
+	if err != nil {
+		return 0, translateError(err, nil)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, translateError(err, nil)
+	}
+
+	compacted := 0
+	for _, id := range ids {
+		err := pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, `SELECT 1 FROM accounts WHERE account_id = $1 FOR UPDATE`, id); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, foldShardsSQL, id)
+			return err
+		})
+		if err != nil {
+			log.Printf("CompactBalanceShards DB error for account %d: %v", id, err)
+			return compacted, translateError(err, nil)
+		}
+		compacted++
+	}
+	return compacted, nil
+}
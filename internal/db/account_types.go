@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrDebitNormalAccount is returned by FundsTransferrer when the source account
+// is debit-normal, so the transfer has to take the transactional path where
+// the service decides whether the account may be debited
+var ErrDebitNormalAccount = errors.New("source account is debit-normal")
+
+// AccountTypePort is implemented by repositories whose accounts have a type of
+// the chart of accounts. The type decides whether an account may go negative:
+// balance updates leaving an account that is not debit-normal negative keep
+// failing with ErrInsufficientFunds. CreateAccount and CreateChildAccount
+// create liabilities.
+type AccountTypePort interface {
+	// CreateTypedAccount creates an account of account.Type, under
+	// account.ParentAccountID unless it is 0, and reports the errors of
+	// CreateAccount and CreateChildAccount
+	CreateTypedAccount(account model.Account) error
+	// GetAccountType returns the type of an account, read within tx when it is
+	// not nil
+	GetAccountType(tx TransactionPort, accountID int64) (model.AccountType, error)
+	// OpenClearingAccount creates an asset account with a zero balance when it
+	// does not exist. An existing account is left as it is, whatever its
+	// history; it returns ErrClearingAccountInUse unless the account is an
+	// asset and is the clearing system account or no system account.
+	OpenClearingAccount(accountID int64) error
+}
+
+const (
+	// createTypedAccountSQL inserts an account of a type, with an optional parent
+	createTypedAccountSQL = `INSERT INTO accounts (account_id, balance, parent_account_id, account_type)
+VALUES ($1, $2, NULLIF($3::bigint, 0), $4)`
+
+	// openClearingAccountSQL creates a clearing account unless the account exists
+	openClearingAccountSQL = `INSERT INTO accounts (account_id, balance, account_type) VALUES ($1, 0, 'asset')
+ON CONFLICT (account_id) DO NOTHING`
+
+	// clearingAccountUsableSQL reports whether an existing account may be a
+	// clearing account
+	clearingAccountUsableSQL = `SELECT account_type = 'asset' AND COALESCE(system_account, 'clearing') = 'clearing'
+FROM accounts WHERE account_id = $1`
+)
+
+// CreateTypedAccount inserts the account and checks the limits of its new
+// ancestors, if any
+func (repo *AccountRepository) CreateTypedAccount(account model.Account) error {
+	if !account.Type.Valid() {
+		return model.ErrInvalidAccountType
+	}
+	ctx := context.Background()
+	err := pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, createTypedAccountSQL, account.AccountID, account.Balance, account.ParentAccountID, string(account.Type))
+		if err != nil {
+			return translateError(err, createChildAccountErrors)
+		}
+		if account.ParentAccountID == 0 {
+			return nil
+		}
+		return checkBalanceLimits(ctx, tx, []int64{account.AccountID})
+	})
+	if err != nil && model.ErrorCode(err) == "" && !errors.Is(err, model.ErrAccountIDAlreadyExists) && !errors.Is(err, model.ErrParentAccountNotFound) {
+		log.Printf("CreateTypedAccount DB error: %v", err)
+	}
+	return err
+}
+
+// GetAccountType returns the type of an account
+func (repo *AccountRepository) GetAccountType(tx TransactionPort, accountID int64) (model.AccountType, error) {
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return "", err
+	}
+	var accountType string
+	err = q.QueryRow(context.Background(), `SELECT account_type FROM accounts WHERE account_id = $1`, accountID).Scan(&accountType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", model.ErrAccountNotFound
+	}
+	if err != nil {
+		log.Printf("GetAccountType DB error: %v", err)
+		return "", fmt.Errorf("query account type: %w", translateError(err, nil))
+	}
+	return model.AccountType(accountType), nil
+}
+
+// OpenClearingAccount creates a clearing account, or checks that the existing
+// account can be one
+func (repo *AccountRepository) OpenClearingAccount(accountID int64) error {
+	ctx := context.Background()
+	tag, err := repo.pool.Exec(ctx, openClearingAccountSQL, accountID)
+	if err != nil {
+		log.Printf("OpenClearingAccount DB error: %v", err)
+		return translateError(err, nil)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+	var usable bool
+	if err := repo.pool.QueryRow(ctx, clearingAccountUsableSQL, accountID).Scan(&usable); err != nil {
+		log.Printf("OpenClearingAccount DB error: %v", err)
+		return translateError(err, nil)
+	}
+	if !usable {
+		return model.ErrClearingAccountInUse
+	}
+	return nil
+}
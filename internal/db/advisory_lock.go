@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tryAdvisoryLock takes the session advisory lock (class, id) on a dedicated
+// connection without waiting, reporting false when it is held elsewhere. The
+// lock is held until unlock, or until the connection dies with its replica.
+// Ids are truncated to the 32-bit lock key; ids sharing a key only serialize
+// their holders. name describes the lock in logs.
+func tryAdvisoryLock(pool *pgxpool.Pool, class int32, id int64, name string) (func(), bool, error) {
+	ctx := context.Background()
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, translateError(err, nil)
+	}
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1, $2)`, class, int32(id)).Scan(&locked); err != nil {
+		conn.Release()
+		log.Printf("Lock %s DB error: %v", name, err)
+		return nil, false, translateError(err, nil)
+	}
+	if !locked {
+		conn.Release()
+		return nil, false, nil
+	}
+	unlock := func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1, $2)`, class, int32(id)); err != nil {
+			// Closing the session is the only other way to release the lock
+			log.Printf("%s lock release error: %v", name, err)
+			conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}
+	return unlock, true, nil
+}
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// balanceRuleLockClass namespaces the per-rule advisory locks, like
+// standingOrderLockClass
+const balanceRuleLockClass int32 = 0x6272 // "br"
+
+// BalanceRuleRepositoryPort defines the repository interface for balance rules
+type BalanceRuleRepositoryPort interface {
+	// CreateBalanceRule stores a new rule from all fields of rule but its id
+	// and timestamps
+	CreateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error)
+	GetBalanceRule(id int64) (model.BalanceRule, error)
+	// ListBalanceRules returns up to limit rules in id order, optionally only
+	// those of accountID
+	ListBalanceRules(accountID int64, limit int) ([]model.BalanceRule, error)
+	// UpdateBalanceRule replaces all fields of a rule but its id and timestamps
+	UpdateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error)
+	// DeleteBalanceRule removes a rule and its sweeps
+	DeleteBalanceRule(id int64) error
+	// TransferTriggeredRules returns the ids of the enabled rules of the
+	// accounts that run after transfers, in id order
+	TransferTriggeredRules(accountIDs []int64) ([]int64, error)
+	// DueBalanceRules returns the ids of up to limit enabled rules whose next
+	// run is at or before now, earliest first
+	DueBalanceRules(now time.Time, limit int) ([]int64, error)
+	// AdvanceBalanceRule moves a rule due at runAt on to its next run. It does
+	// nothing when the rule was changed meanwhile.
+	AdvanceBalanceRule(id int64, runAt time.Time, next *time.Time) error
+	// LockBalanceRule takes the lock serializing the runs of one rule on all
+	// replicas, without waiting. It reports false when another run holds it;
+	// otherwise unlock must be called.
+	LockBalanceRule(id int64) (unlock func(), locked bool, err error)
+	// StartRuleSweep records a sweep as processing, within tx when it is not nil
+	StartRuleSweep(tx TransactionPort, sweep model.BalanceRuleSweep) (model.BalanceRuleSweep, error)
+	// FinishRuleSweep records the outcome of a started sweep, within tx when
+	// it is not nil
+	FinishRuleSweep(tx TransactionPort, id int64, status model.TransferStatus, errorCode string) error
+	// ListRuleSweeps returns up to limit sweeps of a rule, most recent first
+	ListRuleSweeps(ruleID int64, limit int) ([]model.BalanceRuleSweep, error)
+}
+
+const (
+	balanceRuleColumns = `id, account_id, counterparty_account_id, min_balance, max_balance,
+    after_transfer, schedule, next_run_at, enabled, created_at, updated_at`
+
+	createBalanceRuleSQL = `INSERT INTO balance_rules
+    (account_id, counterparty_account_id, min_balance, max_balance, after_transfer, schedule, next_run_at, enabled)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING ` + balanceRuleColumns
+
+	updateBalanceRuleSQL = `UPDATE balance_rules
+SET account_id = $2, counterparty_account_id = $3, min_balance = $4, max_balance = $5,
+    after_transfer = $6, schedule = $7, next_run_at = $8, enabled = $9, updated_at = now()
+WHERE id = $1
+RETURNING ` + balanceRuleColumns
+
+	listBalanceRulesSQL = `SELECT ` + balanceRuleColumns + ` FROM balance_rules
+WHERE $1 = 0 OR account_id = $1
+ORDER BY id
+LIMIT $2`
+
+	transferTriggeredRulesSQL = `SELECT id FROM balance_rules
+WHERE account_id = ANY($1::bigint[]) AND after_transfer AND enabled
+ORDER BY id`
+
+	dueBalanceRulesSQL = `SELECT id FROM balance_rules
+WHERE enabled AND next_run_at <= $1
+ORDER BY next_run_at, id
+LIMIT $2`
+
+	balanceRuleSweepColumns = `id, rule_id, triggered_by, source_account_id, destination_account_id, amount,
+    status, COALESCE(error_code, ''), created_at, finished_at`
+
+	startRuleSweepSQL = `INSERT INTO balance_rule_sweeps
+    (rule_id, triggered_by, source_account_id, destination_account_id, amount, status)
+VALUES ($1, $2, $3, $4, $5, 'processing')
+RETURNING ` + balanceRuleSweepColumns
+
+	listRuleSweepsSQL = `SELECT ` + balanceRuleSweepColumns + ` FROM balance_rule_sweeps
+WHERE rule_id = $1
+ORDER BY id DESC
+LIMIT $2`
+)
+
+// Domain errors for constraint violations of the balance rule statements
+var balanceRuleErrors = errorMapping{
+	sqlStateCheckViolation: model.ErrInvalidBalanceRule,
+}
+
+type BalanceRuleRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBalanceRuleRepository(pool *pgxpool.Pool) *BalanceRuleRepository {
+	return &BalanceRuleRepository{pool: pool}
+}
+
+// CreateBalanceRule stores a new balance rule
+func (repo *BalanceRuleRepository) CreateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error) {
+	row := repo.pool.QueryRow(context.Background(), createBalanceRuleSQL,
+		rule.AccountID, rule.CounterpartyAccountID, rule.Min, rule.Max, rule.AfterTransfer, rule.Schedule, rule.NextRunAt, rule.Enabled)
+	created, err := scanBalanceRule(row)
+	if err != nil {
+		log.Printf("CreateBalanceRule DB error: %v", err)
+		return model.BalanceRule{}, translateError(err, balanceRuleErrors)
+	}
+	return created, nil
+}
+
+// GetBalanceRule retrieves a balance rule by id
+func (repo *BalanceRuleRepository) GetBalanceRule(id int64) (model.BalanceRule, error) {
+	row := repo.pool.QueryRow(context.Background(), `SELECT `+balanceRuleColumns+` FROM balance_rules WHERE id = $1`, id)
+	rule, err := scanBalanceRule(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.BalanceRule{}, model.ErrBalanceRuleNotFound
+	}
+	if err != nil {
+		log.Printf("GetBalanceRule DB error: %v", err)
+		return model.BalanceRule{}, fmt.Errorf("query balance rule by id: %w", translateError(err, nil))
+	}
+	return rule, nil
+}
+
+// ListBalanceRules returns balance rules in id order
+func (repo *BalanceRuleRepository) ListBalanceRules(accountID int64, limit int) ([]model.BalanceRule, error) {
+	rows, err := repo.pool.Query(context.Background(), listBalanceRulesSQL, accountID, limit)
+	if err != nil {
+		log.Printf("ListBalanceRules DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	rules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.BalanceRule, error) {
+		return scanBalanceRule(row)
+	})
+	if err != nil {
+		log.Printf("ListBalanceRules DB error: %v", err)
+	}
+	return rules, translateError(err, nil)
+}
+
+// UpdateBalanceRule replaces the settings of a balance rule
+func (repo *BalanceRuleRepository) UpdateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error) {
+	row := repo.pool.QueryRow(context.Background(), updateBalanceRuleSQL, rule.ID,
+		rule.AccountID, rule.CounterpartyAccountID, rule.Min, rule.Max, rule.AfterTransfer, rule.Schedule, rule.NextRunAt, rule.Enabled)
+	updated, err := scanBalanceRule(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.BalanceRule{}, model.ErrBalanceRuleNotFound
+	}
+	if err != nil {
+		log.Printf("UpdateBalanceRule DB error: %v", err)
+		return model.BalanceRule{}, translateError(err, balanceRuleErrors)
+	}
+	return updated, nil
+}
+
+// DeleteBalanceRule removes a balance rule; its sweeps go with it
+func (repo *BalanceRuleRepository) DeleteBalanceRule(id int64) error {
+	tag, err := repo.pool.Exec(context.Background(), `DELETE FROM balance_rules WHERE id = $1`, id)
+	if err != nil {
+		log.Printf("DeleteBalanceRule DB error: %v", err)
+		return translateError(err, nil)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrBalanceRuleNotFound
+	}
+	return nil
+}
+
+// TransferTriggeredRules returns the rules to run after transfers touching the accounts
+func (repo *BalanceRuleRepository) TransferTriggeredRules(accountIDs []int64) ([]int64, error) {
+	rows, err := repo.pool.Query(context.Background(), transferTriggeredRulesSQL, accountIDs)
+	if err != nil {
+		log.Printf("TransferTriggeredRules DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		log.Printf("TransferTriggeredRules DB error: %v", err)
+	}
+	return ids, translateError(err, nil)
+}
+
+// DueBalanceRules returns the ids of enabled rules that are due
+func (repo *BalanceRuleRepository) DueBalanceRules(now time.Time, limit int) ([]int64, error) {
+	rows, err := repo.pool.Query(context.Background(), dueBalanceRulesSQL, now, limit)
+	if err != nil {
+		log.Printf("DueBalanceRules DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		log.Printf("DueBalanceRules DB error: %v", err)
+	}
+	return ids, translateError(err, nil)
+}
+
+// AdvanceBalanceRule moves a rule on to its next run
+func (repo *BalanceRuleRepository) AdvanceBalanceRule(id int64, runAt time.Time, next *time.Time) error {
+	_, err := repo.pool.Exec(context.Background(), `UPDATE balance_rules SET next_run_at = $3 WHERE id = $1 AND next_run_at = $2`, id, runAt, next)
+	if err != nil {
+		log.Printf("AdvanceBalanceRule DB error: %v", err)
+		return translateError(err, nil)
+	}
+	return nil
+}
+
+// LockBalanceRule takes the advisory lock of a balance rule, held on a
+// dedicated connection until unlock
+func (repo *BalanceRuleRepository) LockBalanceRule(id int64) (func(), bool, error) {
+	return tryAdvisoryLock(repo.pool, balanceRuleLockClass, id, fmt.Sprintf("balance rule %d", id))
+}
+
+// StartRuleSweep records a sweep as processing, optionally within a transaction
+func (repo *BalanceRuleRepository) StartRuleSweep(tx TransactionPort, sweep model.BalanceRuleSweep) (model.BalanceRuleSweep, error) {
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return model.BalanceRuleSweep{}, err
+	}
+	row := q.QueryRow(context.Background(), startRuleSweepSQL,
+		sweep.RuleID, string(sweep.Trigger), sweep.SourceAccountID, sweep.DestinationAccountID, sweep.Amount)
+	started, err := scanRuleSweep(row)
+	if err != nil {
+		log.Printf("StartRuleSweep DB error: %v", err)
+		return model.BalanceRuleSweep{}, translateError(err, errorMapping{sqlStateForeignKeyViolation: model.ErrBalanceRuleNotFound})
+	}
+	return started, nil
+}
+
+// FinishRuleSweep records the outcome of a sweep, optionally within a transaction
+func (repo *BalanceRuleRepository) FinishRuleSweep(tx TransactionPort, id int64, status model.TransferStatus, errorCode string) error {
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(context.Background(), `UPDATE balance_rule_sweeps
+SET status = $2, error_code = NULLIF($3, ''), finished_at = now()
+WHERE id = $1 AND status = 'processing'`, id, string(status), errorCode)
+	if err != nil {
+		log.Printf("FinishRuleSweep DB error: %v", err)
+		return translateError(err, nil)
+	}
+	return nil
+}
+
+// ListRuleSweeps returns the most recent sweeps of a rule
+func (repo *BalanceRuleRepository) ListRuleSweeps(ruleID int64, limit int) ([]model.BalanceRuleSweep, error) {
+	rows, err := repo.pool.Query(context.Background(), listRuleSweepsSQL, ruleID, limit)
+	if err != nil {
+		log.Printf("ListRuleSweeps DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	sweeps, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.BalanceRuleSweep, error) {
+		return scanRuleSweep(row)
+	})
+	if err != nil {
+		log.Printf("ListRuleSweeps DB error: %v", err)
+	}
+	return sweeps, translateError(err, nil)
+}
+
+// scanBalanceRule reads a row selected with balanceRuleColumns
+func scanBalanceRule(row pgx.Row) (model.BalanceRule, error) {
+	var r model.BalanceRule
+	err := row.Scan(&r.ID, &r.AccountID, &r.CounterpartyAccountID, &r.Min, &r.Max,
+		&r.AfterTransfer, &r.Schedule, &r.NextRunAt, &r.Enabled, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// scanRuleSweep reads a row selected with balanceRuleSweepColumns
+func scanRuleSweep(row pgx.Row) (model.BalanceRuleSweep, error) {
+	var s model.BalanceRuleSweep
+	var trigger, status string
+	err := row.Scan(&s.ID, &s.RuleID, &trigger, &s.SourceAccountID, &s.DestinationAccountID, &s.Amount,
+		&status, &s.ErrorCode, &s.CreatedAt, &s.FinishedAt)
+	s.Trigger = model.BalanceRuleTrigger(trigger)
+	s.Status = model.TransferStatus(status)
+	return s, err
+}
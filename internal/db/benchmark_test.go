@@ -0,0 +1,131 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/services"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// The transfer benchmarks compare the pgx repository (native decimal codec,
+// cached prepared statements, batched updates or the single statement
+// transfer) with the database/sql access it replaced: unprepared statements,
+// balances round-tripped through strings and one round trip per statement.
+// Both run against TEST_POSTGRES_DSN:
+//
+//	TEST_POSTGRES_DSN=... go test ./internal/db -run '^$' -bench Transfer
+
+// openBenchPool connects to the benchmark database and resets two funded accounts
+func openBenchPool(b *testing.B) *pgxpool.Pool {
+	dsn := os.Getenv(postgresTestDSNEnv)
+	if dsn == "" {
+		b.Skipf("%s not set", postgresTestDSNEnv)
+	}
+	ctx := context.Background()
+	pool, err := db.NewDBConnectionFromDSN(ctx, dsn, db.PoolOptions{MaxConns: 10, ConnectAttempts: 1})
+	require.NoError(b, err)
+	b.Cleanup(pool.Close)
+
+	migrator, err := db.NewMigrator(pool)
+	require.NoError(b, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(b, err)
+
+	_, err = pool.Exec(ctx, `TRUNCATE accounts CASCADE`)
+	require.NoError(b, err)
+	_, err = pool.Exec(ctx, `INSERT INTO accounts (account_id, balance) VALUES (1, 1000000000), (2, 1000000000)`)
+	require.NoError(b, err)
+	return pool
+}
+
+func BenchmarkTransfer_Pgx(b *testing.B) {
+	pool := openBenchPool(b)
+	svc := services.NewAccountService(db.NewAccountRepository(pool))
+	amount := decimal.RequireFromString("0.01")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src, dst := int64(1), int64(2)
+		if i%2 == 1 {
+			src, dst = dst, src
+		}
+		if err := svc.Transfer(src, dst, amount); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTransfer_SingleStatement(b *testing.B) {
+	pool := openBenchPool(b)
+	svc := services.NewAccountService(db.NewAccountRepository(pool), services.WithSingleStatementTransfer(true))
+	amount := decimal.RequireFromString("0.01")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src, dst := int64(1), int64(2)
+		if i%2 == 1 {
+			src, dst = dst, src
+		}
+		if err := svc.Transfer(src, dst, amount); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTransfer_DatabaseSQL(b *testing.B) {
+	openBenchPool(b)
+	conn, err := sql.Open("pgx", os.Getenv(postgresTestDSNEnv)+" default_query_exec_mode=exec")
+	require.NoError(b, err)
+	defer conn.Close()
+	amount := decimal.RequireFromString("0.01")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src, dst := int64(1), int64(2)
+		if i%2 == 1 {
+			src, dst = dst, src
+		}
+		if err := sqlTransfer(conn, src, dst, amount); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// sqlTransfer is the transfer as the database/sql repository performed it
+func sqlTransfer(conn *sql.DB, src, dst int64, amount decimal.Decimal) (err error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var balanceStr string
+	if err = tx.QueryRow(`SELECT balance FROM accounts WHERE account_id = $1 FOR UPDATE LIMIT 1`, src).Scan(&balanceStr); err != nil {
+		return err
+	}
+	if _, err = decimal.NewFromString(balanceStr); err != nil {
+		return err
+	}
+	if err = tx.QueryRow(`SELECT balance FROM accounts WHERE account_id = $1 FOR UPDATE LIMIT 1`, dst).Scan(&balanceStr); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE accounts SET balance = balance + $1 WHERE account_id = $2`, amount.Neg().String(), src); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE accounts SET balance = balance + $1 WHERE account_id = $2`, amount.String(), dst); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,153 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/db/dbtest"
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// postgresTestDSNEnv names the environment variable with a disposable Postgres
+// database for the conformance tests; they are skipped when it is unset
+const postgresTestDSNEnv = "TEST_POSTGRES_DSN"
+
+func TestMemoryAccountRepositoryConformance(t *testing.T) {
+	dbtest.RunAccountRepositorySuite(t, func(t *testing.T) db.AccountRepositoryPort {
+		return db.NewMemoryAccountRepository(db.NewMemoryStore())
+	})
+}
+
+func TestMemoryTransferRepositoryConformance(t *testing.T) {
+	dbtest.RunTransferRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.TransferRepositoryPort) {
+		store := db.NewMemoryStore()
+		return db.NewMemoryAccountRepository(store), db.NewMemoryTransferRepository(store)
+	})
+}
+
+func TestMemoryStandingOrderRepositoryConformance(t *testing.T) {
+	dbtest.RunStandingOrderRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.StandingOrderRepositoryPort) {
+		store := db.NewMemoryStore()
+		return db.NewMemoryAccountRepository(store), db.NewMemoryStandingOrderRepository(store)
+	})
+}
+
+func TestMemoryBalanceRuleRepositoryConformance(t *testing.T) {
+	dbtest.RunBalanceRuleRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.BalanceRuleRepositoryPort) {
+		store := db.NewMemoryStore()
+		return db.NewMemoryAccountRepository(store), db.NewMemoryBalanceRuleRepository(store)
+	})
+}
+
+func TestMemoryInterestRepositoryConformance(t *testing.T) {
+	dbtest.RunInterestRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.InterestRepositoryPort) {
+		store := db.NewMemoryStore()
+		return db.NewMemoryAccountRepository(store), db.NewMemoryInterestRepository(store)
+	})
+}
+
+func TestMemoryFeeScheduleRepositoryConformance(t *testing.T) {
+	dbtest.RunFeeScheduleRepositorySuite(t, func(t *testing.T) (db.TransferRepositoryPort, db.FeeScheduleRepositoryPort) {
+		store := db.NewMemoryStore()
+		return db.NewMemoryTransferRepository(store), db.NewMemoryFeeScheduleRepository(store)
+	})
+}
+
+func TestMemoryExternalTransferRepositoryConformance(t *testing.T) {
+	dbtest.RunExternalTransferRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.ExternalTransferRepositoryPort) {
+		store := db.NewMemoryStore()
+		return db.NewMemoryAccountRepository(store), db.NewMemoryExternalTransferRepository(store)
+	})
+}
+
+// openTestPool connects to the conformance test database and migrates it
+func openTestPool(t *testing.T) *pgxpool.Pool {
+	dsn := os.Getenv(postgresTestDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresTestDSNEnv)
+	}
+	ctx := context.Background()
+	pool, err := db.NewDBConnectionFromDSN(ctx, dsn, db.PoolOptions{MaxConns: 10, ConnectAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	migrator, err := db.NewMigrator(pool)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	return pool
+}
+
+// truncate empties every table and puts the system accounts back, so each
+// test starts from a freshly migrated database
+func truncate(t *testing.T, pool *pgxpool.Pool) {
+	ctx := context.Background()
+	_, err := pool.Exec(ctx, `TRUNCATE accounts, transfers, standing_orders, balance_rules, interest_products, fee_schedules, external_transfers RESTART IDENTITY CASCADE`)
+	require.NoError(t, err)
+	for _, system := range model.SystemAccounts {
+		_, err = pool.Exec(ctx, `INSERT INTO accounts (account_id, balance, account_type, system_account) VALUES ($1, 0, $2, $3)`,
+			system.AccountID, string(system.Type), string(system.Role))
+		require.NoError(t, err)
+	}
+}
+
+func TestPostgresAccountRepositoryConformance(t *testing.T) {
+	pool := openTestPool(t)
+	dbtest.RunAccountRepositorySuite(t, func(t *testing.T) db.AccountRepositoryPort {
+		truncate(t, pool)
+		return db.NewAccountRepository(pool)
+	})
+}
+
+func TestPostgresTransferRepositoryConformance(t *testing.T) {
+	pool := openTestPool(t)
+	dbtest.RunTransferRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.TransferRepositoryPort) {
+		truncate(t, pool)
+		return db.NewAccountRepository(pool), db.NewTransferRepository(pool)
+	})
+}
+
+func TestPostgresStandingOrderRepositoryConformance(t *testing.T) {
+	pool := openTestPool(t)
+	dbtest.RunStandingOrderRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.StandingOrderRepositoryPort) {
+		truncate(t, pool)
+		return db.NewAccountRepository(pool), db.NewStandingOrderRepository(pool)
+	})
+}
+
+func TestPostgresBalanceRuleRepositoryConformance(t *testing.T) {
+	pool := openTestPool(t)
+	dbtest.RunBalanceRuleRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.BalanceRuleRepositoryPort) {
+		truncate(t, pool)
+		return db.NewAccountRepository(pool), db.NewBalanceRuleRepository(pool)
+	})
+}
+
+func TestPostgresInterestRepositoryConformance(t *testing.T) {
+	pool := openTestPool(t)
+	dbtest.RunInterestRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.InterestRepositoryPort) {
+		truncate(t, pool)
+		return db.NewAccountRepository(pool), db.NewInterestRepository(pool)
+	})
+}
+
+func TestPostgresFeeScheduleRepositoryConformance(t *testing.T) {
+	pool := openTestPool(t)
+	dbtest.RunFeeScheduleRepositorySuite(t, func(t *testing.T) (db.TransferRepositoryPort, db.FeeScheduleRepositoryPort) {
+		truncate(t, pool)
+		return db.NewTransferRepository(pool), db.NewFeeScheduleRepository(pool)
+	})
+}
+
+func TestPostgresExternalTransferRepositoryConformance(t *testing.T) {
+	pool := openTestPool(t)
+	dbtest.RunExternalTransferRepositorySuite(t, func(t *testing.T) (db.AccountRepositoryPort, db.ExternalTransferRepositoryPort) {
+		truncate(t, pool)
+		return db.NewAccountRepository(pool), db.NewExternalTransferRepository(pool)
+	})
+}
@@ -0,0 +1,848 @@
+// Package dbtest provides behavioural test suites that every repository
+// implementation must pass, so the Postgres and in-memory stores stay interchangeable.
+package dbtest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// AccountRepositoryFactory returns an empty repository for a single test
+type AccountRepositoryFactory func(t *testing.T) db.AccountRepositoryPort
+
+// RunAccountRepositorySuite runs the AccountRepositoryPort conformance tests.
+// Each test receives a fresh repository from newRepo; the tests do not run in parallel.
+func RunAccountRepositorySuite(t *testing.T, newRepo AccountRepositoryFactory) {
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateAndGet(t, newRepo(t)) })
+	t.Run("DuplicateID", func(t *testing.T) { testDuplicateID(t, newRepo(t)) })
+	t.Run("ConcurrentDuplicateID", func(t *testing.T) { testConcurrentDuplicateID(t, newRepo(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newRepo(t)) })
+	t.Run("UpdateCommit", func(t *testing.T) { testUpdateCommit(t, newRepo(t)) })
+	t.Run("UpdateRequiresTransaction", func(t *testing.T) { testUpdateRequiresTransaction(t, newRepo(t)) })
+	t.Run("UpdateNotFound", func(t *testing.T) { testUpdateNotFound(t, newRepo(t)) })
+	t.Run("Rollback", func(t *testing.T) { testRollback(t, newRepo(t)) })
+	t.Run("RollbackVisibility", func(t *testing.T) { testRollbackVisibility(t, newRepo(t)) })
+	t.Run("RowLocking", func(t *testing.T) { testRowLocking(t, newRepo(t)) })
+	t.Run("ConcurrentUpdates", func(t *testing.T) { testConcurrentUpdates(t, newRepo(t)) })
+	t.Run("ConcurrentTransfersPreserveTotal", func(t *testing.T) { testConcurrentTransfersPreserveTotal(t, newRepo(t)) })
+	t.Run("BalanceNeverNegative", func(t *testing.T) { testBalanceNeverNegative(t, newRepo(t)) })
+	t.Run("CommitTwice", func(t *testing.T) { testCommitTwice(t, newRepo(t)) })
+	t.Run("BatchUpdate", func(t *testing.T) { testBatchUpdate(t, newRepo(t)) })
+	t.Run("TransferFunds", func(t *testing.T) { testTransferFunds(t, newRepo(t)) })
+	t.Run("ConcurrentTransferFunds", func(t *testing.T) { testConcurrentTransferFunds(t, newRepo(t)) })
+	t.Run("Savepoints", func(t *testing.T) { testSavepoints(t, newRepo(t)) })
+	t.Run("BalanceShards", func(t *testing.T) { testBalanceShards(t, newRepo(t)) })
+	t.Run("ConcurrentShardedTransfers", func(t *testing.T) { testConcurrentShardedTransfers(t, newRepo(t)) })
+	t.Run("Hierarchy", func(t *testing.T) { testHierarchy(t, newRepo(t)) })
+	t.Run("HierarchyBalanceLimits", func(t *testing.T) { testHierarchyBalanceLimits(t, newRepo(t)) })
+	t.Run("AccountTypes", func(t *testing.T) { testAccountTypes(t, newRepo(t)) })
+	t.Run("SystemAccounts", func(t *testing.T) { testSystemAccounts(t, newRepo(t)) })
+}
+
+// requireBalance asserts the committed balance of an account
+func requireBalance(t *testing.T, repo db.AccountRepositoryPort, accountID int64, want string) {
+	t.Helper()
+	balance, err := repo.GetAccountBalance(nil, accountID)
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.RequireFromString(want)), "account %d: want balance %s, got %s", accountID, want, balance)
+}
+
+func testCreateAndGet(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.RequireFromString("100.12345678")))
+
+	balance, err := repo.GetAccountBalance(nil, 1)
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.RequireFromString("100.12345678")), "got %s", balance)
+}
+
+func testDuplicateID(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(10)))
+
+	err := repo.CreateAccount(1, decimal.NewFromInt(20))
+	assert.ErrorIs(t, err, model.ErrAccountIDAlreadyExists)
+
+	requireBalance(t, repo, 1, "10")
+}
+
+func testConcurrentDuplicateID(t *testing.T, repo db.AccountRepositoryPort) {
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- repo.CreateAccount(7, decimal.NewFromInt(int64(i)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.ErrorIs(t, err, model.ErrAccountIDAlreadyExists)
+		}
+	}
+	assert.Equal(t, 1, created, "exactly one concurrent insert of the same id must succeed")
+}
+
+func testNotFound(t *testing.T, repo db.AccountRepositoryPort) {
+	_, err := repo.GetAccountBalance(nil, 404)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = repo.GetAccountBalance(tx, 404)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+}
+
+func testUpdateCommit(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(500)))
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.RequireFromString("200.5")))
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.RequireFromString("-0.00000001")))
+	require.NoError(t, tx.Commit())
+
+	requireBalance(t, repo, 1, "700.49999999")
+}
+
+func testUpdateRequiresTransaction(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(10)))
+
+	err := repo.UpdateAccountBalance(nil, 1, decimal.NewFromInt(10))
+	assert.Error(t, err)
+	requireBalance(t, repo, 1, "10")
+}
+
+func testUpdateNotFound(t *testing.T, repo db.AccountRepositoryPort) {
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	err = repo.UpdateAccountBalance(tx, 404, decimal.NewFromInt(10))
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+}
+
+func testRollback(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.NewFromInt(-40)))
+
+	balance, err := repo.GetAccountBalance(tx, 1)
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.NewFromInt(60)), "transaction sees its own update, got %s", balance)
+
+	require.NoError(t, tx.Rollback())
+	requireBalance(t, repo, 1, "100")
+}
+
+func testRollbackVisibility(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.NewFromInt(50)))
+
+	// Uncommitted changes are invisible outside the transaction
+	requireBalance(t, repo, 1, "100")
+
+	require.NoError(t, tx.Commit())
+	requireBalance(t, repo, 1, "150")
+
+	// A rolled back transaction leaves no trace, even after several updates
+	tx, err = repo.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.NewFromInt(-25)))
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.NewFromInt(-25)))
+	require.NoError(t, tx.Rollback())
+	requireBalance(t, repo, 1, "150")
+}
+
+func testRowLocking(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+
+	first, err := repo.BeginTx()
+	require.NoError(t, err)
+	_, err = repo.GetAccountBalance(first, 1)
+	require.NoError(t, err)
+
+	type result struct {
+		balance decimal.Decimal
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		second, err := repo.BeginTx()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer second.Rollback()
+		balance, err := repo.GetAccountBalance(second, 1)
+		done <- result{balance: balance, err: err}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("second transaction acquired a row locked by the first")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, repo.UpdateAccountBalance(first, 1, decimal.NewFromInt(5)))
+	require.NoError(t, first.Commit())
+
+	select {
+	case res := <-done:
+		require.NoError(t, res.err)
+		assert.True(t, res.balance.Equal(decimal.NewFromInt(105)), "second transaction sees the committed update, got %s", res.balance)
+	case <-time.After(5 * time.Second):
+		t.Fatal("second transaction still blocked after the first committed")
+	}
+}
+
+func testConcurrentUpdates(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.Zero))
+
+	const workers, increments = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*increments)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				errs <- lockAndAdd(repo, 1, decimal.NewFromInt(1))
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	requireBalance(t, repo, 1, "80")
+}
+
+// lockAndAdd performs a read-modify-write of one balance in its own transaction
+func lockAndAdd(repo db.AccountRepositoryPort, accountID int64, delta decimal.Decimal) (err error) {
+	tx, err := repo.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if _, err = repo.GetAccountBalance(tx, accountID); err != nil {
+		return err
+	}
+	if err = repo.UpdateAccountBalance(tx, accountID, delta); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func testConcurrentTransfersPreserveTotal(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(1000)))
+	require.NoError(t, repo.CreateAccount(2, decimal.NewFromInt(1000)))
+
+	const workers, transfers = 6, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*transfers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			src, dst := int64(1), int64(2)
+			if w%2 == 1 {
+				src, dst = dst, src
+			}
+			for i := 0; i < transfers; i++ {
+				errs <- transfer(repo, src, dst, decimal.RequireFromString("1.25"))
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Equal numbers of transfers ran in each direction
+	requireBalance(t, repo, 1, "1000")
+	requireBalance(t, repo, 2, "1000")
+}
+
+// transfer moves amount between two accounts, locking rows in id order to avoid deadlocks
+func transfer(repo db.AccountRepositoryPort, src, dst int64, amount decimal.Decimal) (err error) {
+	tx, err := repo.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	first, second := min(src, dst), max(src, dst)
+	if _, err = repo.GetAccountBalance(tx, first); err != nil {
+		return err
+	}
+	if _, err = repo.GetAccountBalance(tx, second); err != nil {
+		return err
+	}
+	if err = repo.UpdateAccountBalance(tx, src, amount.Neg()); err != nil {
+		return err
+	}
+	if err = repo.UpdateAccountBalance(tx, dst, amount); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func testBalanceNeverNegative(t *testing.T, repo db.AccountRepositoryPort) {
+	assert.ErrorIs(t, repo.CreateAccount(1, decimal.NewFromInt(-1)), model.ErrBalanceMustBeNonNegative)
+	_, err := repo.GetAccountBalance(nil, 1)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+
+	require.NoError(t, repo.CreateAccount(2, decimal.NewFromInt(10)))
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	err = repo.UpdateAccountBalance(tx, 2, decimal.RequireFromString("-10.00000001"))
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds, "update below zero must be rejected")
+	require.NoError(t, tx.Rollback())
+	requireBalance(t, repo, 2, "10")
+
+	// Draining the balance to exactly zero is allowed
+	tx, err = repo.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateAccountBalance(tx, 2, decimal.NewFromInt(-10)))
+	require.NoError(t, tx.Commit())
+	requireBalance(t, repo, 2, "0")
+}
+
+func testCommitTwice(t *testing.T, repo db.AccountRepositoryPort) {
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	assert.Error(t, tx.Commit(), "a finished transaction cannot be committed again")
+	assert.Error(t, tx.Rollback(), "a finished transaction cannot be rolled back")
+}
+
+func testBatchUpdate(t *testing.T, repo db.AccountRepositoryPort) {
+	batcher, ok := repo.(db.BalanceBatchUpdater)
+	if !ok {
+		t.Skip("repository does not implement BalanceBatchUpdater")
+	}
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, repo.CreateAccount(2, decimal.NewFromInt(0)))
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, batcher.UpdateAccountBalances(tx, []db.BalanceUpdate{
+		{AccountID: 1, Delta: decimal.RequireFromString("-30.5")},
+		{AccountID: 2, Delta: decimal.RequireFromString("30.5")},
+	}))
+	require.NoError(t, tx.Commit())
+	requireBalance(t, repo, 1, "69.5")
+	requireBalance(t, repo, 2, "30.5")
+
+	// A failing update reports the domain error of the statement that failed
+	tx, err = repo.BeginTx()
+	require.NoError(t, err)
+	err = batcher.UpdateAccountBalances(tx, []db.BalanceUpdate{
+		{AccountID: 1, Delta: decimal.NewFromInt(-100)},
+		{AccountID: 2, Delta: decimal.NewFromInt(100)},
+	})
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	require.NoError(t, tx.Rollback())
+
+	tx, err = repo.BeginTx()
+	require.NoError(t, err)
+	err = batcher.UpdateAccountBalances(tx, []db.BalanceUpdate{
+		{AccountID: 1, Delta: decimal.NewFromInt(-1)},
+		{AccountID: 404, Delta: decimal.NewFromInt(1)},
+	})
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+	require.NoError(t, tx.Rollback())
+	requireBalance(t, repo, 1, "69.5")
+}
+
+func testTransferFunds(t *testing.T, repo db.AccountRepositoryPort) {
+	transferrer, ok := repo.(db.FundsTransferrer)
+	if !ok {
+		t.Skip("repository does not implement FundsTransferrer")
+	}
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, repo.CreateAccount(2, decimal.NewFromInt(5)))
+
+	require.NoError(t, transferrer.TransferFunds(1, 2, decimal.RequireFromString("99.99999999")))
+	requireBalance(t, repo, 1, "0.00000001")
+	requireBalance(t, repo, 2, "104.99999999")
+
+	testCases := []struct {
+		name         string
+		source, dest int64
+		amount       string
+		want         error
+	}{
+		{"InsufficientFunds", 1, 2, "0.00000002", model.ErrInsufficientFunds},
+		{"SourceNotFound", 404, 2, "1", model.ErrSourceAccountNotFound},
+		{"DestinationNotFound", 2, 404, "1", model.ErrDestinationAccountNotFound},
+		// The source is checked before the destination, like the step by step transfer
+		{"BothNotFound", 404, 405, "1", model.ErrSourceAccountNotFound},
+		{"InsufficientFundsBeforeDestination", 1, 404, "1", model.ErrInsufficientFunds},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := transferrer.TransferFunds(tc.source, tc.dest, decimal.RequireFromString(tc.amount))
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+
+	// Failed transfers change nothing
+	requireBalance(t, repo, 1, "0.00000001")
+	requireBalance(t, repo, 2, "104.99999999")
+}
+
+func testConcurrentTransferFunds(t *testing.T, repo db.AccountRepositoryPort) {
+	transferrer, ok := repo.(db.FundsTransferrer)
+	if !ok {
+		t.Skip("repository does not implement FundsTransferrer")
+	}
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(10)))
+	require.NoError(t, repo.CreateAccount(2, decimal.NewFromInt(10)))
+
+	// Transfers in both directions lock rows in id order and never deadlock;
+	// the source balance check never lets a balance go negative
+	const workers, transfers = 6, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*transfers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			src, dst := int64(1), int64(2)
+			if w%2 == 1 {
+				src, dst = dst, src
+			}
+			for i := 0; i < transfers; i++ {
+				errs <- transferrer.TransferFunds(src, dst, decimal.NewFromInt(3))
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			require.ErrorIs(t, err, model.ErrInsufficientFunds)
+		}
+	}
+
+	first, err := repo.GetAccountBalance(nil, 1)
+	require.NoError(t, err)
+	second, err := repo.GetAccountBalance(nil, 2)
+	require.NoError(t, err)
+	assert.False(t, first.IsNegative() || second.IsNegative(), "balances %s and %s", first, second)
+	assert.True(t, first.Add(second).Equal(decimal.NewFromInt(20)), "total must be preserved, got %s", first.Add(second))
+}
+
+// creditTransfer moves amount like the service does: the source is locked for
+// the balance check and the destination only as much as a credit needs
+func creditTransfer(repo db.AccountRepositoryPort, src, dst int64, amount decimal.Decimal) (err error) {
+	tx, err := repo.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	balance, err := repo.GetAccountBalance(tx, src)
+	if err != nil {
+		return err
+	}
+	if balance.LessThan(amount) {
+		return model.ErrInsufficientFunds
+	}
+	if locker, ok := repo.(db.AccountCreditLocker); ok {
+		err = locker.LockAccountForCredit(tx, dst)
+	} else {
+		_, err = repo.GetAccountBalance(tx, dst)
+	}
+	if err != nil {
+		return err
+	}
+	if err = repo.UpdateAccountBalance(tx, src, amount.Neg()); err != nil {
+		return err
+	}
+	if err = repo.UpdateAccountBalance(tx, dst, amount); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func testBalanceShards(t *testing.T, repo db.AccountRepositoryPort) {
+	sharding, ok := repo.(db.BalanceShardingPort)
+	if !ok {
+		t.Skip("repository does not implement BalanceShardingPort")
+	}
+	assert.ErrorIs(t, sharding.SetBalanceShards(404, 4), model.ErrAccountNotFound)
+
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(10)))
+	require.NoError(t, repo.CreateAccount(2, decimal.NewFromInt(1000)))
+	require.NoError(t, sharding.SetBalanceShards(1, 4))
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, creditTransfer(repo, 2, 1, decimal.RequireFromString("1.5")))
+	}
+	// Reads return the exact total of the account row and its shards
+	requireBalance(t, repo, 1, "40")
+	requireBalance(t, repo, 2, "970")
+
+	// A debit larger than the account row alone succeeds by folding the shards
+	require.NoError(t, creditTransfer(repo, 1, 2, decimal.NewFromInt(35)))
+	requireBalance(t, repo, 1, "5")
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	assert.ErrorIs(t, repo.UpdateAccountBalance(tx, 1, decimal.RequireFromString("-5.00000001")), model.ErrInsufficientFunds)
+	require.NoError(t, tx.Rollback())
+	requireBalance(t, repo, 1, "5")
+
+	// The single statement transfer leaves sharded accounts to the transactional path
+	if transferrer, ok := repo.(db.FundsTransferrer); ok {
+		assert.ErrorIs(t, transferrer.TransferFunds(2, 1, decimal.NewFromInt(1)), db.ErrShardedAccount)
+		assert.ErrorIs(t, transferrer.TransferFunds(1, 2, decimal.NewFromInt(1)), db.ErrShardedAccount)
+		requireBalance(t, repo, 1, "5")
+	}
+
+	require.NoError(t, creditTransfer(repo, 2, 1, decimal.NewFromInt(3)))
+	compacted, err := sharding.CompactBalanceShards()
+	require.NoError(t, err)
+	assert.Equal(t, 1, compacted)
+	requireBalance(t, repo, 1, "8")
+
+	// Changing the number of shards or turning sharding off keeps the balance
+	require.NoError(t, creditTransfer(repo, 2, 1, decimal.NewFromInt(2)))
+	require.NoError(t, sharding.SetBalanceShards(1, 2))
+	requireBalance(t, repo, 1, "10")
+	require.NoError(t, creditTransfer(repo, 2, 1, decimal.NewFromInt(2)))
+	require.NoError(t, sharding.SetBalanceShards(1, 0))
+	requireBalance(t, repo, 1, "12")
+	requireBalance(t, repo, 2, "998")
+
+	compacted, err = sharding.CompactBalanceShards()
+	require.NoError(t, err)
+	assert.Equal(t, 0, compacted)
+}
+
+func testConcurrentShardedTransfers(t *testing.T, repo db.AccountRepositoryPort) {
+	sharding, ok := repo.(db.BalanceShardingPort)
+	if !ok {
+		t.Skip("repository does not implement BalanceShardingPort")
+	}
+	const feeder = 1000
+	require.NoError(t, repo.CreateAccount(1, decimal.Zero))
+	require.NoError(t, sharding.SetBalanceShards(1, 8))
+	for id := int64(feeder); id < feeder+8; id++ {
+		require.NoError(t, repo.CreateAccount(id, decimal.NewFromInt(100)))
+	}
+
+	// Credits from many accounts, debits back to them and compaction run
+	// concurrently; the total across all accounts is preserved
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*20)
+	for id := int64(feeder); id < feeder+8; id++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if i%4 == 3 {
+					err := creditTransfer(repo, 1, id, decimal.NewFromInt(1))
+					if errors.Is(err, model.ErrInsufficientFunds) {
+						err = nil
+					}
+					errs <- err
+					continue
+				}
+				errs <- creditTransfer(repo, id, 1, decimal.NewFromInt(2))
+			}
+		}(id)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if _, err := sharding.CompactBalanceShards(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}
+	}()
+	wg.Wait()
+	close(done)
+	close(errs)
+	for err := range errs {
+		if errors.Is(err, db.ErrDeadlockDetected) {
+			continue
+		}
+		require.NoError(t, err)
+	}
+
+	total, err := repo.GetAccountBalance(nil, 1)
+	require.NoError(t, err)
+	for id := int64(feeder); id < feeder+8; id++ {
+		balance, err := repo.GetAccountBalance(nil, id)
+		require.NoError(t, err)
+		total = total.Add(balance)
+	}
+	assert.True(t, total.Equal(decimal.NewFromInt(800)), "total must be preserved, got %s", total)
+}
+
+func testSavepoints(t *testing.T, repo db.AccountRepositoryPort) {
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, repo.CreateAccount(2, decimal.NewFromInt(100)))
+
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	savepoints, ok := tx.(db.SavepointPort)
+	if !ok {
+		tx.Rollback()
+		t.Skip("transaction does not implement SavepointPort")
+	}
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.NewFromInt(10)))
+
+	require.NoError(t, savepoints.Savepoint("leg"))
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.NewFromInt(5)))
+	_, err = repo.GetAccountBalance(tx, 2)
+	require.NoError(t, err)
+	// A failed statement only spoils the work after the savepoint
+	assert.ErrorIs(t, repo.UpdateAccountBalance(tx, 1, decimal.NewFromInt(-1000)), model.ErrInsufficientFunds)
+	require.NoError(t, savepoints.RollbackToSavepoint("leg"))
+	require.NoError(t, savepoints.ReleaseSavepoint("leg"))
+
+	// Row locks taken after the savepoint were released by the rollback
+	locked := make(chan error, 1)
+	go func() { locked <- lockAndAdd(repo, 2, decimal.NewFromInt(1)) }()
+	select {
+	case err := <-locked:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("row locked after the savepoint is still held")
+	}
+
+	require.NoError(t, repo.UpdateAccountBalance(tx, 1, decimal.NewFromInt(1)))
+	require.NoError(t, tx.Commit())
+	requireBalance(t, repo, 1, "111")
+	requireBalance(t, repo, 2, "101")
+
+	assert.Error(t, savepoints.Savepoint("late"), "a finished transaction cannot create savepoints")
+}
+
+func testHierarchy(t *testing.T, repo db.AccountRepositoryPort) {
+	hierarchy, ok := repo.(db.AccountHierarchyPort)
+	if !ok {
+		t.Skip("repository does not implement AccountHierarchyPort")
+	}
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, hierarchy.CreateChildAccount(2, 1, decimal.NewFromInt(20)))
+	require.NoError(t, hierarchy.CreateChildAccount(4, 1, decimal.NewFromInt(5)))
+	require.NoError(t, hierarchy.CreateChildAccount(3, 2, decimal.NewFromInt(7)))
+	assert.ErrorIs(t, hierarchy.CreateChildAccount(5, 404, decimal.Zero), model.ErrParentAccountNotFound)
+	assert.ErrorIs(t, hierarchy.CreateChildAccount(3, 1, decimal.Zero), model.ErrAccountIDAlreadyExists)
+
+	nodes, err := hierarchy.GetAccountTree(1)
+	require.NoError(t, err)
+	// Parents come before their children, each level in id order
+	var ids, parents []int64
+	for _, node := range nodes {
+		ids = append(ids, node.AccountID)
+		parents = append(parents, node.ParentAccountID)
+	}
+	assert.Equal(t, []int64{1, 2, 4, 3}, ids)
+	assert.Equal(t, []int64{0, 1, 1, 2}, parents)
+	assert.True(t, nodes[3].Balance.Equal(decimal.NewFromInt(7)))
+	assert.Equal(t, model.ChildBalanceUnlimited, nodes[0].ChildPolicy)
+	_, err = hierarchy.GetAccountTree(404)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+
+	// An account cannot move under itself or its descendants
+	assert.ErrorIs(t, hierarchy.SetAccountParent(1, 1), model.ErrAccountHierarchyCycle)
+	assert.ErrorIs(t, hierarchy.SetAccountParent(1, 3), model.ErrAccountHierarchyCycle)
+	assert.ErrorIs(t, hierarchy.SetAccountParent(1, 404), model.ErrParentAccountNotFound)
+	assert.ErrorIs(t, hierarchy.SetAccountParent(404, 1), model.ErrAccountNotFound)
+
+	require.NoError(t, hierarchy.SetAccountParent(3, 4))
+	require.NoError(t, hierarchy.SetAccountParent(2, 0))
+	nodes, err = hierarchy.GetAccountTree(1)
+	require.NoError(t, err)
+	require.Len(t, nodes, 3)
+	assert.Equal(t, int64(3), nodes[2].AccountID)
+	assert.Equal(t, int64(4), nodes[2].ParentAccountID)
+
+	// Accounts with a parent leave the single statement transfer to the
+	// transactional path; roots without limits do not need it
+	if transferrer, ok := repo.(db.FundsTransferrer); ok {
+		assert.ErrorIs(t, transferrer.TransferFunds(1, 4, decimal.NewFromInt(1)), db.ErrHierarchyAccount)
+		requireBalance(t, repo, 1, "100")
+		require.NoError(t, transferrer.TransferFunds(2, 1, decimal.NewFromInt(1)))
+	}
+}
+
+func testHierarchyBalanceLimits(t *testing.T, repo db.AccountRepositoryPort) {
+	hierarchy, ok := repo.(db.AccountHierarchyPort)
+	if !ok {
+		t.Skip("repository does not implement AccountHierarchyPort")
+	}
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(50)))
+	require.NoError(t, repo.CreateAccount(9, decimal.NewFromInt(100)))
+	require.NoError(t, hierarchy.CreateChildAccount(2, 1, decimal.NewFromInt(30)))
+	require.NoError(t, hierarchy.CreateChildAccount(3, 2, decimal.NewFromInt(30)))
+
+	// The descendants of 1 hold 60, more than its own 50
+	assert.ErrorIs(t, hierarchy.SetChildBalancePolicy(1, model.ChildBalanceWithinParent), model.ErrChildBalanceLimitExceeded)
+	require.NoError(t, transfer(repo, 3, 9, decimal.NewFromInt(10)))
+	require.NoError(t, hierarchy.SetChildBalancePolicy(1, model.ChildBalanceWithinParent))
+
+	// checkedTransfer moves funds and checks the limits before committing
+	checkedTransfer := func(src, dst int64, amount int64) (err error) {
+		tx, err := repo.BeginTx()
+		require.NoError(t, err)
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+			}
+		}()
+		if err = repo.UpdateAccountBalance(tx, src, decimal.NewFromInt(-amount)); err != nil {
+			return err
+		}
+		if err = repo.UpdateAccountBalance(tx, dst, decimal.NewFromInt(amount)); err != nil {
+			return err
+		}
+		if err = hierarchy.CheckBalanceLimits(tx, src, dst); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	// A grandchild credit counts against the limit, and so does a debit of the limiting account
+	assert.ErrorIs(t, checkedTransfer(9, 3, 1), model.ErrChildBalanceLimitExceeded)
+	assert.ErrorIs(t, checkedTransfer(1, 9, 1), model.ErrChildBalanceLimitExceeded)
+	require.NoError(t, checkedTransfer(9, 1, 10))
+	require.NoError(t, checkedTransfer(9, 3, 10))
+	require.NoError(t, checkedTransfer(3, 2, 5), "moves within the descendants keep their total")
+	requireBalance(t, repo, 1, "60")
+	requireBalance(t, repo, 3, "25")
+
+	// Placing an account under the limited tree counts its balance too
+	require.NoError(t, repo.CreateAccount(4, decimal.NewFromInt(1)))
+	assert.ErrorIs(t, hierarchy.SetAccountParent(4, 3), model.ErrChildBalanceLimitExceeded)
+	assert.ErrorIs(t, hierarchy.CreateChildAccount(5, 3, decimal.NewFromInt(1)), model.ErrChildBalanceLimitExceeded)
+	require.NoError(t, hierarchy.CreateChildAccount(5, 3, decimal.Zero))
+	require.NoError(t, hierarchy.SetChildBalancePolicy(1, model.ChildBalanceUnlimited))
+	require.NoError(t, hierarchy.SetAccountParent(4, 3))
+}
+
+func testAccountTypes(t *testing.T, repo db.AccountRepositoryPort) {
+	types, ok := repo.(db.AccountTypePort)
+	if !ok {
+		t.Skip("repository does not implement AccountTypePort")
+	}
+	requireType := func(accountID int64, want model.AccountType) {
+		t.Helper()
+		got, err := types.GetAccountType(nil, accountID)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(10)))
+	requireType(1, model.AccountLiability)
+	_, err := types.GetAccountType(nil, 404)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+
+	require.NoError(t, types.CreateTypedAccount(model.Account{AccountID: 2, Balance: decimal.NewFromInt(10), Type: model.AccountExpense}))
+	requireType(2, model.AccountExpense)
+	assert.ErrorIs(t, types.CreateTypedAccount(model.Account{AccountID: 2, Type: model.AccountAsset}), model.ErrAccountIDAlreadyExists)
+	assert.ErrorIs(t, types.CreateTypedAccount(model.Account{AccountID: 3, ParentAccountID: 404, Type: model.AccountEquity}), model.ErrParentAccountNotFound)
+	require.NoError(t, types.CreateTypedAccount(model.Account{AccountID: 3, ParentAccountID: 1, Type: model.AccountEquity}))
+	requireType(3, model.AccountEquity)
+	require.NoError(t, types.OpenClearingAccount(9), "a missing account is created")
+	requireBalance(t, repo, 9, "0")
+	requireType(9, model.AccountAsset)
+
+	// Debit-normal accounts may go negative
+	tx, err := repo.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateAccountBalance(tx, 9, decimal.NewFromInt(-25)))
+	require.NoError(t, repo.UpdateAccountBalance(tx, 2, decimal.NewFromInt(-15)))
+	require.NoError(t, tx.Commit())
+	requireBalance(t, repo, 9, "-25")
+	requireBalance(t, repo, 2, "-5")
+
+	for _, accountID := range []int64{1, 3} {
+		tx, err = repo.BeginTx()
+		require.NoError(t, err)
+		assert.ErrorIs(t, repo.UpdateAccountBalance(tx, accountID, decimal.NewFromInt(-11)), model.ErrInsufficientFunds,
+			"credit-normal accounts stay non-negative")
+		require.NoError(t, tx.Rollback())
+	}
+
+	require.NoError(t, types.OpenClearingAccount(9), "an existing clearing account keeps its balance")
+	requireBalance(t, repo, 9, "-25")
+	assert.ErrorIs(t, types.OpenClearingAccount(1), model.ErrClearingAccountInUse)
+	requireType(1, model.AccountLiability)
+	assert.ErrorIs(t, types.OpenClearingAccount(2), model.ErrClearingAccountInUse)
+	requireType(2, model.AccountExpense)
+
+	if transferrer, ok := repo.(db.FundsTransferrer); ok {
+		assert.ErrorIs(t, transferrer.TransferFunds(9, 1, decimal.NewFromInt(5)), db.ErrDebitNormalAccount)
+		requireBalance(t, repo, 9, "-25")
+		assert.ErrorIs(t, transferrer.TransferFunds(1, 9, decimal.NewFromInt(16)), model.ErrInsufficientFunds)
+	}
+}
+
+func testSystemAccounts(t *testing.T, repo db.AccountRepositoryPort) {
+	types, ok := repo.(db.AccountTypePort)
+	if !ok {
+		t.Skip("repository does not implement AccountTypePort")
+	}
+	for _, system := range model.SystemAccounts {
+		requireBalance(t, repo, system.AccountID, "0")
+		accountType, err := types.GetAccountType(nil, system.AccountID)
+		require.NoError(t, err)
+		assert.Equal(t, system.Type, accountType, "%s account", system.Role)
+	}
+
+	// Only the clearing system account may be a clearing account
+	for _, system := range model.SystemAccounts {
+		err := types.OpenClearingAccount(system.AccountID)
+		if system.Role == model.SystemClearing {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, model.ErrClearingAccountInUse, "%s account", system.Role)
+		}
+	}
+}
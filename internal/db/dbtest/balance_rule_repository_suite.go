@@ -0,0 +1,353 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// BalanceRuleRepositoryFactory returns empty repositories sharing one database for a single test
+type BalanceRuleRepositoryFactory func(t *testing.T) (db.AccountRepositoryPort, db.BalanceRuleRepositoryPort)
+
+// RunBalanceRuleRepositorySuite runs the BalanceRuleRepositoryPort conformance tests
+func RunBalanceRuleRepositorySuite(t *testing.T, newRepos BalanceRuleRepositoryFactory) {
+	run := func(name string, test func(*testing.T, db.BalanceRuleRepositoryPort)) {
+		t.Run(name, func(t *testing.T) {
+			_, rules := newRepos(t)
+			test(t, rules)
+		})
+	}
+	run("CreateAndGet", testBalanceRuleCreateAndGet)
+	run("RejectsInvalid", testBalanceRuleRejectsInvalid)
+	run("List", testListBalanceRules)
+	run("Update", testUpdateBalanceRule)
+	run("Delete", testDeleteBalanceRule)
+	run("TransferTriggered", testTransferTriggeredRules)
+	run("DueInOrder", testDueBalanceRules)
+	run("Advance", testAdvanceBalanceRule)
+	run("LockIsExclusive", testLockBalanceRule)
+	run("Sweeps", testRuleSweeps)
+	t.Run("SweepWithinTransaction", func(t *testing.T) {
+		accounts, rules := newRepos(t)
+		testRuleSweepWithinTransaction(t, accounts, rules)
+	})
+}
+
+// ruleStart is the first scheduled run of the balance rules created by the suite
+var ruleStart = time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+// newBalanceRule returns an enabled rule keeping account 1 between 10 and 50
+// through account 2 after each transfer
+func newBalanceRule() model.BalanceRule {
+	min, max := decimal.NewFromInt(10), decimal.NewFromInt(50)
+	return model.BalanceRule{
+		AccountID:             1,
+		CounterpartyAccountID: 2,
+		Min:                   &min,
+		Max:                   &max,
+		AfterTransfer:         true,
+		Enabled:               true,
+	}
+}
+
+// newScheduledRule returns an enabled daily rule next due at nextRunAt
+func newScheduledRule(nextRunAt time.Time) model.BalanceRule {
+	rule := newBalanceRule()
+	rule.AfterTransfer = false
+	rule.Schedule = "daily"
+	rule.NextRunAt = &nextRunAt
+	return rule
+}
+
+func createBalanceRule(t *testing.T, repo db.BalanceRuleRepositoryPort, rule model.BalanceRule) model.BalanceRule {
+	t.Helper()
+	created, err := repo.CreateBalanceRule(rule)
+	require.NoError(t, err)
+	return created
+}
+
+func testBalanceRuleCreateAndGet(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	rule := newScheduledRule(ruleStart)
+	rule.Max = nil
+	rule.AfterTransfer = true
+	created := createBalanceRule(t, repo, rule)
+	assert.Positive(t, created.ID)
+	assert.False(t, created.CreatedAt.IsZero())
+	assert.False(t, created.UpdatedAt.IsZero())
+
+	got, err := repo.GetBalanceRule(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, got.ID)
+	assert.Equal(t, int64(1), got.AccountID)
+	assert.Equal(t, int64(2), got.CounterpartyAccountID)
+	require.NotNil(t, got.Min)
+	assert.True(t, got.Min.Equal(decimal.NewFromInt(10)), "got %s", got.Min)
+	assert.Nil(t, got.Max)
+	assert.True(t, got.AfterTransfer)
+	assert.Equal(t, "daily", got.Schedule)
+	require.NotNil(t, got.NextRunAt)
+	assert.True(t, got.NextRunAt.Equal(ruleStart))
+	assert.True(t, got.Enabled)
+
+	_, err = repo.GetBalanceRule(created.ID + 1)
+	assert.ErrorIs(t, err, model.ErrBalanceRuleNotFound)
+}
+
+func testBalanceRuleRejectsInvalid(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	sameAccount := newBalanceRule()
+	sameAccount.CounterpartyAccountID = sameAccount.AccountID
+	unbounded := newBalanceRule()
+	unbounded.Min, unbounded.Max = nil, nil
+	inverted := newBalanceRule()
+	inverted.Min, inverted.Max = inverted.Max, inverted.Min
+	untriggered := newBalanceRule()
+	untriggered.AfterTransfer = false
+
+	for name, rule := range map[string]model.BalanceRule{
+		"same account":  sameAccount,
+		"no bounds":     unbounded,
+		"min above max": inverted,
+		"no trigger":    untriggered,
+	} {
+		_, err := repo.CreateBalanceRule(rule)
+		assert.ErrorIs(t, err, model.ErrInvalidBalanceRule, name)
+	}
+
+	created := createBalanceRule(t, repo, newBalanceRule())
+	inverted.ID = created.ID
+	_, err := repo.UpdateBalanceRule(inverted)
+	assert.ErrorIs(t, err, model.ErrInvalidBalanceRule)
+}
+
+func testListBalanceRules(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	first := createBalanceRule(t, repo, newBalanceRule())
+	other := newBalanceRule()
+	other.AccountID = 3
+	second := createBalanceRule(t, repo, other)
+	third := createBalanceRule(t, repo, newBalanceRule())
+
+	all, err := repo.ListBalanceRules(0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, second.ID, third.ID}, balanceRuleIDs(all))
+
+	ofAccount, err := repo.ListBalanceRules(1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, third.ID}, balanceRuleIDs(ofAccount))
+
+	limited, err := repo.ListBalanceRules(0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID}, balanceRuleIDs(limited))
+}
+
+func testUpdateBalanceRule(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	created := createBalanceRule(t, repo, newBalanceRule())
+
+	rule := newScheduledRule(ruleStart)
+	rule.ID = created.ID
+	rule.CounterpartyAccountID = 3
+	rule.Min = nil
+	rule.Enabled = false
+	updated, err := repo.UpdateBalanceRule(rule)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, updated.ID)
+	assert.True(t, updated.CreatedAt.Equal(created.CreatedAt))
+
+	got, err := repo.GetBalanceRule(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), got.CounterpartyAccountID)
+	assert.Nil(t, got.Min)
+	require.NotNil(t, got.Max)
+	assert.False(t, got.AfterTransfer)
+	assert.Equal(t, "daily", got.Schedule)
+	assert.False(t, got.Enabled)
+
+	rule.ID = created.ID + 1
+	_, err = repo.UpdateBalanceRule(rule)
+	assert.ErrorIs(t, err, model.ErrBalanceRuleNotFound)
+}
+
+func testDeleteBalanceRule(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	rule := createBalanceRule(t, repo, newBalanceRule())
+	_, err := repo.StartRuleSweep(nil, model.BalanceRuleSweep{
+		RuleID: rule.ID, Trigger: model.BalanceRuleAfterTransfer,
+		SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteBalanceRule(rule.ID))
+	_, err = repo.GetBalanceRule(rule.ID)
+	assert.ErrorIs(t, err, model.ErrBalanceRuleNotFound)
+	sweeps, err := repo.ListRuleSweeps(rule.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, sweeps, "sweeps go with their rule")
+
+	assert.ErrorIs(t, repo.DeleteBalanceRule(rule.ID), model.ErrBalanceRuleNotFound)
+}
+
+func testTransferTriggeredRules(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	first := createBalanceRule(t, repo, newBalanceRule())
+	createBalanceRule(t, repo, newScheduledRule(ruleStart))
+	disabled := newBalanceRule()
+	disabled.Enabled = false
+	createBalanceRule(t, repo, disabled)
+	other := newBalanceRule()
+	other.AccountID = 3
+	third := createBalanceRule(t, repo, other)
+
+	ids, err := repo.TransferTriggeredRules([]int64{1, 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, third.ID}, ids)
+
+	ids, err = repo.TransferTriggeredRules([]int64{2})
+	require.NoError(t, err)
+	assert.Empty(t, ids, "rules run for their account, not their counterparty")
+}
+
+func testDueBalanceRules(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	later := createBalanceRule(t, repo, newScheduledRule(ruleStart.Add(time.Hour)))
+	earlier := createBalanceRule(t, repo, newScheduledRule(ruleStart))
+	createBalanceRule(t, repo, newScheduledRule(ruleStart.Add(3*time.Hour)))
+	disabled := newScheduledRule(ruleStart)
+	disabled.Enabled = false
+	createBalanceRule(t, repo, disabled)
+
+	due, err := repo.DueBalanceRules(ruleStart.Add(2*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{earlier.ID, later.ID}, due)
+
+	due, err = repo.DueBalanceRules(ruleStart.Add(2*time.Hour), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{earlier.ID}, due)
+
+	due, err = repo.DueBalanceRules(ruleStart.Add(-time.Second), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+func testAdvanceBalanceRule(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	rule := createBalanceRule(t, repo, newScheduledRule(ruleStart))
+	next := ruleStart.AddDate(0, 0, 1)
+
+	require.NoError(t, repo.AdvanceBalanceRule(rule.ID, ruleStart, &next))
+	got, err := repo.GetBalanceRule(rule.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.NextRunAt)
+	assert.True(t, got.NextRunAt.Equal(next))
+
+	// A run that is no longer due does not move the rule
+	require.NoError(t, repo.AdvanceBalanceRule(rule.ID, ruleStart, nil))
+	got, err = repo.GetBalanceRule(rule.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.NextRunAt)
+	assert.True(t, got.NextRunAt.Equal(next))
+}
+
+func testLockBalanceRule(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	rule := createBalanceRule(t, repo, newBalanceRule())
+	other := createBalanceRule(t, repo, newBalanceRule())
+
+	unlock, locked, err := repo.LockBalanceRule(rule.ID)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	_, locked, err = repo.LockBalanceRule(rule.ID)
+	require.NoError(t, err)
+	assert.False(t, locked, "a locked balance rule must not be locked again")
+
+	unlockOther, locked, err := repo.LockBalanceRule(other.ID)
+	require.NoError(t, err)
+	require.True(t, locked, "locks are per balance rule")
+	unlockOther()
+
+	unlock()
+	unlock, locked, err = repo.LockBalanceRule(rule.ID)
+	require.NoError(t, err)
+	require.True(t, locked)
+	unlock()
+}
+
+func testRuleSweeps(t *testing.T, repo db.BalanceRuleRepositoryPort) {
+	rule := createBalanceRule(t, repo, newBalanceRule())
+	start := func(trigger model.BalanceRuleTrigger, amount int64) model.BalanceRuleSweep {
+		sweep, err := repo.StartRuleSweep(nil, model.BalanceRuleSweep{
+			RuleID: rule.ID, Trigger: trigger,
+			SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(amount),
+		})
+		require.NoError(t, err)
+		return sweep
+	}
+	first := start(model.BalanceRuleAfterTransfer, 5)
+	assert.Positive(t, first.ID)
+	assert.Equal(t, model.TransferProcessing, first.Status)
+	last := start(model.BalanceRuleScheduled, 7)
+
+	require.NoError(t, repo.FinishRuleSweep(nil, first.ID, model.TransferCompleted, ""))
+	require.NoError(t, repo.FinishRuleSweep(nil, last.ID, model.TransferFailed, "insufficient_funds"))
+	// A finished sweep keeps its outcome
+	require.NoError(t, repo.FinishRuleSweep(nil, last.ID, model.TransferCompleted, ""))
+
+	sweeps, err := repo.ListRuleSweeps(rule.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, sweeps, 2)
+	assert.Equal(t, last.ID, sweeps[0].ID, "most recent first")
+	assert.Equal(t, model.BalanceRuleScheduled, sweeps[0].Trigger)
+	assert.Equal(t, model.TransferFailed, sweeps[0].Status)
+	assert.Equal(t, "insufficient_funds", sweeps[0].ErrorCode)
+	assert.NotNil(t, sweeps[0].FinishedAt)
+	assert.Equal(t, first.ID, sweeps[1].ID)
+	assert.Equal(t, model.BalanceRuleAfterTransfer, sweeps[1].Trigger)
+	assert.True(t, sweeps[1].Amount.Equal(decimal.NewFromInt(5)))
+	assert.Equal(t, model.TransferCompleted, sweeps[1].Status)
+	assert.Empty(t, sweeps[1].ErrorCode)
+
+	limited, err := repo.ListRuleSweeps(rule.ID, 1)
+	require.NoError(t, err)
+	assert.Len(t, limited, 1)
+
+	_, err = repo.StartRuleSweep(nil, model.BalanceRuleSweep{
+		RuleID: rule.ID + 1, Trigger: model.BalanceRuleAfterTransfer,
+		SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(1),
+	})
+	assert.ErrorIs(t, err, model.ErrBalanceRuleNotFound)
+}
+
+func testRuleSweepWithinTransaction(t *testing.T, accounts db.AccountRepositoryPort, repo db.BalanceRuleRepositoryPort) {
+	rule := createBalanceRule(t, repo, newBalanceRule())
+	runSweep := func() db.TransactionPort {
+		tx, err := accounts.BeginTx()
+		require.NoError(t, err)
+		sweep, err := repo.StartRuleSweep(tx, model.BalanceRuleSweep{
+			RuleID: rule.ID, Trigger: model.BalanceRuleScheduled,
+			SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(5),
+		})
+		require.NoError(t, err)
+		require.NoError(t, repo.FinishRuleSweep(tx, sweep.ID, model.TransferCompleted, ""))
+		return tx
+	}
+
+	// A rolled back sweep leaves no trace
+	require.NoError(t, runSweep().Rollback())
+	sweeps, err := repo.ListRuleSweeps(rule.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, sweeps)
+
+	require.NoError(t, runSweep().Commit())
+	sweeps, err = repo.ListRuleSweeps(rule.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, sweeps, 1)
+	assert.Equal(t, model.TransferCompleted, sweeps[0].Status)
+}
+
+func balanceRuleIDs(rules []model.BalanceRule) []int64 {
+	ids := make([]int64, len(rules))
+	for i, rule := range rules {
+		ids[i] = rule.ID
+	}
+	return ids
+}
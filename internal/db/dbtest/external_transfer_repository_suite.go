@@ -0,0 +1,161 @@
+package dbtest
+
+import (
+	"testing"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ExternalTransferRepositoryFactory returns empty repositories sharing one database for a single test
+type ExternalTransferRepositoryFactory func(t *testing.T) (db.AccountRepositoryPort, db.ExternalTransferRepositoryPort)
+
+// RunExternalTransferRepositorySuite runs the ExternalTransferRepositoryPort conformance tests
+func RunExternalTransferRepositorySuite(t *testing.T, newRepos ExternalTransferRepositoryFactory) {
+	run := func(name string, test func(*testing.T, db.AccountRepositoryPort, db.ExternalTransferRepositoryPort)) {
+		t.Run(name, func(t *testing.T) {
+			accounts, transfers := newRepos(t)
+			// Account 1 is a customer account and 9 a clearing account
+			require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+			require.NoError(t, accounts.CreateAccount(9, decimal.Zero))
+			test(t, accounts, transfers)
+		})
+	}
+	run("CreateAndGet", testExternalTransferCreateAndGet)
+	run("DuplicateReference", testExternalTransferDuplicateReference)
+	run("List", testListExternalTransfers)
+	run("LockAndSetStatus", testLockExternalTransfer)
+	run("Rollback", testExternalTransferRollback)
+}
+
+// newDeposit returns a deposit of amount into account 1 through clearing account 9
+func newDeposit(amount int64, reference string) model.ExternalTransfer {
+	return model.ExternalTransfer{
+		Kind: model.Deposit, AccountID: 1, ClearingAccountID: 9, Amount: decimal.NewFromInt(amount),
+		ClientID: "acme", ExternalReference: reference,
+	}
+}
+
+func testExternalTransferCreateAndGet(t *testing.T, _ db.AccountRepositoryPort, repo db.ExternalTransferRepositoryPort) {
+	created, err := repo.CreateExternalTransfer(nil, newDeposit(50, "wire-1"))
+	require.NoError(t, err)
+	assert.Positive(t, created.ID)
+	assert.Equal(t, model.ExternalTransferPending, created.Status)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	got, err := repo.GetExternalTransfer(model.Deposit, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Deposit, got.Kind)
+	assert.Equal(t, int64(1), got.AccountID)
+	assert.Equal(t, int64(9), got.ClearingAccountID)
+	assert.True(t, got.Amount.Equal(decimal.NewFromInt(50)), "got %s", got.Amount)
+	assert.Equal(t, model.ExternalTransferPending, got.Status)
+	assert.Equal(t, "acme", got.ClientID)
+	assert.Equal(t, "wire-1", got.ExternalReference)
+
+	_, err = repo.GetExternalTransfer(model.Withdrawal, created.ID)
+	assert.ErrorIs(t, err, model.ErrExternalTransferNotFound, "deposits are not withdrawals")
+	_, err = repo.GetExternalTransfer(model.Deposit, 999)
+	assert.ErrorIs(t, err, model.ErrExternalTransferNotFound)
+
+	missing := newDeposit(50, "")
+	missing.AccountID = 404
+	_, err = repo.CreateExternalTransfer(nil, missing)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+}
+
+func testExternalTransferDuplicateReference(t *testing.T, _ db.AccountRepositoryPort, repo db.ExternalTransferRepositoryPort) {
+	_, err := repo.CreateExternalTransfer(nil, newDeposit(50, "wire-1"))
+	require.NoError(t, err)
+	_, err = repo.CreateExternalTransfer(nil, newDeposit(60, "wire-1"))
+	assert.ErrorIs(t, err, model.ErrDuplicateExternalReference)
+
+	withdrawal := newDeposit(60, "wire-1")
+	withdrawal.Kind = model.Withdrawal
+	_, err = repo.CreateExternalTransfer(nil, withdrawal)
+	require.NoError(t, err, "references are unique per kind")
+	other := newDeposit(60, "wire-1")
+	other.ClientID = "globex"
+	_, err = repo.CreateExternalTransfer(nil, other)
+	require.NoError(t, err, "references are unique per client")
+	_, err = repo.CreateExternalTransfer(nil, newDeposit(60, ""))
+	require.NoError(t, err)
+	_, err = repo.CreateExternalTransfer(nil, newDeposit(60, ""))
+	require.NoError(t, err, "the reference is optional")
+}
+
+func testListExternalTransfers(t *testing.T, accounts db.AccountRepositoryPort, repo db.ExternalTransferRepositoryPort) {
+	require.NoError(t, accounts.CreateAccount(2, decimal.Zero))
+	first, err := repo.CreateExternalTransfer(nil, newDeposit(10, ""))
+	require.NoError(t, err)
+	other := newDeposit(20, "")
+	other.AccountID = 2
+	second, err := repo.CreateExternalTransfer(nil, other)
+	require.NoError(t, err)
+	withdrawal := newDeposit(30, "")
+	withdrawal.Kind = model.Withdrawal
+	_, err = repo.CreateExternalTransfer(nil, withdrawal)
+	require.NoError(t, err)
+
+	list, err := repo.ListExternalTransfers(model.Deposit, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, second.ID, list[0].ID, "newest first")
+	assert.Equal(t, first.ID, list[1].ID)
+
+	list, err = repo.ListExternalTransfers(model.Deposit, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, first.ID, list[0].ID)
+	list, err = repo.ListExternalTransfers(model.Deposit, 0, 1)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+	list, err = repo.ListExternalTransfers(model.Withdrawal, 2, 10)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func testLockExternalTransfer(t *testing.T, accounts db.AccountRepositoryPort, repo db.ExternalTransferRepositoryPort) {
+	created, err := repo.CreateExternalTransfer(nil, newDeposit(50, ""))
+	require.NoError(t, err)
+
+	tx, err := accounts.BeginTx()
+	require.NoError(t, err)
+	_, err = repo.LockExternalTransfer(tx, model.Withdrawal, created.ID)
+	assert.ErrorIs(t, err, model.ErrExternalTransferNotFound)
+	locked, err := repo.LockExternalTransfer(tx, model.Deposit, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferPending, locked.Status)
+	settled, err := repo.SetExternalTransferStatus(tx, created.ID, model.ExternalTransferSettled)
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferSettled, settled.Status)
+
+	got, err := repo.GetExternalTransfer(model.Deposit, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferPending, got.Status, "the change is not visible before commit")
+	require.NoError(t, tx.Commit())
+	got, err = repo.GetExternalTransfer(model.Deposit, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferSettled, got.Status)
+	assert.False(t, got.UpdatedAt.Before(got.CreatedAt))
+
+	_, err = repo.LockExternalTransfer(nil, model.Deposit, created.ID)
+	assert.Error(t, err, "locking needs a transaction")
+}
+
+func testExternalTransferRollback(t *testing.T, accounts db.AccountRepositoryPort, repo db.ExternalTransferRepositoryPort) {
+	tx, err := accounts.BeginTx()
+	require.NoError(t, err)
+	created, err := repo.CreateExternalTransfer(tx, newDeposit(50, "wire-1"))
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+
+	_, err = repo.GetExternalTransfer(model.Deposit, created.ID)
+	assert.ErrorIs(t, err, model.ErrExternalTransferNotFound)
+	_, err = repo.CreateExternalTransfer(nil, newDeposit(50, "wire-1"))
+	require.NoError(t, err, "the reference of a rolled back transfer is free")
+}
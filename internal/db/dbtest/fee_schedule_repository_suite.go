@@ -0,0 +1,180 @@
+package dbtest
+
+import (
+	"testing"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// FeeScheduleRepositoryFactory returns empty repositories sharing one database for a single test
+type FeeScheduleRepositoryFactory func(t *testing.T) (db.TransferRepositoryPort, db.FeeScheduleRepositoryPort)
+
+// RunFeeScheduleRepositorySuite runs the FeeScheduleRepositoryPort conformance tests
+func RunFeeScheduleRepositorySuite(t *testing.T, newRepos FeeScheduleRepositoryFactory) {
+	run := func(name string, test func(*testing.T, db.TransferRepositoryPort, db.FeeScheduleRepositoryPort)) {
+		t.Run(name, func(t *testing.T) {
+			transfers, fees := newRepos(t)
+			test(t, transfers, fees)
+		})
+	}
+	run("CreateAndGet", testFeeScheduleCreateAndGet)
+	run("OnePerClientAndType", testFeeScheduleOnePerClientAndType)
+	run("RejectsInvalid", testFeeScheduleRejectsInvalid)
+	run("Find", testFindFeeSchedule)
+	run("Delete", testDeleteFeeSchedule)
+}
+
+// newTieredFeeSchedule returns a tiered schedule for clientID charging 1 up to
+// 100 and 0.5% above
+func newTieredFeeSchedule(clientID string) model.FeeSchedule {
+	return model.FeeSchedule{
+		Name:     "tiered",
+		ClientID: clientID,
+		Kind:     model.FeeTiered,
+		MaxFee:   decimal.NewFromInt(20),
+		Tiers: []model.FeeTier{
+			{MinAmount: decimal.NewFromInt(100), Rate: decimal.RequireFromString("0.005")},
+			{MinAmount: decimal.Zero, Flat: decimal.NewFromInt(1)},
+		},
+	}
+}
+
+func testFeeScheduleCreateAndGet(t *testing.T, _ db.TransferRepositoryPort, repo db.FeeScheduleRepositoryPort) {
+	created, err := repo.CreateFeeSchedule(newTieredFeeSchedule("acme"))
+	require.NoError(t, err)
+	assert.Positive(t, created.ID)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	got, err := repo.GetFeeSchedule(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "tiered", got.Name)
+	assert.Equal(t, "acme", got.ClientID)
+	assert.Equal(t, model.FeeTiered, got.Kind)
+	assert.True(t, got.MaxFee.Equal(decimal.NewFromInt(20)), "got %s", got.MaxFee)
+	require.Len(t, got.Tiers, 2)
+	assert.True(t, got.Tiers[0].MinAmount.IsZero(), "tiers are in ascending order")
+	assert.True(t, got.Tiers[0].Flat.Equal(decimal.NewFromInt(1)), "got %s", got.Tiers[0].Flat)
+	assert.True(t, got.Tiers[1].Rate.Equal(decimal.RequireFromString("0.005")), "got %s", got.Tiers[1].Rate)
+
+	flat, err := repo.CreateFeeSchedule(model.FeeSchedule{Name: "flat", Kind: model.FeeFlat, Flat: decimal.RequireFromString("0.25")})
+	require.NoError(t, err)
+	assert.Greater(t, flat.ID, created.ID)
+	list, err := repo.ListFeeSchedules(10)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, created.ID, list[0].ID)
+	assert.Len(t, list[0].Tiers, 2)
+	assert.Equal(t, flat.ID, list[1].ID)
+	assert.Empty(t, list[1].Tiers)
+	list, err = repo.ListFeeSchedules(1)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	_, err = repo.GetFeeSchedule(999)
+	assert.ErrorIs(t, err, model.ErrFeeScheduleNotFound)
+}
+
+func testFeeScheduleOnePerClientAndType(t *testing.T, _ db.TransferRepositoryPort, repo db.FeeScheduleRepositoryPort) {
+	_, err := repo.CreateFeeSchedule(newTieredFeeSchedule("acme"))
+	require.NoError(t, err)
+	_, err = repo.CreateFeeSchedule(newTieredFeeSchedule("acme"))
+	assert.ErrorIs(t, err, model.ErrFeeScheduleExists)
+
+	_, err = repo.CreateFeeSchedule(newTieredFeeSchedule(""))
+	require.NoError(t, err)
+	_, err = repo.CreateFeeSchedule(newTieredFeeSchedule(""))
+	assert.ErrorIs(t, err, model.ErrFeeScheduleExists, "there is a single default schedule")
+
+	typed := newTieredFeeSchedule("acme")
+	typed.AccountType = model.AccountAsset
+	_, err = repo.CreateFeeSchedule(typed)
+	require.NoError(t, err, "the client can have a schedule per account type")
+	_, err = repo.CreateFeeSchedule(typed)
+	assert.ErrorIs(t, err, model.ErrFeeScheduleExists)
+}
+
+func testFeeScheduleRejectsInvalid(t *testing.T, _ db.TransferRepositoryPort, repo db.FeeScheduleRepositoryPort) {
+	capped := newTieredFeeSchedule("acme")
+	capped.MinFee = decimal.NewFromInt(30)
+	_, err := repo.CreateFeeSchedule(capped)
+	assert.ErrorIs(t, err, model.ErrInvalidFeeSchedule, "the max fee is below the min fee")
+
+	duplicate := newTieredFeeSchedule("acme")
+	duplicate.Tiers[0].MinAmount = decimal.Zero
+	_, err = repo.CreateFeeSchedule(duplicate)
+	assert.ErrorIs(t, err, model.ErrInvalidFeeSchedule, "two tiers start at the same amount")
+
+	typed := newTieredFeeSchedule("acme")
+	typed.AccountType = "savings"
+	_, err = repo.CreateFeeSchedule(typed)
+	assert.ErrorIs(t, err, model.ErrInvalidFeeSchedule, "the account type is unknown")
+
+	_, err = repo.CreateFeeSchedule(newTieredFeeSchedule("acme"))
+	require.NoError(t, err, "rejected schedules are not stored")
+}
+
+func testFindFeeSchedule(t *testing.T, _ db.TransferRepositoryPort, repo db.FeeScheduleRepositoryPort) {
+	_, err := repo.FindFeeSchedule("acme", model.AccountLiability)
+	assert.ErrorIs(t, err, model.ErrFeeScheduleNotFound)
+
+	fallback, err := repo.CreateFeeSchedule(model.FeeSchedule{Name: "default", Kind: model.FeeFlat, Flat: decimal.NewFromInt(1)})
+	require.NoError(t, err)
+	own, err := repo.CreateFeeSchedule(newTieredFeeSchedule("acme"))
+	require.NoError(t, err)
+	assets := model.FeeSchedule{Name: "assets", AccountType: model.AccountAsset, Kind: model.FeeFlat, Flat: decimal.NewFromInt(2)}
+	typedFallback, err := repo.CreateFeeSchedule(assets)
+	require.NoError(t, err)
+	assets.ClientID = "acme"
+	ownTyped, err := repo.CreateFeeSchedule(assets)
+	require.NoError(t, err)
+
+	find := func(clientID string, accountType model.AccountType) int64 {
+		t.Helper()
+		found, err := repo.FindFeeSchedule(clientID, accountType)
+		require.NoError(t, err)
+		return found.ID
+	}
+	assert.Equal(t, own.ID, find("acme", model.AccountLiability))
+	assert.Equal(t, ownTyped.ID, find("acme", model.AccountAsset), "the schedule of the type is preferred")
+	assert.Equal(t, fallback.ID, find("globex", model.AccountLiability), "clients without a schedule get the default one")
+	assert.Equal(t, typedFallback.ID, find("globex", model.AccountAsset))
+	assert.Equal(t, fallback.ID, find("", ""))
+
+	found, err := repo.FindFeeSchedule("acme", model.AccountLiability)
+	require.NoError(t, err)
+	assert.Len(t, found.Tiers, 2)
+	found, err = repo.GetFeeSchedule(ownTyped.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.AccountAsset, found.AccountType)
+}
+
+func testDeleteFeeSchedule(t *testing.T, transfers db.TransferRepositoryPort, repo db.FeeScheduleRepositoryPort) {
+	schedule, err := repo.CreateFeeSchedule(newTieredFeeSchedule("acme"))
+	require.NoError(t, err)
+	charged, err := transfers.CreateTransfer(model.Transfer{
+		SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(10),
+		Fee: &model.Fee{ScheduleID: schedule.ID, AccountID: 3, Amount: decimal.NewFromInt(1), Mode: model.FeeOnTop},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteFeeSchedule(schedule.ID))
+	_, err = repo.GetFeeSchedule(schedule.ID)
+	assert.ErrorIs(t, err, model.ErrFeeScheduleNotFound)
+	assert.ErrorIs(t, repo.DeleteFeeSchedule(schedule.ID), model.ErrFeeScheduleNotFound)
+	_, err = repo.FindFeeSchedule("acme", model.AccountLiability)
+	assert.ErrorIs(t, err, model.ErrFeeScheduleNotFound)
+
+	got, err := transfers.GetTransfer(charged.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.Fee, "charged fees are kept")
+	assert.Zero(t, got.Fee.ScheduleID)
+	assert.True(t, got.Fee.Amount.Equal(decimal.NewFromInt(1)), "got %s", got.Fee.Amount)
+
+	_, err = repo.CreateFeeSchedule(newTieredFeeSchedule("acme"))
+	require.NoError(t, err, "the client can get a new schedule")
+}
@@ -0,0 +1,383 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// InterestRepositoryFactory returns empty repositories sharing one database for a single test
+type InterestRepositoryFactory func(t *testing.T) (db.AccountRepositoryPort, db.InterestRepositoryPort)
+
+// RunInterestRepositorySuite runs the InterestRepositoryPort conformance tests
+func RunInterestRepositorySuite(t *testing.T, newRepos InterestRepositoryFactory) {
+	run := func(name string, test func(*testing.T, db.AccountRepositoryPort, db.InterestRepositoryPort)) {
+		t.Run(name, func(t *testing.T) {
+			accounts, interest := newRepos(t)
+			test(t, accounts, interest)
+		})
+	}
+	run("Products", testInterestProducts)
+	run("RejectsInvalidProduct", testInterestRejectsInvalidProduct)
+	run("SetAccountInterest", testSetAccountInterest)
+	run("Accrue", testAccrueInterest)
+	run("BalanceSnapshots", testInterestBalanceSnapshots)
+	run("DuePostings", testDueInterestPostings)
+	run("Postings", testInterestPostings)
+	run("LockIsExclusive", testLockAccountInterest)
+}
+
+// interestStart is the first accrual day of the accounts of the suite
+var interestStart = time.Date(2026, 1, 30, 0, 0, 0, 0, time.UTC)
+
+// newInterestProduct returns a compound product paying 1% up to 1000 and 2% above
+func newInterestProduct() model.InterestProduct {
+	return model.InterestProduct{
+		Name:     "savings",
+		Method:   model.InterestCompound,
+		DayCount: 365,
+		Tiers: []model.InterestTier{
+			{MinBalance: decimal.NewFromInt(1000), Rate: decimal.RequireFromString("0.02")},
+			{MinBalance: decimal.Zero, Rate: decimal.RequireFromString("0.01")},
+		},
+	}
+}
+
+// setUpInterest creates account 1 accruing a new product from interestStart
+func setUpInterest(t *testing.T, accounts db.AccountRepositoryPort, repo db.InterestRepositoryPort) model.InterestProduct {
+	t.Helper()
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+	product, err := repo.CreateInterestProduct(newInterestProduct())
+	require.NoError(t, err)
+	_, err = repo.SetAccountInterest(1, product.ID, interestStart)
+	require.NoError(t, err)
+	return product
+}
+
+// accrue stores the accrual of account 1 for day
+func accrue(t *testing.T, repo db.InterestRepositoryPort, productID int64, day time.Time, amount string) {
+	t.Helper()
+	require.NoError(t, repo.AccrueInterest(model.InterestAccrual{
+		AccountID: 1, Day: day, ProductID: productID,
+		Base: decimal.NewFromInt(100), Amount: decimal.RequireFromString(amount),
+	}))
+}
+
+func testInterestProducts(t *testing.T, _ db.AccountRepositoryPort, repo db.InterestRepositoryPort) {
+	created, err := repo.CreateInterestProduct(newInterestProduct())
+	require.NoError(t, err)
+	assert.Positive(t, created.ID)
+	assert.False(t, created.CreatedAt.IsZero())
+	simple := newInterestProduct()
+	simple.Method = model.InterestSimple
+	simple.DayCount = 360
+	second, err := repo.CreateInterestProduct(simple)
+	require.NoError(t, err)
+
+	got, err := repo.GetInterestProduct(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "savings", got.Name)
+	assert.Equal(t, model.InterestCompound, got.Method)
+	assert.Equal(t, 365, got.DayCount)
+	require.Len(t, got.Tiers, 2)
+	assert.True(t, got.Tiers[0].MinBalance.IsZero(), "tiers in ascending order")
+	assert.True(t, got.Tiers[0].Rate.Equal(decimal.RequireFromString("0.01")))
+	assert.True(t, got.Tiers[1].MinBalance.Equal(decimal.NewFromInt(1000)))
+
+	_, err = repo.GetInterestProduct(second.ID + 1)
+	assert.ErrorIs(t, err, model.ErrInterestProductNotFound)
+
+	all, err := repo.ListInterestProducts(10)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, created.ID, all[0].ID)
+	assert.Len(t, all[0].Tiers, 2)
+	assert.Equal(t, second.ID, all[1].ID)
+	assert.Equal(t, model.InterestSimple, all[1].Method)
+
+	limited, err := repo.ListInterestProducts(1)
+	require.NoError(t, err)
+	assert.Len(t, limited, 1)
+}
+
+func testInterestRejectsInvalidProduct(t *testing.T, _ db.AccountRepositoryPort, repo db.InterestRepositoryPort) {
+	method := newInterestProduct()
+	method.Method = "continuous"
+	dayCount := newInterestProduct()
+	dayCount.DayCount = 366
+	negative := newInterestProduct()
+	negative.Tiers[0].Rate = decimal.NewFromInt(-1)
+	duplicate := newInterestProduct()
+	duplicate.Tiers[0].MinBalance = decimal.Zero
+
+	for name, p := range map[string]model.InterestProduct{
+		"method":         method,
+		"day count":      dayCount,
+		"negative rate":  negative,
+		"duplicate tier": duplicate,
+	} {
+		_, err := repo.CreateInterestProduct(p)
+		assert.ErrorIs(t, err, model.ErrInvalidInterestProduct, name)
+	}
+	products, err := repo.ListInterestProducts(10)
+	require.NoError(t, err)
+	assert.Empty(t, products)
+}
+
+func testSetAccountInterest(t *testing.T, accounts db.AccountRepositoryPort, repo db.InterestRepositoryPort) {
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+	product, err := repo.CreateInterestProduct(newInterestProduct())
+	require.NoError(t, err)
+	other, err := repo.CreateInterestProduct(newInterestProduct())
+	require.NoError(t, err)
+
+	_, err = repo.GetAccountInterest(1)
+	assert.ErrorIs(t, err, model.ErrInterestNotAssigned)
+
+	ai, err := repo.SetAccountInterest(1, product.ID, interestStart)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), ai.AccountID)
+	assert.Equal(t, product.ID, ai.ProductID)
+	assert.True(t, ai.NextAccrualDay.Equal(interestStart), "got %v", ai.NextAccrualDay)
+	assert.True(t, ai.Accrued.IsZero())
+
+	// Changing products keeps the next accrual day
+	ai, err = repo.SetAccountInterest(1, other.ID, interestStart.AddDate(0, 0, 5))
+	require.NoError(t, err)
+	assert.Equal(t, other.ID, ai.ProductID)
+	assert.True(t, ai.NextAccrualDay.Equal(interestStart))
+
+	// Stopping keeps the account, and resuming starts from the given day
+	ai, err = repo.SetAccountInterest(1, 0, interestStart.AddDate(0, 0, 5))
+	require.NoError(t, err)
+	assert.Zero(t, ai.ProductID)
+	ai, err = repo.SetAccountInterest(1, product.ID, interestStart.AddDate(0, 0, 5))
+	require.NoError(t, err)
+	assert.True(t, ai.NextAccrualDay.Equal(interestStart.AddDate(0, 0, 5)))
+
+	got, err := repo.GetAccountInterest(1)
+	require.NoError(t, err)
+	assert.Equal(t, product.ID, got.ProductID)
+	assert.True(t, got.NextAccrualDay.Equal(ai.NextAccrualDay))
+
+	_, err = repo.SetAccountInterest(1, other.ID+1, interestStart)
+	assert.ErrorIs(t, err, model.ErrInterestProductNotFound)
+	_, err = repo.SetAccountInterest(2, product.ID, interestStart)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+}
+
+func testAccrueInterest(t *testing.T, accounts db.AccountRepositoryPort, repo db.InterestRepositoryPort) {
+	product := setUpInterest(t, accounts, repo)
+	require.NoError(t, accounts.CreateAccount(2, decimal.NewFromInt(100)))
+	_, err := repo.SetAccountInterest(2, product.ID, interestStart.AddDate(0, 0, -1))
+	require.NoError(t, err)
+
+	due, err := repo.DueAccruals(interestStart, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 1}, due, "earliest accrual day first")
+	due, err = repo.DueAccruals(interestStart.AddDate(0, 0, -1), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, due)
+
+	accrue(t, repo, product.ID, interestStart, "0.00273972602739726027")
+	accrue(t, repo, product.ID, interestStart.AddDate(0, 0, 1), "0.00273973353276393318")
+
+	ai, err := repo.GetAccountInterest(1)
+	require.NoError(t, err)
+	assert.True(t, ai.NextAccrualDay.Equal(interestStart.AddDate(0, 0, 2)))
+	assert.True(t, ai.Accrued.Equal(decimal.RequireFromString("0.00547945956016119345")), "got %s", ai.Accrued)
+	due, err = repo.DueAccruals(interestStart.AddDate(0, 0, 1), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, due)
+
+	// A day that is not the next accrual day is rejected
+	err = repo.AccrueInterest(model.InterestAccrual{
+		AccountID: 1, Day: interestStart, ProductID: product.ID, Base: decimal.NewFromInt(100), Amount: decimal.NewFromInt(1),
+	})
+	assert.ErrorIs(t, err, db.ErrAccrualConflict)
+	err = repo.AccrueInterest(model.InterestAccrual{
+		AccountID: 1, Day: interestStart.AddDate(0, 0, 2), ProductID: product.ID + 1, Base: decimal.NewFromInt(100), Amount: decimal.NewFromInt(1),
+	})
+	assert.ErrorIs(t, err, db.ErrAccrualConflict)
+
+	accruals, err := repo.ListInterestAccruals(1, 10)
+	require.NoError(t, err)
+	require.Len(t, accruals, 2)
+	assert.True(t, accruals[0].Day.Equal(interestStart.AddDate(0, 0, 1)), "most recent first")
+	assert.True(t, accruals[0].Amount.Equal(decimal.RequireFromString("0.00273973353276393318")), "got %s", accruals[0].Amount)
+	assert.True(t, accruals[0].Base.Equal(decimal.NewFromInt(100)))
+	assert.Equal(t, product.ID, accruals[0].ProductID)
+	assert.Zero(t, accruals[0].PostingID)
+
+	limited, err := repo.ListInterestAccruals(1, 1)
+	require.NoError(t, err)
+	assert.Len(t, limited, 1)
+}
+
+func testInterestBalanceSnapshots(t *testing.T, accounts db.AccountRepositoryPort, repo db.InterestRepositoryPort) {
+	product := setUpInterest(t, accounts, repo)
+	require.NoError(t, accounts.CreateAccount(2, decimal.NewFromInt(50)))
+	nextDay := interestStart.AddDate(0, 0, 1)
+
+	n, err := repo.SnapshotBalances(interestStart)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "only accounts with a product are recorded")
+
+	// A later run of the same day replaces its snapshot
+	tx, err := accounts.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, accounts.UpdateAccountBalance(tx, 1, decimal.NewFromInt(20)))
+	require.NoError(t, tx.Commit())
+	_, err = repo.SnapshotBalances(interestStart)
+	require.NoError(t, err)
+	_, err = repo.SnapshotBalances(nextDay)
+	require.NoError(t, err)
+
+	snapshots, err := repo.BalanceSnapshots(1, interestStart, nextDay)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.True(t, snapshots[0].Day.Equal(interestStart), "oldest first")
+	assert.True(t, snapshots[0].Balance.Equal(decimal.NewFromInt(120)), "got %s", snapshots[0].Balance)
+	assert.True(t, snapshots[1].Day.Equal(nextDay))
+
+	// Accruing a day drops the snapshots before it
+	accrue(t, repo, product.ID, interestStart, "0.1")
+	accrue(t, repo, product.ID, nextDay, "0.1")
+	snapshots, err = repo.BalanceSnapshots(1, interestStart, nextDay)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	assert.True(t, snapshots[0].Day.Equal(nextDay))
+
+	snapshots, err = repo.BalanceSnapshots(2, interestStart, nextDay)
+	require.NoError(t, err)
+	assert.Empty(t, snapshots)
+}
+
+func testDueInterestPostings(t *testing.T, accounts db.AccountRepositoryPort, repo db.InterestRepositoryPort) {
+	product := setUpInterest(t, accounts, repo)
+	periodEnd := interestStart.AddDate(0, 0, 1)
+
+	accrue(t, repo, product.ID, interestStart, "0.1")
+	due, err := repo.DuePostings(periodEnd, 10)
+	require.NoError(t, err)
+	assert.Empty(t, due, "the account has not accrued through the period")
+
+	accrue(t, repo, product.ID, periodEnd, "0.1")
+	due, err = repo.DuePostings(periodEnd, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, due)
+
+	// An account that stopped accruing is posted what it accrued
+	_, err = repo.SetAccountInterest(1, 0, interestStart)
+	require.NoError(t, err)
+	due, err = repo.DuePostings(periodEnd.AddDate(0, 0, 5), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, due)
+
+	_, err = repo.StartInterestPosting(nil, 1, interestStart, periodEnd)
+	require.NoError(t, err)
+	due, err = repo.DuePostings(periodEnd, 10)
+	require.NoError(t, err)
+	assert.Empty(t, due, "the period has a posting")
+}
+
+func testInterestPostings(t *testing.T, accounts db.AccountRepositoryPort, repo db.InterestRepositoryPort) {
+	product := setUpInterest(t, accounts, repo)
+	for i, amount := range []string{"0.004", "0.004", "0.004", "0.004"} {
+		accrue(t, repo, product.ID, interestStart.AddDate(0, 0, i), amount)
+	}
+	januaryEnd := interestStart.AddDate(0, 0, 1)
+	januaryStart := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// A rolled back posting releases its accruals
+	tx, err := accounts.BeginTx()
+	require.NoError(t, err)
+	rolledBack, err := repo.StartInterestPosting(tx, 1, januaryStart, januaryEnd)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferProcessing, rolledBack.Status)
+	assert.True(t, rolledBack.Accrued.Equal(decimal.RequireFromString("0.008")), "got %s", rolledBack.Accrued)
+	require.NoError(t, repo.FinishInterestPosting(tx, rolledBack.ID, model.TransferCompleted, "", decimal.Zero, rolledBack.Accrued))
+	require.NoError(t, tx.Rollback())
+	ai, err := repo.GetAccountInterest(1)
+	require.NoError(t, err)
+	assert.True(t, ai.Accrued.Equal(decimal.RequireFromString("0.016")), "got %s", ai.Accrued)
+	assert.True(t, ai.Residual.IsZero(), "got %s", ai.Residual)
+
+	// A failed posting also releases its accruals to the next one
+	failed, err := repo.StartInterestPosting(nil, 1, januaryStart, januaryEnd)
+	require.NoError(t, err)
+	_, err = repo.StartInterestPosting(nil, 1, januaryStart, januaryEnd)
+	assert.ErrorIs(t, err, db.ErrPostingExists)
+	require.NoError(t, repo.FinishInterestPosting(nil, failed.ID, model.TransferFailed, "insufficient_funds", decimal.Zero, decimal.Zero))
+	// A finished posting keeps its outcome
+	require.NoError(t, repo.FinishInterestPosting(nil, failed.ID, model.TransferCompleted, "", decimal.Zero, decimal.Zero))
+
+	februaryEnd := interestStart.AddDate(0, 0, 3)
+	posting, err := repo.StartInterestPosting(nil, 1, januaryEnd.AddDate(0, 0, 1), februaryEnd)
+	require.NoError(t, err)
+	assert.True(t, posting.Accrued.Equal(decimal.RequireFromString("0.016")), "got %s", posting.Accrued)
+	assert.True(t, posting.CarriedResidual.IsZero())
+	require.NoError(t, repo.FinishInterestPosting(nil, posting.ID, model.TransferCompleted, "",
+		decimal.RequireFromString("0.01"), decimal.RequireFromString("0.006")))
+
+	ai, err = repo.GetAccountInterest(1)
+	require.NoError(t, err)
+	assert.True(t, ai.Accrued.IsZero(), "got %s", ai.Accrued)
+	assert.True(t, ai.Residual.Equal(decimal.RequireFromString("0.006")), "got %s", ai.Residual)
+
+	accruals, err := repo.ListInterestAccruals(1, 10)
+	require.NoError(t, err)
+	for _, a := range accruals {
+		assert.Equal(t, posting.ID, a.PostingID)
+	}
+
+	postings, err := repo.ListInterestPostings(1, 10)
+	require.NoError(t, err)
+	require.Len(t, postings, 2)
+	assert.Equal(t, posting.ID, postings[0].ID, "most recent first")
+	assert.Equal(t, model.TransferCompleted, postings[0].Status)
+	assert.True(t, postings[0].Amount.Equal(decimal.RequireFromString("0.01")))
+	assert.True(t, postings[0].Residual.Equal(decimal.RequireFromString("0.006")))
+	assert.True(t, postings[0].PeriodEnd.Equal(februaryEnd))
+	assert.NotNil(t, postings[0].FinishedAt)
+	assert.Equal(t, failed.ID, postings[1].ID)
+	assert.Equal(t, model.TransferFailed, postings[1].Status)
+	assert.Equal(t, "insufficient_funds", postings[1].ErrorCode)
+	assert.True(t, postings[1].PeriodStart.Equal(januaryStart))
+
+	// The next posting carries the residual
+	accrue(t, repo, product.ID, februaryEnd.AddDate(0, 0, 1), "0.001")
+	next, err := repo.StartInterestPosting(nil, 1, februaryEnd.AddDate(0, 0, 1), februaryEnd.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.True(t, next.CarriedResidual.Equal(decimal.RequireFromString("0.006")), "got %s", next.CarriedResidual)
+
+	_, err = repo.StartInterestPosting(nil, 2, januaryStart, januaryEnd)
+	assert.ErrorIs(t, err, model.ErrInterestNotAssigned)
+}
+
+func testLockAccountInterest(t *testing.T, _ db.AccountRepositoryPort, repo db.InterestRepositoryPort) {
+	unlock, locked, err := repo.LockAccountInterest(1)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	_, locked, err = repo.LockAccountInterest(1)
+	require.NoError(t, err)
+	assert.False(t, locked, "a locked account must not be locked again")
+
+	unlockOther, locked, err := repo.LockAccountInterest(2)
+	require.NoError(t, err)
+	require.True(t, locked, "locks are per account")
+	unlockOther()
+
+	unlock()
+	unlock, locked, err = repo.LockAccountInterest(1)
+	require.NoError(t, err)
+	require.True(t, locked)
+	unlock()
+}
@@ -0,0 +1,287 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// StandingOrderRepositoryFactory returns empty repositories sharing one database for a single test
+type StandingOrderRepositoryFactory func(t *testing.T) (db.AccountRepositoryPort, db.StandingOrderRepositoryPort)
+
+// RunStandingOrderRepositorySuite runs the StandingOrderRepositoryPort conformance tests
+func RunStandingOrderRepositorySuite(t *testing.T, newRepos StandingOrderRepositoryFactory) {
+	run := func(name string, test func(*testing.T, db.StandingOrderRepositoryPort)) {
+		t.Run(name, func(t *testing.T) {
+			_, orders := newRepos(t)
+			test(t, orders)
+		})
+	}
+	run("CreateAndGet", testStandingOrderCreateAndGet)
+	run("List", testListStandingOrders)
+	run("Cancel", testCancelStandingOrder)
+	run("DueInOrder", testDueStandingOrders)
+	run("LockIsExclusive", testLockStandingOrder)
+	run("OccurrenceStartsOnce", testOccurrenceStartsOnce)
+	run("FinishAdvances", testFinishOccurrenceAdvances)
+	run("FinishAfterCancel", testFinishOccurrenceAfterCancel)
+	t.Run("OccurrenceWithinTransaction", func(t *testing.T) {
+		accounts, orders := newRepos(t)
+		testOccurrenceWithinTransaction(t, accounts, orders)
+	})
+}
+
+// orderStart is the start of the standing orders created by the suite
+var orderStart = time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+// newStandingOrder returns a daily order of 1 from account 1 to 2, next due at nextRunAt
+func newStandingOrder(nextRunAt time.Time) model.StandingOrder {
+	return model.StandingOrder{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               decimal.NewFromInt(1),
+		Schedule:             "daily",
+		StartAt:              orderStart,
+		BusinessDayRule:      "none",
+		NextOccurrenceAt:     &nextRunAt,
+		NextRunAt:            &nextRunAt,
+	}
+}
+
+func createStandingOrder(t *testing.T, repo db.StandingOrderRepositoryPort, order model.StandingOrder) model.StandingOrder {
+	t.Helper()
+	created, err := repo.CreateStandingOrder(order)
+	require.NoError(t, err)
+	return created
+}
+
+func testStandingOrderCreateAndGet(t *testing.T, repo db.StandingOrderRepositoryPort) {
+	end := orderStart.AddDate(0, 6, 0)
+	order := newStandingOrder(orderStart)
+	order.Amount = decimal.RequireFromString("12.5")
+	order.Schedule = "monthly:5"
+	order.EndAt = &end
+	order.MaxOccurrences = 3
+	order.BusinessDayRule = "preceding"
+	runAt := orderStart.Add(-time.Hour)
+	order.NextRunAt = &runAt
+	created := createStandingOrder(t, repo, order)
+	assert.Positive(t, created.ID)
+	assert.Equal(t, model.StandingOrderActive, created.Status)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	got, err := repo.GetStandingOrder(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, got.ID)
+	assert.Equal(t, int64(1), got.SourceAccountID)
+	assert.Equal(t, int64(2), got.DestinationAccountID)
+	assert.True(t, got.Amount.Equal(decimal.RequireFromString("12.5")), "got %s", got.Amount)
+	assert.Equal(t, "monthly:5", got.Schedule)
+	assert.True(t, got.StartAt.Equal(orderStart))
+	require.NotNil(t, got.EndAt)
+	assert.True(t, got.EndAt.Equal(end))
+	assert.Equal(t, 3, got.MaxOccurrences)
+	assert.Zero(t, got.Occurrences)
+	assert.Equal(t, "preceding", got.BusinessDayRule)
+	require.NotNil(t, got.NextOccurrenceAt)
+	assert.True(t, got.NextOccurrenceAt.Equal(orderStart))
+	require.NotNil(t, got.NextRunAt)
+	assert.True(t, got.NextRunAt.Equal(runAt))
+
+	_, err = repo.GetStandingOrder(created.ID + 1)
+	assert.ErrorIs(t, err, model.ErrStandingOrderNotFound)
+}
+
+func testListStandingOrders(t *testing.T, repo db.StandingOrderRepositoryPort) {
+	first := createStandingOrder(t, repo, newStandingOrder(orderStart))
+	second := createStandingOrder(t, repo, newStandingOrder(orderStart))
+	third := createStandingOrder(t, repo, newStandingOrder(orderStart))
+	_, err := repo.CancelStandingOrder(second.ID)
+	require.NoError(t, err)
+
+	all, err := repo.ListStandingOrders("", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, second.ID, third.ID}, standingOrderIDs(all))
+
+	active, err := repo.ListStandingOrders(model.StandingOrderActive, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, third.ID}, standingOrderIDs(active))
+
+	limited, err := repo.ListStandingOrders("", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID}, standingOrderIDs(limited))
+}
+
+func testCancelStandingOrder(t *testing.T, repo db.StandingOrderRepositoryPort) {
+	order := createStandingOrder(t, repo, newStandingOrder(orderStart))
+
+	cancelled, err := repo.CancelStandingOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StandingOrderCancelled, cancelled.Status)
+	assert.Nil(t, cancelled.NextOccurrenceAt)
+	assert.Nil(t, cancelled.NextRunAt)
+
+	_, err = repo.CancelStandingOrder(order.ID)
+	assert.ErrorIs(t, err, model.ErrStandingOrderNotActive)
+	_, err = repo.CancelStandingOrder(order.ID + 1)
+	assert.ErrorIs(t, err, model.ErrStandingOrderNotFound)
+
+	due, err := repo.DueStandingOrders(orderStart.AddDate(1, 0, 0), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+func testDueStandingOrders(t *testing.T, repo db.StandingOrderRepositoryPort) {
+	later := createStandingOrder(t, repo, newStandingOrder(orderStart.Add(time.Hour)))
+	earlier := createStandingOrder(t, repo, newStandingOrder(orderStart))
+	createStandingOrder(t, repo, newStandingOrder(orderStart.Add(3*time.Hour)))
+
+	due, err := repo.DueStandingOrders(orderStart.Add(2*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{earlier.ID, later.ID}, due)
+
+	due, err = repo.DueStandingOrders(orderStart.Add(2*time.Hour), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{earlier.ID}, due)
+
+	due, err = repo.DueStandingOrders(orderStart.Add(-time.Second), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+func testLockStandingOrder(t *testing.T, repo db.StandingOrderRepositoryPort) {
+	order := createStandingOrder(t, repo, newStandingOrder(orderStart))
+	other := createStandingOrder(t, repo, newStandingOrder(orderStart))
+
+	unlock, locked, err := repo.LockStandingOrder(order.ID)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	_, locked, err = repo.LockStandingOrder(order.ID)
+	require.NoError(t, err)
+	assert.False(t, locked, "a locked standing order must not be locked again")
+
+	unlockOther, locked, err := repo.LockStandingOrder(other.ID)
+	require.NoError(t, err)
+	require.True(t, locked, "locks are per standing order")
+	unlockOther()
+
+	unlock()
+	unlock, locked, err = repo.LockStandingOrder(order.ID)
+	require.NoError(t, err)
+	require.True(t, locked)
+	unlock()
+}
+
+func testOccurrenceStartsOnce(t *testing.T, repo db.StandingOrderRepositoryPort) {
+	order := createStandingOrder(t, repo, newStandingOrder(orderStart))
+
+	require.NoError(t, repo.StartOccurrence(nil, order.ID, orderStart))
+	assert.ErrorIs(t, repo.StartOccurrence(nil, order.ID, orderStart), db.ErrOccurrenceExists)
+	require.NoError(t, repo.StartOccurrence(nil, order.ID, orderStart.AddDate(0, 0, 1)))
+
+	occurrences, err := repo.ListOccurrences(order.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, occurrences, 2)
+	assert.True(t, occurrences[0].ScheduledFor.Equal(orderStart.AddDate(0, 0, 1)), "most recent first")
+	assert.Equal(t, model.TransferProcessing, occurrences[1].Status)
+	assert.Nil(t, occurrences[1].FinishedAt)
+}
+
+func testFinishOccurrenceAdvances(t *testing.T, repo db.StandingOrderRepositoryPort) {
+	order := createStandingOrder(t, repo, newStandingOrder(orderStart))
+	next := orderStart.AddDate(0, 0, 1)
+	nextRunAt := next.AddDate(0, 0, 2)
+
+	require.NoError(t, repo.StartOccurrence(nil, order.ID, orderStart))
+	require.NoError(t, repo.FinishOccurrence(nil, order.ID, orderStart, model.TransferCompleted, "", &next, &nextRunAt))
+	got, err := repo.GetStandingOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Occurrences)
+	assert.Equal(t, model.StandingOrderActive, got.Status)
+	require.NotNil(t, got.NextOccurrenceAt)
+	assert.True(t, got.NextOccurrenceAt.Equal(next))
+	require.NotNil(t, got.NextRunAt)
+	assert.True(t, got.NextRunAt.Equal(nextRunAt))
+
+	// Finishing the same occurrence again does not count it twice
+	assert.Error(t, repo.FinishOccurrence(nil, order.ID, orderStart, model.TransferCompleted, "", &next, &nextRunAt))
+
+	// The occurrence, not its adjusted run time, identifies it
+	require.NoError(t, repo.StartOccurrence(nil, order.ID, next))
+	require.NoError(t, repo.FinishOccurrence(nil, order.ID, next, model.TransferFailed, "insufficient_funds", nil, nil))
+	got, err = repo.GetStandingOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Occurrences)
+	assert.Equal(t, model.StandingOrderCompleted, got.Status)
+	assert.Nil(t, got.NextOccurrenceAt)
+	assert.Nil(t, got.NextRunAt)
+
+	occurrences, err := repo.ListOccurrences(order.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, occurrences, 2)
+	assert.Equal(t, model.TransferFailed, occurrences[0].Status)
+	assert.Equal(t, "insufficient_funds", occurrences[0].ErrorCode)
+	assert.NotNil(t, occurrences[0].FinishedAt)
+	assert.Equal(t, model.TransferCompleted, occurrences[1].Status)
+	assert.Empty(t, occurrences[1].ErrorCode)
+}
+
+func testFinishOccurrenceAfterCancel(t *testing.T, repo db.StandingOrderRepositoryPort) {
+	order := createStandingOrder(t, repo, newStandingOrder(orderStart))
+	next := orderStart.AddDate(0, 0, 1)
+
+	require.NoError(t, repo.StartOccurrence(nil, order.ID, orderStart))
+	_, err := repo.CancelStandingOrder(order.ID)
+	require.NoError(t, err)
+	require.NoError(t, repo.FinishOccurrence(nil, order.ID, orderStart, model.TransferCompleted, "", &next, &next))
+
+	got, err := repo.GetStandingOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StandingOrderCancelled, got.Status)
+	assert.Equal(t, 1, got.Occurrences)
+	assert.Nil(t, got.NextRunAt)
+}
+
+func standingOrderIDs(orders []model.StandingOrder) []int64 {
+	ids := make([]int64, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+	return ids
+}
+
+func testOccurrenceWithinTransaction(t *testing.T, accounts db.AccountRepositoryPort, repo db.StandingOrderRepositoryPort) {
+	order := createStandingOrder(t, repo, newStandingOrder(orderStart))
+	next := orderStart.AddDate(0, 0, 1)
+	runOccurrence := func() db.TransactionPort {
+		tx, err := accounts.BeginTx()
+		require.NoError(t, err)
+		require.NoError(t, repo.StartOccurrence(tx, order.ID, orderStart))
+		require.NoError(t, repo.FinishOccurrence(tx, order.ID, orderStart, model.TransferCompleted, "", &next, &next))
+		return tx
+	}
+
+	// A rolled back occurrence leaves no trace, so it can run again
+	require.NoError(t, runOccurrence().Rollback())
+	occurrences, err := repo.ListOccurrences(order.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, occurrences)
+	got, err := repo.GetStandingOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, got.Occurrences)
+	assert.True(t, got.NextOccurrenceAt.Equal(orderStart))
+
+	require.NoError(t, runOccurrence().Commit())
+	got, err = repo.GetStandingOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Occurrences)
+	assert.True(t, got.NextOccurrenceAt.Equal(next))
+	assert.ErrorIs(t, repo.StartOccurrence(nil, order.ID, orderStart), db.ErrOccurrenceExists)
+}
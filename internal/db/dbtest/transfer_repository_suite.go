@@ -0,0 +1,583 @@
+package dbtest
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TransferRepositoryFactory returns empty repositories for a single test. The
+// account repository shares the store, so its transactions can finish transfers.
+type TransferRepositoryFactory func(t *testing.T) (db.AccountRepositoryPort, db.TransferRepositoryPort)
+
+// RunTransferRepositorySuite runs the TransferRepositoryPort conformance tests
+func RunTransferRepositorySuite(t *testing.T, newRepos TransferRepositoryFactory) {
+	run := func(name string, test func(*testing.T, db.AccountRepositoryPort, db.TransferRepositoryPort)) {
+		t.Run(name, func(t *testing.T) {
+			accounts, transfers := newRepos(t)
+			test(t, accounts, transfers)
+		})
+	}
+	run("CreateAndGet", testTransferCreateAndGet)
+	run("NotFound", testTransferNotFound)
+	run("ClaimInOrder", testClaimInOrder)
+	run("LeaseExpiry", testLeaseExpiry)
+	run("FinishInTransaction", testFinishInTransaction)
+	run("ConcurrentClaimsAreExclusive", testConcurrentClaimsAreExclusive)
+	run("ScheduledWaitsUntilDue", testScheduledWaitsUntilDue)
+	run("RetryScheduled", testRetryScheduled)
+	run("ListScheduled", testListScheduled)
+	run("CancelScheduled", testCancelScheduled)
+	run("Reversals", testReversals)
+	run("ReversalInTransaction", testReversalInTransaction)
+	run("Details", testTransferDetails)
+	run("Fee", testTransferFee)
+	run("ExternalReferenceUniquePerClient", testExternalReferenceUniquePerClient)
+	run("BookInTransaction", testBookInTransaction)
+	run("SplitLegs", testSplitLegs)
+	run("SweepLegs", testSweepLegs)
+}
+
+// requireStatus asserts the committed status of a transfer
+func requireStatus(t *testing.T, transfers db.TransferRepositoryPort, id int64, want model.TransferStatus) model.Transfer {
+	t.Helper()
+	transfer, err := transfers.GetTransfer(id)
+	require.NoError(t, err)
+	assert.Equal(t, want, transfer.Status, "transfer %d", id)
+	return transfer
+}
+
+// newTransfer returns a transfer of 1 from account 1 to 2, scheduled when executeAt is set
+func newTransfer(executeAt *time.Time) model.Transfer {
+	return model.Transfer{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(1), ExecuteAt: executeAt}
+}
+
+func transferIDs(transfers []model.Transfer) []int64 {
+	ids := make([]int64, len(transfers))
+	for i, transfer := range transfers {
+		ids[i] = transfer.ID
+	}
+	return ids
+}
+
+func testTransferCreateAndGet(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	created, err := transfers.CreateTransfer(model.Transfer{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.RequireFromString("10.5")})
+	require.NoError(t, err)
+	assert.Positive(t, created.ID)
+	assert.Equal(t, model.TransferPending, created.Status)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	got, err := transfers.GetTransfer(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, got.ID)
+	assert.Equal(t, int64(1), got.SourceAccountID)
+	assert.Equal(t, int64(2), got.DestinationAccountID)
+	assert.True(t, got.Amount.Equal(decimal.RequireFromString("10.5")), "got %s", got.Amount)
+	assert.Equal(t, model.TransferPending, got.Status)
+	assert.Empty(t, got.ErrorCode)
+	assert.Zero(t, got.Attempts)
+
+	next, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+	assert.Greater(t, next.ID, created.ID)
+}
+
+func testTransferNotFound(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	_, err := transfers.GetTransfer(999)
+	assert.ErrorIs(t, err, model.ErrTransferNotFound)
+}
+
+func testClaimInOrder(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		created, err := transfers.CreateTransfer(newTransfer(nil))
+		require.NoError(t, err)
+		ids = append(ids, created.ID)
+	}
+
+	claimed, err := transfers.ClaimTransfers(2, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, ids[:2], transferIDs(claimed))
+	for _, transfer := range claimed {
+		assert.Equal(t, model.TransferProcessing, transfer.Status)
+		assert.Equal(t, 1, transfer.Attempts)
+	}
+
+	claimed, err = transfers.ClaimTransfers(5, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, ids[2:], transferIDs(claimed))
+
+	// Processing transfers stay with their worker until the lease expires
+	claimed, err = transfers.ClaimTransfers(5, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+	requireStatus(t, transfers, ids[0], model.TransferProcessing)
+}
+
+func testLeaseExpiry(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	created, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+	_, err = transfers.ClaimTransfers(1, time.Minute)
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	claimed, err := transfers.ClaimTransfers(1, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, 2, claimed[0].Attempts)
+
+	// The first worker lost its claim and cannot record an outcome any more
+	err = transfers.FinishTransfer(nil, created.ID, 1, model.TransferCompleted, "")
+	assert.ErrorIs(t, err, db.ErrTransferClaimLost)
+	require.NoError(t, transfers.FinishTransfer(nil, created.ID, 2, model.TransferFailed, "insufficient_funds"))
+
+	finished := requireStatus(t, transfers, created.ID, model.TransferFailed)
+	assert.Equal(t, "insufficient_funds", finished.ErrorCode)
+
+	claimed, err = transfers.ClaimTransfers(1, 0)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "finished transfers are never claimed again")
+}
+
+func testFinishInTransaction(t *testing.T, accounts db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	created, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+	_, err = transfers.ClaimTransfers(1, time.Minute)
+	require.NoError(t, err)
+
+	tx, err := accounts.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, transfers.FinishTransfer(tx, created.ID, 1, model.TransferCompleted, ""))
+	requireStatus(t, transfers, created.ID, model.TransferProcessing)
+	require.NoError(t, tx.Rollback())
+	requireStatus(t, transfers, created.ID, model.TransferProcessing)
+
+	tx, err = accounts.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, transfers.FinishTransfer(tx, created.ID, 1, model.TransferCompleted, ""))
+	require.NoError(t, tx.Commit())
+	requireStatus(t, transfers, created.ID, model.TransferCompleted)
+
+	err = transfers.FinishTransfer(nil, created.ID, 1, model.TransferFailed, "insufficient_funds")
+	assert.ErrorIs(t, err, db.ErrTransferClaimLost)
+	requireStatus(t, transfers, created.ID, model.TransferCompleted)
+}
+
+func testConcurrentClaimsAreExclusive(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	const total, workers = 60, 6
+	for i := 0; i < total; i++ {
+		_, err := transfers.CreateTransfer(newTransfer(nil))
+		require.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int64]int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				claimed, err := transfers.ClaimTransfers(4, time.Minute)
+				if !assert.NoError(t, err) || len(claimed) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, transfer := range claimed {
+					seen[transfer.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, total)
+	for id, n := range seen {
+		assert.Equal(t, 1, n, "transfer %d claimed %d times", id, n)
+	}
+}
+
+func testScheduledWaitsUntilDue(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	later := time.Now().Add(time.Hour)
+	scheduled, err := transfers.CreateTransfer(newTransfer(&later))
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferScheduled, scheduled.Status)
+	require.NotNil(t, scheduled.ExecuteAt)
+	require.NotNil(t, scheduled.NextAttemptAt)
+	assert.WithinDuration(t, later, *scheduled.ExecuteAt, time.Millisecond)
+	assert.WithinDuration(t, later, *scheduled.NextAttemptAt, time.Millisecond)
+	assert.Nil(t, scheduled.RetryUntil)
+
+	claimed, err := transfers.ClaimTransfers(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "transfers are not claimed before they are due")
+
+	earlier := time.Now().Add(-time.Second)
+	due, err := transfers.CreateTransfer(newTransfer(&earlier))
+	require.NoError(t, err)
+	claimed, err = transfers.ClaimTransfers(10, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{due.ID}, transferIDs(claimed))
+
+	deadline := earlier.Add(-time.Minute)
+	invalid := newTransfer(&earlier)
+	invalid.RetryUntil = &deadline
+	_, err = transfers.CreateTransfer(invalid)
+	assert.ErrorIs(t, err, model.ErrRetryDeadlineBeforeExecution)
+}
+
+func testRetryScheduled(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	executeAt := time.Now().Add(-time.Second)
+	deadline := executeAt.Add(time.Hour)
+	transfer := newTransfer(&executeAt)
+	transfer.RetryUntil = &deadline
+	created, err := transfers.CreateTransfer(transfer)
+	require.NoError(t, err)
+	_, err = transfers.ClaimTransfers(1, time.Minute)
+	require.NoError(t, err)
+
+	next := time.Now().Add(30 * time.Minute)
+	require.NoError(t, transfers.RetryTransfer(created.ID, 1, next, "insufficient_funds"))
+	retried := requireStatus(t, transfers, created.ID, model.TransferScheduled)
+	assert.Equal(t, "insufficient_funds", retried.ErrorCode)
+	assert.Equal(t, 1, retried.Attempts)
+	require.NotNil(t, retried.NextAttemptAt)
+	assert.WithinDuration(t, next, *retried.NextAttemptAt, time.Millisecond)
+	assert.WithinDuration(t, executeAt, *retried.ExecuteAt, time.Millisecond, "the requested execution time is kept")
+
+	claimed, err := transfers.ClaimTransfers(1, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "a retried transfer waits for its next attempt")
+
+	err = transfers.RetryTransfer(created.ID, 1, next, "insufficient_funds")
+	assert.ErrorIs(t, err, db.ErrTransferClaimLost, "only processing transfers can be retried")
+}
+
+func testListScheduled(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	base := time.Now().Add(time.Hour)
+	var ids []int64
+	for i := 3; i > 0; i-- {
+		executeAt := base.Add(time.Duration(i) * time.Minute)
+		created, err := transfers.CreateTransfer(newTransfer(&executeAt))
+		require.NoError(t, err)
+		ids = append(ids, created.ID)
+	}
+	_, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+
+	listed, err := transfers.ListScheduledTransfers("", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[2], ids[1], ids[0]}, transferIDs(listed), "ordered by execution time, without unscheduled transfers")
+
+	listed, err = transfers.ListScheduledTransfers("", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[2], ids[1]}, transferIDs(listed))
+
+	_, err = transfers.CancelTransfer(ids[1])
+	require.NoError(t, err)
+	listed, err = transfers.ListScheduledTransfers(model.TransferCancelled, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[1]}, transferIDs(listed))
+	listed, err = transfers.ListScheduledTransfers(model.TransferScheduled, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[2], ids[0]}, transferIDs(listed))
+}
+
+func testCancelScheduled(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	now := time.Now().Add(-time.Second)
+	scheduled, err := transfers.CreateTransfer(newTransfer(&now))
+	require.NoError(t, err)
+	started, err := transfers.CreateTransfer(newTransfer(&now))
+	require.NoError(t, err)
+	pending, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+
+	cancelled, err := transfers.CancelTransfer(scheduled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferCancelled, cancelled.Status)
+	requireStatus(t, transfers, scheduled.ID, model.TransferCancelled)
+
+	_, err = transfers.CancelTransfer(scheduled.ID)
+	assert.ErrorIs(t, err, model.ErrTransferNotCancellable)
+	_, err = transfers.CancelTransfer(pending.ID)
+	assert.ErrorIs(t, err, model.ErrTransferNotFound, "transfers without an execution time are not scheduled")
+	_, err = transfers.CancelTransfer(999)
+	assert.ErrorIs(t, err, model.ErrTransferNotFound)
+
+	claimed, err := transfers.ClaimTransfers(10, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{started.ID, pending.ID}, transferIDs(claimed), "cancelled transfers are never claimed")
+	_, err = transfers.CancelTransfer(started.ID)
+	assert.ErrorIs(t, err, model.ErrTransferNotCancellable, "a transfer cannot be cancelled once it started")
+}
+
+// completedTransfer stores a transfer of amount from account 1 to 2 and completes it
+func completedTransfer(t *testing.T, transfers db.TransferRepositoryPort, amount string) model.Transfer {
+	t.Helper()
+	created, err := transfers.CreateTransfer(model.Transfer{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.RequireFromString(amount)})
+	require.NoError(t, err)
+	claimed, err := transfers.ClaimTransfers(1, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []int64{created.ID}, transferIDs(claimed))
+	require.NoError(t, transfers.FinishTransfer(nil, created.ID, 1, model.TransferCompleted, ""))
+	return requireStatus(t, transfers, created.ID, model.TransferCompleted)
+}
+
+func testReversals(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	original := completedTransfer(t, transfers, "10")
+
+	partial, err := transfers.CreateReversal(nil, original.ID, decimal.RequireFromString("4.5"), model.TransferCompleted, nil)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferCompleted, partial.Status)
+	assert.Equal(t, int64(2), partial.SourceAccountID, "a reversal moves funds back from the destination")
+	assert.Equal(t, int64(1), partial.DestinationAccountID)
+	assert.True(t, partial.Amount.Equal(decimal.RequireFromString("4.5")), "got %s", partial.Amount)
+	require.NotNil(t, partial.ReversalOf)
+	assert.Equal(t, original.ID, *partial.ReversalOf)
+	got := requireStatus(t, transfers, partial.ID, model.TransferCompleted)
+	assert.Equal(t, partial.ReversalOf, got.ReversalOf)
+
+	_, err = transfers.CreateReversal(nil, original.ID, decimal.RequireFromString("5.51"), model.TransferCompleted, nil)
+	assert.ErrorIs(t, err, model.ErrReversalExceedsOriginal)
+
+	// A pending reversal holds its amount until it fails
+	deadline := time.Now().Add(time.Hour)
+	rest, err := transfers.CreateReversal(nil, original.ID, decimal.Zero, model.TransferPending, &deadline)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferPending, rest.Status)
+	assert.True(t, rest.Amount.Equal(decimal.RequireFromString("5.5")), "a zero amount reverses the rest, got %s", rest.Amount)
+	require.NotNil(t, rest.RetryUntil)
+	assert.WithinDuration(t, deadline, *rest.RetryUntil, time.Millisecond)
+	_, err = transfers.CreateReversal(nil, original.ID, decimal.Zero, model.TransferCompleted, nil)
+	assert.ErrorIs(t, err, model.ErrReversalExceedsOriginal, "the transfer is fully reversed")
+
+	claimed, err := transfers.ClaimTransfers(1, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []int64{rest.ID}, transferIDs(claimed), "pending reversals are processed by the workers")
+	require.NoError(t, transfers.FinishTransfer(nil, rest.ID, 1, model.TransferFailed, "insufficient_funds"))
+	again, err := transfers.CreateReversal(nil, original.ID, decimal.Zero, model.TransferCompleted, nil)
+	require.NoError(t, err)
+	assert.True(t, again.Amount.Equal(decimal.RequireFromString("5.5")), "got %s", again.Amount)
+
+	reversals, err := transfers.ListReversals(original.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{partial.ID, rest.ID, again.ID}, transferIDs(reversals))
+	reversals, err = transfers.ListReversals(partial.ID)
+	require.NoError(t, err)
+	assert.Empty(t, reversals)
+
+	_, err = transfers.CreateReversal(nil, partial.ID, decimal.Zero, model.TransferCompleted, nil)
+	assert.ErrorIs(t, err, model.ErrTransferNotReversible, "reversals cannot be reversed")
+	pending, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+	_, err = transfers.CreateReversal(nil, pending.ID, decimal.Zero, model.TransferCompleted, nil)
+	assert.ErrorIs(t, err, model.ErrTransferNotReversible, "only completed transfers can be reversed")
+	_, err = transfers.CreateReversal(nil, 999, decimal.Zero, model.TransferCompleted, nil)
+	assert.ErrorIs(t, err, model.ErrTransferNotFound)
+}
+
+func testReversalInTransaction(t *testing.T, accounts db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	original := completedTransfer(t, transfers, "3")
+
+	tx, err := accounts.BeginTx()
+	require.NoError(t, err)
+	reversal, err := transfers.CreateReversal(tx, original.ID, decimal.Zero, model.TransferCompleted, nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+	_, err = transfers.GetTransfer(reversal.ID)
+	assert.ErrorIs(t, err, model.ErrTransferNotFound, "a rolled back reversal is not stored")
+
+	tx, err = accounts.BeginTx()
+	require.NoError(t, err)
+	reversal, err = transfers.CreateReversal(tx, original.ID, decimal.NewFromInt(3), model.TransferCompleted, nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	requireStatus(t, transfers, reversal.ID, model.TransferCompleted)
+}
+
+func testTransferDetails(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	transfer := newTransfer(nil)
+	transfer.TransferDetails = model.TransferDetails{
+		ClientID:          "billing",
+		Description:       "Invoice 2024-117",
+		ExternalReference: "pay_8f2a",
+		Metadata:          json.RawMessage(`{"invoice": "2024-117", "lines": [1, 2]}`),
+	}
+	created, err := transfers.CreateTransfer(transfer)
+	require.NoError(t, err)
+
+	got, err := transfers.GetTransfer(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "billing", got.ClientID)
+	assert.Equal(t, "Invoice 2024-117", got.Description)
+	assert.Equal(t, "pay_8f2a", got.ExternalReference)
+	assert.JSONEq(t, `{"invoice": "2024-117", "lines": [1, 2]}`, string(got.Metadata))
+
+	found, err := transfers.GetTransferByReference("billing", "pay_8f2a")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, found.ID)
+	_, err = transfers.GetTransferByReference("payroll", "pay_8f2a")
+	assert.ErrorIs(t, err, model.ErrTransferNotFound, "references are looked up per client")
+
+	plain, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+	got, err = transfers.GetTransfer(plain.ID)
+	require.NoError(t, err)
+	assert.True(t, got.TransferDetails.Empty())
+	assert.Empty(t, got.ClientID)
+	assert.Nil(t, got.Metadata)
+	_, err = transfers.GetTransferByReference("", "")
+	assert.ErrorIs(t, err, model.ErrTransferNotFound, "transfers without a reference are not found by an empty one")
+}
+
+func testTransferFee(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	transfer := newTransfer(nil)
+	transfer.Amount = decimal.NewFromInt(10)
+	transfer.Fee = &model.Fee{AccountID: 3, Amount: decimal.RequireFromString("0.5"), Mode: model.FeeDeducted}
+	created, err := transfers.CreateTransfer(transfer)
+	require.NoError(t, err)
+
+	got, err := transfers.GetTransfer(created.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.Fee)
+	assert.Zero(t, got.Fee.ScheduleID)
+	assert.Equal(t, int64(3), got.Fee.AccountID)
+	assert.True(t, got.Fee.Amount.Equal(decimal.RequireFromString("0.5")), "got %s", got.Fee.Amount)
+	assert.Equal(t, model.FeeDeducted, got.Fee.Mode)
+	assert.True(t, got.Debited().Equal(decimal.NewFromInt(10)), "got %s", got.Debited())
+	assert.True(t, got.Credited().Equal(decimal.RequireFromString("9.5")), "got %s", got.Credited())
+
+	// Only what the destination was credited can be reversed
+	claimed, err := transfers.ClaimTransfers(1, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []int64{created.ID}, transferIDs(claimed))
+	require.NoError(t, transfers.FinishTransfer(nil, created.ID, 1, model.TransferCompleted, ""))
+	_, err = transfers.CreateReversal(nil, created.ID, decimal.NewFromInt(10), model.TransferCompleted, nil)
+	assert.ErrorIs(t, err, model.ErrReversalExceedsOriginal)
+	reversal, err := transfers.CreateReversal(nil, created.ID, decimal.Zero, model.TransferCompleted, nil)
+	require.NoError(t, err)
+	assert.True(t, reversal.Amount.Equal(decimal.RequireFromString("9.5")), "got %s", reversal.Amount)
+	assert.Nil(t, reversal.Fee, "reversals are not charged")
+
+	plain, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+	got, err = transfers.GetTransfer(plain.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.Fee)
+}
+
+func testExternalReferenceUniquePerClient(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	withReference := func(clientID string) model.Transfer {
+		transfer := newTransfer(nil)
+		transfer.ClientID, transfer.ExternalReference = clientID, "ref-1"
+		return transfer
+	}
+	_, err := transfers.CreateTransfer(withReference("billing"))
+	require.NoError(t, err)
+	_, err = transfers.CreateTransfer(withReference("billing"))
+	assert.ErrorIs(t, err, model.ErrDuplicateExternalReference)
+	_, err = transfers.BookTransfer(nil, withReference("billing"))
+	assert.ErrorIs(t, err, model.ErrDuplicateExternalReference)
+	_, err = transfers.CreateTransfer(withReference("payroll"))
+	assert.NoError(t, err, "another client may use the same reference")
+
+	// Transfers without a reference never conflict
+	for i := 0; i < 2; i++ {
+		_, err = transfers.CreateTransfer(newTransfer(nil))
+		require.NoError(t, err)
+	}
+}
+
+func testBookInTransaction(t *testing.T, accounts db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	transfer := newTransfer(nil)
+	transfer.ClientID, transfer.ExternalReference = "billing", "ref-2"
+
+	tx, err := accounts.BeginTx()
+	require.NoError(t, err)
+	booked, err := transfers.BookTransfer(tx, transfer)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferCompleted, booked.Status)
+	require.NoError(t, tx.Rollback())
+	_, err = transfers.GetTransferByReference("billing", "ref-2")
+	assert.ErrorIs(t, err, model.ErrTransferNotFound, "a rolled back booking frees its reference")
+
+	tx, err = accounts.BeginTx()
+	require.NoError(t, err)
+	booked, err = transfers.BookTransfer(tx, transfer)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	found, err := transfers.GetTransferByReference("billing", "ref-2")
+	require.NoError(t, err)
+	assert.Equal(t, booked.ID, found.ID)
+	assert.Equal(t, model.TransferCompleted, found.Status)
+
+	claimed, err := transfers.ClaimTransfers(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "booked transfers are never claimed")
+}
+
+func testSplitLegs(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	parent, err := transfers.BookTransfer(nil, model.Transfer{SourceAccountID: 1, Amount: decimal.NewFromInt(10), Kind: model.TransferKindSplit})
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferKindSplit, parent.Kind)
+	assert.Zero(t, parent.DestinationAccountID, "a split has no destination of its own")
+
+	var legIDs []int64
+	for dest := int64(2); dest <= 3; dest++ {
+		leg, err := transfers.BookTransfer(nil, model.Transfer{SourceAccountID: 1, DestinationAccountID: dest, Amount: decimal.NewFromInt(5), ParentID: &parent.ID})
+		require.NoError(t, err)
+		assert.Equal(t, model.TransferKindTransfer, leg.Kind)
+		require.NotNil(t, leg.ParentID)
+		assert.Equal(t, parent.ID, *leg.ParentID)
+		legIDs = append(legIDs, leg.ID)
+	}
+
+	legs, err := transfers.ListLegs(parent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, legIDs, transferIDs(legs))
+	assert.Equal(t, []int64{2, 3}, []int64{legs[0].DestinationAccountID, legs[1].DestinationAccountID})
+	got := requireStatus(t, transfers, parent.ID, model.TransferCompleted)
+	assert.Equal(t, model.TransferKindSplit, got.Kind)
+	assert.Zero(t, got.DestinationAccountID)
+
+	// Legs are reversed one by one; the split itself is not reversible
+	_, err = transfers.CreateReversal(nil, parent.ID, decimal.Zero, model.TransferCompleted, nil)
+	assert.ErrorIs(t, err, model.ErrTransferNotReversible)
+	_, err = transfers.CreateReversal(nil, legIDs[0], decimal.Zero, model.TransferCompleted, nil)
+	assert.NoError(t, err)
+
+	plain, err := transfers.CreateTransfer(newTransfer(nil))
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferKindTransfer, plain.Kind)
+	assert.Nil(t, plain.ParentID)
+}
+
+func testSweepLegs(t *testing.T, _ db.AccountRepositoryPort, transfers db.TransferRepositoryPort) {
+	parent, err := transfers.BookTransfer(nil, model.Transfer{DestinationAccountID: 3, Amount: decimal.NewFromInt(10), Kind: model.TransferKindSweep})
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferKindSweep, parent.Kind)
+	assert.Zero(t, parent.SourceAccountID, "a sweep has no source of its own")
+
+	for source := int64(1); source <= 2; source++ {
+		_, err := transfers.BookTransfer(nil, model.Transfer{SourceAccountID: source, DestinationAccountID: 3, Amount: decimal.NewFromInt(5), ParentID: &parent.ID})
+		require.NoError(t, err)
+	}
+	legs, err := transfers.ListLegs(parent.ID)
+	require.NoError(t, err)
+	require.Len(t, legs, 2)
+	assert.Equal(t, []int64{1, 2}, []int64{legs[0].SourceAccountID, legs[1].SourceAccountID})
+	got := requireStatus(t, transfers, parent.ID, model.TransferCompleted)
+	assert.Zero(t, got.SourceAccountID)
+
+	_, err = transfers.CreateReversal(nil, parent.ID, decimal.Zero, model.TransferCompleted, nil)
+	assert.ErrorIs(t, err, model.ErrTransferNotReversible)
+}
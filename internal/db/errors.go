@@ -0,0 +1,43 @@
+package db
+
+import (
+	"errors"
+	"log"
+)
+
+// SQLSTATE codes translated into domain errors
+const (
+	sqlStateUniqueViolation     = "23505"
+	sqlStateForeignKeyViolation = "23503"
+	sqlStateCheckViolation      = "23514"
+	sqlStateDeadlock            = "40P01"
+)
+
+// sqlStateError is implemented by driver errors that carry a SQLSTATE code,
+// such as pgx's *pgconn.PgError
+type sqlStateError interface {
+	error
+	SQLState() string
+}
+
+// errorMapping translates SQLSTATE codes into domain errors for one statement
+type errorMapping map[string]error
+
+// translateError converts a driver error into the domain error registered for
+// its SQLSTATE code, so callers never depend on a specific database driver.
+// Errors without a mapping are returned unchanged.
+func translateError(err error, mapping errorMapping) error {
+	var stateErr sqlStateError
+	if err == nil || !errors.As(err, &stateErr) {
+		return err
+	}
+	code := stateErr.SQLState()
+	if domainErr, ok := mapping[code]; ok {
+		log.Printf("Translated database error %s into %q: %v", code, domainErr, err)
+		return domainErr
+	}
+	if code == sqlStateDeadlock {
+		return ErrDeadlockDetected
+	}
+	return err
+}
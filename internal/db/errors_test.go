@@ -0,0 +1,49 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSQLStateError struct{ code string }
+
+func (e fakeSQLStateError) Error() string    { return "sqlstate " + e.code }
+func (e fakeSQLStateError) SQLState() string { return e.code }
+
+func TestTranslateError(t *testing.T) {
+	mapping := errorMapping{
+		sqlStateUniqueViolation: model.ErrAccountIDAlreadyExists,
+		sqlStateCheckViolation:  model.ErrInsufficientFunds,
+	}
+
+	testCases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"Nil", nil, nil},
+		{"PgconnUniqueViolation", &pgconn.PgError{Code: sqlStateUniqueViolation}, model.ErrAccountIDAlreadyExists},
+		{"DriverAgnostic", fakeSQLStateError{sqlStateCheckViolation}, model.ErrInsufficientFunds},
+		{"Wrapped", fmt.Errorf("exec: %w", fakeSQLStateError{sqlStateUniqueViolation}), model.ErrAccountIDAlreadyExists},
+		{"Deadlock", fakeSQLStateError{sqlStateDeadlock}, ErrDeadlockDetected},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, translateError(tc.err, mapping))
+		})
+	}
+}
+
+func TestTranslateError_UnmappedErrorsPassThrough(t *testing.T) {
+	unmapped := fakeSQLStateError{"42P01"}
+	assert.Equal(t, error(unmapped), translateError(unmapped, errorMapping{}))
+
+	plain := errors.New("connection reset")
+	assert.Equal(t, plain, translateError(plain, errorMapping{sqlStateUniqueViolation: model.ErrAccountIDAlreadyExists}))
+}
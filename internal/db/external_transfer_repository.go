@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ExternalTransferRepositoryPort defines the repository interface for deposits
+// and withdrawals. Their funds are moved by the account repository in the same
+// transaction as the status changes.
+type ExternalTransferRepositoryPort interface {
+	// CreateExternalTransfer stores a pending deposit or withdrawal from all
+	// fields of t but its id, status and times, optionally within a
+	// transaction. It returns ErrDuplicateExternalReference when the client
+	// already used the external reference for the same kind, and
+	// ErrAccountNotFound when either account does not exist.
+	CreateExternalTransfer(tx TransactionPort, t model.ExternalTransfer) (model.ExternalTransfer, error)
+	GetExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error)
+	// ListExternalTransfers returns up to limit deposits or withdrawals, newest
+	// first, of one account or of all accounts when accountID is 0
+	ListExternalTransfers(kind model.ExternalTransferKind, accountID int64, limit int) ([]model.ExternalTransfer, error)
+	// LockExternalTransfer reads a deposit or withdrawal within tx, locking it
+	// until tx ends
+	LockExternalTransfer(tx TransactionPort, kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error)
+	// SetExternalTransferStatus changes the status of a deposit or withdrawal
+	// locked within tx
+	SetExternalTransferStatus(tx TransactionPort, id int64, status model.ExternalTransferStatus) (model.ExternalTransfer, error)
+}
+
+// Domain errors for constraint violations of the external transfer statements
+var createExternalTransferErrors = errorMapping{
+	sqlStateUniqueViolation:     model.ErrDuplicateExternalReference,
+	sqlStateForeignKeyViolation: model.ErrAccountNotFound,
+}
+
+const (
+	externalTransferColumns = `id, kind, account_id, clearing_account_id, amount, status,
+    client_id, COALESCE(external_reference, ''), created_at, updated_at`
+
+	createExternalTransferSQL = `INSERT INTO external_transfers
+    (kind, account_id, clearing_account_id, amount, client_id, external_reference)
+VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+RETURNING ` + externalTransferColumns
+
+	listExternalTransfersSQL = `SELECT ` + externalTransferColumns + ` FROM external_transfers
+WHERE kind = $1 AND ($2::bigint = 0 OR account_id = $2::bigint)
+ORDER BY id DESC
+LIMIT $3`
+
+	setExternalTransferStatusSQL = `UPDATE external_transfers SET status = $2, updated_at = now()
+WHERE id = $1
+RETURNING ` + externalTransferColumns
+)
+
+type ExternalTransferRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewExternalTransferRepository(pool *pgxpool.Pool) *ExternalTransferRepository {
+	return &ExternalTransferRepository{pool: pool}
+}
+
+// CreateExternalTransfer stores a new pending deposit or withdrawal, optionally within a transaction
+func (repo *ExternalTransferRepository) CreateExternalTransfer(tx TransactionPort, t model.ExternalTransfer) (model.ExternalTransfer, error) {
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return model.ExternalTransfer{}, err
+	}
+	created, err := scanExternalTransfer(q.QueryRow(context.Background(), createExternalTransferSQL,
+		string(t.Kind), t.AccountID, t.ClearingAccountID, t.Amount, t.ClientID, t.ExternalReference))
+	if err != nil {
+		err = translateError(err, createExternalTransferErrors)
+		if !errors.Is(err, model.ErrDuplicateExternalReference) && !errors.Is(err, model.ErrAccountNotFound) {
+			log.Printf("CreateExternalTransfer DB error: %v", err)
+		}
+		return model.ExternalTransfer{}, err
+	}
+	return created, nil
+}
+
+// GetExternalTransfer retrieves a deposit or withdrawal by id
+func (repo *ExternalTransferRepository) GetExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error) {
+	return repo.getExternalTransfer(repo.pool, kind, id, "")
+}
+
+// ListExternalTransfers returns deposits or withdrawals, newest first
+func (repo *ExternalTransferRepository) ListExternalTransfers(kind model.ExternalTransferKind, accountID int64, limit int) ([]model.ExternalTransfer, error) {
+	rows, err := repo.pool.Query(context.Background(), listExternalTransfersSQL, string(kind), accountID, limit)
+	if err != nil {
+		log.Printf("ListExternalTransfers DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	transfers, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.ExternalTransfer, error) {
+		return scanExternalTransfer(row)
+	})
+	if err != nil {
+		log.Printf("ListExternalTransfers DB error: %v", err)
+	}
+	return transfers, translateError(err, nil)
+}
+
+// LockExternalTransfer reads a deposit or withdrawal FOR UPDATE within tx
+func (repo *ExternalTransferRepository) LockExternalTransfer(tx TransactionPort, kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error) {
+	if tx == nil {
+		return model.ExternalTransfer{}, fmt.Errorf("transaction is nil")
+	}
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return model.ExternalTransfer{}, err
+	}
+	return repo.getExternalTransfer(q, kind, id, " FOR UPDATE")
+}
+
+// SetExternalTransferStatus changes the status of a locked deposit or withdrawal within tx
+func (repo *ExternalTransferRepository) SetExternalTransferStatus(tx TransactionPort, id int64, status model.ExternalTransferStatus) (model.ExternalTransfer, error) {
+	if tx == nil {
+		return model.ExternalTransfer{}, fmt.Errorf("transaction is nil")
+	}
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return model.ExternalTransfer{}, err
+	}
+	updated, err := scanExternalTransfer(q.QueryRow(context.Background(), setExternalTransferStatusSQL, id, string(status)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ExternalTransfer{}, model.ErrExternalTransferNotFound
+	}
+	if err != nil {
+		log.Printf("SetExternalTransferStatus DB error: %v", err)
+		return model.ExternalTransfer{}, translateError(err, nil)
+	}
+	return updated, nil
+}
+
+// getExternalTransfer selects a deposit or withdrawal by id, with an optional locking clause
+func (repo *ExternalTransferRepository) getExternalTransfer(q querier, kind model.ExternalTransferKind, id int64, locking string) (model.ExternalTransfer, error) {
+	t, err := scanExternalTransfer(q.QueryRow(context.Background(),
+		`SELECT `+externalTransferColumns+` FROM external_transfers WHERE id = $1 AND kind = $2`+locking, id, string(kind)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ExternalTransfer{}, model.ErrExternalTransferNotFound
+	}
+	if err != nil {
+		log.Printf("GetExternalTransfer DB error: %v", err)
+		return model.ExternalTransfer{}, fmt.Errorf("query external transfer by id: %w", translateError(err, nil))
+	}
+	return t, nil
+}
+
+// scanExternalTransfer reads a row selected with externalTransferColumns
+func scanExternalTransfer(row pgx.Row) (model.ExternalTransfer, error) {
+	var t model.ExternalTransfer
+	var kind, status string
+	err := row.Scan(&t.ID, &kind, &t.AccountID, &t.ClearingAccountID, &t.Amount, &status,
+		&t.ClientID, &t.ExternalReference, &t.CreatedAt, &t.UpdatedAt)
+	t.Kind = model.ExternalTransferKind(kind)
+	t.Status = model.ExternalTransferStatus(status)
+	return t, err
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FeeScheduleRepositoryPort defines the repository interface for fee schedules
+type FeeScheduleRepositoryPort interface {
+	// CreateFeeSchedule stores a schedule from all fields of s but its id and
+	// creation time. It returns ErrFeeScheduleExists when the client already
+	// has a schedule for the account type.
+	CreateFeeSchedule(s model.FeeSchedule) (model.FeeSchedule, error)
+	GetFeeSchedule(id int64) (model.FeeSchedule, error)
+	// ListFeeSchedules returns up to limit schedules in id order
+	ListFeeSchedules(limit int) ([]model.FeeSchedule, error)
+	// DeleteFeeSchedule removes a schedule; the transfers it charged keep
+	// their fees
+	DeleteFeeSchedule(id int64) error
+	// FindFeeSchedule returns the schedule charging a client for a transfer
+	// from an account of a type. The client's schedules are preferred to the
+	// default ones, with an empty client id, and among them the schedule of
+	// the type to the one without a type. It returns ErrFeeScheduleNotFound
+	// when none applies.
+	FindFeeSchedule(clientID string, accountType model.AccountType) (model.FeeSchedule, error)
+}
+
+// Domain errors for constraint violations of the fee schedule statements;
+// schedules are unique by client id and account type, tiers by min_amount
+var (
+	feeScheduleErrors = errorMapping{
+		sqlStateCheckViolation:  model.ErrInvalidFeeSchedule,
+		sqlStateUniqueViolation: model.ErrFeeScheduleExists,
+	}
+	feeTierErrors = errorMapping{
+		sqlStateCheckViolation:  model.ErrInvalidFeeSchedule,
+		sqlStateUniqueViolation: model.ErrInvalidFeeSchedule,
+	}
+)
+
+const (
+	feeScheduleColumns = `id, name, client_id, account_type, kind, flat_fee, rate, min_fee, max_fee, created_at`
+
+	createFeeScheduleSQL = `INSERT INTO fee_schedules (name, client_id, account_type, kind, flat_fee, rate, min_fee, max_fee)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, created_at`
+
+	// findFeeScheduleSQL prefers the client's own schedules to the default
+	// ones, then the schedule of the account type to the one without a type
+	findFeeScheduleSQL = `WHERE client_id IN ($1, '') AND account_type IN ($2, '')
+ORDER BY client_id = '', account_type = ''
+LIMIT 1`
+)
+
+type FeeScheduleRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewFeeScheduleRepository(pool *pgxpool.Pool) *FeeScheduleRepository {
+	return &FeeScheduleRepository{pool: pool}
+}
+
+// CreateFeeSchedule stores a new fee schedule with its tiers
+func (repo *FeeScheduleRepository) CreateFeeSchedule(s model.FeeSchedule) (model.FeeSchedule, error) {
+	err := pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error {
+		ctx := context.Background()
+		err := tx.QueryRow(ctx, createFeeScheduleSQL, s.Name, s.ClientID, string(s.AccountType), string(s.Kind), s.Flat, s.Rate, s.MinFee, s.MaxFee).
+			Scan(&s.ID, &s.CreatedAt)
+		if err != nil {
+			return translateError(err, feeScheduleErrors)
+		}
+		for _, tier := range s.Tiers {
+			if _, err := tx.Exec(ctx, `INSERT INTO fee_schedule_tiers (schedule_id, min_amount, flat_fee, rate)
+VALUES ($1, $2, $3, $4)`, s.ID, tier.MinAmount, tier.Flat, tier.Rate); err != nil {
+				return translateError(err, feeTierErrors)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, model.ErrFeeScheduleExists) && !errors.Is(err, model.ErrInvalidFeeSchedule) {
+			log.Printf("CreateFeeSchedule DB error: %v", err)
+		}
+		return model.FeeSchedule{}, err
+	}
+	return s, nil
+}
+
+// GetFeeSchedule retrieves a fee schedule by id
+func (repo *FeeScheduleRepository) GetFeeSchedule(id int64) (model.FeeSchedule, error) {
+	schedules, err := repo.queryFeeSchedules(`WHERE id = $1`, id)
+	if err != nil {
+		log.Printf("GetFeeSchedule DB error: %v", err)
+		return model.FeeSchedule{}, fmt.Errorf("query fee schedule by id: %w", translateError(err, nil))
+	}
+	if len(schedules) == 0 {
+		return model.FeeSchedule{}, model.ErrFeeScheduleNotFound
+	}
+	return schedules[0], nil
+}
+
+// ListFeeSchedules returns fee schedules in id order
+func (repo *FeeScheduleRepository) ListFeeSchedules(limit int) ([]model.FeeSchedule, error) {
+	schedules, err := repo.queryFeeSchedules(`ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		log.Printf("ListFeeSchedules DB error: %v", err)
+	}
+	return schedules, translateError(err, nil)
+}
+
+// DeleteFeeSchedule removes a fee schedule and its tiers
+func (repo *FeeScheduleRepository) DeleteFeeSchedule(id int64) error {
+	tag, err := repo.pool.Exec(context.Background(), `DELETE FROM fee_schedules WHERE id = $1`, id)
+	if err != nil {
+		log.Printf("DeleteFeeSchedule DB error: %v", err)
+		return translateError(err, nil)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrFeeScheduleNotFound
+	}
+	return nil
+}
+
+// FindFeeSchedule returns the schedule charging a client for a transfer from
+// an account of a type
+func (repo *FeeScheduleRepository) FindFeeSchedule(clientID string, accountType model.AccountType) (model.FeeSchedule, error) {
+	schedules, err := repo.queryFeeSchedules(findFeeScheduleSQL, clientID, string(accountType))
+	if err != nil {
+		log.Printf("FindFeeSchedule DB error: %v", err)
+		return model.FeeSchedule{}, fmt.Errorf("query fee schedule of client: %w", translateError(err, nil))
+	}
+	if len(schedules) == 0 {
+		return model.FeeSchedule{}, model.ErrFeeScheduleNotFound
+	}
+	return schedules[0], nil
+}
+
+// queryFeeSchedules selects the schedules matching clause with their tiers
+func (repo *FeeScheduleRepository) queryFeeSchedules(clause string, args ...any) ([]model.FeeSchedule, error) {
+	ctx := context.Background()
+	rows, err := repo.pool.Query(ctx, `SELECT `+feeScheduleColumns+` FROM fee_schedules `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.FeeSchedule, error) {
+		var s model.FeeSchedule
+		var accountType, kind string
+		err := row.Scan(&s.ID, &s.Name, &s.ClientID, &accountType, &kind, &s.Flat, &s.Rate, &s.MinFee, &s.MaxFee, &s.CreatedAt)
+		s.AccountType = model.AccountType(accountType)
+		s.Kind = model.FeeKind(kind)
+		return s, err
+	})
+	if err != nil || len(schedules) == 0 {
+		return schedules, err
+	}
+
+	ids := make([]int64, len(schedules))
+	byID := make(map[int64]*model.FeeSchedule, len(schedules))
+	for i := range schedules {
+		ids[i] = schedules[i].ID
+		byID[schedules[i].ID] = &schedules[i]
+	}
+	rows, err = repo.pool.Query(ctx, `SELECT schedule_id, min_amount, flat_fee, rate FROM fee_schedule_tiers
+WHERE schedule_id = ANY($1) ORDER BY schedule_id, min_amount`, ids)
+	if err != nil {
+		return nil, err
+	}
+	var scheduleID int64
+	var tier model.FeeTier
+	_, err = pgx.ForEachRow(rows, []any{&scheduleID, &tier.MinAmount, &tier.Flat, &tier.Rate}, func() error {
+		s := byID[scheduleID]
+		s.Tiers = append(s.Tiers, tier)
+		return nil
+	})
+	return schedules, err
+}
@@ -0,0 +1,514 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+)
+
+// ErrAccrualConflict is returned when accruing a day that is no longer the
+// next accrual day of the account with that product
+var ErrAccrualConflict = errors.New("interest accrual conflicts with a concurrent change")
+
+// ErrPostingExists is returned when starting a posting for a period that
+// already has one
+var ErrPostingExists = errors.New("interest posting already started for the period")
+
+// interestLockClass namespaces the per-account interest advisory locks, like
+// standingOrderLockClass
+const interestLockClass int32 = 0x6969 // "ii"
+
+// InterestRepositoryPort defines the repository interface for interest
+// products and their accruals and postings. Days are dates at UTC midnight.
+type InterestRepositoryPort interface {
+	// CreateInterestProduct stores a product from all fields of p but its id
+	// and creation time
+	CreateInterestProduct(p model.InterestProduct) (model.InterestProduct, error)
+	GetInterestProduct(id int64) (model.InterestProduct, error)
+	// ListInterestProducts returns up to limit products in id order
+	ListInterestProducts(limit int) ([]model.InterestProduct, error)
+	// SetAccountInterest sets the product accruing on an account, 0 to stop
+	// accruing. An account starting to accrue does so from day from; one
+	// changing products keeps its next accrual day.
+	SetAccountInterest(accountID, productID int64, from time.Time) (model.AccountInterest, error)
+	// GetAccountInterest returns ErrInterestNotAssigned for an account that
+	// never had a product
+	GetAccountInterest(accountID int64) (model.AccountInterest, error)
+	// DueAccruals returns up to limit accounts with a product whose next
+	// accrual day is at or before day, earliest first
+	DueAccruals(day time.Time, limit int) ([]int64, error)
+	// AccrueInterest stores the accrual of an account's next accrual day and
+	// moves the account on to the following day, dropping the balance
+	// snapshots before the day. It returns ErrAccrualConflict when the day or
+	// product no longer match.
+	AccrueInterest(accrual model.InterestAccrual) error
+	// SnapshotBalances records the current balance of every account with a
+	// product as its balance of day, replacing the snapshot of an earlier run
+	// that day. It returns the number of accounts recorded.
+	SnapshotBalances(day time.Time) (int, error)
+	// BalanceSnapshots returns the balance snapshots of an account from day
+	// from through day to, oldest first
+	BalanceSnapshots(accountID int64, from, to time.Time) ([]model.BalanceSnapshot, error)
+	// DuePostings returns up to limit accounts that have accrued through
+	// periodEnd, have unposted accruals up to it and no posting for it
+	DuePostings(periodEnd time.Time, limit int) ([]int64, error)
+	// StartInterestPosting records a processing posting of the unposted
+	// accruals of an account up to periodEnd, with their sum and the residual
+	// carried from the previous posting, within tx when it is not nil. It
+	// returns ErrPostingExists if the period already has a posting.
+	StartInterestPosting(tx TransactionPort, accountID int64, periodStart, periodEnd time.Time) (model.InterestPosting, error)
+	// FinishInterestPosting records the outcome of a started posting, within
+	// tx when it is not nil. A completed posting carries its residual into the
+	// next one; a failed one releases its accruals to the next posting.
+	FinishInterestPosting(tx TransactionPort, id int64, status model.TransferStatus, errorCode string, amount, residual decimal.Decimal) error
+	// ListInterestAccruals returns up to limit accruals of an account, most recent first
+	ListInterestAccruals(accountID int64, limit int) ([]model.InterestAccrual, error)
+	// ListInterestPostings returns up to limit postings of an account, most recent first
+	ListInterestPostings(accountID int64, limit int) ([]model.InterestPosting, error)
+	// LockAccountInterest takes the lock serializing the interest runs of one
+	// account on all replicas, without waiting. It reports false when another
+	// run holds it; otherwise unlock must be called.
+	LockAccountInterest(accountID int64) (unlock func(), locked bool, err error)
+}
+
+const (
+	accountInterestColumns = `account_id, COALESCE(product_id, 0), next_accrual_day, accrued, residual, created_at, updated_at`
+
+	setAccountInterestSQL = `INSERT INTO account_interest (account_id, product_id, next_accrual_day)
+VALUES ($1, NULLIF($2::bigint, 0), $3)
+ON CONFLICT (account_id) DO UPDATE SET
+    product_id = EXCLUDED.product_id,
+    next_accrual_day = CASE WHEN account_interest.product_id IS NULL
+        THEN GREATEST(account_interest.next_accrual_day, EXCLUDED.next_accrual_day)
+        ELSE account_interest.next_accrual_day END,
+    updated_at = now()
+RETURNING ` + accountInterestColumns
+
+	dueAccrualsSQL = `SELECT account_id FROM account_interest
+WHERE product_id IS NOT NULL AND next_accrual_day <= $1
+ORDER BY next_accrual_day, account_id
+LIMIT $2`
+
+	accrueInterestSQL = `UPDATE account_interest
+SET next_accrual_day = next_accrual_day + 1, accrued = accrued + $4, updated_at = now()
+WHERE account_id = $1 AND next_accrual_day = $2 AND product_id = $3`
+
+	duePostingsSQL = `SELECT ai.account_id FROM account_interest ai
+WHERE (ai.product_id IS NULL OR ai.next_accrual_day > $1)
+  AND EXISTS (SELECT 1 FROM interest_accruals a
+      WHERE a.account_id = ai.account_id AND a.posting_id IS NULL AND a.day <= $1)
+  AND NOT EXISTS (SELECT 1 FROM interest_postings p
+      WHERE p.account_id = ai.account_id AND p.period_end = $1)
+ORDER BY ai.account_id
+LIMIT $2`
+
+	interestPostingColumns = `id, account_id, period_start, period_end, accrued, carried_residual, amount, residual,
+    status, COALESCE(error_code, ''), created_at, finished_at`
+
+	startInterestPostingSQL = `INSERT INTO interest_postings
+    (account_id, period_start, period_end, accrued, carried_residual, status)
+SELECT account_id, $2, $3,
+    COALESCE((SELECT sum(amount) FROM interest_accruals
+        WHERE account_id = $1 AND posting_id IS NULL AND day <= $3), 0),
+    residual, 'processing'
+FROM account_interest WHERE account_id = $1
+RETURNING ` + interestPostingColumns
+
+	// snapshotBalancesSQL reads balances like selectBalanceSQL, shards included
+	snapshotBalancesSQL = `INSERT INTO interest_balances (account_id, day, balance)
+SELECT a.account_id, $1, a.balance + COALESCE((
+    SELECT SUM(s.balance) FROM account_balance_shards s WHERE s.account_id = a.account_id
+), 0)
+FROM account_interest ai
+JOIN accounts a ON a.account_id = ai.account_id
+WHERE ai.product_id IS NOT NULL
+ON CONFLICT (account_id, day) DO UPDATE SET balance = EXCLUDED.balance`
+
+	finishInterestPostingSQL = `UPDATE interest_postings
+SET status = $2, error_code = NULLIF($3, ''), amount = $4, residual = $5, finished_at = now()
+WHERE id = $1 AND status = 'processing'
+RETURNING account_id, accrued`
+
+	listInterestAccrualsSQL = `SELECT account_id, day, product_id, base, amount, COALESCE(posting_id, 0)
+FROM interest_accruals
+WHERE account_id = $1
+ORDER BY day DESC
+LIMIT $2`
+
+	listInterestPostingsSQL = `SELECT ` + interestPostingColumns + ` FROM interest_postings
+WHERE account_id = $1
+ORDER BY id DESC
+LIMIT $2`
+)
+
+// Domain errors for constraint violations of the interest product statements
+var interestProductErrors = errorMapping{
+	sqlStateCheckViolation:  model.ErrInvalidInterestProduct,
+	sqlStateUniqueViolation: model.ErrInvalidInterestProduct,
+}
+
+type InterestRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewInterestRepository(pool *pgxpool.Pool) *InterestRepository {
+	return &InterestRepository{pool: pool}
+}
+
+// CreateInterestProduct stores a new interest product with its tiers
+func (repo *InterestRepository) CreateInterestProduct(p model.InterestProduct) (model.InterestProduct, error) {
+	err := pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error {
+		ctx := context.Background()
+		err := tx.QueryRow(ctx, `INSERT INTO interest_products (name, method, day_count)
+VALUES ($1, $2, $3) RETURNING id, created_at`, p.Name, string(p.Method), p.DayCount).Scan(&p.ID, &p.CreatedAt)
+		if err != nil {
+			return err
+		}
+		for _, tier := range p.Tiers {
+			if _, err := tx.Exec(ctx, `INSERT INTO interest_product_tiers (product_id, min_balance, rate)
+VALUES ($1, $2, $3)`, p.ID, tier.MinBalance, tier.Rate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("CreateInterestProduct DB error: %v", err)
+		return model.InterestProduct{}, translateError(err, interestProductErrors)
+	}
+	return p, nil
+}
+
+// GetInterestProduct retrieves an interest product by id
+func (repo *InterestRepository) GetInterestProduct(id int64) (model.InterestProduct, error) {
+	products, err := repo.queryInterestProducts(`WHERE id = $1`, id)
+	if err != nil {
+		log.Printf("GetInterestProduct DB error: %v", err)
+		return model.InterestProduct{}, fmt.Errorf("query interest product by id: %w", translateError(err, nil))
+	}
+	if len(products) == 0 {
+		return model.InterestProduct{}, model.ErrInterestProductNotFound
+	}
+	return products[0], nil
+}
+
+// ListInterestProducts returns interest products in id order
+func (repo *InterestRepository) ListInterestProducts(limit int) ([]model.InterestProduct, error) {
+	products, err := repo.queryInterestProducts(`ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		log.Printf("ListInterestProducts DB error: %v", err)
+	}
+	return products, translateError(err, nil)
+}
+
+// queryInterestProducts selects the products matching clause with their tiers
+func (repo *InterestRepository) queryInterestProducts(clause string, args ...any) ([]model.InterestProduct, error) {
+	ctx := context.Background()
+	rows, err := repo.pool.Query(ctx, `SELECT id, name, method, day_count, created_at FROM interest_products `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	products, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.InterestProduct, error) {
+		var p model.InterestProduct
+		var method string
+		err := row.Scan(&p.ID, &p.Name, &method, &p.DayCount, &p.CreatedAt)
+		p.Method = model.InterestMethod(method)
+		return p, err
+	})
+	if err != nil || len(products) == 0 {
+		return products, err
+	}
+
+	ids := make([]int64, len(products))
+	byID := make(map[int64]*model.InterestProduct, len(products))
+	for i := range products {
+		ids[i] = products[i].ID
+		byID[products[i].ID] = &products[i]
+	}
+	rows, err = repo.pool.Query(ctx, `SELECT product_id, min_balance, rate FROM interest_product_tiers
+WHERE product_id = ANY($1) ORDER BY product_id, min_balance`, ids)
+	if err != nil {
+		return nil, err
+	}
+	var productID int64
+	var tier model.InterestTier
+	_, err = pgx.ForEachRow(rows, []any{&productID, &tier.MinBalance, &tier.Rate}, func() error {
+		p := byID[productID]
+		p.Tiers = append(p.Tiers, tier)
+		return nil
+	})
+	return products, err
+}
+
+// SetAccountInterest sets the product accruing on an account
+func (repo *InterestRepository) SetAccountInterest(accountID, productID int64, from time.Time) (model.AccountInterest, error) {
+	var ai model.AccountInterest
+	err := pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error {
+		ctx := context.Background()
+		// Products are never deleted, so the foreign key can only fail for the account
+		if productID != 0 {
+			var exists bool
+			if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM interest_products WHERE id = $1)`, productID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return model.ErrInterestProductNotFound
+			}
+		}
+		var err error
+		ai, err = scanAccountInterest(tx.QueryRow(ctx, setAccountInterestSQL, accountID, productID, from))
+		return err
+	})
+	if err != nil && !errors.Is(err, model.ErrInterestProductNotFound) {
+		log.Printf("SetAccountInterest DB error: %v", err)
+		return model.AccountInterest{}, translateError(err, errorMapping{sqlStateForeignKeyViolation: model.ErrAccountNotFound})
+	}
+	return ai, err
+}
+
+// GetAccountInterest returns the interest state of an account
+func (repo *InterestRepository) GetAccountInterest(accountID int64) (model.AccountInterest, error) {
+	row := repo.pool.QueryRow(context.Background(), `SELECT `+accountInterestColumns+` FROM account_interest WHERE account_id = $1`, accountID)
+	ai, err := scanAccountInterest(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.AccountInterest{}, model.ErrInterestNotAssigned
+	}
+	if err != nil {
+		log.Printf("GetAccountInterest DB error: %v", err)
+		return model.AccountInterest{}, translateError(err, nil)
+	}
+	return ai, nil
+}
+
+// DueAccruals returns the accounts with days to accrue
+func (repo *InterestRepository) DueAccruals(day time.Time, limit int) ([]int64, error) {
+	return repo.queryAccountIDs("DueAccruals", dueAccrualsSQL, day, limit)
+}
+
+// AccrueInterest stores one day of interest of an account
+func (repo *InterestRepository) AccrueInterest(accrual model.InterestAccrual) error {
+	err := pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error {
+		ctx := context.Background()
+		tag, err := tx.Exec(ctx, accrueInterestSQL, accrual.AccountID, accrual.Day, accrual.ProductID, accrual.Amount)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrAccrualConflict
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO interest_accruals (account_id, day, product_id, base, amount)
+VALUES ($1, $2, $3, $4, $5)`, accrual.AccountID, accrual.Day, accrual.ProductID, accrual.Base, accrual.Amount); err != nil {
+			return err
+		}
+		// The snapshot of the day is kept for a next day without one
+		_, err = tx.Exec(ctx, `DELETE FROM interest_balances WHERE account_id = $1 AND day < $2`, accrual.AccountID, accrual.Day)
+		return err
+	})
+	if err != nil && !errors.Is(err, ErrAccrualConflict) {
+		log.Printf("AccrueInterest DB error: %v", err)
+		return translateError(err, errorMapping{sqlStateUniqueViolation: ErrAccrualConflict})
+	}
+	return err
+}
+
+// SnapshotBalances records the balances of the accounts with a product
+func (repo *InterestRepository) SnapshotBalances(day time.Time) (int, error) {
+	tag, err := repo.pool.Exec(context.Background(), snapshotBalancesSQL, day)
+	if err != nil {
+		log.Printf("SnapshotBalances DB error: %v", err)
+		return 0, translateError(err, nil)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// BalanceSnapshots returns the balance snapshots of an account over a range of days
+func (repo *InterestRepository) BalanceSnapshots(accountID int64, from, to time.Time) ([]model.BalanceSnapshot, error) {
+	rows, err := repo.pool.Query(context.Background(), `SELECT account_id, day, balance FROM interest_balances
+WHERE account_id = $1 AND day BETWEEN $2 AND $3
+ORDER BY day`, accountID, from, to)
+	if err != nil {
+		log.Printf("BalanceSnapshots DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	snapshots, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.BalanceSnapshot, error) {
+		var b model.BalanceSnapshot
+		err := row.Scan(&b.AccountID, &b.Day, &b.Balance)
+		return b, err
+	})
+	if err != nil {
+		log.Printf("BalanceSnapshots DB error: %v", err)
+	}
+	return snapshots, translateError(err, nil)
+}
+
+// DuePostings returns the accounts with interest to post for a period
+func (repo *InterestRepository) DuePostings(periodEnd time.Time, limit int) ([]int64, error) {
+	return repo.queryAccountIDs("DuePostings", duePostingsSQL, periodEnd, limit)
+}
+
+func (repo *InterestRepository) queryAccountIDs(name, sql string, day time.Time, limit int) ([]int64, error) {
+	rows, err := repo.pool.Query(context.Background(), sql, day, limit)
+	if err != nil {
+		log.Printf("%s DB error: %v", name, err)
+		return nil, translateError(err, nil)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		log.Printf("%s DB error: %v", name, err)
+	}
+	return ids, translateError(err, nil)
+}
+
+// StartInterestPosting records a posting as processing and claims its
+// accruals, optionally within a transaction
+func (repo *InterestRepository) StartInterestPosting(tx TransactionPort, accountID int64, periodStart, periodEnd time.Time) (model.InterestPosting, error) {
+	var posting model.InterestPosting
+	start := func(q querier) error {
+		ctx := context.Background()
+		var err error
+		posting, err = scanInterestPosting(q.QueryRow(ctx, startInterestPostingSQL, accountID, periodStart, periodEnd))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrInterestNotAssigned
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := q.Exec(ctx, `UPDATE interest_accruals SET posting_id = $2
+WHERE account_id = $1 AND posting_id IS NULL AND day <= $3`, accountID, posting.ID, periodEnd); err != nil {
+			return err
+		}
+		_, err = q.Exec(ctx, `UPDATE account_interest SET accrued = accrued - $2, updated_at = now()
+WHERE account_id = $1`, accountID, posting.Accrued)
+		return err
+	}
+
+	var err error
+	if tx == nil {
+		err = pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error { return start(tx) })
+	} else {
+		var q querier
+		if q, err = queryable(repo.pool, tx); err != nil {
+			return model.InterestPosting{}, err
+		}
+		err = start(q)
+	}
+	if err != nil && !errors.Is(err, model.ErrInterestNotAssigned) {
+		log.Printf("StartInterestPosting DB error: %v", err)
+		return model.InterestPosting{}, translateError(err, errorMapping{sqlStateUniqueViolation: ErrPostingExists})
+	}
+	return posting, err
+}
+
+// FinishInterestPosting records the outcome of a posting, optionally within a
+// transaction
+func (repo *InterestRepository) FinishInterestPosting(tx TransactionPort, id int64, status model.TransferStatus, errorCode string, amount, residual decimal.Decimal) error {
+	finish := func(q querier) error {
+		ctx := context.Background()
+		var accountID int64
+		var accrued decimal.Decimal
+		err := q.QueryRow(ctx, finishInterestPostingSQL, id, string(status), errorCode, amount, residual).Scan(&accountID, &accrued)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if status == model.TransferCompleted {
+			_, err = q.Exec(ctx, `UPDATE account_interest SET residual = $2, updated_at = now()
+WHERE account_id = $1`, accountID, residual)
+			return err
+		}
+		if _, err := q.Exec(ctx, `UPDATE interest_accruals SET posting_id = NULL WHERE posting_id = $1`, id); err != nil {
+			return err
+		}
+		return repo.restoreAccrued(q, accountID, accrued)
+	}
+
+	var err error
+	if tx == nil {
+		err = pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error { return finish(tx) })
+	} else {
+		var q querier
+		if q, err = queryable(repo.pool, tx); err != nil {
+			return err
+		}
+		err = finish(q)
+	}
+	if err != nil {
+		log.Printf("FinishInterestPosting DB error: %v", err)
+		return translateError(err, nil)
+	}
+	return nil
+}
+
+// restoreAccrued adds released accruals back to the unposted interest of an account
+func (repo *InterestRepository) restoreAccrued(q querier, accountID int64, accrued decimal.Decimal) error {
+	_, err := q.Exec(context.Background(), `UPDATE account_interest SET accrued = accrued + $2, updated_at = now()
+WHERE account_id = $1`, accountID, accrued)
+	return err
+}
+
+// ListInterestAccruals returns the most recent accruals of an account
+func (repo *InterestRepository) ListInterestAccruals(accountID int64, limit int) ([]model.InterestAccrual, error) {
+	rows, err := repo.pool.Query(context.Background(), listInterestAccrualsSQL, accountID, limit)
+	if err != nil {
+		log.Printf("ListInterestAccruals DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	accruals, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.InterestAccrual, error) {
+		var a model.InterestAccrual
+		err := row.Scan(&a.AccountID, &a.Day, &a.ProductID, &a.Base, &a.Amount, &a.PostingID)
+		return a, err
+	})
+	if err != nil {
+		log.Printf("ListInterestAccruals DB error: %v", err)
+	}
+	return accruals, translateError(err, nil)
+}
+
+// ListInterestPostings returns the most recent postings of an account
+func (repo *InterestRepository) ListInterestPostings(accountID int64, limit int) ([]model.InterestPosting, error) {
+	rows, err := repo.pool.Query(context.Background(), listInterestPostingsSQL, accountID, limit)
+	if err != nil {
+		log.Printf("ListInterestPostings DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	postings, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.InterestPosting, error) {
+		return scanInterestPosting(row)
+	})
+	if err != nil {
+		log.Printf("ListInterestPostings DB error: %v", err)
+	}
+	return postings, translateError(err, nil)
+}
+
+// LockAccountInterest takes the interest advisory lock of an account, held on
+// a dedicated connection until unlock
+func (repo *InterestRepository) LockAccountInterest(accountID int64) (func(), bool, error) {
+	return tryAdvisoryLock(repo.pool, interestLockClass, accountID, fmt.Sprintf("interest of account %d", accountID))
+}
+
+// scanAccountInterest reads a row selected with accountInterestColumns
+func scanAccountInterest(row pgx.Row) (model.AccountInterest, error) {
+	var ai model.AccountInterest
+	err := row.Scan(&ai.AccountID, &ai.ProductID, &ai.NextAccrualDay, &ai.Accrued, &ai.Residual, &ai.CreatedAt, &ai.UpdatedAt)
+	return ai, err
+}
+
+// scanInterestPosting reads a row selected with interestPostingColumns
+func scanInterestPosting(row pgx.Row) (model.InterestPosting, error) {
+	var p model.InterestPosting
+	var status string
+	err := row.Scan(&p.ID, &p.AccountID, &p.PeriodStart, &p.PeriodEnd, &p.Accrued, &p.CarriedResidual, &p.Amount, &p.Residual,
+		&status, &p.ErrorCode, &p.CreatedAt, &p.FinishedAt)
+	p.Status = model.TransferStatus(status)
+	return p, err
+}
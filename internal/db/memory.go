@@ -0,0 +1,443 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrDeadlockDetected is returned by the in-memory store when waiting for a row
+// lock would deadlock, mirroring Postgres' deadlock detection (SQLSTATE 40P01)
+var ErrDeadlockDetected = errors.New("deadlock detected")
+
+// MemoryStore is a thread-safe in-memory database shared by the memory repositories.
+//
+// It mimics the Postgres behaviour the service relies on: rows locked by a
+// transaction block other transactions until commit or rollback, changes are
+// invisible to other readers until commit, and rollback restores the previous
+// state. A single mutex guards all tables; row locks are tracked separately so
+// a transaction can hold them across calls.
+type MemoryStore struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	locks map[lockKey]*memoryTx
+
+	accounts      *memTable[int64, memAccount]
+	balanceShards *memTable[shardKey, decimal.Decimal]
+	transfers     *memTable[int64, model.Transfer]
+
+	standingOrders *memTable[int64, model.StandingOrder]
+	occurrences    *memTable[occurrenceKey, model.StandingOrderOccurrence]
+
+	interestProducts *memTable[int64, model.InterestProduct]
+	accountInterest  *memTable[int64, model.AccountInterest]
+	interestAccruals *memTable[accrualKey, model.InterestAccrual]
+	interestPostings *memTable[int64, model.InterestPosting]
+	interestBalances *memTable[accrualKey, model.BalanceSnapshot]
+
+	balanceRules *memTable[int64, model.BalanceRule]
+	ruleSweeps   *memTable[int64, model.BalanceRuleSweep]
+
+	feeSchedules *memTable[int64, model.FeeSchedule]
+
+	externalTransfers *memTable[int64, model.ExternalTransfer]
+
+	// The last ids are id sequences; like Postgres sequences they are not
+	// rolled back
+	lastTransferID      int64
+	lastStandingOrderID int64
+	lastBalanceRuleID   int64
+	lastRuleSweepID     int64
+
+	lastInterestProductID  int64
+	lastInterestPostingID  int64
+	lastFeeScheduleID      int64
+	lastExternalTransferID int64
+
+	// advisoryLocks holds the standing order, balance rule and interest locks,
+	// which unlike row locks belong to a caller rather than a transaction
+	advisoryLocks map[lockKey]bool
+}
+
+// memAccount is a row of the in-memory accounts table
+type memAccount struct {
+	balance     decimal.Decimal
+	shards      int
+	parent      int64
+	childPolicy model.ChildBalancePolicy
+	// accountType decides whether the balance may go negative
+	accountType model.AccountType
+}
+
+// inHierarchy reports whether the account has a parent or limits its children
+func (a memAccount) inHierarchy() bool {
+	return a.parent != 0 || a.limitsChildren()
+}
+
+// limitsChildren reports whether the account limits the balances of its descendants
+func (a memAccount) limitsChildren() bool {
+	return a.childPolicy == model.ChildBalanceWithinParent
+}
+
+// occurrenceKey identifies a row of the in-memory standing order occurrences
+// table; times are kept at the microsecond precision of Postgres
+type occurrenceKey struct {
+	orderID      int64
+	scheduledFor int64
+}
+
+// accrualKey identifies a row of the in-memory interest accruals and
+// balances tables
+type accrualKey struct {
+	accountID int64
+	day       int64
+}
+
+// shardKey identifies a row of the in-memory balance shards table
+type shardKey struct {
+	accountID int64
+	shard     int
+}
+
+// NewMemoryStore creates an in-memory database holding only the system
+// accounts, like a freshly migrated one
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		locks:         make(map[lockKey]*memoryTx),
+		accounts:      newMemTable[int64, memAccount]("accounts"),
+		balanceShards: newMemTable[shardKey, decimal.Decimal]("account_balance_shards"),
+		transfers:     newMemTable[int64, model.Transfer]("transfers"),
+
+		standingOrders: newMemTable[int64, model.StandingOrder]("standing_orders"),
+		occurrences:    newMemTable[occurrenceKey, model.StandingOrderOccurrence]("standing_order_occurrences"),
+
+		interestProducts: newMemTable[int64, model.InterestProduct]("interest_products"),
+		accountInterest:  newMemTable[int64, model.AccountInterest]("account_interest"),
+		interestAccruals: newMemTable[accrualKey, model.InterestAccrual]("interest_accruals"),
+		interestPostings: newMemTable[int64, model.InterestPosting]("interest_postings"),
+		interestBalances: newMemTable[accrualKey, model.BalanceSnapshot]("interest_balances"),
+
+		balanceRules:  newMemTable[int64, model.BalanceRule]("balance_rules"),
+		ruleSweeps:    newMemTable[int64, model.BalanceRuleSweep]("balance_rule_sweeps"),
+		advisoryLocks: make(map[lockKey]bool),
+
+		feeSchedules: newMemTable[int64, model.FeeSchedule]("fee_schedules"),
+
+		externalTransfers: newMemTable[int64, model.ExternalTransfer]("external_transfers"),
+	}
+	for _, system := range model.SystemAccounts {
+		s.accounts.rows[system.AccountID] = memAccount{balance: decimal.Zero, accountType: system.Type}
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// lockKey identifies a locked row
+type lockKey struct {
+	table string
+	key   any
+}
+
+// tryAdvisoryLock takes an advisory lock without waiting, reporting false when
+// it is held; otherwise unlock must be called
+func (s *MemoryStore) tryAdvisoryLock(key lockKey) (unlock func(), locked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.advisoryLocks[key] {
+		return nil, false
+	}
+	s.advisoryLocks[key] = true
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.advisoryLocks, key)
+	}, true
+}
+
+// begin starts a new transaction
+func (s *MemoryStore) begin() *memoryTx {
+	return &memoryTx{store: s}
+}
+
+// autocommit runs fn in its own transaction, like a statement outside BEGIN/COMMIT
+func (s *MemoryStore) autocommit(fn func(tx *memoryTx) error) error {
+	tx := s.begin()
+	s.mu.Lock()
+	err := fn(tx)
+	if err != nil {
+		tx.rollbackLocked()
+	} else {
+		tx.commitLocked()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// inTx runs fn within tx, or in its own transaction when tx is nil
+func (s *MemoryStore) inTx(tx TransactionPort, fn func(tx *memoryTx) error) error {
+	if tx == nil {
+		return s.autocommit(fn)
+	}
+	mtx, err := memoryTxFrom(tx, s)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(mtx)
+}
+
+// lock acquires the row lock for key, waiting while another transaction holds it.
+// It reports whether the lock was newly acquired by this call.
+// Must be called with s.mu held.
+func (s *MemoryStore) lock(tx *memoryTx, key lockKey) (bool, error) {
+	for {
+		owner, held := s.locks[key]
+		if !held {
+			s.locks[key] = tx
+			tx.held = append(tx.held, key)
+			return true, nil
+		}
+		if owner == tx {
+			return false, nil
+		}
+		for waiter := owner; waiter != nil; waiter = waiter.waitingFor {
+			if waiter == tx {
+				return false, ErrDeadlockDetected
+			}
+		}
+		tx.waitingFor = owner
+		s.cond.Wait()
+		tx.waitingFor = nil
+	}
+}
+
+// unlock releases a single row lock held by tx. Must be called with s.mu held.
+func (s *MemoryStore) unlock(tx *memoryTx, key lockKey) {
+	if s.locks[key] != tx {
+		return
+	}
+	delete(s.locks, key)
+	for i, k := range tx.held {
+		if k == key {
+			tx.held = append(tx.held[:i], tx.held[i+1:]...)
+			break
+		}
+	}
+	s.cond.Broadcast()
+}
+
+// memoryTx implements TransactionPort for the in-memory store
+type memoryTx struct {
+	store      *MemoryStore
+	done       bool
+	held       []lockKey
+	undo       []func()
+	onCommit   []func()
+	savepoints []memSavepoint
+	waitingFor *memoryTx
+}
+
+// memSavepoint records how much work a transaction had done when it was created
+type memSavepoint struct {
+	name     string
+	held     int
+	undo     int
+	onCommit int
+}
+
+func (tx *memoryTx) Commit() error {
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.commitLocked()
+	return nil
+}
+
+func (tx *memoryTx) Rollback() error {
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.rollbackLocked()
+	return nil
+}
+
+func (tx *memoryTx) Savepoint(name string) error {
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.savepoints = append(tx.savepoints, memSavepoint{name: name, held: len(tx.held), undo: len(tx.undo), onCommit: len(tx.onCommit)})
+	return nil
+}
+
+func (tx *memoryTx) RollbackToSavepoint(name string) error {
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	sp := tx.savepoints[i]
+	for j := len(tx.undo) - 1; j >= sp.undo; j-- {
+		tx.undo[j]()
+	}
+	for _, key := range tx.held[sp.held:] {
+		delete(tx.store.locks, key)
+	}
+	tx.held, tx.undo, tx.onCommit = tx.held[:sp.held], tx.undo[:sp.undo], tx.onCommit[:sp.onCommit]
+	// Like Postgres, the savepoint itself survives the rollback
+	tx.savepoints = tx.savepoints[:i+1]
+	tx.store.cond.Broadcast()
+	return nil
+}
+
+func (tx *memoryTx) ReleaseSavepoint(name string) error {
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	tx.savepoints = tx.savepoints[:i]
+	return nil
+}
+
+// findSavepoint returns the index of the most recent savepoint with the name
+func (tx *memoryTx) findSavepoint(name string) (int, error) {
+	if tx.done {
+		return 0, ErrTxDone
+	}
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("savepoint %q does not exist", name)
+}
+
+func (tx *memoryTx) commitLocked() {
+	for _, fn := range tx.onCommit {
+		fn()
+	}
+	tx.finishLocked()
+}
+
+func (tx *memoryTx) rollbackLocked() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	tx.finishLocked()
+}
+
+func (tx *memoryTx) finishLocked() {
+	for _, key := range tx.held {
+		delete(tx.store.locks, key)
+	}
+	tx.held, tx.undo, tx.onCommit, tx.savepoints = nil, nil, nil, nil
+	tx.done = true
+	tx.store.cond.Broadcast()
+}
+
+// memoryTxFrom unwraps a TransactionPort created by a memory repository
+func memoryTxFrom(tx TransactionPort, store *MemoryStore) (*memoryTx, error) {
+	mtx, ok := tx.(*memoryTx)
+	if !ok || mtx.store != store {
+		return nil, errors.New("invalid transaction type")
+	}
+	if mtx.done {
+		return nil, ErrTxDone
+	}
+	return mtx, nil
+}
+
+// memVersion is a row value together with whether the row exists
+type memVersion[V any] struct {
+	value  V
+	exists bool
+}
+
+// memTable is a keyed table whose uncommitted changes are hidden from other transactions
+type memTable[K comparable, V any] struct {
+	name string
+	rows map[K]V
+	// committed holds the last committed version of rows changed by an open transaction
+	committed map[K]memVersion[V]
+}
+
+func newMemTable[K comparable, V any](name string) *memTable[K, V] {
+	return &memTable[K, V]{name: name, rows: make(map[K]V), committed: make(map[K]memVersion[V])}
+}
+
+func (t *memTable[K, V]) key(k K) lockKey {
+	return lockKey{table: t.name, key: k}
+}
+
+// get returns the row as seen by tx: its own uncommitted changes, otherwise the
+// committed version. A nil tx sees only committed data.
+func (t *memTable[K, V]) get(s *MemoryStore, tx *memoryTx, k K) (V, bool) {
+	if c, dirty := t.committed[k]; dirty && (tx == nil || s.locks[t.key(k)] != tx) {
+		return c.value, c.exists
+	}
+	v, ok := t.rows[k]
+	return v, ok
+}
+
+// put writes a row; the caller must hold the row lock
+func (t *memTable[K, V]) put(tx *memoryTx, k K, v V) {
+	t.write(tx, k, memVersion[V]{value: v, exists: true})
+}
+
+// remove deletes a row; the caller must hold the row lock
+func (t *memTable[K, V]) remove(tx *memoryTx, k K) {
+	t.write(tx, k, memVersion[V]{})
+}
+
+// keys returns the keys of the rows visible to tx
+func (t *memTable[K, V]) keys(s *MemoryStore, tx *memoryTx) []K {
+	var keys []K
+	seen := make(map[K]bool)
+	for k := range t.rows {
+		seen[k] = true
+	}
+	for k := range t.committed {
+		seen[k] = true
+	}
+	for k := range seen {
+		if _, ok := t.get(s, tx, k); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (t *memTable[K, V]) write(tx *memoryTx, k K, next memVersion[V]) {
+	prevValue, prevExists := t.rows[k]
+	if _, dirty := t.committed[k]; !dirty {
+		t.committed[k] = memVersion[V]{value: prevValue, exists: prevExists}
+		tx.undo = append(tx.undo, func() { delete(t.committed, k) })
+		tx.onCommit = append(tx.onCommit, func() { delete(t.committed, k) })
+	}
+	if next.exists {
+		t.rows[k] = next.value
+	} else {
+		delete(t.rows, k)
+	}
+	tx.undo = append(tx.undo, func() {
+		if prevExists {
+			t.rows[k] = prevValue
+		} else {
+			delete(t.rows, k)
+		}
+	})
+}
@@ -0,0 +1,545 @@
+package db
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// MemoryAccountRepository implements AccountRepositoryPort on top of a MemoryStore
+type MemoryAccountRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryAccountRepository(store *MemoryStore) *MemoryAccountRepository {
+	return &MemoryAccountRepository{store: store}
+}
+
+// BeginTx starts a new transaction and returns the abstraction
+func (repo *MemoryAccountRepository) BeginTx() (TransactionPort, error) {
+	return repo.store.begin(), nil
+}
+
+// CreateAccount creates a new account with the specified ID and initial balance
+func (repo *MemoryAccountRepository) CreateAccount(accountID int64, initialBalance decimal.Decimal) error {
+	return repo.createAccount(accountID, memAccount{balance: initialBalance, accountType: model.AccountLiability})
+}
+
+// GetAccountBalance retrieves the balance for an account, optionally within a transaction.
+// Within a transaction the account row and its shards are locked until commit or rollback.
+func (repo *MemoryAccountRepository) GetAccountBalance(tx TransactionPort, accountID int64) (decimal.Decimal, error) {
+	var mtx *memoryTx
+	if tx != nil {
+		var err error
+		if mtx, err = memoryTxFrom(tx, repo.store); err != nil {
+			return decimal.Zero, err
+		}
+	}
+
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if mtx == nil {
+		account, ok := repo.store.accounts.get(repo.store, nil, accountID)
+		if !ok {
+			return decimal.Zero, model.ErrAccountNotFound
+		}
+		return account.balance.Add(repo.store.shardTotal(nil, accountID, account.shards)), nil
+	}
+
+	account, err := repo.lockAccount(mtx, accountID)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if err := repo.lockShards(mtx, accountID, account.shards); err != nil {
+		return decimal.Zero, err
+	}
+	return account.balance.Add(repo.store.shardTotal(mtx, accountID, account.shards)), nil
+}
+
+// LockAccountForCredit checks the account exists within a transaction. The
+// account row of an unsharded account is locked; a sharded account is not, as
+// its credits lock a single shard row.
+func (repo *MemoryAccountRepository) LockAccountForCredit(tx TransactionPort, accountID int64) error {
+	mtx, err := memoryTxFrom(tx, repo.store)
+	if err != nil {
+		return err
+	}
+
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	account, ok := repo.store.accounts.get(repo.store, mtx, accountID)
+	if ok && account.shards > 0 {
+		return nil
+	}
+	_, err = repo.lockAccount(mtx, accountID)
+	return err
+}
+
+// UpdateAccountBalance updates the balance for an account within a transaction
+func (repo *MemoryAccountRepository) UpdateAccountBalance(tx TransactionPort, accountID int64, delta decimal.Decimal) error {
+	if tx == nil {
+		return fmt.Errorf("transaction is nil")
+	}
+	mtx, err := memoryTxFrom(tx, repo.store)
+	if err != nil {
+		return err
+	}
+
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if delta.IsPositive() {
+		credited, err := repo.creditShard(mtx, accountID, delta)
+		if err != nil || credited {
+			return err
+		}
+	}
+
+	account, err := repo.lockAccount(mtx, accountID)
+	if err != nil {
+		return err
+	}
+	if err := repo.lockShards(mtx, accountID, account.shards); err != nil {
+		return err
+	}
+	balance := account.balance.Add(repo.store.shardTotal(mtx, accountID, account.shards)).Add(delta)
+	if balance.IsNegative() && !account.accountType.DebitNormal() {
+		return model.ErrInsufficientFunds
+	}
+	repo.clearShards(mtx, accountID, account.shards)
+	account.balance = balance
+	repo.store.accounts.put(mtx, accountID, account)
+	return nil
+}
+
+// UpdateAccountBalances applies the updates in order within a transaction
+func (repo *MemoryAccountRepository) UpdateAccountBalances(tx TransactionPort, updates []BalanceUpdate) error {
+	for _, u := range updates {
+		if err := repo.UpdateAccountBalance(tx, u.AccountID, u.Delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransferFunds moves amount from sourceID to destID in its own transaction,
+// locking both rows in id order like the Postgres statement does
+func (repo *MemoryAccountRepository) TransferFunds(sourceID, destID int64, amount decimal.Decimal) error {
+	accounts := repo.store.accounts
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		for _, id := range []int64{min(sourceID, destID), max(sourceID, destID)} {
+			if _, err := repo.store.lock(tx, accounts.key(id)); err != nil {
+				return err
+			}
+		}
+		source, sourceOK := accounts.get(repo.store, tx, sourceID)
+		dest, destOK := accounts.get(repo.store, tx, destID)
+		if source.shards > 0 || dest.shards > 0 {
+			return ErrShardedAccount
+		}
+		if source.inHierarchy() || dest.inHierarchy() {
+			return ErrHierarchyAccount
+		}
+		if !sourceOK {
+			return model.ErrSourceAccountNotFound
+		}
+		if source.accountType.DebitNormal() {
+			return ErrDebitNormalAccount
+		}
+		if source.balance.LessThan(amount) {
+			return model.ErrInsufficientFunds
+		}
+		if !destOK {
+			return model.ErrDestinationAccountNotFound
+		}
+		source.balance = source.balance.Sub(amount)
+		dest.balance = dest.balance.Add(amount)
+		accounts.put(tx, sourceID, source)
+		accounts.put(tx, destID, dest)
+		return nil
+	})
+}
+
+// CreateTypedAccount creates an account of a type, optionally under a parent
+func (repo *MemoryAccountRepository) CreateTypedAccount(account model.Account) error {
+	return repo.createAccount(account.AccountID, memAccount{
+		balance:     account.Balance,
+		parent:      account.ParentAccountID,
+		accountType: account.Type,
+	})
+}
+
+// GetAccountType returns the type of an account
+func (repo *MemoryAccountRepository) GetAccountType(tx TransactionPort, accountID int64) (model.AccountType, error) {
+	var mtx *memoryTx
+	if tx != nil {
+		var err error
+		if mtx, err = memoryTxFrom(tx, repo.store); err != nil {
+			return "", err
+		}
+	}
+
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	account, ok := repo.store.accounts.get(repo.store, mtx, accountID)
+	if !ok {
+		return "", model.ErrAccountNotFound
+	}
+	return account.accountType, nil
+}
+
+// OpenClearingAccount creates a clearing account, or checks that the existing
+// account can be one
+func (repo *MemoryAccountRepository) OpenClearingAccount(accountID int64) error {
+	accounts := repo.store.accounts
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		if _, err := repo.store.lock(tx, accounts.key(accountID)); err != nil {
+			return err
+		}
+		account, exists := accounts.get(repo.store, tx, accountID)
+		if !exists {
+			accounts.put(tx, accountID, memAccount{balance: decimal.Zero, accountType: model.AccountAsset})
+			return nil
+		}
+		role := systemRole(accountID)
+		if account.accountType != model.AccountAsset || (role != "" && role != model.SystemClearing) {
+			return model.ErrClearingAccountInUse
+		}
+		return nil
+	})
+}
+
+// systemRole returns the role of a system account, or "" for other accounts
+func systemRole(accountID int64) model.SystemAccountRole {
+	for _, system := range model.SystemAccounts {
+		if system.AccountID == accountID {
+			return system.Role
+		}
+	}
+	return ""
+}
+
+// createAccount inserts a new account row, checking the limits of the
+// ancestors of a child account, and mirrors the constraints of the accounts table
+func (repo *MemoryAccountRepository) createAccount(accountID int64, account memAccount) error {
+	if account.balance.IsNegative() {
+		return model.ErrBalanceMustBeNonNegative
+	}
+	if !account.accountType.Valid() {
+		return model.ErrInvalidAccountType
+	}
+	accounts := repo.store.accounts
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		if _, err := repo.store.lock(tx, accounts.key(accountID)); err != nil {
+			return err
+		}
+		if _, exists := accounts.get(repo.store, tx, accountID); exists {
+			return model.ErrAccountIDAlreadyExists
+		}
+		if account.parent == 0 {
+			accounts.put(tx, accountID, account)
+			return nil
+		}
+		if _, exists := accounts.get(repo.store, tx, account.parent); !exists {
+			return model.ErrParentAccountNotFound
+		}
+		accounts.put(tx, accountID, account)
+		return repo.checkBalanceLimits(tx, []int64{accountID})
+	})
+}
+
+// SetBalanceShards folds the current shards into the account row and creates
+// the requested number of empty shards
+func (repo *MemoryAccountRepository) SetBalanceShards(accountID int64, shards int) error {
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		account, err := repo.lockAccount(tx, accountID)
+		if err != nil {
+			return err
+		}
+		if err := repo.lockShards(tx, accountID, max(account.shards, shards)); err != nil {
+			return err
+		}
+		account.balance = account.balance.Add(repo.store.shardTotal(tx, accountID, account.shards))
+		for i := shards; i < account.shards; i++ {
+			repo.store.balanceShards.remove(tx, shardKey{accountID: accountID, shard: i})
+		}
+		for i := 0; i < shards; i++ {
+			repo.store.balanceShards.put(tx, shardKey{accountID: accountID, shard: i}, decimal.Zero)
+		}
+		account.shards = shards
+		repo.store.accounts.put(tx, accountID, account)
+		return nil
+	})
+}
+
+// CompactBalanceShards folds the shards of each sharded account into its
+// account row, one account per transaction
+func (repo *MemoryAccountRepository) CompactBalanceShards() (int, error) {
+	repo.store.mu.Lock()
+	var ids []int64
+	for _, id := range repo.store.accounts.keys(repo.store, nil) {
+		if account, _ := repo.store.accounts.get(repo.store, nil, id); account.shards > 0 {
+			ids = append(ids, id)
+		}
+	}
+	repo.store.mu.Unlock()
+
+	compacted := 0
+	for _, id := range ids {
+		err := repo.store.autocommit(func(tx *memoryTx) error {
+			account, err := repo.lockAccount(tx, id)
+			if err != nil {
+				return err
+			}
+			if err := repo.lockShards(tx, id, account.shards); err != nil {
+				return err
+			}
+			account.balance = account.balance.Add(repo.store.shardTotal(tx, id, account.shards))
+			repo.clearShards(tx, id, account.shards)
+			repo.store.accounts.put(tx, id, account)
+			return nil
+		})
+		if err != nil {
+			return compacted, err
+		}
+		compacted++
+	}
+	return compacted, nil
+}
+
+// accountHierarchyLock stands in for the Postgres advisory lock held while an account moves
+var accountHierarchyLock = lockKey{table: "account_hierarchy"}
+
+// CreateChildAccount creates an account under parentID
+func (repo *MemoryAccountRepository) CreateChildAccount(accountID, parentID int64, initialBalance decimal.Decimal) error {
+	return repo.createAccount(accountID, memAccount{balance: initialBalance, parent: parentID, accountType: model.AccountLiability})
+}
+
+// SetAccountParent moves an account under parentID, or makes it a root when parentID is 0
+func (repo *MemoryAccountRepository) SetAccountParent(accountID, parentID int64) error {
+	accounts := repo.store.accounts
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		if _, err := repo.store.lock(tx, accountHierarchyLock); err != nil {
+			return err
+		}
+		if _, exists := accounts.get(repo.store, tx, parentID); parentID != 0 && !exists {
+			return model.ErrParentAccountNotFound
+		}
+		for id := parentID; id != 0; {
+			if id == accountID {
+				return model.ErrAccountHierarchyCycle
+			}
+			ancestor, _ := accounts.get(repo.store, tx, id)
+			id = ancestor.parent
+		}
+		account, err := repo.lockAccount(tx, accountID)
+		if err != nil {
+			return err
+		}
+		account.parent = parentID
+		accounts.put(tx, accountID, account)
+		return repo.checkBalanceLimits(tx, []int64{accountID})
+	})
+}
+
+// SetChildBalancePolicy changes the policy and checks it holds right away
+func (repo *MemoryAccountRepository) SetChildBalancePolicy(accountID int64, policy model.ChildBalancePolicy) error {
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		account, err := repo.lockAccount(tx, accountID)
+		if err != nil {
+			return err
+		}
+		account.childPolicy = policy
+		repo.store.accounts.put(tx, accountID, account)
+		return repo.checkBalanceLimits(tx, []int64{accountID})
+	})
+}
+
+// GetAccountTree returns the account and its descendants breadth first, each
+// level in id order
+func (repo *MemoryAccountRepository) GetAccountTree(accountID int64) ([]model.AccountNode, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if _, ok := repo.store.accounts.get(repo.store, nil, accountID); !ok {
+		return nil, model.ErrAccountNotFound
+	}
+	children := repo.children(nil)
+	var nodes []model.AccountNode
+	for level := []int64{accountID}; len(level) > 0; {
+		var next []int64
+		for _, id := range level {
+			account, _ := repo.store.accounts.get(repo.store, nil, id)
+			policy := account.childPolicy
+			if policy == "" {
+				policy = model.ChildBalanceUnlimited
+			}
+			nodes = append(nodes, model.AccountNode{
+				AccountID:       id,
+				ParentAccountID: account.parent,
+				ChildPolicy:     policy,
+				Balance:         account.balance.Add(repo.store.shardTotal(nil, id, account.shards)),
+			})
+			next = append(next, children[id]...)
+		}
+		slices.Sort(next)
+		level = next
+	}
+	return nodes, nil
+}
+
+// CheckBalanceLimits checks the limits of the accounts and their ancestors within tx
+func (repo *MemoryAccountRepository) CheckBalanceLimits(tx TransactionPort, accountIDs ...int64) error {
+	return repo.store.inTx(tx, func(mtx *memoryTx) error {
+		return repo.checkBalanceLimits(mtx, accountIDs)
+	})
+}
+
+// checkBalanceLimits locks the accounts among accountIDs and their ancestors
+// that limit their descendants, in id order, and checks each holds at least
+// what its descendants hold. Must be called with the store mutex held.
+func (repo *MemoryAccountRepository) checkBalanceLimits(tx *memoryTx, accountIDs []int64) error {
+	accounts := repo.store.accounts
+	var limiting []int64
+	seen := make(map[int64]bool)
+	for _, id := range accountIDs {
+		for id != 0 && !seen[id] {
+			seen[id] = true
+			account, ok := accounts.get(repo.store, tx, id)
+			if !ok {
+				break
+			}
+			if account.limitsChildren() {
+				limiting = append(limiting, id)
+			}
+			id = account.parent
+		}
+	}
+	if len(limiting) == 0 {
+		return nil
+	}
+	slices.Sort(limiting)
+	for _, id := range limiting {
+		if _, err := repo.lockAccount(tx, id); err != nil {
+			return err
+		}
+	}
+
+	children := repo.children(tx)
+	for _, id := range limiting {
+		descendants := decimal.Zero
+		pending := slices.Clone(children[id])
+		for len(pending) > 0 {
+			child := pending[len(pending)-1]
+			pending = append(pending[:len(pending)-1], children[child]...)
+			descendants = descendants.Add(repo.balance(tx, child))
+		}
+		if repo.balance(tx, id).LessThan(descendants) {
+			return fmt.Errorf("%w (account %d)", model.ErrChildBalanceLimitExceeded, id)
+		}
+	}
+	return nil
+}
+
+// children returns the ids of the children of each account as seen by tx.
+// Must be called with the store mutex held.
+func (repo *MemoryAccountRepository) children(tx *memoryTx) map[int64][]int64 {
+	children := make(map[int64][]int64)
+	for _, id := range repo.store.accounts.keys(repo.store, tx) {
+		if account, _ := repo.store.accounts.get(repo.store, tx, id); account.parent != 0 {
+			children[account.parent] = append(children[account.parent], id)
+		}
+	}
+	return children
+}
+
+// balance returns the balance of an account and its shards as seen by tx.
+// Must be called with the store mutex held.
+func (repo *MemoryAccountRepository) balance(tx *memoryTx, accountID int64) decimal.Decimal {
+	account, _ := repo.store.accounts.get(repo.store, tx, accountID)
+	return account.balance.Add(repo.store.shardTotal(tx, accountID, account.shards))
+}
+
+// lockAccount locks an account row and returns it as seen by tx. Like
+// SELECT ... FOR UPDATE, nothing stays locked when the row does not exist.
+// Must be called with the store mutex held.
+func (repo *MemoryAccountRepository) lockAccount(tx *memoryTx, accountID int64) (memAccount, error) {
+	accounts := repo.store.accounts
+	acquired, err := repo.store.lock(tx, accounts.key(accountID))
+	if err != nil {
+		return memAccount{}, err
+	}
+	account, ok := accounts.get(repo.store, tx, accountID)
+	if !ok {
+		if acquired {
+			repo.store.unlock(tx, accounts.key(accountID))
+		}
+		return memAccount{}, model.ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// creditShard adds delta to a random shard of a sharded account and reports
+// whether it did; unsharded accounts are credited on the account row instead.
+// Must be called with the store mutex held.
+func (repo *MemoryAccountRepository) creditShard(tx *memoryTx, accountID int64, delta decimal.Decimal) (bool, error) {
+	account, ok := repo.store.accounts.get(repo.store, tx, accountID)
+	if !ok || account.shards == 0 {
+		return false, nil
+	}
+	shards := repo.store.balanceShards
+	key := shardKey{accountID: accountID, shard: rand.IntN(account.shards)}
+	acquired, err := repo.store.lock(tx, shards.key(key))
+	if err != nil {
+		return false, err
+	}
+	balance, ok := shards.get(repo.store, tx, key)
+	if !ok {
+		// The shard was removed while waiting for its lock
+		if acquired {
+			repo.store.unlock(tx, shards.key(key))
+		}
+		return false, nil
+	}
+	shards.put(tx, key, balance.Add(delta))
+	return true, nil
+}
+
+// lockShards locks the first n shard rows of an account in shard order.
+// Must be called with the store mutex held.
+func (repo *MemoryAccountRepository) lockShards(tx *memoryTx, accountID int64, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := repo.store.lock(tx, repo.store.balanceShards.key(shardKey{accountID: accountID, shard: i})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardTotal sums the shard balances of an account as seen by tx
+func (s *MemoryStore) shardTotal(tx *memoryTx, accountID int64, n int) decimal.Decimal {
+	total := decimal.Zero
+	for i := 0; i < n; i++ {
+		if balance, ok := s.balanceShards.get(s, tx, shardKey{accountID: accountID, shard: i}); ok {
+			total = total.Add(balance)
+		}
+	}
+	return total
+}
+
+// clearShards zeroes the locked shard rows of an account after folding them
+func (repo *MemoryAccountRepository) clearShards(tx *memoryTx, accountID int64, n int) {
+	for i := 0; i < n; i++ {
+		key := shardKey{accountID: accountID, shard: i}
+		if balance, ok := repo.store.balanceShards.get(repo.store, tx, key); ok && !balance.IsZero() {
+			repo.store.balanceShards.put(tx, key, decimal.Zero)
+		}
+	}
+}
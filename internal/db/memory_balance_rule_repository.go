@@ -0,0 +1,261 @@
+package db
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// MemoryBalanceRuleRepository implements BalanceRuleRepositoryPort on top of a MemoryStore
+type MemoryBalanceRuleRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryBalanceRuleRepository(store *MemoryStore) *MemoryBalanceRuleRepository {
+	return &MemoryBalanceRuleRepository{store: store}
+}
+
+// checkBalanceRule mirrors the check constraints of the balance_rules table
+func checkBalanceRule(rule model.BalanceRule) error {
+	switch {
+	case rule.CounterpartyAccountID == rule.AccountID,
+		rule.Min == nil && rule.Max == nil,
+		rule.Min != nil && rule.Max != nil && rule.Min.GreaterThan(*rule.Max),
+		!rule.AfterTransfer && rule.Schedule == "":
+		return model.ErrInvalidBalanceRule
+	}
+	return nil
+}
+
+// CreateBalanceRule stores a new balance rule
+func (repo *MemoryBalanceRuleRepository) CreateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error) {
+	if err := checkBalanceRule(rule); err != nil {
+		return model.BalanceRule{}, err
+	}
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		repo.store.lastBalanceRuleID++
+		now := time.Now().UTC()
+		rule.ID = repo.store.lastBalanceRuleID
+		rule.CreatedAt, rule.UpdatedAt = now, now
+
+		rules := repo.store.balanceRules
+		if _, err := repo.store.lock(tx, rules.key(rule.ID)); err != nil {
+			return err
+		}
+		rules.put(tx, rule.ID, rule)
+		return nil
+	})
+	return rule, err
+}
+
+// GetBalanceRule retrieves a balance rule by id
+func (repo *MemoryBalanceRuleRepository) GetBalanceRule(id int64) (model.BalanceRule, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	rule, ok := repo.store.balanceRules.get(repo.store, nil, id)
+	if !ok {
+		return model.BalanceRule{}, model.ErrBalanceRuleNotFound
+	}
+	return rule, nil
+}
+
+// ListBalanceRules returns balance rules in id order
+func (repo *MemoryBalanceRuleRepository) ListBalanceRules(accountID int64, limit int) ([]model.BalanceRule, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var rules []model.BalanceRule
+	for _, rule := range repo.sortedRules() {
+		if len(rules) >= limit {
+			break
+		}
+		if accountID == 0 || rule.AccountID == accountID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// UpdateBalanceRule replaces the settings of a balance rule
+func (repo *MemoryBalanceRuleRepository) UpdateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error) {
+	if err := checkBalanceRule(rule); err != nil {
+		return model.BalanceRule{}, err
+	}
+	var updated model.BalanceRule
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		rules := repo.store.balanceRules
+		if _, err := repo.store.lock(tx, rules.key(rule.ID)); err != nil {
+			return err
+		}
+		current, ok := rules.get(repo.store, tx, rule.ID)
+		if !ok {
+			return model.ErrBalanceRuleNotFound
+		}
+		rule.CreatedAt, rule.UpdatedAt = current.CreatedAt, time.Now().UTC()
+		rules.put(tx, rule.ID, rule)
+		updated = rule
+		return nil
+	})
+	return updated, err
+}
+
+// DeleteBalanceRule removes a balance rule and its sweeps
+func (repo *MemoryBalanceRuleRepository) DeleteBalanceRule(id int64) error {
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		rules := repo.store.balanceRules
+		if _, err := repo.store.lock(tx, rules.key(id)); err != nil {
+			return err
+		}
+		if _, ok := rules.get(repo.store, tx, id); !ok {
+			return model.ErrBalanceRuleNotFound
+		}
+		rules.remove(tx, id)
+
+		sweeps := repo.store.ruleSweeps
+		for _, sweepID := range sweeps.keys(repo.store, tx) {
+			if sweep, _ := sweeps.get(repo.store, tx, sweepID); sweep.RuleID == id {
+				if _, err := repo.store.lock(tx, sweeps.key(sweepID)); err != nil {
+					return err
+				}
+				sweeps.remove(tx, sweepID)
+			}
+		}
+		return nil
+	})
+}
+
+// TransferTriggeredRules returns the rules to run after transfers touching the accounts
+func (repo *MemoryBalanceRuleRepository) TransferTriggeredRules(accountIDs []int64) ([]int64, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var ids []int64
+	for _, rule := range repo.sortedRules() {
+		if rule.AfterTransfer && rule.Enabled && slices.Contains(accountIDs, rule.AccountID) {
+			ids = append(ids, rule.ID)
+		}
+	}
+	return ids, nil
+}
+
+// DueBalanceRules returns the ids of enabled rules that are due
+func (repo *MemoryBalanceRuleRepository) DueBalanceRules(now time.Time, limit int) ([]int64, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var due []model.BalanceRule
+	for _, rule := range repo.sortedRules() {
+		if rule.Enabled && rule.NextRunAt != nil && !rule.NextRunAt.After(now) {
+			due = append(due, rule)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextRunAt.Before(*due[j].NextRunAt)
+	})
+	ids := make([]int64, 0, min(len(due), limit))
+	for _, rule := range due[:min(len(due), limit)] {
+		ids = append(ids, rule.ID)
+	}
+	return ids, nil
+}
+
+// AdvanceBalanceRule moves a rule on to its next run
+func (repo *MemoryBalanceRuleRepository) AdvanceBalanceRule(id int64, runAt time.Time, next *time.Time) error {
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		rules := repo.store.balanceRules
+		if _, err := repo.store.lock(tx, rules.key(id)); err != nil {
+			return err
+		}
+		rule, ok := rules.get(repo.store, tx, id)
+		if !ok || rule.NextRunAt == nil || !rule.NextRunAt.Equal(runAt) {
+			return nil
+		}
+		rule.NextRunAt = next
+		rules.put(tx, id, rule)
+		return nil
+	})
+}
+
+// LockBalanceRule takes the lock on a balance rule without waiting
+func (repo *MemoryBalanceRuleRepository) LockBalanceRule(id int64) (func(), bool, error) {
+	unlock, locked := repo.store.tryAdvisoryLock(repo.store.balanceRules.key(id))
+	return unlock, locked, nil
+}
+
+// StartRuleSweep records a sweep as processing, optionally within a transaction
+func (repo *MemoryBalanceRuleRepository) StartRuleSweep(tx TransactionPort, sweep model.BalanceRuleSweep) (model.BalanceRuleSweep, error) {
+	err := repo.store.inTx(tx, func(tx *memoryTx) error {
+		if _, ok := repo.store.balanceRules.get(repo.store, tx, sweep.RuleID); !ok {
+			return model.ErrBalanceRuleNotFound
+		}
+		repo.store.lastRuleSweepID++
+		sweep.ID = repo.store.lastRuleSweepID
+		sweep.Status = model.TransferProcessing
+		sweep.ErrorCode = ""
+		sweep.CreatedAt = time.Now().UTC()
+		sweep.FinishedAt = nil
+
+		sweeps := repo.store.ruleSweeps
+		if _, err := repo.store.lock(tx, sweeps.key(sweep.ID)); err != nil {
+			return err
+		}
+		sweeps.put(tx, sweep.ID, sweep)
+		return nil
+	})
+	if err != nil {
+		return model.BalanceRuleSweep{}, err
+	}
+	return sweep, nil
+}
+
+// FinishRuleSweep records the outcome of a sweep, optionally within a transaction
+func (repo *MemoryBalanceRuleRepository) FinishRuleSweep(tx TransactionPort, id int64, status model.TransferStatus, errorCode string) error {
+	return repo.store.inTx(tx, func(tx *memoryTx) error {
+		sweeps := repo.store.ruleSweeps
+		if _, err := repo.store.lock(tx, sweeps.key(id)); err != nil {
+			return err
+		}
+		sweep, ok := sweeps.get(repo.store, tx, id)
+		if !ok || sweep.Status != model.TransferProcessing {
+			return nil
+		}
+		now := time.Now().UTC()
+		sweep.Status, sweep.ErrorCode, sweep.FinishedAt = status, errorCode, &now
+		sweeps.put(tx, id, sweep)
+		return nil
+	})
+}
+
+// ListRuleSweeps returns the most recent sweeps of a rule
+func (repo *MemoryBalanceRuleRepository) ListRuleSweeps(ruleID int64, limit int) ([]model.BalanceRuleSweep, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var sweeps []model.BalanceRuleSweep
+	for _, id := range repo.store.ruleSweeps.keys(repo.store, nil) {
+		if sweep, _ := repo.store.ruleSweeps.get(repo.store, nil, id); sweep.RuleID == ruleID {
+			sweeps = append(sweeps, sweep)
+		}
+	}
+	sort.Slice(sweeps, func(i, j int) bool { return sweeps[i].ID > sweeps[j].ID })
+	if len(sweeps) > limit {
+		sweeps = sweeps[:limit]
+	}
+	return sweeps, nil
+}
+
+// sortedRules returns the committed rules in id order. Must be called with
+// store.mu held.
+func (repo *MemoryBalanceRuleRepository) sortedRules() []model.BalanceRule {
+	ids := repo.store.balanceRules.keys(repo.store, nil)
+	slices.Sort(ids)
+	rules := make([]model.BalanceRule, 0, len(ids))
+	for _, id := range ids {
+		rule, _ := repo.store.balanceRules.get(repo.store, nil, id)
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// MemoryExternalTransferRepository implements ExternalTransferRepositoryPort on top of a MemoryStore
+type MemoryExternalTransferRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryExternalTransferRepository(store *MemoryStore) *MemoryExternalTransferRepository {
+	return &MemoryExternalTransferRepository{store: store}
+}
+
+// CreateExternalTransfer stores a new pending deposit or withdrawal, optionally within a transaction
+func (repo *MemoryExternalTransferRepository) CreateExternalTransfer(tx TransactionPort, t model.ExternalTransfer) (model.ExternalTransfer, error) {
+	var created model.ExternalTransfer
+	err := repo.store.inTx(tx, func(mtx *memoryTx) error {
+		// The account checks stand in for the foreign keys
+		for _, id := range []int64{t.AccountID, t.ClearingAccountID} {
+			if _, ok := repo.store.accounts.get(repo.store, mtx, id); !ok {
+				return model.ErrAccountNotFound
+			}
+		}
+		if ref := t.ExternalReference; ref != "" {
+			// The reference lock stands in for the unique index
+			key := lockKey{table: "external_transfers_external_reference_idx", key: [3]string{t.ClientID, string(t.Kind), ref}}
+			if _, err := repo.store.lock(mtx, key); err != nil {
+				return err
+			}
+			if repo.referenceTaken(mtx, t) {
+				return model.ErrDuplicateExternalReference
+			}
+		}
+
+		repo.store.lastExternalTransferID++
+		now := time.Now().UTC()
+		created = model.ExternalTransfer{
+			ID:                repo.store.lastExternalTransferID,
+			Kind:              t.Kind,
+			AccountID:         t.AccountID,
+			ClearingAccountID: t.ClearingAccountID,
+			Amount:            t.Amount,
+			Status:            model.ExternalTransferPending,
+			ClientID:          t.ClientID,
+			ExternalReference: t.ExternalReference,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		transfers := repo.store.externalTransfers
+		if _, err := repo.store.lock(mtx, transfers.key(created.ID)); err != nil {
+			return err
+		}
+		transfers.put(mtx, created.ID, created)
+		return nil
+	})
+	if err != nil {
+		return model.ExternalTransfer{}, err
+	}
+	return created, nil
+}
+
+// GetExternalTransfer retrieves a deposit or withdrawal by id
+func (repo *MemoryExternalTransferRepository) GetExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	t, ok := repo.store.externalTransfers.get(repo.store, nil, id)
+	if !ok || t.Kind != kind {
+		return model.ExternalTransfer{}, model.ErrExternalTransferNotFound
+	}
+	return t, nil
+}
+
+// ListExternalTransfers returns deposits or withdrawals, newest first
+func (repo *MemoryExternalTransferRepository) ListExternalTransfers(kind model.ExternalTransferKind, accountID int64, limit int) ([]model.ExternalTransfer, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	ids := repo.store.externalTransfers.keys(repo.store, nil)
+	slices.Sort(ids)
+	var transfers []model.ExternalTransfer
+	for i := len(ids) - 1; i >= 0 && len(transfers) < limit; i-- {
+		t, _ := repo.store.externalTransfers.get(repo.store, nil, ids[i])
+		if t.Kind == kind && (accountID == 0 || t.AccountID == accountID) {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
+
+// LockExternalTransfer reads a deposit or withdrawal within tx, locking it until tx ends
+func (repo *MemoryExternalTransferRepository) LockExternalTransfer(tx TransactionPort, kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error) {
+	if tx == nil {
+		return model.ExternalTransfer{}, fmt.Errorf("transaction is nil")
+	}
+	var t model.ExternalTransfer
+	err := repo.store.inTx(tx, func(mtx *memoryTx) error {
+		transfers := repo.store.externalTransfers
+		acquired, err := repo.store.lock(mtx, transfers.key(id))
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if t, ok = transfers.get(repo.store, mtx, id); !ok || t.Kind != kind {
+			// Like SELECT ... FOR UPDATE, nothing stays locked without a matching row
+			if acquired {
+				repo.store.unlock(mtx, transfers.key(id))
+			}
+			return model.ErrExternalTransferNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return model.ExternalTransfer{}, err
+	}
+	return t, nil
+}
+
+// SetExternalTransferStatus changes the status of a locked deposit or withdrawal within tx
+func (repo *MemoryExternalTransferRepository) SetExternalTransferStatus(tx TransactionPort, id int64, status model.ExternalTransferStatus) (model.ExternalTransfer, error) {
+	if tx == nil {
+		return model.ExternalTransfer{}, fmt.Errorf("transaction is nil")
+	}
+	var t model.ExternalTransfer
+	err := repo.store.inTx(tx, func(mtx *memoryTx) error {
+		transfers := repo.store.externalTransfers
+		if _, err := repo.store.lock(mtx, transfers.key(id)); err != nil {
+			return err
+		}
+		var ok bool
+		if t, ok = transfers.get(repo.store, mtx, id); !ok {
+			return model.ErrExternalTransferNotFound
+		}
+		t.Status = status
+		t.UpdatedAt = time.Now().UTC()
+		transfers.put(mtx, id, t)
+		return nil
+	})
+	if err != nil {
+		return model.ExternalTransfer{}, err
+	}
+	return t, nil
+}
+
+// referenceTaken reports whether the client already used the external
+// reference of t for the same kind, as seen by tx. Must be called with the
+// store mutex held.
+func (repo *MemoryExternalTransferRepository) referenceTaken(tx *memoryTx, t model.ExternalTransfer) bool {
+	for _, id := range repo.store.externalTransfers.keys(repo.store, tx) {
+		other, _ := repo.store.externalTransfers.get(repo.store, tx, id)
+		if other.ClientID == t.ClientID && other.Kind == t.Kind && other.ExternalReference == t.ExternalReference {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// MemoryFeeScheduleRepository implements FeeScheduleRepositoryPort on top of a MemoryStore
+type MemoryFeeScheduleRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryFeeScheduleRepository(store *MemoryStore) *MemoryFeeScheduleRepository {
+	return &MemoryFeeScheduleRepository{store: store}
+}
+
+// checkFeeSchedule mirrors the check constraints of the fee schedule tables
+func checkFeeSchedule(s model.FeeSchedule) error {
+	if !s.Kind.Valid() || (s.AccountType != "" && !s.AccountType.Valid()) || s.Flat.IsNegative() || s.Rate.IsNegative() || s.MinFee.IsNegative() ||
+		(!s.MaxFee.IsZero() && s.MaxFee.LessThan(s.MinFee)) {
+		return model.ErrInvalidFeeSchedule
+	}
+	seen := make(map[string]bool, len(s.Tiers))
+	for _, tier := range s.Tiers {
+		if tier.MinAmount.IsNegative() || tier.Flat.IsNegative() || tier.Rate.IsNegative() || seen[tier.MinAmount.String()] {
+			return model.ErrInvalidFeeSchedule
+		}
+		seen[tier.MinAmount.String()] = true
+	}
+	return nil
+}
+
+// CreateFeeSchedule stores a new fee schedule with its tiers
+func (repo *MemoryFeeScheduleRepository) CreateFeeSchedule(s model.FeeSchedule) (model.FeeSchedule, error) {
+	if err := checkFeeSchedule(s); err != nil {
+		return model.FeeSchedule{}, err
+	}
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		// The client and type lock stands in for the unique index
+		key := lockKey{table: "fee_schedules_client_id_account_type_key", key: [2]string{s.ClientID, string(s.AccountType)}}
+		if _, err := repo.store.lock(tx, key); err != nil {
+			return err
+		}
+		if _, taken := repo.find(tx, s.ClientID, s.AccountType); taken {
+			return model.ErrFeeScheduleExists
+		}
+
+		repo.store.lastFeeScheduleID++
+		s.ID = repo.store.lastFeeScheduleID
+		s.CreatedAt = time.Now().UTC()
+		s.Tiers = slices.Clone(s.Tiers)
+		sort.Slice(s.Tiers, func(i, j int) bool { return s.Tiers[i].MinAmount.LessThan(s.Tiers[j].MinAmount) })
+
+		schedules := repo.store.feeSchedules
+		if _, err := repo.store.lock(tx, schedules.key(s.ID)); err != nil {
+			return err
+		}
+		schedules.put(tx, s.ID, s)
+		return nil
+	})
+	if err != nil {
+		return model.FeeSchedule{}, err
+	}
+	return s, nil
+}
+
+// GetFeeSchedule retrieves a fee schedule by id
+func (repo *MemoryFeeScheduleRepository) GetFeeSchedule(id int64) (model.FeeSchedule, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	s, ok := repo.store.feeSchedules.get(repo.store, nil, id)
+	if !ok {
+		return model.FeeSchedule{}, model.ErrFeeScheduleNotFound
+	}
+	return s, nil
+}
+
+// ListFeeSchedules returns fee schedules in id order
+func (repo *MemoryFeeScheduleRepository) ListFeeSchedules(limit int) ([]model.FeeSchedule, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	ids := repo.store.feeSchedules.keys(repo.store, nil)
+	slices.Sort(ids)
+	var schedules []model.FeeSchedule
+	for _, id := range ids[:min(len(ids), limit)] {
+		s, _ := repo.store.feeSchedules.get(repo.store, nil, id)
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// DeleteFeeSchedule removes a fee schedule. The fees of the transfers it
+// charged lose their schedule id, like the ON DELETE SET NULL foreign key.
+func (repo *MemoryFeeScheduleRepository) DeleteFeeSchedule(id int64) error {
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		schedules := repo.store.feeSchedules
+		if _, err := repo.store.lock(tx, schedules.key(id)); err != nil {
+			return err
+		}
+		if _, ok := schedules.get(repo.store, tx, id); !ok {
+			return model.ErrFeeScheduleNotFound
+		}
+		schedules.remove(tx, id)
+
+		transfers := repo.store.transfers
+		for _, transferID := range transfers.keys(repo.store, tx) {
+			transfer, _ := transfers.get(repo.store, tx, transferID)
+			if transfer.Fee == nil || transfer.Fee.ScheduleID != id {
+				continue
+			}
+			if _, err := repo.store.lock(tx, transfers.key(transferID)); err != nil {
+				return err
+			}
+			fee := *transfer.Fee
+			fee.ScheduleID = 0
+			transfer.Fee = &fee
+			transfers.put(tx, transferID, transfer)
+		}
+		return nil
+	})
+}
+
+// FindFeeSchedule returns the schedule charging a client for a transfer from
+// an account of a type
+func (repo *MemoryFeeScheduleRepository) FindFeeSchedule(clientID string, accountType model.AccountType) (model.FeeSchedule, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	for _, client := range []string{clientID, ""} {
+		for _, typ := range []model.AccountType{accountType, ""} {
+			if s, ok := repo.find(nil, client, typ); ok {
+				return s, nil
+			}
+		}
+	}
+	return model.FeeSchedule{}, model.ErrFeeScheduleNotFound
+}
+
+// find returns the schedule with a client id and account type as seen by tx.
+// Must be called with the store mutex held.
+func (repo *MemoryFeeScheduleRepository) find(tx *memoryTx, clientID string, accountType model.AccountType) (model.FeeSchedule, bool) {
+	for _, id := range repo.store.feeSchedules.keys(repo.store, tx) {
+		s, _ := repo.store.feeSchedules.get(repo.store, tx, id)
+		if s.ClientID == clientID && s.AccountType == accountType {
+			return s, true
+		}
+	}
+	return model.FeeSchedule{}, false
+}
@@ -0,0 +1,468 @@
+package db
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// MemoryInterestRepository implements InterestRepositoryPort on top of a MemoryStore
+type MemoryInterestRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryInterestRepository(store *MemoryStore) *MemoryInterestRepository {
+	return &MemoryInterestRepository{store: store}
+}
+
+// checkInterestProduct mirrors the check constraints of the interest product tables
+func checkInterestProduct(p model.InterestProduct) error {
+	if !p.Method.Valid() || (p.DayCount != 360 && p.DayCount != 365) {
+		return model.ErrInvalidInterestProduct
+	}
+	seen := make(map[string]bool, len(p.Tiers))
+	for _, tier := range p.Tiers {
+		if tier.MinBalance.IsNegative() || tier.Rate.IsNegative() || seen[tier.MinBalance.String()] {
+			return model.ErrInvalidInterestProduct
+		}
+		seen[tier.MinBalance.String()] = true
+	}
+	return nil
+}
+
+// dayKey truncates a day to the date Postgres stores
+func dayKey(day time.Time) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// CreateInterestProduct stores a new interest product with its tiers
+func (repo *MemoryInterestRepository) CreateInterestProduct(p model.InterestProduct) (model.InterestProduct, error) {
+	if err := checkInterestProduct(p); err != nil {
+		return model.InterestProduct{}, err
+	}
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		repo.store.lastInterestProductID++
+		p.ID = repo.store.lastInterestProductID
+		p.CreatedAt = time.Now().UTC()
+		p.Tiers = slices.Clone(p.Tiers)
+		sort.Slice(p.Tiers, func(i, j int) bool { return p.Tiers[i].MinBalance.LessThan(p.Tiers[j].MinBalance) })
+
+		products := repo.store.interestProducts
+		if _, err := repo.store.lock(tx, products.key(p.ID)); err != nil {
+			return err
+		}
+		products.put(tx, p.ID, p)
+		return nil
+	})
+	return p, err
+}
+
+// GetInterestProduct retrieves an interest product by id
+func (repo *MemoryInterestRepository) GetInterestProduct(id int64) (model.InterestProduct, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	p, ok := repo.store.interestProducts.get(repo.store, nil, id)
+	if !ok {
+		return model.InterestProduct{}, model.ErrInterestProductNotFound
+	}
+	return p, nil
+}
+
+// ListInterestProducts returns interest products in id order
+func (repo *MemoryInterestRepository) ListInterestProducts(limit int) ([]model.InterestProduct, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	ids := repo.store.interestProducts.keys(repo.store, nil)
+	slices.Sort(ids)
+	var products []model.InterestProduct
+	for _, id := range ids[:min(len(ids), limit)] {
+		p, _ := repo.store.interestProducts.get(repo.store, nil, id)
+		products = append(products, p)
+	}
+	return products, nil
+}
+
+// SetAccountInterest sets the product accruing on an account
+func (repo *MemoryInterestRepository) SetAccountInterest(accountID, productID int64, from time.Time) (model.AccountInterest, error) {
+	var ai model.AccountInterest
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		if _, ok := repo.store.interestProducts.get(repo.store, tx, productID); productID != 0 && !ok {
+			return model.ErrInterestProductNotFound
+		}
+		if _, ok := repo.store.accounts.get(repo.store, tx, accountID); !ok {
+			return model.ErrAccountNotFound
+		}
+		states := repo.store.accountInterest
+		if _, err := repo.store.lock(tx, states.key(accountID)); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		current, exists := states.get(repo.store, tx, accountID)
+		if !exists {
+			ai = model.AccountInterest{
+				AccountID:      accountID,
+				NextAccrualDay: dayKey(from),
+				CreatedAt:      now,
+			}
+		} else {
+			ai = current
+			if ai.ProductID == 0 && dayKey(from).After(ai.NextAccrualDay) {
+				ai.NextAccrualDay = dayKey(from)
+			}
+		}
+		ai.ProductID, ai.UpdatedAt = productID, now
+		states.put(tx, accountID, ai)
+		return nil
+	})
+	if err != nil {
+		return model.AccountInterest{}, err
+	}
+	return ai, nil
+}
+
+// GetAccountInterest returns the interest state of an account
+func (repo *MemoryInterestRepository) GetAccountInterest(accountID int64) (model.AccountInterest, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	ai, ok := repo.store.accountInterest.get(repo.store, nil, accountID)
+	if !ok {
+		return model.AccountInterest{}, model.ErrInterestNotAssigned
+	}
+	return ai, nil
+}
+
+// DueAccruals returns the accounts with days to accrue
+func (repo *MemoryInterestRepository) DueAccruals(day time.Time, limit int) ([]int64, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var due []model.AccountInterest
+	for _, ai := range repo.sortedStates() {
+		if ai.ProductID != 0 && !ai.NextAccrualDay.After(dayKey(day)) {
+			due = append(due, ai)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAccrualDay.Before(due[j].NextAccrualDay) })
+	ids := make([]int64, 0, min(len(due), limit))
+	for _, ai := range due[:min(len(due), limit)] {
+		ids = append(ids, ai.AccountID)
+	}
+	return ids, nil
+}
+
+// AccrueInterest stores one day of interest of an account
+func (repo *MemoryInterestRepository) AccrueInterest(accrual model.InterestAccrual) error {
+	accrual.Day = dayKey(accrual.Day)
+	accrual.PostingID = 0
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		states := repo.store.accountInterest
+		if _, err := repo.store.lock(tx, states.key(accrual.AccountID)); err != nil {
+			return err
+		}
+		ai, ok := states.get(repo.store, tx, accrual.AccountID)
+		if !ok || ai.ProductID != accrual.ProductID || !ai.NextAccrualDay.Equal(accrual.Day) {
+			return ErrAccrualConflict
+		}
+		accruals := repo.store.interestAccruals
+		key := accrualKey{accountID: accrual.AccountID, day: accrual.Day.Unix()}
+		if _, err := repo.store.lock(tx, accruals.key(key)); err != nil {
+			return err
+		}
+		if _, exists := accruals.get(repo.store, tx, key); exists {
+			return ErrAccrualConflict
+		}
+		accruals.put(tx, key, accrual)
+
+		ai.NextAccrualDay = accrual.Day.AddDate(0, 0, 1)
+		ai.Accrued = ai.Accrued.Add(accrual.Amount)
+		ai.UpdatedAt = time.Now().UTC()
+		states.put(tx, accrual.AccountID, ai)
+
+		// The snapshot of the day is kept for a next day without one
+		balances := repo.store.interestBalances
+		for _, key := range balances.keys(repo.store, tx) {
+			if key.accountID != accrual.AccountID || key.day >= accrual.Day.Unix() {
+				continue
+			}
+			if _, err := repo.store.lock(tx, balances.key(key)); err != nil {
+				return err
+			}
+			balances.remove(tx, key)
+		}
+		return nil
+	})
+}
+
+// SnapshotBalances records the balances of the accounts with a product
+func (repo *MemoryInterestRepository) SnapshotBalances(day time.Time) (int, error) {
+	day = dayKey(day)
+	n := 0
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		states := repo.store.accountInterest
+		for _, id := range states.keys(repo.store, tx) {
+			if ai, _ := states.get(repo.store, tx, id); ai.ProductID == 0 {
+				continue
+			}
+			account, ok := repo.store.accounts.get(repo.store, tx, id)
+			if !ok {
+				continue
+			}
+			balances := repo.store.interestBalances
+			key := accrualKey{accountID: id, day: day.Unix()}
+			if _, err := repo.store.lock(tx, balances.key(key)); err != nil {
+				return err
+			}
+			balances.put(tx, key, model.BalanceSnapshot{
+				AccountID: id,
+				Day:       day,
+				Balance:   account.balance.Add(repo.store.shardTotal(tx, id, account.shards)),
+			})
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// BalanceSnapshots returns the balance snapshots of an account over a range of days
+func (repo *MemoryInterestRepository) BalanceSnapshots(accountID int64, from, to time.Time) ([]model.BalanceSnapshot, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var snapshots []model.BalanceSnapshot
+	balances := repo.store.interestBalances
+	for _, key := range balances.keys(repo.store, nil) {
+		b, _ := balances.get(repo.store, nil, key)
+		if b.AccountID == accountID && !b.Day.Before(dayKey(from)) && !b.Day.After(dayKey(to)) {
+			snapshots = append(snapshots, b)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Day.Before(snapshots[j].Day) })
+	return snapshots, nil
+}
+
+// DuePostings returns the accounts with interest to post for a period
+func (repo *MemoryInterestRepository) DuePostings(periodEnd time.Time, limit int) ([]int64, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	periodEnd = dayKey(periodEnd)
+	pending := make(map[int64]bool)
+	for _, a := range repo.accruals(nil) {
+		if a.PostingID == 0 && !a.Day.After(periodEnd) {
+			pending[a.AccountID] = true
+		}
+	}
+	posted := make(map[int64]bool)
+	for _, id := range repo.store.interestPostings.keys(repo.store, nil) {
+		if p, _ := repo.store.interestPostings.get(repo.store, nil, id); p.PeriodEnd.Equal(periodEnd) {
+			posted[p.AccountID] = true
+		}
+	}
+	var ids []int64
+	for _, ai := range repo.sortedStates() {
+		if len(ids) >= limit {
+			break
+		}
+		accruedThrough := ai.ProductID == 0 || ai.NextAccrualDay.After(periodEnd)
+		if accruedThrough && pending[ai.AccountID] && !posted[ai.AccountID] {
+			ids = append(ids, ai.AccountID)
+		}
+	}
+	return ids, nil
+}
+
+// StartInterestPosting records a posting as processing and claims its
+// accruals, optionally within a transaction
+func (repo *MemoryInterestRepository) StartInterestPosting(tx TransactionPort, accountID int64, periodStart, periodEnd time.Time) (model.InterestPosting, error) {
+	var posting model.InterestPosting
+	err := repo.store.inTx(tx, func(tx *memoryTx) error {
+		states := repo.store.accountInterest
+		if _, err := repo.store.lock(tx, states.key(accountID)); err != nil {
+			return err
+		}
+		ai, ok := states.get(repo.store, tx, accountID)
+		if !ok {
+			return model.ErrInterestNotAssigned
+		}
+		posting = model.InterestPosting{
+			AccountID:       accountID,
+			PeriodStart:     dayKey(periodStart),
+			PeriodEnd:       dayKey(periodEnd),
+			CarriedResidual: ai.Residual,
+			Status:          model.TransferProcessing,
+			CreatedAt:       time.Now().UTC(),
+		}
+		postings := repo.store.interestPostings
+		for _, id := range postings.keys(repo.store, tx) {
+			if p, _ := postings.get(repo.store, tx, id); p.AccountID == accountID && p.PeriodEnd.Equal(posting.PeriodEnd) {
+				return ErrPostingExists
+			}
+		}
+		repo.store.lastInterestPostingID++
+		posting.ID = repo.store.lastInterestPostingID
+
+		accruals := repo.store.interestAccruals
+		for _, a := range repo.accruals(tx) {
+			if a.AccountID != accountID || a.PostingID != 0 || a.Day.After(posting.PeriodEnd) {
+				continue
+			}
+			key := accrualKey{accountID: accountID, day: a.Day.Unix()}
+			if _, err := repo.store.lock(tx, accruals.key(key)); err != nil {
+				return err
+			}
+			a.PostingID = posting.ID
+			accruals.put(tx, key, a)
+			posting.Accrued = posting.Accrued.Add(a.Amount)
+		}
+		if _, err := repo.store.lock(tx, postings.key(posting.ID)); err != nil {
+			return err
+		}
+		postings.put(tx, posting.ID, posting)
+
+		ai.Accrued = ai.Accrued.Sub(posting.Accrued)
+		ai.UpdatedAt = time.Now().UTC()
+		states.put(tx, accountID, ai)
+		return nil
+	})
+	if err != nil {
+		return model.InterestPosting{}, err
+	}
+	return posting, nil
+}
+
+// FinishInterestPosting records the outcome of a posting, optionally within a
+// transaction
+func (repo *MemoryInterestRepository) FinishInterestPosting(tx TransactionPort, id int64, status model.TransferStatus, errorCode string, amount, residual decimal.Decimal) error {
+	return repo.store.inTx(tx, func(tx *memoryTx) error {
+		postings := repo.store.interestPostings
+		if _, err := repo.store.lock(tx, postings.key(id)); err != nil {
+			return err
+		}
+		posting, ok := postings.get(repo.store, tx, id)
+		if !ok || posting.Status != model.TransferProcessing {
+			return nil
+		}
+		now := time.Now().UTC()
+		posting.Status, posting.ErrorCode, posting.FinishedAt = status, errorCode, &now
+		posting.Amount, posting.Residual = amount, residual
+		postings.put(tx, id, posting)
+		if status != model.TransferCompleted {
+			return repo.release(tx, posting)
+		}
+
+		states := repo.store.accountInterest
+		if _, err := repo.store.lock(tx, states.key(posting.AccountID)); err != nil {
+			return err
+		}
+		ai, _ := states.get(repo.store, tx, posting.AccountID)
+		ai.Residual, ai.UpdatedAt = residual, now
+		states.put(tx, posting.AccountID, ai)
+		return nil
+	})
+}
+
+// release unlinks the accruals of a posting and adds them back to the
+// unposted interest of its account
+func (repo *MemoryInterestRepository) release(tx *memoryTx, posting model.InterestPosting) error {
+	accruals := repo.store.interestAccruals
+	for _, a := range repo.accruals(tx) {
+		if a.PostingID != posting.ID {
+			continue
+		}
+		key := accrualKey{accountID: a.AccountID, day: a.Day.Unix()}
+		if _, err := repo.store.lock(tx, accruals.key(key)); err != nil {
+			return err
+		}
+		a.PostingID = 0
+		accruals.put(tx, key, a)
+	}
+
+	states := repo.store.accountInterest
+	if _, err := repo.store.lock(tx, states.key(posting.AccountID)); err != nil {
+		return err
+	}
+	ai, _ := states.get(repo.store, tx, posting.AccountID)
+	ai.Accrued = ai.Accrued.Add(posting.Accrued)
+	ai.UpdatedAt = time.Now().UTC()
+	states.put(tx, posting.AccountID, ai)
+	return nil
+}
+
+// ListInterestAccruals returns the most recent accruals of an account
+func (repo *MemoryInterestRepository) ListInterestAccruals(accountID int64, limit int) ([]model.InterestAccrual, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var accruals []model.InterestAccrual
+	for _, a := range repo.accruals(nil) {
+		if a.AccountID == accountID {
+			accruals = append(accruals, a)
+		}
+	}
+	sort.Slice(accruals, func(i, j int) bool { return accruals[i].Day.After(accruals[j].Day) })
+	if len(accruals) > limit {
+		accruals = accruals[:limit]
+	}
+	return accruals, nil
+}
+
+// ListInterestPostings returns the most recent postings of an account
+func (repo *MemoryInterestRepository) ListInterestPostings(accountID int64, limit int) ([]model.InterestPosting, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var postings []model.InterestPosting
+	for _, id := range repo.store.interestPostings.keys(repo.store, nil) {
+		if p, _ := repo.store.interestPostings.get(repo.store, nil, id); p.AccountID == accountID {
+			postings = append(postings, p)
+		}
+	}
+	sort.Slice(postings, func(i, j int) bool { return postings[i].ID > postings[j].ID })
+	if len(postings) > limit {
+		postings = postings[:limit]
+	}
+	return postings, nil
+}
+
+// LockAccountInterest takes the interest lock of an account without waiting
+func (repo *MemoryInterestRepository) LockAccountInterest(accountID int64) (func(), bool, error) {
+	unlock, locked := repo.store.tryAdvisoryLock(repo.store.accountInterest.key(accountID))
+	return unlock, locked, nil
+}
+
+// accruals returns the accruals visible to tx. Must be called with store.mu held.
+func (repo *MemoryInterestRepository) accruals(tx *memoryTx) []model.InterestAccrual {
+	table := repo.store.interestAccruals
+	keys := table.keys(repo.store, tx)
+	accruals := make([]model.InterestAccrual, 0, len(keys))
+	for _, key := range keys {
+		a, _ := table.get(repo.store, tx, key)
+		accruals = append(accruals, a)
+	}
+	return accruals
+}
+
+// sortedStates returns the committed account interest rows in account order.
+// Must be called with store.mu held.
+func (repo *MemoryInterestRepository) sortedStates() []model.AccountInterest {
+	ids := repo.store.accountInterest.keys(repo.store, nil)
+	slices.Sort(ids)
+	states := make([]model.AccountInterest, 0, len(ids))
+	for _, id := range ids {
+		ai, _ := repo.store.accountInterest.get(repo.store, nil, id)
+		states = append(states, ai)
+	}
+	return states
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// MemoryStandingOrderRepository implements StandingOrderRepositoryPort on top of a MemoryStore
+type MemoryStandingOrderRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryStandingOrderRepository(store *MemoryStore) *MemoryStandingOrderRepository {
+	return &MemoryStandingOrderRepository{store: store}
+}
+
+// CreateStandingOrder stores a new active standing order
+func (repo *MemoryStandingOrderRepository) CreateStandingOrder(order model.StandingOrder) (model.StandingOrder, error) {
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		repo.store.lastStandingOrderID++
+		now := time.Now().UTC()
+		order.ID = repo.store.lastStandingOrderID
+		order.Occurrences = 0
+		order.Status = model.StandingOrderActive
+		order.CreatedAt, order.UpdatedAt = now, now
+
+		orders := repo.store.standingOrders
+		if _, err := repo.store.lock(tx, orders.key(order.ID)); err != nil {
+			return err
+		}
+		orders.put(tx, order.ID, order)
+		return nil
+	})
+	return order, err
+}
+
+// GetStandingOrder retrieves a standing order by id
+func (repo *MemoryStandingOrderRepository) GetStandingOrder(id int64) (model.StandingOrder, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	order, ok := repo.store.standingOrders.get(repo.store, nil, id)
+	if !ok {
+		return model.StandingOrder{}, model.ErrStandingOrderNotFound
+	}
+	return order, nil
+}
+
+// ListStandingOrders returns standing orders in id order
+func (repo *MemoryStandingOrderRepository) ListStandingOrders(status model.StandingOrderStatus, limit int) ([]model.StandingOrder, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	ids := repo.store.standingOrders.keys(repo.store, nil)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var orders []model.StandingOrder
+	for _, id := range ids {
+		if len(orders) >= limit {
+			break
+		}
+		order, _ := repo.store.standingOrders.get(repo.store, nil, id)
+		if status == "" || order.Status == status {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// CancelStandingOrder stops an active standing order
+func (repo *MemoryStandingOrderRepository) CancelStandingOrder(id int64) (model.StandingOrder, error) {
+	var cancelled model.StandingOrder
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		orders := repo.store.standingOrders
+		if _, err := repo.store.lock(tx, orders.key(id)); err != nil {
+			return err
+		}
+		order, ok := orders.get(repo.store, tx, id)
+		if !ok {
+			return model.ErrStandingOrderNotFound
+		}
+		if order.Status != model.StandingOrderActive {
+			return model.ErrStandingOrderNotActive
+		}
+		order.Status = model.StandingOrderCancelled
+		order.NextOccurrenceAt, order.NextRunAt = nil, nil
+		order.UpdatedAt = time.Now().UTC()
+		orders.put(tx, id, order)
+		cancelled = order
+		return nil
+	})
+	return cancelled, err
+}
+
+// DueStandingOrders returns the ids of active standing orders that are due
+func (repo *MemoryStandingOrderRepository) DueStandingOrders(now time.Time, limit int) ([]int64, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var due []model.StandingOrder
+	for _, id := range repo.store.standingOrders.keys(repo.store, nil) {
+		order, _ := repo.store.standingOrders.get(repo.store, nil, id)
+		if order.Status == model.StandingOrderActive && order.NextRunAt != nil && !order.NextRunAt.After(now) {
+			due = append(due, order)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		a, b := due[i], due[j]
+		if !a.NextRunAt.Equal(*b.NextRunAt) {
+			return a.NextRunAt.Before(*b.NextRunAt)
+		}
+		return a.ID < b.ID
+	})
+	ids := make([]int64, 0, min(len(due), limit))
+	for _, order := range due[:min(len(due), limit)] {
+		ids = append(ids, order.ID)
+	}
+	return ids, nil
+}
+
+// LockStandingOrder takes the lock on a standing order without waiting
+func (repo *MemoryStandingOrderRepository) LockStandingOrder(id int64) (func(), bool, error) {
+	unlock, locked := repo.store.tryAdvisoryLock(repo.store.standingOrders.key(id))
+	return unlock, locked, nil
+}
+
+// StartOccurrence records an occurrence as processing, optionally within a transaction
+func (repo *MemoryStandingOrderRepository) StartOccurrence(tx TransactionPort, orderID int64, scheduledFor time.Time) error {
+	return repo.store.inTx(tx, func(tx *memoryTx) error {
+		if _, ok := repo.store.standingOrders.get(repo.store, tx, orderID); !ok {
+			return fmt.Errorf("standing order %d does not exist", orderID)
+		}
+		occurrences := repo.store.occurrences
+		key := occurrenceKey{orderID: orderID, scheduledFor: scheduledFor.UnixMicro()}
+		if _, err := repo.store.lock(tx, occurrences.key(key)); err != nil {
+			return err
+		}
+		if _, exists := occurrences.get(repo.store, tx, key); exists {
+			return ErrOccurrenceExists
+		}
+		occurrences.put(tx, key, model.StandingOrderOccurrence{
+			StandingOrderID: orderID,
+			ScheduledFor:    scheduledFor,
+			Status:          model.TransferProcessing,
+			StartedAt:       time.Now().UTC(),
+		})
+		return nil
+	})
+}
+
+// FinishOccurrence records the outcome of an occurrence and advances its
+// order, optionally within a transaction
+func (repo *MemoryStandingOrderRepository) FinishOccurrence(tx TransactionPort, orderID int64, scheduledFor time.Time, status model.TransferStatus, errorCode string, next, nextRunAt *time.Time) error {
+	return repo.store.inTx(tx, func(tx *memoryTx) error {
+		now := time.Now().UTC()
+		occurrences := repo.store.occurrences
+		key := occurrenceKey{orderID: orderID, scheduledFor: scheduledFor.UnixMicro()}
+		if _, err := repo.store.lock(tx, occurrences.key(key)); err != nil {
+			return err
+		}
+		if occurrence, ok := occurrences.get(repo.store, tx, key); ok && occurrence.Status == model.TransferProcessing {
+			occurrence.Status = status
+			occurrence.ErrorCode = errorCode
+			occurrence.FinishedAt = &now
+			occurrences.put(tx, key, occurrence)
+		}
+
+		orders := repo.store.standingOrders
+		if _, err := repo.store.lock(tx, orders.key(orderID)); err != nil {
+			return err
+		}
+		order, ok := orders.get(repo.store, tx, orderID)
+		due := ok && order.NextOccurrenceAt != nil && order.NextOccurrenceAt.Equal(scheduledFor)
+		if !due && !(ok && order.Status == model.StandingOrderCancelled) {
+			return fmt.Errorf("standing order %d is no longer due at %v", orderID, scheduledFor)
+		}
+		order.Occurrences++
+		if order.Status == model.StandingOrderActive {
+			order.NextOccurrenceAt, order.NextRunAt = next, nextRunAt
+			if next == nil {
+				order.Status = model.StandingOrderCompleted
+			}
+		}
+		order.UpdatedAt = now
+		orders.put(tx, orderID, order)
+		return nil
+	})
+}
+
+// ListOccurrences returns the most recent occurrences of a standing order
+func (repo *MemoryStandingOrderRepository) ListOccurrences(orderID int64, limit int) ([]model.StandingOrderOccurrence, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var occurrences []model.StandingOrderOccurrence
+	for _, key := range repo.store.occurrences.keys(repo.store, nil) {
+		if key.orderID == orderID {
+			occurrence, _ := repo.store.occurrences.get(repo.store, nil, key)
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].ScheduledFor.After(occurrences[j].ScheduledFor)
+	})
+	if len(occurrences) > limit {
+		occurrences = occurrences[:limit]
+	}
+	return occurrences, nil
+}
@@ -0,0 +1,341 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// MemoryTransferRepository implements TransferRepositoryPort on top of a MemoryStore
+type MemoryTransferRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryTransferRepository(store *MemoryStore) *MemoryTransferRepository {
+	return &MemoryTransferRepository{store: store}
+}
+
+// CreateTransfer stores a new pending or scheduled transfer
+func (repo *MemoryTransferRepository) CreateTransfer(transfer model.Transfer) (model.Transfer, error) {
+	if transfer.ExecuteAt != nil && transfer.RetryUntil != nil && !transfer.RetryUntil.After(*transfer.ExecuteAt) {
+		return model.Transfer{}, model.ErrRetryDeadlineBeforeExecution
+	}
+	status := model.TransferPending
+	if transfer.ExecuteAt != nil {
+		status = model.TransferScheduled
+	}
+	var created model.Transfer
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		var err error
+		created, err = repo.insert(tx, transfer, status)
+		return err
+	})
+	return created, err
+}
+
+// BookTransfer stores a completed transfer, optionally within a transaction
+func (repo *MemoryTransferRepository) BookTransfer(tx TransactionPort, transfer model.Transfer) (model.Transfer, error) {
+	transfer.ExecuteAt, transfer.RetryUntil = nil, nil
+	var booked model.Transfer
+	err := repo.store.inTx(tx, func(mtx *memoryTx) error {
+		var err error
+		booked, err = repo.insert(mtx, transfer, model.TransferCompleted)
+		return err
+	})
+	return booked, err
+}
+
+// insert stores a new transfer with status, keeping external references
+// unique per client. Must be called with the store mutex held.
+func (repo *MemoryTransferRepository) insert(tx *memoryTx, transfer model.Transfer, status model.TransferStatus) (model.Transfer, error) {
+	transfers := repo.store.transfers
+	if ref := transfer.ExternalReference; ref != "" {
+		// The reference lock stands in for the unique index: a second insert
+		// waits for the first to commit or roll back
+		if _, err := repo.store.lock(tx, lockKey{table: "transfers_external_reference_idx", key: [2]string{transfer.ClientID, ref}}); err != nil {
+			return model.Transfer{}, err
+		}
+		if _, taken := repo.findByReference(tx, transfer.ClientID, ref); taken {
+			return model.Transfer{}, model.ErrDuplicateExternalReference
+		}
+	}
+
+	kind := transfer.Kind
+	if kind == "" {
+		kind = model.TransferKindTransfer
+	}
+
+	// The fee mode is not stored; the fee keeps the mode it was charged with
+	transfer.FeeMode = ""
+	if transfer.Fee != nil {
+		fee := *transfer.Fee
+		transfer.Fee = &fee
+	}
+
+	repo.store.lastTransferID++
+	now := time.Now().UTC()
+	transfer = model.Transfer{
+		ID:                   repo.store.lastTransferID,
+		SourceAccountID:      transfer.SourceAccountID,
+		DestinationAccountID: transfer.DestinationAccountID,
+		Amount:               transfer.Amount,
+		Status:               status,
+		Kind:                 kind,
+		TransferDetails:      transfer.TransferDetails,
+		Fee:                  transfer.Fee,
+		ParentID:             transfer.ParentID,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+		ExecuteAt:            transfer.ExecuteAt,
+		RetryUntil:           transfer.RetryUntil,
+		NextAttemptAt:        transfer.ExecuteAt,
+	}
+	if _, err := repo.store.lock(tx, transfers.key(transfer.ID)); err != nil {
+		return model.Transfer{}, err
+	}
+	transfers.put(tx, transfer.ID, transfer)
+	return transfer, nil
+}
+
+// findByReference returns the transfer of a client with an external reference
+// as seen by tx. Must be called with the store mutex held.
+func (repo *MemoryTransferRepository) findByReference(tx *memoryTx, clientID, reference string) (model.Transfer, bool) {
+	for _, id := range repo.store.transfers.keys(repo.store, tx) {
+		transfer, _ := repo.store.transfers.get(repo.store, tx, id)
+		if transfer.ClientID == clientID && transfer.ExternalReference == reference {
+			return transfer, true
+		}
+	}
+	return model.Transfer{}, false
+}
+
+// GetTransfer retrieves a transfer by id
+func (repo *MemoryTransferRepository) GetTransfer(id int64) (model.Transfer, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	transfer, ok := repo.store.transfers.get(repo.store, nil, id)
+	if !ok {
+		return model.Transfer{}, model.ErrTransferNotFound
+	}
+	return transfer, nil
+}
+
+// GetTransferByReference retrieves the transfer of a client by its external reference
+func (repo *MemoryTransferRepository) GetTransferByReference(clientID, reference string) (model.Transfer, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	transfer, ok := repo.findByReference(nil, clientID, reference)
+	if !ok || reference == "" {
+		return model.Transfer{}, model.ErrTransferNotFound
+	}
+	return transfer, nil
+}
+
+// ListScheduledTransfers returns transfers with an execution time in execution order
+func (repo *MemoryTransferRepository) ListScheduledTransfers(status model.TransferStatus, limit int) ([]model.Transfer, error) {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var scheduled []model.Transfer
+	for _, id := range repo.store.transfers.keys(repo.store, nil) {
+		transfer, _ := repo.store.transfers.get(repo.store, nil, id)
+		if transfer.ExecuteAt != nil && (status == "" || transfer.Status == status) {
+			scheduled = append(scheduled, transfer)
+		}
+	}
+	sort.Slice(scheduled, func(i, j int) bool {
+		a, b := scheduled[i], scheduled[j]
+		if !a.ExecuteAt.Equal(*b.ExecuteAt) {
+			return a.ExecuteAt.Before(*b.ExecuteAt)
+		}
+		return a.ID < b.ID
+	})
+	if len(scheduled) > limit {
+		scheduled = scheduled[:limit]
+	}
+	return scheduled, nil
+}
+
+// CancelTransfer cancels a scheduled transfer that has not started yet
+func (repo *MemoryTransferRepository) CancelTransfer(id int64) (model.Transfer, error) {
+	var cancelled model.Transfer
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		transfers := repo.store.transfers
+		if _, err := repo.store.lock(tx, transfers.key(id)); err != nil {
+			return err
+		}
+		transfer, ok := transfers.get(repo.store, tx, id)
+		if !ok || transfer.ExecuteAt == nil {
+			return model.ErrTransferNotFound
+		}
+		if transfer.Status != model.TransferScheduled {
+			return model.ErrTransferNotCancellable
+		}
+		transfer.Status = model.TransferCancelled
+		transfer.UpdatedAt = time.Now().UTC()
+		transfers.put(tx, id, transfer)
+		cancelled = transfer
+		return nil
+	})
+	return cancelled, err
+}
+
+// ClaimTransfers marks up to limit claimable transfers as processing. Rows
+// locked by another transaction are skipped, like FOR UPDATE SKIP LOCKED.
+func (repo *MemoryTransferRepository) ClaimTransfers(limit int, lease time.Duration) ([]model.Transfer, error) {
+	var claimed []model.Transfer
+	err := repo.store.autocommit(func(tx *memoryTx) error {
+		transfers := repo.store.transfers
+		ids := transfers.keys(repo.store, tx)
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		now := time.Now().UTC()
+		for _, id := range ids {
+			if len(claimed) >= limit {
+				break
+			}
+			if _, locked := repo.store.locks[transfers.key(id)]; locked {
+				continue
+			}
+			transfer, _ := transfers.get(repo.store, tx, id)
+			due := transfer.Status == model.TransferScheduled && !transfer.NextAttemptAt.After(now)
+			expired := transfer.Status == model.TransferProcessing && transfer.UpdatedAt.Before(now.Add(-lease))
+			if transfer.Status != model.TransferPending && !due && !expired {
+				continue
+			}
+			if _, err := repo.store.lock(tx, transfers.key(id)); err != nil {
+				return err
+			}
+			transfer.Status = model.TransferProcessing
+			transfer.Attempts++
+			transfer.UpdatedAt = now
+			transfers.put(tx, id, transfer)
+			claimed = append(claimed, transfer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// FinishTransfer records the outcome of a claimed transfer, optionally within a transaction
+func (repo *MemoryTransferRepository) FinishTransfer(tx TransactionPort, id int64, attempt int, status model.TransferStatus, errorCode string) error {
+	return repo.store.inTx(tx, func(mtx *memoryTx) error {
+		return repo.updateClaimed(mtx, id, attempt, func(transfer *model.Transfer) {
+			transfer.Status = status
+			transfer.ErrorCode = errorCode
+		})
+	})
+}
+
+// RetryTransfer returns a claimed transfer to scheduled after a failed attempt
+func (repo *MemoryTransferRepository) RetryTransfer(id int64, attempt int, next time.Time, errorCode string) error {
+	return repo.store.autocommit(func(tx *memoryTx) error {
+		return repo.updateClaimed(tx, id, attempt, func(transfer *model.Transfer) {
+			transfer.Status = model.TransferScheduled
+			transfer.NextAttemptAt = &next
+			transfer.ErrorCode = errorCode
+		})
+	})
+}
+
+// CreateReversal stores a reversal of a completed transfer, optionally within a transaction
+func (repo *MemoryTransferRepository) CreateReversal(tx TransactionPort, originalID int64, amount decimal.Decimal, status model.TransferStatus, retryUntil *time.Time) (model.Transfer, error) {
+	var reversal model.Transfer
+	err := repo.store.inTx(tx, func(mtx *memoryTx) error {
+		transfers := repo.store.transfers
+		if _, err := repo.store.lock(mtx, transfers.key(originalID)); err != nil {
+			return err
+		}
+		original, ok := transfers.get(repo.store, mtx, originalID)
+		if !ok {
+			return model.ErrTransferNotFound
+		}
+		if original.Status != model.TransferCompleted || original.Kind != model.TransferKindTransfer || original.ReversalOf != nil {
+			return model.ErrTransferNotReversible
+		}
+		reversed := decimal.Zero
+		for _, id := range transfers.keys(repo.store, mtx) {
+			transfer, _ := transfers.get(repo.store, mtx, id)
+			if transfer.ReversalOf != nil && *transfer.ReversalOf == originalID &&
+				transfer.Status != model.TransferFailed && transfer.Status != model.TransferCancelled {
+				reversed = reversed.Add(transfer.Amount)
+			}
+		}
+		amount, err := reversalAmount(original.Credited(), reversed, amount)
+		if err != nil {
+			return err
+		}
+
+		repo.store.lastTransferID++
+		now := time.Now().UTC()
+		reversal = model.Transfer{
+			ID:                   repo.store.lastTransferID,
+			SourceAccountID:      original.DestinationAccountID,
+			DestinationAccountID: original.SourceAccountID,
+			Amount:               amount,
+			Status:               status,
+			Kind:                 model.TransferKindTransfer,
+			CreatedAt:            now,
+			UpdatedAt:            now,
+			RetryUntil:           retryUntil,
+			ReversalOf:           &originalID,
+		}
+		if _, err := repo.store.lock(mtx, transfers.key(reversal.ID)); err != nil {
+			return err
+		}
+		transfers.put(mtx, reversal.ID, reversal)
+		return nil
+	})
+	return reversal, err
+}
+
+// ListReversals returns the reversals of a transfer in id order
+func (repo *MemoryTransferRepository) ListReversals(originalID int64) ([]model.Transfer, error) {
+	return repo.listLinked(func(transfer model.Transfer) *int64 { return transfer.ReversalOf }, originalID), nil
+}
+
+// ListLegs returns the legs of a split in id order
+func (repo *MemoryTransferRepository) ListLegs(parentID int64) ([]model.Transfer, error) {
+	return repo.listLinked(func(transfer model.Transfer) *int64 { return transfer.ParentID }, parentID), nil
+}
+
+// listLinked returns the committed transfers whose link is id, in id order
+func (repo *MemoryTransferRepository) listLinked(link func(model.Transfer) *int64, id int64) []model.Transfer {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	var linked []model.Transfer
+	for _, key := range repo.store.transfers.keys(repo.store, nil) {
+		transfer, _ := repo.store.transfers.get(repo.store, nil, key)
+		if ref := link(transfer); ref != nil && *ref == id {
+			linked = append(linked, transfer)
+		}
+	}
+	sort.Slice(linked, func(i, j int) bool { return linked[i].ID < linked[j].ID })
+	return linked
+}
+
+// updateClaimed locks a transfer and applies update if it is still processing
+// under attempt. Must be called with the store mutex held.
+func (repo *MemoryTransferRepository) updateClaimed(tx *memoryTx, id int64, attempt int, update func(*model.Transfer)) error {
+	transfers := repo.store.transfers
+	if _, err := repo.store.lock(tx, transfers.key(id)); err != nil {
+		return err
+	}
+	transfer, ok := transfers.get(repo.store, tx, id)
+	if !ok || transfer.Status != model.TransferProcessing || transfer.Attempts != attempt {
+		return ErrTransferClaimLost
+	}
+	update(&transfer)
+	transfer.UpdatedAt = time.Now().UTC()
+	transfers.put(tx, id, transfer)
+	return nil
+}
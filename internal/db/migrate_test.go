@@ -0,0 +1,58 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"internal-transfers/internal/db/migrations"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations_SortsAndPairs(t *testing.T) {
+	source := fstest.MapFS{
+		"0002_add_index.up.sql":         {Data: []byte("CREATE INDEX")},
+		"0002_add_index.down.sql":       {Data: []byte("DROP INDEX")},
+		"0001_create_accounts.up.sql":   {Data: []byte("CREATE TABLE")},
+		"0001_create_accounts.down.sql": {Data: []byte("DROP TABLE")},
+		"README.md":                     {Data: []byte("ignored")},
+	}
+
+	list, err := loadMigrations(source)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, int64(1), list[0].Version)
+	assert.Equal(t, "create_accounts", list[0].Name)
+	assert.Equal(t, "CREATE TABLE", list[0].Up)
+	assert.Equal(t, "DROP TABLE", list[0].Down)
+	assert.Equal(t, int64(2), list[1].Version)
+}
+
+func TestLoadMigrations_MissingUp(t *testing.T) {
+	source := fstest.MapFS{
+		"0001_create_accounts.down.sql": {Data: []byte("DROP TABLE")},
+	}
+
+	_, err := loadMigrations(source)
+	assert.ErrorContains(t, err, "no up script")
+}
+
+func TestLoadMigrations_ConflictingNames(t *testing.T) {
+	source := fstest.MapFS{
+		"0001_create_accounts.up.sql": {Data: []byte("CREATE TABLE")},
+		"0001_other_name.down.sql":    {Data: []byte("DROP TABLE")},
+	}
+
+	_, err := loadMigrations(source)
+	assert.ErrorContains(t, err, "conflicting names")
+}
+
+func TestEmbeddedMigrations_ParseAndAreContiguous(t *testing.T) {
+	list, err := loadMigrations(migrations.FS)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, list)
+	for i, m := range list {
+		assert.Equal(t, int64(i+1), m.Version, "migration versions must be contiguous")
+		assert.NotEmpty(t, m.Down, "migration %d_%s has no down script", m.Version, m.Name)
+	}
+}
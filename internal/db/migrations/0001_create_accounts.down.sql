@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS set_updated_at ON accounts;
+DROP FUNCTION IF EXISTS update_updated_at_column();
+DROP TABLE IF EXISTS accounts;
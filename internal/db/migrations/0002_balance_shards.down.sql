@@ -0,0 +1,12 @@
+-- Fold the shard balances back into the accounts before dropping them
+UPDATE accounts a
+SET balance = a.balance + s.total
+FROM (
+    SELECT account_id, SUM(balance) AS total
+    FROM account_balance_shards
+    GROUP BY account_id
+) s
+WHERE a.account_id = s.account_id;
+
+DROP TABLE IF EXISTS account_balance_shards;
+ALTER TABLE accounts DROP COLUMN IF EXISTS balance_shards;
@@ -0,0 +1,11 @@
+-- Hot accounts can spread credits over several shard rows; the balance of an
+-- account is accounts.balance plus the sum of its shard balances
+ALTER TABLE accounts
+    ADD COLUMN balance_shards INT NOT NULL DEFAULT 0 CHECK (balance_shards >= 0);
+
+CREATE TABLE IF NOT EXISTS account_balance_shards (
+    account_id BIGINT NOT NULL REFERENCES accounts (account_id) ON DELETE CASCADE,
+    shard INT NOT NULL CHECK (shard >= 0),
+    balance NUMERIC(20, 8) NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    PRIMARY KEY (account_id, shard)
+);
@@ -0,0 +1,20 @@
+-- Asynchronous transfers. Workers claim pending rows with FOR UPDATE SKIP LOCKED
+-- and record the outcome in the same transaction as the balance changes.
+-- The account ids are not foreign keys: a transfer to a missing account is
+-- accepted and fails with a domain error code when processed.
+CREATE TABLE IF NOT EXISTS transfers (
+    id BIGSERIAL PRIMARY KEY,
+    source_account_id BIGINT NOT NULL,
+    destination_account_id BIGINT NOT NULL,
+    amount NUMERIC(20, 8) NOT NULL CHECK (amount > 0),
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'processing', 'completed', 'failed')),
+    error_code TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Keeps the claim query cheap once most transfers are finished
+CREATE INDEX IF NOT EXISTS transfers_unfinished_idx
+    ON transfers (id) WHERE status IN ('pending', 'processing');
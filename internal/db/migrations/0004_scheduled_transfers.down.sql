@@ -0,0 +1,15 @@
+-- Scheduled and cancelled transfers never moved funds and cannot be represented
+-- without the schedule columns
+DELETE FROM transfers WHERE status IN ('scheduled', 'cancelled');
+
+DROP INDEX IF EXISTS transfers_execute_at_idx;
+DROP INDEX IF EXISTS transfers_due_idx;
+
+ALTER TABLE transfers
+    DROP CONSTRAINT transfers_retry_until_check,
+    DROP CONSTRAINT transfers_status_check,
+    ADD CONSTRAINT transfers_status_check
+        CHECK (status IN ('pending', 'processing', 'completed', 'failed')),
+    DROP COLUMN next_attempt_at,
+    DROP COLUMN retry_until,
+    DROP COLUMN execute_at;
@@ -0,0 +1,17 @@
+-- Scheduled transfers wait in status 'scheduled' until next_attempt_at, which
+-- starts at execute_at and moves forward while failed attempts are retried
+-- until retry_until
+ALTER TABLE transfers
+    ADD COLUMN execute_at TIMESTAMPTZ,
+    ADD COLUMN retry_until TIMESTAMPTZ,
+    ADD COLUMN next_attempt_at TIMESTAMPTZ,
+    DROP CONSTRAINT transfers_status_check,
+    ADD CONSTRAINT transfers_status_check
+        CHECK (status IN ('pending', 'scheduled', 'processing', 'completed', 'failed', 'cancelled')),
+    ADD CONSTRAINT transfers_retry_until_check CHECK (retry_until > execute_at);
+
+CREATE INDEX IF NOT EXISTS transfers_due_idx
+    ON transfers (next_attempt_at) WHERE status = 'scheduled';
+
+CREATE INDEX IF NOT EXISTS transfers_execute_at_idx
+    ON transfers (execute_at, id) WHERE execute_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS standing_order_occurrences;
+DROP TABLE IF EXISTS standing_orders;
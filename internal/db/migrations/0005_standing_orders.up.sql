@@ -0,0 +1,31 @@
+-- Standing orders repeat a transfer on a schedule. next_run_at is the next
+-- occurrence while the order is active and NULL afterwards.
+CREATE TABLE IF NOT EXISTS standing_orders (
+    id BIGSERIAL PRIMARY KEY,
+    source_account_id BIGINT NOT NULL,
+    destination_account_id BIGINT NOT NULL,
+    amount NUMERIC(20, 8) NOT NULL CHECK (amount > 0),
+    schedule TEXT NOT NULL,
+    start_at TIMESTAMPTZ NOT NULL,
+    end_at TIMESTAMPTZ CHECK (end_at >= start_at),
+    max_occurrences INTEGER NOT NULL DEFAULT 0 CHECK (max_occurrences >= 0),
+    occurrences INTEGER NOT NULL DEFAULT 0,
+    next_run_at TIMESTAMPTZ,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'completed', 'cancelled')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS standing_orders_due_idx
+    ON standing_orders (next_run_at) WHERE status = 'active';
+
+-- One row per occurrence; the primary key keeps an occurrence from running twice
+CREATE TABLE IF NOT EXISTS standing_order_occurrences (
+    standing_order_id BIGINT NOT NULL REFERENCES standing_orders (id) ON DELETE CASCADE,
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('processing', 'completed', 'failed')),
+    error_code TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ,
+    PRIMARY KEY (standing_order_id, scheduled_for)
+);
@@ -0,0 +1,6 @@
+-- Orders go back to running at their unadjusted occurrences
+UPDATE standing_orders SET next_run_at = next_occurrence_at;
+
+ALTER TABLE standing_orders
+    DROP COLUMN next_occurrence_at,
+    DROP COLUMN business_day_rule;
@@ -0,0 +1,9 @@
+-- next_occurrence_at is the next occurrence of the schedule, and next_run_at
+-- when it is due once moved to a business day. Existing orders keep running
+-- on calendar days.
+ALTER TABLE standing_orders
+    ADD COLUMN business_day_rule TEXT NOT NULL DEFAULT 'none'
+        CHECK (business_day_rule IN ('none', 'following', 'modified-following', 'preceding')),
+    ADD COLUMN next_occurrence_at TIMESTAMPTZ;
+
+UPDATE standing_orders SET next_occurrence_at = next_run_at;
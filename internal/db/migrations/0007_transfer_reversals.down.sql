@@ -0,0 +1,5 @@
+-- Reversals stay as plain transfers in the opposite direction
+DROP INDEX IF EXISTS transfers_reversal_of_idx;
+
+ALTER TABLE transfers
+    DROP COLUMN reversal_of;
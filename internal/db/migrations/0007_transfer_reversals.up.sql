@@ -0,0 +1,7 @@
+-- A reversal moves funds back from the destination of a completed transfer to
+-- its source; reversal_of links it to the original transfer
+ALTER TABLE transfers
+    ADD COLUMN reversal_of BIGINT REFERENCES transfers (id);
+
+CREATE INDEX IF NOT EXISTS transfers_reversal_of_idx
+    ON transfers (reversal_of) WHERE reversal_of IS NOT NULL;
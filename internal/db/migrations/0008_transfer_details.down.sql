@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS transfers_external_reference_idx;
+
+ALTER TABLE transfers
+    DROP COLUMN metadata,
+    DROP COLUMN external_reference,
+    DROP COLUMN description,
+    DROP COLUMN client_id;
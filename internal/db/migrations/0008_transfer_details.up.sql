@@ -0,0 +1,11 @@
+-- Details supplied by the client that submitted a transfer. External
+-- references are unique per client, so a transfer can be found by its
+-- reference and submitted again without being applied twice.
+ALTER TABLE transfers
+    ADD COLUMN client_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN description TEXT,
+    ADD COLUMN external_reference TEXT,
+    ADD COLUMN metadata JSONB;
+
+CREATE UNIQUE INDEX IF NOT EXISTS transfers_external_reference_idx
+    ON transfers (client_id, external_reference) WHERE external_reference IS NOT NULL;
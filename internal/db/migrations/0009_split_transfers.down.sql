@@ -0,0 +1,12 @@
+-- Legs stay as plain transfers; split parents have no destination and go
+DROP INDEX IF EXISTS transfers_parent_id_idx;
+
+ALTER TABLE transfers
+    DROP COLUMN parent_id;
+
+DELETE FROM transfers WHERE kind = 'split';
+
+ALTER TABLE transfers
+    DROP CONSTRAINT transfers_destination_check,
+    ALTER COLUMN destination_account_id SET NOT NULL,
+    DROP COLUMN kind;
@@ -0,0 +1,11 @@
+-- A split debits one source and credits several destinations. Its parent row
+-- has no destination; each leg is a transfer to one destination with
+-- parent_id set.
+ALTER TABLE transfers
+    ADD COLUMN kind TEXT NOT NULL DEFAULT 'transfer' CHECK (kind IN ('transfer', 'split')),
+    ADD COLUMN parent_id BIGINT REFERENCES transfers (id),
+    ALTER COLUMN destination_account_id DROP NOT NULL,
+    ADD CONSTRAINT transfers_destination_check CHECK (destination_account_id IS NOT NULL OR kind = 'split');
+
+CREATE INDEX IF NOT EXISTS transfers_parent_id_idx
+    ON transfers (parent_id) WHERE parent_id IS NOT NULL;
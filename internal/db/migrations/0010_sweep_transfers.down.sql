@@ -0,0 +1,11 @@
+-- Legs stay as plain transfers; sweep parents have no source and go
+UPDATE transfers SET parent_id = NULL
+WHERE parent_id IN (SELECT id FROM transfers WHERE kind = 'sweep');
+
+DELETE FROM transfers WHERE kind = 'sweep';
+
+ALTER TABLE transfers
+    DROP CONSTRAINT transfers_source_check,
+    ALTER COLUMN source_account_id SET NOT NULL,
+    DROP CONSTRAINT transfers_kind_check,
+    ADD CONSTRAINT transfers_kind_check CHECK (kind IN ('transfer', 'split'));
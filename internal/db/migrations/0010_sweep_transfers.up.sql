@@ -0,0 +1,7 @@
+-- A sweep pulls funds from several sources into one destination. Its parent
+-- row has no source; each leg is a transfer from one source with parent_id set.
+ALTER TABLE transfers
+    DROP CONSTRAINT transfers_kind_check,
+    ADD CONSTRAINT transfers_kind_check CHECK (kind IN ('transfer', 'split', 'sweep')),
+    ALTER COLUMN source_account_id DROP NOT NULL,
+    ADD CONSTRAINT transfers_source_check CHECK (source_account_id IS NOT NULL OR kind = 'sweep');
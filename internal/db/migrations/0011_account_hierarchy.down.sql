@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS accounts_parent_account_id_idx;
+
+ALTER TABLE accounts
+    DROP CONSTRAINT accounts_parent_check,
+    DROP COLUMN child_policy,
+    DROP COLUMN parent_account_id;
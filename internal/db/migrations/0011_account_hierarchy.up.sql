@@ -0,0 +1,9 @@
+-- Accounts form trees, such as company, department and cost center.
+-- child_policy limits the balances of the descendants of an account.
+ALTER TABLE accounts
+    ADD COLUMN parent_account_id BIGINT REFERENCES accounts (account_id),
+    ADD COLUMN child_policy TEXT NOT NULL DEFAULT 'none' CHECK (child_policy IN ('none', 'within_parent_balance')),
+    ADD CONSTRAINT accounts_parent_check CHECK (parent_account_id <> account_id);
+
+CREATE INDEX IF NOT EXISTS accounts_parent_account_id_idx
+    ON accounts (parent_account_id) WHERE parent_account_id IS NOT NULL;
@@ -0,0 +1,42 @@
+-- Balance rules keep an account between bounds by moving funds to or from a
+-- counterparty, after each transfer touching the account and/or on a schedule.
+-- next_run_at is the next scheduled run of an enabled rule and NULL otherwise.
+CREATE TABLE IF NOT EXISTS balance_rules (
+    id BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL,
+    counterparty_account_id BIGINT NOT NULL CHECK (counterparty_account_id <> account_id),
+    min_balance NUMERIC(20, 8),
+    max_balance NUMERIC(20, 8),
+    after_transfer BOOLEAN NOT NULL DEFAULT false,
+    schedule TEXT NOT NULL DEFAULT '',
+    next_run_at TIMESTAMPTZ,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (min_balance IS NOT NULL OR max_balance IS NOT NULL),
+    CHECK (min_balance <= max_balance),
+    CHECK (after_transfer OR schedule <> '')
+);
+
+CREATE INDEX IF NOT EXISTS balance_rules_account_idx
+    ON balance_rules (account_id) WHERE after_transfer AND enabled;
+CREATE INDEX IF NOT EXISTS balance_rules_due_idx
+    ON balance_rules (next_run_at) WHERE enabled;
+
+-- One row per transfer made by a rule, recorded as processing before the
+-- funds move
+CREATE TABLE IF NOT EXISTS balance_rule_sweeps (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id BIGINT NOT NULL REFERENCES balance_rules (id) ON DELETE CASCADE,
+    triggered_by TEXT NOT NULL CHECK (triggered_by IN ('after_transfer', 'schedule')),
+    source_account_id BIGINT NOT NULL,
+    destination_account_id BIGINT NOT NULL,
+    amount NUMERIC(20, 8) NOT NULL CHECK (amount > 0),
+    status TEXT NOT NULL CHECK (status IN ('processing', 'completed', 'failed')),
+    error_code TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS balance_rule_sweeps_rule_id_idx
+    ON balance_rule_sweeps (rule_id, id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS interest_accruals;
+DROP TABLE IF EXISTS interest_postings;
+DROP TABLE IF EXISTS account_interest;
+DROP TABLE IF EXISTS interest_product_tiers;
+DROP TABLE IF EXISTS interest_products;
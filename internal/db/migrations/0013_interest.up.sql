@@ -0,0 +1,66 @@
+-- Interest products accrue daily at annual rates tiered by balance band: each
+-- tier's rate applies to the part of the balance from its min_balance up to
+-- the next tier.
+CREATE TABLE IF NOT EXISTS interest_products (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    method TEXT NOT NULL CHECK (method IN ('simple', 'compound')),
+    day_count INT NOT NULL CHECK (day_count IN (360, 365)),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS interest_product_tiers (
+    product_id BIGINT NOT NULL REFERENCES interest_products (id) ON DELETE CASCADE,
+    min_balance NUMERIC(20, 8) NOT NULL CHECK (min_balance >= 0),
+    rate NUMERIC(12, 8) NOT NULL CHECK (rate >= 0),
+    PRIMARY KEY (product_id, min_balance)
+);
+
+-- The interest state of an account. product_id is NULL once the account no
+-- longer accrues; its unposted interest is still posted. Interest amounts
+-- keep 20 decimal places, rounded to the money precision only when posted.
+CREATE TABLE IF NOT EXISTS account_interest (
+    account_id BIGINT PRIMARY KEY REFERENCES accounts (account_id),
+    product_id BIGINT REFERENCES interest_products (id),
+    next_accrual_day DATE NOT NULL,
+    accrued NUMERIC(38, 20) NOT NULL DEFAULT 0,
+    residual NUMERIC(38, 20) NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS account_interest_accrual_idx
+    ON account_interest (next_accrual_day) WHERE product_id IS NOT NULL;
+
+-- One row per monthly posting, recorded as processing before the funds move
+CREATE TABLE IF NOT EXISTS interest_postings (
+    id BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES account_interest (account_id),
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    accrued NUMERIC(38, 20) NOT NULL,
+    carried_residual NUMERIC(38, 20) NOT NULL,
+    amount NUMERIC(20, 8) NOT NULL DEFAULT 0,
+    residual NUMERIC(38, 20) NOT NULL DEFAULT 0,
+    status TEXT NOT NULL CHECK (status IN ('processing', 'completed', 'failed')),
+    error_code TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ,
+    UNIQUE (account_id, period_end)
+);
+
+-- One row per account and day accrued; posting_id is NULL until posted
+CREATE TABLE IF NOT EXISTS interest_accruals (
+    account_id BIGINT NOT NULL REFERENCES account_interest (account_id),
+    day DATE NOT NULL,
+    product_id BIGINT NOT NULL REFERENCES interest_products (id),
+    base NUMERIC(38, 20) NOT NULL,
+    amount NUMERIC(38, 20) NOT NULL,
+    posting_id BIGINT REFERENCES interest_postings (id) ON DELETE SET NULL,
+    PRIMARY KEY (account_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS interest_accruals_unposted_idx
+    ON interest_accruals (account_id, day) WHERE posting_id IS NULL;
+CREATE INDEX IF NOT EXISTS interest_accruals_posting_idx
+    ON interest_accruals (posting_id);
@@ -0,0 +1,9 @@
+ALTER TABLE transfers
+    DROP CONSTRAINT transfers_fee_check,
+    DROP COLUMN fee_mode,
+    DROP COLUMN fee_amount,
+    DROP COLUMN fee_account_id,
+    DROP COLUMN fee_schedule_id;
+
+DROP TABLE IF EXISTS fee_schedule_tiers;
+DROP TABLE IF EXISTS fee_schedules;
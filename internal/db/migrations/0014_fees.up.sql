@@ -0,0 +1,34 @@
+-- Fee schedules charge the transfers of a client; the schedule with an empty
+-- client id charges every client without one of its own. A zero max_fee does
+-- not cap the fee.
+CREATE TABLE IF NOT EXISTS fee_schedules (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    client_id TEXT NOT NULL DEFAULT '' UNIQUE,
+    kind TEXT NOT NULL CHECK (kind IN ('flat', 'percentage', 'tiered')),
+    flat_fee NUMERIC(20, 8) NOT NULL DEFAULT 0 CHECK (flat_fee >= 0),
+    rate NUMERIC(12, 8) NOT NULL DEFAULT 0 CHECK (rate >= 0),
+    min_fee NUMERIC(20, 8) NOT NULL DEFAULT 0 CHECK (min_fee >= 0),
+    max_fee NUMERIC(20, 8) NOT NULL DEFAULT 0 CHECK (max_fee = 0 OR max_fee >= min_fee),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- The tier of a transfer is the one with the largest min_amount not above
+-- its amount
+CREATE TABLE IF NOT EXISTS fee_schedule_tiers (
+    schedule_id BIGINT NOT NULL REFERENCES fee_schedules (id) ON DELETE CASCADE,
+    min_amount NUMERIC(20, 8) NOT NULL CHECK (min_amount >= 0),
+    flat_fee NUMERIC(20, 8) NOT NULL DEFAULT 0 CHECK (flat_fee >= 0),
+    rate NUMERIC(12, 8) NOT NULL DEFAULT 0 CHECK (rate >= 0),
+    PRIMARY KEY (schedule_id, min_amount)
+);
+
+-- The fee charged with a transfer, credited to fee_account_id in the same
+-- transaction as the transfer's funds
+ALTER TABLE transfers
+    ADD COLUMN fee_schedule_id BIGINT REFERENCES fee_schedules (id) ON DELETE SET NULL,
+    ADD COLUMN fee_account_id BIGINT,
+    ADD COLUMN fee_amount NUMERIC(20, 8) CHECK (fee_amount > 0),
+    ADD COLUMN fee_mode TEXT CHECK (fee_mode IN ('on_top', 'deducted')),
+    ADD CONSTRAINT transfers_fee_check
+        CHECK ((fee_account_id IS NULL) = (fee_amount IS NULL) AND (fee_amount IS NULL) = (fee_mode IS NULL));
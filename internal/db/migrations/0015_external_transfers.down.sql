@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS external_transfers;
+
+ALTER TABLE accounts
+    DROP CONSTRAINT accounts_balance_check,
+    ADD CONSTRAINT accounts_balance_check CHECK (balance >= 0),
+    DROP COLUMN overdraft_allowed;
@@ -0,0 +1,28 @@
+-- Clearing accounts stand for funds held outside the system, so they may go
+-- negative; every other account keeps a non-negative balance
+ALTER TABLE accounts
+    ADD COLUMN overdraft_allowed BOOLEAN NOT NULL DEFAULT false,
+    DROP CONSTRAINT accounts_balance_check,
+    ADD CONSTRAINT accounts_balance_check CHECK (balance >= 0 OR overdraft_allowed);
+
+-- Deposits and withdrawals move funds between a customer account and a
+-- clearing account. A deposit credits the account when it settles; a
+-- withdrawal debits it when it is made and is returned if it fails.
+CREATE TABLE IF NOT EXISTS external_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('deposit', 'withdrawal')),
+    account_id BIGINT NOT NULL REFERENCES accounts (account_id),
+    clearing_account_id BIGINT NOT NULL REFERENCES accounts (account_id),
+    amount NUMERIC(20, 8) NOT NULL CHECK (amount > 0),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'settled', 'failed')),
+    client_id TEXT NOT NULL DEFAULT '',
+    external_reference TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (account_id <> clearing_account_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS external_transfers_external_reference_idx
+    ON external_transfers (client_id, kind, external_reference) WHERE external_reference IS NOT NULL;
+CREATE INDEX IF NOT EXISTS external_transfers_account_idx
+    ON external_transfers (kind, account_id, id);
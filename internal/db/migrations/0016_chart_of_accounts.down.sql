@@ -0,0 +1,24 @@
+-- A client keeps a single schedule: the one without a type, else its oldest
+DELETE FROM fee_schedules f
+WHERE account_type <> ''
+  AND EXISTS (
+    SELECT 1 FROM fee_schedules o WHERE o.client_id = f.client_id AND (o.account_type = '' OR o.id < f.id)
+  );
+
+ALTER TABLE fee_schedules
+    DROP CONSTRAINT fee_schedules_client_id_account_type_key,
+    ADD CONSTRAINT fee_schedules_client_id_key UNIQUE (client_id),
+    DROP COLUMN account_type;
+
+-- The system accounts stay as plain accounts, as transfers may refer to them;
+-- debit-normal accounts keep going negative as overdrawn ones
+ALTER TABLE accounts
+    ADD COLUMN overdraft_allowed BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE accounts SET overdraft_allowed = true WHERE account_type IN ('asset', 'expense');
+
+ALTER TABLE accounts
+    DROP CONSTRAINT accounts_balance_check,
+    ADD CONSTRAINT accounts_balance_check CHECK (balance >= 0 OR overdraft_allowed),
+    DROP COLUMN system_account,
+    DROP COLUMN account_type;
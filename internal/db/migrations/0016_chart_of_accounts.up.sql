@@ -0,0 +1,43 @@
+-- Every account has a type of the chart of accounts. Balances count credits
+-- as positive, so only the debit-normal asset and expense accounts may go
+-- negative. The clearing accounts, which could so far, become assets.
+ALTER TABLE accounts
+    ADD COLUMN account_type TEXT NOT NULL DEFAULT 'liability'
+        CHECK (account_type IN ('asset', 'liability', 'equity', 'revenue', 'expense')),
+    ADD COLUMN system_account TEXT UNIQUE
+        CHECK (system_account IN ('clearing', 'fees', 'interest_expense', 'suspense'));
+
+UPDATE accounts SET account_type = 'asset' WHERE overdraft_allowed;
+
+ALTER TABLE accounts
+    DROP CONSTRAINT accounts_balance_check,
+    ADD CONSTRAINT accounts_balance_check CHECK (balance >= 0 OR account_type IN ('asset', 'expense')),
+    DROP COLUMN overdraft_allowed;
+
+-- The system accounts, with ids from 9000000000000000, which are reserved.
+-- Accounts already holding an id in the reserved range are never taken over.
+DO $$
+DECLARE
+    taken TEXT;
+BEGIN
+    SELECT string_agg(account_id::TEXT, ', ' ORDER BY account_id) INTO taken
+    FROM accounts WHERE account_id >= 9000000000000000;
+    IF taken IS NOT NULL THEN
+        RAISE EXCEPTION 'accounts % hold ids reserved for system accounts (from 9000000000000000); move them to other ids before migrating', taken;
+    END IF;
+END $$;
+
+INSERT INTO accounts (account_id, balance, account_type, system_account) VALUES
+    (9000000000000001, 0, 'asset', 'clearing'),
+    (9000000000000002, 0, 'revenue', 'fees'),
+    (9000000000000003, 0, 'expense', 'interest_expense'),
+    (9000000000000004, 0, 'asset', 'suspense');
+
+-- Fee schedules may charge the transfers from the accounts of one type; the
+-- schedule of a client and type is preferred to the one of the client, then
+-- to the default ones
+ALTER TABLE fee_schedules
+    ADD COLUMN account_type TEXT NOT NULL DEFAULT ''
+        CHECK (account_type IN ('', 'asset', 'liability', 'equity', 'revenue', 'expense')),
+    DROP CONSTRAINT fee_schedules_client_id_key,
+    ADD CONSTRAINT fee_schedules_client_id_account_type_key UNIQUE (client_id, account_type);
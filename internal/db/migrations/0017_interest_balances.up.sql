@@ -0,0 +1,9 @@
+-- The balance of each account with an interest product as seen by the last
+-- interest run of a day. Once the day has ended, it is the balance the day
+-- accrues on; a day without a run accrues on the snapshot of the day before.
+CREATE TABLE IF NOT EXISTS interest_balances (
+    account_id BIGINT NOT NULL REFERENCES account_interest (account_id),
+    day DATE NOT NULL,
+    balance NUMERIC(20, 8) NOT NULL,
+    PRIMARY KEY (account_id, day)
+);
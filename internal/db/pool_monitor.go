@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Pool health states reported by PoolMonitor
+const (
+	PoolStatusUp       = "up"
+	PoolStatusDegraded = "degraded"
+	PoolStatusDown     = "down"
+)
+
+// PoolHealth is a snapshot of the connection pool state
+type PoolHealth struct {
+	Status       string        `json:"status"`
+	Error        string        `json:"error,omitempty"`
+	CheckedAt    time.Time     `json:"checked_at"`
+	MaxOpen      int           `json:"max_open_connections"`
+	Open         int           `json:"open_connections"`
+	InUse        int           `json:"in_use"`
+	Idle         int           `json:"idle"`
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration_ns"`
+	Saturation   float64       `json:"saturation"`
+	PingLatency  time.Duration `json:"ping_latency_ns"`
+}
+
+// PoolStats is the subset of the pool statistics sampled by PoolMonitor
+type PoolStats struct {
+	MaxConns     int
+	TotalConns   int
+	InUse        int
+	Idle         int
+	WaitCount    int64
+	WaitDuration time.Duration
+}
+
+// poolSource is what PoolMonitor needs from a connection pool
+type poolSource interface {
+	Ping(ctx context.Context) error
+	Stats() PoolStats
+}
+
+// pgxPoolSource adapts a pgxpool.Pool to poolSource
+type pgxPoolSource struct {
+	pool *pgxpool.Pool
+}
+
+func (p pgxPoolSource) Ping(ctx context.Context) error { return p.pool.Ping(ctx) }
+
+func (p pgxPoolSource) Stats() PoolStats {
+	stat := p.pool.Stat()
+	return PoolStats{
+		MaxConns:   int(stat.MaxConns()),
+		TotalConns: int(stat.TotalConns()),
+		InUse:      int(stat.AcquiredConns()),
+		Idle:       int(stat.IdleConns()),
+		// An acquire that found no idle connection had to wait for one to be
+		// created or released
+		WaitCount:    stat.EmptyAcquireCount(),
+		WaitDuration: stat.AcquireDuration(),
+	}
+}
+
+// PoolMonitor periodically pings the database and samples pool statistics
+type PoolMonitor struct {
+	source         poolSource
+	interval       time.Duration
+	saturationWarn float64
+
+	mu   sync.RWMutex
+	last PoolHealth
+}
+
+// NewPoolMonitor creates a monitor that reports the pool as degraded once the
+// ratio of in-use to max open connections reaches saturationWarn
+func NewPoolMonitor(pool *pgxpool.Pool, interval time.Duration, saturationWarn float64) *PoolMonitor {
+	return newPoolMonitor(pgxPoolSource{pool: pool}, interval, saturationWarn)
+}
+
+func newPoolMonitor(source poolSource, interval time.Duration, saturationWarn float64) *PoolMonitor {
+	return &PoolMonitor{
+		source:         source,
+		interval:       interval,
+		saturationWarn: saturationWarn,
+		last:           PoolHealth{Status: PoolStatusDown, Error: "health check has not run yet"},
+	}
+}
+
+// Run checks the pool every interval until ctx is cancelled
+func (m *PoolMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.Check(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
+
+// Check pings the database, records the pool statistics and returns them
+func (m *PoolMonitor) Check(ctx context.Context) PoolHealth {
+	pingCtx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+
+	start := time.Now()
+	pingErr := m.source.Ping(pingCtx)
+	latency := time.Since(start)
+
+	stats := m.source.Stats()
+	health := PoolHealth{
+		Status:       PoolStatusUp,
+		CheckedAt:    time.Now().UTC(),
+		MaxOpen:      stats.MaxConns,
+		Open:         stats.TotalConns,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
+		PingLatency:  latency,
+	}
+	if stats.MaxConns > 0 {
+		health.Saturation = float64(stats.InUse) / float64(stats.MaxConns)
+	}
+
+	switch {
+	case pingErr != nil:
+		health.Status = PoolStatusDown
+		health.Error = pingErr.Error()
+		log.Printf("Database health check failed: %v", pingErr)
+	case health.MaxOpen > 0 && health.Saturation >= m.saturationWarn:
+		health.Status = PoolStatusDegraded
+		log.Printf("Database pool saturated: %d/%d connections in use, %d waits", stats.InUse, stats.MaxConns, stats.WaitCount)
+	}
+
+	m.mu.Lock()
+	m.last = health
+	m.mu.Unlock()
+	return health
+}
+
+// Snapshot returns the most recent health check result
+func (m *PoolMonitor) Snapshot() PoolHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.last
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePoolSource struct {
+	pingErr error
+	stats   PoolStats
+}
+
+func (f *fakePoolSource) Ping(ctx context.Context) error { return f.pingErr }
+func (f *fakePoolSource) Stats() PoolStats               { return f.stats }
+
+func TestPoolMonitor_Check(t *testing.T) {
+	source := &fakePoolSource{stats: PoolStats{MaxConns: 4, TotalConns: 2, InUse: 1, Idle: 1}}
+	monitor := newPoolMonitor(source, time.Second, 0.8)
+	assert.Equal(t, PoolStatusDown, monitor.Snapshot().Status, "down until the first check")
+
+	health := monitor.Check(context.Background())
+	assert.Equal(t, PoolStatusUp, health.Status)
+	assert.Equal(t, 4, health.MaxOpen)
+	assert.Equal(t, 2, health.Open)
+	assert.Equal(t, 0.25, health.Saturation)
+	assert.Equal(t, health, monitor.Snapshot())
+
+	source.pingErr = errors.New("connection reset")
+	health = monitor.Check(context.Background())
+	assert.Equal(t, PoolStatusDown, health.Status)
+	assert.Equal(t, "connection reset", health.Error)
+}
+
+func TestPoolMonitor_SaturatedPoolIsDegraded(t *testing.T) {
+	source := &fakePoolSource{stats: PoolStats{MaxConns: 4, TotalConns: 4, InUse: 4, WaitCount: 7}}
+	health := newPoolMonitor(source, time.Second, 0.8).Check(context.Background())
+	assert.Equal(t, PoolStatusDegraded, health.Status)
+	assert.Equal(t, int64(7), health.WaitCount)
+}
@@ -1,18 +1,92 @@
 package db
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
+	"log"
+	"time"
+
+	pgxdecimal "github.com/jackc/pgx-shopspring-decimal"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// NewDBConnectionFromDSN creates a new database connection using a DSN string
-func NewDBConnectionFromDSN(dsn string) (*sql.DB, error) {
-	dbConn, err := sql.Open("postgres", dsn)
+// PoolOptions configures the connection pool and the initial connection attempts
+type PoolOptions struct {
+	MaxConns        int32
+	MinConns        int32
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectAttempts is the number of pings tried before giving up (at least 1)
+	ConnectAttempts int
+	// ConnectBackoff is the delay before the first retry, doubled after every failure
+	ConnectBackoff time.Duration
+	// ConnectMaxBackoff caps the retry delay
+	ConnectMaxBackoff time.Duration
+}
+
+// NewDBConnectionFromDSN creates a new connection pool using a DSN string.
+// The initial ping is retried with exponential backoff, so the service can start
+// before Postgres is ready to accept connections.
+//
+// Every connection registers the numeric <-> decimal.Decimal codec and caches
+// prepared statements, so repeated queries skip parsing and planning.
+func NewDBConnectionFromDSN(ctx context.Context, dsn string, opts PoolOptions) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn: %w", err)
+	}
+	if opts.MaxConns > 0 {
+		cfg.MaxConns = opts.MaxConns
+	}
+	cfg.MinConns = opts.MinConns
+	if opts.ConnMaxLifetime > 0 {
+		cfg.MaxConnLifetime = opts.ConnMaxLifetime
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		cfg.MaxConnIdleTime = opts.ConnMaxIdleTime
+	}
+	cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		pgxdecimal.Register(conn.TypeMap())
+		return nil
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open db: %w", err)
 	}
-	if err := dbConn.Ping(); err != nil {
+	if err := retryWithBackoff(ctx, opts, pool.Ping); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("failed to ping db: %w", err)
 	}
-	return dbConn, nil
+	return pool, nil
+}
+
+// retryWithBackoff calls fn until it succeeds, the attempts are exhausted or ctx is done
+func retryWithBackoff(ctx context.Context, opts PoolOptions, fn func(ctx context.Context) error) error {
+	attempts := max(opts.ConnectAttempts, 1)
+	delay := opts.ConnectBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return err
+		}
+		log.Printf("Database not ready (attempt %d/%d), retrying in %v: %v", attempt, attempts, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if opts.ConnectMaxBackoff > 0 && delay > opts.ConnectMaxBackoff {
+			delay = opts.ConnectMaxBackoff
+		}
+	}
 }
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryWithBackoff_SucceedsAfterFailures(t *testing.T) {
+	calls := 0
+	opts := PoolOptions{ConnectAttempts: 5, ConnectBackoff: time.Millisecond, ConnectMaxBackoff: 2 * time.Millisecond}
+
+	err := retryWithBackoff(context.Background(), opts, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryWithBackoff_GivesUp(t *testing.T) {
+	calls := 0
+	opts := PoolOptions{ConnectAttempts: 3, ConnectBackoff: time.Millisecond}
+
+	err := retryWithBackoff(context.Background(), opts, func(ctx context.Context) error {
+		calls++
+		return errors.New("connection refused")
+	})
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryWithBackoff_CancellationStopsWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := PoolOptions{ConnectAttempts: 10, ConnectBackoff: time.Hour}
+
+	err := retryWithBackoff(ctx, opts, func(ctx context.Context) error {
+		cancel()
+		return errors.New("connection refused")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
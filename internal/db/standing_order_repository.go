@@ -0,0 +1,280 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrOccurrenceExists is returned when starting an occurrence that has already
+// been started, by this scheduler or another one
+var ErrOccurrenceExists = errors.New("standing order occurrence already started")
+
+// standingOrderLockClass namespaces the per-order advisory locks. The two-key
+// form of the lock functions never collides with the single-key migration lock.
+const standingOrderLockClass int32 = 0x736f // "so"
+
+// StandingOrderRepositoryPort defines the repository interface for standing orders
+type StandingOrderRepositoryPort interface {
+	// CreateStandingOrder stores a new active standing order from all fields of
+	// order but its id, status, occurrence count and timestamps
+	CreateStandingOrder(order model.StandingOrder) (model.StandingOrder, error)
+	GetStandingOrder(id int64) (model.StandingOrder, error)
+	// ListStandingOrders returns up to limit standing orders in id order,
+	// optionally only those with status
+	ListStandingOrders(status model.StandingOrderStatus, limit int) ([]model.StandingOrder, error)
+	// CancelStandingOrder stops an active standing order. It returns
+	// ErrStandingOrderNotActive once the order is completed or cancelled.
+	CancelStandingOrder(id int64) (model.StandingOrder, error)
+	// DueStandingOrders returns the ids of up to limit active standing orders
+	// whose next run is at or before now, earliest first
+	DueStandingOrders(now time.Time, limit int) ([]int64, error)
+	// LockStandingOrder takes the lock serializing the schedulers of all
+	// replicas on one standing order, without waiting. It reports false when
+	// another scheduler holds it; otherwise unlock must be called.
+	LockStandingOrder(id int64) (unlock func(), locked bool, err error)
+	// StartOccurrence records an occurrence as processing, within tx when it is
+	// not nil. It returns ErrOccurrenceExists if the occurrence was started
+	// before.
+	StartOccurrence(tx TransactionPort, orderID int64, scheduledFor time.Time) error
+	// FinishOccurrence records the outcome of a started occurrence and, in the
+	// same transaction, counts it and moves the order on to the occurrence
+	// next, due at nextRunAt. It runs within tx when it is not nil. A nil next
+	// completes the order. An order cancelled meanwhile stays cancelled.
+	FinishOccurrence(tx TransactionPort, orderID int64, scheduledFor time.Time, status model.TransferStatus, errorCode string, next, nextRunAt *time.Time) error
+	// ListOccurrences returns up to limit occurrences of a standing order, most recent first
+	ListOccurrences(orderID int64, limit int) ([]model.StandingOrderOccurrence, error)
+}
+
+const (
+	standingOrderColumns = `id, source_account_id, destination_account_id, amount, schedule,
+    start_at, end_at, max_occurrences, occurrences, business_day_rule, next_occurrence_at, next_run_at,
+    status, created_at, updated_at`
+
+	createStandingOrderSQL = `INSERT INTO standing_orders
+    (source_account_id, destination_account_id, amount, schedule, start_at, end_at, max_occurrences,
+     business_day_rule, next_occurrence_at, next_run_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING ` + standingOrderColumns
+
+	listStandingOrdersSQL = `SELECT ` + standingOrderColumns + ` FROM standing_orders
+WHERE $1 = '' OR status = $1
+ORDER BY id
+LIMIT $2`
+
+	dueStandingOrdersSQL = `SELECT id FROM standing_orders
+WHERE status = 'active' AND next_run_at <= $1
+ORDER BY next_run_at, id
+LIMIT $2`
+
+	startOccurrenceSQL = `INSERT INTO standing_order_occurrences (standing_order_id, scheduled_for, status)
+VALUES ($1, $2, 'processing')
+ON CONFLICT DO NOTHING`
+
+	finishOccurrenceSQL = `UPDATE standing_order_occurrences
+SET status = $3, error_code = NULLIF($4, ''), finished_at = now()
+WHERE standing_order_id = $1 AND scheduled_for = $2 AND status = 'processing'`
+
+	advanceStandingOrderSQL = `UPDATE standing_orders
+SET occurrences = occurrences + 1,
+    next_occurrence_at = CASE WHEN status = 'active' THEN $3::timestamptz END,
+    next_run_at = CASE WHEN status = 'active' THEN $4::timestamptz END,
+    status = CASE WHEN status = 'active' AND $3::timestamptz IS NULL THEN 'completed' ELSE status END,
+    updated_at = now()
+WHERE id = $1 AND (next_occurrence_at = $2 OR status = 'cancelled')`
+
+	listOccurrencesSQL = `SELECT standing_order_id, scheduled_for, status, COALESCE(error_code, ''), started_at, finished_at
+FROM standing_order_occurrences
+WHERE standing_order_id = $1
+ORDER BY scheduled_for DESC
+LIMIT $2`
+)
+
+type StandingOrderRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewStandingOrderRepository(pool *pgxpool.Pool) *StandingOrderRepository {
+	return &StandingOrderRepository{pool: pool}
+}
+
+// CreateStandingOrder stores a new active standing order
+func (repo *StandingOrderRepository) CreateStandingOrder(order model.StandingOrder) (model.StandingOrder, error) {
+	row := repo.pool.QueryRow(context.Background(), createStandingOrderSQL,
+		order.SourceAccountID, order.DestinationAccountID, order.Amount, order.Schedule,
+		order.StartAt, order.EndAt, order.MaxOccurrences, order.BusinessDayRule, order.NextOccurrenceAt, order.NextRunAt)
+	created, err := scanStandingOrder(row)
+	if err != nil {
+		log.Printf("CreateStandingOrder DB error: %v", err)
+		return model.StandingOrder{}, translateError(err, nil)
+	}
+	return created, nil
+}
+
+// GetStandingOrder retrieves a standing order by id
+func (repo *StandingOrderRepository) GetStandingOrder(id int64) (model.StandingOrder, error) {
+	row := repo.pool.QueryRow(context.Background(), `SELECT `+standingOrderColumns+` FROM standing_orders WHERE id = $1`, id)
+	order, err := scanStandingOrder(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.StandingOrder{}, model.ErrStandingOrderNotFound
+	}
+	if err != nil {
+		log.Printf("GetStandingOrder DB error: %v", err)
+		return model.StandingOrder{}, fmt.Errorf("query standing order by id: %w", translateError(err, nil))
+	}
+	return order, nil
+}
+
+// ListStandingOrders returns standing orders in id order
+func (repo *StandingOrderRepository) ListStandingOrders(status model.StandingOrderStatus, limit int) ([]model.StandingOrder, error) {
+	rows, err := repo.pool.Query(context.Background(), listStandingOrdersSQL, string(status), limit)
+	if err != nil {
+		log.Printf("ListStandingOrders DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	orders, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.StandingOrder, error) {
+		return scanStandingOrder(row)
+	})
+	if err != nil {
+		log.Printf("ListStandingOrders DB error: %v", err)
+	}
+	return orders, translateError(err, nil)
+}
+
+// CancelStandingOrder stops an active standing order
+func (repo *StandingOrderRepository) CancelStandingOrder(id int64) (model.StandingOrder, error) {
+	var cancelled model.StandingOrder
+	err := pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error {
+		ctx := context.Background()
+		var status string
+		err := tx.QueryRow(ctx, `SELECT status FROM standing_orders WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrStandingOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if model.StandingOrderStatus(status) != model.StandingOrderActive {
+			return model.ErrStandingOrderNotActive
+		}
+		cancelled, err = scanStandingOrder(tx.QueryRow(ctx, `UPDATE standing_orders
+SET status = 'cancelled', next_occurrence_at = NULL, next_run_at = NULL, updated_at = now()
+WHERE id = $1 RETURNING `+standingOrderColumns, id))
+		return err
+	})
+	if err != nil && !errors.Is(err, model.ErrStandingOrderNotFound) && !errors.Is(err, model.ErrStandingOrderNotActive) {
+		log.Printf("CancelStandingOrder DB error: %v", err)
+		return model.StandingOrder{}, translateError(err, nil)
+	}
+	return cancelled, err
+}
+
+// DueStandingOrders returns the ids of active standing orders that are due
+func (repo *StandingOrderRepository) DueStandingOrders(now time.Time, limit int) ([]int64, error) {
+	rows, err := repo.pool.Query(context.Background(), dueStandingOrdersSQL, now, limit)
+	if err != nil {
+		log.Printf("DueStandingOrders DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		log.Printf("DueStandingOrders DB error: %v", err)
+	}
+	return ids, translateError(err, nil)
+}
+
+// LockStandingOrder takes the advisory lock of a standing order, held on a
+// dedicated connection until unlock
+func (repo *StandingOrderRepository) LockStandingOrder(id int64) (func(), bool, error) {
+	return tryAdvisoryLock(repo.pool, standingOrderLockClass, id, fmt.Sprintf("standing order %d", id))
+}
+
+// StartOccurrence records an occurrence as processing, optionally within a transaction
+func (repo *StandingOrderRepository) StartOccurrence(tx TransactionPort, orderID int64, scheduledFor time.Time) error {
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return err
+	}
+	tag, err := q.Exec(context.Background(), startOccurrenceSQL, orderID, scheduledFor)
+	if err != nil {
+		log.Printf("StartOccurrence DB error: %v", err)
+		return translateError(err, nil)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOccurrenceExists
+	}
+	return nil
+}
+
+// FinishOccurrence records the outcome of an occurrence and advances its
+// order, optionally within a transaction
+func (repo *StandingOrderRepository) FinishOccurrence(tx TransactionPort, orderID int64, scheduledFor time.Time, status model.TransferStatus, errorCode string, next, nextRunAt *time.Time) error {
+	finish := func(q querier) error {
+		ctx := context.Background()
+		if _, err := q.Exec(ctx, finishOccurrenceSQL, orderID, scheduledFor, string(status), errorCode); err != nil {
+			return err
+		}
+		tag, err := q.Exec(ctx, advanceStandingOrderSQL, orderID, scheduledFor, next, nextRunAt)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("standing order %d is no longer due at %v", orderID, scheduledFor)
+		}
+		return nil
+	}
+
+	var err error
+	if tx == nil {
+		err = pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error { return finish(tx) })
+	} else {
+		var q querier
+		if q, err = queryable(repo.pool, tx); err != nil {
+			return err
+		}
+		err = finish(q)
+	}
+	if err != nil {
+		log.Printf("FinishOccurrence DB error: %v", err)
+		return translateError(err, nil)
+	}
+	return nil
+}
+
+// ListOccurrences returns the most recent occurrences of a standing order
+func (repo *StandingOrderRepository) ListOccurrences(orderID int64, limit int) ([]model.StandingOrderOccurrence, error) {
+	rows, err := repo.pool.Query(context.Background(), listOccurrencesSQL, orderID, limit)
+	if err != nil {
+		log.Printf("ListOccurrences DB error: %v", err)
+		return nil, translateError(err, nil)
+	}
+	occurrences, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.StandingOrderOccurrence, error) {
+		var o model.StandingOrderOccurrence
+		var status string
+		err := row.Scan(&o.StandingOrderID, &o.ScheduledFor, &status, &o.ErrorCode, &o.StartedAt, &o.FinishedAt)
+		o.Status = model.TransferStatus(status)
+		return o, err
+	})
+	if err != nil {
+		log.Printf("ListOccurrences DB error: %v", err)
+	}
+	return occurrences, translateError(err, nil)
+}
+
+// scanStandingOrder reads a row selected with standingOrderColumns
+func scanStandingOrder(row pgx.Row) (model.StandingOrder, error) {
+	var o model.StandingOrder
+	var status string
+	err := row.Scan(&o.ID, &o.SourceAccountID, &o.DestinationAccountID, &o.Amount, &o.Schedule,
+		&o.StartAt, &o.EndAt, &o.MaxOccurrences, &o.Occurrences, &o.BusinessDayRule, &o.NextOccurrenceAt, &o.NextRunAt,
+		&status, &o.CreatedAt, &o.UpdatedAt)
+	o.Status = model.StandingOrderStatus(status)
+	return o, err
+}
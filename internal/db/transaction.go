@@ -1,6 +1,17 @@
 package db
 
-import "database/sql"
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrTxDone is returned when committing or rolling back a finished transaction
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
 
 // TransactionPort defines the interface for transaction management
 //
@@ -10,10 +21,63 @@ type TransactionPort interface {
 	Rollback() error
 }
 
+// SavepointPort is implemented by transactions that can roll back part of
+// their work. Rolling back to a savepoint undoes the changes made after it and
+// releases the row locks taken after it; the transaction stays usable.
+type SavepointPort interface {
+	Savepoint(name string) error
+	RollbackToSavepoint(name string) error
+	ReleaseSavepoint(name string) error
+}
+
 // Transaction implements the TransactionPort interface for managing database transactions
 type Transaction struct {
-	tx *sql.Tx
+	tx pgx.Tx
+}
+
+func (t *Transaction) Commit() error   { return txDone(t.tx.Commit(context.Background())) }
+func (t *Transaction) Rollback() error { return txDone(t.tx.Rollback(context.Background())) }
+
+func (t *Transaction) Savepoint(name string) error {
+	return t.exec("SAVEPOINT " + pgx.Identifier{name}.Sanitize())
+}
+
+func (t *Transaction) RollbackToSavepoint(name string) error {
+	return t.exec("ROLLBACK TO SAVEPOINT " + pgx.Identifier{name}.Sanitize())
 }
 
-func (t *Transaction) Commit() error   { return t.tx.Commit() }
-func (t *Transaction) Rollback() error { return t.tx.Rollback() }
+func (t *Transaction) ReleaseSavepoint(name string) error {
+	return t.exec("RELEASE SAVEPOINT " + pgx.Identifier{name}.Sanitize())
+}
+
+func (t *Transaction) exec(sql string) error {
+	_, err := t.tx.Exec(context.Background(), sql)
+	return txDone(err)
+}
+
+// txDone maps pgx's closed transaction error onto ErrTxDone
+func txDone(err error) error {
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return ErrTxDone
+	}
+	return err
+}
+
+// querier is implemented by both the connection pool and pgx transactions
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// queryable returns the transaction behind tx, or the pool when tx is nil
+func queryable(pool *pgxpool.Pool, tx TransactionPort) (querier, error) {
+	if tx == nil {
+		return pool, nil
+	}
+	dbTx, ok := tx.(*Transaction)
+	if !ok {
+		return nil, fmt.Errorf("invalid transaction type")
+	}
+	return dbTx.tx, nil
+}
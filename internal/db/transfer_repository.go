@@ -0,0 +1,433 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+)
+
+// ErrTransferClaimLost is returned when finishing a transfer that the caller no
+// longer owns: its lease expired and another worker claimed it again
+var ErrTransferClaimLost = errors.New("transfer is no longer claimed by this worker")
+
+// TransferRepositoryPort defines the repository interface for asynchronous transfers
+type TransferRepositoryPort interface {
+	// CreateTransfer stores a new transfer from the accounts, amount, details,
+	// fee, ExecuteAt and RetryUntil of transfer. It is scheduled when ExecuteAt is
+	// set and pending otherwise. It returns ErrDuplicateExternalReference when
+	// the client already used the external reference.
+	CreateTransfer(transfer model.Transfer) (model.Transfer, error)
+	// BookTransfer stores a completed transfer from the accounts, amount,
+	// details, fee, kind and parent of transfer within tx, for a caller moving its
+	// funds in tx. It returns ErrDuplicateExternalReference like CreateTransfer.
+	BookTransfer(tx TransactionPort, transfer model.Transfer) (model.Transfer, error)
+	GetTransfer(id int64) (model.Transfer, error)
+	// GetTransferByReference returns the transfer of a client with an external
+	// reference, or ErrTransferNotFound
+	GetTransferByReference(clientID, reference string) (model.Transfer, error)
+	// ListScheduledTransfers returns up to limit transfers that have an
+	// execution time, ordered by it, optionally only those with status
+	ListScheduledTransfers(status model.TransferStatus, limit int) ([]model.Transfer, error)
+	// CancelTransfer cancels a scheduled transfer. It returns ErrTransferNotFound
+	// unless the transfer has an execution time, and ErrTransferNotCancellable
+	// once it is no longer scheduled.
+	CancelTransfer(id int64) (model.Transfer, error)
+	// ClaimTransfers marks up to limit transfers as processing and returns them
+	// in id order. Pending transfers are claimable, as are scheduled transfers
+	// that are due and processing transfers not updated for lease, whose worker
+	// is presumed dead. Rows being claimed by another caller at the same time
+	// are skipped.
+	ClaimTransfers(limit int, lease time.Duration) ([]model.Transfer, error)
+	// FinishTransfer records the outcome of a claimed transfer, within tx when
+	// it is not nil. It returns ErrTransferClaimLost unless the transfer is
+	// still processing under the given attempt.
+	FinishTransfer(tx TransactionPort, id int64, attempt int, status model.TransferStatus, errorCode string) error
+	// RetryTransfer returns a claimed transfer to scheduled, due again at next,
+	// and records the error code of the failed attempt. It returns
+	// ErrTransferClaimLost like FinishTransfer.
+	RetryTransfer(id int64, attempt int, next time.Time, errorCode string) error
+	// CreateReversal stores a reversal of transfer originalID, from its
+	// destination back to its source, within tx when it is not nil. A zero
+	// amount reverses what is not reversed yet. The reversal is stored with
+	// status, completed for a caller moving the funds in tx or pending for the
+	// workers, and retried until retryUntil when it is not nil. The original is
+	// locked until tx ends, so concurrent reversals cannot overdraw it.
+	// It returns ErrTransferNotFound, ErrTransferNotReversible unless the
+	// original is a completed transfer between two accounts and not a reversal
+	// itself, and ErrReversalExceedsOriginal when its reversals that did not
+	// fail or get cancelled would exceed what its destination was credited;
+	// fees are not refunded.
+	CreateReversal(tx TransactionPort, originalID int64, amount decimal.Decimal, status model.TransferStatus, retryUntil *time.Time) (model.Transfer, error)
+	// ListReversals returns the reversals of a transfer in id order
+	ListReversals(originalID int64) ([]model.Transfer, error)
+	// ListLegs returns the legs of a split in id order
+	ListLegs(parentID int64) ([]model.Transfer, error)
+}
+
+// Domain errors for constraint violations of the transfer statements
+var createTransferErrors = errorMapping{
+	sqlStateCheckViolation:  model.ErrRetryDeadlineBeforeExecution,
+	sqlStateUniqueViolation: model.ErrDuplicateExternalReference,
+}
+
+const (
+	transferColumns = `id, COALESCE(source_account_id, 0), COALESCE(destination_account_id, 0), amount, status,
+    COALESCE(error_code, ''), attempts, created_at, updated_at,
+    execute_at, retry_until, next_attempt_at, reversal_of,
+    client_id, COALESCE(description, ''), COALESCE(external_reference, ''), metadata,
+    kind, parent_id,
+    COALESCE(fee_schedule_id, 0), COALESCE(fee_account_id, 0), COALESCE(fee_amount, 0), COALESCE(fee_mode, '')`
+
+	createTransferSQL = `INSERT INTO transfers
+    (source_account_id, destination_account_id, amount, status, execute_at, retry_until, next_attempt_at,
+     client_id, description, external_reference, metadata,
+     fee_schedule_id, fee_account_id, fee_amount, fee_mode)
+VALUES ($1, $2, $3, CASE WHEN $4::timestamptz IS NULL THEN 'pending' ELSE 'scheduled' END, $4, $5, $4,
+    $6, NULLIF($7, ''), NULLIF($8, ''), $9,
+    $10, $11, $12, $13)
+RETURNING ` + transferColumns
+
+	bookTransferSQL = `INSERT INTO transfers
+    (source_account_id, destination_account_id, amount, status, client_id, description, external_reference, metadata,
+     kind, parent_id, fee_schedule_id, fee_account_id, fee_amount, fee_mode)
+VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, 'completed', $4, NULLIF($5, ''), NULLIF($6, ''), $7,
+    COALESCE(NULLIF($8, ''), 'transfer'), $9, $10, $11, $12, $13)
+RETURNING ` + transferColumns
+
+	getTransferByReferenceSQL = `SELECT ` + transferColumns + ` FROM transfers
+WHERE client_id = $1 AND external_reference = $2`
+
+	listScheduledTransfersSQL = `SELECT ` + transferColumns + ` FROM transfers
+WHERE execute_at IS NOT NULL AND ($1 = '' OR status = $1)
+ORDER BY execute_at, id
+LIMIT $2`
+
+	// claimTransfersSQL claims the oldest claimable transfers; SKIP LOCKED lets
+	// workers on several replicas claim disjoint batches without waiting
+	claimTransfersSQL = `WITH claimed AS (
+    UPDATE transfers t
+    SET status = 'processing', attempts = t.attempts + 1, updated_at = now()
+    FROM (
+        SELECT id FROM transfers
+        WHERE status = 'pending'
+           OR (status = 'scheduled' AND next_attempt_at <= now())
+           OR (status = 'processing' AND updated_at < now() - $2::bigint * interval '1 microsecond')
+        ORDER BY id
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    ) due
+    WHERE t.id = due.id
+    RETURNING t.*
+)
+SELECT ` + transferColumns + ` FROM claimed ORDER BY id`
+
+	finishTransferSQL = `UPDATE transfers
+SET status = $3, error_code = NULLIF($4, ''), updated_at = now()
+WHERE id = $1 AND attempts = $2 AND status = 'processing'`
+
+	retryTransferSQL = `UPDATE transfers
+SET status = 'scheduled', next_attempt_at = $3, error_code = NULLIF($4, ''), updated_at = now()
+WHERE id = $1 AND attempts = $2 AND status = 'processing'`
+
+	// lockReversedTransferSQL reads what the destination was credited, the
+	// amount less a deducted fee
+	lockReversedTransferSQL = `SELECT COALESCE(source_account_id, 0), COALESCE(destination_account_id, 0),
+    amount - CASE WHEN fee_mode = 'deducted' THEN fee_amount ELSE 0 END, status,
+    kind = 'transfer' AND reversal_of IS NULL
+FROM transfers WHERE id = $1 FOR UPDATE`
+
+	// reversedAmountSQL sums the reversals that moved or may still move funds
+	reversedAmountSQL = `SELECT COALESCE(SUM(amount), 0) FROM transfers
+WHERE reversal_of = $1 AND status NOT IN ('failed', 'cancelled')`
+
+	createReversalSQL = `INSERT INTO transfers
+    (source_account_id, destination_account_id, amount, status, retry_until, reversal_of)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING ` + transferColumns
+
+	listReversalsSQL = `SELECT ` + transferColumns + ` FROM transfers WHERE reversal_of = $1 ORDER BY id`
+
+	listLegsSQL = `SELECT ` + transferColumns + ` FROM transfers WHERE parent_id = $1 ORDER BY id`
+)
+
+type TransferRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTransferRepository(pool *pgxpool.Pool) *TransferRepository {
+	return &TransferRepository{pool: pool}
+}
+
+// CreateTransfer stores a new pending or scheduled transfer
+func (repo *TransferRepository) CreateTransfer(transfer model.Transfer) (model.Transfer, error) {
+	d := transfer.TransferDetails
+	feeScheduleID, feeAccountID, feeAmount, feeMode := feeValues(transfer.Fee)
+	row := repo.pool.QueryRow(context.Background(), createTransferSQL,
+		transfer.SourceAccountID, transfer.DestinationAccountID, transfer.Amount, transfer.ExecuteAt, transfer.RetryUntil,
+		d.ClientID, d.Description, d.ExternalReference, d.Metadata,
+		feeScheduleID, feeAccountID, feeAmount, feeMode)
+	created, err := scanTransfer(row)
+	if err != nil {
+		log.Printf("CreateTransfer DB error: %v", err)
+		return model.Transfer{}, translateError(err, createTransferErrors)
+	}
+	return created, nil
+}
+
+// BookTransfer stores a completed transfer, optionally within a transaction
+func (repo *TransferRepository) BookTransfer(tx TransactionPort, transfer model.Transfer) (model.Transfer, error) {
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	d := transfer.TransferDetails
+	feeScheduleID, feeAccountID, feeAmount, feeMode := feeValues(transfer.Fee)
+	booked, err := scanTransfer(q.QueryRow(context.Background(), bookTransferSQL,
+		transfer.SourceAccountID, transfer.DestinationAccountID, transfer.Amount,
+		d.ClientID, d.Description, d.ExternalReference, d.Metadata, string(transfer.Kind), transfer.ParentID,
+		feeScheduleID, feeAccountID, feeAmount, feeMode))
+	if err != nil {
+		log.Printf("BookTransfer DB error: %v", err)
+		return model.Transfer{}, translateError(err, createTransferErrors)
+	}
+	return booked, nil
+}
+
+// GetTransfer retrieves a transfer by id
+func (repo *TransferRepository) GetTransfer(id int64) (model.Transfer, error) {
+	row := repo.pool.QueryRow(context.Background(), `SELECT `+transferColumns+` FROM transfers WHERE id = $1`, id)
+	transfer, err := scanTransfer(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Transfer{}, model.ErrTransferNotFound
+	}
+	if err != nil {
+		log.Printf("GetTransfer DB error: %v", err)
+		return model.Transfer{}, fmt.Errorf("query transfer by id: %w", translateError(err, nil))
+	}
+	return transfer, nil
+}
+
+// GetTransferByReference retrieves the transfer of a client by its external reference
+func (repo *TransferRepository) GetTransferByReference(clientID, reference string) (model.Transfer, error) {
+	transfer, err := scanTransfer(repo.pool.QueryRow(context.Background(), getTransferByReferenceSQL, clientID, reference))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Transfer{}, model.ErrTransferNotFound
+	}
+	if err != nil {
+		log.Printf("GetTransferByReference DB error: %v", err)
+		return model.Transfer{}, fmt.Errorf("query transfer by reference: %w", translateError(err, nil))
+	}
+	return transfer, nil
+}
+
+// ListScheduledTransfers returns transfers with an execution time in execution order
+func (repo *TransferRepository) ListScheduledTransfers(status model.TransferStatus, limit int) ([]model.Transfer, error) {
+	transfers, err := repo.queryTransfers(listScheduledTransfersSQL, string(status), limit)
+	if err != nil {
+		log.Printf("ListScheduledTransfers DB error: %v", err)
+	}
+	return transfers, err
+}
+
+// CancelTransfer cancels a scheduled transfer that has not started yet
+func (repo *TransferRepository) CancelTransfer(id int64) (model.Transfer, error) {
+	var cancelled model.Transfer
+	err := pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error {
+		ctx := context.Background()
+		var status string
+		err := tx.QueryRow(ctx, `SELECT status FROM transfers WHERE id = $1 AND execute_at IS NOT NULL FOR UPDATE`, id).Scan(&status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrTransferNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if model.TransferStatus(status) != model.TransferScheduled {
+			return model.ErrTransferNotCancellable
+		}
+		cancelled, err = scanTransfer(tx.QueryRow(ctx,
+			`UPDATE transfers SET status = 'cancelled', updated_at = now() WHERE id = $1 RETURNING `+transferColumns, id))
+		return err
+	})
+	if err != nil && !errors.Is(err, model.ErrTransferNotFound) && !errors.Is(err, model.ErrTransferNotCancellable) {
+		log.Printf("CancelTransfer DB error: %v", err)
+		return model.Transfer{}, translateError(err, nil)
+	}
+	return cancelled, err
+}
+
+// ClaimTransfers marks up to limit claimable transfers as processing
+func (repo *TransferRepository) ClaimTransfers(limit int, lease time.Duration) ([]model.Transfer, error) {
+	transfers, err := repo.queryTransfers(claimTransfersSQL, limit, lease.Microseconds())
+	if err != nil {
+		log.Printf("ClaimTransfers DB error: %v", err)
+	}
+	return transfers, err
+}
+
+// FinishTransfer records the outcome of a claimed transfer, optionally within a transaction
+func (repo *TransferRepository) FinishTransfer(tx TransactionPort, id int64, attempt int, status model.TransferStatus, errorCode string) error {
+	q, err := queryable(repo.pool, tx)
+	if err != nil {
+		return err
+	}
+	tag, err := q.Exec(context.Background(), finishTransferSQL, id, attempt, string(status), errorCode)
+	if err != nil {
+		log.Printf("FinishTransfer DB error: %v", err)
+		return translateError(err, nil)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTransferClaimLost
+	}
+	return nil
+}
+
+// RetryTransfer returns a claimed transfer to scheduled after a failed attempt
+func (repo *TransferRepository) RetryTransfer(id int64, attempt int, next time.Time, errorCode string) error {
+	tag, err := repo.pool.Exec(context.Background(), retryTransferSQL, id, attempt, next, errorCode)
+	if err != nil {
+		log.Printf("RetryTransfer DB error: %v", err)
+		return translateError(err, nil)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTransferClaimLost
+	}
+	return nil
+}
+
+// CreateReversal stores a reversal of a completed transfer, optionally within a transaction
+func (repo *TransferRepository) CreateReversal(tx TransactionPort, originalID int64, amount decimal.Decimal, status model.TransferStatus, retryUntil *time.Time) (model.Transfer, error) {
+	var reversal model.Transfer
+	create := func(q querier) error {
+		ctx := context.Background()
+		var sourceID, destID int64
+		var original decimal.Decimal
+		var originalStatus string
+		var reversible bool
+		err := q.QueryRow(ctx, lockReversedTransferSQL, originalID).Scan(&sourceID, &destID, &original, &originalStatus, &reversible)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrTransferNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if model.TransferStatus(originalStatus) != model.TransferCompleted || !reversible {
+			return model.ErrTransferNotReversible
+		}
+		var reversed decimal.Decimal
+		if err := q.QueryRow(ctx, reversedAmountSQL, originalID).Scan(&reversed); err != nil {
+			return err
+		}
+		if amount, err = reversalAmount(original, reversed, amount); err != nil {
+			return err
+		}
+		reversal, err = scanTransfer(q.QueryRow(ctx, createReversalSQL,
+			destID, sourceID, amount, string(status), retryUntil, originalID))
+		return err
+	}
+
+	var err error
+	if tx == nil {
+		err = pgx.BeginFunc(context.Background(), repo.pool, func(tx pgx.Tx) error { return create(tx) })
+	} else {
+		var q querier
+		if q, err = queryable(repo.pool, tx); err != nil {
+			return model.Transfer{}, err
+		}
+		err = create(q)
+	}
+	if err != nil && !errors.Is(err, model.ErrTransferNotFound) && !errors.Is(err, model.ErrTransferNotReversible) &&
+		!errors.Is(err, model.ErrReversalExceedsOriginal) {
+		log.Printf("CreateReversal DB error: %v", err)
+		return model.Transfer{}, translateError(err, nil)
+	}
+	return reversal, err
+}
+
+// ListReversals returns the reversals of a transfer in id order
+func (repo *TransferRepository) ListReversals(originalID int64) ([]model.Transfer, error) {
+	transfers, err := repo.queryTransfers(listReversalsSQL, originalID)
+	if err != nil {
+		log.Printf("ListReversals DB error: %v", err)
+	}
+	return transfers, err
+}
+
+// ListLegs returns the legs of a split in id order
+func (repo *TransferRepository) ListLegs(parentID int64) ([]model.Transfer, error) {
+	transfers, err := repo.queryTransfers(listLegsSQL, parentID)
+	if err != nil {
+		log.Printf("ListLegs DB error: %v", err)
+	}
+	return transfers, err
+}
+
+// reversalAmount returns the amount of a new reversal of original, of which
+// reversed is already reversed; a zero amount reverses the rest
+func reversalAmount(original, reversed, amount decimal.Decimal) (decimal.Decimal, error) {
+	remaining := original.Sub(reversed)
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if !amount.IsPositive() || amount.GreaterThan(remaining) {
+		return decimal.Decimal{}, model.ErrReversalExceedsOriginal
+	}
+	return amount, nil
+}
+
+// feeValues returns the fee_schedule_id, fee_account_id, fee_amount and
+// fee_mode values of a fee, all NULL without one
+func feeValues(fee *model.Fee) (scheduleID, accountID *int64, amount *decimal.Decimal, mode *string) {
+	if fee == nil {
+		return nil, nil, nil, nil
+	}
+	if fee.ScheduleID != 0 {
+		scheduleID = &fee.ScheduleID
+	}
+	m := string(fee.Mode)
+	return scheduleID, &fee.AccountID, &fee.Amount, &m
+}
+
+// queryTransfers runs a query selecting transferColumns
+func (repo *TransferRepository) queryTransfers(sql string, args ...any) ([]model.Transfer, error) {
+	rows, err := repo.pool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, translateError(err, nil)
+	}
+	transfers, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Transfer, error) {
+		return scanTransfer(row)
+	})
+	return transfers, translateError(err, nil)
+}
+
+// scanTransfer reads a row selected with transferColumns
+func scanTransfer(row pgx.Row) (model.Transfer, error) {
+	var t model.Transfer
+	var status string
+	var metadata []byte
+	var kind string
+	var fee model.Fee
+	var feeMode string
+	err := row.Scan(&t.ID, &t.SourceAccountID, &t.DestinationAccountID, &t.Amount, &status,
+		&t.ErrorCode, &t.Attempts, &t.CreatedAt, &t.UpdatedAt,
+		&t.ExecuteAt, &t.RetryUntil, &t.NextAttemptAt, &t.ReversalOf,
+		&t.ClientID, &t.Description, &t.ExternalReference, &metadata,
+		&kind, &t.ParentID,
+		&fee.ScheduleID, &fee.AccountID, &fee.Amount, &feeMode)
+	t.Status = model.TransferStatus(status)
+	t.Kind = model.TransferKind(kind)
+	t.Metadata = metadata
+	if fee.AccountID != 0 {
+		fee.Mode = model.FeeMode(feeMode)
+		t.Fee = &fee
+	}
+	return t, err
+}
@@ -64,6 +64,78 @@ func (mr *MockAccountServicePortMockRecorder) GetAccount(arg0 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccount", reflect.TypeOf((*MockAccountServicePort)(nil).GetAccount), arg0)
 }
 
+// GetAccountTree mocks base method.
+func (m *MockAccountServicePort) GetAccountTree(arg0 int64) (model.AccountNode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountTree", arg0)
+	ret0, _ := ret[0].(model.AccountNode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccountTree indicates an expected call of GetAccountTree.
+func (mr *MockAccountServicePortMockRecorder) GetAccountTree(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountTree", reflect.TypeOf((*MockAccountServicePort)(nil).GetAccountTree), arg0)
+}
+
+// QuoteTransfer mocks base method.
+func (m *MockAccountServicePort) QuoteTransfer(arg0, arg1 int64, arg2 decimal.Decimal, arg3 string, arg4 model.FeeMode) (model.TransferQuote, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QuoteTransfer", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(model.TransferQuote)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QuoteTransfer indicates an expected call of QuoteTransfer.
+func (mr *MockAccountServicePortMockRecorder) QuoteTransfer(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuoteTransfer", reflect.TypeOf((*MockAccountServicePort)(nil).QuoteTransfer), arg0, arg1, arg2, arg3, arg4)
+}
+
+// SetAccountParent mocks base method.
+func (m *MockAccountServicePort) SetAccountParent(arg0, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAccountParent", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAccountParent indicates an expected call of SetAccountParent.
+func (mr *MockAccountServicePortMockRecorder) SetAccountParent(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAccountParent", reflect.TypeOf((*MockAccountServicePort)(nil).SetAccountParent), arg0, arg1)
+}
+
+// SetBalanceShards mocks base method.
+func (m *MockAccountServicePort) SetBalanceShards(arg0 int64, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBalanceShards", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetBalanceShards indicates an expected call of SetBalanceShards.
+func (mr *MockAccountServicePortMockRecorder) SetBalanceShards(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBalanceShards", reflect.TypeOf((*MockAccountServicePort)(nil).SetBalanceShards), arg0, arg1)
+}
+
+// SetChildBalancePolicy mocks base method.
+func (m *MockAccountServicePort) SetChildBalancePolicy(arg0 int64, arg1 model.ChildBalancePolicy) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetChildBalancePolicy", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetChildBalancePolicy indicates an expected call of SetChildBalancePolicy.
+func (mr *MockAccountServicePortMockRecorder) SetChildBalancePolicy(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetChildBalancePolicy", reflect.TypeOf((*MockAccountServicePort)(nil).SetChildBalancePolicy), arg0, arg1)
+}
+
 // Transfer mocks base method.
 func (m *MockAccountServicePort) Transfer(arg0, arg1 int64, arg2 decimal.Decimal) error {
 	m.ctrl.T.Helper()
@@ -77,3 +149,18 @@ func (mr *MockAccountServicePortMockRecorder) Transfer(arg0, arg1, arg2 interfac
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transfer", reflect.TypeOf((*MockAccountServicePort)(nil).Transfer), arg0, arg1, arg2)
 }
+
+// TransferWithFee mocks base method.
+func (m *MockAccountServicePort) TransferWithFee(arg0, arg1 int64, arg2 decimal.Decimal, arg3 string, arg4 model.FeeMode) (*model.Fee, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferWithFee", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*model.Fee)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TransferWithFee indicates an expected call of TransferWithFee.
+func (mr *MockAccountServicePortMockRecorder) TransferWithFee(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferWithFee", reflect.TypeOf((*MockAccountServicePort)(nil).TransferWithFee), arg0, arg1, arg2, arg3, arg4)
+}
@@ -0,0 +1,188 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal-transfers/internal/services (interfaces: TransferServicePort)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	calendar "internal-transfers/internal/calendar"
+	model "internal-transfers/internal/model"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	decimal "github.com/shopspring/decimal"
+)
+
+// MockTransferServicePort is a mock of TransferServicePort interface.
+type MockTransferServicePort struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransferServicePortMockRecorder
+}
+
+// MockTransferServicePortMockRecorder is the mock recorder for MockTransferServicePort.
+type MockTransferServicePortMockRecorder struct {
+	mock *MockTransferServicePort
+}
+
+// NewMockTransferServicePort creates a new mock instance.
+func NewMockTransferServicePort(ctrl *gomock.Controller) *MockTransferServicePort {
+	mock := &MockTransferServicePort{ctrl: ctrl}
+	mock.recorder = &MockTransferServicePortMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTransferServicePort) EXPECT() *MockTransferServicePortMockRecorder {
+	return m.recorder
+}
+
+// BookTransfer mocks base method.
+func (m *MockTransferServicePort) BookTransfer(arg0, arg1 int64, arg2 decimal.Decimal, arg3 model.TransferDetails) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BookTransfer", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BookTransfer indicates an expected call of BookTransfer.
+func (mr *MockTransferServicePortMockRecorder) BookTransfer(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BookTransfer", reflect.TypeOf((*MockTransferServicePort)(nil).BookTransfer), arg0, arg1, arg2, arg3)
+}
+
+// CancelScheduledTransfer mocks base method.
+func (m *MockTransferServicePort) CancelScheduledTransfer(arg0 int64) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelScheduledTransfer", arg0)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelScheduledTransfer indicates an expected call of CancelScheduledTransfer.
+func (mr *MockTransferServicePortMockRecorder) CancelScheduledTransfer(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelScheduledTransfer", reflect.TypeOf((*MockTransferServicePort)(nil).CancelScheduledTransfer), arg0)
+}
+
+// GetTransfer mocks base method.
+func (m *MockTransferServicePort) GetTransfer(arg0 int64) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfer", arg0)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransfer indicates an expected call of GetTransfer.
+func (mr *MockTransferServicePortMockRecorder) GetTransfer(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfer", reflect.TypeOf((*MockTransferServicePort)(nil).GetTransfer), arg0)
+}
+
+// GetTransferByReference mocks base method.
+func (m *MockTransferServicePort) GetTransferByReference(arg0, arg1 string) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransferByReference", arg0, arg1)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransferByReference indicates an expected call of GetTransferByReference.
+func (mr *MockTransferServicePortMockRecorder) GetTransferByReference(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransferByReference", reflect.TypeOf((*MockTransferServicePort)(nil).GetTransferByReference), arg0, arg1)
+}
+
+// ListScheduledTransfers mocks base method.
+func (m *MockTransferServicePort) ListScheduledTransfers(arg0 model.TransferStatus, arg1 int) ([]model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListScheduledTransfers", arg0, arg1)
+	ret0, _ := ret[0].([]model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListScheduledTransfers indicates an expected call of ListScheduledTransfers.
+func (mr *MockTransferServicePortMockRecorder) ListScheduledTransfers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListScheduledTransfers", reflect.TypeOf((*MockTransferServicePort)(nil).ListScheduledTransfers), arg0, arg1)
+}
+
+// ReverseTransfer mocks base method.
+func (m *MockTransferServicePort) ReverseTransfer(arg0 int64, arg1 decimal.Decimal, arg2 time.Time) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseTransfer", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReverseTransfer indicates an expected call of ReverseTransfer.
+func (mr *MockTransferServicePortMockRecorder) ReverseTransfer(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseTransfer", reflect.TypeOf((*MockTransferServicePort)(nil).ReverseTransfer), arg0, arg1, arg2)
+}
+
+// ScheduleTransfer mocks base method.
+func (m *MockTransferServicePort) ScheduleTransfer(arg0, arg1 int64, arg2 decimal.Decimal, arg3, arg4 time.Time, arg5 calendar.Rule, arg6 model.TransferDetails) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScheduleTransfer", arg0, arg1, arg2, arg3, arg4, arg5, arg6)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScheduleTransfer indicates an expected call of ScheduleTransfer.
+func (mr *MockTransferServicePortMockRecorder) ScheduleTransfer(arg0, arg1, arg2, arg3, arg4, arg5, arg6 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScheduleTransfer", reflect.TypeOf((*MockTransferServicePort)(nil).ScheduleTransfer), arg0, arg1, arg2, arg3, arg4, arg5, arg6)
+}
+
+// SplitTransfer mocks base method.
+func (m *MockTransferServicePort) SplitTransfer(arg0 int64, arg1 decimal.Decimal, arg2 []model.SplitShare, arg3 model.TransferDetails) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SplitTransfer", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SplitTransfer indicates an expected call of SplitTransfer.
+func (mr *MockTransferServicePortMockRecorder) SplitTransfer(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SplitTransfer", reflect.TypeOf((*MockTransferServicePort)(nil).SplitTransfer), arg0, arg1, arg2, arg3)
+}
+
+// SubmitTransfer mocks base method.
+func (m *MockTransferServicePort) SubmitTransfer(arg0, arg1 int64, arg2 decimal.Decimal, arg3 model.TransferDetails) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubmitTransfer", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubmitTransfer indicates an expected call of SubmitTransfer.
+func (mr *MockTransferServicePortMockRecorder) SubmitTransfer(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubmitTransfer", reflect.TypeOf((*MockTransferServicePort)(nil).SubmitTransfer), arg0, arg1, arg2, arg3)
+}
+
+// SweepTransfer mocks base method.
+func (m *MockTransferServicePort) SweepTransfer(arg0 int64, arg1 []model.SweepSource, arg2 model.SweepMode, arg3 model.TransferDetails) (model.Sweep, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SweepTransfer", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.Sweep)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SweepTransfer indicates an expected call of SweepTransfer.
+func (mr *MockTransferServicePortMockRecorder) SweepTransfer(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SweepTransfer", reflect.TypeOf((*MockTransferServicePort)(nil).SweepTransfer), arg0, arg1, arg2, arg3)
+}
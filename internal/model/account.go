@@ -9,4 +9,114 @@ import (
 type Account struct {
 	AccountID int64
 	Balance   decimal.Decimal
+	// ParentAccountID places the account under another one; 0 for none
+	ParentAccountID int64
+	// Type is the place of the account in the chart of accounts; empty for a
+	// liability when it is created
+	Type AccountType
+}
+
+// AccountType is the place of an account in the chart of accounts
+type AccountType string
+
+// Account types
+const (
+	AccountAsset     AccountType = "asset"
+	AccountLiability AccountType = "liability"
+	AccountEquity    AccountType = "equity"
+	AccountRevenue   AccountType = "revenue"
+	AccountExpense   AccountType = "expense"
+)
+
+// Valid reports whether t is a known account type
+func (t AccountType) Valid() bool {
+	switch t {
+	case AccountAsset, AccountLiability, AccountEquity, AccountRevenue, AccountExpense:
+		return true
+	}
+	return false
+}
+
+// DebitNormal reports whether accounts of type t normally carry a debit
+// balance. Balances count credits as positive, so these are the accounts that
+// may go negative; the others must stay at or above zero.
+func (t AccountType) DebitNormal() bool {
+	return t == AccountAsset || t == AccountExpense
+}
+
+// SystemAccountRole is what a system account is reserved for
+type SystemAccountRole string
+
+// System account roles
+const (
+	// SystemClearing stands for the funds held outside the system
+	SystemClearing SystemAccountRole = "clearing"
+	// SystemFees collects the transfer fees
+	SystemFees SystemAccountRole = "fees"
+	// SystemInterestExpense pays the interest of the accounts
+	SystemInterestExpense SystemAccountRole = "interest_expense"
+	// SystemSuspense holds the funds that cannot be booked yet, on either side
+	SystemSuspense SystemAccountRole = "suspense"
+)
+
+// SystemAccount is an account the migrations create for the system itself
+type SystemAccount struct {
+	Role      SystemAccountRole
+	AccountID int64
+	Type      AccountType
+}
+
+// FirstReservedAccountID starts the account ids reserved for system accounts.
+// It stays below 2^53, so JSON clients represent every id exactly.
+const FirstReservedAccountID int64 = 9_000_000_000_000_000
+
+// System account ids
+const (
+	ClearingAccountID        = FirstReservedAccountID + 1
+	FeesAccountID            = FirstReservedAccountID + 2
+	InterestExpenseAccountID = FirstReservedAccountID + 3
+	SuspenseAccountID        = FirstReservedAccountID + 4
+)
+
+// SystemAccounts are the system accounts created by the migrations
+var SystemAccounts = []SystemAccount{
+	{Role: SystemClearing, AccountID: ClearingAccountID, Type: AccountAsset},
+	{Role: SystemFees, AccountID: FeesAccountID, Type: AccountRevenue},
+	{Role: SystemInterestExpense, AccountID: InterestExpenseAccountID, Type: AccountExpense},
+	{Role: SystemSuspense, AccountID: SuspenseAccountID, Type: AccountAsset},
+}
+
+// IsReservedAccountID reports whether id is reserved for system accounts
+func IsReservedAccountID(id int64) bool {
+	return id >= FirstReservedAccountID
+}
+
+// ChildBalancePolicy limits the balances of the descendants of an account
+type ChildBalancePolicy string
+
+// Child balance policies
+const (
+	// ChildBalanceUnlimited puts no limit on the descendants
+	ChildBalanceUnlimited ChildBalancePolicy = "none"
+	// ChildBalanceWithinParent keeps the descendants together at or below the
+	// account's own balance
+	ChildBalanceWithinParent ChildBalancePolicy = "within_parent_balance"
+)
+
+// Valid reports whether p is a known policy
+func (p ChildBalancePolicy) Valid() bool {
+	return p == ChildBalanceUnlimited || p == ChildBalanceWithinParent
+}
+
+// AccountNode is an account in a hierarchy of accounts
+type AccountNode struct {
+	AccountID       int64
+	ParentAccountID int64
+	ChildPolicy     ChildBalancePolicy
+	// Balance is the account's own balance
+	Balance decimal.Decimal
+	// TotalBalance is the own balance plus the balances of all descendants.
+	// Like Children, only nodes returned by the account service carry it.
+	TotalBalance decimal.Decimal
+	Children     []AccountNode
 }
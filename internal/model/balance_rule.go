@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// BalanceRuleTrigger is what made a balance rule run
+type BalanceRuleTrigger string
+
+// Balance rule triggers
+const (
+	// BalanceRuleAfterTransfer runs the rule after a committed transfer touched its account
+	BalanceRuleAfterTransfer BalanceRuleTrigger = "after_transfer"
+	// BalanceRuleScheduled runs the rule on its schedule
+	BalanceRuleScheduled BalanceRuleTrigger = "schedule"
+)
+
+// BalanceRule keeps the balance of an account between bounds by moving funds
+// to or from a counterparty account
+type BalanceRule struct {
+	ID                    int64
+	AccountID             int64
+	CounterpartyAccountID int64
+	// Min and Max bound the balance; a nil bound is not enforced, but at least
+	// one is set. Funds above Max go to the counterparty, and funds missing
+	// below Min come from it.
+	Min *decimal.Decimal
+	Max *decimal.Decimal
+	// AfterTransfer runs the rule after each committed transfer touching the account
+	AfterTransfer bool
+	// Schedule runs the rule on a schedule, as parsed by the schedule package;
+	// empty for none
+	Schedule string
+	// NextRunAt is the next scheduled run; nil without a schedule or when disabled
+	NextRunAt *time.Time
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Sweep returns the transfer that brings balance back within the bounds of
+// the rule, or a zero amount when it is within them
+func (r BalanceRule) Sweep(balance decimal.Decimal) (sourceID, destID int64, amount decimal.Decimal) {
+	switch {
+	case r.Max != nil && balance.GreaterThan(*r.Max):
+		return r.AccountID, r.CounterpartyAccountID, balance.Sub(*r.Max)
+	case r.Min != nil && balance.LessThan(*r.Min):
+		return r.CounterpartyAccountID, r.AccountID, r.Min.Sub(balance)
+	}
+	return 0, 0, decimal.Zero
+}
+
+// BalanceRuleSweep is a transfer made by a balance rule
+type BalanceRuleSweep struct {
+	ID                   int64
+	RuleID               int64
+	Trigger              BalanceRuleTrigger
+	SourceAccountID      int64
+	DestinationAccountID int64
+	Amount               decimal.Decimal
+	// Status is processing, completed or failed; a sweep left processing was
+	// interrupted and needs to be reconciled by hand
+	Status TransferStatus
+	// ErrorCode is the domain error code of a failed sweep
+	ErrorCode  string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
@@ -4,14 +4,99 @@ import "errors"
 
 // Domain-specific errors
 var (
-	ErrAccountNotFound                = errors.New("account not found")
-	ErrSourceAccountNotFound          = errors.New("source account not found")
-	ErrDestinationAccountNotFound     = errors.New("destination account not found")
-	ErrInsufficientFunds              = errors.New("insufficient funds")
-	ErrAccountIDMustBePositive        = errors.New("account id must be a positive number")
-	ErrBalanceMustBeNonNegative       = errors.New("balance must be non-negative")
-	ErrAccountIDAlreadyExists         = errors.New("account id already exists")
-	ErrSourceAndDestinationMustDiffer = errors.New("source and destination accounts must be different")
-	ErrAmountMustBePositive           = errors.New("amount must be positive")
-	ErrPrecisionTooHigh               = errors.New("precision must be 8 or fewer decimal places")
+	ErrAccountNotFound                  = errors.New("account not found")
+	ErrSourceAccountNotFound            = errors.New("source account not found")
+	ErrDestinationAccountNotFound       = errors.New("destination account not found")
+	ErrInsufficientFunds                = errors.New("insufficient funds")
+	ErrAccountIDMustBePositive          = errors.New("account id must be a positive number")
+	ErrBalanceMustBeNonNegative         = errors.New("balance must be non-negative")
+	ErrAccountIDAlreadyExists           = errors.New("account id already exists")
+	ErrSourceAndDestinationMustDiffer   = errors.New("source and destination accounts must be different")
+	ErrAmountMustBePositive             = errors.New("amount must be positive")
+	ErrPrecisionTooHigh                 = errors.New("precision exceeds the maximum number of decimal places")
+	ErrInvalidShardCount                = errors.New("invalid number of balance shards")
+	ErrBalanceShardingUnsupported       = errors.New("balance sharding is not supported by the storage driver")
+	ErrParentAccountNotFound            = errors.New("parent account not found")
+	ErrAccountHierarchyCycle            = errors.New("an account cannot be placed under itself or its descendants")
+	ErrChildBalanceLimitExceeded        = errors.New("descendants would hold more than the balance of an account limiting them")
+	ErrInvalidChildPolicy               = errors.New("child policy must be none or within_parent_balance")
+	ErrAccountHierarchyUnsupported      = errors.New("account hierarchies are not supported by the storage driver")
+	ErrInvalidAccountType               = errors.New("account type must be asset, liability, equity, revenue or expense")
+	ErrAccountTypesUnsupported          = errors.New("account types are not supported by the storage driver")
+	ErrDebitNormalAccountType           = errors.New("asset and expense accounts cannot be created through the API")
+	ErrAccountIDReserved                = errors.New("account ids from 9000000000000000 are reserved for system accounts")
+	ErrTransferQueueClosed              = errors.New("transfer queue is closed")
+	ErrTransferNotFound                 = errors.New("transfer not found")
+	ErrTransferIDMustBePositive         = errors.New("transfer id must be a positive number")
+	ErrRetryDeadlineBeforeExecution     = errors.New("retry deadline must be after the execution time")
+	ErrTransferNotCancellable           = errors.New("only scheduled transfers that have not started can be cancelled")
+	ErrTransferNotReversible            = errors.New("only completed transfers that are not reversals can be reversed")
+	ErrReversalExceedsOriginal          = errors.New("reversals must not exceed the amount of the original transfer")
+	ErrDuplicateExternalReference       = errors.New("external reference is already used by another transfer of the client")
+	ErrInvalidMetadata                  = errors.New("metadata must be a JSON object")
+	ErrMetadataTooLarge                 = errors.New("metadata exceeds the maximum size")
+	ErrInvalidSplit                     = errors.New("invalid split")
+	ErrInvalidSweep                     = errors.New("invalid sweep")
+	ErrStandingOrderNotFound            = errors.New("standing order not found")
+	ErrStandingOrderIDMustBePositive    = errors.New("standing order id must be a positive number")
+	ErrStandingOrderNotActive           = errors.New("standing order is no longer active")
+	ErrInvalidSchedule                  = errors.New("invalid schedule")
+	ErrEndBeforeStart                   = errors.New("end date must not be before the start date")
+	ErrInvalidMaxOccurrences            = errors.New("max occurrences must be non-negative")
+	ErrNoOccurrences                    = errors.New("schedule has no occurrence between the start and end dates")
+	ErrInvalidBusinessDayRule           = errors.New("business day rule must be none, following, modified-following or preceding")
+	ErrBalanceRuleNotFound              = errors.New("balance rule not found")
+	ErrBalanceRuleIDMustBePositive      = errors.New("balance rule id must be a positive number")
+	ErrInvalidBalanceRule               = errors.New("invalid balance rule")
+	ErrInterestProductNotFound          = errors.New("interest product not found")
+	ErrProductIDMustBePositive          = errors.New("interest product id must be a positive number")
+	ErrInvalidInterestProduct           = errors.New("invalid interest product")
+	ErrInterestNotAssigned              = errors.New("the account has no interest product")
+	ErrFeeScheduleNotFound              = errors.New("fee schedule not found")
+	ErrFeeScheduleIDMustBePositive      = errors.New("fee schedule id must be a positive number")
+	ErrInvalidFeeSchedule               = errors.New("invalid fee schedule")
+	ErrFeeScheduleExists                = errors.New("the client already has a fee schedule for the account type")
+	ErrInvalidFeeMode                   = errors.New("fee mode must be on_top or deducted")
+	ErrFeeExceedsAmount                 = errors.New("a deducted fee must be less than the amount")
+	ErrFeeAccountNotFound               = errors.New("fee account not found")
+	ErrExternalTransferNotFound         = errors.New("deposit or withdrawal not found")
+	ErrExternalTransferIDMustBePositive = errors.New("deposit or withdrawal id must be a positive number")
+	ErrExternalTransferNotPending       = errors.New("only pending deposits and withdrawals can be settled or failed")
+	ErrUnknownClearingAccount           = errors.New("clearing account must be one of the configured clearing accounts")
+	ErrClearingAccountsUnsupported      = errors.New("clearing accounts are not supported by the storage driver")
+	ErrClearingAccountNotAllowed        = errors.New("deposits and withdrawals cannot be made to or from a clearing account")
+	ErrSystemAccountSource              = errors.New("clearing and system accounts can only be debited by deposits, withdrawals and interest")
+	ErrSystemAccountNotAllowed          = errors.New("system accounts only take part in the fee, interest and clearing legs of transfers")
+	ErrClearingAccountInUse             = errors.New("an existing account can only be a clearing account if it is an asset account and no other system account")
 )
+
+// errorCodes are the stable codes recorded for transfers that failed with a domain error
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrSourceAccountNotFound, "source_account_not_found"},
+	{ErrDestinationAccountNotFound, "destination_account_not_found"},
+	{ErrAccountNotFound, "account_not_found"},
+	{ErrInsufficientFunds, "insufficient_funds"},
+	{ErrAccountIDMustBePositive, "invalid_account_id"},
+	{ErrSourceAndDestinationMustDiffer, "same_account"},
+	{ErrAmountMustBePositive, "invalid_amount"},
+	{ErrPrecisionTooHigh, "precision_too_high"},
+	{ErrChildBalanceLimitExceeded, "child_balance_limit_exceeded"},
+	{ErrInvalidFeeMode, "invalid_fee_mode"},
+	{ErrFeeExceedsAmount, "fee_exceeds_amount"},
+	{ErrFeeAccountNotFound, "fee_account_not_found"},
+	{ErrSystemAccountSource, "system_account_source"},
+	{ErrSystemAccountNotAllowed, "system_account"},
+}
+
+// ErrorCode returns the stable code of a domain error, or "" for any other error
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ExternalTransferKind tells a deposit from a withdrawal
+type ExternalTransferKind string
+
+// External transfer kinds
+const (
+	// Deposit brings funds into an account from a clearing account
+	Deposit ExternalTransferKind = "deposit"
+	// Withdrawal takes funds out of an account into a clearing account
+	Withdrawal ExternalTransferKind = "withdrawal"
+)
+
+// Valid reports whether k is a known external transfer kind
+func (k ExternalTransferKind) Valid() bool {
+	return k == Deposit || k == Withdrawal
+}
+
+// ExternalTransferStatus is the settlement state of a deposit or withdrawal
+type ExternalTransferStatus string
+
+// External transfer statuses. Pending deposits and withdrawals end up settled
+// once the outside party confirms them, or failed.
+const (
+	ExternalTransferPending ExternalTransferStatus = "pending"
+	ExternalTransferSettled ExternalTransferStatus = "settled"
+	ExternalTransferFailed  ExternalTransferStatus = "failed"
+)
+
+// ExternalTransfer moves funds between a customer account and a clearing
+// account, which stands for funds held outside the system and may go negative.
+//
+// A deposit credits the account only when it settles, so pending deposits are
+// not spendable. A withdrawal debits the account when it is made and returns
+// the funds if it fails.
+type ExternalTransfer struct {
+	ID                int64
+	Kind              ExternalTransferKind
+	AccountID         int64
+	ClearingAccountID int64
+	Amount            decimal.Decimal
+	Status            ExternalTransferStatus
+	// ClientID identifies the client; external references are unique per
+	// client and kind
+	ClientID string
+	// ExternalReference is the outside party's id of the transfer, or empty
+	ExternalReference string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
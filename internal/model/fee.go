@@ -0,0 +1,125 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// FeeKind is how a fee schedule computes the fee of a transfer
+type FeeKind string
+
+// Fee kinds
+const (
+	// FeeFlat charges the same fee on every transfer
+	FeeFlat FeeKind = "flat"
+	// FeePercentage charges a share of the amount
+	FeePercentage FeeKind = "percentage"
+	// FeeTiered charges the flat fee plus the share of the amount of the tier
+	// the amount falls in
+	FeeTiered FeeKind = "tiered"
+)
+
+// Valid reports whether k is a known fee kind
+func (k FeeKind) Valid() bool {
+	return k == FeeFlat || k == FeePercentage || k == FeeTiered
+}
+
+// FeeMode is how the fee of a transfer is paid
+type FeeMode string
+
+// Fee modes
+const (
+	// FeeOnTop debits the source with the amount plus the fee; the destination
+	// receives the full amount
+	FeeOnTop FeeMode = "on_top"
+	// FeeDeducted takes the fee out of the amount; the destination receives
+	// the amount less the fee
+	FeeDeducted FeeMode = "deducted"
+)
+
+// Valid reports whether m is a known fee mode
+func (m FeeMode) Valid() bool {
+	return m == FeeOnTop || m == FeeDeducted
+}
+
+// FeeTier is the fee of the transfers of at least MinAmount, up to the next
+// tier: Flat plus Rate, as a fraction (0.01 for 1%), of the amount
+type FeeTier struct {
+	MinAmount decimal.Decimal
+	Flat      decimal.Decimal
+	Rate      decimal.Decimal
+}
+
+// FeeSchedule is how the transfers of a client, or from accounts of a type,
+// are charged
+type FeeSchedule struct {
+	ID   int64
+	Name string
+	// ClientID is the client charged by the schedule; the schedule with an
+	// empty client id charges the clients without a schedule of their own
+	ClientID string
+	// AccountType is the type of the source accounts charged by the schedule;
+	// the schedule with an empty type charges every type without a schedule
+	// of its own
+	AccountType AccountType
+	Kind        FeeKind
+	// Flat is the fee of a flat schedule
+	Flat decimal.Decimal
+	// Rate is the share of the amount, as a fraction, of a percentage schedule
+	Rate decimal.Decimal
+	// MinFee and MaxFee bound the fee; a zero MaxFee does not cap it
+	MinFee decimal.Decimal
+	MaxFee decimal.Decimal
+	// Tiers of a tiered schedule are in ascending MinAmount order
+	Tiers     []FeeTier
+	CreatedAt time.Time
+}
+
+// Fee returns the fee of a transfer of amount, rounded to places
+func (s FeeSchedule) Fee(amount decimal.Decimal, places int32) decimal.Decimal {
+	fee := decimal.Zero
+	switch s.Kind {
+	case FeeFlat:
+		fee = s.Flat
+	case FeePercentage:
+		fee = amount.Mul(s.Rate)
+	case FeeTiered:
+		for _, tier := range s.Tiers {
+			if amount.LessThan(tier.MinAmount) {
+				break
+			}
+			fee = tier.Flat.Add(amount.Mul(tier.Rate))
+		}
+	}
+	fee = decimal.Max(fee, s.MinFee)
+	if s.MaxFee.IsPositive() {
+		fee = decimal.Min(fee, s.MaxFee)
+	}
+	return fee.Round(places)
+}
+
+// Fee is the fee charged with a transfer, credited to the fee account
+type Fee struct {
+	// ScheduleID is the schedule that charged the fee, or 0 once it is deleted
+	ScheduleID int64
+	AccountID  int64
+	Amount     decimal.Decimal
+	Mode       FeeMode
+}
+
+// Debit returns what the source of a transfer of amount is debited with
+func (f Fee) Debit(amount decimal.Decimal) decimal.Decimal {
+	if f.Mode == FeeDeducted {
+		return amount
+	}
+	return amount.Add(f.Amount)
+}
+
+// Credit returns what the destination of a transfer of amount is credited with
+func (f Fee) Credit(amount decimal.Decimal) decimal.Decimal {
+	if f.Mode == FeeDeducted {
+		return amount.Sub(f.Amount)
+	}
+	return amount
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// InterestPlaces is the number of decimal places accrued interest is kept at,
+// the scale of the NUMERIC(38, 20) interest columns
+const InterestPlaces int32 = 20
+
+// InterestMethod is how an interest product compounds
+type InterestMethod string
+
+// Interest methods
+const (
+	// InterestSimple accrues on the balance only
+	InterestSimple InterestMethod = "simple"
+	// InterestCompound accrues on the balance plus the interest accrued but
+	// not yet posted, compounding daily
+	InterestCompound InterestMethod = "compound"
+)
+
+// Valid reports whether m is a known interest method
+func (m InterestMethod) Valid() bool {
+	return m == InterestSimple || m == InterestCompound
+}
+
+// InterestTier is the annual rate, as a fraction (0.05 for 5%), paid on the
+// part of a balance from MinBalance up to the next tier
+type InterestTier struct {
+	MinBalance decimal.Decimal
+	Rate       decimal.Decimal
+}
+
+// InterestProduct accrues interest daily at rates tiered by balance band and
+// posts it monthly
+type InterestProduct struct {
+	ID     int64
+	Name   string
+	Method InterestMethod
+	// DayCount is the number of days in a year of the annual rates, 360 or 365
+	DayCount int
+	// Tiers are in ascending MinBalance order
+	Tiers     []InterestTier
+	CreatedAt time.Time
+}
+
+// DailyInterest returns the interest of one day on base, each band of base
+// earning the rate of its tier, at InterestPlaces
+func (p InterestProduct) DailyInterest(base decimal.Decimal) decimal.Decimal {
+	yearly := decimal.Zero
+	for i, tier := range p.Tiers {
+		if base.LessThanOrEqual(tier.MinBalance) {
+			break
+		}
+		band := base.Sub(tier.MinBalance)
+		if i+1 < len(p.Tiers) {
+			band = decimal.Min(band, p.Tiers[i+1].MinBalance.Sub(tier.MinBalance))
+		}
+		yearly = yearly.Add(band.Mul(tier.Rate))
+	}
+	return yearly.DivRound(decimal.NewFromInt(int64(p.DayCount)), InterestPlaces)
+}
+
+// AccountInterest is the interest state of an account
+type AccountInterest struct {
+	AccountID int64
+	// ProductID is the product accruing on the account, or 0 when it no
+	// longer accrues
+	ProductID int64
+	// NextAccrualDay is the first day not accrued yet, a date at UTC midnight
+	NextAccrualDay time.Time
+	// Accrued is the interest accrued but not posted yet
+	Accrued decimal.Decimal
+	// Residual is what rounding left of the posted interest, carried into the
+	// next posting
+	Residual  decimal.Decimal
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// InterestAccrual is the interest accrued by an account on one day
+type InterestAccrual struct {
+	AccountID int64
+	// Day is a date at UTC midnight
+	Day       time.Time
+	ProductID int64
+	// Base is the end-of-day balance interest accrued on, plus the unposted
+	// interest for compound products
+	Base   decimal.Decimal
+	Amount decimal.Decimal
+	// PostingID is the posting that paid the accrual, or 0 while it is unposted
+	PostingID int64
+}
+
+// BalanceSnapshot is the balance of an account seen by the last interest run
+// of a day, which interest accrues on once the day has ended
+type BalanceSnapshot struct {
+	AccountID int64
+	// Day is a date at UTC midnight
+	Day     time.Time
+	Balance decimal.Decimal
+}
+
+// InterestPosting is a transfer of accrued interest from the house account
+type InterestPosting struct {
+	ID        int64
+	AccountID int64
+	// PeriodStart and PeriodEnd are the first and last days of the month
+	// posted, dates at UTC midnight. Accruals left over from failed postings
+	// are posted with the next period.
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	// Accrued is the sum of the accruals posted and CarriedResidual the
+	// residual of the previous posting; Amount is their sum rounded down to
+	// the money precision, and Residual what is left over
+	Accrued         decimal.Decimal
+	CarriedResidual decimal.Decimal
+	Amount          decimal.Decimal
+	Residual        decimal.Decimal
+	Status          TransferStatus
+	ErrorCode       string
+	CreatedAt       time.Time
+	FinishedAt      *time.Time
+}
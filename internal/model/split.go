@@ -0,0 +1,12 @@
+package model
+
+import "github.com/shopspring/decimal"
+
+// SplitShare is the part of a split credited to one destination: either a
+// fixed Amount, or a Percent of what is left of the total after the fixed
+// amounts
+type SplitShare struct {
+	DestinationAccountID int64
+	Amount               decimal.Decimal
+	Percent              decimal.Decimal
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// StandingOrderStatus is the state of a standing order
+type StandingOrderStatus string
+
+// Standing order statuses. An active order becomes completed after its last
+// occurrence, or cancelled when stopped early.
+const (
+	StandingOrderActive    StandingOrderStatus = "active"
+	StandingOrderCompleted StandingOrderStatus = "completed"
+	StandingOrderCancelled StandingOrderStatus = "cancelled"
+)
+
+// Valid reports whether s is a known standing order status
+func (s StandingOrderStatus) Valid() bool {
+	switch s {
+	case StandingOrderActive, StandingOrderCompleted, StandingOrderCancelled:
+		return true
+	}
+	return false
+}
+
+// OccurrenceInterrupted is the error code of an occurrence whose scheduler
+// stopped while running it. The transfer may or may not have been made, so it
+// is not attempted again and needs to be reconciled by hand.
+const OccurrenceInterrupted = "interrupted"
+
+// StandingOrder is a transfer repeated on a schedule
+type StandingOrder struct {
+	ID                   int64
+	SourceAccountID      int64
+	DestinationAccountID int64
+	Amount               decimal.Decimal
+	// Schedule is the spec of the recurrence, as parsed by the schedule package
+	Schedule string
+	// StartAt anchors the schedule; no occurrence is before it
+	StartAt time.Time
+	// EndAt is the last time an occurrence may fall on; nil repeats indefinitely
+	EndAt *time.Time
+	// MaxOccurrences limits the number of occurrences; 0 means no limit
+	MaxOccurrences int
+	// Occurrences counts the occurrences run so far, failed ones included
+	Occurrences int
+	// BusinessDayRule moves occurrences that miss a business day, as parsed by
+	// the calendar package
+	BusinessDayRule string
+	// NextOccurrenceAt is the next occurrence of the schedule, and NextRunAt
+	// when it is due after the business day rule moved it; both are nil once
+	// the order is no longer active
+	NextOccurrenceAt *time.Time
+	NextRunAt        *time.Time
+	Status           StandingOrderStatus
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// StandingOrderOccurrence is one run of a standing order
+type StandingOrderOccurrence struct {
+	StandingOrderID int64
+	// ScheduledFor is the occurrence time before any business day adjustment;
+	// each is run at most once
+	ScheduledFor time.Time
+	// Status is processing, completed or failed
+	Status TransferStatus
+	// ErrorCode is the domain error code of a failed occurrence, or OccurrenceInterrupted
+	ErrorCode  string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+}
@@ -0,0 +1,53 @@
+package model
+
+import "github.com/shopspring/decimal"
+
+// SweepSource is an account a sweep pulls funds from: either a fixed Amount,
+// or everything above Floor when Floor is set
+type SweepSource struct {
+	SourceAccountID int64
+	Amount          decimal.Decimal
+	Floor           *decimal.Decimal
+}
+
+// SweepMode decides what happens to a sweep when a source cannot be swept
+type SweepMode string
+
+// Sweep modes
+const (
+	// SweepAtomic moves the funds of every source or of none
+	SweepAtomic SweepMode = "atomic"
+	// SweepBestEffort moves the funds of the sources that can be swept and
+	// reports the others
+	SweepBestEffort SweepMode = "best_effort"
+)
+
+// SweepResultStatus is the outcome of a sweep for one source
+type SweepResultStatus string
+
+// Sweep result statuses
+const (
+	SweepResultCompleted SweepResultStatus = "completed"
+	// SweepResultSkipped is a source with nothing above its floor
+	SweepResultSkipped SweepResultStatus = "skipped"
+	SweepResultFailed  SweepResultStatus = "failed"
+)
+
+// SweepResult reports what a sweep did with one source
+type SweepResult struct {
+	SourceAccountID int64
+	// Amount is the amount moved from the source
+	Amount decimal.Decimal
+	Status SweepResultStatus
+	// ErrorCode is the domain error code of a failed source
+	ErrorCode string
+	// TransferID is the id of the leg that moved the funds
+	TransferID int64
+}
+
+// Sweep is a sweep and its results in the order of its sources. Transfer is
+// the parent transfer with its legs; it is zero when nothing moved.
+type Sweep struct {
+	Transfer Transfer
+	Results  []SweepResult
+}
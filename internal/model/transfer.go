@@ -0,0 +1,140 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// TransferStatus is the processing state of an asynchronous transfer
+type TransferStatus string
+
+// Transfer statuses, in the order a transfer moves through them. A scheduled
+// transfer waits for its execution time, and returns to scheduled while
+// failed attempts are retried.
+const (
+	TransferPending    TransferStatus = "pending"
+	TransferScheduled  TransferStatus = "scheduled"
+	TransferProcessing TransferStatus = "processing"
+	TransferCompleted  TransferStatus = "completed"
+	TransferFailed     TransferStatus = "failed"
+	TransferCancelled  TransferStatus = "cancelled"
+)
+
+// Valid reports whether s is a known transfer status
+func (s TransferStatus) Valid() bool {
+	switch s {
+	case TransferPending, TransferScheduled, TransferProcessing, TransferCompleted, TransferFailed, TransferCancelled:
+		return true
+	}
+	return false
+}
+
+// TransferKind tells a transfer between two accounts from the parent of a
+// transfer with several legs
+type TransferKind string
+
+// Transfer kinds
+const (
+	// TransferKindTransfer moves funds from one account to another
+	TransferKindTransfer TransferKind = "transfer"
+	// TransferKindSplit debits its source and credits the destinations of its
+	// legs; it has no destination of its own
+	TransferKindSplit TransferKind = "split"
+	// TransferKindSweep debits the sources of its legs and credits its
+	// destination; it has no source of its own
+	TransferKindSweep TransferKind = "sweep"
+)
+
+// TransferDetails describe a transfer for the client that submitted it
+type TransferDetails struct {
+	// ClientID identifies the client; external references are unique per client
+	ClientID    string
+	Description string
+	// ExternalReference is the client's own id of the transfer
+	ExternalReference string
+	// Metadata is an arbitrary JSON object, or nil
+	Metadata json.RawMessage
+	// FeeMode is how the client pays the fee of the transfer; empty pays it on
+	// top. It is not stored: a charged fee records its mode.
+	FeeMode FeeMode
+}
+
+// Empty reports whether the details carry no description, external reference
+// or metadata; a client id or fee mode alone describes nothing
+func (d TransferDetails) Empty() bool {
+	return d.Description == "" && d.ExternalReference == "" && len(d.Metadata) == 0
+}
+
+// Transfer is a transfer recorded for asynchronous processing, or booked
+// together with its funds
+type Transfer struct {
+	ID                   int64
+	SourceAccountID      int64
+	DestinationAccountID int64
+	Amount               decimal.Decimal
+	Status               TransferStatus
+	// Kind is empty or TransferKindTransfer for a transfer between two accounts
+	Kind TransferKind
+	TransferDetails
+	// Fee is the fee charged with a transfer between two accounts, or nil
+	Fee *Fee
+	// ErrorCode is the domain error code of a failed transfer, or of the last
+	// failed attempt of a scheduled transfer that will be retried
+	ErrorCode string
+	// Attempts counts how often a worker has claimed the transfer
+	Attempts  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// ExecuteAt is when a scheduled transfer should run; nil runs it right away
+	ExecuteAt *time.Time
+	// RetryUntil is the deadline for retrying a failed scheduled transfer; nil
+	// fails it on the first error
+	RetryUntil *time.Time
+	// NextAttemptAt is when a scheduled transfer is next due
+	NextAttemptAt *time.Time
+
+	// ReversalOf is the id of the transfer a reversal moves funds back for
+	ReversalOf *int64
+	// Reversals are the reversals of a completed transfer in id order. Only
+	// transfers returned by the transfer service carry them.
+	Reversals []Transfer
+
+	// ParentID is the id of the split or sweep a leg belongs to
+	ParentID *int64
+	// Legs are the legs of a split or sweep in id order. Like Reversals, only transfers
+	// returned by the transfer service carry them.
+	Legs []Transfer
+}
+
+// Debited returns what the source of the transfer is debited with, its amount
+// plus a fee charged on top
+func (t Transfer) Debited() decimal.Decimal {
+	if t.Fee == nil {
+		return t.Amount
+	}
+	return t.Fee.Debit(t.Amount)
+}
+
+// Credited returns what the destination of the transfer is credited with, its
+// amount less a deducted fee
+func (t Transfer) Credited() decimal.Decimal {
+	if t.Fee == nil {
+		return t.Amount
+	}
+	return t.Fee.Credit(t.Amount)
+}
+
+// TransferQuote is what a transfer would do if it were made now
+type TransferQuote struct {
+	SourceAccountID      int64
+	DestinationAccountID int64
+	Amount               decimal.Decimal
+	// Fee is the fee the transfer would be charged, or nil
+	Fee *Fee
+	// Balances are those the source, destination and fee accounts would have
+	// after the transfer, in that order; nil when the transfer would fail
+	Balances []Account
+}
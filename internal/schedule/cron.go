@@ -0,0 +1,144 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// cronSearchLimit bounds the search for the next match, so an expression that
+// can never match, like "0 0 30 2 *", ends instead of looping forever
+const cronSearchLimit = 100_000
+
+// cron matches the five fields of a cron expression in the start's location.
+// As in cron, when both day fields are restricted a day matching either matches.
+type cron struct {
+	start                         time.Time
+	minute, hour, dom, month, dow []bool
+	domRestricted, dowRestricted  bool
+}
+
+// cronField describes the values allowed in a field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCron(spec string, start time.Time) (Schedule, error) {
+	fields := strings.Fields(spec)
+	var sets [5][]bool
+	for i, f := range cronFields {
+		set, err := parseCronField(fields[i], f)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", model.ErrInvalidSchedule, err)
+		}
+		sets[i] = set
+	}
+	// 7 is Sunday too
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return cron{
+		start:         start,
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of *, n, a-b, optionally
+// followed by /step
+func parseCronField(field string, f cronField) ([]bool, error) {
+	set := make([]bool, f.max+1)
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("bad step in %s field %q", f.name, field)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			var err error
+			lo, hi, err = parseCronRange(rng, f)
+			if err != nil {
+				return nil, fmt.Errorf("%v in %s field %q", err, f.name, field)
+			}
+			if step > 1 && lo == hi {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func parseCronRange(rng string, f cronField) (int, int, error) {
+	loText, hiText, isRange := strings.Cut(rng, "-")
+	lo, err := strconv.Atoi(loText)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad value %q", loText)
+	}
+	hi := lo
+	if isRange {
+		if hi, err = strconv.Atoi(hiText); err != nil {
+			return 0, 0, fmt.Errorf("bad value %q", hiText)
+		}
+	}
+	if lo < f.min || hi > f.max || lo > hi {
+		return 0, 0, fmt.Errorf("range %q outside %d-%d", rng, f.min, f.max)
+	}
+	return lo, hi, nil
+}
+
+func (s cron) Next(t time.Time) time.Time {
+	if t.Before(s.start) {
+		t = s.start.Add(-time.Nanosecond)
+	}
+	loc := s.start.Location()
+	t = t.In(loc)
+	// Start at the first whole minute after t
+	c := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	for i := 0; i < cronSearchLimit; i++ {
+		switch {
+		case !s.month[c.Month()]:
+			c = time.Date(c.Year(), c.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(c):
+			c = time.Date(c.Year(), c.Month(), c.Day()+1, 0, 0, 0, 0, loc)
+		case !s.hour[c.Hour()]:
+			c = time.Date(c.Year(), c.Month(), c.Day(), c.Hour()+1, 0, 0, 0, loc)
+		case !s.minute[c.Minute()]:
+			c = time.Date(c.Year(), c.Month(), c.Day(), c.Hour(), c.Minute()+1, 0, 0, loc)
+		default:
+			return c
+		}
+	}
+	return time.Time{}
+}
+
+func (s cron) dayMatches(c time.Time) bool {
+	dom, dow := s.dom[c.Day()], s.dow[c.Weekday()]
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
@@ -0,0 +1,163 @@
+// Package schedule computes the occurrence times of recurring transfers.
+//
+// A schedule is parsed from a spec anchored at a start time. Occurrences are
+// never before the start, and the named schedules run at the start's time of
+// day in the start's location:
+//
+//	daily               every day
+//	weekly              every week, on the start's weekday
+//	monthly:N           every month on day N (1-31); shorter months use their last day
+//	last-business-day   every month on its last business day
+//	every <duration>    at a fixed interval from the start, e.g. "every 12h" (at least 1m)
+//	<cron expression>   five fields: minute hour day-of-month month day-of-week
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"internal-transfers/internal/model"
+)
+
+// MinInterval is the shortest interval accepted by "every <duration>"
+const MinInterval = time.Minute
+
+// Schedule produces the occurrence times of a recurring transfer
+type Schedule interface {
+	// Next returns the first occurrence strictly after t, or the zero time
+	// when there is none
+	Next(t time.Time) time.Time
+}
+
+// BusinessDayFunc reports whether the date of day is a business day
+type BusinessDayFunc func(day time.Time) bool
+
+// Weekdays treats Monday to Friday as business days
+func Weekdays(day time.Time) bool {
+	return day.Weekday() != time.Saturday && day.Weekday() != time.Sunday
+}
+
+// Parse parses spec anchored at start; errors wrap model.ErrInvalidSchedule.
+// isBusinessDay decides which days count for "last-business-day"; nil uses
+// Weekdays.
+func Parse(spec string, start time.Time, isBusinessDay BusinessDayFunc) (Schedule, error) {
+	if isBusinessDay == nil {
+		isBusinessDay = Weekdays
+	}
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "daily":
+		return dayStep{start: start, days: 1}, nil
+	case spec == "weekly":
+		return dayStep{start: start, days: 7}, nil
+	case spec == "last-business-day":
+		return monthly{start: start, isBusinessDay: isBusinessDay}, nil
+	case strings.HasPrefix(spec, "monthly:"):
+		day, err := strconv.Atoi(strings.TrimPrefix(spec, "monthly:"))
+		if err != nil || day < 1 || day > 31 {
+			return nil, fmt.Errorf("%w: day of month must be between 1 and 31", model.ErrInvalidSchedule)
+		}
+		return monthly{start: start, day: day}, nil
+	case strings.HasPrefix(spec, "every "):
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "every ")))
+		if err != nil || every < MinInterval {
+			return nil, fmt.Errorf("%w: interval must be a duration of at least %v", model.ErrInvalidSchedule, MinInterval)
+		}
+		return interval{start: start, every: every}, nil
+	case len(strings.Fields(spec)) == 5:
+		return parseCron(spec, start)
+	}
+	return nil, fmt.Errorf("%w: %q", model.ErrInvalidSchedule, spec)
+}
+
+// First returns the first occurrence of s at or after start
+func First(s Schedule, start time.Time) time.Time {
+	return s.Next(start.Add(-time.Nanosecond))
+}
+
+// interval occurs at start + k * every
+type interval struct {
+	start time.Time
+	every time.Duration
+}
+
+func (s interval) Next(t time.Time) time.Time {
+	if t.Before(s.start) {
+		return s.start
+	}
+	k := t.Sub(s.start)/s.every + 1
+	return s.start.Add(k * s.every)
+}
+
+// dayStep occurs every days calendar days at the start's time of day, so
+// daylight saving changes do not shift it
+type dayStep struct {
+	start time.Time
+	days  int
+}
+
+func (s dayStep) Next(t time.Time) time.Time {
+	if t.Before(s.start) {
+		return s.start
+	}
+	// Estimate the step from the elapsed time, then correct for DST shifts
+	n := int(t.Sub(s.start)/(24*time.Hour)) / s.days
+	for n > 0 && s.at(n).After(t) {
+		n--
+	}
+	for !s.at(n).After(t) {
+		n++
+	}
+	return s.at(n)
+}
+
+func (s dayStep) at(n int) time.Time {
+	return s.start.AddDate(0, 0, n*s.days)
+}
+
+// monthly occurs once a month: on day, or on the last business day when
+// isBusinessDay is set
+type monthly struct {
+	start         time.Time
+	day           int
+	isBusinessDay BusinessDayFunc
+}
+
+func (s monthly) Next(t time.Time) time.Time {
+	from := t
+	if from.Before(s.start) {
+		from = s.start
+	}
+	from = from.In(s.start.Location())
+	// The occurrence of the previous month can still be after t when a later
+	// day of this month rolls back, so start one month early
+	year, month := from.Year(), from.Month()-1
+	for i := 0; i < 14; i++ {
+		c, ok := s.in(year, month+time.Month(i))
+		if ok && !c.Before(s.start) && c.After(t) {
+			return c
+		}
+	}
+	return time.Time{}
+}
+
+// in returns the occurrence in the given month, which is normalized like time.Date
+func (s monthly) in(year int, month time.Month) (time.Time, bool) {
+	h, m, sec := s.start.Clock()
+	loc := s.start.Location()
+	first := time.Date(year, month, 1, h, m, sec, s.start.Nanosecond(), loc)
+	last := first.AddDate(0, 1, -1).Day()
+
+	if s.isBusinessDay == nil {
+		return time.Date(first.Year(), first.Month(), min(s.day, last), h, m, sec, s.start.Nanosecond(), loc), true
+	}
+	for day := last; day >= 1; day-- {
+		c := time.Date(first.Year(), first.Month(), day, h, m, sec, s.start.Nanosecond(), loc)
+		if s.isBusinessDay(c) {
+			return c, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,116 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+// occurrences returns the first n occurrences of spec from start
+func occurrences(t *testing.T, spec string, start time.Time, n int) []time.Time {
+	t.Helper()
+	s, err := Parse(spec, start, nil)
+	require.NoError(t, err)
+	var got []time.Time
+	for c := First(s, start); len(got) < n && !c.IsZero(); c = s.Next(c) {
+		got = append(got, c)
+	}
+	return got
+}
+
+func TestParse_Occurrences(t *testing.T) {
+	testCases := []struct {
+		name  string
+		spec  string
+		start time.Time
+		want  []time.Time
+	}{
+		{"Daily", "daily", date(2026, 3, 30, 9, 0),
+			[]time.Time{date(2026, 3, 30, 9, 0), date(2026, 3, 31, 9, 0), date(2026, 4, 1, 9, 0)}},
+		{"Weekly", "weekly", date(2026, 3, 30, 9, 0),
+			[]time.Time{date(2026, 3, 30, 9, 0), date(2026, 4, 6, 9, 0), date(2026, 4, 13, 9, 0)}},
+		{"MonthlyAfterStartDay", "monthly:15", date(2026, 1, 20, 8, 30),
+			[]time.Time{date(2026, 2, 15, 8, 30), date(2026, 3, 15, 8, 30)}},
+		{"MonthlyClampsShortMonths", "monthly:31", date(2026, 1, 1, 0, 0),
+			[]time.Time{date(2026, 1, 31, 0, 0), date(2026, 2, 28, 0, 0), date(2026, 3, 31, 0, 0), date(2026, 4, 30, 0, 0)}},
+		// January 31 2026 is a Saturday and May 31 a Sunday
+		{"LastBusinessDay", "last-business-day", date(2026, 1, 1, 17, 0),
+			[]time.Time{date(2026, 1, 30, 17, 0), date(2026, 2, 27, 17, 0), date(2026, 3, 31, 17, 0), date(2026, 4, 30, 17, 0), date(2026, 5, 29, 17, 0)}},
+		{"Interval", "every 36h", date(2026, 1, 1, 0, 0),
+			[]time.Time{date(2026, 1, 1, 0, 0), date(2026, 1, 2, 12, 0), date(2026, 1, 4, 0, 0)}},
+		{"CronWeekdays", "0 9 * * 1-5", date(2026, 1, 2, 10, 0),
+			[]time.Time{date(2026, 1, 5, 9, 0), date(2026, 1, 6, 9, 0), date(2026, 1, 7, 9, 0)}},
+		{"CronSteps", "*/20 6 1 * *", date(2026, 1, 1, 0, 0),
+			[]time.Time{date(2026, 1, 1, 6, 0), date(2026, 1, 1, 6, 20), date(2026, 1, 1, 6, 40), date(2026, 2, 1, 6, 0)}},
+		// Either day field matches when both are restricted
+		{"CronDayOfMonthOrWeek", "0 0 13 * 5", date(2026, 2, 1, 0, 0),
+			[]time.Time{date(2026, 2, 6, 0, 0), date(2026, 2, 13, 0, 0), date(2026, 2, 20, 0, 0)}},
+		{"CronSundayAsSeven", "30 12 * * 7", date(2026, 1, 1, 0, 0),
+			[]time.Time{date(2026, 1, 4, 12, 30), date(2026, 1, 11, 12, 30)}},
+		{"CronNeverMatches", "0 0 30 2 *", date(2026, 1, 1, 0, 0), nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, occurrences(t, tc.spec, tc.start, max(len(tc.want), 1)))
+		})
+	}
+}
+
+func TestParse_NextFromArbitraryTime(t *testing.T) {
+	start := date(2026, 1, 1, 9, 0)
+	for _, spec := range []string{"daily", "weekly", "monthly:1", "last-business-day", "every 90m", "15 9 * * *"} {
+		s, err := Parse(spec, start, nil)
+		require.NoError(t, err, spec)
+		// Before the start the first occurrence is returned
+		assert.Equal(t, First(s, start), s.Next(start.AddDate(-1, 0, 0)), spec)
+		// Next is never at or before the given time, and never skips an occurrence
+		at := date(2026, 6, 17, 13, 7)
+		next := s.Next(at)
+		assert.True(t, next.After(at), spec)
+		c := First(s, start)
+		for !c.After(at) {
+			c = s.Next(c)
+		}
+		assert.Equal(t, c, next, spec)
+	}
+}
+
+func TestParse_KeepsLocalTimeAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	start := time.Date(2026, 3, 28, 9, 0, 0, 0, loc)
+	got := occurrences(t, "daily", start, 3)
+	for _, c := range got {
+		assert.Equal(t, 9, c.Hour())
+	}
+	// Clocks move forward on March 29
+	assert.Equal(t, 23*time.Hour, got[1].Sub(got[0]))
+}
+
+func TestParse_BusinessDayFunc(t *testing.T) {
+	// April 30 2026 is a Thursday; treat it as a holiday
+	isBusinessDay := func(day time.Time) bool {
+		return Weekdays(day) && !(day.Month() == time.April && day.Day() == 30)
+	}
+	s, err := Parse("last-business-day", date(2026, 4, 1, 0, 0), isBusinessDay)
+	require.NoError(t, err)
+	assert.Equal(t, date(2026, 4, 29, 0, 0), First(s, date(2026, 4, 1, 0, 0)))
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "hourly", "monthly:0", "monthly:32", "monthly:x", "every 30s", "every soon",
+		"60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "* * * *"} {
+		_, err := Parse(spec, date(2026, 1, 1, 0, 0), nil)
+		assert.ErrorIs(t, err, model.ErrInvalidSchedule, spec)
+	}
+}
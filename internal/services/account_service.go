@@ -7,11 +7,14 @@ import (
 	"internal-transfers/internal/model"
 	"log"
 
-	"github.com/lib/pq"
 	"github.com/shopspring/decimal"
 )
 
-const maxDecimalPrecision = 8
+// defaultMaxDecimalPrecision matches the scale of the NUMERIC(20, 8) balance column
+const defaultMaxDecimalPrecision = 8
+
+// MaxBalanceShards is the largest number of shard rows an account may use
+const MaxBalanceShards = 256
 
 // AccountServicePort defines the service interface for accounts
 //
@@ -20,14 +23,87 @@ type AccountServicePort interface {
 	CreateAccount(account model.Account) error
 	GetAccount(id int64) (model.Account, error)
 	Transfer(sourceID, destID int64, amount decimal.Decimal) error
+	TransferWithFee(sourceID, destID int64, amount decimal.Decimal, clientID string, mode model.FeeMode) (*model.Fee, error)
+	QuoteTransfer(sourceID, destID int64, amount decimal.Decimal, clientID string, mode model.FeeMode) (model.TransferQuote, error)
+	SetBalanceShards(accountID int64, shards int) error
+	SetAccountParent(accountID, parentID int64) error
+	SetChildBalancePolicy(accountID int64, policy model.ChildBalancePolicy) error
+	GetAccountTree(accountID int64) (model.AccountNode, error)
 }
 
+// sourcePolicy says which accounts a transfer may debit
+type sourcePolicy int
+
+const (
+	// clientSource debits only accounts that are not debit-normal, within
+	// their balance. Every transfer a client asks for uses it.
+	clientSource sourcePolicy = iota
+	// systemSource also debits the debit-normal clearing and system accounts,
+	// which may go negative. Only deposits, withdrawals and interest postings
+	// use it.
+	systemSource
+)
+
+// TransferObserver is told about each transfer once it is committed. It is
+// called synchronously by the committing goroutine and must not block.
+type TransferObserver func(sourceID, destID int64)
+
 type AccountService struct {
-	repo db.AccountRepositoryPort
+	repo            db.AccountRepositoryPort
+	maxPrecision    int32
+	singleStatement bool
+	observers       []TransferObserver
+
+	feeSchedules db.FeeScheduleRepositoryPort
+	feeAccountID int64
+}
+
+// AccountServiceOption customizes an AccountService
+type AccountServiceOption func(*AccountService)
+
+// WithMaxPrecision sets the maximum number of decimal places accepted for amounts
+func WithMaxPrecision(places int32) AccountServiceOption {
+	return func(s *AccountService) {
+		s.maxPrecision = places
+	}
+}
+
+// WithSingleStatementTransfer makes Transfer use the repository's single round
+// trip transfer when the repository implements db.FundsTransferrer
+func WithSingleStatementTransfer(enabled bool) AccountServiceOption {
+	return func(s *AccountService) {
+		s.singleStatement = enabled
+	}
+}
+
+// WithFees makes TransferWithFee and the transfer service charge the fees of
+// the schedules, credited to feeAccountID
+func WithFees(schedules db.FeeScheduleRepositoryPort, feeAccountID int64) AccountServiceOption {
+	return func(s *AccountService) {
+		s.feeSchedules = schedules
+		s.feeAccountID = feeAccountID
+	}
+}
+
+func NewAccountService(repo db.AccountRepositoryPort, opts ...AccountServiceOption) *AccountService {
+	s := &AccountService{repo: repo, maxPrecision: defaultMaxDecimalPrecision}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// OnTransferCommitted adds an observer of committed transfers. Observers must be
+// added before the service makes transfers.
+func (s *AccountService) OnTransferCommitted(observer TransferObserver) {
+	s.observers = append(s.observers, observer)
 }
 
-func NewAccountService(repo db.AccountRepositoryPort) *AccountService {
-	return &AccountService{repo: repo}
+// committed tells the observers about a committed transfer
+func (s *AccountService) committed(sourceID, destID int64) {
+	for _, observer := range s.observers {
+		observer(sourceID, destID)
+	}
 }
 
 // Validation helpers
@@ -38,9 +114,9 @@ func validateAccountID(id int64) error {
 	return nil
 }
 
-func validateDecimalPrecision(val decimal.Decimal) error {
-	if val.Exponent() < -maxDecimalPrecision {
-		return model.ErrPrecisionTooHigh
+func (s *AccountService) validateDecimalPrecision(val decimal.Decimal) error {
+	if val.Exponent() < -s.maxPrecision {
+		return fmt.Errorf("%w (%d)", model.ErrPrecisionTooHigh, s.maxPrecision)
 	}
 	return nil
 }
@@ -51,22 +127,49 @@ func (s *AccountService) CreateAccount(account model.Account) error {
 		log.Printf("CreateAccount validation failed: %v", err)
 		return err
 	}
+	if model.IsReservedAccountID(account.AccountID) {
+		log.Printf("CreateAccount reserved account id: %d", account.AccountID)
+		return model.ErrAccountIDReserved
+	}
+	if account.Type != "" && !account.Type.Valid() {
+		log.Printf("CreateAccount invalid account type: %q", account.Type)
+		return model.ErrInvalidAccountType
+	}
+	// Debit-normal accounts may go negative, so they would create money; only
+	// the migrations and the clearing accounts are debit-normal
+	if account.Type.DebitNormal() {
+		log.Printf("CreateAccount debit-normal account type: %q", account.Type)
+		return model.ErrDebitNormalAccountType
+	}
 	if account.Balance.IsNegative() {
 		log.Printf("CreateAccount negative balance: %v", account.Balance)
 		return model.ErrBalanceMustBeNonNegative
 	}
-	if err := validateDecimalPrecision(account.Balance); err != nil {
+	if err := s.validateDecimalPrecision(account.Balance); err != nil {
 		log.Printf("CreateAccount balance precision error: %v", err)
 		return err
 	}
 
-	err := s.repo.CreateAccount(account.AccountID, account.Balance)
+	var err error
+	switch {
+	case account.Type != "" && account.Type != model.AccountLiability:
+		err = s.createTypedAccount(account)
+	case account.ParentAccountID != 0:
+		err = s.createChildAccount(account)
+	default:
+		err = s.repo.CreateAccount(account.AccountID, account.Balance)
+	}
 	if err != nil {
-		// Handle unique constraint violation (Postgres error code 23505)
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		// The repository translates unique constraint violations into a domain error
+		if errors.Is(err, model.ErrAccountIDAlreadyExists) {
 			log.Printf("CreateAccount duplicate account id: %d", account.AccountID)
 			return model.ErrAccountIDAlreadyExists
 		}
+		if errors.Is(err, model.ErrParentAccountNotFound) || errors.Is(err, model.ErrChildBalanceLimitExceeded) ||
+			errors.Is(err, model.ErrAccountHierarchyUnsupported) || errors.Is(err, model.ErrAccountTypesUnsupported) {
+			log.Printf("CreateAccount failed: %v", err)
+			return err
+		}
 		log.Printf("CreateAccount db error: %v", err)
 		return err
 	}
@@ -74,6 +177,33 @@ func (s *AccountService) CreateAccount(account model.Account) error {
 	return nil
 }
 
+// createChildAccount creates the account under its parent
+func (s *AccountService) createChildAccount(account model.Account) error {
+	if err := validateAccountID(account.ParentAccountID); err != nil {
+		return fmt.Errorf("parent: %w", err)
+	}
+	hierarchy, ok := s.repo.(db.AccountHierarchyPort)
+	if !ok {
+		return model.ErrAccountHierarchyUnsupported
+	}
+	return hierarchy.CreateChildAccount(account.AccountID, account.ParentAccountID, account.Balance)
+}
+
+// createTypedAccount creates an account of a type other than liability,
+// optionally under its parent
+func (s *AccountService) createTypedAccount(account model.Account) error {
+	if account.ParentAccountID != 0 {
+		if err := validateAccountID(account.ParentAccountID); err != nil {
+			return fmt.Errorf("parent: %w", err)
+		}
+	}
+	types, ok := s.repo.(db.AccountTypePort)
+	if !ok {
+		return model.ErrAccountTypesUnsupported
+	}
+	return types.CreateTypedAccount(account)
+}
+
 // GetAccount retrieves the account details by ID
 func (s *AccountService) GetAccount(id int64) (model.Account, error) {
 	if err := validateAccountID(id); err != nil {
@@ -93,16 +223,184 @@ func (s *AccountService) GetAccount(id int64) (model.Account, error) {
 		AccountID: id,
 		Balance:   balance,
 	}
+	if types, ok := s.repo.(db.AccountTypePort); ok {
+		if account.Type, err = types.GetAccountType(nil, id); err != nil {
+			log.Printf("GetAccount db error getting type: %v", err)
+			return model.Account{}, fmt.Errorf("get account type: %w", err)
+		}
+	}
 	return account, nil
 }
 
 // Transfer moves funds from one account to another
-func (s *AccountService) Transfer(sourceID, destID int64, amount decimal.Decimal) (err error) {
-	if err = validateAccountID(sourceID); err != nil {
+func (s *AccountService) Transfer(sourceID, destID int64, amount decimal.Decimal) error {
+	if err := s.validateTransfer(sourceID, destID, amount); err != nil {
+		return err
+	}
+	return s.transfer(sourceID, destID, amount, nil)
+}
+
+// TransferWithFee moves funds like Transfer and charges the fee of the
+// client's schedule in the same transaction, paid as mode says. It returns the
+// fee, or nil when none is charged.
+func (s *AccountService) TransferWithFee(sourceID, destID int64, amount decimal.Decimal, clientID string, mode model.FeeMode) (*model.Fee, error) {
+	if err := s.validateTransfer(sourceID, destID, amount); err != nil {
+		return nil, err
+	}
+	fee, err := s.quoteFee(sourceID, destID, amount, clientID, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.transfer(sourceID, destID, amount, fee); err != nil {
+		return nil, err
+	}
+	return fee, nil
+}
+
+// QuoteTransfer runs the checks of TransferWithFee and moves the funds in a
+// transaction it rolls back, returning the fee and the balances the accounts
+// would have. When the transfer would fail, the quote holds the fee computed so
+// far along with the error.
+func (s *AccountService) QuoteTransfer(sourceID, destID int64, amount decimal.Decimal, clientID string, mode model.FeeMode) (quote model.TransferQuote, err error) {
+	quote = model.TransferQuote{SourceAccountID: sourceID, DestinationAccountID: destID, Amount: amount}
+	if err = s.validateTransfer(sourceID, destID, amount); err != nil {
+		return quote, err
+	}
+	if quote.Fee, err = s.quoteFee(sourceID, destID, amount, clientID, mode); err != nil {
+		return quote, err
+	}
+
+	txn, err := s.repo.BeginTx()
+	if err != nil {
+		log.Printf("QuoteTransfer failed to begin transaction: %v", err)
+		return quote, err
+	}
+	// Nothing is ever committed
+	defer txn.Rollback()
+
+	if err = s.transferWithFeeInTx(txn, sourceID, destID, amount, quote.Fee); err != nil {
+		return quote, err
+	}
+	accountIDs := []int64{sourceID, destID}
+	if quote.Fee != nil {
+		accountIDs = append(accountIDs, quote.Fee.AccountID)
+	}
+	balances := make([]model.Account, 0, len(accountIDs))
+	for _, accountID := range accountIDs {
+		balance, err := s.repo.GetAccountBalance(txn, accountID)
+		if err != nil {
+			log.Printf("QuoteTransfer error getting balance of %d: %v", accountID, err)
+			return quote, err
+		}
+		balances = append(balances, model.Account{AccountID: accountID, Balance: balance})
+	}
+	quote.Balances = balances
+	log.Printf("Transfer quoted: %d -> %d, amount: %v", sourceID, destID, amount)
+	return quote, nil
+}
+
+// quoteFee returns the fee the schedule of the client and the type of the
+// source account charges on a transfer, or nil when fees are not enabled, no
+// schedule applies or the fee is zero. Transfers from or to the fee account
+// are not charged.
+func (s *AccountService) quoteFee(sourceID, destID int64, amount decimal.Decimal, clientID string, mode model.FeeMode) (*model.Fee, error) {
+	if mode == "" {
+		mode = model.FeeOnTop
+	}
+	if !mode.Valid() {
+		log.Printf("Transfer with invalid fee mode: %q", mode)
+		return nil, model.ErrInvalidFeeMode
+	}
+	if s.feeSchedules == nil || sourceID == s.feeAccountID || destID == s.feeAccountID {
+		return nil, nil
+	}
+	var accountType model.AccountType
+	if types, ok := s.repo.(db.AccountTypePort); ok {
+		var err error
+		if accountType, err = types.GetAccountType(nil, sourceID); err != nil {
+			if errors.Is(err, model.ErrAccountNotFound) {
+				log.Printf("Transfer source account not found: %d", sourceID)
+				return nil, model.ErrSourceAccountNotFound
+			}
+			log.Printf("Transfer error getting source account type: %v", err)
+			return nil, err
+		}
+	}
+	schedule, err := s.feeSchedules.FindFeeSchedule(clientID, accountType)
+	if errors.Is(err, model.ErrFeeScheduleNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Transfer error finding fee schedule: %v", err)
+		return nil, err
+	}
+	amountFee := schedule.Fee(amount, s.maxPrecision)
+	if !amountFee.IsPositive() {
+		return nil, nil
+	}
+	if mode == model.FeeDeducted && !amountFee.LessThan(amount) {
+		log.Printf("Transfer fee %v deducted from amount %v", amountFee, amount)
+		return nil, model.ErrFeeExceedsAmount
+	}
+	return &model.Fee{ScheduleID: schedule.ID, AccountID: s.feeAccountID, Amount: amountFee, Mode: mode}, nil
+}
+
+// transfer moves the funds of a validated transfer, charging fee when it is
+// not nil
+func (s *AccountService) transfer(sourceID, destID int64, amount decimal.Decimal, fee *model.Fee) (err error) {
+	// The single statement has no fee leg
+	if transferrer, ok := s.repo.(db.FundsTransferrer); ok && s.singleStatement && fee == nil {
+		err = transferrer.TransferFunds(sourceID, destID, amount)
+		switch {
+		case errors.Is(err, db.ErrShardedAccount), errors.Is(err, db.ErrHierarchyAccount), errors.Is(err, db.ErrDebitNormalAccount):
+			// Sharded accounts, hierarchies and debit-normal sources take the
+			// transactional path below
+		case err != nil:
+			log.Printf("Transfer failed: %v", err)
+			return err
+		default:
+			log.Printf("Transfer successful: %d -> %d, amount: %v", sourceID, destID, amount)
+			s.committed(sourceID, destID)
+			return nil
+		}
+	}
+
+	txn, err := s.repo.BeginTx()
+	if err != nil {
+		log.Printf("Transfer failed to begin transaction: %v", err)
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			txn.Rollback()
+			log.Printf("Transfer panic, transaction rolled back: %v", p)
+			panic(p)
+		} else if err != nil {
+			txn.Rollback()
+			log.Printf("Transfer error, transaction rolled back: %v", err)
+		}
+	}()
+
+	if err = s.transferWithFeeInTx(txn, sourceID, destID, amount, fee); err != nil {
+		return err
+	}
+
+	if err = txn.Commit(); err != nil {
+		log.Printf("Transfer commit failed: %v", err)
+		return err
+	}
+	log.Printf("Transfer successful: %d -> %d, amount: %v", sourceID, destID, amount)
+	s.committed(sourceID, destID)
+	return nil
+}
+
+// validateTransfer checks the transfer arguments before any storage access
+func (s *AccountService) validateTransfer(sourceID, destID int64, amount decimal.Decimal) error {
+	if err := validateAccountID(sourceID); err != nil {
 		log.Printf("Transfer validation failed for sourceID: %v", err)
 		return err
 	}
-	if err = validateAccountID(destID); err != nil {
+	if err := validateAccountID(destID); err != nil {
 		log.Printf("Transfer validation failed for destID: %v", err)
 		return err
 	}
@@ -110,31 +408,80 @@ func (s *AccountService) Transfer(sourceID, destID int64, amount decimal.Decimal
 		log.Printf("Transfer attempted with same source and destination: %d", sourceID)
 		return model.ErrSourceAndDestinationMustDiffer
 	}
+	if err := validateClientAccounts(sourceID, destID); err != nil {
+		log.Printf("Transfer with system account: %d -> %d", sourceID, destID)
+		return err
+	}
 	if amount.IsNegative() || amount.IsZero() {
 		log.Printf("Transfer with non-positive amount: %v", amount)
 		return model.ErrAmountMustBePositive
 	}
-	if err = validateDecimalPrecision(amount); err != nil {
+	if err := s.validateDecimalPrecision(amount); err != nil {
 		log.Printf("Transfer amount precision error: %v", err)
 		return err
 	}
+	return nil
+}
+
+// validateClientAccounts rejects the system accounts as either side of a
+// client transfer: only the fee, interest and clearing legs move their funds
+func validateClientAccounts(accountIDs ...int64) error {
+	for _, id := range accountIDs {
+		if model.IsReservedAccountID(id) {
+			return model.ErrSystemAccountNotAllowed
+		}
+	}
+	return nil
+}
+
+// transferInTx locks both accounts and moves the funds within txn, debiting
+// the source as policy allows and leaving commit or rollback to the caller
+func (s *AccountService) transferInTx(txn db.TransactionPort, sourceID, destID int64, amount decimal.Decimal, policy sourcePolicy) error {
+	return s.moveFundsInTx(txn, sourceID, destID, amount, nil, policy)
+}
 
+// inTx runs fn in a transaction of the account repository and commits it
+// unless fn fails
+func (s *AccountService) inTx(fn func(txn db.TransactionPort) error) (err error) {
 	txn, err := s.repo.BeginTx()
 	if err != nil {
-		log.Printf("Transfer failed to begin transaction: %v", err)
 		return err
 	}
 	defer func() {
 		if p := recover(); p != nil {
 			txn.Rollback()
-			log.Printf("Transfer panic, transaction rolled back: %v", p)
 			panic(p)
 		} else if err != nil {
 			txn.Rollback()
-			log.Printf("Transfer error, transaction rolled back: %v", err)
 		}
 	}()
 
+	if err = fn(txn); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// transferWithFeeInTx is transferInTx of a client transfer charging fee, when
+// it is not nil, as a third leg crediting the fee account
+func (s *AccountService) transferWithFeeInTx(txn db.TransactionPort, sourceID, destID int64, amount decimal.Decimal, fee *model.Fee) error {
+	return s.moveFundsInTx(txn, sourceID, destID, amount, fee, clientSource)
+}
+
+// moveFundsInTx locks the accounts and moves the funds of a transfer and its
+// fee within txn
+func (s *AccountService) moveFundsInTx(txn db.TransactionPort, sourceID, destID int64, amount decimal.Decimal, fee *model.Fee, policy sourcePolicy) error {
+	if policy == clientSource {
+		if err := validateClientAccounts(sourceID, destID); err != nil {
+			log.Printf("Transfer with system account: %d -> %d", sourceID, destID)
+			return err
+		}
+	}
+	debit, credit := amount, amount
+	if fee != nil {
+		debit, credit = fee.Debit(amount), fee.Credit(amount)
+	}
+
 	// Lock source account row and get balance
 	balance, err := s.repo.GetAccountBalance(txn, sourceID)
 	if err != nil {
@@ -145,14 +492,24 @@ func (s *AccountService) Transfer(sourceID, destID int64, amount decimal.Decimal
 		log.Printf("Transfer error getting source balance: %v", err)
 		return err
 	}
-	if balance.LessThan(amount) {
-		log.Printf("Transfer insufficient funds: %d, balance: %v, amount: %v", sourceID, balance, amount)
+	// Only the clearing and system accounts are debit-normal, and they may go
+	// negative, so clients cannot debit them
+	debitNormal, err := s.debitNormal(txn, sourceID)
+	if err != nil {
+		log.Printf("Transfer error getting source account type: %v", err)
+		return err
+	}
+	if debitNormal && policy == clientSource {
+		log.Printf("Transfer from debit-normal account: %d", sourceID)
+		return model.ErrSystemAccountSource
+	}
+	if balance.LessThan(debit) && !debitNormal {
+		log.Printf("Transfer insufficient funds: %d, balance: %v, amount: %v", sourceID, balance, debit)
 		return model.ErrInsufficientFunds
 	}
 
 	// Lock destination account row to ensure it exists
-	_, err = s.repo.GetAccountBalance(txn, destID)
-	if err != nil {
+	if err = s.lockForCredit(txn, destID); err != nil {
 		if errors.Is(err, model.ErrAccountNotFound) {
 			log.Printf("Transfer destination account not found: %d", destID)
 			return model.ErrDestinationAccountNotFound
@@ -160,21 +517,184 @@ func (s *AccountService) Transfer(sourceID, destID int64, amount decimal.Decimal
 		log.Printf("Transfer error getting destination balance: %v", err)
 		return err
 	}
+	updates := []db.BalanceUpdate{{AccountID: sourceID, Delta: debit.Neg()}, {AccountID: destID, Delta: credit}}
+	if fee != nil {
+		if err = s.lockForCredit(txn, fee.AccountID); err != nil {
+			if errors.Is(err, model.ErrAccountNotFound) {
+				log.Printf("Transfer fee account not found: %d", fee.AccountID)
+				return model.ErrFeeAccountNotFound
+			}
+			log.Printf("Transfer error getting fee account balance: %v", err)
+			return err
+		}
+		updates = append(updates, db.BalanceUpdate{AccountID: fee.AccountID, Delta: fee.Amount})
+	}
 
-	// Update balances
-	if err = s.repo.UpdateAccountBalance(txn, sourceID, amount.Neg()); err != nil {
-		log.Printf("Transfer error updating source balance: %v", err)
+	// Update balances, in a single round trip when the repository supports it
+	if batcher, ok := s.repo.(db.BalanceBatchUpdater); ok {
+		if err = batcher.UpdateAccountBalances(txn, updates); err != nil {
+			log.Printf("Transfer error updating balances: %v", err)
+			return err
+		}
+	} else {
+		for _, update := range updates {
+			if err = s.repo.UpdateAccountBalance(txn, update.AccountID, update.Delta); err != nil {
+				log.Printf("Transfer error updating balance of %d: %v", update.AccountID, err)
+				return err
+			}
+		}
+	}
+
+	// The credits may push the ancestors of the credited accounts past their limits
+	if hierarchy, ok := s.repo.(db.AccountHierarchyPort); ok {
+		accountIDs := []int64{sourceID, destID}
+		if fee != nil {
+			accountIDs = append(accountIDs, fee.AccountID)
+		}
+		if err = hierarchy.CheckBalanceLimits(txn, accountIDs...); err != nil {
+			if !errors.Is(err, model.ErrChildBalanceLimitExceeded) {
+				log.Printf("Transfer error checking balance limits: %v", err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// debitNormal reports whether an account has a debit-normal type, which lets
+// its balance go negative. Without account types no account may.
+func (s *AccountService) debitNormal(txn db.TransactionPort, accountID int64) (bool, error) {
+	types, ok := s.repo.(db.AccountTypePort)
+	if !ok {
+		return false, nil
+	}
+	accountType, err := types.GetAccountType(txn, accountID)
+	if err != nil {
+		return false, err
+	}
+	return accountType.DebitNormal(), nil
+}
+
+// lockForCredit locks an account that is about to be credited
+func (s *AccountService) lockForCredit(txn db.TransactionPort, accountID int64) error {
+	if locker, ok := s.repo.(db.AccountCreditLocker); ok {
+		return locker.LockAccountForCredit(txn, accountID)
+	}
+	_, err := s.repo.GetAccountBalance(txn, accountID)
+	return err
+}
+
+// SetBalanceShards spreads the credits of a hot account over the given number of
+// shard rows, or turns sharding off when shards is 0
+func (s *AccountService) SetBalanceShards(accountID int64, shards int) error {
+	if err := validateAccountID(accountID); err != nil {
+		log.Printf("SetBalanceShards validation failed: %v", err)
 		return err
 	}
-	if err = s.repo.UpdateAccountBalance(txn, destID, amount); err != nil {
-		log.Printf("Transfer error updating destination balance: %v", err)
+	if shards < 0 || shards > MaxBalanceShards {
+		log.Printf("SetBalanceShards invalid shard count: %d", shards)
+		return fmt.Errorf("%w (0 to %d)", model.ErrInvalidShardCount, MaxBalanceShards)
+	}
+	sharding, ok := s.repo.(db.BalanceShardingPort)
+	if !ok {
+		return model.ErrBalanceShardingUnsupported
+	}
+	if err := sharding.SetBalanceShards(accountID, shards); err != nil {
+		if !errors.Is(err, model.ErrAccountNotFound) {
+			log.Printf("SetBalanceShards db error: %v", err)
+		}
 		return err
 	}
+	log.Printf("Account %d balance shards set to %d", accountID, shards)
+	return nil
+}
 
-	if err = txn.Commit(); err != nil {
-		log.Printf("Transfer commit failed: %v", err)
+// SetAccountParent moves an account under parentID, or makes it a root account
+// when parentID is 0
+func (s *AccountService) SetAccountParent(accountID, parentID int64) error {
+	if err := validateAccountID(accountID); err != nil {
+		log.Printf("SetAccountParent validation failed: %v", err)
 		return err
 	}
-	log.Printf("Transfer successful: %d -> %d, amount: %v", sourceID, destID, amount)
+	if parentID < 0 {
+		log.Printf("SetAccountParent invalid parent: %d", parentID)
+		return fmt.Errorf("parent: %w", model.ErrAccountIDMustBePositive)
+	}
+	if parentID == accountID {
+		return model.ErrAccountHierarchyCycle
+	}
+	hierarchy, ok := s.repo.(db.AccountHierarchyPort)
+	if !ok {
+		return model.ErrAccountHierarchyUnsupported
+	}
+	if err := hierarchy.SetAccountParent(accountID, parentID); err != nil {
+		log.Printf("SetAccountParent failed: %v", err)
+		return err
+	}
+	log.Printf("Account %d parent set to %d", accountID, parentID)
+	return nil
+}
+
+// SetChildBalancePolicy sets the policy an account applies to its descendants
+func (s *AccountService) SetChildBalancePolicy(accountID int64, policy model.ChildBalancePolicy) error {
+	if err := validateAccountID(accountID); err != nil {
+		log.Printf("SetChildBalancePolicy validation failed: %v", err)
+		return err
+	}
+	if !policy.Valid() {
+		log.Printf("SetChildBalancePolicy invalid policy: %q", policy)
+		return model.ErrInvalidChildPolicy
+	}
+	hierarchy, ok := s.repo.(db.AccountHierarchyPort)
+	if !ok {
+		return model.ErrAccountHierarchyUnsupported
+	}
+	if err := hierarchy.SetChildBalancePolicy(accountID, policy); err != nil {
+		log.Printf("SetChildBalancePolicy failed: %v", err)
+		return err
+	}
+	log.Printf("Account %d child policy set to %s", accountID, policy)
 	return nil
 }
+
+// GetAccountTree returns an account with its descendants nested below it, each
+// node with its own balance and the total of its subtree
+func (s *AccountService) GetAccountTree(accountID int64) (model.AccountNode, error) {
+	if err := validateAccountID(accountID); err != nil {
+		log.Printf("GetAccountTree validation failed: %v", err)
+		return model.AccountNode{}, err
+	}
+	hierarchy, ok := s.repo.(db.AccountHierarchyPort)
+	if !ok {
+		return model.AccountNode{}, model.ErrAccountHierarchyUnsupported
+	}
+	nodes, err := hierarchy.GetAccountTree(accountID)
+	if err != nil {
+		if !errors.Is(err, model.ErrAccountNotFound) {
+			log.Printf("GetAccountTree db error: %v", err)
+		}
+		return model.AccountNode{}, err
+	}
+	return buildAccountTree(nodes), nil
+}
+
+// buildAccountTree nests nodes, listed parents before their children with the
+// root first, and totals each subtree
+func buildAccountTree(nodes []model.AccountNode) model.AccountNode {
+	children := make(map[int64][]int, len(nodes))
+	for i := 1; i < len(nodes); i++ {
+		children[nodes[i].ParentAccountID] = append(children[nodes[i].ParentAccountID], i)
+	}
+	var build func(i int) model.AccountNode
+	build = func(i int) model.AccountNode {
+		node := nodes[i]
+		node.TotalBalance = node.Balance
+		for _, child := range children[node.AccountID] {
+			sub := build(child)
+			node.TotalBalance = node.TotalBalance.Add(sub.TotalBalance)
+			node.Children = append(node.Children, sub)
+		}
+		return node
+	}
+	return build(0)
+}
@@ -4,12 +4,14 @@ import (
 	"errors"
 	"testing"
 
+	"internal-transfers/internal/db"
 	"internal-transfers/internal/mocks"
 	"internal-transfers/internal/model"
 
 	"github.com/golang/mock/gomock"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func validAccount() model.Account {
@@ -34,6 +36,29 @@ func TestCreateAccount_ValidationErrors(t *testing.T) {
 	acc.Balance = decimal.NewFromFloat(-1)
 	err = svc.CreateAccount(acc)
 	assert.ErrorIs(t, err, model.ErrBalanceMustBeNonNegative)
+
+	acc = validAccount()
+	acc.AccountID = model.FirstReservedAccountID
+	err = svc.CreateAccount(acc)
+	assert.ErrorIs(t, err, model.ErrAccountIDReserved)
+
+	acc = validAccount()
+	acc.Type = "savings"
+	err = svc.CreateAccount(acc)
+	assert.ErrorIs(t, err, model.ErrInvalidAccountType)
+
+	for _, debitNormal := range []model.AccountType{model.AccountAsset, model.AccountExpense} {
+		acc = validAccount()
+		acc.Type = debitNormal
+		err = svc.CreateAccount(acc)
+		assert.ErrorIs(t, err, model.ErrDebitNormalAccountType, "%s accounts would create money", debitNormal)
+	}
+
+	// The mock repository does not implement db.AccountTypePort
+	acc = validAccount()
+	acc.Type = model.AccountEquity
+	err = svc.CreateAccount(acc)
+	assert.ErrorIs(t, err, model.ErrAccountTypesUnsupported)
 }
 
 func TestCreateAccount_RepositoryErrors(t *testing.T) {
@@ -121,3 +146,322 @@ func TestTransfer_Success(t *testing.T) {
 	err := svc.Transfer(sourceID, destID, amount)
 	assert.NoError(t, err)
 }
+
+func TestAccountService_MaxPrecision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := mocks.NewMockAccountRepositoryPort(ctrl)
+	svc := NewAccountService(repo, WithMaxPrecision(2))
+
+	err := svc.Transfer(1, 2, decimal.RequireFromString("1.001"))
+	assert.ErrorIs(t, err, model.ErrPrecisionTooHigh)
+
+	acc := validAccount()
+	acc.Balance = decimal.RequireFromString("0.123")
+	err = svc.CreateAccount(acc)
+	assert.ErrorIs(t, err, model.ErrPrecisionTooHigh)
+}
+
+func TestTransfer_RepositoryDomainErrorReachesCaller(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := mocks.NewMockAccountRepositoryPort(ctrl)
+	tx := mocks.NewMockTransactionPort(ctrl)
+	svc := NewAccountService(repo)
+
+	sourceID, destID := int64(1), int64(2)
+	amount := decimal.NewFromFloat(10)
+
+	repo.EXPECT().BeginTx().Return(tx, nil)
+	repo.EXPECT().GetAccountBalance(tx, sourceID).Return(decimal.NewFromFloat(20), nil)
+	repo.EXPECT().GetAccountBalance(tx, destID).Return(decimal.NewFromFloat(5), nil)
+	repo.EXPECT().UpdateAccountBalance(tx, sourceID, amount.Neg()).Return(model.ErrInsufficientFunds)
+	tx.EXPECT().Rollback()
+
+	err := svc.Transfer(sourceID, destID, amount)
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+}
+
+// batchingRepository adds BalanceBatchUpdater to the mock repository
+type batchingRepository struct {
+	*mocks.MockAccountRepositoryPort
+	batches [][]db.BalanceUpdate
+}
+
+func (r *batchingRepository) UpdateAccountBalances(tx db.TransactionPort, updates []db.BalanceUpdate) error {
+	r.batches = append(r.batches, updates)
+	return nil
+}
+
+func TestTransfer_BatchesBalanceUpdates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := &batchingRepository{MockAccountRepositoryPort: mocks.NewMockAccountRepositoryPort(ctrl)}
+	tx := mocks.NewMockTransactionPort(ctrl)
+	svc := NewAccountService(repo)
+
+	sourceID, destID := int64(1), int64(2)
+	amount := decimal.NewFromFloat(10)
+
+	repo.EXPECT().BeginTx().Return(tx, nil)
+	repo.EXPECT().GetAccountBalance(tx, sourceID).Return(decimal.NewFromFloat(20), nil)
+	repo.EXPECT().GetAccountBalance(tx, destID).Return(decimal.NewFromFloat(5), nil)
+	tx.EXPECT().Commit().Return(nil)
+
+	err := svc.Transfer(sourceID, destID, amount)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]db.BalanceUpdate{{{AccountID: sourceID, Delta: amount.Neg()}, {AccountID: destID, Delta: amount}}}, repo.batches)
+}
+
+// transferringRepository adds FundsTransferrer to the mock repository
+type transferringRepository struct {
+	*mocks.MockAccountRepositoryPort
+	err error
+}
+
+func (r *transferringRepository) TransferFunds(sourceID, destID int64, amount decimal.Decimal) error {
+	return r.err
+}
+
+func TestTransfer_SingleStatement(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := &transferringRepository{MockAccountRepositoryPort: mocks.NewMockAccountRepositoryPort(ctrl)}
+
+	// No BeginTx, locks or updates are expected on the mock
+	svc := NewAccountService(repo, WithSingleStatementTransfer(true))
+	assert.NoError(t, svc.Transfer(1, 2, decimal.NewFromInt(10)))
+
+	repo.err = model.ErrDestinationAccountNotFound
+	assert.ErrorIs(t, svc.Transfer(1, 2, decimal.NewFromInt(10)), model.ErrDestinationAccountNotFound)
+
+	// Validation still runs first
+	assert.ErrorIs(t, svc.Transfer(1, 1, decimal.NewFromInt(10)), model.ErrSourceAndDestinationMustDiffer)
+}
+
+func TestTransfer_SingleStatementIsOptIn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := &transferringRepository{MockAccountRepositoryPort: mocks.NewMockAccountRepositoryPort(ctrl), err: errors.New("must not be called")}
+	svc := NewAccountService(repo)
+
+	repo.EXPECT().BeginTx().Return(nil, errors.New("begin failed"))
+	assert.EqualError(t, svc.Transfer(1, 2, decimal.NewFromInt(10)), "begin failed")
+}
+
+func TestSetBalanceShards_Validation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	svc := NewAccountService(mocks.NewMockAccountRepositoryPort(ctrl))
+
+	assert.ErrorIs(t, svc.SetBalanceShards(0, 4), model.ErrAccountIDMustBePositive)
+	assert.ErrorIs(t, svc.SetBalanceShards(1, -1), model.ErrInvalidShardCount)
+	assert.ErrorIs(t, svc.SetBalanceShards(1, MaxBalanceShards+1), model.ErrInvalidShardCount)
+	// The mock repository does not implement db.BalanceShardingPort
+	assert.ErrorIs(t, svc.SetBalanceShards(1, 4), model.ErrBalanceShardingUnsupported)
+}
+
+func TestTransfer_SingleStatementFallsBackForShardedAccounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := &transferringRepository{MockAccountRepositoryPort: mocks.NewMockAccountRepositoryPort(ctrl), err: db.ErrShardedAccount}
+	tx := mocks.NewMockTransactionPort(ctrl)
+	svc := NewAccountService(repo, WithSingleStatementTransfer(true))
+
+	amount := decimal.NewFromInt(10)
+	repo.EXPECT().BeginTx().Return(tx, nil)
+	repo.EXPECT().GetAccountBalance(tx, int64(1)).Return(decimal.NewFromInt(20), nil)
+	repo.EXPECT().GetAccountBalance(tx, int64(2)).Return(decimal.Zero, nil)
+	repo.EXPECT().UpdateAccountBalance(tx, int64(1), amount.Neg()).Return(nil)
+	repo.EXPECT().UpdateAccountBalance(tx, int64(2), amount).Return(nil)
+	tx.EXPECT().Commit().Return(nil)
+
+	assert.NoError(t, svc.Transfer(1, 2, amount))
+}
+
+func TestAccountHierarchy_Validation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	svc := NewAccountService(mocks.NewMockAccountRepositoryPort(ctrl))
+
+	assert.ErrorIs(t, svc.SetAccountParent(0, 1), model.ErrAccountIDMustBePositive)
+	assert.ErrorIs(t, svc.SetAccountParent(1, -1), model.ErrAccountIDMustBePositive)
+	assert.ErrorIs(t, svc.SetAccountParent(1, 1), model.ErrAccountHierarchyCycle)
+	assert.ErrorIs(t, svc.SetChildBalancePolicy(1, "sometimes"), model.ErrInvalidChildPolicy)
+	// The mock repository does not implement db.AccountHierarchyPort
+	assert.ErrorIs(t, svc.SetAccountParent(1, 2), model.ErrAccountHierarchyUnsupported)
+	assert.ErrorIs(t, svc.SetChildBalancePolicy(1, model.ChildBalanceWithinParent), model.ErrAccountHierarchyUnsupported)
+	_, err := svc.GetAccountTree(1)
+	assert.ErrorIs(t, err, model.ErrAccountHierarchyUnsupported)
+	assert.ErrorIs(t, svc.CreateAccount(model.Account{AccountID: 2, ParentAccountID: 1}), model.ErrAccountHierarchyUnsupported)
+}
+
+// newHierarchyTest builds company 1 with departments 2 and 3 and cost center 4
+// under department 2
+func newHierarchyTest(t *testing.T) (*AccountService, db.AccountRepositoryPort) {
+	repo := db.NewMemoryAccountRepository(db.NewMemoryStore())
+	svc := NewAccountService(repo, WithSingleStatementTransfer(true))
+	require.NoError(t, svc.CreateAccount(model.Account{AccountID: 1, Balance: decimal.NewFromInt(100)}))
+	require.NoError(t, svc.CreateAccount(model.Account{AccountID: 2, Balance: decimal.NewFromInt(30), ParentAccountID: 1}))
+	require.NoError(t, svc.CreateAccount(model.Account{AccountID: 3, Balance: decimal.NewFromInt(20), ParentAccountID: 1}))
+	require.NoError(t, svc.CreateAccount(model.Account{AccountID: 4, Balance: decimal.NewFromInt(5), ParentAccountID: 2}))
+	return svc, repo
+}
+
+func TestGetAccountTree(t *testing.T) {
+	svc, _ := newHierarchyTest(t)
+
+	tree, err := svc.GetAccountTree(1)
+	require.NoError(t, err)
+	assert.True(t, tree.TotalBalance.Equal(decimal.NewFromInt(155)), "got %s", tree.TotalBalance)
+	require.Len(t, tree.Children, 2)
+	assert.Equal(t, int64(2), tree.Children[0].AccountID)
+	assert.True(t, tree.Children[0].TotalBalance.Equal(decimal.NewFromInt(35)), "got %s", tree.Children[0].TotalBalance)
+	require.Len(t, tree.Children[0].Children, 1)
+	assert.Equal(t, int64(4), tree.Children[0].Children[0].AccountID)
+	assert.True(t, tree.Children[1].TotalBalance.Equal(decimal.NewFromInt(20)))
+
+	// A subtree is rooted at the requested account
+	tree, err = svc.GetAccountTree(2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), tree.ParentAccountID)
+	assert.True(t, tree.TotalBalance.Equal(decimal.NewFromInt(35)))
+
+	_, err = svc.GetAccountTree(9)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+	assert.ErrorIs(t, svc.SetAccountParent(1, 4), model.ErrAccountHierarchyCycle)
+	assert.ErrorIs(t, svc.SetAccountParent(4, 9), model.ErrParentAccountNotFound)
+	assert.ErrorIs(t, svc.CreateAccount(model.Account{AccountID: 5, ParentAccountID: 9}), model.ErrParentAccountNotFound)
+}
+
+func TestTransfer_ChildBalanceLimit(t *testing.T) {
+	svc, repo := newHierarchyTest(t)
+	require.NoError(t, svc.CreateAccount(model.Account{AccountID: 9, Balance: decimal.NewFromInt(100)}))
+
+	// Department 2 holds 30 and limits cost center 4, which holds 5
+	require.NoError(t, svc.SetChildBalancePolicy(2, model.ChildBalanceWithinParent))
+	require.NoError(t, svc.Transfer(9, 4, decimal.NewFromInt(25)))
+	assert.ErrorIs(t, svc.Transfer(9, 4, decimal.NewFromInt(1)), model.ErrChildBalanceLimitExceeded)
+	assert.ErrorIs(t, svc.Transfer(2, 9, decimal.NewFromInt(1)), model.ErrChildBalanceLimitExceeded)
+	requireAccountBalance(t, repo, 4, 30)
+	requireAccountBalance(t, repo, 9, 75)
+
+	// Funding the department first makes room for the cost center
+	require.NoError(t, svc.Transfer(1, 2, decimal.NewFromInt(10)))
+	require.NoError(t, svc.Transfer(9, 4, decimal.NewFromInt(10)))
+
+	// A new child over the limit is rejected, and so is a stricter policy
+	assert.ErrorIs(t, svc.CreateAccount(model.Account{AccountID: 5, Balance: decimal.NewFromInt(1), ParentAccountID: 4}), model.ErrChildBalanceLimitExceeded)
+	assert.ErrorIs(t, svc.SetChildBalancePolicy(1, model.ChildBalanceWithinParent), model.ErrChildBalanceLimitExceeded)
+}
+
+func TestQuoteTransfer(t *testing.T) {
+	svc, repo := newHierarchyTest(t)
+
+	quote, err := svc.QuoteTransfer(1, 2, decimal.NewFromInt(40), "", "")
+	require.NoError(t, err)
+	assert.Nil(t, quote.Fee)
+	require.Len(t, quote.Balances, 2)
+	assert.Equal(t, int64(1), quote.Balances[0].AccountID)
+	assert.True(t, quote.Balances[0].Balance.Equal(decimal.NewFromInt(60)), "got %s", quote.Balances[0].Balance)
+	assert.Equal(t, int64(2), quote.Balances[1].AccountID)
+	assert.True(t, quote.Balances[1].Balance.Equal(decimal.NewFromInt(70)), "got %s", quote.Balances[1].Balance)
+	requireAccountBalance(t, repo, 1, 100)
+	requireAccountBalance(t, repo, 2, 30)
+
+	// Failing transfers are quoted with their error
+	quote, err = svc.QuoteTransfer(2, 1, decimal.NewFromInt(31), "", "")
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	assert.Nil(t, quote.Balances)
+	require.NoError(t, svc.SetChildBalancePolicy(2, model.ChildBalanceWithinParent))
+	_, err = svc.QuoteTransfer(1, 4, decimal.NewFromInt(26), "", "")
+	assert.ErrorIs(t, err, model.ErrChildBalanceLimitExceeded)
+	_, err = svc.QuoteTransfer(1, 9, decimal.NewFromInt(1), "", "")
+	assert.ErrorIs(t, err, model.ErrDestinationAccountNotFound)
+	_, err = svc.QuoteTransfer(1, 2, decimal.RequireFromString("0.000000001"), "", "")
+	assert.ErrorIs(t, err, model.ErrPrecisionTooHigh)
+	requireAccountBalance(t, repo, 1, 100)
+	requireAccountBalance(t, repo, 4, 5)
+
+	// Nothing is left locked
+	require.NoError(t, svc.Transfer(1, 2, decimal.NewFromInt(40)))
+	requireAccountBalance(t, repo, 2, 70)
+}
+
+func TestAccountTypes(t *testing.T) {
+	repo := db.NewMemoryAccountRepository(db.NewMemoryStore())
+	svc := NewAccountService(repo, WithSingleStatementTransfer(true))
+	require.NoError(t, svc.CreateAccount(model.Account{AccountID: 1, Balance: decimal.NewFromInt(10)}))
+	// Debit-normal accounts are only created by the operator
+	require.NoError(t, repo.CreateTypedAccount(model.Account{AccountID: 2, Type: model.AccountAsset}))
+	require.NoError(t, repo.CreateTypedAccount(model.Account{AccountID: 3, ParentAccountID: 2, Type: model.AccountExpense}))
+	require.NoError(t, svc.CreateAccount(model.Account{AccountID: 4, Type: model.AccountRevenue}))
+
+	for id, want := range map[int64]model.AccountType{1: model.AccountLiability, 2: model.AccountAsset, 3: model.AccountExpense, 4: model.AccountRevenue} {
+		account, err := svc.GetAccount(id)
+		require.NoError(t, err)
+		assert.Equal(t, want, account.Type, "account %d", id)
+	}
+
+	// Clients cannot debit asset and expense accounts, on either transfer path
+	assert.ErrorIs(t, svc.Transfer(2, 1, decimal.NewFromInt(25)), model.ErrSystemAccountSource)
+	_, err := svc.TransferWithFee(3, 4, decimal.NewFromInt(5), "", "")
+	assert.ErrorIs(t, err, model.ErrSystemAccountSource)
+	requireAccountBalance(t, repo, 2, 0)
+
+	// Deposits, withdrawals and interest let them go negative
+	systemTransfer := func(sourceID, destID int64, amount int64) error {
+		return svc.inTx(func(txn db.TransactionPort) error {
+			return svc.transferInTx(txn, sourceID, destID, decimal.NewFromInt(amount), systemSource)
+		})
+	}
+	require.NoError(t, systemTransfer(2, 1, 25))
+	require.NoError(t, systemTransfer(3, 4, 5))
+	requireAccountBalance(t, repo, 2, -25)
+	requireAccountBalance(t, repo, 3, -5)
+	assert.ErrorIs(t, svc.Transfer(4, 1, decimal.NewFromInt(6)), model.ErrInsufficientFunds)
+	assert.ErrorIs(t, systemTransfer(4, 1, 6), model.ErrInsufficientFunds, "credit-normal accounts never go negative")
+	assert.ErrorIs(t, svc.Transfer(1, 2, decimal.NewFromInt(36)), model.ErrInsufficientFunds)
+	requireAccountBalance(t, repo, 1, 35)
+
+	// The system accounts exist from the start
+	interest := model.SystemAccounts[2]
+	require.Equal(t, model.SystemInterestExpense, interest.Role)
+	assert.ErrorIs(t, svc.Transfer(interest.AccountID, 1, decimal.NewFromInt(1)), model.ErrSystemAccountNotAllowed)
+	require.NoError(t, systemTransfer(interest.AccountID, 1, 1))
+	requireAccountBalance(t, repo, interest.AccountID, -1)
+	assert.ErrorIs(t, svc.CreateAccount(model.Account{AccountID: interest.AccountID}), model.ErrAccountIDReserved)
+}
+
+func TestSystemAccounts_OnlyInInternalLegs(t *testing.T) {
+	store := db.NewMemoryStore()
+	repo := db.NewMemoryAccountRepository(store)
+	schedules := db.NewMemoryFeeScheduleRepository(store)
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, repo.CreateAccount(2, decimal.Zero))
+	svc := NewAccountService(repo, WithFees(schedules, model.FeesAccountID))
+	_, err := schedules.CreateFeeSchedule(model.FeeSchedule{Name: "flat", Kind: model.FeeFlat, Flat: decimal.NewFromInt(1)})
+	require.NoError(t, err)
+
+	// The fee leg credits the fees account
+	_, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(10), "", "")
+	require.NoError(t, err)
+	requireAccountBalance(t, repo, model.FeesAccountID, 1)
+
+	for _, system := range model.SystemAccounts {
+		assert.ErrorIs(t, svc.Transfer(system.AccountID, 1, decimal.NewFromInt(1)), model.ErrSystemAccountNotAllowed, "from %s", system.Role)
+		assert.ErrorIs(t, svc.Transfer(1, system.AccountID, decimal.NewFromInt(1)), model.ErrSystemAccountNotAllowed, "to %s", system.Role)
+		err := svc.inTx(func(txn db.TransactionPort) error {
+			return svc.transferWithFeeInTx(txn, system.AccountID, 2, decimal.NewFromInt(1), nil)
+		})
+		assert.ErrorIs(t, err, model.ErrSystemAccountNotAllowed, "%s in a split, sweep or rule", system.Role)
+	}
+	requireAccountBalance(t, repo, model.FeesAccountID, 1)
+
+	// Interest is paid from the interest expense account
+	require.NoError(t, svc.inTx(func(txn db.TransactionPort) error {
+		return svc.transferInTx(txn, model.InterestExpenseAccountID, 1, decimal.NewFromInt(2), systemSource)
+	}))
+	requireAccountBalance(t, repo, model.InterestExpenseAccountID, -2)
+	requireAccountBalance(t, repo, 1, 91)
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"internal-transfers/internal/calendar"
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// Defaults for AsyncTransferOptions
+const (
+	DefaultAsyncTransferWorkers      = 2
+	DefaultAsyncTransferBatchSize    = 32
+	DefaultAsyncTransferPollInterval = 500 * time.Millisecond
+	DefaultAsyncTransferLease        = time.Minute
+	DefaultScheduledRetryInterval    = time.Minute
+	DefaultMaxMetadataBytes          = 1024
+)
+
+// MaxScheduledTransfersPage is the largest number of scheduled transfers listed at once
+const MaxScheduledTransfersPage = 1000
+
+// TransferServicePort defines the service interface for asynchronous transfers
+//
+//go:generate mockgen -destination=../mocks/mock_transfer_service.go -package=mocks internal-transfers/internal/services TransferServicePort
+type TransferServicePort interface {
+	SubmitTransfer(sourceID, destID int64, amount decimal.Decimal, details model.TransferDetails) (model.Transfer, error)
+	ScheduleTransfer(sourceID, destID int64, amount decimal.Decimal, executeAt, retryUntil time.Time, rule calendar.Rule, details model.TransferDetails) (model.Transfer, error)
+	BookTransfer(sourceID, destID int64, amount decimal.Decimal, details model.TransferDetails) (model.Transfer, error)
+	SplitTransfer(sourceID int64, amount decimal.Decimal, shares []model.SplitShare, details model.TransferDetails) (model.Transfer, error)
+	SweepTransfer(destID int64, sources []model.SweepSource, mode model.SweepMode, details model.TransferDetails) (model.Sweep, error)
+	GetTransfer(id int64) (model.Transfer, error)
+	GetTransferByReference(clientID, reference string) (model.Transfer, error)
+	ListScheduledTransfers(status model.TransferStatus, limit int) ([]model.Transfer, error)
+	CancelScheduledTransfer(id int64) (model.Transfer, error)
+	ReverseTransfer(id int64, amount decimal.Decimal, retryUntil time.Time) (model.Transfer, error)
+}
+
+// AsyncTransferOptions configures the workers of an AsyncTransferService
+type AsyncTransferOptions struct {
+	// Workers is the number of goroutines processing transfers; 0 only accepts them
+	Workers int
+	// BatchSize is the number of transfers a worker claims at once
+	BatchSize int
+	// PollInterval is how long an idle worker waits before looking for work again
+	PollInterval time.Duration
+	// Lease is how long a transfer may stay processing before another worker
+	// presumes its worker dead and claims it again
+	Lease time.Duration
+	// RetryInterval is the delay between attempts of a failed scheduled transfer
+	RetryInterval time.Duration
+	// Calendar moves scheduled transfers to business days; nil is calendar.Default()
+	Calendar *calendar.Calendar
+	// MaxMetadataBytes is the largest metadata object accepted with a transfer
+	MaxMetadataBytes int
+	// GroupCommit books synchronous transfers in its batches when it is not nil
+	GroupCommit *GroupCommitService
+}
+
+// AsyncTransferService accepts transfers for background processing.
+//
+// Submitted transfers are stored as pending. Workers, possibly on several
+// replicas, claim them, move the funds and mark them completed in the same
+// database transaction, so a transfer claimed again after its lease expired is
+// never applied twice. A transfer rejected with a domain error is marked failed
+// with the error code; any other error leaves it processing, and it is retried
+// once the lease expires.
+//
+// Scheduled transfers are stored with an execution time, moved to a business
+// day before its cut-off by the calendar, and claimed by the same workers once
+// due. When an attempt fails with a domain error and the transfer has a retry
+// deadline, it is scheduled again RetryInterval later, as long as that is
+// before the deadline.
+//
+// A transfer with details for the client, such as an external reference, can
+// also be booked: its funds move right away and it is recorded as completed in
+// the same transaction.
+//
+// The fee of a transfer is quoted from the client's fee schedule when it is
+// submitted, stored with it and charged together with its funds. Splits,
+// sweeps and reversals are not charged, and reversals do not refund fees.
+//
+// A completed transfer is reversed by a transfer in the opposite direction
+// linked to it, booked the same way; a reversal that waits for funds is stored
+// as pending with a retry deadline.
+type AsyncTransferService struct {
+	accounts  *AccountService
+	transfers db.TransferRepositoryPort
+	opts      AsyncTransferOptions
+}
+
+func NewAsyncTransferService(accounts *AccountService, transfers db.TransferRepositoryPort, opts AsyncTransferOptions) *AsyncTransferService {
+	if opts.Workers < 0 {
+		opts.Workers = 0
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultAsyncTransferBatchSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultAsyncTransferPollInterval
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = DefaultAsyncTransferLease
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultScheduledRetryInterval
+	}
+	if opts.Calendar == nil {
+		opts.Calendar = calendar.Default()
+	}
+	if opts.MaxMetadataBytes <= 0 {
+		opts.MaxMetadataBytes = DefaultMaxMetadataBytes
+	}
+	return &AsyncTransferService{accounts: accounts, transfers: transfers, opts: opts}
+}
+
+// SubmitTransfer validates and stores a transfer for background processing
+func (s *AsyncTransferService) SubmitTransfer(sourceID, destID int64, amount decimal.Decimal, details model.TransferDetails) (model.Transfer, error) {
+	if err := s.accounts.validateTransfer(sourceID, destID, amount); err != nil {
+		return model.Transfer{}, err
+	}
+	details, err := s.validateDetails(details)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	fee, err := s.accounts.quoteFee(sourceID, destID, amount, details.ClientID, details.FeeMode)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	transfer, err := s.transfers.CreateTransfer(model.Transfer{SourceAccountID: sourceID, DestinationAccountID: destID, Amount: amount, TransferDetails: details, Fee: fee})
+	if err != nil {
+		if !errors.Is(err, model.ErrDuplicateExternalReference) {
+			log.Printf("SubmitTransfer db error: %v", err)
+		}
+		return model.Transfer{}, err
+	}
+	log.Printf("Transfer %d submitted: %d -> %d, amount: %v", transfer.ID, sourceID, destID, amount)
+	return transfer, nil
+}
+
+// ScheduleTransfer books a transfer to run at executeAt, as moved by the
+// business day rule; an empty rule is the calendar's default. Failed attempts
+// are retried until retryUntil; a zero retryUntil fails the transfer on the
+// first error.
+func (s *AsyncTransferService) ScheduleTransfer(sourceID, destID int64, amount decimal.Decimal, executeAt, retryUntil time.Time, rule calendar.Rule, details model.TransferDetails) (model.Transfer, error) {
+	if err := s.accounts.validateTransfer(sourceID, destID, amount); err != nil {
+		return model.Transfer{}, err
+	}
+	details, err := s.validateDetails(details)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	rule, err = s.opts.Calendar.ResolveRule(string(rule))
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	fee, err := s.accounts.quoteFee(sourceID, destID, amount, details.ClientID, details.FeeMode)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	transfer := model.Transfer{SourceAccountID: sourceID, DestinationAccountID: destID, Amount: amount, TransferDetails: details, Fee: fee}
+	if adjusted := s.opts.Calendar.Adjust(executeAt, rule); !adjusted.Equal(executeAt) {
+		log.Printf("ScheduleTransfer moved %v to %v by the %s rule", executeAt, adjusted, rule)
+		executeAt = adjusted
+	}
+	executeAt = executeAt.UTC()
+	transfer.ExecuteAt = &executeAt
+	if !retryUntil.IsZero() {
+		if !retryUntil.After(executeAt) {
+			log.Printf("ScheduleTransfer retry deadline %v is not after %v", retryUntil, executeAt)
+			return model.Transfer{}, model.ErrRetryDeadlineBeforeExecution
+		}
+		retryUntil = retryUntil.UTC()
+		transfer.RetryUntil = &retryUntil
+	}
+
+	scheduled, err := s.transfers.CreateTransfer(transfer)
+	if err != nil {
+		if !errors.Is(err, model.ErrDuplicateExternalReference) {
+			log.Printf("ScheduleTransfer db error: %v", err)
+		}
+		return model.Transfer{}, err
+	}
+	log.Printf("Transfer %d scheduled at %v: %d -> %d, amount: %v", scheduled.ID, executeAt, sourceID, destID, amount)
+	return scheduled, nil
+}
+
+// BookTransfer moves the funds right away, like AccountService.Transfer, and
+// records the transfer with its details as completed in the same transaction,
+// the batch transaction of the group commit service when one is configured
+func (s *AsyncTransferService) BookTransfer(sourceID, destID int64, amount decimal.Decimal, details model.TransferDetails) (model.Transfer, error) {
+	if err := s.accounts.validateTransfer(sourceID, destID, amount); err != nil {
+		return model.Transfer{}, err
+	}
+	details, err := s.validateDetails(details)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	fee, err := s.accounts.quoteFee(sourceID, destID, amount, details.ClientID, details.FeeMode)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	transfer := model.Transfer{SourceAccountID: sourceID, DestinationAccountID: destID, Amount: amount, TransferDetails: details, Fee: fee}
+	create := func(txn db.TransactionPort) (model.Transfer, error) {
+		return s.transfers.BookTransfer(txn, transfer)
+	}
+	var booked model.Transfer
+	if s.opts.GroupCommit != nil {
+		booked, err = s.opts.GroupCommit.book(transfer, create)
+	} else {
+		booked, err = s.book(create)
+	}
+	if err != nil {
+		if model.ErrorCode(err) == "" && !errors.Is(err, model.ErrDuplicateExternalReference) {
+			log.Printf("BookTransfer db error: %v", err)
+		}
+		return model.Transfer{}, err
+	}
+	log.Printf("Transfer %d booked: %d -> %d, amount: %v", booked.ID, sourceID, destID, amount)
+	return booked, nil
+}
+
+// validateDetails checks the metadata of a transfer and drops a JSON null
+func (s *AsyncTransferService) validateDetails(details model.TransferDetails) (model.TransferDetails, error) {
+	metadata := bytes.TrimSpace(details.Metadata)
+	if len(metadata) == 0 || bytes.Equal(metadata, []byte("null")) {
+		details.Metadata = nil
+		return details, nil
+	}
+	if len(metadata) > s.opts.MaxMetadataBytes {
+		log.Printf("Transfer metadata of %d bytes exceeds %d", len(metadata), s.opts.MaxMetadataBytes)
+		return model.TransferDetails{}, model.ErrMetadataTooLarge
+	}
+	if metadata[0] != '{' || !json.Valid(metadata) {
+		return model.TransferDetails{}, model.ErrInvalidMetadata
+	}
+	details.Metadata = json.RawMessage(metadata)
+	return details, nil
+}
+
+// ListScheduledTransfers returns up to limit scheduled transfers in execution
+// order, optionally only those with status
+func (s *AsyncTransferService) ListScheduledTransfers(status model.TransferStatus, limit int) ([]model.Transfer, error) {
+	if limit <= 0 || limit > MaxScheduledTransfersPage {
+		limit = MaxScheduledTransfersPage
+	}
+	transfers, err := s.transfers.ListScheduledTransfers(status, limit)
+	if err != nil {
+		log.Printf("ListScheduledTransfers db error: %v", err)
+	}
+	return transfers, err
+}
+
+// CancelScheduledTransfer cancels a scheduled transfer that has not started yet
+func (s *AsyncTransferService) CancelScheduledTransfer(id int64) (model.Transfer, error) {
+	if id <= 0 {
+		return model.Transfer{}, model.ErrTransferIDMustBePositive
+	}
+	transfer, err := s.transfers.CancelTransfer(id)
+	switch {
+	case err == nil:
+		log.Printf("Transfer %d cancelled", id)
+	case errors.Is(err, model.ErrTransferNotFound), errors.Is(err, model.ErrTransferNotCancellable):
+	default:
+		log.Printf("CancelScheduledTransfer db error: %v", err)
+	}
+	return transfer, err
+}
+
+// GetTransfer returns a submitted transfer and its status, with the legs of a
+// split or sweep and the reversals of a completed transfer
+func (s *AsyncTransferService) GetTransfer(id int64) (model.Transfer, error) {
+	if id <= 0 {
+		return model.Transfer{}, model.ErrTransferIDMustBePositive
+	}
+	transfer, err := s.transfers.GetTransfer(id)
+	if err != nil {
+		if !errors.Is(err, model.ErrTransferNotFound) {
+			log.Printf("GetTransfer db error: %v", err)
+		}
+		return transfer, err
+	}
+	if transfer.Kind == model.TransferKindSplit || transfer.Kind == model.TransferKindSweep {
+		if transfer.Legs, err = s.transfers.ListLegs(id); err != nil {
+			log.Printf("GetTransfer db error listing legs: %v", err)
+			return model.Transfer{}, err
+		}
+		return transfer, nil
+	}
+	if transfer.Status == model.TransferCompleted && transfer.ReversalOf == nil {
+		if transfer.Reversals, err = s.transfers.ListReversals(id); err != nil {
+			log.Printf("GetTransfer db error listing reversals: %v", err)
+			return model.Transfer{}, err
+		}
+	}
+	return transfer, nil
+}
+
+// GetTransferByReference returns the transfer a client submitted with an external reference
+func (s *AsyncTransferService) GetTransferByReference(clientID, reference string) (model.Transfer, error) {
+	transfer, err := s.transfers.GetTransferByReference(clientID, reference)
+	if err != nil && !errors.Is(err, model.ErrTransferNotFound) {
+		log.Printf("GetTransferByReference db error: %v", err)
+	}
+	return transfer, err
+}
+
+// ReverseTransfer moves amount of a completed transfer back from its
+// destination to its source, linked to the original; a zero amount reverses
+// what is not reversed yet. Reversals of a transfer never exceed its amount.
+// When the destination lacks the funds, the reversal fails with
+// ErrInsufficientFunds and nothing is stored, unless retryUntil is set: then
+// it is stored as pending and retried by the workers until retryUntil.
+func (s *AsyncTransferService) ReverseTransfer(id int64, amount decimal.Decimal, retryUntil time.Time) (model.Transfer, error) {
+	if id <= 0 {
+		return model.Transfer{}, model.ErrTransferIDMustBePositive
+	}
+	if amount.IsNegative() {
+		log.Printf("ReverseTransfer with negative amount: %v", amount)
+		return model.Transfer{}, model.ErrAmountMustBePositive
+	}
+	if err := s.accounts.validateDecimalPrecision(amount); err != nil {
+		log.Printf("ReverseTransfer amount precision error: %v", err)
+		return model.Transfer{}, err
+	}
+	if !retryUntil.IsZero() && !retryUntil.After(time.Now()) {
+		log.Printf("ReverseTransfer retry deadline %v is in the past", retryUntil)
+		return model.Transfer{}, model.ErrRetryDeadlineBeforeExecution
+	}
+
+	reversal, err := s.reverse(id, amount)
+	if errors.Is(err, model.ErrInsufficientFunds) && !retryUntil.IsZero() {
+		retryUntil = retryUntil.UTC()
+		reversal, err = s.transfers.CreateReversal(nil, id, amount, model.TransferPending, &retryUntil)
+		if err == nil {
+			log.Printf("Transfer %d reversal %d pending until %v: %d -> %d, amount: %v", id, reversal.ID, retryUntil, reversal.SourceAccountID, reversal.DestinationAccountID, reversal.Amount)
+			return reversal, nil
+		}
+	}
+	switch {
+	case err == nil:
+		log.Printf("Transfer %d reversed by %d: %d -> %d, amount: %v", id, reversal.ID, reversal.SourceAccountID, reversal.DestinationAccountID, reversal.Amount)
+	case model.ErrorCode(err) != "", errors.Is(err, model.ErrTransferNotFound),
+		errors.Is(err, model.ErrTransferNotReversible), errors.Is(err, model.ErrReversalExceedsOriginal):
+		log.Printf("Transfer %d reversal rejected: %v", id, err)
+	default:
+		log.Printf("ReverseTransfer db error: %v", err)
+	}
+	return reversal, err
+}
+
+// reverse stores a completed reversal and moves its funds in one transaction
+func (s *AsyncTransferService) reverse(id int64, amount decimal.Decimal) (model.Transfer, error) {
+	return s.book(func(txn db.TransactionPort) (model.Transfer, error) {
+		return s.transfers.CreateReversal(txn, id, amount, model.TransferCompleted, nil)
+	})
+}
+
+// book stores a completed transfer with create and moves its funds in one transaction
+func (s *AsyncTransferService) book(create func(txn db.TransactionPort) (model.Transfer, error)) (model.Transfer, error) {
+	var transfer model.Transfer
+	err := s.accounts.inTx(func(txn db.TransactionPort) error {
+		var err error
+		if transfer, err = create(txn); err != nil {
+			return err
+		}
+		return s.accounts.transferWithFeeInTx(txn, transfer.SourceAccountID, transfer.DestinationAccountID, transfer.Amount, transfer.Fee)
+	})
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	s.accounts.committed(transfer.SourceAccountID, transfer.DestinationAccountID)
+	return transfer, nil
+}
+
+// Run processes transfers with the configured number of workers until ctx is cancelled
+func (s *AsyncTransferService) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work processes batches back to back while there is work, then polls
+func (s *AsyncTransferService) work(ctx context.Context) {
+	for {
+		n, err := s.ProcessBatch()
+		if err == nil && n == s.opts.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.opts.PollInterval):
+		}
+	}
+}
+
+// ProcessBatch claims one batch of transfers and processes them, returning how many were claimed
+func (s *AsyncTransferService) ProcessBatch() (int, error) {
+	claimed, err := s.transfers.ClaimTransfers(s.opts.BatchSize, s.opts.Lease)
+	if err != nil {
+		log.Printf("Async transfer claim failed: %v", err)
+		return 0, err
+	}
+	for _, transfer := range claimed {
+		s.process(transfer)
+	}
+	return len(claimed), nil
+}
+
+// process executes a claimed transfer and records its outcome
+func (s *AsyncTransferService) process(transfer model.Transfer) {
+	// The usual validation applies at execution time; its errors are final
+	if err := s.accounts.validateTransfer(transfer.SourceAccountID, transfer.DestinationAccountID, transfer.Amount); err != nil {
+		s.fail(transfer, model.ErrorCode(err))
+		return
+	}
+
+	err := s.execute(transfer)
+	if err == nil {
+		log.Printf("Transfer %d completed: %d -> %d, amount: %v", transfer.ID, transfer.SourceAccountID, transfer.DestinationAccountID, transfer.Amount)
+		s.accounts.committed(transfer.SourceAccountID, transfer.DestinationAccountID)
+		return
+	}
+	if errors.Is(err, db.ErrTransferClaimLost) {
+		log.Printf("Transfer %d was claimed by another worker", transfer.ID)
+		return
+	}
+	code := model.ErrorCode(err)
+	if code == "" {
+		log.Printf("Transfer %d attempt %d failed, retrying after the lease expires: %v", transfer.ID, transfer.Attempts, err)
+		return
+	}
+	if transfer.RetryUntil != nil {
+		next := time.Now().UTC().Add(s.opts.RetryInterval)
+		if !next.After(*transfer.RetryUntil) {
+			if err := s.transfers.RetryTransfer(transfer.ID, transfer.Attempts, next, code); err != nil {
+				log.Printf("Transfer %d failed to schedule a retry after %s: %v", transfer.ID, code, err)
+				return
+			}
+			log.Printf("Transfer %d attempt %d failed with %s, retrying at %v", transfer.ID, transfer.Attempts, code, next)
+			return
+		}
+	}
+	s.fail(transfer, code)
+}
+
+// fail marks a claimed transfer failed with a domain error code
+func (s *AsyncTransferService) fail(transfer model.Transfer, code string) {
+	if err := s.transfers.FinishTransfer(nil, transfer.ID, transfer.Attempts, model.TransferFailed, code); err != nil {
+		log.Printf("Transfer %d failed to record failure %s: %v", transfer.ID, code, err)
+		return
+	}
+	log.Printf("Transfer %d failed: %s", transfer.ID, code)
+}
+
+// execute moves the funds and marks the transfer completed in one transaction.
+// The transfer row is updated first, so a second worker holding the same
+// transfer waits for the first and then finds its claim lost.
+func (s *AsyncTransferService) execute(transfer model.Transfer) (err error) {
+	txn, err := s.accounts.repo.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			txn.Rollback()
+			panic(p)
+		} else if err != nil {
+			txn.Rollback()
+		}
+	}()
+
+	if err = s.transfers.FinishTransfer(txn, transfer.ID, transfer.Attempts, model.TransferCompleted, ""); err != nil {
+		return err
+	}
+	if err = s.accounts.transferWithFeeInTx(txn, transfer.SourceAccountID, transfer.DestinationAccountID, transfer.Amount, transfer.Fee); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
@@ -0,0 +1,418 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/calendar"
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAsyncTransferTest(t *testing.T, opts AsyncTransferOptions) (*AsyncTransferService, db.AccountRepositoryPort, db.TransferRepositoryPort) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	transfers := db.NewMemoryTransferRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, accounts.CreateAccount(2, decimal.Zero))
+	return NewAsyncTransferService(NewAccountService(accounts), transfers, opts), accounts, transfers
+}
+
+func requireAccountBalance(t *testing.T, repo db.AccountRepositoryPort, accountID int64, want int64) {
+	t.Helper()
+	balance, err := repo.GetAccountBalance(nil, accountID)
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.NewFromInt(want)), "account %d: want %d, got %s", accountID, want, balance)
+}
+
+func requireStatus(t *testing.T, transfers db.TransferRepositoryPort, id int64, want model.TransferStatus) model.Transfer {
+	t.Helper()
+	transfer, err := transfers.GetTransfer(id)
+	require.NoError(t, err)
+	assert.Equal(t, want, transfer.Status, "transfer %d", id)
+	return transfer
+}
+
+func TestAsyncTransfer_Lifecycle(t *testing.T) {
+	svc, accounts, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+
+	submitted, err := svc.SubmitTransfer(1, 2, decimal.NewFromInt(30), model.TransferDetails{})
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferPending, submitted.Status)
+	requireAccountBalance(t, accounts, 1, 100)
+
+	n, err := svc.ProcessBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	got, err := svc.GetTransfer(submitted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferCompleted, got.Status)
+	assert.Empty(t, got.ErrorCode)
+	requireAccountBalance(t, accounts, 1, 70)
+	requireAccountBalance(t, accounts, 2, 30)
+}
+
+func TestAsyncTransfer_RecordsDomainErrorCode(t *testing.T) {
+	svc, accounts, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+
+	tooMuch, err := svc.SubmitTransfer(1, 2, decimal.NewFromInt(500), model.TransferDetails{})
+	require.NoError(t, err)
+	missing, err := svc.SubmitTransfer(1, 9, decimal.NewFromInt(1), model.TransferDetails{})
+	require.NoError(t, err)
+	_, err = svc.ProcessBatch()
+	require.NoError(t, err)
+
+	got, err := svc.GetTransfer(tooMuch.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferFailed, got.Status)
+	assert.Equal(t, "insufficient_funds", got.ErrorCode)
+
+	got, err = svc.GetTransfer(missing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferFailed, got.Status)
+	assert.Equal(t, "destination_account_not_found", got.ErrorCode)
+	requireAccountBalance(t, accounts, 1, 100)
+}
+
+func TestAsyncTransfer_Validation(t *testing.T) {
+	svc, _, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+
+	_, err := svc.SubmitTransfer(1, 1, decimal.NewFromInt(1), model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrSourceAndDestinationMustDiffer)
+	_, err = svc.SubmitTransfer(1, 2, decimal.NewFromInt(-1), model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrAmountMustBePositive)
+	_, err = svc.GetTransfer(0)
+	assert.ErrorIs(t, err, model.ErrTransferIDMustBePositive)
+	_, err = svc.GetTransfer(42)
+	assert.ErrorIs(t, err, model.ErrTransferNotFound)
+}
+
+func TestAsyncTransfer_StaleClaimIsNotApplied(t *testing.T) {
+	svc, accounts, transfers := newAsyncTransferTest(t, AsyncTransferOptions{Lease: time.Millisecond})
+
+	submitted, err := svc.SubmitTransfer(1, 2, decimal.NewFromInt(10), model.TransferDetails{})
+	require.NoError(t, err)
+	stale, err := transfers.ClaimTransfers(1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = svc.ProcessBatch()
+	require.NoError(t, err)
+
+	// The worker that lost the lease finishes late and must not move funds again
+	svc.process(stale[0])
+	got, err := svc.GetTransfer(submitted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferCompleted, got.Status)
+	assert.Equal(t, 2, got.Attempts)
+	requireAccountBalance(t, accounts, 1, 90)
+	requireAccountBalance(t, accounts, 2, 10)
+}
+
+func TestAsyncTransfer_WorkersProcessEachTransferOnce(t *testing.T) {
+	svc, accounts, _ := newAsyncTransferTest(t, AsyncTransferOptions{Workers: 4, BatchSize: 3, PollInterval: time.Millisecond})
+
+	var ids []int64
+	for i := 0; i < 40; i++ {
+		submitted, err := svc.SubmitTransfer(1, 2, decimal.NewFromInt(1), model.TransferDetails{})
+		require.NoError(t, err)
+		ids = append(ids, submitted.ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		svc.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		for _, id := range ids {
+			if got, err := svc.GetTransfer(id); err != nil || got.Status != model.TransferCompleted {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	requireAccountBalance(t, accounts, 1, 60)
+	requireAccountBalance(t, accounts, 2, 40)
+}
+
+func TestScheduledTransfer_RunsWhenDue(t *testing.T) {
+	svc, accounts, transfers := newAsyncTransferTest(t, AsyncTransferOptions{})
+
+	later, err := svc.ScheduleTransfer(1, 2, decimal.NewFromInt(10), time.Now().Add(time.Hour), time.Time{}, calendar.RuleNone, model.TransferDetails{})
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferScheduled, later.Status)
+	due, err := svc.ScheduleTransfer(1, 2, decimal.NewFromInt(5), time.Now().Add(-time.Second), time.Time{}, calendar.RuleNone, model.TransferDetails{})
+	require.NoError(t, err)
+
+	n, err := svc.ProcessBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "only the due transfer runs")
+	requireStatus(t, transfers, due.ID, model.TransferCompleted)
+	requireStatus(t, transfers, later.ID, model.TransferScheduled)
+	requireAccountBalance(t, accounts, 2, 5)
+}
+
+func TestScheduledTransfer_RetriesUntilDeadline(t *testing.T) {
+	svc, accounts, transfers := newAsyncTransferTest(t, AsyncTransferOptions{RetryInterval: 20 * time.Millisecond})
+
+	scheduled, err := svc.ScheduleTransfer(1, 2, decimal.NewFromInt(150), time.Now().Add(-time.Second), time.Now().Add(time.Hour), calendar.RuleNone, model.TransferDetails{})
+	require.NoError(t, err)
+	_, err = svc.ProcessBatch()
+	require.NoError(t, err)
+
+	retried := requireStatus(t, transfers, scheduled.ID, model.TransferScheduled)
+	assert.Equal(t, "insufficient_funds", retried.ErrorCode, "the reason of the failed attempt is recorded")
+	n, err := svc.ProcessBatch()
+	require.NoError(t, err)
+	assert.Zero(t, n, "the retry waits for the retry interval")
+
+	// Funds arrive before the next attempt
+	tx, err := accounts.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, accounts.UpdateAccountBalance(tx, 1, decimal.NewFromInt(50)))
+	require.NoError(t, tx.Commit())
+
+	time.Sleep(30 * time.Millisecond)
+	_, err = svc.ProcessBatch()
+	require.NoError(t, err)
+	completed := requireStatus(t, transfers, scheduled.ID, model.TransferCompleted)
+	assert.Equal(t, 2, completed.Attempts)
+	requireAccountBalance(t, accounts, 2, 150)
+}
+
+func TestScheduledTransfer_NoRetryPastDeadline(t *testing.T) {
+	svc, _, transfers := newAsyncTransferTest(t, AsyncTransferOptions{RetryInterval: time.Hour})
+
+	scheduled, err := svc.ScheduleTransfer(1, 9, decimal.NewFromInt(1), time.Now().Add(-time.Second), time.Now().Add(time.Minute), calendar.RuleNone, model.TransferDetails{})
+	require.NoError(t, err)
+	_, err = svc.ProcessBatch()
+	require.NoError(t, err)
+
+	failed := requireStatus(t, transfers, scheduled.ID, model.TransferFailed)
+	assert.Equal(t, "destination_account_not_found", failed.ErrorCode)
+}
+
+func TestScheduledTransfer_RevalidatedAtExecution(t *testing.T) {
+	svc, accounts, transfers := newAsyncTransferTest(t, AsyncTransferOptions{})
+	scheduled, err := svc.ScheduleTransfer(1, 2, decimal.RequireFromString("0.125"), time.Now().Add(-time.Second), time.Now().Add(time.Hour), calendar.RuleNone, model.TransferDetails{})
+	require.NoError(t, err)
+
+	// The precision limit was lowered after the transfer was booked
+	strict := NewAsyncTransferService(NewAccountService(accounts, WithMaxPrecision(2)), transfers, AsyncTransferOptions{})
+	_, err = strict.ProcessBatch()
+	require.NoError(t, err)
+
+	failed := requireStatus(t, transfers, scheduled.ID, model.TransferFailed)
+	assert.Equal(t, "precision_too_high", failed.ErrorCode, "validation errors are not retried")
+	requireAccountBalance(t, accounts, 1, 100)
+}
+
+func TestScheduledTransfer_MovedToBusinessDay(t *testing.T) {
+	holiday := calendar.Holiday{Date: time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC), Name: "Bank holiday"}
+	cal := calendar.New(calendar.Options{Cutoff: 17 * time.Hour, Holidays: []calendar.Holiday{holiday}})
+	svc, _, _ := newAsyncTransferTest(t, AsyncTransferOptions{Calendar: cal})
+	saturday := time.Date(2030, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name      string
+		executeAt time.Time
+		rule      calendar.Rule
+		want      time.Time
+	}{
+		{"DefaultRuleIsFollowing", saturday, "", time.Date(2030, 3, 5, 10, 0, 0, 0, time.UTC)},
+		{"Preceding", saturday, calendar.Preceding, time.Date(2030, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{"AfterCutoff", time.Date(2030, 3, 1, 18, 0, 0, 0, time.UTC), "", time.Date(2030, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"None", saturday, calendar.RuleNone, saturday},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scheduled, err := svc.ScheduleTransfer(1, 2, decimal.NewFromInt(1), tc.executeAt, time.Time{}, tc.rule, model.TransferDetails{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, *scheduled.ExecuteAt)
+		})
+	}
+
+	_, err := svc.ScheduleTransfer(1, 2, decimal.NewFromInt(1), saturday, time.Time{}, "nearest", model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrInvalidBusinessDayRule)
+	// The retry deadline must still be after the moved execution time
+	_, err = svc.ScheduleTransfer(1, 2, decimal.NewFromInt(1), saturday, saturday.Add(time.Hour), calendar.Following, model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrRetryDeadlineBeforeExecution)
+}
+
+func TestScheduledTransfer_ListAndCancel(t *testing.T) {
+	svc, _, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+
+	executeAt := time.Now().Add(time.Hour)
+	_, err := svc.ScheduleTransfer(1, 2, decimal.NewFromInt(1), executeAt, executeAt.Add(-time.Minute), calendar.RuleNone, model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrRetryDeadlineBeforeExecution)
+	_, err = svc.ScheduleTransfer(1, 1, decimal.NewFromInt(1), executeAt, time.Time{}, calendar.RuleNone, model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrSourceAndDestinationMustDiffer)
+
+	first, err := svc.ScheduleTransfer(1, 2, decimal.NewFromInt(1), executeAt, time.Time{}, calendar.RuleNone, model.TransferDetails{})
+	require.NoError(t, err)
+	second, err := svc.ScheduleTransfer(1, 2, decimal.NewFromInt(2), executeAt.Add(-time.Minute), time.Time{}, calendar.RuleNone, model.TransferDetails{})
+	require.NoError(t, err)
+
+	listed, err := svc.ListScheduledTransfers("", 0)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+	assert.Equal(t, second.ID, listed[0].ID)
+
+	cancelled, err := svc.CancelScheduledTransfer(first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferCancelled, cancelled.Status)
+	_, err = svc.CancelScheduledTransfer(first.ID)
+	assert.ErrorIs(t, err, model.ErrTransferNotCancellable)
+	_, err = svc.CancelScheduledTransfer(0)
+	assert.ErrorIs(t, err, model.ErrTransferIDMustBePositive)
+
+	listed, err = svc.ListScheduledTransfers(model.TransferScheduled, 10)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, second.ID, listed[0].ID)
+}
+
+// completeTransfer submits a transfer from account 1 to 2 and processes it
+func completeTransfer(t *testing.T, svc *AsyncTransferService, amount int64) model.Transfer {
+	t.Helper()
+	submitted, err := svc.SubmitTransfer(1, 2, decimal.NewFromInt(amount), model.TransferDetails{})
+	require.NoError(t, err)
+	_, err = svc.ProcessBatch()
+	require.NoError(t, err)
+	return requireStatus(t, svc.transfers, submitted.ID, model.TransferCompleted)
+}
+
+func TestReverseTransfer_Partial(t *testing.T) {
+	svc, accounts, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+	original := completeTransfer(t, svc, 30)
+
+	first, err := svc.ReverseTransfer(original.ID, decimal.NewFromInt(10), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferCompleted, first.Status)
+	requireAccountBalance(t, accounts, 1, 80)
+	requireAccountBalance(t, accounts, 2, 20)
+
+	_, err = svc.ReverseTransfer(original.ID, decimal.NewFromInt(21), time.Time{})
+	assert.ErrorIs(t, err, model.ErrReversalExceedsOriginal)
+	rest, err := svc.ReverseTransfer(original.ID, decimal.Zero, time.Time{})
+	require.NoError(t, err)
+	assert.True(t, rest.Amount.Equal(decimal.NewFromInt(20)), "got %s", rest.Amount)
+	requireAccountBalance(t, accounts, 1, 100)
+	requireAccountBalance(t, accounts, 2, 0)
+
+	// The link shows both ways
+	got, err := svc.GetTransfer(original.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, rest.ID}, []int64{got.Reversals[0].ID, got.Reversals[1].ID})
+	got, err = svc.GetTransfer(rest.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.ReversalOf)
+	assert.Equal(t, original.ID, *got.ReversalOf)
+	assert.Empty(t, got.Reversals)
+
+	_, err = svc.ReverseTransfer(rest.ID, decimal.Zero, time.Time{})
+	assert.ErrorIs(t, err, model.ErrTransferNotReversible)
+	_, err = svc.ReverseTransfer(original.ID, decimal.NewFromInt(-1), time.Time{})
+	assert.ErrorIs(t, err, model.ErrAmountMustBePositive)
+	_, err = svc.ReverseTransfer(0, decimal.Zero, time.Time{})
+	assert.ErrorIs(t, err, model.ErrTransferIDMustBePositive)
+}
+
+func TestReverseTransfer_InsufficientFunds(t *testing.T) {
+	svc, accounts, transfers := newAsyncTransferTest(t, AsyncTransferOptions{RetryInterval: time.Millisecond})
+	original := completeTransfer(t, svc, 30)
+	require.NoError(t, accounts.CreateAccount(3, decimal.Zero))
+	require.NoError(t, svc.accounts.Transfer(2, 3, decimal.NewFromInt(25)))
+
+	// Without a retry deadline the reversal fails and nothing is stored
+	_, err := svc.ReverseTransfer(original.ID, decimal.Zero, time.Time{})
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	reversals, err := transfers.ListReversals(original.ID)
+	require.NoError(t, err)
+	assert.Empty(t, reversals)
+	requireAccountBalance(t, accounts, 2, 5)
+
+	// With one it waits for the funds
+	pending, err := svc.ReverseTransfer(original.ID, decimal.Zero, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferPending, pending.Status)
+	_, err = svc.ProcessBatch()
+	require.NoError(t, err)
+	retried := requireStatus(t, transfers, pending.ID, model.TransferScheduled)
+	assert.Equal(t, "insufficient_funds", retried.ErrorCode)
+
+	require.NoError(t, svc.accounts.Transfer(3, 2, decimal.NewFromInt(25)))
+	time.Sleep(5 * time.Millisecond)
+	_, err = svc.ProcessBatch()
+	require.NoError(t, err)
+	requireStatus(t, transfers, pending.ID, model.TransferCompleted)
+	requireAccountBalance(t, accounts, 1, 100)
+	requireAccountBalance(t, accounts, 2, 0)
+}
+
+func TestBookTransfer(t *testing.T) {
+	svc, accounts, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+	details := model.TransferDetails{ClientID: "billing", Description: "Invoice 117", ExternalReference: "pay_1", Metadata: json.RawMessage(`{"invoice": 117}`)}
+
+	booked, err := svc.BookTransfer(1, 2, decimal.NewFromInt(30), details)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferCompleted, booked.Status)
+	requireAccountBalance(t, accounts, 1, 70)
+	requireAccountBalance(t, accounts, 2, 30)
+
+	found, err := svc.GetTransferByReference("billing", "pay_1")
+	require.NoError(t, err)
+	assert.Equal(t, booked.ID, found.ID)
+	assert.Equal(t, "Invoice 117", found.Description)
+	assert.JSONEq(t, `{"invoice": 117}`, string(found.Metadata))
+
+	// A resubmission with the same reference moves nothing
+	_, err = svc.BookTransfer(1, 2, decimal.NewFromInt(30), details)
+	assert.ErrorIs(t, err, model.ErrDuplicateExternalReference)
+	_, err = svc.SubmitTransfer(1, 2, decimal.NewFromInt(30), details)
+	assert.ErrorIs(t, err, model.ErrDuplicateExternalReference)
+	requireAccountBalance(t, accounts, 1, 70)
+
+	// A failed transfer does not keep its reference
+	details.ExternalReference = "pay_2"
+	_, err = svc.BookTransfer(1, 2, decimal.NewFromInt(500), details)
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	_, err = svc.GetTransferByReference("billing", "pay_2")
+	assert.ErrorIs(t, err, model.ErrTransferNotFound)
+}
+
+func TestTransferDetails_Metadata(t *testing.T) {
+	svc, _, _ := newAsyncTransferTest(t, AsyncTransferOptions{MaxMetadataBytes: 32})
+	submit := func(metadata string) (model.Transfer, error) {
+		return svc.SubmitTransfer(1, 2, decimal.NewFromInt(1), model.TransferDetails{Metadata: json.RawMessage(metadata)})
+	}
+
+	_, err := submit(`{"note": "this object is longer than 32 bytes"}`)
+	assert.ErrorIs(t, err, model.ErrMetadataTooLarge)
+	_, err = submit(`["not", "an", "object"]`)
+	assert.ErrorIs(t, err, model.ErrInvalidMetadata)
+	_, err = submit(`{"broken": `)
+	assert.ErrorIs(t, err, model.ErrInvalidMetadata)
+
+	submitted, err := submit(`null`)
+	require.NoError(t, err)
+	assert.Nil(t, submitted.Metadata, "null is no metadata")
+	submitted, err = submit(` {"ok": true} `)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ok": true}`, string(submitted.Metadata))
+}
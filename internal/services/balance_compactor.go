@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"internal-transfers/internal/db"
+)
+
+// BalanceCompactor periodically folds the balance shards of hot accounts back
+// into their account rows, keeping debits and reads of those accounts cheap
+type BalanceCompactor struct {
+	repo     db.BalanceShardingPort
+	interval time.Duration
+}
+
+func NewBalanceCompactor(repo db.BalanceShardingPort, interval time.Duration) *BalanceCompactor {
+	return &BalanceCompactor{repo: repo, interval: interval}
+}
+
+// Run compacts every interval until ctx is cancelled
+func (c *BalanceCompactor) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Compact()
+		}
+	}
+}
+
+// Compact folds the shards of all sharded accounts once
+func (c *BalanceCompactor) Compact() {
+	start := time.Now()
+	compacted, err := c.repo.CompactBalanceShards()
+	if err != nil {
+		log.Printf("Balance shard compaction failed after %d account(s): %v", compacted, err)
+		return
+	}
+	if compacted > 0 {
+		log.Printf("Balance shards compacted: %d account(s) in %v", compacted, time.Since(start))
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+
+	"internal-transfers/internal/db"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalanceCompactor_Compact(t *testing.T) {
+	repo := db.NewMemoryAccountRepository(db.NewMemoryStore())
+	svc := NewAccountService(repo)
+	require.NoError(t, repo.CreateAccount(1, decimal.Zero))
+	require.NoError(t, repo.CreateAccount(2, decimal.NewFromInt(50)))
+	require.NoError(t, svc.SetBalanceShards(1, 4))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, svc.Transfer(2, 1, decimal.NewFromInt(5)))
+	}
+
+	NewBalanceCompactor(repo, 0).Compact()
+
+	account, err := svc.GetAccount(1)
+	require.NoError(t, err)
+	assert.True(t, account.Balance.Equal(decimal.NewFromInt(50)), "got %s", account.Balance)
+
+	// Every sharded account is visited on each run, and the whole balance
+	// stays spendable
+	compacted, err := repo.CompactBalanceShards()
+	require.NoError(t, err)
+	assert.Equal(t, 1, compacted)
+	assert.NoError(t, svc.Transfer(1, 2, decimal.NewFromInt(50)))
+}
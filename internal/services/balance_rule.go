@@ -0,0 +1,458 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"internal-transfers/internal/calendar"
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+	"internal-transfers/internal/schedule"
+
+	"github.com/shopspring/decimal"
+)
+
+// Defaults for the balance rule worker
+const (
+	DefaultBalanceRuleInterval  = 10 * time.Second
+	DefaultBalanceRuleBatchSize = 100
+)
+
+// MaxBalanceRulesPage is the largest number of balance rules or sweeps listed at once
+const MaxBalanceRulesPage = 1000
+
+// BalanceRuleServicePort defines the service interface for balance rules
+//
+//go:generate mockgen -destination=../mocks/mock_balance_rule_service.go -package=mocks internal-transfers/internal/services BalanceRuleServicePort
+type BalanceRuleServicePort interface {
+	CreateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error)
+	GetBalanceRule(id int64) (model.BalanceRule, error)
+	ListBalanceRules(accountID int64, limit int) ([]model.BalanceRule, error)
+	UpdateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error)
+	DeleteBalanceRule(id int64) error
+	ListSweeps(id int64, limit int) ([]model.BalanceRuleSweep, error)
+}
+
+// BalanceRuleService manages balance rules and runs them.
+//
+// A rule runs after each transfer committed by this replica that touches its
+// account, and/or on its schedule. Running a rule reads the balance of its
+// account and, when it is out of bounds, makes one transfer to or from the
+// counterparty, recorded as a sweep of the rule in the same transaction as
+// the funds move. Transfers made by rules do not trigger other rules, so that two
+// rules cannot pass funds back and forth forever. Like standing orders, a
+// rule is run by one replica at a time under a per-rule lock; a rule that is
+// already running elsewhere is skipped.
+//
+// Schedules run in the time zone of the calendar, anchored at midnight of the
+// day the rule was created.
+type BalanceRuleService struct {
+	accounts  *AccountService
+	rules     db.BalanceRuleRepositoryPort
+	calendar  *calendar.Calendar
+	interval  time.Duration
+	batchSize int
+	now       func() time.Time
+
+	mu sync.Mutex
+	// touched are the accounts of transfers committed since the last RunTouched
+	touched map[int64]bool
+	// own counts the sweeps in flight per source and destination, whose
+	// commits are not to trigger rules
+	own  map[[2]int64]int
+	wake chan struct{}
+}
+
+// NewBalanceRuleService returns the service and subscribes it to the
+// transfers committed by accounts. Scheduled rules are run every interval; a
+// zero interval never runs them. A nil cal is calendar.Default().
+func NewBalanceRuleService(accounts *AccountService, rules db.BalanceRuleRepositoryPort, interval time.Duration, cal *calendar.Calendar) *BalanceRuleService {
+	if cal == nil {
+		cal = calendar.Default()
+	}
+	s := &BalanceRuleService{
+		accounts:  accounts,
+		rules:     rules,
+		calendar:  cal,
+		interval:  interval,
+		batchSize: DefaultBalanceRuleBatchSize,
+		now:       time.Now,
+		touched:   make(map[int64]bool),
+		own:       make(map[[2]int64]int),
+		wake:      make(chan struct{}, 1),
+	}
+	accounts.OnTransferCommitted(s.transferCommitted)
+	return s
+}
+
+// CreateBalanceRule validates and stores a balance rule
+func (s *BalanceRuleService) CreateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error) {
+	now := s.now()
+	if err := s.prepareRule(&rule, now, now); err != nil {
+		return model.BalanceRule{}, err
+	}
+	created, err := s.rules.CreateBalanceRule(rule)
+	if err != nil {
+		log.Printf("CreateBalanceRule db error: %v", err)
+		return model.BalanceRule{}, err
+	}
+	log.Printf("Balance rule %d created: account %d, counterparty %d", created.ID, created.AccountID, created.CounterpartyAccountID)
+	return created, nil
+}
+
+// GetBalanceRule returns a balance rule
+func (s *BalanceRuleService) GetBalanceRule(id int64) (model.BalanceRule, error) {
+	if id <= 0 {
+		return model.BalanceRule{}, model.ErrBalanceRuleIDMustBePositive
+	}
+	rule, err := s.rules.GetBalanceRule(id)
+	if err != nil && !errors.Is(err, model.ErrBalanceRuleNotFound) {
+		log.Printf("GetBalanceRule db error: %v", err)
+	}
+	return rule, err
+}
+
+// ListBalanceRules returns up to limit balance rules in id order, optionally
+// only those of accountID
+func (s *BalanceRuleService) ListBalanceRules(accountID int64, limit int) ([]model.BalanceRule, error) {
+	if accountID < 0 {
+		return nil, model.ErrAccountIDMustBePositive
+	}
+	if limit <= 0 || limit > MaxBalanceRulesPage {
+		limit = MaxBalanceRulesPage
+	}
+	rules, err := s.rules.ListBalanceRules(accountID, limit)
+	if err != nil {
+		log.Printf("ListBalanceRules db error: %v", err)
+	}
+	return rules, err
+}
+
+// UpdateBalanceRule replaces the settings of a balance rule. Its next
+// scheduled run is recomputed from now.
+func (s *BalanceRuleService) UpdateBalanceRule(rule model.BalanceRule) (model.BalanceRule, error) {
+	current, err := s.GetBalanceRule(rule.ID)
+	if err != nil {
+		return model.BalanceRule{}, err
+	}
+	if err := s.prepareRule(&rule, current.CreatedAt, s.now()); err != nil {
+		return model.BalanceRule{}, err
+	}
+	updated, err := s.rules.UpdateBalanceRule(rule)
+	if err != nil {
+		if !errors.Is(err, model.ErrBalanceRuleNotFound) {
+			log.Printf("UpdateBalanceRule db error: %v", err)
+		}
+		return model.BalanceRule{}, err
+	}
+	log.Printf("Balance rule %d updated", updated.ID)
+	return updated, nil
+}
+
+// DeleteBalanceRule removes a balance rule with its sweeps
+func (s *BalanceRuleService) DeleteBalanceRule(id int64) error {
+	if id <= 0 {
+		return model.ErrBalanceRuleIDMustBePositive
+	}
+	err := s.rules.DeleteBalanceRule(id)
+	switch {
+	case err == nil:
+		log.Printf("Balance rule %d deleted", id)
+	case errors.Is(err, model.ErrBalanceRuleNotFound):
+	default:
+		log.Printf("DeleteBalanceRule db error: %v", err)
+	}
+	return err
+}
+
+// ListSweeps returns up to limit sweeps of a balance rule, most recent first
+func (s *BalanceRuleService) ListSweeps(id int64, limit int) ([]model.BalanceRuleSweep, error) {
+	if _, err := s.GetBalanceRule(id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxBalanceRulesPage {
+		limit = MaxBalanceRulesPage
+	}
+	sweeps, err := s.rules.ListRuleSweeps(id, limit)
+	if err != nil {
+		log.Printf("ListRuleSweeps db error: %v", err)
+	}
+	return sweeps, err
+}
+
+// prepareRule validates rule and sets its next scheduled run after now, for
+// a rule created at createdAt
+func (s *BalanceRuleService) prepareRule(rule *model.BalanceRule, createdAt, now time.Time) error {
+	if err := validateAccountID(rule.AccountID); err != nil {
+		return err
+	}
+	if err := validateAccountID(rule.CounterpartyAccountID); err != nil {
+		return err
+	}
+	if rule.AccountID == rule.CounterpartyAccountID {
+		return model.ErrSourceAndDestinationMustDiffer
+	}
+	if err := validateClientAccounts(rule.AccountID, rule.CounterpartyAccountID); err != nil {
+		return err
+	}
+	if rule.Min == nil && rule.Max == nil {
+		return fmt.Errorf("%w: at least one of min and max is required", model.ErrInvalidBalanceRule)
+	}
+	for _, bound := range []*decimal.Decimal{rule.Min, rule.Max} {
+		if bound == nil {
+			continue
+		}
+		if bound.IsNegative() {
+			return fmt.Errorf("%w: bounds must not be negative", model.ErrInvalidBalanceRule)
+		}
+		if err := s.accounts.validateDecimalPrecision(*bound); err != nil {
+			return err
+		}
+	}
+	if rule.Min != nil && rule.Max != nil && rule.Min.GreaterThan(*rule.Max) {
+		return fmt.Errorf("%w: min must not be above max", model.ErrInvalidBalanceRule)
+	}
+	if !rule.AfterTransfer && rule.Schedule == "" {
+		return fmt.Errorf("%w: the rule must run after transfers, on a schedule or both", model.ErrInvalidBalanceRule)
+	}
+	if _, err := s.accounts.GetAccount(rule.AccountID); err != nil {
+		return err
+	}
+	if _, err := s.accounts.GetAccount(rule.CounterpartyAccountID); err != nil {
+		if errors.Is(err, model.ErrAccountNotFound) {
+			return fmt.Errorf("counterparty: %w", err)
+		}
+		return err
+	}
+
+	rule.NextRunAt = nil
+	if rule.Schedule == "" {
+		return nil
+	}
+	sched, err := s.parseSchedule(rule.Schedule, createdAt)
+	if err != nil {
+		log.Printf("Balance rule invalid schedule %q: %v", rule.Schedule, err)
+		return err
+	}
+	if rule.Enabled {
+		rule.NextRunAt = nextRun(sched, now)
+	}
+	return nil
+}
+
+// Run runs the rules of the accounts touched by transfers as they commit,
+// and the due scheduled rules every interval, until ctx is cancelled
+func (s *BalanceRuleService) Run(ctx context.Context) {
+	var tick <-chan time.Time
+	if s.interval > 0 {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+			s.RunTouched()
+		case <-tick:
+			// Keep going while there is work beyond one batch
+			for ctx.Err() == nil {
+				if n, err := s.RunDue(); err != nil || n == 0 {
+					break
+				}
+			}
+		}
+	}
+}
+
+// transferCommitted notes the accounts of a committed transfer for the
+// worker, unless a rule made it
+func (s *BalanceRuleService) transferCommitted(sourceID, destID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair := [2]int64{sourceID, destID}
+	if s.own[pair] > 0 {
+		s.own[pair]--
+		return
+	}
+	s.touched[sourceID], s.touched[destID] = true, true
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunTouched runs the after-transfer rules of the accounts touched since the
+// last call, returning how many rules ran
+func (s *BalanceRuleService) RunTouched() (int, error) {
+	s.mu.Lock()
+	accountIDs := make([]int64, 0, len(s.touched))
+	for id := range s.touched {
+		accountIDs = append(accountIDs, id)
+	}
+	clear(s.touched)
+	s.mu.Unlock()
+	if len(accountIDs) == 0 {
+		return 0, nil
+	}
+	slices.Sort(accountIDs)
+
+	ids, err := s.rules.TransferTriggeredRules(accountIDs)
+	if err != nil {
+		log.Printf("Balance rule worker failed to list the rules of touched accounts: %v", err)
+		return 0, err
+	}
+	return s.runRules(ids, model.BalanceRuleAfterTransfer), nil
+}
+
+// RunDue runs up to one batch of due scheduled rules, returning how many ran
+func (s *BalanceRuleService) RunDue() (int, error) {
+	due, err := s.rules.DueBalanceRules(s.now().UTC(), s.batchSize)
+	if err != nil {
+		log.Printf("Balance rule worker failed to list due rules: %v", err)
+		return 0, err
+	}
+	return s.runRules(due, model.BalanceRuleScheduled), nil
+}
+
+func (s *BalanceRuleService) runRules(ids []int64, trigger model.BalanceRuleTrigger) int {
+	ran := 0
+	for _, id := range ids {
+		ok, err := s.runRule(id, trigger)
+		if err != nil {
+			log.Printf("Balance rule %d failed, retrying on the next run: %v", id, err)
+		}
+		if ok {
+			ran++
+		}
+	}
+	return ran
+}
+
+// runRule runs a rule unless another worker holds its lock, or it is
+// disabled, gone or, for a scheduled run, no longer due
+func (s *BalanceRuleService) runRule(id int64, trigger model.BalanceRuleTrigger) (bool, error) {
+	unlock, locked, err := s.rules.LockBalanceRule(id)
+	if err != nil || !locked {
+		return false, err
+	}
+	defer unlock()
+
+	// Re-read under the lock: the rule may have changed or run meanwhile
+	rule, err := s.rules.GetBalanceRule(id)
+	if errors.Is(err, model.ErrBalanceRuleNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	now := s.now()
+	if !rule.Enabled {
+		return false, nil
+	}
+	if trigger == model.BalanceRuleScheduled && (rule.NextRunAt == nil || rule.NextRunAt.After(now)) {
+		return false, nil
+	}
+
+	if err := s.sweep(rule, trigger); err != nil {
+		return false, err
+	}
+	if trigger != model.BalanceRuleScheduled {
+		return true, nil
+	}
+	sched, err := s.parseSchedule(rule.Schedule, rule.CreatedAt)
+	if err != nil {
+		return true, err
+	}
+	// Runs missed while no worker was running are skipped, not caught up on
+	return true, s.rules.AdvanceBalanceRule(id, *rule.NextRunAt, nextRun(sched, now))
+}
+
+// sweep brings the balance of the rule's account back within its bounds.
+// Must be called with the rule lock held.
+func (s *BalanceRuleService) sweep(rule model.BalanceRule, trigger model.BalanceRuleTrigger) error {
+	var record, sweep model.BalanceRuleSweep
+	err := s.accounts.inTx(func(txn db.TransactionPort) error {
+		// The account stays locked from the balance read to the move, so no
+		// transfer can change what the sweep is computed from
+		balance, err := s.accounts.repo.GetAccountBalance(txn, rule.AccountID)
+		if err != nil {
+			return err
+		}
+		sourceID, destID, amount := rule.Sweep(balance)
+		if amount.IsZero() {
+			return nil
+		}
+		record = model.BalanceRuleSweep{
+			RuleID:               rule.ID,
+			Trigger:              trigger,
+			SourceAccountID:      sourceID,
+			DestinationAccountID: destID,
+			Amount:               amount,
+		}
+		if sweep, err = s.rules.StartRuleSweep(txn, record); err != nil {
+			return err
+		}
+		if err := s.accounts.transferInTx(txn, sourceID, destID, amount, clientSource); err != nil {
+			return err
+		}
+		return s.rules.FinishRuleSweep(txn, sweep.ID, model.TransferCompleted, "")
+	})
+	sourceID, destID, amount := record.SourceAccountID, record.DestinationAccountID, record.Amount
+	if err == nil {
+		if amount.IsZero() {
+			return nil
+		}
+		// The sweep is in flight until its commit is observed
+		s.mu.Lock()
+		s.own[[2]int64{sourceID, destID}]++
+		s.mu.Unlock()
+		s.accounts.committed(sourceID, destID)
+		log.Printf("Balance rule %d swept %v from %d to %d", rule.ID, amount, sourceID, destID)
+		return nil
+	}
+
+	code := model.ErrorCode(err)
+	if code == "" || amount.IsZero() {
+		// Nothing was recorded, so the rule can run again
+		return err
+	}
+	// Everything was rolled back; record the failure on its own
+	err = s.accounts.inTx(func(txn db.TransactionPort) error {
+		var err error
+		if sweep, err = s.rules.StartRuleSweep(txn, record); err != nil {
+			return err
+		}
+		return s.rules.FinishRuleSweep(txn, sweep.ID, model.TransferFailed, code)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Balance rule %d sweep %d of %v from %d to %d failed: %s", rule.ID, sweep.ID, amount, sourceID, destID, code)
+	return nil
+}
+
+// parseSchedule parses spec in the calendar's time zone, anchored at midnight
+// of the day the rule was created
+func (s *BalanceRuleService) parseSchedule(spec string, createdAt time.Time) (schedule.Schedule, error) {
+	local := createdAt.In(s.calendar.Location())
+	anchor := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	return schedule.Parse(spec, anchor, s.calendar.IsBusinessDay)
+}
+
+// nextRun returns the first run of sched after now, or nil when there is none
+func nextRun(sched schedule.Schedule, now time.Time) *time.Time {
+	next := sched.Next(now).UTC()
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
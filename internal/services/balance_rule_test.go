@@ -0,0 +1,337 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBalanceRuleTest returns a service whose clock is read from *now, with
+// account 1 holding 30, the counterparty 2 holding 100 and account 3 holding 100
+func newBalanceRuleTest(t *testing.T, now *time.Time) (*BalanceRuleService, *AccountService, db.AccountRepositoryPort) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(30)))
+	require.NoError(t, accounts.CreateAccount(2, decimal.NewFromInt(100)))
+	require.NoError(t, accounts.CreateAccount(3, decimal.NewFromInt(100)))
+	accountService := NewAccountService(accounts)
+	svc := NewBalanceRuleService(accountService, db.NewMemoryBalanceRuleRepository(store), 0, nil)
+	svc.now = func() time.Time { return *now }
+	return svc, accountService, accounts
+}
+
+// boundedRule keeps account 1 between min and max through account 2 after each transfer
+func boundedRule(min, max int64) model.BalanceRule {
+	lower, upper := decimal.NewFromInt(min), decimal.NewFromInt(max)
+	return model.BalanceRule{
+		AccountID:             1,
+		CounterpartyAccountID: 2,
+		Min:                   &lower,
+		Max:                   &upper,
+		AfterTransfer:         true,
+		Enabled:               true,
+	}
+}
+
+func TestBalanceRule_AfterTransferKeepsAccountWithinBounds(t *testing.T) {
+	now := time.Now()
+	svc, accountService, accounts := newBalanceRuleTest(t, &now)
+	rule, err := svc.CreateBalanceRule(boundedRule(10, 50))
+	require.NoError(t, err)
+	assert.Nil(t, rule.NextRunAt)
+
+	require.NoError(t, accountService.Transfer(3, 1, decimal.NewFromInt(40)))
+	ran, err := svc.RunTouched()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 1, 50)
+	requireAccountBalance(t, accounts, 2, 120)
+
+	require.NoError(t, accountService.Transfer(1, 3, decimal.NewFromInt(45)))
+	ran, err = svc.RunTouched()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 1, 10)
+	requireAccountBalance(t, accounts, 2, 115)
+
+	// The sweeps of the rule do not trigger rules themselves
+	ran, err = svc.RunTouched()
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+
+	sweeps, err := svc.ListSweeps(rule.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, sweeps, 2)
+	assert.Equal(t, int64(2), sweeps[0].SourceAccountID)
+	assert.Equal(t, int64(1), sweeps[0].DestinationAccountID)
+	assert.True(t, sweeps[0].Amount.Equal(decimal.NewFromInt(5)), "got %s", sweeps[0].Amount)
+	assert.Equal(t, model.BalanceRuleAfterTransfer, sweeps[0].Trigger)
+	assert.Equal(t, model.TransferCompleted, sweeps[0].Status)
+	assert.Equal(t, int64(1), sweeps[1].SourceAccountID)
+	assert.True(t, sweeps[1].Amount.Equal(decimal.NewFromInt(20)), "got %s", sweeps[1].Amount)
+}
+
+func TestBalanceRule_OnlyRunsForItsAccount(t *testing.T) {
+	now := time.Now()
+	svc, accountService, accounts := newBalanceRuleTest(t, &now)
+	_, err := svc.CreateBalanceRule(boundedRule(40, 50))
+	require.NoError(t, err)
+
+	require.NoError(t, accountService.Transfer(3, 2, decimal.NewFromInt(10)))
+	ran, err := svc.RunTouched()
+	require.NoError(t, err)
+	assert.Zero(t, ran, "transfers of the counterparty alone do not run the rule")
+	requireAccountBalance(t, accounts, 1, 30)
+}
+
+func TestBalanceRule_RecordsFailedSweep(t *testing.T) {
+	now := time.Now()
+	svc, accountService, accounts := newBalanceRuleTest(t, &now)
+	rule, err := svc.CreateBalanceRule(boundedRule(500, 1000))
+	require.NoError(t, err)
+
+	require.NoError(t, accountService.Transfer(3, 1, decimal.NewFromInt(1)))
+	ran, err := svc.RunTouched()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 1, 31)
+	requireAccountBalance(t, accounts, 2, 100)
+
+	sweeps, err := svc.ListSweeps(rule.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, sweeps, 1)
+	assert.Equal(t, model.TransferFailed, sweeps[0].Status)
+	assert.Equal(t, "insufficient_funds", sweeps[0].ErrorCode)
+	assert.True(t, sweeps[0].Amount.Equal(decimal.NewFromInt(469)), "got %s", sweeps[0].Amount)
+}
+
+func TestBalanceRule_NeverDebitsClearingAccount(t *testing.T) {
+	now := time.Now()
+	svc, accountService, accounts := newBalanceRuleTest(t, &now)
+	require.NoError(t, accounts.(db.AccountTypePort).CreateTypedAccount(model.Account{AccountID: 90, Type: model.AccountAsset}))
+	rule := boundedRule(50, 1000)
+	rule.CounterpartyAccountID = 90
+	created, err := svc.CreateBalanceRule(rule)
+	require.NoError(t, err)
+
+	require.NoError(t, accountService.Transfer(1, 3, decimal.NewFromInt(1)))
+	_, err = svc.RunTouched()
+	require.NoError(t, err)
+	requireAccountBalance(t, accounts, 1, 29)
+	requireAccountBalance(t, accounts, 90, 0)
+	sweeps, err := svc.ListSweeps(created.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, sweeps, 1)
+	assert.Equal(t, "system_account_source", sweeps[0].ErrorCode)
+}
+
+// failingFinishSweepRepository fails the first FinishRuleSweep with an error
+// that is not a domain error
+type failingFinishSweepRepository struct {
+	db.BalanceRuleRepositoryPort
+	failed bool
+}
+
+func (r *failingFinishSweepRepository) FinishRuleSweep(tx db.TransactionPort, id int64, status model.TransferStatus, errorCode string) error {
+	if !r.failed {
+		r.failed = true
+		return errors.New("connection reset")
+	}
+	return r.BalanceRuleRepositoryPort.FinishRuleSweep(tx, id, status, errorCode)
+}
+
+func TestBalanceRule_FailedFinishRollsBackSweep(t *testing.T) {
+	now := time.Now()
+	svc, accountService, accounts := newBalanceRuleTest(t, &now)
+	svc.rules = &failingFinishSweepRepository{BalanceRuleRepositoryPort: svc.rules}
+	rule, err := svc.CreateBalanceRule(boundedRule(10, 20))
+	require.NoError(t, err)
+
+	require.NoError(t, accountService.Transfer(3, 1, decimal.NewFromInt(1)))
+	ran, err := svc.RunTouched()
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+	requireAccountBalance(t, accounts, 1, 31)
+	requireAccountBalance(t, accounts, 2, 100)
+	sweeps, err := svc.ListSweeps(rule.ID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, sweeps)
+
+	// Nothing was recorded, so the next transfer sweeps the whole excess once
+	require.NoError(t, accountService.Transfer(3, 1, decimal.NewFromInt(1)))
+	ran, err = svc.RunTouched()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 1, 20)
+	requireAccountBalance(t, accounts, 2, 112)
+	sweeps, err = svc.ListSweeps(rule.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, sweeps, 1)
+	assert.Equal(t, model.TransferCompleted, sweeps[0].Status)
+
+	// The sweep does not trigger the rule again
+	ran, err = svc.RunTouched()
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+}
+
+// racingSweepRepository starts a transfer when a sweep starts, between the
+// balance check and the move
+type racingSweepRepository struct {
+	db.BalanceRuleRepositoryPort
+	race func()
+}
+
+func (r *racingSweepRepository) StartRuleSweep(tx db.TransactionPort, sweep model.BalanceRuleSweep) (model.BalanceRuleSweep, error) {
+	if race := r.race; race != nil {
+		r.race = nil
+		race()
+	}
+	return r.BalanceRuleRepositoryPort.StartRuleSweep(tx, sweep)
+}
+
+func TestBalanceRule_SweepHoldsAccountUntilMoved(t *testing.T) {
+	now := time.Now()
+	svc, accountService, accounts := newBalanceRuleTest(t, &now)
+	done := make(chan error, 1)
+	svc.rules = &racingSweepRepository{BalanceRuleRepositoryPort: svc.rules, race: func() {
+		go func() { done <- accountService.Transfer(1, 3, decimal.NewFromInt(25)) }()
+		time.Sleep(30 * time.Millisecond)
+	}}
+	rule, err := svc.CreateBalanceRule(boundedRule(10, 20))
+	require.NoError(t, err)
+
+	require.NoError(t, accountService.Transfer(3, 1, decimal.NewFromInt(1)))
+	ran, err := svc.RunTouched()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+
+	// The transfer waited for the sweep, which moved the excess of 31
+	assert.ErrorIs(t, <-done, model.ErrInsufficientFunds)
+	requireAccountBalance(t, accounts, 1, 20)
+	requireAccountBalance(t, accounts, 2, 111)
+	sweeps, err := svc.ListSweeps(rule.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, sweeps, 1)
+	assert.Equal(t, model.TransferCompleted, sweeps[0].Status)
+	assert.True(t, sweeps[0].Amount.Equal(decimal.NewFromInt(11)), "got %s", sweeps[0].Amount)
+}
+
+func TestBalanceRule_Scheduled(t *testing.T) {
+	// Schedules are anchored at the real creation day, so the clock runs ahead of it
+	now := time.Now().UTC().Truncate(time.Hour).Add(24 * time.Hour)
+	svc, accountService, accounts := newBalanceRuleTest(t, &now)
+	rule := boundedRule(40, 50)
+	rule.AfterTransfer = false
+	rule.Schedule = "every 1h"
+	created, err := svc.CreateBalanceRule(rule)
+	require.NoError(t, err)
+	require.NotNil(t, created.NextRunAt)
+	assert.True(t, created.NextRunAt.Equal(now.Add(time.Hour)), "got %v", created.NextRunAt)
+
+	require.NoError(t, accountService.Transfer(3, 1, decimal.NewFromInt(1)))
+	ran, err := svc.RunTouched()
+	require.NoError(t, err)
+	assert.Zero(t, ran, "scheduled rules do not run after transfers")
+	ran, err = svc.RunDue()
+	require.NoError(t, err)
+	assert.Zero(t, ran, "the rule is not due yet")
+
+	// Missed runs are skipped
+	now = now.Add(3*time.Hour + time.Minute)
+	ran, err = svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 1, 40)
+	got, err := svc.GetBalanceRule(created.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.NextRunAt)
+	assert.True(t, got.NextRunAt.Equal(now.Truncate(time.Hour).Add(time.Hour)), "got %v", got.NextRunAt)
+	sweeps, err := svc.ListSweeps(created.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, sweeps, 1)
+	assert.Equal(t, model.BalanceRuleScheduled, sweeps[0].Trigger)
+
+	// A disabled rule has no next run
+	rule.ID = created.ID
+	rule.Enabled = false
+	updated, err := svc.UpdateBalanceRule(rule)
+	require.NoError(t, err)
+	assert.Nil(t, updated.NextRunAt)
+	now = now.Add(24 * time.Hour)
+	ran, err = svc.RunDue()
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+}
+
+func TestBalanceRule_SkipsRulesLockedByAnotherWorker(t *testing.T) {
+	now := time.Now()
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	rules := db.NewMemoryBalanceRuleRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(30)))
+	require.NoError(t, accounts.CreateAccount(2, decimal.NewFromInt(100)))
+	accountService := NewAccountService(accounts)
+	svc := NewBalanceRuleService(accountService, rules, 0, nil)
+	svc.now = func() time.Time { return now }
+	rule, err := svc.CreateBalanceRule(boundedRule(0, 20))
+	require.NoError(t, err)
+
+	unlock, locked, err := rules.LockBalanceRule(rule.ID)
+	require.NoError(t, err)
+	require.True(t, locked)
+	require.NoError(t, accountService.Transfer(2, 1, decimal.NewFromInt(1)))
+	ran, err := svc.RunTouched()
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+	requireAccountBalance(t, accounts, 1, 31)
+	unlock()
+}
+
+func TestBalanceRule_Validation(t *testing.T) {
+	now := time.Now()
+	svc, _, _ := newBalanceRuleTest(t, &now)
+
+	negative := decimal.NewFromInt(-1)
+	precise := decimal.RequireFromString("10.000000001")
+	testCases := []struct {
+		name   string
+		modify func(*model.BalanceRule)
+		want   error
+	}{
+		{"InvalidAccount", func(r *model.BalanceRule) { r.AccountID = 0 }, model.ErrAccountIDMustBePositive},
+		{"SameAccount", func(r *model.BalanceRule) { r.CounterpartyAccountID = 1 }, model.ErrSourceAndDestinationMustDiffer},
+		{"SystemAccount", func(r *model.BalanceRule) { r.CounterpartyAccountID = model.SuspenseAccountID }, model.ErrSystemAccountNotAllowed},
+		{"NoBounds", func(r *model.BalanceRule) { r.Min, r.Max = nil, nil }, model.ErrInvalidBalanceRule},
+		{"NegativeBound", func(r *model.BalanceRule) { r.Min = &negative }, model.ErrInvalidBalanceRule},
+		{"MinAboveMax", func(r *model.BalanceRule) { r.Min, r.Max = r.Max, r.Min }, model.ErrInvalidBalanceRule},
+		{"TooPrecise", func(r *model.BalanceRule) { r.Max = &precise }, model.ErrPrecisionTooHigh},
+		{"NoTrigger", func(r *model.BalanceRule) { r.AfterTransfer = false }, model.ErrInvalidBalanceRule},
+		{"InvalidSchedule", func(r *model.BalanceRule) { r.Schedule = "fortnightly" }, model.ErrInvalidSchedule},
+		{"UnknownAccount", func(r *model.BalanceRule) { r.AccountID = 42 }, model.ErrAccountNotFound},
+		{"UnknownCounterparty", func(r *model.BalanceRule) { r.CounterpartyAccountID = 42 }, model.ErrAccountNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := boundedRule(10, 50)
+			tc.modify(&rule)
+			_, err := svc.CreateBalanceRule(rule)
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+
+	_, err := svc.GetBalanceRule(0)
+	assert.ErrorIs(t, err, model.ErrBalanceRuleIDMustBePositive)
+	_, err = svc.UpdateBalanceRule(boundedRule(10, 50))
+	assert.ErrorIs(t, err, model.ErrBalanceRuleIDMustBePositive)
+	assert.ErrorIs(t, svc.DeleteBalanceRule(42), model.ErrBalanceRuleNotFound)
+	_, err = svc.ListSweeps(42, 0)
+	assert.ErrorIs(t, err, model.ErrBalanceRuleNotFound)
+}
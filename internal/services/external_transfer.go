@@ -0,0 +1,219 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+)
+
+// MaxExternalTransfersPage is the largest number of deposits or withdrawals listed at once
+const MaxExternalTransfersPage = 1000
+
+// ExternalTransferServicePort defines the service interface for deposits and withdrawals
+//
+//go:generate mockgen -destination=../mocks/mock_external_transfer_service.go -package=mocks internal-transfers/internal/services ExternalTransferServicePort
+type ExternalTransferServicePort interface {
+	CreateExternalTransfer(t model.ExternalTransfer) (model.ExternalTransfer, error)
+	GetExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error)
+	ListExternalTransfers(kind model.ExternalTransferKind, accountID int64, limit int) ([]model.ExternalTransfer, error)
+	SettleExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error)
+	FailExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error)
+}
+
+// ExternalTransferService moves money into and out of the system through
+// clearing accounts, which stand for the funds held outside it. They are
+// assets, so they may go negative.
+//
+// A deposit is recorded as pending and credits its account from the clearing
+// account only when it settles, so the funds cannot be spent before the
+// outside party confirms them. A withdrawal debits its account into the
+// clearing account right away, so the funds cannot be spent twice, and
+// returns them if it fails. Funds move with the transactional path of the
+// AccountService, in the same transaction as the status change, and its
+// observers are told about them.
+type ExternalTransferService struct {
+	accounts  *AccountService
+	transfers db.ExternalTransferRepositoryPort
+	// clearing are the clearing account ids; the first is the default one
+	clearing []int64
+}
+
+func NewExternalTransferService(accounts *AccountService, transfers db.ExternalTransferRepositoryPort, clearingAccountIDs []int64) *ExternalTransferService {
+	return &ExternalTransferService{accounts: accounts, transfers: transfers, clearing: clearingAccountIDs}
+}
+
+// OpenClearingAccounts creates the clearing accounts that do not exist yet as
+// assets, which may go negative, and fails if an existing one cannot be a
+// clearing account. It must be called before deposits and withdrawals are
+// made.
+func (s *ExternalTransferService) OpenClearingAccounts() error {
+	types, ok := s.accounts.repo.(db.AccountTypePort)
+	if !ok {
+		return model.ErrClearingAccountsUnsupported
+	}
+	for _, id := range s.clearing {
+		if err := validateAccountID(id); err != nil {
+			return fmt.Errorf("clearing account %d: %w", id, err)
+		}
+		if err := types.OpenClearingAccount(id); err != nil {
+			return fmt.Errorf("open clearing account %d: %w", id, err)
+		}
+	}
+	log.Printf("Clearing accounts open: %v", s.clearing)
+	return nil
+}
+
+// CreateExternalTransfer validates and records a deposit or withdrawal. A
+// withdrawal debits its account in the same transaction.
+func (s *ExternalTransferService) CreateExternalTransfer(t model.ExternalTransfer) (model.ExternalTransfer, error) {
+	if err := s.validate(&t); err != nil {
+		log.Printf("Create %s validation failed: %v", t.Kind, err)
+		return model.ExternalTransfer{}, err
+	}
+
+	var created model.ExternalTransfer
+	err := s.accounts.inTx(func(txn db.TransactionPort) error {
+		var err error
+		if created, err = s.transfers.CreateExternalTransfer(txn, t); err != nil {
+			return err
+		}
+		if t.Kind != model.Withdrawal {
+			return nil
+		}
+		err = s.accounts.transferInTx(txn, t.AccountID, t.ClearingAccountID, t.Amount, clientSource)
+		if errors.Is(err, model.ErrSourceAccountNotFound) {
+			return model.ErrAccountNotFound
+		}
+		return err
+	})
+	if err != nil {
+		if model.ErrorCode(err) == "" && !errors.Is(err, model.ErrDuplicateExternalReference) {
+			log.Printf("Create %s error: %v", t.Kind, err)
+		}
+		return model.ExternalTransfer{}, err
+	}
+	if created.Kind == model.Withdrawal {
+		s.accounts.committed(created.AccountID, created.ClearingAccountID)
+	}
+	log.Printf("%s %d created: account %d, clearing account %d, amount: %v",
+		created.Kind, created.ID, created.AccountID, created.ClearingAccountID, created.Amount)
+	return created, nil
+}
+
+// GetExternalTransfer returns a deposit or withdrawal
+func (s *ExternalTransferService) GetExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error) {
+	if id <= 0 {
+		return model.ExternalTransfer{}, model.ErrExternalTransferIDMustBePositive
+	}
+	t, err := s.transfers.GetExternalTransfer(kind, id)
+	if err != nil && !errors.Is(err, model.ErrExternalTransferNotFound) {
+		log.Printf("GetExternalTransfer db error: %v", err)
+	}
+	return t, err
+}
+
+// ListExternalTransfers returns up to limit deposits or withdrawals, newest
+// first, optionally of a single account
+func (s *ExternalTransferService) ListExternalTransfers(kind model.ExternalTransferKind, accountID int64, limit int) ([]model.ExternalTransfer, error) {
+	if accountID < 0 {
+		return nil, model.ErrAccountIDMustBePositive
+	}
+	if limit <= 0 || limit > MaxExternalTransfersPage {
+		limit = MaxExternalTransfersPage
+	}
+	transfers, err := s.transfers.ListExternalTransfers(kind, accountID, limit)
+	if err != nil {
+		log.Printf("ListExternalTransfers db error: %v", err)
+	}
+	return transfers, err
+}
+
+// SettleExternalTransfer confirms a pending deposit or withdrawal. A deposit
+// credits its account from the clearing account; a withdrawal was debited
+// when it was made. Settling a settled one returns it unchanged.
+func (s *ExternalTransferService) SettleExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error) {
+	return s.finish(kind, id, model.ExternalTransferSettled)
+}
+
+// FailExternalTransfer rejects a pending deposit or withdrawal. A deposit
+// never moved any funds; a withdrawal returns them to its account. Failing a
+// failed one returns it unchanged.
+func (s *ExternalTransferService) FailExternalTransfer(kind model.ExternalTransferKind, id int64) (model.ExternalTransfer, error) {
+	return s.finish(kind, id, model.ExternalTransferFailed)
+}
+
+// finish moves a pending deposit or withdrawal to status, crediting its
+// account from the clearing account when a deposit settles or a withdrawal fails
+func (s *ExternalTransferService) finish(kind model.ExternalTransferKind, id int64, status model.ExternalTransferStatus) (model.ExternalTransfer, error) {
+	if id <= 0 {
+		return model.ExternalTransfer{}, model.ErrExternalTransferIDMustBePositive
+	}
+
+	var finished model.ExternalTransfer
+	credited := false
+	err := s.accounts.inTx(func(txn db.TransactionPort) error {
+		t, err := s.transfers.LockExternalTransfer(txn, kind, id)
+		if err != nil {
+			return err
+		}
+		if t.Status == status {
+			finished = t
+			return nil
+		}
+		if t.Status != model.ExternalTransferPending {
+			return model.ErrExternalTransferNotPending
+		}
+		if (kind == model.Deposit) == (status == model.ExternalTransferSettled) {
+			if err := s.accounts.transferInTx(txn, t.ClearingAccountID, t.AccountID, t.Amount, systemSource); err != nil {
+				if errors.Is(err, model.ErrDestinationAccountNotFound) {
+					return model.ErrAccountNotFound
+				}
+				return err
+			}
+			credited = true
+		}
+		finished, err = s.transfers.SetExternalTransferStatus(txn, id, status)
+		return err
+	})
+	if err != nil {
+		if model.ErrorCode(err) == "" && !errors.Is(err, model.ErrExternalTransferNotFound) && !errors.Is(err, model.ErrExternalTransferNotPending) {
+			log.Printf("Finish %s %d error: %v", kind, id, err)
+		}
+		return model.ExternalTransfer{}, err
+	}
+	if credited {
+		s.accounts.committed(finished.ClearingAccountID, finished.AccountID)
+	}
+	log.Printf("%s %d %s", kind, id, finished.Status)
+	return finished, nil
+}
+
+// validate checks a new deposit or withdrawal, defaulting its clearing account
+func (s *ExternalTransferService) validate(t *model.ExternalTransfer) error {
+	if !t.Kind.Valid() {
+		return fmt.Errorf("unknown external transfer kind %q", t.Kind)
+	}
+	if err := validateAccountID(t.AccountID); err != nil {
+		return err
+	}
+	if slices.Contains(s.clearing, t.AccountID) {
+		return model.ErrClearingAccountNotAllowed
+	}
+	if err := validateClientAccounts(t.AccountID); err != nil {
+		return err
+	}
+	if t.ClearingAccountID == 0 && len(s.clearing) > 0 {
+		t.ClearingAccountID = s.clearing[0]
+	}
+	if !slices.Contains(s.clearing, t.ClearingAccountID) {
+		return model.ErrUnknownClearingAccount
+	}
+	if !t.Amount.IsPositive() {
+		return model.ErrAmountMustBePositive
+	}
+	return s.accounts.validateDecimalPrecision(t.Amount)
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"testing"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newExternalTransferTest returns a service with clearing accounts 90 and 91,
+// account 1 holding 100 and account 2 none
+func newExternalTransferTest(t *testing.T) (*ExternalTransferService, *AccountService, db.AccountRepositoryPort) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, accounts.CreateAccount(2, decimal.Zero))
+	require.NoError(t, accounts.CreateTypedAccount(model.Account{AccountID: 91, Balance: decimal.NewFromInt(7), Type: model.AccountAsset}))
+	svc := NewAccountService(accounts, WithMaxPrecision(2))
+	external := NewExternalTransferService(svc, db.NewMemoryExternalTransferRepository(store), []int64{90, 91})
+	require.NoError(t, external.OpenClearingAccounts())
+	return external, svc, accounts
+}
+
+func TestOpenClearingAccounts(t *testing.T) {
+	_, _, accounts := newExternalTransferTest(t)
+	requireAccountBalance(t, accounts, 90, 0)
+	requireAccountBalance(t, accounts, 91, 7)
+
+	store := db.NewMemoryStore()
+	repo := db.NewMemoryAccountRepository(store)
+	svc := NewAccountService(repo)
+	err := NewExternalTransferService(svc, nil, []int64{0}).OpenClearingAccounts()
+	assert.ErrorIs(t, err, model.ErrAccountIDMustBePositive)
+	assert.NoError(t, NewExternalTransferService(svc, nil, []int64{model.ClearingAccountID}).OpenClearingAccounts())
+	assert.ErrorIs(t, NewExternalTransferService(svc, nil, []int64{model.SuspenseAccountID}).OpenClearingAccounts(), model.ErrClearingAccountInUse)
+
+	// An existing account is never turned into a clearing account
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+	err = NewExternalTransferService(svc, nil, []int64{1}).OpenClearingAccounts()
+	assert.ErrorIs(t, err, model.ErrClearingAccountInUse)
+	requireAccountBalance(t, repo, 1, 100)
+
+	require.NoError(t, repo.CreateTypedAccount(model.Account{AccountID: 2, Type: model.AccountAsset}))
+	_, err = db.NewMemoryTransferRepository(store).CreateTransfer(model.Transfer{
+		SourceAccountID: 2, DestinationAccountID: 1, Amount: decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+	assert.NoError(t, NewExternalTransferService(svc, nil, []int64{2}).OpenClearingAccounts(), "an asset stays usable whatever its transfers")
+}
+
+func TestDeposit_SpendableOnceSettled(t *testing.T) {
+	external, svc, accounts := newExternalTransferTest(t)
+	var committed [][2]int64
+	svc.OnTransferCommitted(func(sourceID, destID int64) { committed = append(committed, [2]int64{sourceID, destID}) })
+
+	deposit, err := external.CreateExternalTransfer(model.ExternalTransfer{Kind: model.Deposit, AccountID: 2, Amount: decimal.NewFromInt(40)})
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferPending, deposit.Status)
+	assert.Equal(t, int64(90), deposit.ClearingAccountID, "the first clearing account is the default")
+	requireAccountBalance(t, accounts, 2, 0)
+	assert.ErrorIs(t, svc.Transfer(2, 1, decimal.NewFromInt(10)), model.ErrInsufficientFunds, "pending deposits are not spendable")
+
+	settled, err := external.SettleExternalTransfer(model.Deposit, deposit.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferSettled, settled.Status)
+	requireAccountBalance(t, accounts, 2, 40)
+	requireAccountBalance(t, accounts, 90, -40)
+	assert.Equal(t, [][2]int64{{90, 2}}, committed)
+	require.NoError(t, svc.Transfer(2, 1, decimal.NewFromInt(10)))
+
+	again, err := external.SettleExternalTransfer(model.Deposit, deposit.ID)
+	require.NoError(t, err, "settling twice is a no-op")
+	assert.Equal(t, model.ExternalTransferSettled, again.Status)
+	requireAccountBalance(t, accounts, 2, 30)
+	_, err = external.FailExternalTransfer(model.Deposit, deposit.ID)
+	assert.ErrorIs(t, err, model.ErrExternalTransferNotPending)
+
+	failed, err := external.CreateExternalTransfer(model.ExternalTransfer{Kind: model.Deposit, AccountID: 2, ClearingAccountID: 91, Amount: decimal.NewFromInt(5)})
+	require.NoError(t, err)
+	failed, err = external.FailExternalTransfer(model.Deposit, failed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferFailed, failed.Status)
+	requireAccountBalance(t, accounts, 2, 30)
+	requireAccountBalance(t, accounts, 91, 7)
+	_, err = external.SettleExternalTransfer(model.Deposit, failed.ID)
+	assert.ErrorIs(t, err, model.ErrExternalTransferNotPending)
+}
+
+func TestWithdrawal_DebitedUntilFailed(t *testing.T) {
+	external, svc, accounts := newExternalTransferTest(t)
+
+	withdrawal, err := external.CreateExternalTransfer(model.ExternalTransfer{Kind: model.Withdrawal, AccountID: 1, Amount: decimal.NewFromInt(60)})
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferPending, withdrawal.Status)
+	requireAccountBalance(t, accounts, 1, 40)
+	requireAccountBalance(t, accounts, 90, 60)
+	assert.ErrorIs(t, svc.Transfer(1, 2, decimal.NewFromInt(50)), model.ErrInsufficientFunds, "pending withdrawals are not spendable")
+
+	_, err = external.CreateExternalTransfer(model.ExternalTransfer{Kind: model.Withdrawal, AccountID: 1, Amount: decimal.NewFromInt(41)})
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	list, err := external.ListExternalTransfers(model.Withdrawal, 1, 10)
+	require.NoError(t, err)
+	assert.Len(t, list, 1, "a withdrawal without funds is not recorded")
+
+	// Only the withdrawal can take its funds back out of the clearing account
+	assert.ErrorIs(t, svc.Transfer(90, 2, decimal.NewFromInt(60)), model.ErrSystemAccountSource)
+	failed, err := external.FailExternalTransfer(model.Withdrawal, withdrawal.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferFailed, failed.Status)
+	requireAccountBalance(t, accounts, 1, 100)
+	requireAccountBalance(t, accounts, 90, 0)
+
+	settled, err := external.CreateExternalTransfer(model.ExternalTransfer{Kind: model.Withdrawal, AccountID: 1, Amount: decimal.NewFromInt(30)})
+	require.NoError(t, err)
+	settled, err = external.SettleExternalTransfer(model.Withdrawal, settled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ExternalTransferSettled, settled.Status)
+	requireAccountBalance(t, accounts, 1, 70)
+	requireAccountBalance(t, accounts, 90, 30)
+
+	_, err = external.SettleExternalTransfer(model.Deposit, settled.ID)
+	assert.ErrorIs(t, err, model.ErrExternalTransferNotFound, "withdrawals are not deposits")
+}
+
+func TestExternalTransfer_Validation(t *testing.T) {
+	external, _, _ := newExternalTransferTest(t)
+	deposit := func(accountID, clearingAccountID int64, amount string) error {
+		_, err := external.CreateExternalTransfer(model.ExternalTransfer{
+			Kind: model.Deposit, AccountID: accountID, ClearingAccountID: clearingAccountID, Amount: decimal.RequireFromString(amount),
+		})
+		return err
+	}
+
+	assert.ErrorIs(t, deposit(0, 0, "10"), model.ErrAccountIDMustBePositive)
+	assert.ErrorIs(t, deposit(1, 0, "0"), model.ErrAmountMustBePositive)
+	assert.ErrorIs(t, deposit(1, 0, "0.001"), model.ErrPrecisionTooHigh)
+	assert.ErrorIs(t, deposit(1, 2, "10"), model.ErrUnknownClearingAccount)
+	assert.ErrorIs(t, deposit(91, 90, "10"), model.ErrClearingAccountNotAllowed)
+	assert.ErrorIs(t, deposit(model.FeesAccountID, 0, "10"), model.ErrSystemAccountNotAllowed)
+	assert.ErrorIs(t, deposit(404, 0, "10"), model.ErrAccountNotFound)
+
+	_, err := external.CreateExternalTransfer(model.ExternalTransfer{Kind: model.Deposit, AccountID: 1, Amount: decimal.NewFromInt(5), ClientID: "acme", ExternalReference: "wire-1"})
+	require.NoError(t, err)
+	_, err = external.CreateExternalTransfer(model.ExternalTransfer{Kind: model.Deposit, AccountID: 1, Amount: decimal.NewFromInt(5), ClientID: "acme", ExternalReference: "wire-1"})
+	assert.ErrorIs(t, err, model.ErrDuplicateExternalReference)
+
+	_, err = external.GetExternalTransfer(model.Deposit, 0)
+	assert.ErrorIs(t, err, model.ErrExternalTransferIDMustBePositive)
+	_, err = external.SettleExternalTransfer(model.Deposit, 404)
+	assert.ErrorIs(t, err, model.ErrExternalTransferNotFound)
+}
+
+func TestClearingAccount_NotDebitedByClients(t *testing.T) {
+	svc, accounts, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+	require.NoError(t, accounts.(db.AccountTypePort).CreateTypedAccount(model.Account{AccountID: 90, Balance: decimal.NewFromInt(50), Type: model.AccountAsset}))
+
+	_, err := svc.BookTransfer(90, 2, decimal.NewFromInt(5), model.TransferDetails{Description: "refund"})
+	assert.ErrorIs(t, err, model.ErrSystemAccountSource)
+	_, err = svc.SplitTransfer(90, decimal.NewFromInt(5), []model.SplitShare{fixedShare(1, "2"), fixedShare(2, "3")}, model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrSystemAccountSource)
+	_, err = svc.SweepTransfer(2, []model.SweepSource{fixedSource(90, 5)}, model.SweepAtomic, model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrSystemAccountSource)
+	requireAccountBalance(t, accounts, 90, 50)
+	requireAccountBalance(t, accounts, 2, 0)
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// MaxFeeSchedulesPage is the largest number of fee schedules listed at once
+const MaxFeeSchedulesPage = 1000
+
+// FeeServicePort defines the service interface for fee schedules
+//
+//go:generate mockgen -destination=../mocks/mock_fee_service.go -package=mocks internal-transfers/internal/services FeeServicePort
+type FeeServicePort interface {
+	CreateSchedule(schedule model.FeeSchedule) (model.FeeSchedule, error)
+	GetSchedule(id int64) (model.FeeSchedule, error)
+	ListSchedules(limit int) ([]model.FeeSchedule, error)
+	DeleteSchedule(id int64) error
+}
+
+// FeeService manages the fee schedules charged by the AccountService built
+// with WithFees on the same repository.
+//
+// A client's transfers are charged by its own schedule, or by the default
+// schedule, the one without a client id, when it has none. The fee is
+// rounded to the money precision and credited to the fee account as a third
+// leg of the transfer, in the same transaction as its funds.
+type FeeService struct {
+	accounts  *AccountService
+	schedules db.FeeScheduleRepositoryPort
+}
+
+func NewFeeService(accounts *AccountService, schedules db.FeeScheduleRepositoryPort) *FeeService {
+	return &FeeService{accounts: accounts, schedules: schedules}
+}
+
+// CreateSchedule validates and stores a fee schedule
+func (s *FeeService) CreateSchedule(schedule model.FeeSchedule) (model.FeeSchedule, error) {
+	if err := s.validateSchedule(&schedule); err != nil {
+		return model.FeeSchedule{}, err
+	}
+	created, err := s.schedules.CreateFeeSchedule(schedule)
+	if err != nil {
+		if !errors.Is(err, model.ErrFeeScheduleExists) {
+			log.Printf("CreateFeeSchedule db error: %v", err)
+		}
+		return model.FeeSchedule{}, err
+	}
+	log.Printf("Fee schedule %d created: %s for client %q", created.ID, created.Kind, created.ClientID)
+	return created, nil
+}
+
+// GetSchedule returns a fee schedule
+func (s *FeeService) GetSchedule(id int64) (model.FeeSchedule, error) {
+	if id <= 0 {
+		return model.FeeSchedule{}, model.ErrFeeScheduleIDMustBePositive
+	}
+	schedule, err := s.schedules.GetFeeSchedule(id)
+	if err != nil && !errors.Is(err, model.ErrFeeScheduleNotFound) {
+		log.Printf("GetFeeSchedule db error: %v", err)
+	}
+	return schedule, err
+}
+
+// ListSchedules returns up to limit fee schedules in id order
+func (s *FeeService) ListSchedules(limit int) ([]model.FeeSchedule, error) {
+	if limit <= 0 || limit > MaxFeeSchedulesPage {
+		limit = MaxFeeSchedulesPage
+	}
+	schedules, err := s.schedules.ListFeeSchedules(limit)
+	if err != nil {
+		log.Printf("ListFeeSchedules db error: %v", err)
+	}
+	return schedules, err
+}
+
+// DeleteSchedule removes a fee schedule. The client's transfers are charged by
+// the default schedule from then on; transfers already charged keep their fees.
+func (s *FeeService) DeleteSchedule(id int64) error {
+	if id <= 0 {
+		return model.ErrFeeScheduleIDMustBePositive
+	}
+	err := s.schedules.DeleteFeeSchedule(id)
+	switch {
+	case err == nil:
+		log.Printf("Fee schedule %d deleted", id)
+	case errors.Is(err, model.ErrFeeScheduleNotFound):
+	default:
+		log.Printf("DeleteFeeSchedule db error: %v", err)
+	}
+	return err
+}
+
+// validateSchedule checks schedule and puts its tiers in ascending order
+func (s *FeeService) validateSchedule(schedule *model.FeeSchedule) error {
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	if schedule.Name == "" {
+		return fmt.Errorf("%w: name is required", model.ErrInvalidFeeSchedule)
+	}
+	if !schedule.Kind.Valid() {
+		return fmt.Errorf("%w: kind must be flat, percentage or tiered", model.ErrInvalidFeeSchedule)
+	}
+	if schedule.AccountType != "" && !schedule.AccountType.Valid() {
+		return fmt.Errorf("%w: %v", model.ErrInvalidFeeSchedule, model.ErrInvalidAccountType)
+	}
+	if (schedule.Kind == model.FeeTiered) != (len(schedule.Tiers) > 0) {
+		return fmt.Errorf("%w: tiered schedules and only they need tiers", model.ErrInvalidFeeSchedule)
+	}
+	if schedule.Flat.IsNegative() || schedule.MinFee.IsNegative() || schedule.MaxFee.IsNegative() {
+		return fmt.Errorf("%w: fees must not be negative", model.ErrInvalidFeeSchedule)
+	}
+	if schedule.MaxFee.IsPositive() && schedule.MaxFee.LessThan(schedule.MinFee) {
+		return fmt.Errorf("%w: max fee must not be less than the min fee", model.ErrInvalidFeeSchedule)
+	}
+	if err := validateFeeRate(schedule.Rate); err != nil {
+		return err
+	}
+	for _, d := range []decimal.Decimal{schedule.Flat, schedule.Rate, schedule.MinFee, schedule.MaxFee} {
+		if err := s.accounts.validateDecimalPrecision(d); err != nil {
+			return err
+		}
+	}
+
+	schedule.Tiers = slices.Clone(schedule.Tiers)
+	slices.SortFunc(schedule.Tiers, func(a, b model.FeeTier) int { return a.MinAmount.Cmp(b.MinAmount) })
+	for i, tier := range schedule.Tiers {
+		if tier.MinAmount.IsNegative() || tier.Flat.IsNegative() {
+			return fmt.Errorf("%w: tier amounts and fees must not be negative", model.ErrInvalidFeeSchedule)
+		}
+		if i > 0 && tier.MinAmount.Equal(schedule.Tiers[i-1].MinAmount) {
+			return fmt.Errorf("%w: tier minimum amounts must differ", model.ErrInvalidFeeSchedule)
+		}
+		if err := validateFeeRate(tier.Rate); err != nil {
+			return err
+		}
+		for _, d := range []decimal.Decimal{tier.MinAmount, tier.Flat, tier.Rate} {
+			if err := s.accounts.validateDecimalPrecision(d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateFeeRate checks that a rate is a fraction of the amount
+func validateFeeRate(rate decimal.Decimal) error {
+	if rate.IsNegative() || rate.GreaterThan(decimal.NewFromInt(1)) {
+		return fmt.Errorf("%w: rates must be between 0 and 1", model.ErrInvalidFeeSchedule)
+	}
+	return nil
+}
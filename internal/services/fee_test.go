@@ -0,0 +1,263 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFeeTest returns services charging fees to account 9, with account 1
+// holding 100 and account 2 none
+func newFeeTest(t *testing.T) (*FeeService, *AccountService, db.AccountRepositoryPort, db.TransferRepositoryPort) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	schedules := db.NewMemoryFeeScheduleRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, accounts.CreateAccount(2, decimal.Zero))
+	require.NoError(t, accounts.CreateAccount(9, decimal.Zero))
+	svc := NewAccountService(accounts, WithMaxPrecision(2), WithFees(schedules, 9))
+	return NewFeeService(svc, schedules), svc, accounts, db.NewMemoryTransferRepository(store)
+}
+
+func TestFeeSchedule_Fee(t *testing.T) {
+	tiered := model.FeeSchedule{
+		Kind:   model.FeeTiered,
+		MaxFee: decimal.NewFromInt(20),
+		Tiers: []model.FeeTier{
+			{MinAmount: decimal.Zero, Flat: decimal.NewFromInt(1)},
+			{MinAmount: decimal.NewFromInt(100), Flat: decimal.RequireFromString("0.5"), Rate: decimal.RequireFromString("0.005")},
+		},
+	}
+	percentage := model.FeeSchedule{
+		Kind:   model.FeePercentage,
+		Rate:   decimal.RequireFromString("0.015"),
+		MinFee: decimal.RequireFromString("0.3"),
+		MaxFee: decimal.NewFromInt(10),
+	}
+	testCases := []struct {
+		name     string
+		schedule model.FeeSchedule
+		amount   string
+		want     string
+	}{
+		{"flat", model.FeeSchedule{Kind: model.FeeFlat, Flat: decimal.RequireFromString("0.25")}, "1000", "0.25"},
+		{"percentage", percentage, "100", "1.5"},
+		{"percentage rounded", percentage, "33.33", "0.5"},
+		{"percentage min", percentage, "10", "0.3"},
+		{"percentage max", percentage, "5000", "10"},
+		{"first tier", tiered, "99.99", "1"},
+		{"second tier", tiered, "100", "1"},
+		{"second tier rate", tiered, "1000", "5.5"},
+		{"tier max", tiered, "10000", "20"},
+	}
+	for _, tc := range testCases {
+		got := tc.schedule.Fee(decimal.RequireFromString(tc.amount), 2)
+		assert.True(t, got.Equal(decimal.RequireFromString(tc.want)), "%s: want %s, got %s", tc.name, tc.want, got)
+	}
+}
+
+func TestTransferWithFee_Modes(t *testing.T) {
+	fees, svc, accounts, _ := newFeeTest(t)
+	_, err := fees.CreateSchedule(model.FeeSchedule{Name: "standard", Kind: model.FeePercentage, Rate: decimal.RequireFromString("0.1")})
+	require.NoError(t, err)
+
+	fee, err := svc.TransferWithFee(1, 2, decimal.NewFromInt(50), "", "")
+	require.NoError(t, err)
+	require.NotNil(t, fee)
+	assert.Equal(t, model.FeeOnTop, fee.Mode, "fees are added on top by default")
+	assert.Equal(t, int64(9), fee.AccountID)
+	assert.True(t, fee.Amount.Equal(decimal.NewFromInt(5)), "got %s", fee.Amount)
+	requireAccountBalance(t, accounts, 1, 45)
+	requireAccountBalance(t, accounts, 2, 50)
+	requireAccountBalance(t, accounts, 9, 5)
+
+	fee, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(40), "", model.FeeDeducted)
+	require.NoError(t, err)
+	require.NotNil(t, fee)
+	assert.True(t, fee.Amount.Equal(decimal.NewFromInt(4)), "got %s", fee.Amount)
+	requireAccountBalance(t, accounts, 1, 5)
+	requireAccountBalance(t, accounts, 2, 86)
+	requireAccountBalance(t, accounts, 9, 9)
+
+	// The fee counts against the balance of the source
+	_, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(5), "", model.FeeOnTop)
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	requireAccountBalance(t, accounts, 1, 5)
+	requireAccountBalance(t, accounts, 9, 9)
+
+	_, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(1), "", "sideways")
+	assert.ErrorIs(t, err, model.ErrInvalidFeeMode)
+
+	// Transfers to and from the fee account are not charged
+	fee, err = svc.TransferWithFee(9, 1, decimal.NewFromInt(9), "", "")
+	require.NoError(t, err)
+	assert.Nil(t, fee)
+	requireAccountBalance(t, accounts, 1, 14)
+}
+
+func TestTransferWithFee_SelectsClientSchedule(t *testing.T) {
+	fees, svc, accounts, _ := newFeeTest(t)
+
+	fee, err := svc.TransferWithFee(1, 2, decimal.NewFromInt(10), "acme", "")
+	require.NoError(t, err)
+	assert.Nil(t, fee, "nothing is charged without a schedule")
+
+	_, err = fees.CreateSchedule(model.FeeSchedule{Name: "default", Kind: model.FeeFlat, Flat: decimal.NewFromInt(2)})
+	require.NoError(t, err)
+	own, err := fees.CreateSchedule(model.FeeSchedule{Name: "acme", ClientID: "acme", Kind: model.FeeFlat, Flat: decimal.NewFromInt(1)})
+	require.NoError(t, err)
+
+	fee, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(10), "acme", "")
+	require.NoError(t, err)
+	require.NotNil(t, fee)
+	assert.Equal(t, own.ID, fee.ScheduleID)
+	assert.True(t, fee.Amount.Equal(decimal.NewFromInt(1)), "got %s", fee.Amount)
+	fee, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(10), "globex", "")
+	require.NoError(t, err)
+	require.NotNil(t, fee)
+	assert.True(t, fee.Amount.Equal(decimal.NewFromInt(2)), "got %s", fee.Amount)
+	requireAccountBalance(t, accounts, 9, 3)
+
+	// A deducted fee must leave something to credit
+	_, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(2), "globex", model.FeeDeducted)
+	assert.ErrorIs(t, err, model.ErrFeeExceedsAmount)
+
+	// Plain transfers are never charged
+	require.NoError(t, svc.Transfer(1, 2, decimal.NewFromInt(10)))
+	requireAccountBalance(t, accounts, 9, 3)
+}
+
+func TestTransferWithFee_SelectsAccountTypeSchedule(t *testing.T) {
+	fees, svc, accounts, _ := newFeeTest(t)
+	types := accounts.(db.AccountTypePort)
+	require.NoError(t, types.CreateTypedAccount(model.Account{AccountID: 3, Balance: decimal.NewFromInt(20), Type: model.AccountEquity}))
+
+	_, err := fees.CreateSchedule(model.FeeSchedule{Name: "default", Kind: model.FeeFlat, Flat: decimal.NewFromInt(2)})
+	require.NoError(t, err)
+	equity, err := fees.CreateSchedule(model.FeeSchedule{Name: "equity", AccountType: model.AccountEquity, Kind: model.FeeFlat, Flat: decimal.NewFromInt(1)})
+	require.NoError(t, err)
+
+	fee, err := svc.TransferWithFee(3, 2, decimal.NewFromInt(10), "acme", "")
+	require.NoError(t, err)
+	require.NotNil(t, fee)
+	assert.Equal(t, equity.ID, fee.ScheduleID, "the source account type picks the schedule")
+	requireAccountBalance(t, accounts, 3, 9)
+	fee, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(10), "acme", "")
+	require.NoError(t, err)
+	require.NotNil(t, fee)
+	assert.True(t, fee.Amount.Equal(decimal.NewFromInt(2)), "got %s", fee.Amount)
+
+	_, err = svc.TransferWithFee(404, 2, decimal.NewFromInt(10), "acme", "")
+	assert.ErrorIs(t, err, model.ErrSourceAccountNotFound)
+	_, err = fees.CreateSchedule(model.FeeSchedule{Name: "x", AccountType: "savings", Kind: model.FeeFlat})
+	assert.ErrorIs(t, err, model.ErrInvalidFeeSchedule)
+}
+
+func TestTransferWithFee_MissingFeeAccount(t *testing.T) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	schedules := db.NewMemoryFeeScheduleRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, accounts.CreateAccount(2, decimal.Zero))
+	svc := NewAccountService(accounts, WithFees(schedules, 9))
+	_, err := NewFeeService(svc, schedules).CreateSchedule(model.FeeSchedule{Name: "flat", Kind: model.FeeFlat, Flat: decimal.NewFromInt(1)})
+	require.NoError(t, err)
+
+	_, err = svc.TransferWithFee(1, 2, decimal.NewFromInt(10), "", "")
+	assert.ErrorIs(t, err, model.ErrFeeAccountNotFound)
+	requireAccountBalance(t, accounts, 1, 100)
+	requireAccountBalance(t, accounts, 2, 0)
+}
+
+func TestFeeService_Validation(t *testing.T) {
+	fees, _, _, _ := newFeeTest(t)
+	testCases := []struct {
+		name     string
+		schedule model.FeeSchedule
+		want     error
+	}{
+		{"no name", model.FeeSchedule{Kind: model.FeeFlat}, model.ErrInvalidFeeSchedule},
+		{"kind", model.FeeSchedule{Name: "x", Kind: "weekly"}, model.ErrInvalidFeeSchedule},
+		{"tiered without tiers", model.FeeSchedule{Name: "x", Kind: model.FeeTiered}, model.ErrInvalidFeeSchedule},
+		{"tiers of a flat schedule", model.FeeSchedule{Name: "x", Kind: model.FeeFlat, Tiers: []model.FeeTier{{}}}, model.ErrInvalidFeeSchedule},
+		{"negative fee", model.FeeSchedule{Name: "x", Kind: model.FeeFlat, Flat: decimal.NewFromInt(-1)}, model.ErrInvalidFeeSchedule},
+		{"max below min", model.FeeSchedule{Name: "x", Kind: model.FeeFlat, MinFee: decimal.NewFromInt(2), MaxFee: decimal.NewFromInt(1)}, model.ErrInvalidFeeSchedule},
+		{"rate above 1", model.FeeSchedule{Name: "x", Kind: model.FeePercentage, Rate: decimal.RequireFromString("1.5")}, model.ErrInvalidFeeSchedule},
+		{"precision", model.FeeSchedule{Name: "x", Kind: model.FeeFlat, Flat: decimal.RequireFromString("0.001")}, model.ErrPrecisionTooHigh},
+		{"duplicate tiers", model.FeeSchedule{Name: "x", Kind: model.FeeTiered, Tiers: []model.FeeTier{{}, {}}}, model.ErrInvalidFeeSchedule},
+	}
+	for _, tc := range testCases {
+		_, err := fees.CreateSchedule(tc.schedule)
+		assert.ErrorIs(t, err, tc.want, tc.name)
+	}
+
+	_, err := fees.GetSchedule(0)
+	assert.ErrorIs(t, err, model.ErrFeeScheduleIDMustBePositive)
+	assert.ErrorIs(t, fees.DeleteSchedule(42), model.ErrFeeScheduleNotFound)
+}
+
+func TestAsyncTransfer_ChargesFee(t *testing.T) {
+	fees, svc, accounts, transfers := newFeeTest(t)
+	_, err := fees.CreateSchedule(model.FeeSchedule{Name: "flat", Kind: model.FeeFlat, Flat: decimal.NewFromInt(2)})
+	require.NoError(t, err)
+	async := NewAsyncTransferService(svc, transfers, AsyncTransferOptions{})
+
+	booked, err := async.BookTransfer(1, 2, decimal.NewFromInt(20), model.TransferDetails{FeeMode: model.FeeDeducted})
+	require.NoError(t, err)
+	require.NotNil(t, booked.Fee)
+	assert.True(t, booked.Credited().Equal(decimal.NewFromInt(18)), "got %s", booked.Credited())
+	requireAccountBalance(t, accounts, 1, 80)
+	requireAccountBalance(t, accounts, 2, 18)
+	requireAccountBalance(t, accounts, 9, 2)
+
+	submitted, err := async.SubmitTransfer(1, 2, decimal.NewFromInt(10), model.TransferDetails{})
+	require.NoError(t, err)
+	require.NotNil(t, submitted.Fee, "the fee is quoted when the transfer is accepted")
+	_, err = async.ProcessBatch()
+	require.NoError(t, err)
+	got := requireStatus(t, transfers, submitted.ID, model.TransferCompleted)
+	require.NotNil(t, got.Fee)
+	assert.Equal(t, model.FeeOnTop, got.Fee.Mode)
+	requireAccountBalance(t, accounts, 1, 68)
+	requireAccountBalance(t, accounts, 2, 28)
+	requireAccountBalance(t, accounts, 9, 4)
+
+	// Reversals return what the destination was credited, not the fee
+	reversal, err := async.ReverseTransfer(booked.ID, decimal.Zero, time.Time{})
+	require.NoError(t, err)
+	assert.True(t, reversal.Amount.Equal(decimal.NewFromInt(18)), "got %s", reversal.Amount)
+	requireAccountBalance(t, accounts, 1, 86)
+	requireAccountBalance(t, accounts, 9, 4)
+}
+
+func TestQuoteTransfer_Fee(t *testing.T) {
+	fees, svc, accounts, _ := newFeeTest(t)
+	_, err := fees.CreateSchedule(model.FeeSchedule{Name: "flat", Kind: model.FeeFlat, Flat: decimal.NewFromInt(3)})
+	require.NoError(t, err)
+
+	quote, err := svc.QuoteTransfer(1, 2, decimal.NewFromInt(50), "", model.FeeDeducted)
+	require.NoError(t, err)
+	require.NotNil(t, quote.Fee)
+	assert.True(t, quote.Fee.Amount.Equal(decimal.NewFromInt(3)), "got %s", quote.Fee.Amount)
+	require.Len(t, quote.Balances, 3)
+	assert.True(t, quote.Balances[0].Balance.Equal(decimal.NewFromInt(50)), "got %s", quote.Balances[0].Balance)
+	assert.True(t, quote.Balances[1].Balance.Equal(decimal.NewFromInt(47)), "got %s", quote.Balances[1].Balance)
+	assert.Equal(t, int64(9), quote.Balances[2].AccountID)
+	assert.True(t, quote.Balances[2].Balance.Equal(decimal.NewFromInt(3)), "got %s", quote.Balances[2].Balance)
+	requireAccountBalance(t, accounts, 1, 100)
+	requireAccountBalance(t, accounts, 9, 0)
+
+	// The fee of a transfer the source cannot pay for is still quoted
+	quote, err = svc.QuoteTransfer(1, 2, decimal.NewFromInt(99), "", model.FeeOnTop)
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	require.NotNil(t, quote.Fee)
+	assert.True(t, quote.Fee.Amount.Equal(decimal.NewFromInt(3)), "got %s", quote.Fee.Amount)
+	_, err = svc.QuoteTransfer(1, 2, decimal.NewFromInt(3), "", model.FeeDeducted)
+	assert.ErrorIs(t, err, model.ErrFeeExceedsAmount)
+}
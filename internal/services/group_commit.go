@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// Group commit defaults
+const (
+	DefaultGroupCommitMaxBatch  = 256
+	DefaultGroupCommitMaxWait   = 5 * time.Millisecond
+	DefaultGroupCommitQueueSize = 4096
+)
+
+// GroupCommitOptions tunes the batching of GroupCommitService
+type GroupCommitOptions struct {
+	// MaxBatch is the largest number of transfers committed together
+	MaxBatch int
+	// MaxWait is how long the first transfer of a batch waits for others to join
+	MaxWait time.Duration
+	// QueueSize is the number of transfers that can wait for the worker
+	QueueSize int
+}
+
+// transferRequest is a queued transfer and the channel its result is sent on
+type transferRequest struct {
+	sourceID, destID int64
+	amount           decimal.Decimal
+	fee              *model.Fee
+	// create records the transfer before its funds move when it is not nil
+	create  func(txn db.TransactionPort) (model.Transfer, error)
+	created model.Transfer
+	result  chan error
+}
+
+// GroupCommitService is an AccountServicePort whose transfers are queued and
+// committed in batches by a single worker, one database transaction per batch.
+//
+// Each transfer runs inside its own savepoint, so a failing transfer is rolled
+// back alone and reports its own error while the rest of the batch commits.
+// Transfer returns once the batch holding the transfer has committed.
+// AsyncTransferService books synchronous transfers through the same batches.
+type GroupCommitService struct {
+	*AccountService
+	opts  GroupCommitOptions
+	queue chan *transferRequest
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+	finished chan struct{}
+}
+
+func NewGroupCommitService(service *AccountService, opts GroupCommitOptions) *GroupCommitService {
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = DefaultGroupCommitMaxBatch
+	}
+	if opts.MaxWait <= 0 {
+		opts.MaxWait = DefaultGroupCommitMaxWait
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultGroupCommitQueueSize
+	}
+	return &GroupCommitService{
+		AccountService: service,
+		opts:           opts,
+		queue:          make(chan *transferRequest, opts.QueueSize),
+		stopped:        make(chan struct{}),
+		finished:       make(chan struct{}),
+	}
+}
+
+// Transfer validates the transfer, queues it and waits for its batch to commit
+func (g *GroupCommitService) Transfer(sourceID, destID int64, amount decimal.Decimal) error {
+	if err := g.validateTransfer(sourceID, destID, amount); err != nil {
+		return err
+	}
+	return g.enqueue(&transferRequest{sourceID: sourceID, destID: destID, amount: amount})
+}
+
+// TransferWithFee validates the transfer, quotes its fee, queues it and waits
+// for its batch to commit
+func (g *GroupCommitService) TransferWithFee(sourceID, destID int64, amount decimal.Decimal, clientID string, mode model.FeeMode) (*model.Fee, error) {
+	if err := g.validateTransfer(sourceID, destID, amount); err != nil {
+		return nil, err
+	}
+	fee, err := g.quoteFee(sourceID, destID, amount, clientID, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.enqueue(&transferRequest{sourceID: sourceID, destID: destID, amount: amount, fee: fee}); err != nil {
+		return nil, err
+	}
+	return fee, nil
+}
+
+// book queues a validated transfer that create records in the batch
+// transaction and returns the record once the batch has committed
+func (g *GroupCommitService) book(transfer model.Transfer, create func(txn db.TransactionPort) (model.Transfer, error)) (model.Transfer, error) {
+	req := &transferRequest{
+		sourceID: transfer.SourceAccountID,
+		destID:   transfer.DestinationAccountID,
+		amount:   transfer.Amount,
+		fee:      transfer.Fee,
+		create:   create,
+	}
+	if err := g.enqueue(req); err != nil {
+		return model.Transfer{}, err
+	}
+	return req.created, nil
+}
+
+// enqueue queues a validated transfer and waits for its batch to commit
+func (g *GroupCommitService) enqueue(req *transferRequest) error {
+	req.result = make(chan error, 1)
+	select {
+	case g.queue <- req:
+	case <-g.stopped:
+		return model.ErrTransferQueueClosed
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-g.finished:
+		// The worker may have answered just before it finished
+		select {
+		case err := <-req.result:
+			return err
+		default:
+			return model.ErrTransferQueueClosed
+		}
+	}
+}
+
+// Run processes queued transfers until ctx is cancelled, then commits the
+// transfers still in the queue and stops
+func (g *GroupCommitService) Run(ctx context.Context) {
+	defer close(g.finished)
+	for {
+		select {
+		case <-ctx.Done():
+			g.stopOnce.Do(func() { close(g.stopped) })
+			for {
+				batch := g.drain(nil)
+				if len(batch) == 0 {
+					return
+				}
+				g.commitBatch(batch)
+			}
+		case req := <-g.queue:
+			g.commitBatch(g.collect(ctx, req))
+		}
+	}
+}
+
+// collect gathers transfers until the batch is full or MaxWait has passed
+func (g *GroupCommitService) collect(ctx context.Context, first *transferRequest) []*transferRequest {
+	batch := g.drain([]*transferRequest{first})
+	if len(batch) >= g.opts.MaxBatch {
+		return batch
+	}
+	timer := time.NewTimer(g.opts.MaxWait)
+	defer timer.Stop()
+	for len(batch) < g.opts.MaxBatch {
+		select {
+		case req := <-g.queue:
+			batch = append(batch, req)
+		case <-timer.C:
+			return batch
+		case <-ctx.Done():
+			return batch
+		}
+	}
+	return batch
+}
+
+// drain appends the transfers already waiting in the queue without blocking
+func (g *GroupCommitService) drain(batch []*transferRequest) []*transferRequest {
+	for len(batch) < g.opts.MaxBatch {
+		select {
+		case req := <-g.queue:
+			batch = append(batch, req)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// commitBatch runs the transfers in one transaction and answers every caller
+func (g *GroupCommitService) commitBatch(batch []*transferRequest) {
+	results := make([]error, len(batch))
+	err := g.runBatch(batch, results)
+	for i, req := range batch {
+		if err != nil && results[i] == nil {
+			// The transfer itself succeeded but its batch did not commit
+			results[i] = err
+		}
+		req.result <- results[i]
+	}
+}
+
+// runBatch executes the batch, recording the outcome of each transfer in
+// results, and returns an error when the batch as a whole failed
+func (g *GroupCommitService) runBatch(batch []*transferRequest, results []error) (err error) {
+	start := time.Now()
+	txn, err := g.repo.BeginTx()
+	if err != nil {
+		log.Printf("Group commit failed to begin transaction: %v", err)
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			txn.Rollback()
+			log.Printf("Group commit panic, transaction rolled back: %v", p)
+			err = fmt.Errorf("group commit panic: %v", p)
+		} else if err != nil {
+			txn.Rollback()
+		}
+	}()
+
+	savepoints, ok := txn.(db.SavepointPort)
+	if !ok {
+		// Without savepoints one failing transfer would undo the others
+		txn.Rollback()
+		for i, req := range batch {
+			if req.create == nil {
+				results[i] = g.transfer(req.sourceID, req.destID, req.amount, req.fee)
+				continue
+			}
+			if results[i] = g.inTx(func(txn db.TransactionPort) error { return g.runRequest(txn, req) }); results[i] == nil {
+				g.committed(req.sourceID, req.destID)
+			}
+		}
+		return nil
+	}
+
+	committed := 0
+	for i, req := range batch {
+		if err = savepoints.Savepoint("transfer"); err != nil {
+			return err
+		}
+		results[i] = g.runRequest(txn, req)
+		if results[i] != nil {
+			if err = savepoints.RollbackToSavepoint("transfer"); err != nil {
+				return err
+			}
+		} else {
+			committed++
+		}
+		if err = savepoints.ReleaseSavepoint("transfer"); err != nil {
+			return err
+		}
+	}
+
+	if err = txn.Commit(); err != nil {
+		log.Printf("Group commit failed: %v", err)
+		return err
+	}
+	for i, req := range batch {
+		if results[i] == nil {
+			g.committed(req.sourceID, req.destID)
+		}
+	}
+	log.Printf("Group commit: %d of %d transfer(s) committed in %v", committed, len(batch), time.Since(start))
+	return nil
+}
+
+// runRequest records the transfer when the request asks for it and moves its funds
+func (g *GroupCommitService) runRequest(txn db.TransactionPort, req *transferRequest) error {
+	if req.create != nil {
+		created, err := req.create(txn)
+		if err != nil {
+			return err
+		}
+		req.created = created
+	}
+	return g.transferWithFeeInTx(txn, req.sourceID, req.destID, req.amount, req.fee)
+}
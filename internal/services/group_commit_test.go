@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/mocks"
+	"internal-transfers/internal/model"
+
+	"github.com/golang/mock/gomock"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGroupCommitTest(t *testing.T, opts GroupCommitOptions) (*GroupCommitService, db.AccountRepositoryPort, context.CancelFunc) {
+	repo := db.NewMemoryAccountRepository(db.NewMemoryStore())
+	svc := NewGroupCommitService(NewAccountService(repo), opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	go svc.Run(ctx)
+	t.Cleanup(cancel)
+	return svc, repo, cancel
+}
+
+func TestGroupCommit_BatchesTransfers(t *testing.T) {
+	svc, repo, _ := newGroupCommitTest(t, GroupCommitOptions{MaxBatch: 8, MaxWait: 50 * time.Millisecond})
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, repo.CreateAccount(2, decimal.Zero))
+	require.NoError(t, repo.CreateAccount(3, decimal.NewFromInt(1)))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every fifth transfer fails; only that transfer is rolled back
+			if i%5 == 4 {
+				errs[i] = svc.Transfer(3, 2, decimal.NewFromInt(10))
+				return
+			}
+			errs[i] = svc.Transfer(1, 2, decimal.NewFromInt(1))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i%5 == 4 {
+			assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	balance, err := repo.GetAccountBalance(nil, 2)
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.NewFromInt(16)), "got %s", balance)
+}
+
+func TestGroupCommit_ValidatesBeforeQueueing(t *testing.T) {
+	svc, _, _ := newGroupCommitTest(t, GroupCommitOptions{})
+	assert.ErrorIs(t, svc.Transfer(1, 1, decimal.NewFromInt(1)), model.ErrSourceAndDestinationMustDiffer)
+	assert.ErrorIs(t, svc.Transfer(1, 2, decimal.Zero), model.ErrAmountMustBePositive)
+}
+
+func TestGroupCommit_RefusesTransfersAfterShutdown(t *testing.T) {
+	svc, repo, cancel := newGroupCommitTest(t, GroupCommitOptions{})
+	require.NoError(t, repo.CreateAccount(1, decimal.NewFromInt(10)))
+	require.NoError(t, repo.CreateAccount(2, decimal.Zero))
+	require.NoError(t, svc.Transfer(1, 2, decimal.NewFromInt(1)))
+
+	cancel()
+	<-svc.finished
+	assert.ErrorIs(t, svc.Transfer(1, 2, decimal.NewFromInt(1)), model.ErrTransferQueueClosed)
+}
+
+func TestGroupCommit_CommitFailureFailsBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := mocks.NewMockAccountRepositoryPort(ctrl)
+	tx := &savepointTx{MockTransactionPort: mocks.NewMockTransactionPort(ctrl)}
+	svc := NewGroupCommitService(NewAccountService(repo), GroupCommitOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.Run(ctx)
+
+	amount := decimal.NewFromInt(1)
+	repo.EXPECT().BeginTx().Return(tx, nil)
+	repo.EXPECT().GetAccountBalance(tx, int64(1)).Return(decimal.NewFromInt(5), nil)
+	repo.EXPECT().GetAccountBalance(tx, int64(2)).Return(decimal.Zero, nil)
+	repo.EXPECT().UpdateAccountBalance(tx, int64(1), amount.Neg()).Return(nil)
+	repo.EXPECT().UpdateAccountBalance(tx, int64(2), amount).Return(nil)
+	tx.EXPECT().Commit().Return(assert.AnError)
+	tx.EXPECT().Rollback()
+
+	assert.ErrorIs(t, svc.Transfer(1, 2, amount), assert.AnError)
+	assert.Equal(t, []string{"save transfer", "release transfer"}, tx.calls)
+}
+
+// savepointTx adds db.SavepointPort to the mock transaction
+type savepointTx struct {
+	*mocks.MockTransactionPort
+	calls []string
+}
+
+func (tx *savepointTx) Savepoint(name string) error {
+	tx.calls = append(tx.calls, "save "+name)
+	return nil
+}
+
+func (tx *savepointTx) RollbackToSavepoint(name string) error {
+	tx.calls = append(tx.calls, "rollback "+name)
+	return nil
+}
+
+func (tx *savepointTx) ReleaseSavepoint(name string) error {
+	tx.calls = append(tx.calls, "release "+name)
+	return nil
+}
+
+func TestGroupCommit_BooksTransfers(t *testing.T) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	transfers := db.NewMemoryTransferRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, accounts.CreateAccount(2, decimal.Zero))
+	require.NoError(t, accounts.CreateAccount(3, decimal.NewFromInt(1)))
+	service := NewAccountService(accounts)
+	group := NewGroupCommitService(service, GroupCommitOptions{MaxBatch: 8, MaxWait: 50 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go group.Run(ctx)
+	async := NewAsyncTransferService(service, transfers, AsyncTransferOptions{GroupCommit: group})
+
+	var wg sync.WaitGroup
+	booked := make([]model.Transfer, 10)
+	errs := make([]error, len(booked))
+	for i := range booked {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			details := model.TransferDetails{ExternalReference: fmt.Sprintf("pay_%d", i)}
+			// Every fifth transfer fails; it is neither applied nor recorded
+			if i%5 == 4 {
+				booked[i], errs[i] = async.BookTransfer(3, 2, decimal.NewFromInt(10), details)
+				return
+			}
+			booked[i], errs[i] = async.BookTransfer(1, 2, decimal.NewFromInt(1), details)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		ref := fmt.Sprintf("pay_%d", i)
+		if i%5 == 4 {
+			assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+			_, err = transfers.GetTransferByReference("", ref)
+			assert.ErrorIs(t, err, model.ErrTransferNotFound)
+			continue
+		}
+		require.NoError(t, err)
+		stored, err := transfers.GetTransfer(booked[i].ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.TransferCompleted, stored.Status)
+		assert.Equal(t, ref, stored.ExternalReference)
+	}
+	balance, err := accounts.GetAccountBalance(nil, 2)
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.NewFromInt(8)), "got %s", balance)
+}
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"internal-transfers/internal/calendar"
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// Defaults for the interest worker
+const (
+	DefaultInterestInterval  = time.Hour
+	DefaultInterestBatchSize = 100
+	DefaultInterestDayCount  = 365
+)
+
+// MaxInterestPage is the largest number of interest products, accruals or postings listed at once
+const MaxInterestPage = 1000
+
+// InterestServicePort defines the service interface for interest products
+//
+//go:generate mockgen -destination=../mocks/mock_interest_service.go -package=mocks internal-transfers/internal/services InterestServicePort
+type InterestServicePort interface {
+	CreateProduct(p model.InterestProduct) (model.InterestProduct, error)
+	GetProduct(id int64) (model.InterestProduct, error)
+	ListProducts(limit int) ([]model.InterestProduct, error)
+	SetAccountProduct(accountID, productID int64) (model.AccountInterest, error)
+	GetAccountInterest(accountID int64) (model.AccountInterest, error)
+	ListAccruals(accountID int64, limit int) ([]model.InterestAccrual, error)
+	ListPostings(accountID int64, limit int) ([]model.InterestPosting, error)
+}
+
+// InterestService manages interest products and accrues and posts interest.
+//
+// Days are calendar days in the time zone of the calendar. Once a day has
+// ended, the worker accrues it for each account with a product: one accrual
+// row of the product's daily interest on the balance of that day, plus the
+// interest accrued but not posted yet for compound products, kept at
+// model.InterestPlaces. Every run of the worker snapshots the balances of the
+// current day, so the snapshot of a day is its end-of-day balance up to the
+// transfers of its last interval. A day without a run accrues on the snapshot
+// of the day before; days before any snapshot accrue on the balance read when
+// they are accrued.
+//
+// Once a month has ended and its last day is accrued, the unposted accruals
+// of the account are posted by one transfer from the house account, recorded
+// as a posting in the same transaction as the funds move. Only the money
+// precision is transferred; the rounding residual is carried into the next
+// posting. A posting that fails, for instance because the house account is
+// short of funds, releases its accruals to the next month's posting. Like
+// standing orders, an account is processed by one replica at a time under a
+// per-account lock.
+type InterestService struct {
+	accounts       *AccountService
+	interest       db.InterestRepositoryPort
+	calendar       *calendar.Calendar
+	houseAccountID int64
+	interval       time.Duration
+	batchSize      int
+	now            func() time.Time
+}
+
+// NewInterestService returns the service posting interest from houseAccountID.
+// The worker runs every interval; a zero interval never runs it. A nil cal is
+// calendar.Default().
+func NewInterestService(accounts *AccountService, interest db.InterestRepositoryPort, houseAccountID int64, interval time.Duration, cal *calendar.Calendar) *InterestService {
+	if cal == nil {
+		cal = calendar.Default()
+	}
+	return &InterestService{
+		accounts:       accounts,
+		interest:       interest,
+		calendar:       cal,
+		houseAccountID: houseAccountID,
+		interval:       interval,
+		batchSize:      DefaultInterestBatchSize,
+		now:            time.Now,
+	}
+}
+
+// CreateProduct validates and stores an interest product
+func (s *InterestService) CreateProduct(p model.InterestProduct) (model.InterestProduct, error) {
+	if err := s.validateProduct(&p); err != nil {
+		return model.InterestProduct{}, err
+	}
+	created, err := s.interest.CreateInterestProduct(p)
+	if err != nil {
+		log.Printf("CreateInterestProduct db error: %v", err)
+		return model.InterestProduct{}, err
+	}
+	log.Printf("Interest product %d created: %s, %d tiers", created.ID, created.Method, len(created.Tiers))
+	return created, nil
+}
+
+// GetProduct returns an interest product
+func (s *InterestService) GetProduct(id int64) (model.InterestProduct, error) {
+	if id <= 0 {
+		return model.InterestProduct{}, model.ErrProductIDMustBePositive
+	}
+	p, err := s.interest.GetInterestProduct(id)
+	if err != nil && !errors.Is(err, model.ErrInterestProductNotFound) {
+		log.Printf("GetInterestProduct db error: %v", err)
+	}
+	return p, err
+}
+
+// ListProducts returns up to limit interest products in id order
+func (s *InterestService) ListProducts(limit int) ([]model.InterestProduct, error) {
+	products, err := s.interest.ListInterestProducts(interestPageSize(limit))
+	if err != nil {
+		log.Printf("ListInterestProducts db error: %v", err)
+	}
+	return products, err
+}
+
+// SetAccountProduct makes an account accrue a product from today on, or stop
+// accruing when productID is 0. Changing products applies from the first day
+// not accrued yet. Interest accrued before stopping is still posted.
+func (s *InterestService) SetAccountProduct(accountID, productID int64) (model.AccountInterest, error) {
+	if _, err := s.accounts.GetAccount(accountID); err != nil {
+		return model.AccountInterest{}, err
+	}
+	if productID < 0 {
+		return model.AccountInterest{}, model.ErrProductIDMustBePositive
+	}
+	if productID == 0 {
+		if _, err := s.GetAccountInterest(accountID); err != nil {
+			return model.AccountInterest{}, err
+		}
+	}
+	ai, err := s.interest.SetAccountInterest(accountID, productID, s.today())
+	if err != nil {
+		if !errors.Is(err, model.ErrInterestProductNotFound) && !errors.Is(err, model.ErrAccountNotFound) {
+			log.Printf("SetAccountInterest db error: %v", err)
+		}
+		return model.AccountInterest{}, err
+	}
+	log.Printf("Account %d interest product set to %d", accountID, productID)
+	return ai, nil
+}
+
+// GetAccountInterest returns the interest state of an account
+func (s *InterestService) GetAccountInterest(accountID int64) (model.AccountInterest, error) {
+	if err := validateAccountID(accountID); err != nil {
+		return model.AccountInterest{}, err
+	}
+	ai, err := s.interest.GetAccountInterest(accountID)
+	if err != nil && !errors.Is(err, model.ErrInterestNotAssigned) {
+		log.Printf("GetAccountInterest db error: %v", err)
+	}
+	return ai, err
+}
+
+// ListAccruals returns up to limit accruals of an account, most recent first
+func (s *InterestService) ListAccruals(accountID int64, limit int) ([]model.InterestAccrual, error) {
+	if _, err := s.accounts.GetAccount(accountID); err != nil {
+		return nil, err
+	}
+	accruals, err := s.interest.ListInterestAccruals(accountID, interestPageSize(limit))
+	if err != nil {
+		log.Printf("ListInterestAccruals db error: %v", err)
+	}
+	return accruals, err
+}
+
+// ListPostings returns up to limit interest postings of an account, most recent first
+func (s *InterestService) ListPostings(accountID int64, limit int) ([]model.InterestPosting, error) {
+	if _, err := s.accounts.GetAccount(accountID); err != nil {
+		return nil, err
+	}
+	postings, err := s.interest.ListInterestPostings(accountID, interestPageSize(limit))
+	if err != nil {
+		log.Printf("ListInterestPostings db error: %v", err)
+	}
+	return postings, err
+}
+
+func interestPageSize(limit int) int {
+	if limit <= 0 || limit > MaxInterestPage {
+		return MaxInterestPage
+	}
+	return limit
+}
+
+// validateProduct checks p and puts its tiers in ascending order
+func (s *InterestService) validateProduct(p *model.InterestProduct) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is required", model.ErrInvalidInterestProduct)
+	}
+	if !p.Method.Valid() {
+		return fmt.Errorf("%w: method must be simple or compound", model.ErrInvalidInterestProduct)
+	}
+	if p.DayCount == 0 {
+		p.DayCount = DefaultInterestDayCount
+	}
+	if p.DayCount != 360 && p.DayCount != 365 {
+		return fmt.Errorf("%w: day count must be 360 or 365", model.ErrInvalidInterestProduct)
+	}
+	if len(p.Tiers) == 0 {
+		return fmt.Errorf("%w: at least one tier is required", model.ErrInvalidInterestProduct)
+	}
+
+	p.Tiers = slices.Clone(p.Tiers)
+	slices.SortFunc(p.Tiers, func(a, b model.InterestTier) int { return a.MinBalance.Cmp(b.MinBalance) })
+	for i, tier := range p.Tiers {
+		if tier.MinBalance.IsNegative() {
+			return fmt.Errorf("%w: tier minimum balances must not be negative", model.ErrInvalidInterestProduct)
+		}
+		if i > 0 && tier.MinBalance.Equal(p.Tiers[i-1].MinBalance) {
+			return fmt.Errorf("%w: tier minimum balances must differ", model.ErrInvalidInterestProduct)
+		}
+		if tier.Rate.IsNegative() || tier.Rate.GreaterThan(decimal.NewFromInt(1)) {
+			return fmt.Errorf("%w: rates must be between 0 and 1", model.ErrInvalidInterestProduct)
+		}
+		if err := s.accounts.validateDecimalPrecision(tier.MinBalance); err != nil {
+			return err
+		}
+		if err := s.accounts.validateDecimalPrecision(tier.Rate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run accrues the days that ended and posts the months that ended every
+// interval until ctx is cancelled
+func (s *InterestService) Run(ctx context.Context) {
+	if s.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// A failed snapshot leaves the day to the snapshot of the day before
+			_ = s.SnapshotBalances()
+			// Keep going while there is work beyond one batch
+			for ctx.Err() == nil {
+				if n, err := s.RunAccruals(); err != nil || n == 0 {
+					break
+				}
+			}
+			for ctx.Err() == nil {
+				if n, err := s.RunPostings(); err != nil || n == 0 {
+					break
+				}
+			}
+		}
+	}
+}
+
+// today returns the current calendar day as a date at UTC midnight
+func (s *InterestService) today() time.Time {
+	local := s.now().In(s.calendar.Location())
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// SnapshotBalances records the balances of the accounts with a product as
+// their balances of the current day
+func (s *InterestService) SnapshotBalances() error {
+	n, err := s.interest.SnapshotBalances(s.today())
+	if err != nil {
+		log.Printf("Interest worker failed to snapshot balances: %v", err)
+		return err
+	}
+	log.Printf("Interest worker recorded the balances of %d accounts", n)
+	return nil
+}
+
+// RunAccruals accrues the ended days of up to one batch of accounts,
+// returning how many accounts accrued
+func (s *InterestService) RunAccruals() (int, error) {
+	lastEnded := s.today().AddDate(0, 0, -1)
+	due, err := s.interest.DueAccruals(lastEnded, s.batchSize)
+	if err != nil {
+		log.Printf("Interest worker failed to list due accruals: %v", err)
+		return 0, err
+	}
+	ran := 0
+	for _, accountID := range due {
+		ok, err := s.accrue(accountID, lastEnded)
+		if err != nil {
+			log.Printf("Interest accrual of account %d failed, retrying on the next run: %v", accountID, err)
+		}
+		if ok {
+			ran++
+		}
+	}
+	return ran, nil
+}
+
+// accrue accrues the days of an account up to lastEnded, unless another
+// worker holds its lock or it no longer accrues
+func (s *InterestService) accrue(accountID int64, lastEnded time.Time) (bool, error) {
+	unlock, locked, err := s.interest.LockAccountInterest(accountID)
+	if err != nil || !locked {
+		return false, err
+	}
+	defer unlock()
+
+	// Re-read under the lock: the account may have changed or accrued meanwhile
+	ai, err := s.interest.GetAccountInterest(accountID)
+	if err != nil {
+		return false, err
+	}
+	if ai.ProductID == 0 || ai.NextAccrualDay.After(lastEnded) {
+		return false, nil
+	}
+	product, err := s.interest.GetInterestProduct(ai.ProductID)
+	if err != nil {
+		return false, err
+	}
+	account, err := s.accounts.GetAccount(accountID)
+	if err != nil {
+		return false, err
+	}
+	// The snapshot of the day before covers a next day without one
+	snapshots, err := s.interest.BalanceSnapshots(accountID, ai.NextAccrualDay.AddDate(0, 0, -1), lastEnded)
+	if err != nil {
+		return false, err
+	}
+
+	accrued := ai.Accrued
+	balance := account.Balance
+	for day := ai.NextAccrualDay; !day.After(lastEnded); day = day.AddDate(0, 0, 1) {
+		for len(snapshots) > 0 && !snapshots[0].Day.After(day) {
+			balance, snapshots = snapshots[0].Balance, snapshots[1:]
+		}
+		base := balance
+		if product.Method == model.InterestCompound {
+			base = base.Add(accrued)
+		}
+		amount := product.DailyInterest(base)
+		err := s.interest.AccrueInterest(model.InterestAccrual{
+			AccountID: accountID,
+			Day:       day,
+			ProductID: product.ID,
+			Base:      base,
+			Amount:    amount,
+		})
+		if errors.Is(err, db.ErrAccrualConflict) {
+			// The product changed meanwhile; the next run accrues the rest
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		accrued = accrued.Add(amount)
+	}
+	return true, nil
+}
+
+// RunPostings posts the interest of the last ended month for up to one batch
+// of accounts, returning how many postings were made
+func (s *InterestService) RunPostings() (int, error) {
+	today := s.today()
+	periodStart := time.Date(today.Year(), today.Month()-1, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := time.Date(today.Year(), today.Month(), 0, 0, 0, 0, 0, time.UTC)
+	due, err := s.interest.DuePostings(periodEnd, s.batchSize)
+	if err != nil {
+		log.Printf("Interest worker failed to list due postings: %v", err)
+		return 0, err
+	}
+	ran := 0
+	for _, accountID := range due {
+		ok, err := s.post(accountID, periodStart, periodEnd)
+		if err != nil {
+			log.Printf("Interest posting of account %d failed, retrying on the next run: %v", accountID, err)
+		}
+		if ok {
+			ran++
+		}
+	}
+	return ran, nil
+}
+
+// post transfers the unposted interest of an account up to periodEnd, unless
+// another worker holds its lock or posted it meanwhile
+func (s *InterestService) post(accountID int64, periodStart, periodEnd time.Time) (bool, error) {
+	unlock, locked, err := s.interest.LockAccountInterest(accountID)
+	if err != nil || !locked {
+		return false, err
+	}
+	defer unlock()
+
+	var posting model.InterestPosting
+	var amount, residual decimal.Decimal
+	start := func(txn db.TransactionPort) error {
+		var err error
+		if posting, err = s.interest.StartInterestPosting(txn, accountID, periodStart, periodEnd); err != nil {
+			return err
+		}
+		total := posting.Accrued.Add(posting.CarriedResidual)
+		amount = total.Truncate(s.accounts.maxPrecision)
+		residual = total.Sub(amount)
+		return nil
+	}
+	err = s.accounts.inTx(func(txn db.TransactionPort) error {
+		if err := start(txn); err != nil {
+			return err
+		}
+		if amount.IsPositive() {
+			if err := s.accounts.transferInTx(txn, s.houseAccountID, accountID, amount, systemSource); err != nil {
+				return err
+			}
+		}
+		return s.interest.FinishInterestPosting(txn, posting.ID, model.TransferCompleted, "", amount, residual)
+	})
+	if errors.Is(err, db.ErrPostingExists) {
+		return false, nil
+	}
+	code := model.ErrorCode(err)
+	if err != nil && code == "" {
+		// Nothing was recorded, so the posting runs again
+		return false, err
+	}
+	if code != "" {
+		// Everything was rolled back; record the failure on its own
+		err = s.accounts.inTx(func(txn db.TransactionPort) error {
+			if err := start(txn); err != nil {
+				return err
+			}
+			return s.interest.FinishInterestPosting(txn, posting.ID, model.TransferFailed, code, amount, residual)
+		})
+		if err != nil {
+			return false, err
+		}
+	} else if amount.IsPositive() {
+		s.accounts.committed(s.houseAccountID, accountID)
+	}
+
+	if code != "" {
+		log.Printf("Interest posting %d of %v to account %d failed: %s", posting.ID, amount, accountID, code)
+	} else {
+		log.Printf("Interest posting %d paid %v to account %d, residual %v", posting.ID, amount, accountID, residual)
+	}
+	return true, nil
+}
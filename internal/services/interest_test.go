@@ -0,0 +1,358 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newInterestTest returns a service whose clock is read from *now, with
+// account 1 holding 1000 and the house account 9 holding house
+func newInterestTest(t *testing.T, now *time.Time, house int64) (*InterestService, db.AccountRepositoryPort) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(1000)))
+	require.NoError(t, accounts.CreateAccount(9, decimal.NewFromInt(house)))
+	svc := NewInterestService(NewAccountService(accounts), db.NewMemoryInterestRepository(store), 9, 0, nil)
+	svc.now = func() time.Time { return *now }
+	return svc, accounts
+}
+
+// flatProduct pays rate on the whole balance
+func flatProduct(method model.InterestMethod, rate string) model.InterestProduct {
+	return model.InterestProduct{
+		Name:   "savings",
+		Method: method,
+		Tiers:  []model.InterestTier{{MinBalance: decimal.Zero, Rate: decimal.RequireFromString(rate)}},
+	}
+}
+
+func requireBalance(t *testing.T, repo db.AccountRepositoryPort, accountID int64, want decimal.Decimal) {
+	t.Helper()
+	balance, err := repo.GetAccountBalance(nil, accountID)
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(want), "account %d: want %s, got %s", accountID, want, balance)
+}
+
+func TestInterestProduct_DailyInterestIsTiered(t *testing.T) {
+	product := model.InterestProduct{
+		DayCount: 360,
+		Tiers: []model.InterestTier{
+			{MinBalance: decimal.Zero, Rate: decimal.RequireFromString("0.018")},
+			{MinBalance: decimal.NewFromInt(1000), Rate: decimal.RequireFromString("0.036")},
+			{MinBalance: decimal.NewFromInt(5000), Rate: decimal.RequireFromString("0.072")},
+		},
+	}
+	testCases := []struct {
+		base string
+		want string
+	}{
+		{"0", "0"},
+		{"500", "0.025"},
+		{"1000", "0.05"},
+		{"3000", "0.25"},
+		{"6000", "0.65"},
+		{"1", "0.00005"},
+		{"0.01", "0.0000005"},
+	}
+	for _, tc := range testCases {
+		got := product.DailyInterest(decimal.RequireFromString(tc.base))
+		assert.True(t, got.Equal(decimal.RequireFromString(tc.want)), "base %s: want %s, got %s", tc.base, tc.want, got)
+	}
+
+	// Interest is kept at high precision
+	product.DayCount = 365
+	got := product.DailyInterest(decimal.NewFromInt(100))
+	assert.Equal(t, "0.00493150684931506849", got.String())
+}
+
+func TestInterest_SimpleAccruesDailyAndPostsMonthly(t *testing.T) {
+	now := time.Date(2026, 1, 29, 12, 0, 0, 0, time.UTC)
+	svc, accounts := newInterestTest(t, &now, 100)
+	product, err := svc.CreateProduct(flatProduct(model.InterestSimple, "0.05"))
+	require.NoError(t, err)
+	assert.Equal(t, 365, product.DayCount, "the day count defaults to 365")
+	ai, err := svc.SetAccountProduct(1, product.ID)
+	require.NoError(t, err)
+	assert.True(t, ai.NextAccrualDay.Equal(time.Date(2026, 1, 29, 0, 0, 0, 0, time.UTC)))
+
+	n, err := svc.RunAccruals()
+	require.NoError(t, err)
+	assert.Zero(t, n, "today has not ended")
+
+	now = time.Date(2026, 2, 1, 0, 30, 0, 0, time.UTC)
+	n, err = svc.RunAccruals()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	daily := decimal.RequireFromString("0.13698630136986301370")
+	accruals, err := svc.ListAccruals(1, 0)
+	require.NoError(t, err)
+	require.Len(t, accruals, 3)
+	for _, a := range accruals {
+		assert.True(t, a.Base.Equal(decimal.NewFromInt(1000)), "simple interest accrues on the balance, got %s", a.Base)
+		assert.True(t, a.Amount.Equal(daily), "got %s", a.Amount)
+	}
+	assert.True(t, accruals[0].Day.Equal(time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)))
+
+	n, err = svc.RunPostings()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	requireBalance(t, accounts, 1, decimal.RequireFromString("1000.41095890"))
+	requireBalance(t, accounts, 9, decimal.RequireFromString("99.58904110"))
+
+	postings, err := svc.ListPostings(1, 0)
+	require.NoError(t, err)
+	require.Len(t, postings, 1)
+	posting := postings[0]
+	assert.Equal(t, model.TransferCompleted, posting.Status)
+	assert.True(t, posting.PeriodStart.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, posting.PeriodEnd.Equal(time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, posting.Accrued.Equal(daily.Mul(decimal.NewFromInt(3))), "got %s", posting.Accrued)
+	assert.True(t, posting.Amount.Equal(decimal.RequireFromString("0.41095890")), "got %s", posting.Amount)
+	assert.True(t, posting.Residual.Equal(decimal.RequireFromString("0.0000000041095890411")), "got %s", posting.Residual)
+
+	n, err = svc.RunPostings()
+	require.NoError(t, err)
+	assert.Zero(t, n, "the month is posted once")
+
+	// The residual is carried into the next posting
+	ai, err = svc.GetAccountInterest(1)
+	require.NoError(t, err)
+	assert.True(t, ai.Residual.Equal(posting.Residual))
+	assert.True(t, ai.Accrued.IsZero())
+	now = time.Date(2026, 3, 1, 0, 30, 0, 0, time.UTC)
+	_, err = svc.RunAccruals()
+	require.NoError(t, err)
+	_, err = svc.RunPostings()
+	require.NoError(t, err)
+	postings, err = svc.ListPostings(1, 0)
+	require.NoError(t, err)
+	require.Len(t, postings, 2)
+	assert.True(t, postings[0].CarriedResidual.Equal(posting.Residual))
+	assert.Equal(t, 28, len(mustAccruals(t, svc, postings[0].ID)))
+}
+
+// mustAccruals returns the accruals of account 1 paid by a posting
+func mustAccruals(t *testing.T, svc *InterestService, postingID int64) []model.InterestAccrual {
+	t.Helper()
+	accruals, err := svc.ListAccruals(1, 0)
+	require.NoError(t, err)
+	var paid []model.InterestAccrual
+	for _, a := range accruals {
+		if a.PostingID == postingID {
+			paid = append(paid, a)
+		}
+	}
+	return paid
+}
+
+func TestInterest_CompoundAccruesOnUnpostedInterest(t *testing.T) {
+	now := time.Date(2026, 1, 30, 12, 0, 0, 0, time.UTC)
+	svc, _ := newInterestTest(t, &now, 100)
+	product, err := svc.CreateProduct(flatProduct(model.InterestCompound, "0.365"))
+	require.NoError(t, err)
+	_, err = svc.SetAccountProduct(1, product.ID)
+	require.NoError(t, err)
+
+	now = now.AddDate(0, 0, 2)
+	_, err = svc.RunAccruals()
+	require.NoError(t, err)
+	accruals, err := svc.ListAccruals(1, 0)
+	require.NoError(t, err)
+	require.Len(t, accruals, 2)
+	assert.True(t, accruals[1].Amount.Equal(decimal.NewFromInt(1)), "got %s", accruals[1].Amount)
+	assert.True(t, accruals[0].Base.Equal(decimal.NewFromInt(1001)), "got %s", accruals[0].Base)
+	assert.True(t, accruals[0].Amount.Equal(decimal.RequireFromString("1.001")), "got %s", accruals[0].Amount)
+}
+
+func TestInterest_DaysAccrueOnTheirOwnSnapshots(t *testing.T) {
+	now := time.Date(2026, 1, 28, 12, 0, 0, 0, time.UTC)
+	svc, accounts := newInterestTest(t, &now, 1000)
+	transfers := NewAccountService(accounts)
+	product, err := svc.CreateProduct(flatProduct(model.InterestSimple, "0.365"))
+	require.NoError(t, err)
+	_, err = svc.SetAccountProduct(1, product.ID)
+	require.NoError(t, err)
+	require.NoError(t, svc.SnapshotBalances())
+
+	now = time.Date(2026, 1, 29, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, transfers.Transfer(9, 1, decimal.NewFromInt(1000)))
+	require.NoError(t, svc.SnapshotBalances())
+
+	// No run on the 30th, and the balance changed since the 29th
+	now = time.Date(2026, 1, 31, 0, 30, 0, 0, time.UTC)
+	require.NoError(t, transfers.Transfer(1, 9, decimal.NewFromInt(1500)))
+	require.NoError(t, svc.SnapshotBalances())
+	n, err := svc.RunAccruals()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	accruals, err := svc.ListAccruals(1, 0)
+	require.NoError(t, err)
+	require.Len(t, accruals, 3)
+	for i, want := range []int64{2000, 2000, 1000} {
+		assert.True(t, accruals[i].Base.Equal(decimal.NewFromInt(want)), "%v: want %d, got %s", accruals[i].Day, want, accruals[i].Base)
+	}
+}
+
+func TestInterest_FailedPostingRollsOver(t *testing.T) {
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	svc, accounts := newInterestTest(t, &now, 0)
+	product, err := svc.CreateProduct(flatProduct(model.InterestSimple, "0.365"))
+	require.NoError(t, err)
+	_, err = svc.SetAccountProduct(1, product.ID)
+	require.NoError(t, err)
+
+	now = time.Date(2026, 2, 1, 0, 30, 0, 0, time.UTC)
+	_, err = svc.RunAccruals()
+	require.NoError(t, err)
+	n, err := svc.RunPostings()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	postings, err := svc.ListPostings(1, 0)
+	require.NoError(t, err)
+	require.Len(t, postings, 1)
+	assert.Equal(t, model.TransferFailed, postings[0].Status)
+	assert.Equal(t, "insufficient_funds", postings[0].ErrorCode)
+	requireAccountBalance(t, accounts, 1, 1000)
+
+	// Stopping the product still posts what was accrued, with the next month
+	_, err = svc.SetAccountProduct(1, 0)
+	require.NoError(t, err)
+	require.NoError(t, accounts.CreateAccount(2, decimal.NewFromInt(100)))
+	require.NoError(t, NewAccountService(accounts).Transfer(2, 9, decimal.NewFromInt(100)))
+	now = time.Date(2026, 3, 1, 0, 30, 0, 0, time.UTC)
+	n, err = svc.RunAccruals()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = svc.RunPostings()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	requireAccountBalance(t, accounts, 1, 1001)
+	requireAccountBalance(t, accounts, 9, 99)
+	postings, err = svc.ListPostings(1, 0)
+	require.NoError(t, err)
+	require.Len(t, postings, 2)
+	assert.Equal(t, model.TransferCompleted, postings[0].Status)
+	assert.True(t, postings[0].PeriodStart.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+// failingFinishInterestRepository fails the first FinishInterestPosting with
+// an error that is not a domain error
+type failingFinishInterestRepository struct {
+	db.InterestRepositoryPort
+	failed bool
+}
+
+func (r *failingFinishInterestRepository) FinishInterestPosting(tx db.TransactionPort, id int64, status model.TransferStatus, errorCode string, amount, residual decimal.Decimal) error {
+	if !r.failed {
+		r.failed = true
+		return errors.New("connection reset")
+	}
+	return r.InterestRepositoryPort.FinishInterestPosting(tx, id, status, errorCode, amount, residual)
+}
+
+func TestInterest_FailedFinishRollsBackTransfer(t *testing.T) {
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	svc, accounts := newInterestTest(t, &now, 100)
+	svc.interest = &failingFinishInterestRepository{InterestRepositoryPort: svc.interest}
+	product, err := svc.CreateProduct(flatProduct(model.InterestSimple, "0.365"))
+	require.NoError(t, err)
+	_, err = svc.SetAccountProduct(1, product.ID)
+	require.NoError(t, err)
+
+	now = time.Date(2026, 2, 1, 0, 30, 0, 0, time.UTC)
+	_, err = svc.RunAccruals()
+	require.NoError(t, err)
+	n, err := svc.RunPostings()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	requireAccountBalance(t, accounts, 1, 1000)
+	postings, err := svc.ListPostings(1, 0)
+	require.NoError(t, err)
+	assert.Empty(t, postings)
+
+	// Nothing was recorded, so the next run pays the interest once
+	n, err = svc.RunPostings()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	requireAccountBalance(t, accounts, 1, 1001)
+	requireAccountBalance(t, accounts, 9, 99)
+	n, err = svc.RunPostings()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestInterest_SkipsAccountsLockedByAnotherWorker(t *testing.T) {
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	interest := db.NewMemoryInterestRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(1000)))
+	svc := NewInterestService(NewAccountService(accounts), interest, 9, 0, nil)
+	svc.now = func() time.Time { return now }
+	product, err := svc.CreateProduct(flatProduct(model.InterestSimple, "0.05"))
+	require.NoError(t, err)
+	_, err = svc.SetAccountProduct(1, product.ID)
+	require.NoError(t, err)
+
+	unlock, locked, err := interest.LockAccountInterest(1)
+	require.NoError(t, err)
+	require.True(t, locked)
+	now = now.AddDate(0, 0, 1)
+	n, err := svc.RunAccruals()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	unlock()
+}
+
+func TestInterest_Validation(t *testing.T) {
+	now := time.Now()
+	svc, _ := newInterestTest(t, &now, 100)
+
+	testCases := []struct {
+		name   string
+		modify func(*model.InterestProduct)
+		want   error
+	}{
+		{"NoName", func(p *model.InterestProduct) { p.Name = " " }, model.ErrInvalidInterestProduct},
+		{"InvalidMethod", func(p *model.InterestProduct) { p.Method = "continuous" }, model.ErrInvalidInterestProduct},
+		{"InvalidDayCount", func(p *model.InterestProduct) { p.DayCount = 366 }, model.ErrInvalidInterestProduct},
+		{"NoTiers", func(p *model.InterestProduct) { p.Tiers = nil }, model.ErrInvalidInterestProduct},
+		{"NegativeRate", func(p *model.InterestProduct) { p.Tiers[0].Rate = decimal.NewFromInt(-1) }, model.ErrInvalidInterestProduct},
+		{"RateAboveOne", func(p *model.InterestProduct) { p.Tiers[0].Rate = decimal.NewFromInt(2) }, model.ErrInvalidInterestProduct},
+		{"NegativeMinBalance", func(p *model.InterestProduct) { p.Tiers[0].MinBalance = decimal.NewFromInt(-1) }, model.ErrInvalidInterestProduct},
+		{"DuplicateTier", func(p *model.InterestProduct) { p.Tiers = append(p.Tiers, p.Tiers[0]) }, model.ErrInvalidInterestProduct},
+		{"TooPrecise", func(p *model.InterestProduct) { p.Tiers[0].Rate = decimal.RequireFromString("0.000000001") }, model.ErrPrecisionTooHigh},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := flatProduct(model.InterestSimple, "0.05")
+			tc.modify(&p)
+			_, err := svc.CreateProduct(p)
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+
+	_, err := svc.GetProduct(0)
+	assert.ErrorIs(t, err, model.ErrProductIDMustBePositive)
+	_, err = svc.GetProduct(42)
+	assert.ErrorIs(t, err, model.ErrInterestProductNotFound)
+	_, err = svc.SetAccountProduct(1, 42)
+	assert.ErrorIs(t, err, model.ErrInterestProductNotFound)
+	_, err = svc.SetAccountProduct(42, 1)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+	_, err = svc.SetAccountProduct(1, 0)
+	assert.ErrorIs(t, err, model.ErrInterestNotAssigned)
+	_, err = svc.GetAccountInterest(1)
+	assert.ErrorIs(t, err, model.ErrInterestNotAssigned)
+	_, err = svc.ListPostings(42, 0)
+	assert.ErrorIs(t, err, model.ErrAccountNotFound)
+}
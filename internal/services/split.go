@@ -0,0 +1,180 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// MaxSplitLegs is the largest number of destinations of one split
+const MaxSplitLegs = 100
+
+var hundred = decimal.NewFromInt(100)
+
+// SplitTransfer debits amount from the source and credits it to the
+// destinations of shares. The split is recorded as a completed parent transfer
+// without a destination, with one child leg per destination, and all of it is
+// booked in one transaction: either every leg moves its funds or none does.
+func (s *AsyncTransferService) SplitTransfer(sourceID int64, amount decimal.Decimal, shares []model.SplitShare, details model.TransferDetails) (model.Transfer, error) {
+	if err := validateAccountID(sourceID); err != nil {
+		log.Printf("SplitTransfer validation failed for sourceID: %v", err)
+		return model.Transfer{}, err
+	}
+	if err := validateClientAccounts(sourceID); err != nil {
+		log.Printf("SplitTransfer from system account: %d", sourceID)
+		return model.Transfer{}, err
+	}
+	if !amount.IsPositive() {
+		log.Printf("SplitTransfer with non-positive amount: %v", amount)
+		return model.Transfer{}, model.ErrAmountMustBePositive
+	}
+	if err := s.accounts.validateDecimalPrecision(amount); err != nil {
+		log.Printf("SplitTransfer amount precision error: %v", err)
+		return model.Transfer{}, err
+	}
+	if err := s.validateShares(sourceID, shares); err != nil {
+		log.Printf("SplitTransfer validation failed: %v", err)
+		return model.Transfer{}, err
+	}
+	amounts, err := allocateSplit(amount, shares, s.accounts.maxPrecision)
+	if err != nil {
+		log.Printf("SplitTransfer allocation failed: %v", err)
+		return model.Transfer{}, err
+	}
+	details, err = s.validateDetails(details)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+
+	var split model.Transfer
+	err = s.accounts.inTx(func(txn db.TransactionPort) error {
+		var err error
+		split, err = s.transfers.BookTransfer(txn, model.Transfer{SourceAccountID: sourceID, Amount: amount, Kind: model.TransferKindSplit, TransferDetails: details})
+		if err != nil {
+			return err
+		}
+		split.Legs = make([]model.Transfer, 0, len(shares))
+		for i, share := range shares {
+			leg, err := s.transfers.BookTransfer(txn, model.Transfer{SourceAccountID: sourceID, DestinationAccountID: share.DestinationAccountID, Amount: amounts[i], ParentID: &split.ID})
+			if err != nil {
+				return err
+			}
+			if err = s.accounts.transferInTx(txn, sourceID, share.DestinationAccountID, amounts[i], clientSource); err != nil {
+				return err
+			}
+			split.Legs = append(split.Legs, leg)
+		}
+		return nil
+	})
+	if err != nil {
+		if model.ErrorCode(err) == "" && !errors.Is(err, model.ErrDuplicateExternalReference) {
+			log.Printf("SplitTransfer db error: %v", err)
+		}
+		return model.Transfer{}, err
+	}
+	log.Printf("Transfer %d split: %d -> %d destinations, amount: %v", split.ID, sourceID, len(split.Legs), amount)
+	for _, leg := range split.Legs {
+		s.accounts.committed(leg.SourceAccountID, leg.DestinationAccountID)
+	}
+	return split, nil
+}
+
+// validateShares checks the destinations and the fixed amounts of a split
+func (s *AsyncTransferService) validateShares(sourceID int64, shares []model.SplitShare) error {
+	if len(shares) == 0 {
+		return fmt.Errorf("%w: at least one destination is required", model.ErrInvalidSplit)
+	}
+	if len(shares) > MaxSplitLegs {
+		return fmt.Errorf("%w: more than %d destinations", model.ErrInvalidSplit, MaxSplitLegs)
+	}
+	seen := make(map[int64]bool, len(shares))
+	for _, share := range shares {
+		if err := validateAccountID(share.DestinationAccountID); err != nil {
+			return err
+		}
+		if share.DestinationAccountID == sourceID {
+			return model.ErrSourceAndDestinationMustDiffer
+		}
+		if err := validateClientAccounts(share.DestinationAccountID); err != nil {
+			return err
+		}
+		if seen[share.DestinationAccountID] {
+			return fmt.Errorf("%w: destination %d is listed twice", model.ErrInvalidSplit, share.DestinationAccountID)
+		}
+		seen[share.DestinationAccountID] = true
+		if share.Amount.IsZero() == share.Percent.IsZero() {
+			return fmt.Errorf("%w: destination %d needs either an amount or a percent", model.ErrInvalidSplit, share.DestinationAccountID)
+		}
+		if share.Amount.IsNegative() || share.Percent.IsNegative() {
+			return model.ErrAmountMustBePositive
+		}
+		if err := s.accounts.validateDecimalPrecision(share.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocateSplit returns the amount of each share of total. Fixed amounts are
+// taken first; the rest is divided by percent, each share rounded down to
+// places, and the smallest units left over by rounding go one each to the
+// percent shares with the largest discarded fractions, earlier shares first
+// on ties. The amounts always add up to total exactly.
+func allocateSplit(total decimal.Decimal, shares []model.SplitShare, places int32) ([]decimal.Decimal, error) {
+	amounts := make([]decimal.Decimal, len(shares))
+	rest := total
+	percent := decimal.Zero
+	var byPercent []int
+	for i, share := range shares {
+		if share.Percent.IsZero() {
+			amounts[i] = share.Amount
+			rest = rest.Sub(share.Amount)
+			continue
+		}
+		percent = percent.Add(share.Percent)
+		byPercent = append(byPercent, i)
+	}
+	if rest.IsNegative() {
+		return nil, fmt.Errorf("%w: fixed amounts exceed the total", model.ErrInvalidSplit)
+	}
+	if len(byPercent) == 0 {
+		if !rest.IsZero() {
+			return nil, fmt.Errorf("%w: amounts must add up to the total", model.ErrInvalidSplit)
+		}
+		return amounts, nil
+	}
+	if !percent.Equal(hundred) {
+		return nil, fmt.Errorf("%w: percents must add up to 100", model.ErrInvalidSplit)
+	}
+
+	fractions := make([]decimal.Decimal, len(shares))
+	left := rest
+	for _, i := range byPercent {
+		exact := rest.Mul(shares[i].Percent).Shift(-2)
+		amounts[i] = exact.Truncate(places)
+		fractions[i] = exact.Sub(amounts[i])
+		left = left.Sub(amounts[i])
+	}
+	sort.SliceStable(byPercent, func(a, b int) bool {
+		return fractions[byPercent[a]].GreaterThan(fractions[byPercent[b]])
+	})
+	unit := decimal.New(1, -places)
+	for n := 0; left.IsPositive(); n++ {
+		i := byPercent[n]
+		amounts[i] = amounts[i].Add(unit)
+		left = left.Sub(unit)
+	}
+
+	for i, amount := range amounts {
+		if amount.IsZero() {
+			return nil, fmt.Errorf("%w: share of destination %d rounds to zero", model.ErrInvalidSplit, shares[i].DestinationAccountID)
+		}
+	}
+	return amounts, nil
+}
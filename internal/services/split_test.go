@@ -0,0 +1,128 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixedShare(dest int64, amount string) model.SplitShare {
+	return model.SplitShare{DestinationAccountID: dest, Amount: decimal.RequireFromString(amount)}
+}
+
+func percentShare(dest int64, percent string) model.SplitShare {
+	return model.SplitShare{DestinationAccountID: dest, Percent: decimal.RequireFromString(percent)}
+}
+
+func TestAllocateSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  string
+		shares []model.SplitShare
+		want   []string
+	}{
+		{"fixed amounts", "10", []model.SplitShare{fixedShare(2, "7.5"), fixedShare(3, "2.5")}, []string{"7.5", "2.5"}},
+		{"even percents", "10", []model.SplitShare{percentShare(2, "50"), percentShare(3, "50")}, []string{"5", "5"}},
+		{"thirds", "100", []model.SplitShare{percentShare(2, "33.34"), percentShare(3, "33.33"), percentShare(4, "33.33")}, []string{"33.34", "33.33", "33.33"}},
+		{"largest fraction first", "1", []model.SplitShare{percentShare(2, "33.3333"), percentShare(3, "33.3333"), percentShare(4, "33.3334")}, []string{"0.33", "0.33", "0.34"}},
+		{"ties in request order", "0.03", []model.SplitShare{percentShare(2, "50"), percentShare(3, "50")}, []string{"0.02", "0.01"}},
+		{"fixed then percent of the rest", "10.01", []model.SplitShare{fixedShare(2, "1"), percentShare(3, "50"), percentShare(4, "50")}, []string{"1", "4.51", "4.50"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			total := decimal.RequireFromString(tc.total)
+			amounts, err := allocateSplit(total, tc.shares, 2)
+			require.NoError(t, err)
+			sum := decimal.Zero
+			for i, want := range tc.want {
+				assert.True(t, amounts[i].Equal(decimal.RequireFromString(want)), "share %d: got %s, want %s", i, amounts[i], want)
+				sum = sum.Add(amounts[i])
+			}
+			assert.True(t, sum.Equal(total), "shares add up to %s", sum)
+		})
+	}
+}
+
+func TestAllocateSplit_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  string
+		shares []model.SplitShare
+	}{
+		{"fixed amounts exceed the total", "10", []model.SplitShare{fixedShare(2, "7"), fixedShare(3, "4")}},
+		{"fixed amounts short of the total", "10", []model.SplitShare{fixedShare(2, "7"), fixedShare(3, "2")}},
+		{"percents short of 100", "10", []model.SplitShare{percentShare(2, "50"), percentShare(3, "49")}},
+		{"nothing left for percents", "10", []model.SplitShare{fixedShare(2, "10"), percentShare(3, "100")}},
+		{"share rounds to zero", "0.01", []model.SplitShare{percentShare(2, "50"), percentShare(3, "50")}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := allocateSplit(decimal.RequireFromString(tc.total), tc.shares, 2)
+			assert.ErrorIs(t, err, model.ErrInvalidSplit)
+		})
+	}
+}
+
+func TestSplitTransfer(t *testing.T) {
+	svc, accounts, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+	require.NoError(t, accounts.CreateAccount(3, decimal.Zero))
+	details := model.TransferDetails{ClientID: "payroll", ExternalReference: "run_1"}
+
+	split, err := svc.SplitTransfer(1, decimal.NewFromInt(90), []model.SplitShare{fixedShare(2, "30"), percentShare(3, "100")}, details)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferKindSplit, split.Kind)
+	assert.Equal(t, model.TransferCompleted, split.Status)
+	require.Len(t, split.Legs, 2)
+	requireAccountBalance(t, accounts, 1, 10)
+	requireAccountBalance(t, accounts, 2, 30)
+	requireAccountBalance(t, accounts, 3, 60)
+
+	got, err := svc.GetTransfer(split.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Legs, 2)
+	for i, leg := range got.Legs {
+		require.NotNil(t, leg.ParentID)
+		assert.Equal(t, split.ID, *leg.ParentID)
+		assert.Equal(t, split.Legs[i].ID, leg.ID)
+	}
+	assert.Empty(t, got.Reversals)
+
+	// Legs are reversed one by one, the split itself is not
+	_, err = svc.ReverseTransfer(split.ID, decimal.Zero, time.Time{})
+	assert.ErrorIs(t, err, model.ErrTransferNotReversible)
+	_, err = svc.ReverseTransfer(got.Legs[0].ID, decimal.Zero, time.Time{})
+	require.NoError(t, err)
+	requireAccountBalance(t, accounts, 1, 40)
+}
+
+func TestSplitTransfer_Atomic(t *testing.T) {
+	svc, accounts, transfers := newAsyncTransferTest(t, AsyncTransferOptions{})
+	require.NoError(t, accounts.CreateAccount(3, decimal.Zero))
+	details := model.TransferDetails{ClientID: "payroll", ExternalReference: "run_1"}
+
+	// The first leg fits the balance, the second does not
+	_, err := svc.SplitTransfer(1, decimal.NewFromInt(150), []model.SplitShare{fixedShare(2, "80"), fixedShare(3, "70")}, details)
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	_, err = svc.SplitTransfer(1, decimal.NewFromInt(20), []model.SplitShare{fixedShare(2, "10"), fixedShare(4, "10")}, details)
+	assert.ErrorIs(t, err, model.ErrDestinationAccountNotFound)
+	requireAccountBalance(t, accounts, 1, 100)
+	requireAccountBalance(t, accounts, 2, 0)
+	_, err = transfers.GetTransferByReference("payroll", "run_1")
+	assert.ErrorIs(t, err, model.ErrTransferNotFound)
+
+	_, err = svc.SplitTransfer(1, decimal.NewFromInt(20), []model.SplitShare{fixedShare(2, "10"), fixedShare(2, "10")}, details)
+	assert.ErrorIs(t, err, model.ErrInvalidSplit)
+	_, err = svc.SplitTransfer(1, decimal.NewFromInt(20), []model.SplitShare{fixedShare(1, "20")}, details)
+	assert.ErrorIs(t, err, model.ErrSourceAndDestinationMustDiffer)
+	_, err = svc.SplitTransfer(1, decimal.NewFromInt(20), []model.SplitShare{{DestinationAccountID: 2}}, details)
+	assert.ErrorIs(t, err, model.ErrInvalidSplit)
+	_, err = svc.SplitTransfer(1, decimal.NewFromInt(20), nil, details)
+	assert.ErrorIs(t, err, model.ErrInvalidSplit)
+	_, err = svc.SplitTransfer(1, decimal.RequireFromString("0.000000001"), []model.SplitShare{percentShare(2, "100")}, details)
+	assert.ErrorIs(t, err, model.ErrPrecisionTooHigh)
+}
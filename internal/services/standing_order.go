@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"internal-transfers/internal/calendar"
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+	"internal-transfers/internal/schedule"
+)
+
+// Defaults for the standing order scheduler
+const (
+	DefaultStandingOrderInterval  = 10 * time.Second
+	DefaultStandingOrderBatchSize = 100
+)
+
+// MaxStandingOrdersPage is the largest number of standing orders or occurrences listed at once
+const MaxStandingOrdersPage = 1000
+
+// StandingOrderServicePort defines the service interface for standing orders
+//
+//go:generate mockgen -destination=../mocks/mock_standing_order_service.go -package=mocks internal-transfers/internal/services StandingOrderServicePort
+type StandingOrderServicePort interface {
+	CreateStandingOrder(order model.StandingOrder) (model.StandingOrder, error)
+	GetStandingOrder(id int64) (model.StandingOrder, error)
+	ListStandingOrders(status model.StandingOrderStatus, limit int) ([]model.StandingOrder, error)
+	CancelStandingOrder(id int64) (model.StandingOrder, error)
+	ListOccurrences(id int64, limit int) ([]model.StandingOrderOccurrence, error)
+}
+
+// StandingOrderService manages standing orders and runs their occurrences.
+//
+// Schedules run in the time zone of the calendar, and each occurrence is due
+// once its order's business day rule moved it (see calendar.Calendar.Adjust).
+// Each due occurrence becomes one transfer. Schedulers on all
+// replicas poll for due orders; an order is handled by one scheduler at a time
+// under a per-order lock (a Postgres advisory lock), and each occurrence is
+// recorded in the same transaction as its transfer, so it runs exactly once
+// even if the lock is lost or the scheduler dies mid-transfer.
+type StandingOrderService struct {
+	accounts  *AccountService
+	orders    db.StandingOrderRepositoryPort
+	calendar  *calendar.Calendar
+	interval  time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+// NewStandingOrderService returns the service; a nil cal is calendar.Default()
+func NewStandingOrderService(accounts *AccountService, orders db.StandingOrderRepositoryPort, interval time.Duration, cal *calendar.Calendar) *StandingOrderService {
+	if interval <= 0 {
+		interval = DefaultStandingOrderInterval
+	}
+	if cal == nil {
+		cal = calendar.Default()
+	}
+	return &StandingOrderService{
+		accounts:  accounts,
+		orders:    orders,
+		calendar:  cal,
+		interval:  interval,
+		batchSize: DefaultStandingOrderBatchSize,
+		now:       time.Now,
+	}
+}
+
+// CreateStandingOrder validates and stores a standing order. Its first
+// occurrence is the first one at or after the later of StartAt and now; a zero
+// StartAt starts the schedule now, and an empty BusinessDayRule is the
+// calendar's default.
+func (s *StandingOrderService) CreateStandingOrder(order model.StandingOrder) (model.StandingOrder, error) {
+	if err := s.accounts.validateTransfer(order.SourceAccountID, order.DestinationAccountID, order.Amount); err != nil {
+		return model.StandingOrder{}, err
+	}
+	now := s.now().UTC().Truncate(time.Microsecond)
+	if order.StartAt.IsZero() {
+		order.StartAt = now
+	}
+	// Postgres keeps microseconds; truncating here keeps the schedule anchor identical in both stores
+	order.StartAt = order.StartAt.UTC().Truncate(time.Microsecond)
+	if order.EndAt != nil {
+		end := order.EndAt.UTC().Truncate(time.Microsecond)
+		if end.Before(order.StartAt) {
+			return model.StandingOrder{}, model.ErrEndBeforeStart
+		}
+		order.EndAt = &end
+	}
+	if order.MaxOccurrences < 0 {
+		return model.StandingOrder{}, model.ErrInvalidMaxOccurrences
+	}
+	rule, err := s.calendar.ResolveRule(order.BusinessDayRule)
+	if err != nil {
+		return model.StandingOrder{}, err
+	}
+	order.BusinessDayRule = string(rule)
+
+	sched, err := s.parseSchedule(order)
+	if err != nil {
+		log.Printf("CreateStandingOrder invalid schedule %q: %v", order.Schedule, err)
+		return model.StandingOrder{}, err
+	}
+	first := schedule.First(sched, order.StartAt).UTC()
+	if first.Before(now) {
+		first = sched.Next(now.Add(-time.Nanosecond)).UTC()
+	}
+	if first.IsZero() || (order.EndAt != nil && first.After(*order.EndAt)) {
+		return model.StandingOrder{}, model.ErrNoOccurrences
+	}
+	runAt := s.calendar.Adjust(first, rule)
+	order.NextOccurrenceAt, order.NextRunAt = &first, &runAt
+
+	created, err := s.orders.CreateStandingOrder(order)
+	if err != nil {
+		log.Printf("CreateStandingOrder db error: %v", err)
+		return model.StandingOrder{}, err
+	}
+	log.Printf("Standing order %d created: %d -> %d, amount: %v, schedule: %q, first run at %v",
+		created.ID, created.SourceAccountID, created.DestinationAccountID, created.Amount, created.Schedule, runAt)
+	return created, nil
+}
+
+// GetStandingOrder returns a standing order
+func (s *StandingOrderService) GetStandingOrder(id int64) (model.StandingOrder, error) {
+	if id <= 0 {
+		return model.StandingOrder{}, model.ErrStandingOrderIDMustBePositive
+	}
+	order, err := s.orders.GetStandingOrder(id)
+	if err != nil && !errors.Is(err, model.ErrStandingOrderNotFound) {
+		log.Printf("GetStandingOrder db error: %v", err)
+	}
+	return order, err
+}
+
+// ListStandingOrders returns up to limit standing orders in id order,
+// optionally only those with status
+func (s *StandingOrderService) ListStandingOrders(status model.StandingOrderStatus, limit int) ([]model.StandingOrder, error) {
+	if limit <= 0 || limit > MaxStandingOrdersPage {
+		limit = MaxStandingOrdersPage
+	}
+	orders, err := s.orders.ListStandingOrders(status, limit)
+	if err != nil {
+		log.Printf("ListStandingOrders db error: %v", err)
+	}
+	return orders, err
+}
+
+// CancelStandingOrder stops an active standing order; an occurrence already
+// running still finishes
+func (s *StandingOrderService) CancelStandingOrder(id int64) (model.StandingOrder, error) {
+	if id <= 0 {
+		return model.StandingOrder{}, model.ErrStandingOrderIDMustBePositive
+	}
+	order, err := s.orders.CancelStandingOrder(id)
+	switch {
+	case err == nil:
+		log.Printf("Standing order %d cancelled", id)
+	case errors.Is(err, model.ErrStandingOrderNotFound), errors.Is(err, model.ErrStandingOrderNotActive):
+	default:
+		log.Printf("CancelStandingOrder db error: %v", err)
+	}
+	return order, err
+}
+
+// ListOccurrences returns up to limit occurrences of a standing order, most recent first
+func (s *StandingOrderService) ListOccurrences(id int64, limit int) ([]model.StandingOrderOccurrence, error) {
+	if _, err := s.GetStandingOrder(id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxStandingOrdersPage {
+		limit = MaxStandingOrdersPage
+	}
+	occurrences, err := s.orders.ListOccurrences(id, limit)
+	if err != nil {
+		log.Printf("ListOccurrences db error: %v", err)
+	}
+	return occurrences, err
+}
+
+// Run runs due occurrences every interval until ctx is cancelled
+func (s *StandingOrderService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// Keep going while there is work beyond one batch
+		for ctx.Err() == nil {
+			if n, err := s.RunDue(); err != nil || n == 0 {
+				break
+			}
+		}
+	}
+}
+
+// RunDue runs the due occurrences of up to one batch of standing orders,
+// returning how many occurrences ran. An order that missed several
+// occurrences, for instance while no scheduler was running, catches up on all
+// of them.
+func (s *StandingOrderService) RunDue() (int, error) {
+	due, err := s.orders.DueStandingOrders(s.now().UTC(), s.batchSize)
+	if err != nil {
+		log.Printf("Standing order scheduler failed to list due orders: %v", err)
+		return 0, err
+	}
+	ran := 0
+	for _, id := range due {
+		n, err := s.runOrder(id)
+		if err != nil {
+			log.Printf("Standing order %d occurrence failed, retrying on the next run: %v", id, err)
+		}
+		ran += n
+	}
+	return ran, nil
+}
+
+// runOrder runs the due occurrences of a standing order, unless another
+// scheduler holds its lock
+func (s *StandingOrderService) runOrder(id int64) (int, error) {
+	unlock, locked, err := s.orders.LockStandingOrder(id)
+	if err != nil || !locked {
+		return 0, err
+	}
+	defer unlock()
+
+	ran := 0
+	for {
+		// Re-read under the lock: another scheduler may have run the occurrence
+		order, err := s.orders.GetStandingOrder(id)
+		if err != nil {
+			return ran, err
+		}
+		if order.Status != model.StandingOrderActive || order.NextOccurrenceAt == nil || order.NextRunAt.After(s.now()) {
+			return ran, nil
+		}
+		if err := s.runOccurrence(order, *order.NextOccurrenceAt); err != nil {
+			return ran, err
+		}
+		ran++
+	}
+}
+
+// runOccurrence makes the transfer of one occurrence and moves the order on.
+// The occurrence is recorded, the funds moved and the order moved on in one
+// transaction, so an occurrence either ran exactly once or not at all. Must be
+// called with the order lock held.
+func (s *StandingOrderService) runOccurrence(order model.StandingOrder, occurrence time.Time) error {
+	next, nextRunAt, err := s.nextOccurrence(order, occurrence)
+	if err != nil {
+		return err
+	}
+
+	err = s.accounts.inTx(func(txn db.TransactionPort) error {
+		if err := s.orders.StartOccurrence(txn, order.ID, occurrence); err != nil {
+			return err
+		}
+		if err := s.accounts.transferInTx(txn, order.SourceAccountID, order.DestinationAccountID, order.Amount, clientSource); err != nil {
+			return err
+		}
+		return s.orders.FinishOccurrence(txn, order.ID, occurrence, model.TransferCompleted, "", next, nextRunAt)
+	})
+	if err == nil {
+		s.accounts.committed(order.SourceAccountID, order.DestinationAccountID)
+		log.Printf("Standing order %d occurrence at %v completed", order.ID, occurrence)
+		return nil
+	}
+
+	// Everything was rolled back; record the failure on its own
+	started := errors.Is(err, db.ErrOccurrenceExists)
+	code := model.ErrorCode(err)
+	switch {
+	case started:
+		// Left processing by a version that recorded occurrences before their transfer
+		log.Printf("Standing order %d occurrence at %v was interrupted and is not repeated; reconcile it by hand", order.ID, occurrence)
+		code = model.OccurrenceInterrupted
+	case code == "":
+		// Nothing was recorded, so the occurrence runs again
+		return err
+	}
+	err = s.accounts.inTx(func(txn db.TransactionPort) error {
+		if !started {
+			if err := s.orders.StartOccurrence(txn, order.ID, occurrence); err != nil {
+				return err
+			}
+		}
+		return s.orders.FinishOccurrence(txn, order.ID, occurrence, model.TransferFailed, code, next, nextRunAt)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Standing order %d occurrence at %v failed: %s", order.ID, occurrence, code)
+	return nil
+}
+
+// nextOccurrence returns the occurrence after the given one and when it is
+// due, or nils when the order ends with it
+func (s *StandingOrderService) nextOccurrence(order model.StandingOrder, occurrence time.Time) (*time.Time, *time.Time, error) {
+	if order.MaxOccurrences > 0 && order.Occurrences+1 >= order.MaxOccurrences {
+		return nil, nil, nil
+	}
+	sched, err := s.parseSchedule(order)
+	if err != nil {
+		return nil, nil, err
+	}
+	next := sched.Next(occurrence).UTC()
+	if next.IsZero() || (order.EndAt != nil && next.After(*order.EndAt)) {
+		return nil, nil, nil
+	}
+	rule, err := calendar.ParseRule(order.BusinessDayRule)
+	if err != nil {
+		return nil, nil, err
+	}
+	runAt := s.calendar.Adjust(next, rule)
+	return &next, &runAt, nil
+}
+
+// parseSchedule parses the schedule of order in the calendar's time zone, so
+// that named schedules and cron fields follow its local time
+func (s *StandingOrderService) parseSchedule(order model.StandingOrder) (schedule.Schedule, error) {
+	return schedule.Parse(order.Schedule, order.StartAt.In(s.calendar.Location()), s.calendar.IsBusinessDay)
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"internal-transfers/internal/calendar"
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// standingOrderClock is the time the standing order tests start at, a Monday
+var standingOrderClock = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// newStandingOrderTest returns a service whose clock is read from *now
+func newStandingOrderTest(t *testing.T, now *time.Time) (*StandingOrderService, db.AccountRepositoryPort, db.StandingOrderRepositoryPort) {
+	store := db.NewMemoryStore()
+	accounts := db.NewMemoryAccountRepository(store)
+	orders := db.NewMemoryStandingOrderRepository(store)
+	require.NoError(t, accounts.CreateAccount(1, decimal.NewFromInt(100)))
+	require.NoError(t, accounts.CreateAccount(2, decimal.Zero))
+	svc := NewStandingOrderService(NewAccountService(accounts), orders, 0, nil)
+	svc.now = func() time.Time { return *now }
+	return svc, accounts, orders
+}
+
+func dailyOrder(amount int64) model.StandingOrder {
+	return model.StandingOrder{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               decimal.NewFromInt(amount),
+		Schedule:             "daily",
+		StartAt:              standingOrderClock,
+	}
+}
+
+func requireOccurrences(t *testing.T, svc *StandingOrderService, id int64, want ...model.TransferStatus) []model.StandingOrderOccurrence {
+	t.Helper()
+	occurrences, err := svc.ListOccurrences(id, 0)
+	require.NoError(t, err)
+	got := make([]model.TransferStatus, len(occurrences))
+	for i, o := range occurrences {
+		got[i] = o.Status
+	}
+	assert.Equal(t, want, got)
+	return occurrences
+}
+
+func TestStandingOrder_RunsEachOccurrenceUntilMaxOccurrences(t *testing.T) {
+	now := standingOrderClock
+	svc, accounts, _ := newStandingOrderTest(t, &now)
+	order := dailyOrder(10)
+	order.MaxOccurrences = 3
+	created, err := svc.CreateStandingOrder(order)
+	require.NoError(t, err)
+	require.NotNil(t, created.NextRunAt)
+	assert.Equal(t, standingOrderClock, *created.NextRunAt)
+
+	ran, err := svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	ran, err = svc.RunDue()
+	require.NoError(t, err)
+	assert.Zero(t, ran, "the next occurrence is not due yet")
+	requireAccountBalance(t, accounts, 2, 10)
+
+	// Missed occurrences catch up, and the order stops at its limit
+	now = standingOrderClock.AddDate(0, 0, 5)
+	ran, err = svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 2, ran)
+	requireAccountBalance(t, accounts, 1, 70)
+	requireAccountBalance(t, accounts, 2, 30)
+
+	got, err := svc.GetStandingOrder(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StandingOrderCompleted, got.Status)
+	assert.Equal(t, 3, got.Occurrences)
+	assert.Nil(t, got.NextRunAt)
+	occurrences := requireOccurrences(t, svc, created.ID, model.TransferCompleted, model.TransferCompleted, model.TransferCompleted)
+	assert.Equal(t, standingOrderClock.AddDate(0, 0, 2), occurrences[0].ScheduledFor)
+}
+
+func TestStandingOrder_StopsAtEndDate(t *testing.T) {
+	now := standingOrderClock.AddDate(0, 0, 10)
+	svc, accounts, _ := newStandingOrderTest(t, &now)
+	order := dailyOrder(1)
+	order.Schedule = "weekly"
+	end := standingOrderClock.AddDate(0, 0, 20)
+	order.EndAt = &end
+	created, err := svc.CreateStandingOrder(order)
+	require.NoError(t, err)
+	// Occurrences before creation are not back-dated
+	assert.Equal(t, standingOrderClock.AddDate(0, 0, 14), *created.NextRunAt)
+
+	now = end
+	ran, err := svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 2, 1)
+
+	got, err := svc.GetStandingOrder(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StandingOrderCompleted, got.Status)
+}
+
+func TestStandingOrder_RecordsFailedOccurrenceAndContinues(t *testing.T) {
+	now := standingOrderClock
+	svc, accounts, _ := newStandingOrderTest(t, &now)
+	created, err := svc.CreateStandingOrder(dailyOrder(60))
+	require.NoError(t, err)
+
+	now = standingOrderClock.AddDate(0, 0, 1)
+	ran, err := svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 2, ran)
+	requireAccountBalance(t, accounts, 1, 40)
+
+	occurrences := requireOccurrences(t, svc, created.ID, model.TransferFailed, model.TransferCompleted)
+	assert.Equal(t, "insufficient_funds", occurrences[0].ErrorCode)
+	got, err := svc.GetStandingOrder(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StandingOrderActive, got.Status)
+	assert.Equal(t, standingOrderClock.AddDate(0, 0, 2), *got.NextRunAt)
+}
+
+func TestStandingOrder_NeverDebitsClearingAccount(t *testing.T) {
+	now := standingOrderClock
+	svc, accounts, _ := newStandingOrderTest(t, &now)
+	require.NoError(t, accounts.(db.AccountTypePort).CreateTypedAccount(model.Account{AccountID: 90, Type: model.AccountAsset}))
+	order := dailyOrder(10)
+	order.SourceAccountID = 90
+	created, err := svc.CreateStandingOrder(order)
+	require.NoError(t, err)
+
+	_, err = svc.RunDue()
+	require.NoError(t, err)
+	occurrences := requireOccurrences(t, svc, created.ID, model.TransferFailed)
+	assert.Equal(t, "system_account_source", occurrences[0].ErrorCode)
+	requireAccountBalance(t, accounts, 90, 0)
+}
+
+func TestStandingOrder_InterruptedOccurrenceIsNotRepeated(t *testing.T) {
+	now := standingOrderClock
+	svc, accounts, orders := newStandingOrderTest(t, &now)
+	created, err := svc.CreateStandingOrder(dailyOrder(10))
+	require.NoError(t, err)
+	// A scheduler started the occurrence and died
+	require.NoError(t, orders.StartOccurrence(nil, created.ID, standingOrderClock))
+
+	ran, err := svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 1, 100)
+
+	occurrences := requireOccurrences(t, svc, created.ID, model.TransferFailed)
+	assert.Equal(t, model.OccurrenceInterrupted, occurrences[0].ErrorCode)
+	got, err := svc.GetStandingOrder(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Occurrences)
+}
+
+// failingFinishRepository fails the first FinishOccurrence with an error that
+// is not a domain error
+type failingFinishRepository struct {
+	db.StandingOrderRepositoryPort
+	failed bool
+}
+
+func (r *failingFinishRepository) FinishOccurrence(tx db.TransactionPort, orderID int64, scheduledFor time.Time, status model.TransferStatus, errorCode string, next, nextRunAt *time.Time) error {
+	if !r.failed {
+		r.failed = true
+		return errors.New("connection reset")
+	}
+	return r.StandingOrderRepositoryPort.FinishOccurrence(tx, orderID, scheduledFor, status, errorCode, next, nextRunAt)
+}
+
+func TestStandingOrder_FailedFinishRollsBackTransfer(t *testing.T) {
+	now := standingOrderClock
+	svc, accounts, orders := newStandingOrderTest(t, &now)
+	svc.orders = &failingFinishRepository{StandingOrderRepositoryPort: orders}
+	created, err := svc.CreateStandingOrder(dailyOrder(10))
+	require.NoError(t, err)
+
+	ran, err := svc.RunDue()
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+	requireAccountBalance(t, accounts, 2, 0)
+	occurrences, err := svc.ListOccurrences(created.ID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, occurrences)
+
+	// Nothing was recorded, so the next run makes the transfer once
+	ran, err = svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 2, 10)
+	requireOccurrences(t, svc, created.ID, model.TransferCompleted)
+}
+
+func TestStandingOrder_SkipsOrdersLockedByAnotherScheduler(t *testing.T) {
+	now := standingOrderClock
+	svc, accounts, orders := newStandingOrderTest(t, &now)
+	created, err := svc.CreateStandingOrder(dailyOrder(10))
+	require.NoError(t, err)
+
+	unlock, locked, err := orders.LockStandingOrder(created.ID)
+	require.NoError(t, err)
+	require.True(t, locked)
+	ran, err := svc.RunDue()
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+	requireAccountBalance(t, accounts, 2, 0)
+
+	unlock()
+	ran, err = svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 2, 10)
+}
+
+func TestStandingOrder_MovedByBusinessDayRule(t *testing.T) {
+	now := standingOrderClock
+	svc, accounts, _ := newStandingOrderTest(t, &now)
+	order := dailyOrder(10)
+	order.Schedule = "monthly:7"
+	order.BusinessDayRule = "preceding"
+	created, err := svc.CreateStandingOrder(order)
+	require.NoError(t, err)
+	// March 7 is a Saturday
+	assert.Equal(t, time.Date(2026, 3, 7, 9, 0, 0, 0, time.UTC), *created.NextOccurrenceAt)
+	assert.Equal(t, time.Date(2026, 3, 6, 9, 0, 0, 0, time.UTC), *created.NextRunAt)
+
+	now = *created.NextRunAt
+	ran, err := svc.RunDue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	requireAccountBalance(t, accounts, 2, 10)
+	occurrences := requireOccurrences(t, svc, created.ID, model.TransferCompleted)
+	assert.Equal(t, *created.NextOccurrenceAt, occurrences[0].ScheduledFor, "occurrences keep their unadjusted time")
+
+	got, err := svc.GetStandingOrder(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 4, 7, 9, 0, 0, 0, time.UTC), *got.NextOccurrenceAt)
+	assert.Equal(t, time.Date(2026, 4, 7, 9, 0, 0, 0, time.UTC), *got.NextRunAt)
+
+	// Without a rule the calendar's default applies
+	order.BusinessDayRule = ""
+	created, err = svc.CreateStandingOrder(order)
+	require.NoError(t, err)
+	assert.Equal(t, string(calendar.Following), created.BusinessDayRule)
+	assert.Equal(t, time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC), *created.NextRunAt)
+}
+
+func TestStandingOrder_ScheduleFollowsCalendarTimeZone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	now := standingOrderClock
+	svc, _, _ := newStandingOrderTest(t, &now)
+	svc.calendar = calendar.New(calendar.Options{Location: newYork, Rule: calendar.RuleNone})
+
+	order := dailyOrder(1)
+	order.StartAt = time.Date(2026, 3, 7, 14, 0, 0, 0, time.UTC) // 09:00 EST
+	created, err := svc.CreateStandingOrder(order)
+	require.NoError(t, err)
+
+	// Clocks go forward on March 8; the order stays at 09:00 local time
+	now = time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	_, err = svc.RunDue()
+	require.NoError(t, err)
+	occurrences := requireOccurrences(t, svc, created.ID, model.TransferCompleted, model.TransferCompleted)
+	assert.Equal(t, time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC), occurrences[0].ScheduledFor)
+}
+
+func TestStandingOrder_Cancel(t *testing.T) {
+	now := standingOrderClock
+	svc, accounts, _ := newStandingOrderTest(t, &now)
+	created, err := svc.CreateStandingOrder(dailyOrder(10))
+	require.NoError(t, err)
+
+	cancelled, err := svc.CancelStandingOrder(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StandingOrderCancelled, cancelled.Status)
+	_, err = svc.CancelStandingOrder(created.ID)
+	assert.ErrorIs(t, err, model.ErrStandingOrderNotActive)
+
+	ran, err := svc.RunDue()
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+	requireAccountBalance(t, accounts, 2, 0)
+}
+
+func TestStandingOrder_CreateValidation(t *testing.T) {
+	now := standingOrderClock
+	svc, _, _ := newStandingOrderTest(t, &now)
+
+	endBeforeStart := standingOrderClock.Add(-time.Hour)
+	endBeforeFirst := standingOrderClock.Add(time.Hour)
+	testCases := []struct {
+		name   string
+		modify func(*model.StandingOrder)
+		want   error
+	}{
+		{"SameAccount", func(o *model.StandingOrder) { o.DestinationAccountID = 1 }, model.ErrSourceAndDestinationMustDiffer},
+		{"SystemAccount", func(o *model.StandingOrder) { o.SourceAccountID = model.FeesAccountID }, model.ErrSystemAccountNotAllowed},
+		{"NonPositiveAmount", func(o *model.StandingOrder) { o.Amount = decimal.Zero }, model.ErrAmountMustBePositive},
+		{"InvalidSchedule", func(o *model.StandingOrder) { o.Schedule = "fortnightly" }, model.ErrInvalidSchedule},
+		{"EndBeforeStart", func(o *model.StandingOrder) { o.EndAt = &endBeforeStart }, model.ErrEndBeforeStart},
+		{"NegativeMaxOccurrences", func(o *model.StandingOrder) { o.MaxOccurrences = -1 }, model.ErrInvalidMaxOccurrences},
+		{"NoOccurrenceBeforeEnd", func(o *model.StandingOrder) { o.Schedule = "monthly:15"; o.EndAt = &endBeforeFirst }, model.ErrNoOccurrences},
+		{"InvalidBusinessDayRule", func(o *model.StandingOrder) { o.BusinessDayRule = "nearest" }, model.ErrInvalidBusinessDayRule},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			order := dailyOrder(10)
+			tc.modify(&order)
+			_, err := svc.CreateStandingOrder(order)
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+
+	_, err := svc.GetStandingOrder(0)
+	assert.ErrorIs(t, err, model.ErrStandingOrderIDMustBePositive)
+	_, err = svc.ListOccurrences(42, 0)
+	assert.ErrorIs(t, err, model.ErrStandingOrderNotFound)
+}
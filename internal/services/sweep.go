@@ -0,0 +1,193 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"internal-transfers/internal/db"
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// MaxSweepSources is the largest number of sources of one sweep
+const MaxSweepSources = 100
+
+// SweepTransfer pulls funds from the sources into the destination in one
+// transaction. Each source gives a fixed amount or everything above its floor;
+// a source with nothing above its floor is skipped. In atomic mode, the empty
+// default, a source that cannot be swept fails the whole sweep. In best-effort
+// mode it is reported as failed and the other sources are swept.
+//
+// When funds move, the sweep is recorded as a completed parent transfer
+// without a source, with one child leg per swept source.
+func (s *AsyncTransferService) SweepTransfer(destID int64, sources []model.SweepSource, mode model.SweepMode, details model.TransferDetails) (model.Sweep, error) {
+	if mode == "" {
+		mode = model.SweepAtomic
+	}
+	if mode != model.SweepAtomic && mode != model.SweepBestEffort {
+		return model.Sweep{}, fmt.Errorf("%w: unknown mode %q", model.ErrInvalidSweep, mode)
+	}
+	if err := validateAccountID(destID); err != nil {
+		log.Printf("SweepTransfer validation failed for destID: %v", err)
+		return model.Sweep{}, err
+	}
+	if err := validateClientAccounts(destID); err != nil {
+		log.Printf("SweepTransfer to system account: %d", destID)
+		return model.Sweep{}, err
+	}
+	if err := s.validateSweepSources(destID, sources); err != nil {
+		log.Printf("SweepTransfer validation failed: %v", err)
+		return model.Sweep{}, err
+	}
+	details, err := s.validateDetails(details)
+	if err != nil {
+		return model.Sweep{}, err
+	}
+	if _, err := s.accounts.repo.GetAccountBalance(nil, destID); err != nil {
+		if errors.Is(err, model.ErrAccountNotFound) {
+			return model.Sweep{}, model.ErrDestinationAccountNotFound
+		}
+		log.Printf("SweepTransfer db error: %v", err)
+		return model.Sweep{}, err
+	}
+
+	var sweep model.Sweep
+	err = s.accounts.inTx(func(txn db.TransactionPort) error {
+		var err error
+		sweep, err = s.sweepInTx(txn, destID, sources, mode, details)
+		return err
+	})
+	if err != nil {
+		if model.ErrorCode(err) == "" && !errors.Is(err, model.ErrDuplicateExternalReference) {
+			log.Printf("SweepTransfer db error: %v", err)
+		}
+		return model.Sweep{}, err
+	}
+	log.Printf("Transfer %d swept %v from %d of %d sources into %d", sweep.Transfer.ID, sweep.Transfer.Amount, len(sweep.Transfer.Legs), len(sources), destID)
+	for _, leg := range sweep.Transfer.Legs {
+		s.accounts.committed(leg.SourceAccountID, leg.DestinationAccountID)
+	}
+	return sweep, nil
+}
+
+// sweepInTx locks the sources, works out what each gives and books the
+// sweep within txn
+func (s *AsyncTransferService) sweepInTx(txn db.TransactionPort, destID int64, sources []model.SweepSource, mode model.SweepMode, details model.TransferDetails) (model.Sweep, error) {
+	sweep := model.Sweep{Results: make([]model.SweepResult, len(sources))}
+	total := decimal.Zero
+	for i, source := range sources {
+		result := &sweep.Results[i]
+		result.SourceAccountID = source.SourceAccountID
+		amount, err := s.sweepAmount(txn, source)
+		switch {
+		case err == nil && amount.IsZero():
+			result.Status = model.SweepResultSkipped
+		case err == nil:
+			result.Amount = amount
+			total = total.Add(amount)
+		case model.ErrorCode(err) != "" && mode == model.SweepBestEffort:
+			log.Printf("SweepTransfer source %d failed: %v", source.SourceAccountID, err)
+			result.Status = model.SweepResultFailed
+			result.ErrorCode = model.ErrorCode(err)
+		case model.ErrorCode(err) != "":
+			return model.Sweep{}, fmt.Errorf("source %d: %w", source.SourceAccountID, err)
+		default:
+			return model.Sweep{}, err
+		}
+	}
+	if total.IsZero() {
+		return sweep, nil
+	}
+
+	parent, err := s.transfers.BookTransfer(txn, model.Transfer{DestinationAccountID: destID, Amount: total, Kind: model.TransferKindSweep, TransferDetails: details})
+	if err != nil {
+		return model.Sweep{}, err
+	}
+	for i := range sweep.Results {
+		result := &sweep.Results[i]
+		if result.Status != "" {
+			continue
+		}
+		leg, err := s.transfers.BookTransfer(txn, model.Transfer{SourceAccountID: result.SourceAccountID, DestinationAccountID: destID, Amount: result.Amount, ParentID: &parent.ID})
+		if err != nil {
+			return model.Sweep{}, err
+		}
+		if err = s.accounts.transferInTx(txn, result.SourceAccountID, destID, result.Amount, clientSource); err != nil {
+			return model.Sweep{}, err
+		}
+		result.Status = model.SweepResultCompleted
+		result.TransferID = leg.ID
+		parent.Legs = append(parent.Legs, leg)
+	}
+	sweep.Transfer = parent
+	return sweep, nil
+}
+
+// sweepAmount locks a source and returns what it gives: its fixed amount if
+// the balance covers it, or what is above its floor
+func (s *AsyncTransferService) sweepAmount(txn db.TransactionPort, source model.SweepSource) (decimal.Decimal, error) {
+	balance, err := s.accounts.repo.GetAccountBalance(txn, source.SourceAccountID)
+	if err != nil {
+		if errors.Is(err, model.ErrAccountNotFound) {
+			return decimal.Zero, model.ErrSourceAccountNotFound
+		}
+		return decimal.Zero, err
+	}
+	if source.Floor != nil {
+		if balance.LessThanOrEqual(*source.Floor) {
+			return decimal.Zero, nil
+		}
+		return balance.Sub(*source.Floor), nil
+	}
+	if balance.LessThan(source.Amount) {
+		return decimal.Zero, model.ErrInsufficientFunds
+	}
+	return source.Amount, nil
+}
+
+// validateSweepSources checks the sources of a sweep and their amounts and floors
+func (s *AsyncTransferService) validateSweepSources(destID int64, sources []model.SweepSource) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("%w: at least one source is required", model.ErrInvalidSweep)
+	}
+	if len(sources) > MaxSweepSources {
+		return fmt.Errorf("%w: more than %d sources", model.ErrInvalidSweep, MaxSweepSources)
+	}
+	seen := make(map[int64]bool, len(sources))
+	for _, source := range sources {
+		if err := validateAccountID(source.SourceAccountID); err != nil {
+			return err
+		}
+		if source.SourceAccountID == destID {
+			return model.ErrSourceAndDestinationMustDiffer
+		}
+		if err := validateClientAccounts(source.SourceAccountID); err != nil {
+			return err
+		}
+		if seen[source.SourceAccountID] {
+			return fmt.Errorf("%w: source %d is listed twice", model.ErrInvalidSweep, source.SourceAccountID)
+		}
+		seen[source.SourceAccountID] = true
+		if source.Floor == nil {
+			if !source.Amount.IsPositive() {
+				return model.ErrAmountMustBePositive
+			}
+			if err := s.accounts.validateDecimalPrecision(source.Amount); err != nil {
+				return err
+			}
+			continue
+		}
+		if !source.Amount.IsZero() {
+			return fmt.Errorf("%w: source %d needs either an amount or a floor", model.ErrInvalidSweep, source.SourceAccountID)
+		}
+		if source.Floor.IsNegative() {
+			return fmt.Errorf("%w: floor of source %d is negative", model.ErrInvalidSweep, source.SourceAccountID)
+		}
+		if err := s.accounts.validateDecimalPrecision(*source.Floor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"testing"
+
+	"internal-transfers/internal/model"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixedSource(source int64, amount int64) model.SweepSource {
+	return model.SweepSource{SourceAccountID: source, Amount: decimal.NewFromInt(amount)}
+}
+
+func floorSource(source int64, floor int64) model.SweepSource {
+	f := decimal.NewFromInt(floor)
+	return model.SweepSource{SourceAccountID: source, Floor: &f}
+}
+
+// newSweepTest funds accounts 3 and 4 with 50 each; account 2 is the treasury
+func newSweepTest(t *testing.T) (*AsyncTransferService, func(accountID int64, want int64)) {
+	svc, accounts, _ := newAsyncTransferTest(t, AsyncTransferOptions{})
+	require.NoError(t, accounts.CreateAccount(3, decimal.NewFromInt(50)))
+	require.NoError(t, accounts.CreateAccount(4, decimal.NewFromInt(50)))
+	return svc, func(accountID int64, want int64) {
+		t.Helper()
+		requireAccountBalance(t, accounts, accountID, want)
+	}
+}
+
+func TestSweepTransfer(t *testing.T) {
+	svc, requireBalance := newSweepTest(t)
+
+	sweep, err := svc.SweepTransfer(2, []model.SweepSource{floorSource(1, 20), fixedSource(3, 15), floorSource(4, 60)}, "", model.TransferDetails{ExternalReference: "eod_1"})
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferKindSweep, sweep.Transfer.Kind)
+	assert.True(t, sweep.Transfer.Amount.Equal(decimal.NewFromInt(95)), "got %s", sweep.Transfer.Amount)
+	require.Len(t, sweep.Transfer.Legs, 2)
+	requireBalance(1, 20)
+	requireBalance(2, 95)
+	requireBalance(3, 35)
+	requireBalance(4, 50)
+
+	require.Len(t, sweep.Results, 3)
+	assert.Equal(t, model.SweepResultCompleted, sweep.Results[0].Status)
+	assert.True(t, sweep.Results[0].Amount.Equal(decimal.NewFromInt(80)))
+	assert.Equal(t, sweep.Transfer.Legs[0].ID, sweep.Results[0].TransferID)
+	assert.Equal(t, model.SweepResultCompleted, sweep.Results[1].Status)
+	assert.Equal(t, model.SweepResultSkipped, sweep.Results[2].Status, "nothing above the floor")
+
+	got, err := svc.GetTransfer(sweep.Transfer.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Legs, 2)
+	assert.Zero(t, got.SourceAccountID)
+
+	// Swept again, every source is at its floor and nothing is recorded
+	sweep, err = svc.SweepTransfer(2, []model.SweepSource{floorSource(1, 20)}, model.SweepAtomic, model.TransferDetails{})
+	require.NoError(t, err)
+	assert.Zero(t, sweep.Transfer.ID)
+	assert.Equal(t, model.SweepResultSkipped, sweep.Results[0].Status)
+}
+
+func TestSweepTransfer_Atomic(t *testing.T) {
+	svc, requireBalance := newSweepTest(t)
+
+	_, err := svc.SweepTransfer(2, []model.SweepSource{fixedSource(3, 10), fixedSource(4, 60)}, model.SweepAtomic, model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrInsufficientFunds)
+	assert.ErrorContains(t, err, "source 4")
+	_, err = svc.SweepTransfer(2, []model.SweepSource{fixedSource(3, 10), fixedSource(9, 10)}, model.SweepAtomic, model.TransferDetails{})
+	assert.ErrorIs(t, err, model.ErrSourceAccountNotFound)
+	requireBalance(2, 0)
+	requireBalance(3, 50)
+}
+
+func TestSweepTransfer_BestEffort(t *testing.T) {
+	svc, requireBalance := newSweepTest(t)
+
+	sweep, err := svc.SweepTransfer(2, []model.SweepSource{fixedSource(3, 10), fixedSource(4, 60), fixedSource(9, 10)}, model.SweepBestEffort, model.TransferDetails{})
+	require.NoError(t, err)
+	require.Len(t, sweep.Transfer.Legs, 1)
+	assert.Equal(t, model.SweepResultCompleted, sweep.Results[0].Status)
+	assert.Equal(t, model.SweepResultFailed, sweep.Results[1].Status)
+	assert.Equal(t, "insufficient_funds", sweep.Results[1].ErrorCode)
+	assert.Equal(t, model.SweepResultFailed, sweep.Results[2].Status)
+	assert.Equal(t, "source_account_not_found", sweep.Results[2].ErrorCode)
+	requireBalance(2, 10)
+	requireBalance(3, 40)
+	requireBalance(4, 50)
+}
+
+func TestSweepTransfer_Validation(t *testing.T) {
+	svc, _ := newSweepTest(t)
+	negative := decimal.NewFromInt(-1)
+
+	testCases := []struct {
+		name    string
+		dest    int64
+		sources []model.SweepSource
+		mode    model.SweepMode
+		want    error
+	}{
+		{"no sources", 2, nil, "", model.ErrInvalidSweep},
+		{"unknown mode", 2, []model.SweepSource{fixedSource(3, 10)}, "eventually", model.ErrInvalidSweep},
+		{"duplicate source", 2, []model.SweepSource{fixedSource(3, 10), floorSource(3, 0)}, "", model.ErrInvalidSweep},
+		{"source is the destination", 2, []model.SweepSource{fixedSource(2, 10)}, "", model.ErrSourceAndDestinationMustDiffer},
+		{"no amount", 2, []model.SweepSource{{SourceAccountID: 3}}, "", model.ErrAmountMustBePositive},
+		{"amount and floor", 2, []model.SweepSource{{SourceAccountID: 3, Amount: decimal.NewFromInt(1), Floor: &negative}}, "", model.ErrInvalidSweep},
+		{"negative floor", 2, []model.SweepSource{{SourceAccountID: 3, Floor: &negative}}, "", model.ErrInvalidSweep},
+		{"missing destination", 9, []model.SweepSource{fixedSource(3, 10)}, "", model.ErrDestinationAccountNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.SweepTransfer(tc.dest, tc.sources, tc.mode, model.TransferDetails{})
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+}